@@ -1,6 +1,8 @@
 package cfg
 
 import (
+	"slices"
+
 	"codeberg.org/mjh/LibRate/internal/lib/thumbnailer"
 	"codeberg.org/mjh/LibRate/internal/logging"
 )
@@ -14,14 +16,15 @@ type Config struct {
 	Secret string `json:"secret,omitempty" yaml:"secret" mapstructure:"secret" env:"LIBRATE_SECRET"`
 	// default to production for security reasons
 	// nolint: revive
-	LibrateEnv string         `json:"librateEnv,omitempty" yaml:"librateEnv" default:"production" mapstructure:"librateEnv" env:"LIBRATE_ENV" validate:"oneof='test' 'development' 'production'"`
-	Redis      RedisConfig    `json:"redis,omitempty" yaml:"redis" mapstructure:"redis"`
-	Logging    logging.Config `json:"logging,omitempty" yaml:"logging" mapstructure:"logging"`
-	Keys       KeysConfig     `json:"keys,omitempty" yaml:"keys" mapstructure:"keys"`
-	JWTSecret  string         `json:"jwtSecret,omitempty" yaml:"jwtSecret" mapstructure:"jwtSecret" env:"LIBRATE_JWT_SECRET"`
-	GRPC       GrpcConfig     `json:"grpc,omitempty" yaml:"grpc" mapstructure:"grpc"`
-	External   External       `json:"external,omitempty" yaml:"external" mapstructure:"external"`
-	Search     SearchConfig   `json:"search,omitempty" yaml:"search" mapstructure:"search"`
+	LibrateEnv string           `json:"librateEnv,omitempty" yaml:"librateEnv" default:"production" mapstructure:"librateEnv" env:"LIBRATE_ENV" validate:"oneof='test' 'development' 'production'"`
+	Redis      RedisConfig      `json:"redis,omitempty" yaml:"redis" mapstructure:"redis"`
+	Logging    logging.Config   `json:"logging,omitempty" yaml:"logging" mapstructure:"logging"`
+	Keys       KeysConfig       `json:"keys,omitempty" yaml:"keys" mapstructure:"keys"`
+	JWTSecret  string           `json:"jwtSecret,omitempty" yaml:"jwtSecret" mapstructure:"jwtSecret" env:"LIBRATE_JWT_SECRET"`
+	GRPC       GrpcConfig       `json:"grpc,omitempty" yaml:"grpc" mapstructure:"grpc"`
+	External   External         `json:"external,omitempty" yaml:"external" mapstructure:"external"`
+	Search     SearchConfig     `json:"search,omitempty" yaml:"search" mapstructure:"search"`
+	Federation FederationConfig `json:"federation,omitempty" yaml:"federation" mapstructure:"federation"`
 }
 
 // nolint: musttag,revive // tagged in the struct above, can't break tags into multiline
@@ -66,10 +69,12 @@ type MeiliConfig struct {
 }
 
 type External struct {
-	// currently supported: json, id3, spotify (requires client ID and secret)
+	// currently supported: json, id3, spotify (requires client ID and secret), discogs
 	ImportSources       []string `yaml:"import_sources,omitempty" default:"json,id3" env:"LIBRATE_IMPORT_SOURCES"`
 	SpotifyClientID     string   `yaml:"spotify_client_id,omitempty" env:"SPOTIFY_CLIENT_ID"`
 	SpotifyClientSecret string   `yaml:"spotify_client_secret,omitempty" env:"SPOTIFY_CLIENT_SECRET"`
+	// optional, raises the rate limit of the Discogs API
+	DiscogsToken string `yaml:"discogs_token,omitempty" env:"DISCOGS_TOKEN"`
 }
 
 type RedisConfig struct {
@@ -101,6 +106,9 @@ type FiberConfig struct {
 	TLS             bool            `yaml:"tls" default:"false" env:"LIBRATE_TLS"`
 	MaxUploadSize   int64           `yaml:"maxUploadSize" default:"4194304" env:"LIBRATE_MAX_SIZE"`
 	Thumbnailing    ThumbnailConfig `yaml:"thumbnailing" default:"{namespaces: [{name: album_cover, size: {Width: 500, Height: 500}}]"`
+
+	// new members can't sign up while the registrations are closed
+	RegistrationsClosed bool `yaml:"registrationsClosed" default:"false" env:"LIBRATE_REGISTRATIONS_CLOSED"`
 }
 
 // FIXME: currently this cannot be reliably configured via environment variables
@@ -109,6 +117,18 @@ type ThumbnailConfig struct {
 	TargetNS []ThumbnailerNamespace `yaml:"namespaces" default:"[{names: {album_cover, film_poster} size: {Width: 500, Height: 500}}]"`
 }
 
+// DimsFor returns the thumbnail size for the given image type, or nil if images of this type
+// don't get thumbnails
+func (tc *ThumbnailConfig) DimsFor(imageType string) *thumbnailer.Dims {
+	for i := range tc.TargetNS {
+		// #wontfix providing more than one ns and all simultaneously
+		if slices.Contains(tc.TargetNS[i].Names, imageType) || tc.TargetNS[i].Names[0] == "all" {
+			return &tc.TargetNS[i].MaxSize
+		}
+	}
+	return nil
+}
+
 type ThumbnailerNamespace struct {
 	Names   []string         `yaml:"names" validate:"required,oneof='album_cover' 'film_poster' 'profile' 'all'"`
 	MaxSize thumbnailer.Dims `yaml:"size" default:"{Width: 500, Height: 500}"`
@@ -120,6 +140,18 @@ type KeysConfig struct {
 	Public  string `yaml:"public" default:"./keys/public.pem" env:"LIBRATE_PUBLIC_KEY"`
 }
 
+// FederationConfig controls the delivery of activities to other instances
+type FederationConfig struct {
+	// number of deliveries processed at the same time
+	DeliveryWorkers int `yaml:"deliveryWorkers,omitempty" default:"4" env:"LIBRATE_DELIVERY_WORKERS"`
+	// how many deliveries to a single host can be in flight, so that small instances aren't overwhelmed
+	MaxPerHost int `yaml:"maxPerHost,omitempty" default:"2" env:"LIBRATE_DELIVERY_MAX_PER_HOST"`
+	// failed deliveries are retried with exponential backoff, then moved to the dead letter queue
+	MaxAttempts int `yaml:"maxAttempts,omitempty" default:"10" env:"LIBRATE_DELIVERY_MAX_ATTEMPTS"`
+	// only federate with the domains explicitly allowed (or silenced) by the admins
+	AllowlistMode bool `yaml:"allowlistMode,omitempty" default:"false" env:"LIBRATE_FEDERATION_ALLOWLIST"`
+}
+
 type GrpcConfig struct {
 	Host            string `yaml:"host" default:"localhost" env:"LIBRATE_GRPC_HOST"`
 	Port            int    `yaml:"port" default:"3030" env:"LIBRATE_GRPC_PORT"`
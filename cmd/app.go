@@ -23,6 +23,7 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/etag"
 	"github.com/gofiber/fiber/v2/middleware/idempotency"
 	rec "github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/utils"
 	"github.com/gofiber/storage/redis/v3"
 )
 
@@ -106,6 +107,13 @@ func SetupMiddlewares(conf *cfg.Config,
 			Next: func(c *fiber.Ctx) bool {
 				return c.Query("cache") == "false" || c.Path() == "/api/authenticate/status" || strings.Contains(c.Route().Path, "/ws") || strings.Contains(c.Route().Path, "favicon")
 			},
+			// media and creators are served as ActivityStreams documents to other instances
+			KeyGenerator: func(c *fiber.Ctx) string {
+				if security.WantsActivityStreams(c) {
+					return utils.CopyString(c.Path()) + "|as"
+				}
+				return utils.CopyString(c.Path())
+			},
 		}),
 		compress.New(compress.Config{
 			Level: compress.LevelBestSpeed,
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"codeberg.org/mjh/LibRate/models"
+)
+
+// The dead letter service is small enough not to warrant generated code. Its messages
+// are the well-known Struct, ListValue and Empty types, so any reflection-aware client
+// (e.g. grpcurl) can call it:
+//
+//	grpcurl -plaintext -d '{"limit": 10}' localhost:3030 librate.federation.Deliveries/ListDeadLetters
+//	grpcurl -plaintext -d '{"id": 42}' localhost:3030 librate.federation.Deliveries/RetryDelivery
+const (
+	deliveriesService = "librate.federation.Deliveries"
+	deliveriesProto   = "librate/federation/deliveries.proto"
+)
+
+// DeliveriesServer allows administrators to inspect, retry and discard federated
+// deliveries which ran out of attempts
+type DeliveriesServer interface {
+	// ListDeadLetters accepts optional limit and offset fields
+	ListDeadLetters(ctx context.Context, req *structpb.Struct) (*structpb.ListValue, error)
+	// RetryDelivery and DiscardDelivery expect the id of the delivery
+	RetryDelivery(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error)
+	DiscardDelivery(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error)
+}
+
+var deliveriesServiceDesc = grpc.ServiceDesc{
+	ServiceName: deliveriesService,
+	HandlerType: (*DeliveriesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListDeadLetters",
+			Handler: unaryHandler(deliveriesService, "ListDeadLetters", func(srv DeliveriesServer, ctx context.Context, req *structpb.Struct) (any, error) {
+				return srv.ListDeadLetters(ctx, req)
+			}),
+		},
+		{
+			MethodName: "RetryDelivery",
+			Handler: unaryHandler(deliveriesService, "RetryDelivery", func(srv DeliveriesServer, ctx context.Context, req *structpb.Struct) (any, error) {
+				return srv.RetryDelivery(ctx, req)
+			}),
+		},
+		{
+			MethodName: "DiscardDelivery",
+			Handler: unaryHandler(deliveriesService, "DiscardDelivery", func(srv DeliveriesServer, ctx context.Context, req *structpb.Struct) (any, error) {
+				return srv.DiscardDelivery(ctx, req)
+			}),
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: deliveriesProto,
+}
+
+// unaryHandler adapts a method taking a Struct to the handler signature expected by grpc.MethodDesc
+func unaryHandler[S any](
+	service, method string,
+	call func(srv S, ctx context.Context, req *structpb.Struct) (any, error),
+) func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error) {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		req := new(structpb.Struct)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(S), ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: "/" + service + "/" + method,
+		}
+		return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+			return call(srv.(S), ctx, req.(*structpb.Struct))
+		})
+	}
+}
+
+// registerDeliveriesDescriptor makes the service visible to gRPC reflection
+func registerDeliveriesDescriptor() error {
+	return registerDescriptor(deliveriesProto, "Deliveries",
+		protoMethod("ListDeadLetters", ".google.protobuf.Struct", ".google.protobuf.ListValue"),
+		protoMethod("RetryDelivery", ".google.protobuf.Struct", ".google.protobuf.Empty"),
+		protoMethod("DiscardDelivery", ".google.protobuf.Struct", ".google.protobuf.Empty"),
+	)
+}
+
+// registerDescriptor registers a file describing a service of the librate.federation package,
+// whose messages are well-known types
+func registerDescriptor(path, service string, methods ...*descriptorpb.MethodDescriptorProto) error {
+	if _, err := protoregistry.GlobalFiles.FindFileByPath(path); err == nil {
+		return nil
+	}
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String(path),
+		Package:    proto.String("librate.federation"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/struct.proto", "google/protobuf/empty.proto"},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name:   proto.String(service),
+			Method: methods,
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		return err
+	}
+	return protoregistry.GlobalFiles.RegisterFile(fd)
+}
+
+func protoMethod(name, input, output string) *descriptorpb.MethodDescriptorProto {
+	return &descriptorpb.MethodDescriptorProto{
+		Name:       proto.String(name),
+		InputType:  proto.String(input),
+		OutputType: proto.String(output),
+	}
+}
+
+// SetDeliveries provides the storage of the delivery queue. The gRPC server is started
+// before the database connection is established, so it can't be passed on creation
+func (s *GrpcServer) SetDeliveries(d *models.DeliveryStorage) {
+	s.deliveries.Store(d)
+}
+
+func (s *GrpcServer) deliveryStorage() (*models.DeliveryStorage, error) {
+	d := s.deliveries.Load()
+	if d == nil {
+		return nil, status.Error(codes.Unavailable, "database connection not established yet")
+	}
+	return d, nil
+}
+
+func (s *GrpcServer) ListDeadLetters(ctx context.Context, req *structpb.Struct) (*structpb.ListValue, error) {
+	storage, err := s.deliveryStorage()
+	if err != nil {
+		return nil, err
+	}
+	limit, offset := 20, 0
+	if v, ok := req.GetFields()["limit"]; ok {
+		limit = int(v.GetNumberValue())
+	}
+	if v, ok := req.GetFields()["offset"]; ok {
+		offset = int(v.GetNumberValue())
+	}
+	if limit < 1 || limit > 1000 || offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must be between 1 and 1000 and offset must not be negative")
+	}
+
+	dead, err := storage.DeadLetters(ctx, limit, offset)
+	if err != nil {
+		s.Log.Error().Err(err).Msg("failed to list dead letters")
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	list := &structpb.ListValue{Values: make([]*structpb.Value, 0, len(dead))}
+	for i := range dead {
+		entry, err := structpb.NewStruct(map[string]any{
+			"id":           dead[i].ID,
+			"sender":       dead[i].Sender,
+			"inbox":        dead[i].Inbox,
+			"activity_iri": dead[i].ActivityIRI.String,
+			"attempts":     dead[i].Attempts,
+			"last_error":   dead[i].LastError.String,
+			"created":      dead[i].Created.Format(time.RFC3339),
+			"payload":      string(dead[i].Payload),
+		})
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		list.Values = append(list.Values, structpb.NewStructValue(entry))
+	}
+	return list, nil
+}
+
+func (s *GrpcServer) RetryDelivery(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error) {
+	return s.withDeadLetter(ctx, req, "retry", func(storage *models.DeliveryStorage, id int64) error {
+		return storage.Retry(ctx, id)
+	})
+}
+
+func (s *GrpcServer) DiscardDelivery(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error) {
+	return s.withDeadLetter(ctx, req, "discard", func(storage *models.DeliveryStorage, id int64) error {
+		return storage.Discard(ctx, id)
+	})
+}
+
+func (s *GrpcServer) withDeadLetter(
+	ctx context.Context,
+	req *structpb.Struct,
+	action string,
+	do func(storage *models.DeliveryStorage, id int64) error,
+) (*emptypb.Empty, error) {
+	storage, err := s.deliveryStorage()
+	if err != nil {
+		return nil, err
+	}
+	v, ok := req.GetFields()["id"]
+	if !ok || v.GetNumberValue() < 1 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	id := int64(v.GetNumberValue())
+
+	if err = do(storage, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Errorf(codes.NotFound, "dead letter %d not found", id)
+		}
+		s.Log.Error().Err(err).Msgf("failed to %s delivery %d", action, id)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	s.Log.Info().Msgf("dead letter %d: %s requested", id, action)
+	return &emptypb.Empty{}, nil
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"codeberg.org/mjh/LibRate/models"
+)
+
+// Like the deliveries service, this one uses well-known types only:
+//
+//	grpcurl -plaintext localhost:3030 librate.federation.DomainPolicies/ListDomainPolicies
+//	grpcurl -plaintext -d '{"domain": "spam.example", "severity": "block", "reason": "spam"}' \
+//		localhost:3030 librate.federation.DomainPolicies/SetDomainPolicy
+const (
+	domainPoliciesService = "librate.federation.DomainPolicies"
+	domainPoliciesProto   = "librate/federation/domain_policies.proto"
+)
+
+// DomainPoliciesServer allows administrators to block, silence or allow other instances
+type DomainPoliciesServer interface {
+	ListDomainPolicies(ctx context.Context, req *structpb.Struct) (*structpb.ListValue, error)
+	// SetDomainPolicy expects the domain and severity, reject_media and reason are optional
+	SetDomainPolicy(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error)
+	// RemoveDomainPolicy expects the domain
+	RemoveDomainPolicy(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error)
+}
+
+var domainPoliciesServiceDesc = grpc.ServiceDesc{
+	ServiceName: domainPoliciesService,
+	HandlerType: (*DomainPoliciesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListDomainPolicies",
+			Handler: unaryHandler(domainPoliciesService, "ListDomainPolicies", func(srv DomainPoliciesServer, ctx context.Context, req *structpb.Struct) (any, error) {
+				return srv.ListDomainPolicies(ctx, req)
+			}),
+		},
+		{
+			MethodName: "SetDomainPolicy",
+			Handler: unaryHandler(domainPoliciesService, "SetDomainPolicy", func(srv DomainPoliciesServer, ctx context.Context, req *structpb.Struct) (any, error) {
+				return srv.SetDomainPolicy(ctx, req)
+			}),
+		},
+		{
+			MethodName: "RemoveDomainPolicy",
+			Handler: unaryHandler(domainPoliciesService, "RemoveDomainPolicy", func(srv DomainPoliciesServer, ctx context.Context, req *structpb.Struct) (any, error) {
+				return srv.RemoveDomainPolicy(ctx, req)
+			}),
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: domainPoliciesProto,
+}
+
+func registerDomainPoliciesDescriptor() error {
+	return registerDescriptor(domainPoliciesProto, "DomainPolicies",
+		protoMethod("ListDomainPolicies", ".google.protobuf.Struct", ".google.protobuf.ListValue"),
+		protoMethod("SetDomainPolicy", ".google.protobuf.Struct", ".google.protobuf.Empty"),
+		protoMethod("RemoveDomainPolicy", ".google.protobuf.Struct", ".google.protobuf.Empty"),
+	)
+}
+
+// SetDomainPolicies provides the storage of the domain policies, see SetDeliveries
+func (s *GrpcServer) SetDomainPolicies(p *models.DomainPolicyStorage) {
+	s.domainPolicies.Store(p)
+}
+
+func (s *GrpcServer) domainPolicyStorage() (*models.DomainPolicyStorage, error) {
+	p := s.domainPolicies.Load()
+	if p == nil {
+		return nil, status.Error(codes.Unavailable, "database connection not established yet")
+	}
+	return p, nil
+}
+
+func (s *GrpcServer) ListDomainPolicies(ctx context.Context, _ *structpb.Struct) (*structpb.ListValue, error) {
+	storage, err := s.domainPolicyStorage()
+	if err != nil {
+		return nil, err
+	}
+	policies, err := storage.List(ctx)
+	if err != nil {
+		s.Log.Error().Err(err).Msg("failed to list domain policies")
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	list := &structpb.ListValue{Values: make([]*structpb.Value, 0, len(policies))}
+	for _, p := range policies {
+		entry, err := structpb.NewStruct(map[string]any{
+			"domain":       p.Domain,
+			"severity":     p.Severity,
+			"reject_media": p.RejectMedia,
+			"reason":       p.Reason.String,
+			"created_by":   p.CreatedBy.String,
+			"updated":      p.Updated.Format(time.RFC3339),
+		})
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		list.Values = append(list.Values, structpb.NewStructValue(entry))
+	}
+	return list, nil
+}
+
+func (s *GrpcServer) SetDomainPolicy(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error) {
+	storage, err := s.domainPolicyStorage()
+	if err != nil {
+		return nil, err
+	}
+	fields := req.GetFields()
+	policy := &models.DomainPolicy{
+		Domain:      fields["domain"].GetStringValue(),
+		Severity:    fields["severity"].GetStringValue(),
+		RejectMedia: fields["reject_media"].GetBoolValue(),
+		CreatedBy:   sql.NullString{String: "grpc", Valid: true},
+	}
+	if reason := fields["reason"].GetStringValue(); reason != "" {
+		policy.Reason = sql.NullString{String: reason, Valid: true}
+	}
+	if err = policy.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err = storage.Set(ctx, policy); err != nil {
+		s.Log.Error().Err(err).Msgf("failed to set policy for %s", policy.Domain)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	s.Log.Info().Msgf("policy for %s set to %s", policy.Domain, policy.Severity)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *GrpcServer) RemoveDomainPolicy(ctx context.Context, req *structpb.Struct) (*emptypb.Empty, error) {
+	storage, err := s.domainPolicyStorage()
+	if err != nil {
+		return nil, err
+	}
+	domain := req.GetFields()["domain"].GetStringValue()
+	if domain == "" {
+		return nil, status.Error(codes.InvalidArgument, "domain is required")
+	}
+	if err = storage.Remove(ctx, domain); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Errorf(codes.NotFound, "no policy for %s", domain)
+		}
+		s.Log.Error().Err(err).Msgf("failed to remove policy for %s", domain)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	s.Log.Info().Msgf("policy for %s removed", domain)
+	return &emptypb.Empty{}, nil
+}
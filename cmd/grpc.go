@@ -8,6 +8,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	protodb "codeberg.org/mjh/lrctl/grpc/db"
 	protosearch "codeberg.org/mjh/lrctl/grpc/search"
@@ -23,6 +24,7 @@ import (
 	"codeberg.org/mjh/LibRate/controllers/search"
 	"codeberg.org/mjh/LibRate/controllers/search/meili"
 	"codeberg.org/mjh/LibRate/db"
+	"codeberg.org/mjh/LibRate/models"
 	searchdb "codeberg.org/mjh/LibRate/models/search"
 )
 
@@ -34,6 +36,10 @@ type GrpcServer struct {
 	App    *fiber.App
 	Log    *zerolog.Logger
 	Config *cfg.GrpcConfig
+	// storage of the federation delivery queue, see SetDeliveries
+	deliveries atomic.Pointer[models.DeliveryStorage]
+	// see SetDomainPolicies
+	domainPolicies atomic.Pointer[models.DomainPolicyStorage]
 }
 
 // RunGrpcServer is the entry point for the GRPC server.
@@ -50,6 +56,14 @@ func registerGRPC(srv *GrpcServer) {
 	shutdown.RegisterShutdownServiceServer(s, srv)
 	protodb.RegisterDBServer(s, srv)
 	protosearch.RegisterSearchServer(s, srv)
+	s.RegisterService(&deliveriesServiceDesc, srv)
+	if err := registerDeliveriesDescriptor(); err != nil {
+		srv.Log.Warn().Err(err).Msg("failed to register the deliveries service for reflection")
+	}
+	s.RegisterService(&domainPoliciesServiceDesc, srv)
+	if err := registerDomainPoliciesDescriptor(); err != nil {
+		srv.Log.Warn().Err(err).Msg("failed to register the domain policies service for reflection")
+	}
 
 	reflection.Register(s)
 
@@ -7,6 +7,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 
+	"codeberg.org/mjh/LibRate/internal/crypt"
 	h "codeberg.org/mjh/LibRate/internal/handlers"
 	"codeberg.org/mjh/LibRate/lib/redist"
 	"codeberg.org/mjh/LibRate/models/member"
@@ -15,6 +16,9 @@ import (
 // Register handles the creation of a new user
 func (a *Service) Register(c *fiber.Ctx) error {
 	a.log.Debug().Msg("Registration request")
+	if a.conf.Fiber.RegistrationsClosed {
+		return h.Res(c, fiber.StatusForbidden, "Registrations are closed")
+	}
 	input, err := parseRegistrationInput(c)
 	if err != nil {
 		return h.Res(c, fiber.StatusBadRequest, err.Error())
@@ -94,12 +98,20 @@ func createMember(input *member.Input) (*member.Member, error) {
 		return nil, err
 	}
 
+	// used for signing federated activities
+	publicKeyPem, privateKeyPem, err := crypt.GenerateRSAKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
 	memberData := &member.Member{
-		PassHash:     passhash,
-		MemberName:   in.MemberName,
-		Email:        in.Email,
-		RegTimestamp: time.Now(),
-		Roles:        []string{"member"},
+		PassHash:      passhash,
+		MemberName:    in.MemberName,
+		Email:         in.Email,
+		RegTimestamp:  time.Now(),
+		Roles:         []string{"member"},
+		PublicKeyPem:  publicKeyPem,
+		PrivateKeyPem: privateKeyPem,
 	}
 
 	return memberData, nil
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/cfg"
+)
+
+func TestRegisterWhenClosed(t *testing.T) {
+	logger := zerolog.Nop()
+	a := &Service{
+		conf: &cfg.Config{Fiber: cfg.FiberConfig{RegistrationsClosed: true}},
+		log:  &logger,
+	}
+	app := fiber.New()
+	app.Post("/register", a.Register)
+
+	req := httptest.NewRequest(fiber.MethodPost, "/register", strings.NewReader(
+		`{"membername":"lain","email":"lain@wired.jp","password":"Present day, present time!"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	res, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusForbidden, res.StatusCode)
+}
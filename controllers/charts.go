@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	h "codeberg.org/mjh/LibRate/internal/handlers"
+	"codeberg.org/mjh/LibRate/models"
+)
+
+// how often the charts are recomputed from the scores
+const chartRefreshInterval = time.Hour
+
+// Chart is a page of the best rated media matching the filters, with the scores on the viewer's rating scale
+type Chart struct {
+	Entries []models.ChartEntry `json:"entries"`
+	Scale   models.RatingScale  `json:"scale"`
+}
+
+// GetChart returns the best rated media, by their weighted scores, optionally narrowed down to a kind,
+// a year, decade or range of release years, a genre along with its subgenres, the country the artists
+// come from and a minimum number of ratings
+// @Summary Get the top charts
+// @Description The scores are on the viewer's rating scale. The charts are refreshed hourly
+// @Tags reviews,media
+// @Produce json
+// @Param kind query string false "Media kind" Enums(album, track, film, tv_show, season, episode, book, game, anime, manga, comic)
+// @Param year query int false "Release year, overrides year_from and year_to"
+// @Param decade query int false "First year of the release decade, e.g. 1990, overrides year_from and year_to"
+// @Param year_from query int false "Earliest release year"
+// @Param year_to query int false "Latest release year"
+// @Param genre query int false "Genre ID, the subgenres are included"
+// @Param country query string false "ISO 3166-1 alpha-2 code of the country the artists come from"
+// @Param min_ratings query int false "Minimum number of ratings" default(0)
+// @Param limit query int false "Number of entries to return" default(25) minimum(1) maximum(100)
+// @Param offset query int false "Number of entries to skip" default(0)
+// @Success 200 {object} Chart
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /charts [get]
+func (rc *ReviewController) GetChart(c *fiber.Ctx) error {
+	filter, err := models.ParseChartFilter(c.Query)
+	if err != nil {
+		return h.Res(c, fiber.StatusBadRequest, err.Error())
+	}
+	entries, err := rc.rs.Chart(c.UserContext(), filter)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidChartFilter) {
+			return h.Res(c, fiber.StatusBadRequest, err.Error())
+		}
+		rc.ms.Log.Error().Err(err).Msg("Failed to get the chart")
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to fetch the chart")
+	}
+	scale := rc.viewerScale(c)
+	for i := range entries {
+		entries[i].Average = scale.Convert(entries[i].Average)
+		entries[i].WeightedScore = scale.Convert(entries[i].WeightedScore)
+	}
+	return c.JSON(Chart{Entries: entries, Scale: scale})
+}
+
+// RunChartRefresh periodically recomputes the charts in the background
+func (rc *ReviewController) RunChartRefresh(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(chartRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := rc.rs.RefreshCharts(ctx); err != nil {
+				if ctx.Err() == nil {
+					rc.ms.Log.Error().Err(err).Msg("failed to refresh the charts")
+				}
+				continue
+			}
+			rc.ms.Log.Debug().Msg("refreshed the charts")
+		}
+	}()
+}
@@ -0,0 +1,227 @@
+package federation
+
+import (
+	"context"
+	"crypto/rsa"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ap/activitypub"
+
+	"codeberg.org/mjh/LibRate/internal/crypt"
+)
+
+const (
+	activityJSON = "application/activity+json"
+	ldJSON       = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+	// remote actors are re-fetched after this period to pick up key rotations and inbox changes
+	actorCacheTTL = 24 * time.Hour
+	// maxDocumentSize limits the size of the remote documents we're willing to parse
+	maxDocumentSize = 1 << 20
+)
+
+// remoteActor is the subset of a remote ActivityPub actor needed for federation
+type remoteActor struct {
+	IRI          string         `db:"iri"`
+	Webfinger    string         `db:"webfinger"`
+	Inbox        string         `db:"inbox"`
+	SharedInbox  sql.NullString `db:"shared_inbox"`
+	KeyID        string         `db:"key_id"`
+	PublicKeyPem string         `db:"public_key_pem"`
+	Fetched      time.Time      `db:"fetched"`
+}
+
+// deliveryInbox prefers the shared inbox to reduce the number of requests
+func (ra *remoteActor) deliveryInbox() string {
+	if ra.SharedInbox.Valid && ra.SharedInbox.String != "" {
+		return ra.SharedInbox.String
+	}
+	return ra.Inbox
+}
+
+// getRemoteActor returns the actor with the given IRI, fetching it if it's not cached
+// or the cached copy is stale
+func (fc *FedController) getRemoteActor(ctx context.Context, iri string, refresh bool) (*remoteActor, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		if !refresh {
+			var cached remoteActor
+			err := fc.storage.GetContext(ctx, &cached,
+				`SELECT * FROM federation.remote_actors WHERE iri = $1`, iri)
+			if err == nil && time.Since(cached.Fetched) < actorCacheTTL {
+				return &cached, nil
+			}
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("failed to look up cached actor %s: %v", iri, err)
+			}
+		}
+
+		actor, err := fc.fetchActor(ctx, iri)
+		if err != nil {
+			return nil, err
+		}
+		if err := fc.saveRemoteActor(ctx, actor); err != nil {
+			return nil, err
+		}
+		return actor, nil
+	}
+}
+
+func (fc *FedController) fetchActor(ctx context.Context, iri string) (*remoteActor, error) {
+	body, err := fc.fetchDocument(ctx, iri)
+	if err != nil {
+		return nil, err
+	}
+	item, err := activitypub.UnmarshalJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode actor %s: %v", iri, err)
+	}
+	actor, err := activitypub.ToActor(item)
+	if err != nil {
+		return nil, fmt.Errorf("document at %s is not an actor: %v", iri, err)
+	}
+	if actor.ID.String() != iri {
+		return nil, fmt.Errorf("actor ID %s does not match the requested IRI %s", actor.ID, iri)
+	}
+	u, err := url.Parse(iri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid actor IRI %s: %v", iri, err)
+	}
+	username := actor.PreferredUsername.First().Value.String()
+	if username == "" || actor.Inbox == nil {
+		return nil, fmt.Errorf("actor %s is missing preferredUsername or inbox", iri)
+	}
+
+	ra := &remoteActor{
+		IRI:          iri,
+		Webfinger:    username + "@" + u.Hostname(),
+		Inbox:        actor.Inbox.GetLink().String(),
+		KeyID:        actor.PublicKey.ID.String(),
+		PublicKeyPem: actor.PublicKey.PublicKeyPem,
+		Fetched:      time.Now(),
+	}
+	if actor.Endpoints != nil && actor.Endpoints.SharedInbox != nil {
+		ra.SharedInbox = sql.NullString{String: actor.Endpoints.SharedInbox.GetLink().String(), Valid: true}
+	}
+	return ra, nil
+}
+
+func (fc *FedController) saveRemoteActor(ctx context.Context, ra *remoteActor) error {
+	_, err := fc.storage.NamedExecContext(ctx, `INSERT INTO federation.remote_actors
+	(iri, webfinger, inbox, shared_inbox, key_id, public_key_pem, fetched)
+	VALUES (:iri, :webfinger, :inbox, :shared_inbox, :key_id, :public_key_pem, :fetched)
+	ON CONFLICT (iri) DO UPDATE SET
+		webfinger = EXCLUDED.webfinger,
+		inbox = EXCLUDED.inbox,
+		shared_inbox = EXCLUDED.shared_inbox,
+		key_id = EXCLUDED.key_id,
+		public_key_pem = EXCLUDED.public_key_pem,
+		fetched = EXCLUDED.fetched`, ra)
+	if err != nil {
+		return fmt.Errorf("failed to cache remote actor %s: %v", ra.IRI, err)
+	}
+	return nil
+}
+
+// lookupKey returns the public key with the given ID along with its owner.
+// Most implementations use the actor IRI with a fragment as the key ID
+func (fc *FedController) lookupKey(ctx context.Context, keyID string, refresh bool) (*remoteActor, *rsa.PublicKey, error) {
+	actorIRI, _, _ := strings.Cut(keyID, "#")
+	actor, err := fc.getRemoteActor(ctx, actorIRI, refresh)
+	if err != nil {
+		return nil, nil, err
+	}
+	if actor.KeyID != keyID {
+		return nil, nil, fmt.Errorf("key %s does not belong to %s", keyID, actorIRI)
+	}
+	key, err := crypt.ParseRSAPublicKey(actor.PublicKeyPem)
+	if err != nil {
+		return nil, nil, err
+	}
+	return actor, key, nil
+}
+
+// resolveWebfinger finds the actor of a remote member, using the WebFinger protocol (RFC 7033)
+func (fc *FedController) resolveWebfinger(ctx context.Context, webfinger string) (*remoteActor, error) {
+	var cached remoteActor
+	err := fc.storage.GetContext(ctx, &cached,
+		`SELECT * FROM federation.remote_actors WHERE webfinger = $1`, webfinger)
+	if err == nil && time.Since(cached.Fetched) < actorCacheTTL {
+		return &cached, nil
+	}
+
+	_, host, found := strings.Cut(webfinger, "@")
+	if !found {
+		return nil, fmt.Errorf("invalid webfinger %s", webfinger)
+	}
+	if _, err = fc.checkDomain(ctx, host); err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("https://%s/.well-known/webfinger?resource=%s",
+		host, url.QueryEscape("acct:"+webfinger))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webfinger request: %v", err)
+	}
+	req.Header.Set("Accept", "application/jrd+json, application/json")
+	res, err := fc.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("webfinger lookup for %s failed: %v", webfinger, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("webfinger lookup for %s returned %s", webfinger, res.Status)
+	}
+
+	var jrd struct {
+		Links []struct {
+			Rel  string `json:"rel"`
+			Type string `json:"type"`
+			Href string `json:"href"`
+		} `json:"links"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxDocumentSize)).Decode(&jrd); err != nil {
+		return nil, fmt.Errorf("failed to decode webfinger response: %v", err)
+	}
+	for _, link := range jrd.Links {
+		if link.Rel == "self" && (link.Type == activityJSON || strings.HasPrefix(link.Type, "application/ld+json")) {
+			return fc.getRemoteActor(ctx, link.Href, true)
+		}
+	}
+	return nil, fmt.Errorf("no ActivityPub actor found for %s", webfinger)
+}
+
+// fetchDocument retrieves an ActivityStreams document
+func (fc *FedController) fetchDocument(ctx context.Context, iri string) ([]byte, error) {
+	if _, err := fc.checkIRI(ctx, iri); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, iri, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %v", iri, err)
+	}
+	req.Header.Set("Accept", activityJSON+", "+ldJSON)
+	res, err := fc.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %v", iri, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s returned %s", iri, res.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxDocumentSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", iri, err)
+	}
+	return body, nil
+}
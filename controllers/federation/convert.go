@@ -3,6 +3,7 @@ package federation
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/go-ap/activitypub"
 	"github.com/gofiber/fiber/v2"
@@ -43,15 +44,23 @@ func (ch *ConversionHandler) MemberToActor(c *fiber.Ctx, memberData *member.Memb
 	return actor, nil
 }
 
-// TODO: create an actual implementation
+// FollowToAS converts a follow request of a local member to an ActivityPub Follow.
+// The object is set to the local actor of the target, callers following remote members
+// must replace it with the remote actor's IRI
 func (ch *ConversionHandler) FollowToAS(ctx context.Context, req *member.FollowBlockRequest) (*activitypub.Follow, error) {
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
-		return &activitypub.Follow{
-			Actor:  activitypub.IRI(req.Requester),
-			Object: activitypub.IRI(req.Target),
-		}, nil
+		if ch.conf == nil {
+			return nil, fmt.Errorf("instance configuration is required to build actor IRIs")
+		}
+		base := instanceURL(ch.conf) + "/api/members/"
+		follow := activitypub.FollowNew(
+			activitypub.ID(req.ActivityIRI.String),
+			activitypub.IRI(base+strings.Split(req.Target, "@")[0]),
+		)
+		follow.Actor = activitypub.IRI(base + strings.Split(req.Requester, "@")[0])
+		return follow, nil
 	}
 }
@@ -0,0 +1,236 @@
+package federation
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"codeberg.org/mjh/LibRate/controllers/version"
+	h "codeberg.org/mjh/LibRate/internal/handlers"
+)
+
+const (
+	nodeInfoSchema = "http://nodeinfo.diaspora.software/ns/schema/2.1"
+	nodeInfoType   = `application/json; profile="http://nodeinfo.diaspora.software/ns/schema/2.1#"`
+)
+
+type (
+	// JRD is the JSON Resource Descriptor returned by WebFinger (RFC 7033)
+	JRD struct {
+		Subject string    `json:"subject"`
+		Aliases []string  `json:"aliases,omitempty"`
+		Links   []JRDLink `json:"links"`
+	}
+
+	JRDLink struct {
+		Rel      string `json:"rel"`
+		Type     string `json:"type,omitempty"`
+		Href     string `json:"href,omitempty"`
+		Template string `json:"template,omitempty"`
+	}
+
+	// NodeInfo describes the instance, according to the NodeInfo 2.1 schema
+	NodeInfo struct {
+		Version           string           `json:"version"`
+		Software          NodeInfoSoftware `json:"software"`
+		Protocols         []string         `json:"protocols"`
+		Services          NodeInfoServices `json:"services"`
+		OpenRegistrations bool             `json:"openRegistrations"`
+		Usage             NodeInfoUsage    `json:"usage"`
+		Metadata          map[string]any   `json:"metadata"`
+	}
+
+	NodeInfoSoftware struct {
+		Name       string `json:"name"`
+		Version    string `json:"version"`
+		Repository string `json:"repository,omitempty"`
+		Homepage   string `json:"homepage,omitempty"`
+	}
+
+	NodeInfoServices struct {
+		Inbound  []string `json:"inbound"`
+		Outbound []string `json:"outbound"`
+	}
+
+	NodeInfoUsage struct {
+		Users      NodeInfoUsers `json:"users"`
+		LocalPosts int64         `json:"localPosts" db:"local_posts"`
+	}
+
+	NodeInfoUsers struct {
+		Total          int64 `json:"total" db:"total"`
+		ActiveMonth    int64 `json:"activeMonth" db:"active_month"`
+		ActiveHalfyear int64 `json:"activeHalfyear" db:"active_halfyear"`
+	}
+)
+
+// @Summary WebFinger lookup
+// @Description Resolves acct: URIs and actor IRIs of local members (RFC 7033)
+// @Tags federation
+// @Produce json
+// @Param resource query string true "acct:nick@domain or the actor IRI"
+// @Success 200 {object} JRD
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Router /.well-known/webfinger [get]
+func (fc *FedController) WebFinger(c *fiber.Ctx) error {
+	resource := c.Query("resource")
+	if resource == "" {
+		return h.Res(c, fiber.StatusBadRequest, "Missing resource parameter")
+	}
+
+	name, err := fc.webfingerResourceName(resource)
+	if err != nil {
+		return h.Res(c, fiber.StatusNotFound, err.Error())
+	}
+
+	m, err := fc.members.Read(c.Context(), name, "nick")
+	if err != nil {
+		return h.Res(c, fiber.StatusNotFound, "Member not found")
+	}
+
+	actorIRI := fc.actorIRI(m.MemberName)
+	profile := fc.baseURL() + "/profiles/" + m.MemberName
+	// allow lookups from web based clients
+	c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+	return c.JSON(JRD{
+		Subject: "acct:" + m.MemberName + "@" + fc.conf.Fiber.Domain,
+		Aliases: []string{actorIRI, profile},
+		Links: []JRDLink{
+			{Rel: "self", Type: activityJSON, Href: actorIRI},
+			{Rel: "http://webfinger.net/rel/profile-page", Type: "text/html", Href: profile},
+		},
+	}, "application/jrd+json; charset=utf-8")
+}
+
+// webfingerResourceName extracts the nickname of a local member from a WebFinger resource
+func (fc *FedController) webfingerResourceName(resource string) (string, error) {
+	if acct, found := strings.CutPrefix(resource, "acct:"); found {
+		// some software prefixes the account with "@"
+		name, domain, ok := strings.Cut(strings.TrimPrefix(acct, "@"), "@")
+		if !ok || name == "" {
+			return "", fmt.Errorf("invalid account %s", acct)
+		}
+		if !strings.EqualFold(domain, fc.conf.Fiber.Domain) {
+			return "", fmt.Errorf("%s is not a local account", acct)
+		}
+		return name, nil
+	}
+
+	u, err := url.Parse(resource)
+	if err != nil || u.Hostname() != fc.conf.Fiber.Domain {
+		return "", fmt.Errorf("unsupported resource %s", resource)
+	}
+	for _, prefix := range []string{"/api/members/", "/profiles/"} {
+		if name, found := strings.CutPrefix(u.Path, prefix); found && name != "" && !strings.Contains(name, "/") {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported resource %s", resource)
+}
+
+// @Summary host-meta document
+// @Description Points legacy clients to the WebFinger endpoint (RFC 6415)
+// @Tags federation
+// @Produce xml
+// @Success 200 {string} string
+// @Router /.well-known/host-meta [get]
+func (fc *FedController) HostMeta(c *fiber.Ctx) error {
+	type link struct {
+		Rel      string `xml:"rel,attr"`
+		Type     string `xml:"type,attr"`
+		Template string `xml:"template,attr"`
+	}
+	doc := struct {
+		XMLName xml.Name `xml:"XRD"`
+		XMLNS   string   `xml:"xmlns,attr"`
+		Links   []link   `xml:"Link"`
+	}{
+		XMLNS: "http://docs.oasis-open.org/ns/xri/xrd-1.0",
+		Links: []link{{
+			Rel:      "lrdd",
+			Type:     "application/xrd+xml",
+			Template: fc.baseURL() + "/.well-known/webfinger?resource={uri}",
+		}},
+	}
+	out, err := xml.Marshal(doc)
+	if err != nil {
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to encode host-meta")
+	}
+	c.Set(fiber.HeaderContentType, "application/xrd+xml; charset=utf-8")
+	return c.Send(append([]byte(xml.Header), out...))
+}
+
+// @Summary NodeInfo discovery document
+// @Tags federation
+// @Produce json
+// @Success 200 {object} JRD
+// @Router /.well-known/nodeinfo [get]
+func (fc *FedController) NodeInfoDiscovery(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"links": []JRDLink{
+			{Rel: nodeInfoSchema, Href: fc.baseURL() + "/nodeinfo/2.1"},
+		},
+	})
+}
+
+// @Summary NodeInfo 2.1
+// @Description Instance metadata and usage statistics
+// @Tags federation
+// @Produce json
+// @Success 200 {object} NodeInfo
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /nodeinfo/2.1 [get]
+func (fc *FedController) NodeInfo(c *fiber.Ctx) error {
+	var users NodeInfoUsers
+	// members don't track their last activity, so activity is approximated by the reviews posted
+	err := fc.storage.GetContext(c.Context(), &users, `SELECT
+		(SELECT count(*) FROM public.members WHERE active) AS total,
+		(SELECT count(DISTINCT user_id) FROM reviews.ratings
+			WHERE created_at > now() - INTERVAL '1 month') AS active_month,
+		(SELECT count(DISTINCT user_id) FROM reviews.ratings
+			WHERE created_at > now() - INTERVAL '6 months') AS active_halfyear`)
+	if err != nil {
+		fc.log.Error().Err(err).Msg("failed to count users for nodeinfo")
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to get usage statistics")
+	}
+	var localPosts int64
+	if err = fc.storage.GetContext(c.Context(), &localPosts, `SELECT count(*) FROM reviews.ratings
+		WHERE remote_actor IS NULL`); err != nil {
+		fc.log.Error().Err(err).Msg("failed to count reviews for nodeinfo")
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to get usage statistics")
+	}
+
+	softwareVersion, err := version.Version()
+	if err != nil {
+		fc.log.Warn().Err(err).Msg("failed to read version for nodeinfo")
+		softwareVersion = "unknown"
+	}
+
+	c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+	return c.JSON(NodeInfo{
+		Version: "2.1",
+		Software: NodeInfoSoftware{
+			Name:       "librate",
+			Version:    softwareVersion,
+			Repository: "https://codeberg.org/mjh/LibRate",
+			Homepage:   "https://codeberg.org/mjh/LibRate",
+		},
+		Protocols: []string{"activitypub"},
+		Services: NodeInfoServices{
+			Inbound:  []string{},
+			Outbound: []string{},
+		},
+		OpenRegistrations: !fc.conf.Fiber.RegistrationsClosed,
+		Usage: NodeInfoUsage{
+			Users:      users,
+			LocalPosts: localPosts,
+		},
+		Metadata: map[string]any{
+			"nodeName": fc.conf.Fiber.Domain,
+		},
+	}, nodeInfoType)
+}
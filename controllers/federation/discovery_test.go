@@ -0,0 +1,39 @@
+package federation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"codeberg.org/mjh/LibRate/cfg"
+)
+
+func TestWebfingerResourceName(t *testing.T) {
+	conf := cfg.TestConfig
+	conf.Fiber.Domain = "librate.club"
+	fc := &FedController{conf: &conf}
+
+	cases := []struct {
+		resource string
+		want     string
+		wantErr  bool
+	}{
+		{resource: "acct:lain@librate.club", want: "lain"},
+		{resource: "acct:@lain@librate.club", want: "lain"},
+		{resource: "http://librate.club/api/members/lain", want: "lain"},
+		{resource: "https://librate.club/profiles/lain", want: "lain"},
+		{resource: "acct:lain@wired.jp", wantErr: true},
+		{resource: "acct:lain", wantErr: true},
+		{resource: "https://librate.club/api/members/lain/outbox", wantErr: true},
+		{resource: "https://wired.jp/api/members/lain", wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := fc.webfingerResourceName(tc.resource)
+		if tc.wantErr {
+			assert.Errorf(t, err, "resource %s", tc.resource)
+			continue
+		}
+		assert.NoErrorf(t, err, "resource %s", tc.resource)
+		assert.Equal(t, tc.want, got)
+	}
+}
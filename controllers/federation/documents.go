@@ -0,0 +1,147 @@
+package federation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-ap/activitypub"
+	"github.com/gofiber/fiber/v2"
+
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+// CatalogConverter converts catalog entries to ActivityStreams documents, so that other
+// instances can reference the same album or film by IRI
+type CatalogConverter interface {
+	MediaToAS(m *media.Media) ([]byte, error)
+	PersonToActor(p *media.Person, id string) ([]byte, error)
+	GroupToActor(g *media.Group, id string) ([]byte, error)
+	StudioToActor(s *media.Studio) ([]byte, error)
+}
+
+// MediaIRI returns the canonical IRI of a media item
+func (ch *ConversionHandler) MediaIRI(m *media.Media) string {
+	return instanceURL(ch.conf) + "/api/media/" + m.ID.String()
+}
+
+// CreatorIRI returns the canonical IRI of a person, group or studio
+func (ch *ConversionHandler) CreatorIRI(kind, id string) string {
+	return instanceURL(ch.conf) + "/api/media/creator?" + url.Values{"kind": {kind}, "id": {id}}.Encode()
+}
+
+// MediaToAS converts a media item to an ActivityStreams object
+func (ch *ConversionHandler) MediaToAS(m *media.Media) ([]byte, error) {
+	object := activitypub.ObjectNew(mediaObjectType(m.Kind))
+	object.ID = activitypub.ID(ch.MediaIRI(m))
+	object.Name = activitypub.DefaultNaturalLanguageValue(m.Title)
+	object.URL = activitypub.IRI(instanceURL(ch.conf) + "/media/" + m.ID.String())
+	if !m.Created.IsZero() {
+		object.Published = m.Created
+	}
+	if m.Modified.Valid {
+		object.Updated = m.Modified.Time
+	}
+	if m.Creator.Valid {
+		object.AttributedTo = activitypub.IRI(ch.CreatorIRI("person", fmt.Sprint(m.Creator.Int32)))
+	}
+	doc, err := object.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("error encoding media %s: %v", m.ID, err)
+	}
+	// the kind is more specific than the ActivityStreams type, e.g. album vs track
+	return appendField(doc, "mediaKind", m.Kind)
+}
+
+// PersonToActor converts an artist, author, actor etc. to an ActivityStreams Person
+func (ch *ConversionHandler) PersonToActor(p *media.Person, id string) ([]byte, error) {
+	name := p.Name
+	if name == "" {
+		name = strings.TrimSpace(p.FirstName + " " + p.LastName)
+	}
+	actor := ch.catalogActor(activitypub.PersonType, ch.CreatorIRI("person", id), name, p.Bio.String)
+	if p.Website.Valid {
+		actor.URL = activitypub.IRI(p.Website.String)
+	}
+	return encodeActor(actor)
+}
+
+// GroupToActor converts a band, orchestra etc. to an ActivityStreams Group
+func (ch *ConversionHandler) GroupToActor(g *media.Group, id string) ([]byte, error) {
+	actor := ch.catalogActor(activitypub.GroupType, ch.CreatorIRI("group", id), g.Name, g.Bio.String)
+	if g.Website.Valid {
+		actor.URL = activitypub.IRI(g.Website.String)
+	}
+	if g.Formed.Valid {
+		actor.Published = g.Formed.Time
+	}
+	return encodeActor(actor)
+}
+
+// StudioToActor converts a studio, label or publisher to an ActivityStreams Organization
+func (ch *ConversionHandler) StudioToActor(s *media.Studio) ([]byte, error) {
+	actor := ch.catalogActor(activitypub.OrganizationType, ch.CreatorIRI("studio", fmt.Sprint(s.ID)), s.Name, "")
+	return encodeActor(actor)
+}
+
+// catalogActor builds the common part of the actors representing creators. They can't be
+// followed (yet), but the inbox is mandatory for actors, so the shared inbox is used
+func (ch *ConversionHandler) catalogActor(
+	kind activitypub.ActivityVocabularyType,
+	iri, name, summary string,
+) *activitypub.Actor {
+	actor := activitypub.ActorNew(activitypub.ID(iri), kind)
+	actor.Name = activitypub.DefaultNaturalLanguageValue(name)
+	if summary != "" {
+		actor.Summary = activitypub.DefaultNaturalLanguageValue(summary)
+	}
+	actor.Inbox = activitypub.IRI(instanceURL(ch.conf) + "/api/inbox")
+	return actor
+}
+
+func encodeActor(actor *activitypub.Actor) ([]byte, error) {
+	doc, err := actor.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("error encoding actor %s: %v", actor.ID, err)
+	}
+	return doc, nil
+}
+
+// mediaObjectType maps media kinds to the closest ActivityStreams object type
+func mediaObjectType(kind string) activitypub.ActivityVocabularyType {
+	switch kind {
+	case "album", "track":
+		return activitypub.AudioType
+	case "film", "tv_show", "season", "episode":
+		return activitypub.VideoType
+	case "book":
+		return activitypub.DocumentType
+	default:
+		return activitypub.ObjectType
+	}
+}
+
+// appendField adds a string field to an encoded JSON object
+func appendField(doc []byte, key, value string) ([]byte, error) {
+	if len(doc) < 2 || doc[len(doc)-1] != '}' {
+		return nil, fmt.Errorf("not a JSON object")
+	}
+	encoded, err := json.Marshal(map[string]string{key: value})
+	if err != nil {
+		return nil, err
+	}
+	// strip the braces of the encoded field
+	field := encoded[1 : len(encoded)-1]
+	if doc[len(doc)-2] != '{' {
+		field = append([]byte{','}, field...)
+	}
+	return append(append(doc[:len(doc)-1:len(doc)-1], field...), '}'), nil
+}
+
+// SendDocument responds with an ActivityStreams document
+func SendDocument(c *fiber.Ctx, doc []byte) error {
+	c.Set(fiber.HeaderContentType, activityJSON)
+	c.Vary(fiber.HeaderAccept)
+	return c.Send(withContext(doc))
+}
@@ -0,0 +1,89 @@
+package federation
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/cfg"
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+func TestCatalogDocuments(t *testing.T) {
+	conf := cfg.TestConfig
+	conf.Fiber.Domain = "librate.club"
+	ch := &ConversionHandler{conf: &conf}
+	base := instanceURL(&conf)
+
+	t.Run("media", func(t *testing.T) {
+		id := uuid.Must(uuid.NewV4())
+		doc, err := ch.MediaToAS(&media.Media{
+			ID:      id,
+			Title:   "Lateralus",
+			Kind:    "album",
+			Created: time.Date(2001, 5, 15, 0, 0, 0, 0, time.UTC),
+			Creator: sql.NullInt32{Int32: 7, Valid: true},
+		})
+		require.NoError(t, err)
+
+		var object map[string]any
+		require.NoError(t, json.Unmarshal(doc, &object))
+		assert.Equal(t, base+"/api/media/"+id.String(), object["id"])
+		assert.Equal(t, "Audio", object["type"])
+		assert.Equal(t, "Lateralus", object["name"])
+		assert.Equal(t, "album", object["mediaKind"])
+		assert.Equal(t, base+"/api/media/creator?id=7&kind=person", object["attributedTo"])
+	})
+
+	t.Run("person", func(t *testing.T) {
+		doc, err := ch.PersonToActor(&media.Person{FirstName: "Maynard James", LastName: "Keenan"}, "7")
+		require.NoError(t, err)
+
+		var actor map[string]any
+		require.NoError(t, json.Unmarshal(doc, &actor))
+		assert.Equal(t, "Person", actor["type"])
+		assert.Equal(t, "Maynard James Keenan", actor["name"])
+		assert.Equal(t, base+"/api/inbox", actor["inbox"])
+	})
+
+	t.Run("studio", func(t *testing.T) {
+		doc, err := ch.StudioToActor(&media.Studio{ID: 3, Name: "Volcano Entertainment"})
+		require.NoError(t, err)
+
+		var actor map[string]any
+		require.NoError(t, json.Unmarshal(doc, &actor))
+		assert.Equal(t, "Organization", actor["type"])
+		assert.Equal(t, base+"/api/media/creator?id=3&kind=studio", actor["id"])
+	})
+}
+
+func TestLocalMediaID(t *testing.T) {
+	conf := cfg.TestConfig
+	conf.Fiber.Domain = "librate.club"
+	fc := &FedController{conf: &conf}
+	id := uuid.Must(uuid.NewV4())
+
+	got, err := fc.localMediaID("https://librate.club/api/media/" + id.String())
+	require.NoError(t, err)
+	assert.Equal(t, id, got)
+
+	_, err = fc.localMediaID("https://bookwyrm.social/book/1234")
+	assert.Error(t, err)
+	_, err = fc.localMediaID("https://librate.club/api/members/lain")
+	assert.Error(t, err)
+}
+
+func TestAppendField(t *testing.T) {
+	doc, err := appendField([]byte(`{}`), "mediaKind", `"quoted"`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"mediaKind":"\"quoted\""}`, string(doc))
+
+	doc, err = appendField([]byte(`{"id":"x"}`), "mediaKind", "film")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"x","mediaKind":"film"}`, string(doc))
+}
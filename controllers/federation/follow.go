@@ -1,6 +1,9 @@
 package federation
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/go-ap/activitypub"
@@ -10,44 +13,208 @@ import (
 	"codeberg.org/mjh/LibRate/models/member"
 )
 
-// In handles incoming messages, then routes them to the appropriate handler
-func (fc *FedController) In(c *fiber.Ctx) error {
-	var activity activitypub.Activity
+// Follow handles incoming follow requests
+func (fc *FedController) Follow(c *fiber.Ctx) error {
+	activity, ok := c.Locals("activity").(*activitypub.Activity)
+	actor, isVerified := c.Locals("remoteActor").(*remoteActor)
+	if !ok || !isVerified {
+		return h.Res(c, fiber.StatusBadRequest, "Follow requests must be sent to the inbox")
+	}
+	if activity.Object == nil {
+		return h.Res(c, fiber.StatusBadRequest, "Missing follow target")
+	}
+	target, err := fc.localWebfinger(activity.Object.GetLink())
+	if err != nil {
+		return h.Res(c, fiber.StatusNotFound, "Unknown follow target")
+	}
+	fc.log.Info().Msgf("Follow request from %s to %s", actor.Webfinger, target)
+
+	resp := fc.members.RequestFollow(c.Context(), &member.FollowBlockRequest{
+		Requester:   actor.Webfinger,
+		Target:      target,
+		Reblogs:     true,
+		ActivityIRI: sql.NullString{String: activity.ID.String(), Valid: activity.ID != ""},
+	})
+	switch resp.Status {
+	case "accepted", "already_following", "blocked":
+		response := fc.followResponseActivity(target, activity, resp.Status != "blocked")
+		if err = fc.deliver(c.Context(), target, actor.Inbox, response); err != nil {
+			fc.log.Error().Err(err).Msgf("failed to queue %s for %s", response.Type, actor.Webfinger)
+			return h.Res(c, fiber.StatusInternalServerError, "Failed to process follow request")
+		}
+	case "pending":
+	case "not_found":
+		return h.Res(c, fiber.StatusNotFound, "Unknown follow target")
+	default:
+		fc.log.Error().Err(resp.Error).Msgf("error requesting follow from %s", actor.Webfinger)
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to process follow request")
+	}
+
+	return h.Res(c, fiber.StatusAccepted, "Follow request received")
+}
+
+// followResponse handles a remote member accepting or rejecting a follow request
+// sent by a local member
+func (fc *FedController) followResponse(c *fiber.Ctx) error {
+	activity := c.Locals("activity").(*activitypub.Activity)
+	actor := c.Locals("remoteActor").(*remoteActor)
+	if activity.Object == nil {
+		return h.Res(c, fiber.StatusBadRequest, "Missing follow object")
+	}
 
-	if err := c.BodyParser(&activity); err != nil {
-		return err
+	follower, err := fc.findLocalFollower(c.Context(), activity.Object)
+	if err != nil {
+		fc.log.Warn().Err(err).Msgf("%s for unknown follow from %s", activity.Type, actor.Webfinger)
+		return h.Res(c, fiber.StatusNotFound, "Unknown follow request")
 	}
 
-	switch activity.Type {
-	case activitypub.FollowType:
-		return fc.Follow(c)
+	if activity.Type == activitypub.RejectType {
+		// also used to remove an existing follower
+		if err = fc.members.RemoveFollower(c.Context(), follower, actor.Webfinger); err != nil {
+			fc.log.Error().Err(err).Msgf("failed to process rejection of %s by %s", follower, actor.Webfinger)
+			return h.Res(c, fiber.StatusInternalServerError, "Failed to process rejection")
+		}
+		return h.Res(c, fiber.StatusAccepted, "Follow request rejected")
+	}
+
+	status := fc.members.GetFollowStatus(c.Context(), follower, actor.Webfinger)
+	switch status.Status {
+	case "accepted":
+		return h.Res(c, fiber.StatusAccepted, "Already following")
+	case "pending":
+		if err = fc.members.AcceptFollow(c.Context(), actor.Webfinger, status.ID); err != nil {
+			fc.log.Error().Err(err).Msgf("failed to accept follow of %s by %s", follower, actor.Webfinger)
+			return h.Res(c, fiber.StatusInternalServerError, "Failed to process acceptance")
+		}
+		return h.Res(c, fiber.StatusAccepted, "Follow request accepted")
 	default:
-		return fc.Unknown(c)
+		return h.Res(c, fiber.StatusNotFound, "Unknown follow request")
 	}
 }
 
-// Unknown handles unknown activity types
-func (fc *FedController) Unknown(c *fiber.Ctx) error {
-	return h.Res(c, fiber.StatusNotImplemented, "Unknown activity type")
+// undo handles the reversal of previous activities. Currently only follows can be undone
+func (fc *FedController) undo(c *fiber.Ctx) error {
+	activity := c.Locals("activity").(*activitypub.Activity)
+	actor := c.Locals("remoteActor").(*remoteActor)
+	if activity.Object == nil {
+		return h.Res(c, fiber.StatusBadRequest, "Missing undo object")
+	}
+
+	var followee string
+	err := fc.storage.GetContext(c.Context(), &followee, `
+	SELECT followee FROM public.followers WHERE activity_iri = $1
+	UNION ALL
+	SELECT target_webfinger FROM public.follow_requests WHERE activity_iri = $1
+	LIMIT 1`, activity.Object.GetLink().String())
+	if err != nil {
+		embedded, e := activitypub.ToActivity(activity.Object)
+		if e != nil || embedded.Type != activitypub.FollowType || embedded.Object == nil {
+			return fc.Unknown(c)
+		}
+		if followee, err = fc.localWebfinger(embedded.Object.GetLink()); err != nil {
+			return h.Res(c, fiber.StatusNotFound, "Unknown follow target")
+		}
+	}
+
+	if err = fc.members.RemoveFollower(c.Context(), actor.Webfinger, followee); err != nil {
+		fc.log.Error().Err(err).Msgf("failed to remove follower %s of %s", actor.Webfinger, followee)
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to undo follow")
+	}
+	return h.Res(c, fiber.StatusAccepted, "Follow undone")
 }
 
-// Follow handles incoming follow requests
-func (fc *FedController) Follow(c *fiber.Ctx) error {
-	var activity activitypub.Follow
-	if err := c.BodyParser(&activity); err != nil {
-		return err
+// findLocalFollower returns the webfinger of the local member who sent the follow
+// request referenced by an Accept or Reject
+func (fc *FedController) findLocalFollower(ctx context.Context, follow activitypub.Item) (string, error) {
+	var follower string
+	err := fc.storage.GetContext(ctx, &follower, `
+	SELECT requester_webfinger FROM public.follow_requests WHERE activity_iri = $1
+	UNION ALL
+	SELECT follower FROM public.followers WHERE activity_iri = $1
+	LIMIT 1`, follow.GetLink().String())
+	if err == nil {
+		return follower, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("failed to look up follow %s: %v", follow.GetLink(), err)
 	}
-	actor := activity.Actor.GetLink()
-	follows := activity.Object.GetLink()
-	fc.log.Info().Msgf("Follow request from %s to %s", actor, follows)
 
-	resp := fc.members.RequestFollow(c.Context(), &member.FollowBlockRequest{
-		Requester: actor.String(),
-		Target:    follows.String(),
-	})
-	if resp.Error != nil {
-		return fmt.Errorf("error requesting follow: %w", resp.Error)
+	// some implementations don't keep the ID of the Follow, but embed the original activity
+	embedded, err := activitypub.ToActivity(follow)
+	if err != nil || embedded.Actor == nil {
+		return "", fmt.Errorf("follow %s not found", follow.GetLink())
 	}
+	return fc.localWebfinger(embedded.Actor.GetLink())
+}
 
-	return h.Res(c, fiber.StatusOK, "Follow request sent")
+// FollowRemote stores a follow request to a member of another instance and sends it
+// to their inbox. The request stays pending until an Accept is received.
+func (fc *FedController) FollowRemote(ctx context.Context, fr *member.FollowBlockRequest) member.FollowResponse {
+	target, err := fc.resolveWebfinger(ctx, fr.Target)
+	if err != nil {
+		return member.FollowResponse{
+			Status: "not_found",
+			Error:  fmt.Errorf("failed to resolve %s: %v", fr.Target, err),
+		}
+	}
+
+	follow, err := fc.FollowToAS(ctx, fr)
+	if err != nil {
+		return member.FollowResponse{Status: "failed", Error: err}
+	}
+	follow.ID = fc.newActivityIRI()
+	follow.Object = activitypub.IRI(target.IRI)
+	fr.ActivityIRI = sql.NullString{String: follow.ID.String(), Valid: true}
+
+	resp := fc.members.RequestFollow(ctx, fr)
+	if resp.Status == "pending" {
+		if err = fc.deliver(ctx, fr.Requester, target.Inbox, follow); err != nil {
+			return member.FollowResponse{Status: "failed", Error: err}
+		}
+	}
+	return resp
+}
+
+// RespondFollow sends an Accept or Reject for a follow request received from another instance
+func (fc *FedController) RespondFollow(ctx context.Context, fr *member.FollowBlockRequest, accepted bool) error {
+	requester, err := fc.resolveWebfinger(ctx, fr.Requester)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %v", fr.Requester, err)
+	}
+	follow := activitypub.FollowNew(activitypub.ID(fr.ActivityIRI.String), activitypub.IRI(fc.actorIRI(fr.Target)))
+	follow.Actor = activitypub.IRI(requester.IRI)
+
+	return fc.deliver(ctx, fr.Target, requester.Inbox, fc.followResponseActivity(fr.Target, follow, accepted))
+}
+
+// UndoFollow tells a remote member that a local member no longer follows them
+func (fc *FedController) UndoFollow(ctx context.Context, follower, followee, followIRI string) error {
+	target, err := fc.resolveWebfinger(ctx, followee)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %v", followee, err)
+	}
+	follow := activitypub.FollowNew(activitypub.ID(followIRI), activitypub.IRI(target.IRI))
+	follow.Actor = activitypub.IRI(fc.actorIRI(follower))
+
+	undo := activitypub.UndoNew(fc.newActivityIRI(), follow)
+	undo.Actor = follow.Actor
+	return fc.deliver(ctx, follower, target.Inbox, undo)
+}
+
+// followResponseActivity builds an Accept or Reject of the given Follow on behalf of
+// the local followee
+func (fc *FedController) followResponseActivity(
+	followee string,
+	follow *activitypub.Activity,
+	accepted bool,
+) *activitypub.Activity {
+	var response *activitypub.Activity
+	if accepted {
+		response = activitypub.AcceptNew(fc.newActivityIRI(), follow)
+	} else {
+		response = activitypub.RejectNew(fc.newActivityIRI(), follow)
+	}
+	response.Actor = activitypub.IRI(fc.actorIRI(followee))
+	response.To = activitypub.ItemCollection{follow.Actor.GetLink()}
+	return response
 }
@@ -0,0 +1,197 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-ap/activitypub"
+	"github.com/gofiber/fiber/v2"
+
+	h "codeberg.org/mjh/LibRate/internal/handlers"
+)
+
+// In handles incoming messages, then routes them to the appropriate handler
+// @Summary Receive an ActivityPub activity
+// @Description Shared and per-member inbox. Requests must carry a valid HTTP signature
+// @Description (draft-cavage-http-signatures, rsa-sha256) covering at least the date and digest headers.
+// @Tags federation
+// @Accept json
+// @Param Signature header string true "HTTP signature of the request"
+// @Param Digest header string true "SHA-256 digest of the body"
+// @Success 202 {object} h.ResponseHTTP{}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 401 {object} h.ResponseHTTP{}
+// @Failure 403 {object} h.ResponseHTTP{}
+// @Failure 501 {object} h.ResponseHTTP{}
+// @Router /inbox [post]
+// @Router /members/{member_name}/inbox [post]
+func (fc *FedController) In(c *fiber.Ctx) error {
+	item, err := activitypub.UnmarshalJSON(c.Body())
+	if err != nil {
+		return h.Res(c, fiber.StatusBadRequest, "Malformed activity")
+	}
+	activity, err := activitypub.ToActivity(item)
+	if err != nil {
+		return h.Res(c, fiber.StatusBadRequest, "Not an activity")
+	}
+
+	if activity.Actor == nil {
+		return h.Res(c, fiber.StatusBadRequest, "Missing actor")
+	}
+	policy, err := fc.checkIRI(c.Context(), activity.Actor.GetLink().String())
+	if err != nil {
+		if isRefused(err) {
+			fc.log.Debug().Err(err).Msgf("refused activity %s", activity.ID)
+			return h.Res(c, fiber.StatusForbidden, "Domain not allowed to federate with this instance")
+		}
+		fc.log.Error().Err(err).Msgf("failed to check the policy for %s", activity.Actor.GetLink())
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to process activity")
+	}
+
+	actor, err := fc.verifyRequest(c, activity)
+	if err != nil {
+		fc.log.Warn().Err(err).Msgf("rejected activity %s", activity.ID)
+		if isRefused(err) {
+			return h.Res(c, fiber.StatusForbidden, "Domain not allowed to federate with this instance")
+		}
+		return h.Res(c, fiber.StatusUnauthorized, "Invalid signature")
+	}
+
+	isNew, err := fc.saveActivity(c.Context(), activity, "in", c.Body())
+	if err != nil {
+		fc.log.Error().Err(err).Msgf("failed to save activity %s", activity.ID)
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to process activity")
+	}
+	// the sender might retry a delivery that we've already processed
+	if !isNew {
+		return h.Res(c, fiber.StatusAccepted, "Activity already processed")
+	}
+
+	c.Locals("activity", activity)
+	c.Locals("remoteActor", actor)
+	c.Locals("domainPolicy", policy)
+
+	switch activity.Type {
+	case activitypub.FollowType:
+		return fc.Follow(c)
+	case activitypub.AcceptType, activitypub.RejectType:
+		return fc.followResponse(c)
+	case activitypub.UndoType:
+		return fc.undo(c)
+	case activitypub.CreateType, activitypub.UpdateType:
+		return fc.receiveReview(c)
+	case activitypub.DeleteType:
+		return fc.deleteReview(c)
+	default:
+		return fc.Unknown(c)
+	}
+}
+
+// Unknown handles unknown activity types
+func (fc *FedController) Unknown(c *fiber.Ctx) error {
+	return h.Res(c, fiber.StatusNotImplemented, "Unknown activity type")
+}
+
+// verifyRequest checks the HTTP signature of an incoming request and makes sure
+// that the signer is the actor of the activity
+func (fc *FedController) verifyRequest(c *fiber.Ctx, activity *activitypub.Activity) (*remoteActor, error) {
+	params, err := parseSignatureHeader(c.Get("Signature"))
+	if err != nil {
+		return nil, err
+	}
+
+	getHeader := func(name string) string {
+		if strings.EqualFold(name, "host") {
+			return string(c.Request().Host())
+		}
+		return c.Get(name)
+	}
+
+	// the key might be hosted elsewhere than the actor
+	if _, err = fc.checkIRI(c.Context(), params.KeyID); err != nil {
+		return nil, err
+	}
+	actor, key, err := fc.lookupKey(c.Context(), params.KeyID, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up key %s: %v", params.KeyID, err)
+	}
+	err = verifySignature(params, c.Method(), string(c.Request().RequestURI()), getHeader, c.Body(), key)
+	if err != nil {
+		// the key might have been rotated since we cached it
+		actor, key, err = fc.lookupKey(c.Context(), params.KeyID, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to refresh key %s: %v", params.KeyID, err)
+		}
+		if err = verifySignature(params, c.Method(), string(c.Request().RequestURI()), getHeader, c.Body(), key); err != nil {
+			return nil, err
+		}
+	}
+
+	if activity.Actor == nil || activity.Actor.GetLink().String() != actor.IRI {
+		return nil, fmt.Errorf("activity actor does not match the signer %s", actor.IRI)
+	}
+	return actor, nil
+}
+
+// saveActivity records an activity. It returns false if the activity has already been recorded
+func (fc *FedController) saveActivity(
+	ctx context.Context,
+	activity *activitypub.Activity,
+	direction string,
+	payload []byte,
+) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+		var object *string
+		if activity.Object != nil {
+			o := activity.Object.GetLink().String()
+			object = &o
+		}
+		var iri *string
+		if activity.ID != "" {
+			i := activity.ID.String()
+			iri = &i
+		}
+		if payload == nil {
+			var err error
+			payload, err = json.Marshal(activity)
+			if err != nil {
+				return false, fmt.Errorf("failed to encode activity: %v", err)
+			}
+		}
+		res, err := fc.storage.ExecContext(ctx, `INSERT INTO federation.activities
+		(iri, kind, actor, object, direction, payload)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (iri, direction) DO NOTHING`,
+			iri, string(activity.Type), activity.Actor.GetLink().String(), object, direction, payload)
+		if err != nil {
+			return false, fmt.Errorf("failed to save activity: %v", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return false, fmt.Errorf("failed to save activity: %v", err)
+		}
+		return n > 0, nil
+	}
+}
+
+// localWebfinger maps the IRI of a local actor to the member's webfinger
+func (fc *FedController) localWebfinger(iri activitypub.IRI) (string, error) {
+	u, err := url.Parse(iri.String())
+	if err != nil {
+		return "", fmt.Errorf("invalid IRI %s: %v", iri, err)
+	}
+	if u.Hostname() != fc.conf.Fiber.Domain {
+		return "", fmt.Errorf("%s is not a local actor", iri)
+	}
+	name, found := strings.CutPrefix(u.Path, "/api/members/")
+	if !found || name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("%s is not a member actor", iri)
+	}
+	return name + "@" + fc.conf.Fiber.Domain, nil
+}
@@ -2,12 +2,16 @@ package federation
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"github.com/go-ap/activitypub"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
 	"github.com/rs/zerolog"
 
+	"codeberg.org/mjh/LibRate/cfg"
+	"codeberg.org/mjh/LibRate/models"
 	"codeberg.org/mjh/LibRate/models/member"
 )
 
@@ -16,10 +20,21 @@ type FedHandler interface {
 	Converter
 	Follow(c *fiber.Ctx) error
 	In(c *fiber.Ctx) error
+	Out(c *fiber.Ctx) error
+	Actor(c *fiber.Ctx) error
 	Unknown(c *fiber.Ctx) error
+	// FollowRemote stores a follow request to a member of another instance and delivers it
+	FollowRemote(ctx context.Context, fr *member.FollowBlockRequest) member.FollowResponse
+	// RespondFollow notifies a remote requester that their follow request was accepted or rejected
+	RespondFollow(ctx context.Context, fr *member.FollowBlockRequest, accepted bool) error
+	// UndoFollow notifies a remote member that they were unfollowed
+	UndoFollow(ctx context.Context, follower, followee, followIRI string) error
+	// PublishReview delivers a review to the remote followers of the member who wrote it
+	PublishReview(ctx context.Context, activityType, memberName string, review *models.Review) error
 }
 
 type Converter interface {
+	CatalogConverter
 	// FollowToAS converts LibRate FollowBlockRequest to ActivityPub Follow
 	FollowToAS(ctx context.Context, req *member.FollowBlockRequest) (*activitypub.Follow, error)
 	MemberToActor(c *fiber.Ctx, m *member.Member) ([]byte, error)
@@ -27,17 +42,59 @@ type Converter interface {
 
 // FedController holds the dependencies for the federation handler
 type FedController struct {
-	log     *zerolog.Logger
-	storage *sqlx.DB
-	members member.Storer
+	log      *zerolog.Logger
+	storage  *sqlx.DB
+	members  member.Storer
+	ratings  *models.RatingStorage
+	conf     *cfg.Config
+	client   *http.Client
+	queue    *DeliveryQueue
+	policies domainPolicyStorer
 	Converter
 }
 
 type ConversionHandler struct {
-	log *zerolog.Logger
+	log  *zerolog.Logger
+	conf *cfg.Config
 }
 
 // NewFedController returns a new FedController
-func NewController(log *zerolog.Logger, storage *sqlx.DB, memberStorage member.Storer) *FedController {
-	return &FedController{log: log, storage: storage, members: memberStorage}
+func NewController(
+	log *zerolog.Logger,
+	storage *sqlx.DB,
+	memberStorage member.Storer,
+	conf *cfg.Config,
+) *FedController {
+	fc := &FedController{
+		log:      log,
+		storage:  storage,
+		members:  memberStorage,
+		ratings:  models.NewRatingStorage(storage, log),
+		policies: models.NewDomainPolicyStorage(storage, log),
+		conf:     conf,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		Converter: &ConversionHandler{
+			log:  log,
+			conf: conf,
+		},
+	}
+	fc.queue = newDeliveryQueue(models.NewDeliveryStorage(storage, log), log, &conf.Federation, fc.send)
+	return fc
+}
+
+// RunDelivery starts the workers delivering queued activities to other instances
+func (fc *FedController) RunDelivery(ctx context.Context) {
+	fc.queue.Run(ctx)
+}
+
+// baseURL returns the public URL of this instance
+func (fc *FedController) baseURL() string {
+	return instanceURL(fc.conf)
+}
+
+func instanceURL(conf *cfg.Config) string {
+	if conf.LibrateEnv == "development" || conf.LibrateEnv == "test" {
+		return "http://" + conf.Fiber.Domain
+	}
+	return "https://" + conf.Fiber.Domain
 }
@@ -0,0 +1,260 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-ap/activitypub"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid/v5"
+
+	"codeberg.org/mjh/LibRate/internal/crypt"
+	h "codeberg.org/mjh/LibRate/internal/handlers"
+	"codeberg.org/mjh/LibRate/models"
+	"codeberg.org/mjh/LibRate/models/member"
+)
+
+// asContext is prepended to every document we serve or deliver
+const asContext = `"@context":["https://www.w3.org/ns/activitystreams","https://w3id.org/security/v1"]`
+
+// @Summary Get a member's ActivityPub actor document
+// @Tags federation
+// @Produce json
+// @Param member_name path string true "The nickname of the member"
+// @Success 200 {object} activitypub.Actor
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /members/{member_name} [get]
+func (fc *FedController) Actor(c *fiber.Ctx) error {
+	m, err := fc.signingMember(c.Context(), c.Params("member_name"))
+	if err != nil {
+		fc.log.Debug().Err(err).Msg("actor lookup failed")
+		return h.Res(c, fiber.StatusNotFound, "Member not found")
+	}
+	actor, err := fc.MemberToActor(c, m)
+	if err != nil {
+		fc.log.Error().Err(err).Msgf("failed to convert %s to actor", m.MemberName)
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to create actor")
+	}
+	c.Set(fiber.HeaderContentType, activityJSON)
+	return c.Send(withContext(actor))
+}
+
+// Out serves the activities sent by a member
+// @Summary Get a member's outbox
+// @Tags federation
+// @Produce json
+// @Param member_name path string true "The nickname of the member"
+// @Param limit query int false "Number of activities to return" default(20)
+// @Param offset query int false "Number of activities to skip" default(0)
+// @Success 200 {object} activitypub.OrderedCollection
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /members/{member_name}/outbox [get]
+func (fc *FedController) Out(c *fiber.Ctx) error {
+	name := c.Params("member_name")
+	if _, err := fc.members.GetID(c.Context(), name); err != nil {
+		return h.Res(c, fiber.StatusNotFound, "Member not found")
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		return h.Res(c, fiber.StatusBadRequest, "Invalid limit")
+	}
+	offset, err := strconv.Atoi(c.Query("offset", "0"))
+	if err != nil || offset < 0 {
+		return h.Res(c, fiber.StatusBadRequest, "Invalid offset")
+	}
+
+	actorIRI := fc.actorIRI(name)
+	var total uint
+	if err = fc.storage.GetContext(c.Context(), &total, `SELECT count(*) FROM federation.activities
+		WHERE actor = $1 AND direction = 'out'`, actorIRI); err != nil {
+		fc.log.Error().Err(err).Msgf("failed to count activities of %s", name)
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to load outbox")
+	}
+	var payloads [][]byte
+	if err = fc.storage.SelectContext(c.Context(), &payloads, `SELECT payload FROM federation.activities
+		WHERE actor = $1 AND direction = 'out'
+		ORDER BY created DESC
+		LIMIT $2 OFFSET $3`, actorIRI, limit, offset); err != nil {
+		fc.log.Error().Err(err).Msgf("failed to load activities of %s", name)
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to load outbox")
+	}
+
+	// the payloads are embedded as they are, since not all of them (e.g. reviews)
+	// can be represented with the ActivityStreams vocabulary alone
+	items := make([]json.RawMessage, len(payloads))
+	for i := range payloads {
+		items[i] = payloads[i]
+	}
+	doc, err := json.Marshal(struct {
+		ID           string            `json:"id"`
+		Type         string            `json:"type"`
+		TotalItems   uint              `json:"totalItems"`
+		OrderedItems []json.RawMessage `json:"orderedItems"`
+	}{
+		ID:           actorIRI + "/outbox",
+		Type:         string(activitypub.OrderedCollectionType),
+		TotalItems:   total,
+		OrderedItems: items,
+	})
+	if err != nil {
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to encode outbox")
+	}
+	c.Set(fiber.HeaderContentType, activityJSON)
+	return c.Send(withContext(doc))
+}
+
+// @Summary Get an activity sent from this instance
+// @Tags federation
+// @Produce json
+// @Param id path string true "The ID of the activity"
+// @Success 200 {object} activitypub.Activity
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Router /activities/{id} [get]
+func (fc *FedController) Activity(c *fiber.Ctx) error {
+	var payload []byte
+	err := fc.storage.GetContext(c.Context(), &payload, `SELECT payload FROM federation.activities
+		WHERE iri = $1 AND direction = 'out'`, fc.baseURL()+"/api/activities/"+c.Params("id"))
+	if err != nil {
+		return h.Res(c, fiber.StatusNotFound, "Activity not found")
+	}
+	c.Set(fiber.HeaderContentType, activityJSON)
+	return c.Send(payload)
+}
+
+// deliver records an activity in the sender's outbox and queues it for delivery to the given inbox
+func (fc *FedController) deliver(ctx context.Context, sender, inbox string, activity *activitypub.Activity) error {
+	doc, err := activity.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to encode activity: %v", err)
+	}
+	return fc.deliverPayload(ctx, sender, inbox, activity, withContext(doc))
+}
+
+// deliverPayload is like deliver, but for activities which can't be expressed with the
+// ActivityStreams vocabulary alone. The activity is then only used for bookkeeping.
+func (fc *FedController) deliverPayload(
+	ctx context.Context,
+	sender, inbox string,
+	activity *activitypub.Activity,
+	payload []byte,
+) error {
+	if _, err := fc.saveActivity(ctx, activity, "out", payload); err != nil {
+		return err
+	}
+	if _, err := fc.checkIRI(ctx, inbox); err != nil {
+		if isRefused(err) {
+			fc.log.Debug().Err(err).Msgf("not delivering %s to %s", activity.ID, inbox)
+			return nil
+		}
+		return err
+	}
+	return fc.queue.Enqueue(ctx, sender, inbox, activity.ID.String(), payload)
+}
+
+// send posts a queued activity to the remote inbox, signed with the sender's key
+func (fc *FedController) send(ctx context.Context, d *models.Delivery) error {
+	// the domain might have been blocked after the delivery was queued
+	if _, err := fc.checkDomain(ctx, d.Host); err != nil {
+		if isRefused(err) {
+			return permanentError{err}
+		}
+		return err
+	}
+	m, err := fc.signingMember(ctx, strings.Split(d.Sender, "@")[0])
+	if err != nil {
+		return err
+	}
+	key, err := crypt.ParseRSAPrivateKey(m.PrivateKeyPem)
+	if err != nil {
+		return permanentError{err}
+	}
+	return postActivity(ctx, fc.client, d.Inbox, fc.actorIRI(m.MemberName)+"#main-key", key, d.Payload)
+}
+
+// postActivity signs and posts an activity. Failures which retrying won't fix are
+// returned as permanentError
+func postActivity(
+	ctx context.Context,
+	client *http.Client,
+	inbox, keyID string,
+	key *rsa.PrivateKey,
+	payload []byte,
+) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, inbox, bytes.NewReader(payload))
+	if err != nil {
+		return permanentError{fmt.Errorf("failed to create delivery request: %v", err)}
+	}
+	req.Header.Set("Content-Type", activityJSON)
+	req.Header.Set("Accept", activityJSON)
+	if err = SignRequest(req, keyID, key, payload); err != nil {
+		return err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("delivery to %s failed: %v", inbox, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	err = fmt.Errorf("delivery to %s failed with %s: %s", inbox, res.Status, body)
+	// the remote server is telling us that the request itself is wrong, so retrying won't help,
+	// except for the statuses used for rate limiting
+	if res.StatusCode >= 400 && res.StatusCode <= 499 &&
+		res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests {
+		return permanentError{err}
+	}
+	return err
+}
+
+// signingMember reads a local member, generating the signing keypair for accounts created
+// before federation was supported
+func (fc *FedController) signingMember(ctx context.Context, name string) (*member.Member, error) {
+	m, err := fc.members.Read(ctx, name, "nick")
+	if err != nil {
+		return nil, err
+	}
+	if m.PrivateKeyPem != "" {
+		return m, nil
+	}
+	m.PublicKeyPem, m.PrivateKeyPem, err = crypt.GenerateRSAKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	if err = fc.members.SetKeys(ctx, m.MemberName, m.PublicKeyPem, m.PrivateKeyPem); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// actorIRI returns the IRI of a local member's actor, given either the nickname or the webfinger
+func (fc *FedController) actorIRI(member string) string {
+	return fc.baseURL() + "/api/members/" + strings.Split(member, "@")[0]
+}
+
+func (fc *FedController) newActivityIRI() activitypub.ID {
+	return activitypub.ID(fc.baseURL() + "/api/activities/" + uuid.Must(uuid.NewV7()).String())
+}
+
+// withContext adds the JSON-LD context to an encoded ActivityStreams object
+func withContext(doc []byte) []byte {
+	if len(doc) < 2 || doc[0] != '{' {
+		return doc
+	}
+	if doc[1] == '}' {
+		return []byte("{" + asContext + "}")
+	}
+	return append([]byte("{"+asContext+","), doc[1:]...)
+}
@@ -0,0 +1,190 @@
+package federation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+
+	h "codeberg.org/mjh/LibRate/internal/handlers"
+	"codeberg.org/mjh/LibRate/models"
+)
+
+// domainPolicyStorer is implemented by models.DomainPolicyStorage
+type domainPolicyStorer interface {
+	Match(ctx context.Context, host string) (*models.DomainPolicy, error)
+	Set(ctx context.Context, p *models.DomainPolicy) error
+	Remove(ctx context.Context, domain string) error
+	List(ctx context.Context) ([]*models.DomainPolicy, error)
+}
+
+var (
+	errDomainBlocked  = errors.New("domain is blocked")
+	errNotAllowlisted = errors.New("domain is not on the allowlist")
+)
+
+// checkDomain returns the policy applying to a remote host, or an error if federating
+// with it is not allowed. Policies are looked up on every call, so that changes made by
+// the admins take effect immediately
+func (fc *FedController) checkDomain(ctx context.Context, host string) (*models.DomainPolicy, error) {
+	host = strings.ToLower(host)
+	if host == "" || host == fc.conf.Fiber.Domain {
+		return nil, nil
+	}
+	policy, err := fc.policies.Match(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case policy != nil && policy.Severity == models.SeverityBlock:
+		return policy, fmt.Errorf("%s: %w", host, errDomainBlocked)
+	case policy == nil && fc.conf.Federation.AllowlistMode:
+		return nil, fmt.Errorf("%s: %w", host, errNotAllowlisted)
+	}
+	return policy, nil
+}
+
+// checkIRI is like checkDomain, but for the host of an IRI
+func (fc *FedController) checkIRI(ctx context.Context, iri string) (*models.DomainPolicy, error) {
+	u, err := url.Parse(iri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IRI %s: %v", iri, err)
+	}
+	return fc.checkDomain(ctx, u.Hostname())
+}
+
+// isRefused tells whether the error comes from a domain policy
+func isRefused(err error) bool {
+	return errors.Is(err, errDomainBlocked) || errors.Is(err, errNotAllowlisted)
+}
+
+// embeddedMedia matches the tags of the HTML elements used to embed images, videos etc.
+var embeddedMedia = regexp.MustCompile(`(?i)</?(img|video|audio|picture|source|track|iframe|embed|object)\b[^>]*>`)
+
+// stripMedia removes the embedded media from HTML content of a domain with reject_media set
+func stripMedia(content string) string {
+	return embeddedMedia.ReplaceAllString(content, "")
+}
+
+// isAdmin checks if the request was made by a local administrator
+func (fc *FedController) isAdmin(c *fiber.Ctx) (string, bool) {
+	requester, ok := c.Locals("jwtToken").(*jwt.Token)
+	if !ok {
+		return "", false
+	}
+	claims := requester.Claims.(jwt.MapClaims)
+	wf, _ := claims["webfinger"].(string)
+	name, domain, found := strings.Cut(wf, "@")
+	if !found || domain != fc.conf.Fiber.Domain {
+		return "", false
+	}
+	if !fc.members.HasRole(c.Context(), name, "admin", true) {
+		fc.log.Warn().Msgf("Member %s tried to manage domain policies", name)
+		return "", false
+	}
+	return wf, true
+}
+
+// @Summary List domain policies
+// @Description Lists the blocked, silenced and allowed domains
+// @Tags federation,administration
+// @Produce json
+// @Success 200 {object} h.ResponseHTTP{data=[]models.DomainPolicy}
+// @Failure 403 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /admin/federation/domains [get]
+func (fc *FedController) ListDomainPolicies(c *fiber.Ctx) error {
+	if _, ok := fc.isAdmin(c); !ok {
+		return h.Res(c, fiber.StatusForbidden, "Forbidden")
+	}
+	policies, err := fc.policies.List(c.Context())
+	if err != nil {
+		fc.log.Error().Err(err).Msg("failed to list domain policies")
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to list domain policies")
+	}
+	return h.ResData(c, fiber.StatusOK, "OK", policies)
+}
+
+// DomainPolicyInput is the body of a request setting a domain policy
+type DomainPolicyInput struct {
+	Severity    string `json:"severity" validate:"required,oneof=allow silence block" example:"silence"`
+	RejectMedia bool   `json:"reject_media"`
+	Reason      string `json:"reason,omitempty" example:"spam"`
+}
+
+// @Summary Set a domain policy
+// @Description Blocks, silences or allows a domain, along with its subdomains.
+// @Description Blocking a domain removes the reviews and follows of its members.
+// @Tags federation,administration
+// @Accept json
+// @Produce json
+// @Param domain path string true "The domain"
+// @Param input body DomainPolicyInput true "The policy"
+// @Param X-CSRF-Token header string true "X-CSRF-Token header"
+// @Success 200 {object} h.ResponseHTTP{data=models.DomainPolicy}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 403 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /admin/federation/domains/{domain} [put]
+func (fc *FedController) SetDomainPolicy(c *fiber.Ctx) error {
+	admin, ok := fc.isAdmin(c)
+	if !ok {
+		return h.Res(c, fiber.StatusForbidden, "Forbidden")
+	}
+	var input DomainPolicyInput
+	if err := c.BodyParser(&input); err != nil {
+		return h.Res(c, fiber.StatusBadRequest, "Invalid input")
+	}
+	policy := &models.DomainPolicy{
+		Domain:      c.Params("domain"),
+		Severity:    input.Severity,
+		RejectMedia: input.RejectMedia,
+		Reason:      sql.NullString{String: input.Reason, Valid: input.Reason != ""},
+		CreatedBy:   sql.NullString{String: admin, Valid: true},
+	}
+	if err := policy.Validate(); err != nil {
+		return h.Res(c, fiber.StatusBadRequest, err.Error())
+	}
+	if policy.Domain == fc.conf.Fiber.Domain {
+		return h.Res(c, fiber.StatusBadRequest, "Cannot set a policy for this instance")
+	}
+	if err := fc.policies.Set(c.Context(), policy); err != nil {
+		fc.log.Error().Err(err).Msgf("failed to set policy for %s", policy.Domain)
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to set domain policy")
+	}
+	fc.log.Info().Msgf("%s set the policy for %s to %s", admin, policy.Domain, policy.Severity)
+	return h.ResData(c, fiber.StatusOK, "OK", policy)
+}
+
+// @Summary Remove a domain policy
+// @Tags federation,administration
+// @Produce json
+// @Param domain path string true "The domain"
+// @Param X-CSRF-Token header string true "X-CSRF-Token header"
+// @Success 200 {object} h.ResponseHTTP{}
+// @Failure 403 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /admin/federation/domains/{domain} [delete]
+func (fc *FedController) RemoveDomainPolicy(c *fiber.Ctx) error {
+	admin, ok := fc.isAdmin(c)
+	if !ok {
+		return h.Res(c, fiber.StatusForbidden, "Forbidden")
+	}
+	domain := c.Params("domain")
+	if err := fc.policies.Remove(c.Context(), domain); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return h.Res(c, fiber.StatusNotFound, "No policy for this domain")
+		}
+		fc.log.Error().Err(err).Msgf("failed to remove policy for %s", domain)
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to remove domain policy")
+	}
+	fc.log.Info().Msgf("%s removed the policy for %s", admin, domain)
+	return h.Res(c, fiber.StatusOK, "OK")
+}
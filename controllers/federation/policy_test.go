@@ -0,0 +1,126 @@
+package federation
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/cfg"
+	"codeberg.org/mjh/LibRate/models"
+)
+
+// memoryPolicies mimics the domain policy table
+type memoryPolicies map[string]*models.DomainPolicy
+
+func (m memoryPolicies) Match(_ context.Context, host string) (*models.DomainPolicy, error) {
+	for _, domain := range models.ParentDomains(host) {
+		if p, ok := m[domain]; ok {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m memoryPolicies) Set(_ context.Context, p *models.DomainPolicy) error {
+	m[p.Domain] = p
+	return nil
+}
+
+func (m memoryPolicies) Remove(_ context.Context, domain string) error {
+	delete(m, domain)
+	return nil
+}
+
+func (m memoryPolicies) List(_ context.Context) (policies []*models.DomainPolicy, err error) {
+	for _, p := range m {
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+func newPolicyController(allowlist bool) *FedController {
+	conf := cfg.TestConfig
+	conf.Fiber.Domain = "librate.club"
+	conf.Federation.AllowlistMode = allowlist
+	log := zerolog.Nop()
+	return &FedController{
+		conf: &conf,
+		log:  &log,
+		policies: memoryPolicies{
+			"spam.example":     {Domain: "spam.example", Severity: models.SeverityBlock},
+			"ok.spam.example":  {Domain: "ok.spam.example", Severity: models.SeverityAllow},
+			"loud.example":     {Domain: "loud.example", Severity: models.SeveritySilence},
+			"bookwyrm.example": {Domain: "bookwyrm.example", Severity: models.SeverityAllow},
+		},
+	}
+}
+
+func TestCheckDomain(t *testing.T) {
+	cases := []struct {
+		host      string
+		allowlist bool
+		want      error
+	}{
+		{host: "librate.club", allowlist: true},
+		{host: "spam.example", want: errDomainBlocked},
+		{host: "a.spam.example", want: errDomainBlocked},
+		{host: "OK.spam.example"},
+		{host: "loud.example"},
+		{host: "unknown.example"},
+		{host: "unknown.example", allowlist: true, want: errNotAllowlisted},
+		{host: "loud.example", allowlist: true},
+		{host: "social.bookwyrm.example", allowlist: true},
+		{host: "spam.example", allowlist: true, want: errDomainBlocked},
+	}
+	for _, tc := range cases {
+		fc := newPolicyController(tc.allowlist)
+		_, err := fc.checkDomain(context.Background(), tc.host)
+		if tc.want == nil {
+			assert.NoError(t, err, tc.host)
+		} else {
+			assert.ErrorIs(t, err, tc.want, tc.host)
+			assert.True(t, isRefused(err))
+		}
+	}
+}
+
+func TestInboxRefusesBlockedDomain(t *testing.T) {
+	fc := newPolicyController(false)
+	app := fiber.New()
+	app.Post("/api/inbox", fc.In)
+
+	req := httptest.NewRequest(fiber.MethodPost, "/api/inbox", strings.NewReader(`{
+		"id": "https://a.spam.example/activities/1",
+		"type": "Follow",
+		"actor": "https://a.spam.example/users/bot",
+		"object": "https://librate.club/api/members/lain"
+	}`))
+	req.Header.Set(fiber.HeaderContentType, activityJSON)
+	res, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusForbidden, res.StatusCode)
+}
+
+func TestSendToBlockedDomain(t *testing.T) {
+	fc := newPolicyController(false)
+	err := fc.send(context.Background(), &models.Delivery{
+		Sender: "lain",
+		Inbox:  "https://spam.example/inbox",
+		Host:   "spam.example",
+	})
+	var permanent permanentError
+	assert.True(t, errors.As(err, &permanent), "blocked deliveries should not be retried")
+}
+
+func TestStripMedia(t *testing.T) {
+	content := `<p>Great album <img src="https://x.example/a.png" alt="cover"/></p>` +
+		`<video controls><source src="clip.mp4"></video><p>Bye</p>`
+	assert.Equal(t, `<p>Great album </p><p>Bye</p>`, stripMedia(content))
+}
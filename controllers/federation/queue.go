@@ -0,0 +1,214 @@
+package federation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"codeberg.org/mjh/LibRate/cfg"
+	"codeberg.org/mjh/LibRate/models"
+)
+
+const (
+	// how long a worker may hold a delivery before it can be claimed by another one
+	deliveryLease = 2 * time.Minute
+	// how often workers look for deliveries that became due
+	pollInterval = 5 * time.Second
+	baseBackoff  = 30 * time.Second
+	maxBackoff   = 12 * time.Hour
+)
+
+type (
+	deliveryStorer interface {
+		Enqueue(ctx context.Context, d *models.Delivery) error
+		Claim(ctx context.Context, exclude []string, lease time.Duration) (*models.Delivery, error)
+		Complete(ctx context.Context, id int64) error
+		Reschedule(ctx context.Context, id int64, next time.Time, lastErr string) error
+		Bury(ctx context.Context, id int64, lastErr string) error
+	}
+
+	// DeliveryQueue is a pool of workers delivering the activities persisted in the
+	// delivery table. Failed deliveries are retried with exponential backoff, until
+	// they run out of attempts and end up in the dead letter queue.
+	DeliveryQueue struct {
+		store       deliveryStorer
+		log         *zerolog.Logger
+		send        func(ctx context.Context, d *models.Delivery) error
+		workers     int
+		maxPerHost  int
+		maxAttempts int
+		// mu guards inFlight and makes claiming a delivery and reserving its host atomic.
+		// The per host limit applies to this process only
+		mu       sync.Mutex
+		inFlight map[string]int
+		wake     chan struct{}
+	}
+
+	// permanentError marks a delivery failure which retrying won't fix
+	permanentError struct {
+		err error
+	}
+)
+
+func (e permanentError) Error() string { return e.err.Error() }
+
+func (e permanentError) Unwrap() error { return e.err }
+
+func newDeliveryQueue(
+	store deliveryStorer,
+	log *zerolog.Logger,
+	conf *cfg.FederationConfig,
+	send func(ctx context.Context, d *models.Delivery) error,
+) *DeliveryQueue {
+	q := &DeliveryQueue{
+		store:       store,
+		log:         log,
+		send:        send,
+		workers:     conf.DeliveryWorkers,
+		maxPerHost:  conf.MaxPerHost,
+		maxAttempts: conf.MaxAttempts,
+		inFlight:    make(map[string]int),
+		wake:        make(chan struct{}, 1),
+	}
+	if q.workers < 1 {
+		q.workers = 4
+	}
+	if q.maxPerHost < 1 {
+		q.maxPerHost = 2
+	}
+	if q.maxAttempts < 1 {
+		q.maxAttempts = 10
+	}
+	return q
+}
+
+// Enqueue persists a delivery and wakes up an idle worker
+func (q *DeliveryQueue) Enqueue(ctx context.Context, sender, inbox, activityIRI string, payload []byte) error {
+	u, err := url.Parse(inbox)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid inbox %s", inbox)
+	}
+	err = q.store.Enqueue(ctx, &models.Delivery{
+		Sender:      sender,
+		Inbox:       inbox,
+		Host:        u.Host,
+		ActivityIRI: sql.NullString{String: activityIRI, Valid: activityIRI != ""},
+		Payload:     payload,
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run starts the workers, which stop when the context is cancelled
+func (q *DeliveryQueue) Run(ctx context.Context) {
+	for i := 0; i < q.workers; i++ {
+		go q.work(ctx)
+	}
+}
+
+func (q *DeliveryQueue) work(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		// drain everything that's due before going idle
+		for q.processNext(ctx) {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// processNext claims and attempts a single delivery. It returns false if there was nothing to do
+func (q *DeliveryQueue) processNext(ctx context.Context) bool {
+	d, err := q.claim(ctx)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) && ctx.Err() == nil {
+			q.log.Error().Err(err).Msg("failed to claim delivery")
+		}
+		return false
+	}
+	defer q.release(d.Host)
+
+	sendCtx, cancel := context.WithTimeout(ctx, deliveryLease/2)
+	err = q.send(sendCtx, d)
+	cancel()
+	if err == nil {
+		if err = q.store.Complete(ctx, d.ID); err != nil {
+			q.log.Error().Err(err).Msgf("failed to complete delivery %d", d.ID)
+		}
+		return true
+	}
+
+	var permanent permanentError
+	if errors.As(err, &permanent) || int(d.Attempts)+1 >= q.maxAttempts {
+		q.log.Warn().Err(err).Msgf("giving up on delivery %d to %s", d.ID, d.Inbox)
+		if err = q.store.Bury(ctx, d.ID, err.Error()); err != nil {
+			q.log.Error().Err(err).Msgf("failed to bury delivery %d", d.ID)
+		}
+		return true
+	}
+
+	next := time.Now().Add(backoff(d.Attempts + 1))
+	q.log.Debug().Err(err).Msgf("delivery %d to %s failed, retrying at %s", d.ID, d.Inbox, next)
+	if err = q.store.Reschedule(ctx, d.ID, next, err.Error()); err != nil {
+		q.log.Error().Err(err).Msgf("failed to reschedule delivery %d", d.ID)
+	}
+	return true
+}
+
+// claim takes the next due delivery to a host which hasn't reached its concurrency limit
+func (q *DeliveryQueue) claim(ctx context.Context) (*models.Delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var saturated []string
+	for host, n := range q.inFlight {
+		if n >= q.maxPerHost {
+			saturated = append(saturated, host)
+		}
+	}
+	d, err := q.store.Claim(ctx, saturated, deliveryLease)
+	if err != nil {
+		return nil, err
+	}
+	q.inFlight[d.Host]++
+	return d, nil
+}
+
+func (q *DeliveryQueue) release(host string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.inFlight[host] <= 1 {
+		delete(q.inFlight, host)
+		return
+	}
+	q.inFlight[host]--
+}
+
+// backoff returns the delay before the given attempt, doubling with each failure
+func backoff(attempt int32) time.Duration {
+	delay := baseBackoff
+	for i := int32(1); i < attempt; i++ {
+		delay *= 2
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return delay
+}
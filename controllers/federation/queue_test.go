@@ -0,0 +1,226 @@
+package federation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/cfg"
+	"codeberg.org/mjh/LibRate/internal/crypt"
+	"codeberg.org/mjh/LibRate/models"
+	"codeberg.org/mjh/LibRate/tests"
+)
+
+// memoryDeliveries mimics the delivery table
+type memoryDeliveries struct {
+	mu     sync.Mutex
+	lastID int64
+	rows   map[int64]*models.Delivery
+}
+
+func newMemoryDeliveries() *memoryDeliveries {
+	return &memoryDeliveries{rows: make(map[int64]*models.Delivery)}
+}
+
+func (m *memoryDeliveries) Enqueue(_ context.Context, d *models.Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	d.ID, d.Status, d.NextAttempt, d.Created = m.lastID, "pending", time.Now(), time.Now()
+	row := *d
+	m.rows[d.ID] = &row
+	return nil
+}
+
+func (m *memoryDeliveries) Claim(_ context.Context, exclude []string, lease time.Duration) (*models.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due *models.Delivery
+	for _, d := range m.rows {
+		if d.Status != "pending" || d.NextAttempt.After(time.Now()) || slices.Contains(exclude, d.Host) {
+			continue
+		}
+		if due == nil || d.NextAttempt.Before(due.NextAttempt) {
+			due = d
+		}
+	}
+	if due == nil {
+		return nil, fmt.Errorf("error claiming delivery: %w", sql.ErrNoRows)
+	}
+	due.Status = "running"
+	due.LockedUntil = sql.NullTime{Time: time.Now().Add(lease), Valid: true}
+	claimed := *due
+	return &claimed, nil
+}
+
+func (m *memoryDeliveries) Complete(_ context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.rows, id)
+	return nil
+}
+
+func (m *memoryDeliveries) Reschedule(_ context.Context, id int64, next time.Time, lastErr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := m.rows[id]
+	d.Status, d.NextAttempt, d.LastError = "pending", next, sql.NullString{String: lastErr, Valid: true}
+	d.Attempts++
+	return nil
+}
+
+func (m *memoryDeliveries) Bury(_ context.Context, id int64, lastErr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := m.rows[id]
+	d.Status, d.LastError = "dead", sql.NullString{String: lastErr, Valid: true}
+	d.Attempts++
+	return nil
+}
+
+func (m *memoryDeliveries) get(id int64) (models.Delivery, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.rows[id]
+	if !ok {
+		return models.Delivery{}, false
+	}
+	return *d, true
+}
+
+// makeDue pretends that the backoff of a delivery has elapsed
+func (m *memoryDeliveries) makeDue(id int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rows[id].NextAttempt = time.Now()
+}
+
+func (m *memoryDeliveries) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.rows)
+}
+
+func newTestQueue(t *testing.T, store *memoryDeliveries, conf cfg.FederationConfig) *DeliveryQueue {
+	t.Helper()
+	_, privPem, err := crypt.GenerateRSAKeyPair()
+	require.NoError(t, err)
+	key, err := crypt.ParseRSAPrivateKey(privPem)
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	return newDeliveryQueue(store, &log, &conf, func(ctx context.Context, d *models.Delivery) error {
+		return postActivity(ctx, http.DefaultClient, d.Inbox, "https://lr.localhost/api/members/"+d.Sender+"#main-key", key, d.Payload)
+	})
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	inbox := tests.NewRemoteInbox()
+	defer inbox.Close()
+	store := newMemoryDeliveries()
+	q := newTestQueue(t, store, cfg.FederationConfig{MaxAttempts: 3})
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue(ctx, "lain", inbox.Inbox(), "https://lr.localhost/api/activities/1", []byte(`{"type":"Follow"}`)))
+	inbox.FailNext(1, http.StatusServiceUnavailable)
+
+	start := time.Now()
+	assert.True(t, q.processNext(ctx))
+	d, ok := store.get(1)
+	require.True(t, ok)
+	assert.Equal(t, "pending", d.Status)
+	assert.EqualValues(t, 1, d.Attempts)
+	assert.WithinDuration(t, start.Add(baseBackoff), d.NextAttempt, 5*time.Second)
+	// not due yet
+	assert.False(t, q.processNext(ctx))
+
+	store.makeDue(1)
+	assert.True(t, q.processNext(ctx))
+	_, ok = store.get(1)
+	assert.False(t, ok, "successful delivery should be removed from the queue")
+
+	received := inbox.Received()
+	require.Len(t, received, 1)
+	params, err := parseSignatureHeader(received[0].Header.Get("Signature"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://lr.localhost/api/members/lain#main-key", params.KeyID)
+	assert.JSONEq(t, `{"type":"Follow"}`, string(received[0].Body))
+}
+
+func TestDeliveryDeadLetters(t *testing.T) {
+	inbox := tests.NewRemoteInbox()
+	defer inbox.Close()
+	store := newMemoryDeliveries()
+	q := newTestQueue(t, store, cfg.FederationConfig{MaxAttempts: 2})
+	ctx := context.Background()
+
+	t.Run("out of attempts", func(t *testing.T) {
+		require.NoError(t, q.Enqueue(ctx, "lain", inbox.Inbox(), "", []byte(`{}`)))
+		inbox.FailNext(2, http.StatusBadGateway)
+		assert.True(t, q.processNext(ctx))
+		store.makeDue(1)
+		assert.True(t, q.processNext(ctx))
+		d, ok := store.get(1)
+		require.True(t, ok)
+		assert.Equal(t, "dead", d.Status)
+		assert.Contains(t, d.LastError.String, "502")
+	})
+
+	t.Run("permanent failure", func(t *testing.T) {
+		require.NoError(t, q.Enqueue(ctx, "lain", inbox.Inbox(), "", []byte(`{}`)))
+		inbox.FailNext(1, http.StatusGone)
+		assert.True(t, q.processNext(ctx))
+		d, ok := store.get(2)
+		require.True(t, ok)
+		assert.Equal(t, "dead", d.Status)
+		assert.EqualValues(t, 1, d.Attempts)
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		require.NoError(t, q.Enqueue(ctx, "lain", inbox.Inbox(), "", []byte(`{}`)))
+		inbox.FailNext(1, http.StatusTooManyRequests)
+		assert.True(t, q.processNext(ctx))
+		d, ok := store.get(3)
+		require.True(t, ok)
+		assert.Equal(t, "pending", d.Status)
+	})
+}
+
+func TestDeliveryPerHostLimit(t *testing.T) {
+	slow, other := tests.NewRemoteInbox(), tests.NewRemoteInbox()
+	defer slow.Close()
+	defer other.Close()
+	slow.Delay, other.Delay = 50*time.Millisecond, 50*time.Millisecond
+
+	store := newMemoryDeliveries()
+	q := newTestQueue(t, store, cfg.FederationConfig{DeliveryWorkers: 4, MaxPerHost: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, q.Enqueue(ctx, "lain", slow.Inbox(), "", []byte(`{}`)))
+		require.NoError(t, q.Enqueue(ctx, "lain", other.Inbox(), "", []byte(`{}`)))
+	}
+	q.Run(ctx)
+
+	require.Eventually(t, func() bool { return store.len() == 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.Len(t, slow.Received(), 4)
+	assert.Len(t, other.Received(), 4)
+	assert.Equal(t, 1, slow.MaxConcurrent())
+	assert.Equal(t, 1, other.MaxConcurrent())
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, baseBackoff, backoff(1))
+	assert.Equal(t, 2*baseBackoff, backoff(2))
+	assert.Equal(t, 8*baseBackoff, backoff(4))
+	assert.Equal(t, maxBackoff, backoff(30))
+}
@@ -0,0 +1,285 @@
+package federation
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ap/activitypub"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid/v5"
+
+	h "codeberg.org/mjh/LibRate/internal/handlers"
+	"codeberg.org/mjh/LibRate/models"
+)
+
+const publicCollection = "https://www.w3.org/ns/activitystreams#Public"
+
+var (
+	// bookwyrmScale is the scale of the rating property, with half stars
+	bookwyrmScale = models.RatingScale{Lower: 0, Upper: 5, Step: 0.5}
+	// legacyScale is the scale of the stars property
+	legacyScale = models.RatingScale{Lower: 0, Upper: 10, Step: 1}
+)
+
+type (
+	// reviewObject is the federated representation of a review. ActivityStreams has no
+	// vocabulary for ratings, so the object follows the one used by BookWyrm, which
+	// uses a 5 star scale, and adds the 0-10 score of older LibRate instances
+	// and the exact score on the 0-1000 reference scale. The scores are decoded as floats,
+	// so that a single malformed one can be skipped instead of failing the whole object.
+	reviewObject struct {
+		ID           string    `json:"id"`
+		Type         string    `json:"type"`
+		AttributedTo string    `json:"attributedTo"`
+		Name         string    `json:"name,omitempty"`
+		Content      string    `json:"content,omitempty"`
+		Published    time.Time `json:"published,omitempty"`
+		Rating       *float64  `json:"rating,omitempty"`
+		Stars        *float64  `json:"stars,omitempty"`
+		Score        *float64  `json:"score,omitempty"`
+		Media        string    `json:"inReplyTo,omitempty"`
+		MediaKind    string    `json:"mediaKind,omitempty"`
+		// BookWyrm only knows of books, which it reads from inReplyToBook
+		Book string   `json:"inReplyToBook,omitempty"`
+		To   []string `json:"to,omitempty"`
+		Cc   []string `json:"cc,omitempty"`
+	}
+
+	reviewActivity struct {
+		ID     string          `json:"id"`
+		Type   string          `json:"type"`
+		Actor  string          `json:"actor"`
+		Object json.RawMessage `json:"object"`
+		To     []string        `json:"to,omitempty"`
+		Cc     []string        `json:"cc,omitempty"`
+	}
+)
+
+// PublishReview delivers a Create, Update or Delete of a local review to the remote
+// followers of its author. The author is the signed in member who made the change,
+// never the user_id stored with the review
+func (fc *FedController) PublishReview(ctx context.Context, activityType, memberName string, review *models.Review) error {
+	author, err := fc.members.Read(ctx, memberName, "nick")
+	if err != nil {
+		return fmt.Errorf("failed to read author of review %d: %v", review.ID, err)
+	}
+	inboxes, err := fc.followerInboxes(ctx, author.Webfinger)
+	if err != nil {
+		return err
+	}
+	if len(inboxes) == 0 {
+		return nil
+	}
+
+	actorIRI := fc.actorIRI(author.MemberName)
+	to, cc := []string{publicCollection}, []string{actorIRI + "/followers"}
+	objectIRI := fc.reviewIRI(review.ID)
+
+	var object any
+	if activityType == string(activitypub.DeleteType) {
+		object = activitypub.Tombstone{ID: activitypub.ID(objectIRI), Type: activitypub.TombstoneType}
+	} else {
+		var kind string
+		err = fc.storage.GetContext(ctx, &kind, `SELECT kind FROM media.media WHERE id = $1`, review.MediaID)
+		if err != nil {
+			return fmt.Errorf("failed to get the kind of media %s: %v", review.MediaID, err)
+		}
+		object = fc.ReviewToAS(review, actorIRI, kind)
+	}
+	encoded, err := json.Marshal(object)
+	if err != nil {
+		return fmt.Errorf("failed to encode review %d: %v", review.ID, err)
+	}
+
+	activity := activitypub.ActivityNew(fc.newActivityIRI(), activitypub.ActivityVocabularyType(activityType),
+		activitypub.IRI(objectIRI))
+	activity.Actor = activitypub.IRI(actorIRI)
+	payload, err := json.Marshal(reviewActivity{
+		ID:     activity.ID.String(),
+		Type:   activityType,
+		Actor:  actorIRI,
+		Object: encoded,
+		To:     to,
+		Cc:     cc,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s activity: %v", activityType, err)
+	}
+	payload = withContext(payload)
+
+	for _, inbox := range inboxes {
+		if err = fc.deliverPayload(ctx, author.MemberName, inbox, activity, payload); err != nil {
+			return fmt.Errorf("failed to queue review %d for %s: %v", review.ID, inbox, err)
+		}
+	}
+	return nil
+}
+
+// ReviewToAS converts a local review of a media item of the given kind to its federated representation
+func (fc *FedController) ReviewToAS(review *models.Review, actorIRI, mediaKind string) *reviewObject {
+	stars := legacyScale.Denormalize(review.Stars)
+	rating := bookwyrmScale.Denormalize(review.Stars)
+	score := float64(review.Stars)
+	mediaIRI := fc.baseURL() + "/api/media/" + review.MediaID.String()
+	object := &reviewObject{
+		ID:           fc.reviewIRI(review.ID),
+		Type:         "Review",
+		AttributedTo: actorIRI,
+		Name:         review.Topic,
+		Content:      review.Body,
+		Published:    review.CreatedAt.UTC(),
+		Rating:       &rating,
+		Stars:        &stars,
+		Score:        &score,
+		Media:        mediaIRI,
+		MediaKind:    mediaKind,
+		To:           []string{publicCollection},
+		Cc:           []string{actorIRI + "/followers"},
+	}
+	if mediaKind == "book" {
+		object.Book = mediaIRI
+	}
+	return object
+}
+
+// followerInboxes returns the inboxes of the remote followers of a local member,
+// preferring shared inboxes so that each instance receives an activity once
+func (fc *FedController) followerInboxes(ctx context.Context, webfinger string) (inboxes []string, err error) {
+	err = fc.storage.SelectContext(ctx, &inboxes, `SELECT DISTINCT COALESCE(ra.shared_inbox, ra.inbox)
+		FROM public.followers f
+		JOIN federation.remote_actors ra ON ra.webfinger = f.follower
+		WHERE f.followee = $1`, webfinger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the followers of %s: %v", webfinger, err)
+	}
+	return inboxes, nil
+}
+
+func (fc *FedController) reviewIRI(id int64) string {
+	return fc.baseURL() + "/api/reviews/" + strconv.FormatInt(id, 10)
+}
+
+// receiveReview handles a Create or Update of a review written on another instance.
+// Only reviews of media known to this instance are stored.
+func (fc *FedController) receiveReview(c *fiber.Ctx) error {
+	actor := c.Locals("remoteActor").(*remoteActor)
+
+	var activity struct {
+		Object json.RawMessage `json:"object"`
+	}
+	if err := json.Unmarshal(c.Body(), &activity); err != nil {
+		return h.Res(c, fiber.StatusBadRequest, "Malformed activity")
+	}
+	var object reviewObject
+	// objects sent by reference can't be handled without fetching them
+	if err := json.Unmarshal(activity.Object, &object); err != nil {
+		return fc.Unknown(c)
+	}
+	if object.Type != "Review" && object.Type != "Rating" {
+		return fc.Unknown(c)
+	}
+	if object.ID == "" || object.AttributedTo != actor.IRI {
+		return h.Res(c, fiber.StatusBadRequest, "Review must be attributed to the sender")
+	}
+
+	// reviews without a rating, common on BookWyrm, have nothing to store
+	if object.Score == nil && object.Stars == nil && object.Rating == nil {
+		fc.log.Debug().Msgf("ignoring review %s without a rating", object.ID)
+		return h.Res(c, fiber.StatusAccepted, "Review without a rating ignored")
+	}
+
+	stars, ok := object.referenceStars()
+	if !ok {
+		return h.Res(c, fiber.StatusBadRequest, "Rating out of range")
+	}
+
+	mediaIRI := object.Media
+	if mediaIRI == "" {
+		mediaIRI = object.Book
+	}
+	mediaID, err := fc.localMediaID(mediaIRI)
+	if err != nil || !fc.mediaExists(c.Context(), mediaID) {
+		fc.log.Debug().Msgf("ignoring review %s of unknown media %s", object.ID, mediaIRI)
+		return h.Res(c, fiber.StatusAccepted, "Media not known to this instance")
+	}
+
+	if policy, _ := c.Locals("domainPolicy").(*models.DomainPolicy); policy != nil && policy.RejectMedia {
+		object.Content = stripMedia(object.Content)
+	}
+
+	published := object.Published
+	if published.IsZero() {
+		published = time.Now()
+	}
+	err = fc.ratings.SaveRemote(c.Context(), &models.Review{
+		CreatedAt:   published,
+		Stars:       stars,
+		Body:        object.Content,
+		Topic:       object.Name,
+		MediaID:     mediaID,
+		RemoteActor: sql.NullString{String: actor.IRI, Valid: true},
+		ActivityIRI: sql.NullString{String: object.ID, Valid: true},
+	})
+	if err != nil {
+		fc.log.Error().Err(err).Msgf("failed to save review %s from %s", object.ID, actor.Webfinger)
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to save review")
+	}
+	return h.Res(c, fiber.StatusAccepted, "Review received")
+}
+
+// referenceStars converts the most precise of the scores sent to the reference scale.
+// Scores outside of their scales are skipped. It returns false if none of them is valid
+func (o *reviewObject) referenceStars() (int16, bool) {
+	within := func(score *float64, scale models.RatingScale) bool {
+		return score != nil && *score >= float64(scale.Lower) && *score <= float64(scale.Upper)
+	}
+	switch {
+	case o.Score != nil && *o.Score >= 0 && *o.Score <= models.ReferenceScale:
+		return int16(math.Round(*o.Score)), true
+	case within(o.Stars, legacyScale):
+		return int16(math.Round(*o.Stars * models.ReferenceScale / float64(legacyScale.Upper))), true
+	case within(o.Rating, bookwyrmScale):
+		return int16(math.Round(*o.Rating * models.ReferenceScale / float64(bookwyrmScale.Upper))), true
+	}
+	return 0, false
+}
+
+// deleteReview handles a Delete of a review written on another instance
+func (fc *FedController) deleteReview(c *fiber.Ctx) error {
+	activity := c.Locals("activity").(*activitypub.Activity)
+	actor := c.Locals("remoteActor").(*remoteActor)
+	if activity.Object == nil {
+		return h.Res(c, fiber.StatusBadRequest, "Missing delete object")
+	}
+	if err := fc.ratings.DeleteRemote(c.Context(), activity.Object.GetLink().String(), actor.IRI); err != nil {
+		fc.log.Error().Err(err).Msgf("failed to delete review %s", activity.Object.GetLink())
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to delete review")
+	}
+	return h.Res(c, fiber.StatusAccepted, "Delete received")
+}
+
+// localMediaID extracts the ID of a media item from its canonical IRI
+func (fc *FedController) localMediaID(iri string) (uuid.UUID, error) {
+	u, err := url.Parse(iri)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid media IRI %s: %v", iri, err)
+	}
+	id, found := strings.CutPrefix(u.Path, "/api/media/")
+	if u.Hostname() != fc.conf.Fiber.Domain || !found {
+		return uuid.Nil, fmt.Errorf("%s is not a media item of this instance", iri)
+	}
+	return uuid.FromString(id)
+}
+
+func (fc *FedController) mediaExists(ctx context.Context, id uuid.UUID) bool {
+	var exists bool
+	err := fc.storage.GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM media.media WHERE id = $1)`, id)
+	return err == nil && exists
+}
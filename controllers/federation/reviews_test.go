@@ -0,0 +1,91 @@
+package federation
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/cfg"
+	"codeberg.org/mjh/LibRate/models"
+)
+
+func TestReviewToAS(t *testing.T) {
+	conf := cfg.TestConfig
+	conf.Fiber.Domain = "librate.club"
+	fc := &FedController{conf: &conf}
+
+	mediaID := uuid.Must(uuid.NewV4())
+	review := &models.Review{
+		ID:        42,
+		CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Stars:     700,
+		Body:      "Surprisingly good",
+		Topic:     "Serial Experiments Lain",
+		MediaID:   mediaID,
+	}
+	object := fc.ReviewToAS(review, fc.actorIRI("lain"), "anime")
+
+	doc, err := json.Marshal(object)
+	require.NoError(t, err)
+
+	var decoded reviewObject
+	require.NoError(t, json.Unmarshal(doc, &decoded))
+	assert.Equal(t, "Review", decoded.Type)
+	assert.Equal(t, fc.baseURL()+"/api/reviews/42", decoded.ID)
+	assert.Equal(t, fc.baseURL()+"/api/members/lain", decoded.AttributedTo)
+	require.NotNil(t, decoded.Rating)
+	assert.Equal(t, 3.5, *decoded.Rating)
+	require.NotNil(t, decoded.Stars)
+	assert.Equal(t, 7.0, *decoded.Stars)
+	require.NotNil(t, decoded.Score)
+	assert.Equal(t, 700.0, *decoded.Score)
+	assert.Equal(t, fc.baseURL()+"/api/media/"+mediaID.String(), decoded.Media)
+	assert.Equal(t, "anime", decoded.MediaKind)
+	assert.Empty(t, decoded.Book, "only books should be sent as BookWyrm books")
+
+	book := fc.ReviewToAS(review, fc.actorIRI("lain"), "book")
+	assert.Equal(t, book.Media, book.Book)
+}
+
+func TestReviewObjectStars(t *testing.T) {
+	testCases := []struct {
+		name   string
+		object string
+		stars  int16
+		valid  bool
+	}{
+		{"score", `{"score": 655, "stars": 7, "rating": 3.5}`, 655, true},
+		{"stars", `{"stars": 7, "rating": 3}`, 700, true},
+		{"half stars", `{"stars": 7.5}`, 750, true},
+		{"rating", `{"rating": 4.5}`, 900, true},
+		{"score out of range", `{"score": 5000, "stars": 8}`, 800, true},
+		{"stars out of range", `{"stars": 300, "rating": 2.5}`, 500, true},
+		{"negative stars", `{"stars": -1}`, 0, false},
+		{"rating out of range", `{"rating": 10}`, 0, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var object reviewObject
+			require.NoError(t, json.Unmarshal([]byte(tc.object), &object), "a malformed score shouldn't fail the object")
+			stars, valid := object.referenceStars()
+			assert.Equal(t, tc.valid, valid)
+			assert.Equal(t, tc.stars, stars)
+		})
+	}
+}
+
+func TestReviewObjectWithoutRating(t *testing.T) {
+	// BookWyrm sends reviews with no rating property when the reader didn't rate the book
+	doc := `{"id": "https://bookwyrm.social/user/ann/review/1", "type": "Review",
+		"attributedTo": "https://bookwyrm.social/user/ann", "content": "A slow start"}`
+
+	var object reviewObject
+	require.NoError(t, json.Unmarshal([]byte(doc), &object))
+	assert.Nil(t, object.Rating)
+	assert.Nil(t, object.Stars)
+	assert.Nil(t, object.Score)
+}
@@ -0,0 +1,155 @@
+package federation
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// maxClockSkew is the maximum allowed difference between the Date header of a signed
+// request and the local time
+const maxClockSkew = 12 * time.Hour
+
+// signedHeaders are the headers covered by the signatures we create.
+// (request-target) is a pseudo-header consisting of the method and path
+var signedHeaders = []string{"(request-target)", "host", "date", "digest"}
+
+// requiredHeaders must be covered by the signatures of incoming requests, so that they
+// can't be replayed against another path or host, nor long after they were made
+var requiredHeaders = []string{"(request-target)", "host", "date"}
+
+// signatureParams holds the parsed contents of the Signature header, as defined in
+// draft-cavage-http-signatures
+type signatureParams struct {
+	KeyID     string
+	Algorithm string
+	Headers   []string
+	Signature []byte
+}
+
+// digest computes the value of the Digest header for a request body
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// SignRequest adds the Date, Digest and Signature headers to an outgoing request
+func SignRequest(req *http.Request, keyID string, key *rsa.PrivateKey, body []byte) error {
+	if req.Header.Get("Date") == "" {
+		req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("Digest", digest(body))
+
+	signingString := buildSigningString(signedHeaders, req.Method, req.URL.RequestURI(), req.Header.Get)
+	hashed := sha256.Sum256([]byte(signingString))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	req.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(signedHeaders, " "), base64.StdEncoding.EncodeToString(sig)))
+	return nil
+}
+
+// parseSignatureHeader parses the comma separated key="value" pairs of the Signature header
+func parseSignatureHeader(header string) (*signatureParams, error) {
+	if header == "" {
+		return nil, fmt.Errorf("missing signature header")
+	}
+	params := &signatureParams{
+		// default as per the spec
+		Headers: []string{"date"},
+	}
+	for _, part := range strings.Split(header, ",") {
+		k, v, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return nil, fmt.Errorf("malformed signature parameter %q", part)
+		}
+		v = strings.Trim(v, `"`)
+		switch k {
+		case "keyId":
+			params.KeyID = v
+		case "algorithm":
+			params.Algorithm = v
+		case "headers":
+			params.Headers = strings.Fields(strings.ToLower(v))
+		case "signature":
+			sig, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode signature: %w", err)
+			}
+			params.Signature = sig
+		}
+	}
+	if params.KeyID == "" || len(params.Signature) == 0 {
+		return nil, fmt.Errorf("signature header is missing keyId or signature")
+	}
+	// hs2019 doesn't specify the algorithm, but in practice it's always rsa-sha256 in the fediverse
+	if params.Algorithm != "" && params.Algorithm != "rsa-sha256" && params.Algorithm != "hs2019" {
+		return nil, fmt.Errorf("unsupported signature algorithm %s", params.Algorithm)
+	}
+	return params, nil
+}
+
+// verifySignature checks the signature of an incoming request against the public key
+// of the sender. getHeader must return the value of the request header with the given name.
+// The requiredHeaders must be signed, and if the body is non-empty, so must be the digest
+// header, which has to match it.
+func verifySignature(
+	params *signatureParams,
+	method, requestURI string,
+	getHeader func(string) string,
+	body []byte,
+	key *rsa.PublicKey,
+) error {
+	for _, h := range requiredHeaders {
+		if !lo.Contains(params.Headers, h) {
+			return fmt.Errorf("%s header must be signed", h)
+		}
+	}
+	date, err := http.ParseTime(getHeader("Date"))
+	if err != nil {
+		return fmt.Errorf("invalid date header: %w", err)
+	}
+	if skew := time.Since(date); skew > maxClockSkew || skew < -maxClockSkew {
+		return fmt.Errorf("date header is outside the allowed clock skew")
+	}
+
+	if len(body) > 0 {
+		if !lo.Contains(params.Headers, "digest") {
+			return fmt.Errorf("digest header must be signed")
+		}
+		if getHeader("Digest") != digest(body) {
+			return fmt.Errorf("digest mismatch")
+		}
+	}
+
+	signingString := buildSigningString(params.Headers, method, requestURI, getHeader)
+	hashed := sha256.Sum256([]byte(signingString))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], params.Signature); err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+	return nil
+}
+
+func buildSigningString(headers []string, method, requestURI string, getHeader func(string) string) string {
+	lines := make([]string, 0, len(headers))
+	for _, h := range headers {
+		if h == "(request-target)" {
+			lines = append(lines, fmt.Sprintf("(request-target): %s %s", strings.ToLower(method), requestURI))
+			continue
+		}
+		lines = append(lines, h+": "+strings.TrimSpace(getHeader(h)))
+	}
+	return strings.Join(lines, "\n")
+}
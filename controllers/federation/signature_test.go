@@ -0,0 +1,104 @@
+package federation
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/internal/crypt"
+)
+
+func TestSignatureRoundtrip(t *testing.T) {
+	pubPem, privPem, err := crypt.GenerateRSAKeyPair()
+	require.NoError(t, err)
+	priv, err := crypt.ParseRSAPrivateKey(privPem)
+	require.NoError(t, err)
+	pub, err := crypt.ParseRSAPublicKey(pubPem)
+	require.NoError(t, err)
+
+	body := []byte(`{"type":"Follow"}`)
+	keyID := "https://remote.example/api/members/lain#main-key"
+
+	newSignedRequest := func(t *testing.T) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "https://lr.localhost/api/inbox?x=1", bytes.NewReader(body))
+		require.NoError(t, SignRequest(req, keyID, priv, body))
+		return req
+	}
+
+	t.Run("valid signature", func(t *testing.T) {
+		req := newSignedRequest(t)
+		params, err := parseSignatureHeader(req.Header.Get("Signature"))
+		require.NoError(t, err)
+		assert.Equal(t, keyID, params.KeyID)
+		assert.Equal(t, signedHeaders, params.Headers)
+		assert.NoError(t, verifySignature(params, req.Method, req.URL.RequestURI(), req.Header.Get, body, pub))
+	})
+
+	t.Run("tampered body", func(t *testing.T) {
+		req := newSignedRequest(t)
+		params, err := parseSignatureHeader(req.Header.Get("Signature"))
+		require.NoError(t, err)
+		err = verifySignature(params, req.Method, req.URL.RequestURI(), req.Header.Get, []byte(`{"type":"Block"}`), pub)
+		assert.ErrorContains(t, err, "digest mismatch")
+	})
+
+	t.Run("wrong target", func(t *testing.T) {
+		req := newSignedRequest(t)
+		params, err := parseSignatureHeader(req.Header.Get("Signature"))
+		require.NoError(t, err)
+		err = verifySignature(params, req.Method, "/api/members/lain/inbox", req.Header.Get, body, pub)
+		assert.ErrorContains(t, err, "signature verification failed")
+	})
+
+	t.Run("another host", func(t *testing.T) {
+		req := newSignedRequest(t)
+		params, err := parseSignatureHeader(req.Header.Get("Signature"))
+		require.NoError(t, err)
+		getHeader := func(name string) string {
+			if name == "host" {
+				return "other.example"
+			}
+			return req.Header.Get(name)
+		}
+		err = verifySignature(params, req.Method, req.URL.RequestURI(), getHeader, body, pub)
+		assert.ErrorContains(t, err, "signature verification failed")
+	})
+
+	t.Run("unsigned target and host", func(t *testing.T) {
+		req := newSignedRequest(t)
+		for _, headers := range [][]string{{"host", "date", "digest"}, {"(request-target)", "date", "digest"}} {
+			params, err := parseSignatureHeader(req.Header.Get("Signature"))
+			require.NoError(t, err)
+			params.Headers = headers
+			err = verifySignature(params, req.Method, req.URL.RequestURI(), req.Header.Get, body, pub)
+			assert.ErrorContains(t, err, "must be signed", "a signature over %v could be replayed", headers)
+		}
+	})
+
+	t.Run("stale date", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "https://lr.localhost/api/inbox", bytes.NewReader(body))
+		req.Header.Set("Date", time.Now().Add(-24*time.Hour).UTC().Format(http.TimeFormat))
+		require.NoError(t, SignRequest(req, keyID, priv, body))
+		params, err := parseSignatureHeader(req.Header.Get("Signature"))
+		require.NoError(t, err)
+		err = verifySignature(params, req.Method, req.URL.RequestURI(), req.Header.Get, body, pub)
+		assert.ErrorContains(t, err, "clock skew")
+	})
+}
+
+func TestParseSignatureHeader(t *testing.T) {
+	_, err := parseSignatureHeader("")
+	assert.Error(t, err)
+
+	_, err = parseSignatureHeader(`keyId="a",algorithm="ecdsa-sha256",signature="YQ=="`)
+	assert.ErrorContains(t, err, "unsupported")
+
+	params, err := parseSignatureHeader(`keyId="a#main-key",algorithm="hs2019",signature="YQ=="`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"date"}, params.Headers)
+}
@@ -1,63 +1,126 @@
 package form
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid/v5"
+	"github.com/golang-jwt/jwt/v5"
+
 	h "codeberg.org/mjh/LibRate/internal/handlers"
 	"codeberg.org/mjh/LibRate/models/media"
-	"github.com/gofiber/fiber/v2"
 )
 
+// AddMedia adds the submitted media to the moderation queue
+// @Summary Submit media
+// @Description Adds the media to the moderation queue. Albums are submitted with their tracks and
+// @Description TV shows with their seasons and episodes, which are moderated together with them.
+// @Description Tracks, seasons and episodes can also be added to the existing albums and shows
+// @Tags media,moderation
+// @Accept json
+// @Produce json
+// @Param type path string true "Media type" Enums(film, book, album, track, tv_show, season, episode, game, anime, manga, comic)
+// @Param X-CSRF-Token header string true "X-CSRF-Token header"
+// @Success 200 {object} h.ResponseHTTP{}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Failure 501 {object} h.ResponseHTTP{}
+// @Router /form/add_media/{type} [post]
 func (fc *Controller) AddMedia(c *fiber.Ctx) error {
-	mediaType := c.Params("type")
-	switch mediaType {
+	var err error
+	switch c.Params("type") {
 	case "film":
-		err := fc.addFilm(c)
-		if err != nil {
-			return err
-		}
+		err = fc.addFilm(c)
 	case "book":
-		err := fc.addBook(c)
-		if err != nil {
-			return err
-		}
+		err = fc.addBook(c)
+	case "album":
+		err = fc.addAlbum(c)
+	case "track":
+		err = fc.addTrack(c)
+	case "tv_show":
+		err = fc.addTVShow(c)
+	case "season":
+		err = fc.addSeason(c)
+	case "episode":
+		err = fc.addEpisode(c)
+	case "game":
+		err = fc.addGame(c)
+	case "anime":
+		err = fc.addAnime(c)
+	case "manga", "comic":
+		err = fc.addComic(c, c.Params("type"))
 	default:
 		return h.Res(c, fiber.StatusNotImplemented,
 			"Sorry, adding this media type via Web UI is not supported yet")
 	}
+	if err != nil {
+		return formError(c, err)
+	}
 
 	return h.Res(c, fiber.StatusOK,
 		`Media added successfully. Thank you for your contribution and please wait for an approval!
 		<a href="/form/add_media">Add another media</a>`)
 }
 
+// UpdateMedia edits the submitted media and records the edit in its history
+// @Summary Update media
+// @Description Changes the fields present in the request body. If the moderators asked for changes,
+// @Description the media goes back to the moderation queue
+// @Tags media,moderation
+// @Accept json
+// @Produce json
+// @Param type path string true "Media type" Enums(film, book)
+// @Param summary query string false "Edit summary"
+// @Param X-CSRF-Token header string true "X-CSRF-Token header"
+// @Success 200 {object} h.ResponseHTTP{}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Failure 501 {object} h.ResponseHTTP{}
+// @Router /form/update_media/{type} [post]
 func (fc *Controller) UpdateMedia(c *fiber.Ctx) error {
-	mediaType := c.Params("type")
-	switch mediaType {
+	var err error
+	switch c.Params("type") {
 	case "film":
-		err := fc.updateFilm(c)
-		if err != nil {
-			return err
-		}
+		err = fc.updateFilm(c)
+	case "book":
+		err = fc.updateBook(c)
 	default:
 		return h.Res(c, fiber.StatusNotImplemented,
 			"Sorry, updating this media type via Web UI is not supported yet")
 	}
+	if err != nil {
+		return formError(c, err)
+	}
 
 	return h.Res(c, fiber.StatusOK,
 		`Media updated successfully. Thank you for your contribution and please wait for an approval!
 		<a href="/form/update_media">Update another media</a>`)
 }
 
+// formError responds with the status of the error returned by one of the form flows
+func formError(c *fiber.Ctx, err error) error {
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return h.Res(c, fe.Code, fe.Message)
+	}
+	return h.Res(c, fiber.StatusInternalServerError, "Internal error")
+}
+
 func (fc *Controller) addFilm(c *fiber.Ctx) (err error) {
 	var film *media.Film
 	if err = c.BodyParser(&film); err != nil {
 		fc.log.Error().Err(err).Msgf("Failed to parse JSON: %s", err.Error())
-		return h.Res(c, fiber.StatusBadRequest, "Cannot parse JSON")
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
 	}
 
-	err = fc.storage.AddFilm(c.UserContext(), film)
+	err = fc.storage.AddFilm(c.UserContext(), film, memberName(c))
 	if err != nil {
 		fc.log.Error().Err(err).Msgf("Failed to add film: %s", err.Error())
-		return h.Res(c, fiber.StatusInternalServerError, "Failed to add film")
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to add film")
 	}
 
 	return nil
@@ -67,13 +130,13 @@ func (fc *Controller) addBook(c *fiber.Ctx) (err error) {
 	var book *media.Book
 	if err = c.BodyParser(&book); err != nil {
 		fc.log.Error().Err(err).Msgf("Failed to parse JSON: %s", err.Error())
-		return h.Res(c, fiber.StatusBadRequest, "Cannot parse JSON")
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
 	}
 
-	err = fc.storage.AddBook(c.UserContext(), book, &book.Publisher)
+	err = fc.storage.AddBook(c.UserContext(), book, &book.Publisher, memberName(c))
 	if err != nil {
 		fc.log.Error().Err(err).Msgf("Failed to add book: %s", err.Error())
-		return h.Res(c, fiber.StatusInternalServerError, "Failed to add book")
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to add book")
 	}
 
 	return nil
@@ -83,14 +146,79 @@ func (fc *Controller) updateFilm(c *fiber.Ctx) (err error) {
 	var film *media.Film
 	if err = c.BodyParser(&film); err != nil {
 		fc.log.Error().Err(err).Msgf("Failed to parse JSON: %s", err.Error())
-		return h.Res(c, fiber.StatusBadRequest, "Cannot parse JSON")
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
 	}
+	return fc.update(c, media.RevisionFilm, film.MediaID)
+}
 
-	err = fc.storage.UpdateFilm(c.UserContext(), film)
-	if err != nil {
-		fc.log.Error().Err(err).Msgf("Failed to update film: %s", err.Error())
-		return h.Res(c, fiber.StatusInternalServerError, "Failed to update film")
+func (fc *Controller) updateBook(c *fiber.Ctx) (err error) {
+	var book *media.Book
+	if err = c.BodyParser(&book); err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to parse JSON: %s", err.Error())
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+	}
+	return fc.update(c, media.RevisionBook, book.MediaID)
+}
+
+// update records the request body as a revision of the media. The media goes back to the queue
+// if the moderators asked the member for changes
+func (fc *Controller) update(c *fiber.Ctx, target string, mediaID *uuid.UUID) error {
+	if mediaID == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Missing media ID")
+	}
+
+	_, err := fc.storage.Revise(c.UserContext(), target, mediaID.String(), c.Body(),
+		memberWebfinger(c), c.Query("summary"))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("No such %s", target))
+	case err != nil && !errors.Is(err, media.ErrNoChanges):
+		fc.log.Error().Err(err).Msgf("Failed to update %s: %s", target, err.Error())
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update "+target)
+	}
+	if err = fc.storage.Resubmit(c.UserContext(), *mediaID, memberName(c)); err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to resubmit %s: %s", target, err.Error())
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update "+target)
 	}
 
 	return nil
 }
+
+// assignNumbers numbers the items listed without a number in the order they were listed in
+// and makes sure no number is used twice
+func assignNumbers[N ~int16 | ~uint8 | ~uint16](numbers []*N, what string) error {
+	seen := make(map[N]bool, len(numbers))
+	for i, n := range numbers {
+		if *n == 0 {
+			*n = N(i + 1)
+		}
+		if *n < 0 {
+			return fmt.Errorf("invalid %s number %d", what, *n)
+		}
+		if seen[*n] {
+			return fmt.Errorf("%s number %d is used more than once", what, *n)
+		}
+		seen[*n] = true
+	}
+	return nil
+}
+
+// memberName returns the nick of the member who sent the request
+func memberName(c *fiber.Ctx) string {
+	token, ok := c.Locals("jwtToken").(*jwt.Token)
+	if !ok {
+		return ""
+	}
+	name, _ := token.Claims.(jwt.MapClaims)["member_name"].(string)
+	return name
+}
+
+// memberWebfinger returns the webfinger of the member who sent the request
+func memberWebfinger(c *fiber.Ctx) string {
+	token, ok := c.Locals("jwtToken").(*jwt.Token)
+	if !ok {
+		return ""
+	}
+	wf, _ := token.Claims.(jwt.MapClaims)["webfinger"].(string)
+	return wf
+}
@@ -0,0 +1,205 @@
+package form
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+func TestCheckAlbum(t *testing.T) {
+	minutes := func(m, s int) time.Time {
+		return time.Time{}.Add(time.Duration(m)*time.Minute + time.Duration(s)*time.Second)
+	}
+	album := media.Album{
+		Name: " Mezzanine ",
+		Tracks: []media.Track{
+			{Name: "Angel", Duration: minutes(6, 18)},
+			{Name: "Risingson", Duration: minutes(4, 58)},
+			{Name: "Teardrop", Duration: minutes(5, 29)},
+		},
+	}
+	require.NoError(t, checkAlbum(&album))
+	assert.Equal(t, "Mezzanine", album.Name)
+	for i := range album.Tracks {
+		assert.Equal(t, int16(i+1), album.Tracks[i].Number, "the tracks should be numbered in the listed order")
+	}
+	require.True(t, album.Duration.Valid)
+	assert.Equal(t, 16*time.Minute+45*time.Second, clockDuration(album.Duration.Time))
+
+	album.Duration.Valid = false
+	album.Tracks[2].Duration = time.Time{}
+	require.NoError(t, checkAlbum(&album))
+	assert.False(t, album.Duration.Valid, "the duration shouldn't be guessed if a track's is missing")
+
+	album.Tracks[2].Number = 1
+	assert.ErrorContains(t, checkAlbum(&album), "track number 1 is used more than once")
+	album.Tracks[2].Number = -3
+	assert.Error(t, checkAlbum(&album))
+	album.Tracks[2] = media.Track{Name: " ", Number: 3}
+	assert.Error(t, checkAlbum(&album))
+	assert.Error(t, checkAlbum(&media.Album{Name: "  "}))
+}
+
+func TestCheckTVShow(t *testing.T) {
+	show := media.TVShow{
+		Title: "Serial Experiments Lain",
+		Seasons: []media.Season{{
+			Episodes: []media.Episode{{Title: "Weird"}, {Title: "Girls"}, {Title: "Psyche", Episode: 4}},
+		}},
+	}
+	require.NoError(t, checkTVShow(&show))
+	assert.Equal(t, uint8(1), show.Seasons[0].Number)
+	assert.Equal(t, uint16(2), show.Seasons[0].Episodes[1].Episode)
+	assert.Equal(t, uint16(4), show.Seasons[0].Episodes[2].Episode)
+
+	show.Seasons = append(show.Seasons, media.Season{Number: 1})
+	assert.ErrorContains(t, checkTVShow(&show), "season number 1 is used more than once")
+	show.Seasons[1] = media.Season{Number: 2, Episodes: []media.Episode{{Title: ""}}}
+	assert.Error(t, checkTVShow(&show))
+}
+
+func TestCheckGame(t *testing.T) {
+	released := time.Date(2000, time.June, 23, 0, 0, 0, 0, time.UTC)
+	game := media.Game{
+		Title:      " Deus Ex ",
+		Platforms:  []media.Platform{{Name: " PC "}},
+		Developers: []media.Studio{{Name: "Ion Storm"}},
+		Releases: []media.GameRelease{
+			{Date: released},
+			{Region: "jp", Platform: "PlayStation 2", Date: released.AddDate(3, 0, 0)},
+		},
+	}
+	require.NoError(t, checkGame(&game))
+	assert.Equal(t, "Deus Ex", game.Title)
+	assert.Equal(t, "PC", game.Platforms[0].Name)
+	assert.Equal(t, media.RegionWorldwide, game.Releases[0].Region)
+	assert.Equal(t, "JP", game.Releases[1].Region)
+
+	game.Releases[1].Region = "JPN"
+	assert.ErrorContains(t, checkGame(&game), `invalid region "JPN"`)
+	game.Releases[1] = media.GameRelease{Region: "EU"}
+	assert.ErrorContains(t, checkGame(&game), "the release date in region EU is required")
+	game.Releases = nil
+	game.Publishers = []media.Studio{{Name: " "}}
+	assert.Error(t, checkGame(&game))
+	assert.Error(t, checkGame(&media.Game{Title: "Deus Ex", Franchises: []media.Franchise{{}}}))
+	assert.Error(t, checkGame(&media.Game{}))
+}
+
+func TestCheckAnime(t *testing.T) {
+	spring, year := "spring", int16(1998)
+	anime := media.Anime{
+		Title:   " Cowboy Bebop ",
+		Studios: []media.Studio{{Name: " Sunrise "}},
+		Seasons: []media.AnimeSeason{{
+			Year:     &year,
+			Quarter:  &spring,
+			Episodes: []media.AnimeEpisode{{Title: "Asteroid Blues"}, {Title: "Stray Dog Strut"}},
+		}},
+	}
+	require.NoError(t, checkAnime(&anime))
+	assert.Equal(t, "Cowboy Bebop", anime.Title)
+	assert.Equal(t, media.AnimeTV, anime.Format)
+	assert.Equal(t, "Sunrise", anime.Studios[0].Name)
+	assert.Equal(t, uint8(1), anime.Seasons[0].Number)
+	assert.Equal(t, uint16(2), anime.Seasons[0].Episodes[1].Number)
+	require.NotNil(t, anime.EpisodeCount)
+	assert.Equal(t, int16(2), *anime.EpisodeCount, "the listed episodes should be counted")
+
+	announced := int16(26)
+	anime.EpisodeCount = &announced
+	require.NoError(t, checkAnime(&anime))
+	assert.Equal(t, int16(26), *anime.EpisodeCount, "the announced count should be kept")
+
+	anime.Seasons[0].Year = nil
+	assert.ErrorContains(t, checkAnime(&anime), "the year of the spring broadcast season is required")
+	autumn := "autumn"
+	anime.Seasons[0].Quarter = &autumn
+	assert.ErrorContains(t, checkAnime(&anime), `invalid broadcast season "autumn"`)
+	anime.Seasons[0].Quarter = nil
+	anime.Seasons[0].Episodes[1].Number = 1
+	assert.ErrorContains(t, checkAnime(&anime), "episode number 1 is used more than once")
+	assert.ErrorContains(t, checkAnime(&media.Anime{Title: "Akira", Format: "film"}), `invalid format "film"`)
+	assert.Error(t, checkAnime(&media.Anime{Title: "Bebop", Studios: []media.Studio{{}}}))
+	assert.Error(t, checkAnime(&media.Anime{}))
+}
+
+func TestCheckComic(t *testing.T) {
+	started := time.Date(1982, time.December, 6, 0, 0, 0, 0, time.UTC)
+	ended := time.Date(1990, time.June, 25, 0, 0, 0, 0, time.UTC)
+	comic := media.Comic{
+		Kind:           "manga",
+		Title:          " Akira ",
+		Authors:        []media.Person{{Name: " Katsuhiro Otomo "}},
+		Artists:        []media.Person{{Name: "Katsuhiro Otomo"}},
+		Serializations: []media.Serialization{{Magazine: " Weekly Young Magazine ", Started: &started, Ended: &ended}},
+		Volumes: []media.ComicVolume{
+			{Chapters: []media.ComicChapter{{}, {}}},
+			{Chapters: []media.ComicChapter{{}}},
+		},
+		Chapters: []media.ComicChapter{{Title: "not collected yet"}},
+	}
+	require.NoError(t, checkComic(&comic))
+	assert.Equal(t, "Akira", comic.Title)
+	assert.Equal(t, media.ComicOngoing, comic.Status)
+	assert.Equal(t, "Katsuhiro Otomo", comic.Authors[0].Name)
+	assert.Equal(t, "Weekly Young Magazine", comic.Serializations[0].Magazine)
+	assert.Equal(t, uint16(2), comic.Volumes[1].Number)
+	assert.Equal(t, uint16(3), comic.Volumes[1].Chapters[0].Number, "the chapters should be numbered across the volumes")
+	assert.Equal(t, uint16(4), comic.Chapters[0].Number)
+
+	comic.Chapters[0].Number = 2
+	assert.ErrorContains(t, checkComic(&comic), "chapter number 2 is used more than once")
+	comic.Chapters = nil
+	comic.Serializations[0].Started, comic.Serializations[0].Ended = &ended, &started
+	assert.ErrorContains(t, checkComic(&comic), "the serialization in Weekly Young Magazine ended before it started")
+	comic.Serializations = nil
+	comic.Status = "finished"
+	assert.ErrorContains(t, checkComic(&comic), `invalid status "finished"`)
+	assert.Error(t, checkComic(&media.Comic{Kind: "comic", Title: "Watchmen", Artists: []media.Person{{Name: " "}}}))
+	assert.ErrorContains(t, checkComic(&media.Comic{Kind: "comic"}), "the title of the comic is required")
+}
+
+func TestAddMediaValidation(t *testing.T) {
+	log := zerolog.Nop()
+	fc := &Controller{log: &log}
+	app := fiber.New()
+	app.Post("/add_media/:type", fc.AddMedia)
+	app.Post("/update_media/:type", fc.UpdateMedia)
+
+	albumID := uuid.Must(uuid.NewV4()).String()
+	for _, tc := range []struct {
+		path, body string
+		status     int
+	}{
+		{"/add_media/album", `{"name":"Mezzanine","tracks":[{"name":"Angel"},{"name":""}]}`, fiber.StatusBadRequest},
+		{"/add_media/album", `{"name":`, fiber.StatusBadRequest},
+		{"/add_media/track", `{"name":"Angel","track_number":1}`, fiber.StatusBadRequest},
+		{"/add_media/track", `{"name":"Angel","album_id":"` + albumID + `"}`, fiber.StatusBadRequest},
+		{"/add_media/tv_show", `{"title":"Lain","seasons":[{"number":1},{"number":1}]}`, fiber.StatusBadRequest},
+		{"/add_media/season", `{"number":1}`, fiber.StatusBadRequest},
+		{"/add_media/episode", `{"show_id":"` + albumID + `","season":1,"title":"Weird"}`, fiber.StatusBadRequest},
+		{"/add_media/game", `{"title":"Deus Ex","releases":[{"region":"1","date":"2000-06-23T00:00:00Z"}]}`, fiber.StatusBadRequest},
+		{"/add_media/anime", `{"title":"Cowboy Bebop","format":"series"}`, fiber.StatusBadRequest},
+		{"/add_media/manga", `{"title":"Akira","volumes":[{"number":1},{"number":1}]}`, fiber.StatusBadRequest},
+		{"/add_media/comic", `{"title":"Watchmen","status":"finished"}`, fiber.StatusBadRequest},
+		{"/add_media/podcast", `{}`, fiber.StatusNotImplemented},
+		{"/update_media/book", `{"title":"Neuromancer"}`, fiber.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(fiber.MethodPost, tc.path, strings.NewReader(tc.body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		res, err := app.Test(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, tc.status, res.StatusCode, "%s %s", tc.path, tc.body)
+	}
+}
@@ -0,0 +1,87 @@
+package form
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+func (fc *Controller) addAnime(c *fiber.Ctx) (err error) {
+	var anime media.Anime
+	if err = c.BodyParser(&anime); err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to parse JSON: %s", err.Error())
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+	}
+	if err = checkAnime(&anime); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err = fc.storage.AddAnime(c.UserContext(), &anime, memberName(c)); err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to add anime: %s", err.Error())
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to add anime")
+	}
+
+	return nil
+}
+
+// checkAnime validates the submitted anime and numbers its seasons and episodes. Anime without
+// a format are TV series, and the episode count defaults to the number of the listed episodes
+func checkAnime(anime *media.Anime) error {
+	anime.Title = strings.TrimSpace(anime.Title)
+	if anime.Title == "" {
+		return errors.New("the title of the anime is required")
+	}
+	if anime.Format == "" {
+		anime.Format = media.AnimeTV
+	}
+	if !media.ValidAnimeFormat(anime.Format) {
+		return fmt.Errorf("invalid format %q", anime.Format)
+	}
+	for i := range anime.Studios {
+		anime.Studios[i].Name = strings.TrimSpace(anime.Studios[i].Name)
+		if anime.Studios[i].ID == 0 && anime.Studios[i].Name == "" {
+			return errors.New("every studio needs a name")
+		}
+	}
+
+	var listed int16
+	numbers := make([]*uint8, len(anime.Seasons))
+	for i := range anime.Seasons {
+		s := &anime.Seasons[i]
+		numbers[i] = &s.Number
+		s.Title = strings.TrimSpace(s.Title)
+		if s.Quarter != nil && !media.ValidQuarter(*s.Quarter) {
+			return fmt.Errorf("invalid broadcast season %q", *s.Quarter)
+		}
+		if s.Quarter != nil && s.Year == nil {
+			return fmt.Errorf("the year of the %s broadcast season is required", *s.Quarter)
+		}
+		episodes := make([]*uint16, len(s.Episodes))
+		for j := range s.Episodes {
+			s.Episodes[j].Title = strings.TrimSpace(s.Episodes[j].Title)
+			if s.Episodes[j].Title == "" {
+				return errors.New("every episode needs a title")
+			}
+			episodes[j] = &s.Episodes[j].Number
+		}
+		if err := assignNumbers(episodes, "episode"); err != nil {
+			return err
+		}
+		listed += int16(len(s.Episodes))
+	}
+	if err := assignNumbers(numbers, "season"); err != nil {
+		return err
+	}
+
+	switch {
+	case anime.EpisodeCount != nil && *anime.EpisodeCount <= 0:
+		return fmt.Errorf("invalid episode count %d", *anime.EpisodeCount)
+	case anime.EpisodeCount == nil && listed > 0:
+		anime.EpisodeCount = &listed
+	}
+	return nil
+}
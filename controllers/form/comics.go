@@ -0,0 +1,88 @@
+package form
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+// addComic adds a manga or a comic, depending on the kind
+func (fc *Controller) addComic(c *fiber.Ctx, kind string) (err error) {
+	var comic media.Comic
+	if err = c.BodyParser(&comic); err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to parse JSON: %s", err.Error())
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+	}
+	comic.Kind = kind
+	if err = checkComic(&comic); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err = fc.storage.AddComic(c.UserContext(), &comic, memberName(c)); err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to add %s: %s", kind, err.Error())
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to add "+kind)
+	}
+
+	return nil
+}
+
+// checkComic validates the submitted manga or comic and numbers its volumes and chapters. The
+// chapters are numbered across the volumes, with the ones not collected yet coming last
+func checkComic(comic *media.Comic) error {
+	comic.Title = strings.TrimSpace(comic.Title)
+	if comic.Title == "" {
+		return fmt.Errorf("the title of the %s is required", comic.Kind)
+	}
+	if comic.Status == "" {
+		comic.Status = media.ComicOngoing
+	}
+	if !media.ValidComicStatus(comic.Status) {
+		return fmt.Errorf("invalid status %q", comic.Status)
+	}
+	for _, people := range [][]media.Person{comic.Authors, comic.Artists} {
+		for i := range people {
+			people[i].Name = strings.TrimSpace(people[i].Name)
+			if people[i].ID.IsNil() && people[i].Name == "" {
+				return errors.New("every author and artist needs a name")
+			}
+		}
+	}
+	if comic.Publisher != nil {
+		comic.Publisher.Name = strings.TrimSpace(comic.Publisher.Name)
+		if comic.Publisher.ID == 0 && comic.Publisher.Name == "" {
+			return errors.New("the publisher needs a name")
+		}
+	}
+	for i := range comic.Serializations {
+		s := &comic.Serializations[i]
+		s.Magazine = strings.TrimSpace(s.Magazine)
+		if s.Magazine == "" {
+			return errors.New("every serialization needs a magazine")
+		}
+		if s.Started != nil && s.Ended != nil && s.Ended.Before(*s.Started) {
+			return fmt.Errorf("the serialization in %s ended before it started", s.Magazine)
+		}
+	}
+
+	volumes := make([]*uint16, len(comic.Volumes))
+	chapters := make([]*uint16, 0, len(comic.Chapters))
+	for i := range comic.Volumes {
+		v := &comic.Volumes[i]
+		volumes[i] = &v.Number
+		v.Title = strings.TrimSpace(v.Title)
+		for j := range v.Chapters {
+			chapters = append(chapters, &v.Chapters[j].Number)
+		}
+	}
+	for i := range comic.Chapters {
+		chapters = append(chapters, &comic.Chapters[i].Number)
+	}
+	if err := assignNumbers(volumes, "volume"); err != nil {
+		return err
+	}
+	return assignNumbers(chapters, "chapter")
+}
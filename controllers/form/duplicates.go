@@ -0,0 +1,218 @@
+package form
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+
+	h "codeberg.org/mjh/LibRate/internal/handlers"
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+// how often the catalog is scanned for duplicates
+const duplicateScanInterval = 6 * time.Hour
+
+type (
+	// duplicateStorage is implemented by media.Storage
+	duplicateStorage interface {
+		ScanDuplicates(ctx context.Context) (int, error)
+		DuplicateCandidates(ctx context.Context, target, status string, limit, offset int) ([]media.DuplicateCandidate, error)
+		DismissDuplicate(ctx context.Context, id int64, moderator string) error
+		MergeDuplicate(ctx context.Context, id int64, keepID, moderator string) (*media.DuplicateCandidate, error)
+	}
+
+	// duplicateScanner periodically looks for the people, groups, studios and media added more than once
+	duplicateScanner struct {
+		store   duplicateStorage
+		log     *zerolog.Logger
+		running atomic.Bool
+	}
+)
+
+// run scans the catalog right away and then every interval, until the context is cancelled
+func (s *duplicateScanner) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.scan(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scan reports whether it started, since only one scan runs at a time
+func (s *duplicateScanner) scan(ctx context.Context) bool {
+	if !s.running.CompareAndSwap(false, true) {
+		return false
+	}
+	defer s.running.Store(false)
+	found, err := s.store.ScanDuplicates(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.log.Error().Err(err).Msg("failed to scan for duplicates")
+		}
+		return true
+	}
+	s.log.Info().Msgf("found %d likely duplicates", found)
+	return true
+}
+
+// RunDuplicateScan starts scanning the catalog for duplicates in the background
+func (fc *Controller) RunDuplicateScan(ctx context.Context) {
+	go fc.scanner.run(ctx, duplicateScanInterval)
+}
+
+// @Summary List the likely duplicates
+// @Description Lists the people, groups, studios and media which were likely added more than once, most likely first
+// @Tags media,moderation
+// @Produce json
+// @Param target query string false "Kind of the duplicates" Enums(person, group, studio, media)
+// @Param status query string false "Status of the candidates" Enums(pending, merged, dismissed) default(pending)
+// @Param limit query int false "Page size" default(50)
+// @Param offset query int false "Offset" default(0)
+// @Success 200 {object} h.ResponseHTTP{data=[]media.DuplicateCandidate}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 403 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /moderation/duplicates [get]
+func (fc *Controller) GetDuplicates(c *fiber.Ctx) error {
+	name, ok := fc.isModerator(c)
+	if !ok {
+		fc.log.Warn().Msgf("Member %s tried to view the duplicates", name)
+		return h.Res(c, fiber.StatusForbidden, "Forbidden")
+	}
+	target := c.Query("target")
+	switch target {
+	case "", media.DuplicatePerson, media.DuplicateGroup, media.DuplicateStudio, media.DuplicateMedia:
+	default:
+		return h.Res(c, fiber.StatusBadRequest, "Invalid target "+target)
+	}
+	status := c.Query("status", media.StatusPending)
+	switch status {
+	case media.StatusPending, media.DuplicateMerged, media.DuplicateDismissed:
+	default:
+		return h.Res(c, fiber.StatusBadRequest, "Invalid status "+status)
+	}
+	limit := c.QueryInt("limit", defaultQueueLimit)
+	if limit <= 0 || limit > maxQueueLimit {
+		limit = defaultQueueLimit
+	}
+	offset := max(c.QueryInt("offset", 0), 0)
+
+	candidates, err := fc.duplicates.DuplicateCandidates(c.UserContext(), target, status, limit, offset)
+	if err != nil {
+		fc.log.Error().Err(err).Msg("Failed to list the duplicates")
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to list the duplicates")
+	}
+	return h.ResData(c, fiber.StatusOK, "success", candidates)
+}
+
+// @Summary Scan for duplicates
+// @Description Starts scanning the catalog for duplicates, without waiting for the next scheduled scan
+// @Tags media,moderation
+// @Produce json
+// @Param X-CSRF-Token header string true "X-CSRF-Token header"
+// @Success 202 {object} h.ResponseHTTP{}
+// @Failure 403 {object} h.ResponseHTTP{}
+// @Failure 409 {object} h.ResponseHTTP{}
+// @Router /moderation/duplicates/scan [post]
+func (fc *Controller) ScanDuplicates(c *fiber.Ctx) error {
+	name, ok := fc.isModerator(c)
+	if !ok {
+		fc.log.Warn().Msgf("Member %s tried to scan for duplicates", name)
+		return h.Res(c, fiber.StatusForbidden, "Forbidden")
+	}
+	if fc.scanner.running.Load() {
+		return h.Res(c, fiber.StatusConflict, "The catalog is being scanned already")
+	}
+	// the request context is gone as soon as the response is sent
+	go fc.scanner.scan(context.Background())
+	return h.Res(c, fiber.StatusAccepted, "Scanning for duplicates")
+}
+
+// @Summary Merge duplicates
+// @Description Merges one of the duplicates into the other. Ratings, cast, artists, images and keywords
+// @Description are moved to the row which is kept, and the links to the merged one are redirected
+// @Tags media,moderation
+// @Produce json
+// @Param id path int true "Duplicate candidate ID"
+// @Param keep query string false "ID of the row to keep, the first one by default"
+// @Param X-CSRF-Token header string true "X-CSRF-Token header"
+// @Success 200 {object} h.ResponseHTTP{data=media.DuplicateCandidate}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 403 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 409 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /moderation/duplicates/{id}/merge [post]
+func (fc *Controller) MergeDuplicate(c *fiber.Ctx) error {
+	name, ok := fc.isModerator(c)
+	if !ok {
+		fc.log.Warn().Msgf("Member %s tried to merge duplicates", name)
+		return h.Res(c, fiber.StatusForbidden, "Forbidden")
+	}
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return h.Res(c, fiber.StatusBadRequest, "Invalid duplicate ID")
+	}
+
+	candidate, err := fc.duplicates.MergeDuplicate(c.UserContext(), id, c.Query("keep"), memberWebfinger(c))
+	if err != nil {
+		return fc.handleDuplicateError(c, id, err)
+	}
+	fc.log.Info().Msgf("Member %s merged the duplicate %s %s and %s", name,
+		candidate.Target, candidate.FirstID, candidate.SecondID)
+	return h.ResData(c, fiber.StatusOK, "success", candidate)
+}
+
+// @Summary Dismiss duplicates
+// @Description Marks the candidate as not being a duplicate, so that it's not suggested again
+// @Tags media,moderation
+// @Produce json
+// @Param id path int true "Duplicate candidate ID"
+// @Param X-CSRF-Token header string true "X-CSRF-Token header"
+// @Success 200 {object} h.ResponseHTTP{}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 403 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 409 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /moderation/duplicates/{id}/dismiss [post]
+func (fc *Controller) DismissDuplicate(c *fiber.Ctx) error {
+	name, ok := fc.isModerator(c)
+	if !ok {
+		fc.log.Warn().Msgf("Member %s tried to dismiss duplicates", name)
+		return h.Res(c, fiber.StatusForbidden, "Forbidden")
+	}
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return h.Res(c, fiber.StatusBadRequest, "Invalid duplicate ID")
+	}
+	if err = fc.duplicates.DismissDuplicate(c.UserContext(), id, memberWebfinger(c)); err != nil {
+		return fc.handleDuplicateError(c, id, err)
+	}
+	return h.Res(c, fiber.StatusOK, "Dismissed")
+}
+
+func (fc *Controller) handleDuplicateError(c *fiber.Ctx, id int64, err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return h.Res(c, fiber.StatusNotFound, "Duplicate not found")
+	case errors.Is(err, media.ErrResolved), errors.Is(err, media.ErrUnmergeable):
+		return h.Res(c, fiber.StatusConflict, err.Error())
+	case errors.Is(err, media.ErrInvalidKey):
+		return h.Res(c, fiber.StatusBadRequest, err.Error())
+	default:
+		fc.log.Error().Err(err).Msgf("Failed to resolve duplicate %d", id)
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to resolve the duplicate")
+	}
+}
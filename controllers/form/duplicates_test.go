@@ -0,0 +1,134 @@
+package form
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/models/media"
+	"codeberg.org/mjh/LibRate/tests"
+)
+
+// memoryDuplicates mimics media.duplicate_candidates, with the merges reduced to the status changes
+type memoryDuplicates struct {
+	candidates map[int64]*media.DuplicateCandidate
+	scans      chan struct{}
+}
+
+func (m *memoryDuplicates) ScanDuplicates(_ context.Context) (int, error) {
+	m.scans <- struct{}{}
+	return len(m.candidates), nil
+}
+
+func (m *memoryDuplicates) DuplicateCandidates(_ context.Context, target, status string, _, _ int) ([]media.DuplicateCandidate, error) {
+	candidates := make([]media.DuplicateCandidate, 0)
+	for _, c := range m.candidates {
+		if c.Status == status && (target == "" || c.Target == target) {
+			candidates = append(candidates, *c)
+		}
+	}
+	return candidates, nil
+}
+
+func (m *memoryDuplicates) resolve(id int64, moderator, status string) (*media.DuplicateCandidate, error) {
+	c, ok := m.candidates[id]
+	if !ok {
+		return nil, fmt.Errorf("error getting duplicate candidate %d: %w", id, sql.ErrNoRows)
+	}
+	if c.Status != media.StatusPending {
+		return nil, media.ErrResolved
+	}
+	c.Status = status
+	c.ResolvedBy = sql.NullString{String: moderator, Valid: true}
+	c.Resolved = sql.NullTime{Time: time.Now(), Valid: true}
+	return c, nil
+}
+
+func (m *memoryDuplicates) DismissDuplicate(_ context.Context, id int64, moderator string) error {
+	_, err := m.resolve(id, moderator, media.DuplicateDismissed)
+	return err
+}
+
+func (m *memoryDuplicates) MergeDuplicate(_ context.Context, id int64, keepID, moderator string) (*media.DuplicateCandidate, error) {
+	if c, ok := m.candidates[id]; ok && keepID != "" && keepID != c.FirstID && keepID != c.SecondID {
+		return nil, fmt.Errorf("%w %q: not one of the duplicates", media.ErrInvalidKey, keepID)
+	}
+	return m.resolve(id, moderator, media.DuplicateMerged)
+}
+
+func newDuplicatesApp(store *memoryDuplicates) *fiber.App {
+	log := zerolog.Nop()
+	fc := &Controller{
+		log:        &log,
+		members:    memoryRoles{"alice": "mod", "lain": "regular"},
+		duplicates: store,
+		scanner:    &duplicateScanner{store: store, log: &log},
+	}
+	app := fiber.New()
+	app.Use(tests.FakeAuth)
+	app.Get("/moderation/duplicates", fc.GetDuplicates)
+	app.Post("/moderation/duplicates/scan", fc.ScanDuplicates)
+	app.Post("/moderation/duplicates/:id/merge", fc.MergeDuplicate)
+	app.Post("/moderation/duplicates/:id/dismiss", fc.DismissDuplicate)
+	return app
+}
+
+func TestDuplicates(t *testing.T) {
+	store := &memoryDuplicates{
+		candidates: map[int64]*media.DuplicateCandidate{
+			1: {ID: 1, Target: media.DuplicatePerson, FirstID: "a", SecondID: "b", Score: 0.7, Status: media.StatusPending},
+			2: {ID: 2, Target: media.DuplicateMedia, FirstID: "c", SecondID: "d", Score: 1, Status: media.StatusPending},
+		},
+		scans: make(chan struct{}, 1),
+	}
+	app := newDuplicatesApp(store)
+
+	status, _ := tests.JSONRequest(t, app, fiber.MethodGet, "/moderation/duplicates", "lain", "")
+	assert.Equal(t, fiber.StatusForbidden, status)
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, "/moderation/duplicates/1/merge", "lain", "")
+	assert.Equal(t, fiber.StatusForbidden, status)
+
+	status, data := tests.JSONRequest(t, app, fiber.MethodGet, "/moderation/duplicates?target=person", "alice", "")
+	require.Equal(t, fiber.StatusOK, status)
+	var listed []media.DuplicateCandidate
+	require.NoError(t, json.Unmarshal(data, &listed))
+	require.Len(t, listed, 1)
+	assert.Equal(t, int64(1), listed[0].ID)
+	status, _ = tests.JSONRequest(t, app, fiber.MethodGet, "/moderation/duplicates?target=genre", "alice", "")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, "/moderation/duplicates/1/merge?keep=x", "alice", "")
+	assert.Equal(t, fiber.StatusBadRequest, status, "only one of the pair can be kept")
+	status, data = tests.JSONRequest(t, app, fiber.MethodPost, "/moderation/duplicates/1/merge?keep=b", "alice", "")
+	require.Equal(t, fiber.StatusOK, status)
+	var merged media.DuplicateCandidate
+	require.NoError(t, json.Unmarshal(data, &merged))
+	assert.Equal(t, media.DuplicateMerged, merged.Status)
+	assert.Equal(t, "alice@librate.club", merged.ResolvedBy.String)
+
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, "/moderation/duplicates/1/dismiss", "alice", "")
+	assert.Equal(t, fiber.StatusConflict, status, "merged duplicates can't be dismissed")
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, "/moderation/duplicates/2/dismiss", "alice", "")
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, media.DuplicateDismissed, store.candidates[2].Status)
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, "/moderation/duplicates/3/dismiss", "alice", "")
+	assert.Equal(t, fiber.StatusNotFound, status)
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, "/moderation/duplicates/x/dismiss", "alice", "")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, "/moderation/duplicates/scan", "alice", "")
+	require.Equal(t, fiber.StatusAccepted, status)
+	select {
+	case <-store.scans:
+	case <-time.After(time.Second):
+		t.Fatal("the scan didn't start")
+	}
+}
@@ -0,0 +1,73 @@
+package form
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+func (fc *Controller) addGame(c *fiber.Ctx) (err error) {
+	var game media.Game
+	if err = c.BodyParser(&game); err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to parse JSON: %s", err.Error())
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+	}
+	if err = checkGame(&game); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err = fc.storage.AddGame(c.UserContext(), &game, memberName(c)); err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to add game: %s", err.Error())
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to add game")
+	}
+
+	return nil
+}
+
+// checkGame validates the submitted game. The regions of the releases are uppercased and
+// the releases without a region are treated as worldwide
+func checkGame(game *media.Game) error {
+	game.Title = strings.TrimSpace(game.Title)
+	if game.Title == "" {
+		return errors.New("the title of the game is required")
+	}
+	for i := range game.Platforms {
+		game.Platforms[i].Name = strings.TrimSpace(game.Platforms[i].Name)
+		if game.Platforms[i].Name == "" {
+			return errors.New("every platform needs a name")
+		}
+	}
+	for i := range game.Franchises {
+		game.Franchises[i].Name = strings.TrimSpace(game.Franchises[i].Name)
+		if game.Franchises[i].Name == "" {
+			return errors.New("every franchise needs a name")
+		}
+	}
+	for _, studios := range [][]media.Studio{game.Developers, game.Publishers} {
+		for i := range studios {
+			studios[i].Name = strings.TrimSpace(studios[i].Name)
+			if studios[i].ID == 0 && studios[i].Name == "" {
+				return errors.New("every developer and publisher needs a name")
+			}
+		}
+	}
+	for i := range game.Releases {
+		r := &game.Releases[i]
+		r.Region = strings.ToUpper(strings.TrimSpace(r.Region))
+		if r.Region == "" {
+			r.Region = media.RegionWorldwide
+		}
+		if !media.ValidRegion(r.Region) {
+			return fmt.Errorf("invalid region %q", r.Region)
+		}
+		if r.Date.IsZero() {
+			return fmt.Errorf("the release date in region %s is required", r.Region)
+		}
+		r.Platform = strings.TrimSpace(r.Platform)
+	}
+	return nil
+}
@@ -1,10 +1,14 @@
 package form
 
 import (
+	"context"
+
+	"github.com/gofrs/uuid/v5"
 	"github.com/rs/zerolog"
 
 	"codeberg.org/mjh/LibRate/cfg"
 	"codeberg.org/mjh/LibRate/models/media"
+	"codeberg.org/mjh/LibRate/models/member"
 )
 
 type (
@@ -12,16 +16,38 @@ type (
 		log     *zerolog.Logger
 		storage media.Storage
 		conf    *cfg.Config
+		// used to tell moderators from the other members
+		members    roleChecker
+		moderation moderationStorage
+		duplicates duplicateStorage
+		scanner    *duplicateScanner
+	}
+
+	roleChecker interface {
+		HasRole(ctx context.Context, name, role string, exact bool) bool
+	}
+
+	// moderationStorage is implemented by media.Storage
+	moderationStorage interface {
+		ModerationQueue(ctx context.Context, statuses []string, limit, offset int) ([]media.Submission, error)
+		Submission(ctx context.Context, mediaID uuid.UUID) (*media.Submission, error)
+		Moderate(ctx context.Context, mediaID uuid.UUID, reviewer, status, comment string) (*media.ModerationComment, error)
 	}
 )
 
 func NewController(log *zerolog.Logger,
 	storage media.Storage,
+	members member.Storer,
 	conf *cfg.Config,
 ) *Controller {
-	return &Controller{
+	fc := &Controller{
 		log:     log,
 		storage: storage,
 		conf:    conf,
+		members: members,
 	}
+	fc.moderation = &fc.storage
+	fc.duplicates = &fc.storage
+	fc.scanner = &duplicateScanner{store: fc.duplicates, log: log}
+	return fc
 }
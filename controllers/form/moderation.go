@@ -0,0 +1,164 @@
+package form
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid/v5"
+
+	h "codeberg.org/mjh/LibRate/internal/handlers"
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+const (
+	defaultQueueLimit = 50
+	maxQueueLimit     = 200
+)
+
+// ModerationInput is the decision of a moderator on a submission
+type ModerationInput struct {
+	Status string `json:"status" enum:"approved,rejected,needs-changes" example:"needs-changes"`
+	// required unless the submission is approved
+	Comment string `json:"comment,omitempty" example:"Please add the release date"`
+}
+
+// isModerator checks if the request was made by a moderator
+func (fc *Controller) isModerator(c *fiber.Ctx) (string, bool) {
+	name := memberName(c)
+	if name == "" || !fc.members.HasRole(c.Context(), name, "mod", false) {
+		return name, false
+	}
+	return name, true
+}
+
+// @Summary List the moderation queue
+// @Description Lists the submitted media waiting for a moderator, oldest first.
+// @Description By default, both the pending submissions and the ones the submitters were asked to change are listed
+// @Tags media,moderation
+// @Produce json
+// @Param status query string false "Comma separated statuses" example(pending)
+// @Param limit query int false "Page size" default(50)
+// @Param offset query int false "Offset" default(0)
+// @Success 200 {object} h.ResponseHTTP{data=[]media.Submission}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 403 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /moderation/queue [get]
+func (fc *Controller) GetQueue(c *fiber.Ctx) error {
+	name, ok := fc.isModerator(c)
+	if !ok {
+		fc.log.Warn().Msgf("Member %s tried to view the moderation queue", name)
+		return h.Res(c, fiber.StatusForbidden, "Forbidden")
+	}
+	statuses := []string{media.StatusPending, media.StatusNeedsChanges}
+	if q := c.Query("status"); q != "" {
+		statuses = strings.Split(q, ",")
+		for _, s := range statuses {
+			if s != media.StatusPending && s != media.StatusNeedsChanges && s != media.StatusRejected {
+				return h.Res(c, fiber.StatusBadRequest, "Invalid status "+s)
+			}
+		}
+	}
+	limit := c.QueryInt("limit", defaultQueueLimit)
+	if limit <= 0 || limit > maxQueueLimit {
+		limit = defaultQueueLimit
+	}
+	offset := max(c.QueryInt("offset", 0), 0)
+
+	queue, err := fc.moderation.ModerationQueue(c.UserContext(), statuses, limit, offset)
+	if err != nil {
+		fc.log.Error().Err(err).Msg("Failed to list the moderation queue")
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to list the moderation queue")
+	}
+	return h.ResData(c, fiber.StatusOK, "success", queue)
+}
+
+// @Summary Get a submission
+// @Description Returns the moderation status of the submitted media along with the moderators' comments.
+// @Description Only moderators and the member who submitted the media can see it
+// @Tags media,moderation
+// @Produce json
+// @Param id path string true "Media UUID"
+// @Success 200 {object} h.ResponseHTTP{data=media.Submission}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /moderation/{id} [get]
+func (fc *Controller) GetSubmission(c *fiber.Ctx) error {
+	mediaID, err := uuid.FromString(c.Params("id"))
+	if err != nil {
+		return h.Res(c, fiber.StatusBadRequest, "Invalid media ID")
+	}
+	submission, err := fc.moderation.Submission(c.UserContext(), mediaID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return h.Res(c, fiber.StatusNotFound, "Submission not found")
+	}
+	if err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to get submission %s", mediaID)
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to get the submission")
+	}
+	name, isMod := fc.isModerator(c)
+	if !isMod && (!submission.Submitter.Valid || submission.Submitter.String != name) {
+		// not telling the others whether there's such a submission at all
+		return h.Res(c, fiber.StatusNotFound, "Submission not found")
+	}
+	return h.ResData(c, fiber.StatusOK, "success", submission)
+}
+
+// @Summary Moderate a submission
+// @Description Approves or rejects the submitted media, or asks the submitter for changes.
+// @Description Approved media become visible and searchable. Once the submitter updates the media they were
+// @Description asked to change, it's back in the queue
+// @Tags media,moderation
+// @Accept json
+// @Produce json
+// @Param id path string true "Media UUID"
+// @Param input body ModerationInput true "The decision"
+// @Param X-CSRF-Token header string true "X-CSRF-Token header"
+// @Success 200 {object} h.ResponseHTTP{data=media.ModerationComment}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 403 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 409 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /moderation/{id} [post]
+func (fc *Controller) Moderate(c *fiber.Ctx) error {
+	name, ok := fc.isModerator(c)
+	if !ok {
+		fc.log.Warn().Msgf("Member %s tried to moderate a submission", name)
+		return h.Res(c, fiber.StatusForbidden, "Forbidden")
+	}
+	mediaID, err := uuid.FromString(c.Params("id"))
+	if err != nil {
+		return h.Res(c, fiber.StatusBadRequest, "Invalid media ID")
+	}
+	var input ModerationInput
+	if err = c.BodyParser(&input); err != nil {
+		return h.Res(c, fiber.StatusBadRequest, "Cannot parse JSON")
+	}
+	input.Comment = strings.TrimSpace(input.Comment)
+	switch input.Status {
+	case media.StatusApproved:
+	case media.StatusRejected, media.StatusNeedsChanges:
+		if input.Comment == "" {
+			return h.Res(c, fiber.StatusBadRequest, "Please explain to the submitter what is wrong")
+		}
+	default:
+		return h.Res(c, fiber.StatusBadRequest, "Invalid status")
+	}
+
+	comment, err := fc.moderation.Moderate(c.UserContext(), mediaID, name, input.Status, input.Comment)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return h.Res(c, fiber.StatusNotFound, "Submission not found")
+	case errors.Is(err, media.ErrInvalidTransition):
+		return h.Res(c, fiber.StatusConflict, err.Error())
+	case err != nil:
+		fc.log.Error().Err(err).Msgf("Failed to moderate submission %s", mediaID)
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to moderate the submission")
+	}
+	fc.log.Info().Msgf("Member %s set the status of %s to %s", name, mediaID, input.Status)
+	return h.ResData(c, fiber.StatusOK, "success", comment)
+}
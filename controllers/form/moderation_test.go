@@ -0,0 +1,156 @@
+package form
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/models/media"
+	"codeberg.org/mjh/LibRate/tests"
+)
+
+// memoryRoles maps the member names onto their roles
+type memoryRoles map[string]string
+
+func (m memoryRoles) HasRole(_ context.Context, name, role string, _ bool) bool {
+	return m[name] == role
+}
+
+// memoryQueue mimics the moderation columns of media.media
+type memoryQueue map[uuid.UUID]*media.Submission
+
+func (m memoryQueue) ModerationQueue(_ context.Context, statuses []string, _, _ int) ([]media.Submission, error) {
+	queue := make([]media.Submission, 0)
+	for _, s := range m {
+		for _, status := range statuses {
+			if s.Status == status {
+				queue = append(queue, *s)
+			}
+		}
+	}
+	return queue, nil
+}
+
+func (m memoryQueue) Submission(_ context.Context, mediaID uuid.UUID) (*media.Submission, error) {
+	s, ok := m[mediaID]
+	if !ok {
+		return nil, fmt.Errorf("error getting submission %s: %w", mediaID, sql.ErrNoRows)
+	}
+	return s, nil
+}
+
+func (m memoryQueue) Moderate(_ context.Context, mediaID uuid.UUID, reviewer, status, comment string) (*media.ModerationComment, error) {
+	s, ok := m[mediaID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if !media.CanTransition(s.Status, status) {
+		return nil, fmt.Errorf("%w: %s to %s", media.ErrInvalidTransition, s.Status, status)
+	}
+	s.Status = status
+	c := media.ModerationComment{
+		MediaID:  mediaID,
+		Reviewer: sql.NullString{String: reviewer, Valid: true},
+		Status:   status,
+		Body:     comment,
+		Created:  time.Now(),
+	}
+	s.Comments = append(s.Comments, c)
+	return &c, nil
+}
+
+func newModerationApp(queue memoryQueue) *fiber.App {
+	log := zerolog.Nop()
+	fc := &Controller{
+		log:        &log,
+		members:    memoryRoles{"alice": "mod", "lain": "regular"},
+		moderation: queue,
+	}
+	app := fiber.New()
+	app.Use(tests.FakeAuth)
+	app.Get("/moderation/queue", fc.GetQueue)
+	app.Get("/moderation/:id", fc.GetSubmission)
+	app.Post("/moderation/:id", fc.Moderate)
+	return app
+}
+
+func TestModerationQueue(t *testing.T) {
+	pending := uuid.Must(uuid.NewV4())
+	queue := memoryQueue{
+		pending:                 {ID: pending, Title: "Mezzanine", Kind: "album", Status: media.StatusPending},
+		uuid.Must(uuid.NewV4()): {Title: "Blue Lines", Kind: "album", Status: media.StatusApproved},
+	}
+	app := newModerationApp(queue)
+
+	status, _ := tests.JSONRequest(t, app, fiber.MethodGet, "/moderation/queue", "lain", "")
+	assert.Equal(t, fiber.StatusForbidden, status)
+
+	status, data := tests.JSONRequest(t, app, fiber.MethodGet, "/moderation/queue", "alice", "")
+	require.Equal(t, fiber.StatusOK, status)
+	var listed []media.Submission
+	require.NoError(t, json.Unmarshal(data, &listed))
+	require.Len(t, listed, 1, "approved media shouldn't be in the queue")
+	assert.Equal(t, pending, listed[0].ID)
+
+	status, _ = tests.JSONRequest(t, app, fiber.MethodGet, "/moderation/queue?status=approved", "alice", "")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
+
+func TestModerate(t *testing.T) {
+	id := uuid.Must(uuid.NewV4())
+	queue := memoryQueue{
+		id: {
+			ID: id, Title: "Mezzanine", Kind: "album", Status: media.StatusPending,
+			Submitter: sql.NullString{String: "lain", Valid: true},
+		},
+	}
+	app := newModerationApp(queue)
+	path := "/moderation/" + id.String()
+
+	status, _ := tests.JSONRequest(t, app, fiber.MethodPost, path, "lain", `{"status":"approved"}`)
+	assert.Equal(t, fiber.StatusForbidden, status, "submitters can't approve their own submissions")
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, path, "alice", `{"status":"needs-changes"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status, "the submitter should be told what to change")
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, path, "alice", `{"status":"pending"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, path, "alice", `{"status":"needs-changes","comment":"Add the tracklist"}`)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, media.StatusNeedsChanges, queue[id].Status)
+
+	status, data := tests.JSONRequest(t, app, fiber.MethodGet, path, "lain", "")
+	require.Equal(t, fiber.StatusOK, status, "the submitter should see the comments")
+	var submission media.Submission
+	require.NoError(t, json.Unmarshal(data, &submission))
+	require.Len(t, submission.Comments, 1)
+	assert.Equal(t, "Add the tracklist", submission.Comments[0].Body)
+	assert.Equal(t, "alice", submission.Comments[0].Reviewer.String)
+
+	status, _ = tests.JSONRequest(t, app, fiber.MethodGet, path, "mallory", "")
+	assert.Equal(t, fiber.StatusNotFound, status, "other members shouldn't see the submission")
+
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, path, "alice", `{"status":"approved"}`)
+	require.Equal(t, fiber.StatusOK, status)
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, path, "alice", `{"status":"rejected","comment":"Duplicate"}`)
+	assert.Equal(t, fiber.StatusConflict, status, "approved submissions are final")
+
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, "/moderation/"+uuid.Must(uuid.NewV4()).String(), "alice", `{"status":"approved"}`)
+	assert.Equal(t, fiber.StatusNotFound, status)
+}
+
+func TestCanTransition(t *testing.T) {
+	assert.True(t, media.CanTransition(media.StatusPending, media.StatusApproved))
+	assert.True(t, media.CanTransition(media.StatusNeedsChanges, media.StatusPending))
+	assert.False(t, media.CanTransition(media.StatusPending, media.StatusPending))
+	assert.False(t, media.CanTransition(media.StatusRejected, media.StatusApproved))
+	assert.False(t, media.CanTransition(media.StatusApproved, media.StatusNeedsChanges))
+}
@@ -0,0 +1,100 @@
+package form
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+func (fc *Controller) addAlbum(c *fiber.Ctx) (err error) {
+	var album media.Album
+	if err = c.BodyParser(&album); err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to parse JSON: %s", err.Error())
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+	}
+	if err = checkAlbum(&album); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err = fc.storage.SubmitAlbum(c.UserContext(), &album, memberName(c)); err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to add album: %s", err.Error())
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to add album")
+	}
+
+	return nil
+}
+
+func (fc *Controller) addTrack(c *fiber.Ctx) (err error) {
+	var track media.Track
+	if err = c.BodyParser(&track); err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to parse JSON: %s", err.Error())
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+	}
+	track.Name = strings.TrimSpace(track.Name)
+	switch {
+	case track.AlbumID == nil:
+		return fiber.NewError(fiber.StatusBadRequest, "The album of the track is required")
+	case track.Name == "":
+		return fiber.NewError(fiber.StatusBadRequest, "The name of the track is required")
+	case track.Number <= 0:
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid track number")
+	}
+
+	err = fc.storage.SubmitTrack(c.UserContext(), &track, memberName(c))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiber.NewError(fiber.StatusNotFound, "No such album")
+	}
+	if err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to add track: %s", err.Error())
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to add track")
+	}
+
+	return nil
+}
+
+// checkAlbum validates the submitted album and numbers its tracks. Unless the duration of
+// the album is given, it's the sum of the durations of its tracks
+func checkAlbum(album *media.Album) error {
+	album.Name = strings.TrimSpace(album.Name)
+	if album.Name == "" {
+		return errors.New("the name of the album is required")
+	}
+	numbers := make([]*int16, len(album.Tracks))
+	for i := range album.Tracks {
+		album.Tracks[i].Name = strings.TrimSpace(album.Tracks[i].Name)
+		if album.Tracks[i].Name == "" {
+			return errors.New("every track needs a name")
+		}
+		numbers[i] = &album.Tracks[i].Number
+	}
+	if err := assignNumbers(numbers, "track"); err != nil {
+		return err
+	}
+
+	if !album.Duration.Valid && len(album.Tracks) > 0 {
+		var total time.Duration
+		for i := range album.Tracks {
+			d := clockDuration(album.Tracks[i].Duration)
+			if d == 0 {
+				return nil
+			}
+			total += d
+		}
+		// the duration is stored as the time of day
+		if total < 24*time.Hour {
+			album.Duration = sql.NullTime{Time: time.Time{}.Add(total), Valid: true}
+		}
+	}
+	return nil
+}
+
+// clockDuration reads the duration stored as the time of day
+func clockDuration(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+}
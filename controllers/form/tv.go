@@ -0,0 +1,114 @@
+package form
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+func (fc *Controller) addTVShow(c *fiber.Ctx) (err error) {
+	var show media.TVShow
+	if err = c.BodyParser(&show); err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to parse JSON: %s", err.Error())
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+	}
+	if err = checkTVShow(&show); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err = fc.storage.AddTVShow(c.UserContext(), &show, memberName(c)); err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to add TV show: %s", err.Error())
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to add TV show")
+	}
+
+	return nil
+}
+
+func (fc *Controller) addSeason(c *fiber.Ctx) (err error) {
+	var season media.Season
+	if err = c.BodyParser(&season); err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to parse JSON: %s", err.Error())
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+	}
+	if season.ShowID == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "The TV show of the season is required")
+	}
+	if season.Number == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid season number")
+	}
+	if err = checkEpisodes(season.Episodes); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	err = fc.storage.AddSeason(c.UserContext(), &season, memberName(c))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiber.NewError(fiber.StatusNotFound, "No such TV show")
+	}
+	if err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to add season: %s", err.Error())
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to add season")
+	}
+
+	return nil
+}
+
+func (fc *Controller) addEpisode(c *fiber.Ctx) (err error) {
+	var episode media.Episode
+	if err = c.BodyParser(&episode); err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to parse JSON: %s", err.Error())
+		return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+	}
+	episode.Title = strings.TrimSpace(episode.Title)
+	switch {
+	case episode.ShowID == nil:
+		return fiber.NewError(fiber.StatusBadRequest, "The TV show of the episode is required")
+	case episode.Season == 0 || episode.Episode == 0:
+		return fiber.NewError(fiber.StatusBadRequest, "Both the season and the episode number are required")
+	case episode.Title == "":
+		return fiber.NewError(fiber.StatusBadRequest, "The title of the episode is required")
+	}
+
+	err = fc.storage.AddEpisode(c.UserContext(), &episode, memberName(c))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiber.NewError(fiber.StatusNotFound, "No such season")
+	}
+	if err != nil {
+		fc.log.Error().Err(err).Msgf("Failed to add episode: %s", err.Error())
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to add episode")
+	}
+
+	return nil
+}
+
+// checkTVShow validates the submitted show and numbers its seasons and episodes
+func checkTVShow(show *media.TVShow) error {
+	show.Title = strings.TrimSpace(show.Title)
+	if show.Title == "" {
+		return errors.New("the title of the TV show is required")
+	}
+	numbers := make([]*uint8, len(show.Seasons))
+	for i := range show.Seasons {
+		numbers[i] = &show.Seasons[i].Number
+		if err := checkEpisodes(show.Seasons[i].Episodes); err != nil {
+			return err
+		}
+	}
+	return assignNumbers(numbers, "season")
+}
+
+// checkEpisodes validates the episodes of a season and numbers them
+func checkEpisodes(episodes []media.Episode) error {
+	numbers := make([]*uint16, len(episodes))
+	for i := range episodes {
+		episodes[i].Title = strings.TrimSpace(episodes[i].Title)
+		if episodes[i].Title == "" {
+			return errors.New("every episode needs a title")
+		}
+		numbers[i] = &episodes[i].Episode
+	}
+	return assignNumbers(numbers, "episode")
+}
@@ -0,0 +1,377 @@
+package media
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+	"golang.org/x/net/html"
+
+	"codeberg.org/mjh/LibRate/cfg"
+	"codeberg.org/mjh/LibRate/models/media"
+	"codeberg.org/mjh/LibRate/models/static"
+)
+
+// bandcampDate is the format of the release dates in the embedded metadata, e.g. "20 Oct 2017 00:00:00 GMT"
+const bandcampDate = "02 Jan 2006 15:04:05 MST"
+
+type (
+	// coverStorer saves the cover art of the imported albums
+	coverStorer interface {
+		AddImage(ctx context.Context, props *static.MediaProps) (dest string, id int64, err error)
+		SetThumbnail(ctx context.Context, imageID int64, thumbnail string) error
+		AttachImage(ctx context.Context, mediaID uuid.UUID, imageID int64, isMain bool) error
+	}
+
+	bandcampImporter struct {
+		client  *http.Client
+		catalog albumSaver
+		covers  coverStorer
+		thumbs  *cfg.ThumbnailConfig
+		// the limit for both the page and the cover art
+		maxSize int64
+		log     *zerolog.Logger
+	}
+
+	// bandcampTralbum is the JSON embedded in the data-tralbum attribute of album and track pages
+	bandcampTralbum struct {
+		// album or track
+		ItemType         string `json:"item_type"`
+		Artist           string `json:"artist"`
+		ArtID            int64  `json:"art_id"`
+		AlbumReleaseDate string `json:"album_release_date"`
+		Current          struct {
+			Title       string `json:"title"`
+			ReleaseDate string `json:"release_date"`
+			PublishDate string `json:"publish_date"`
+		} `json:"current"`
+		TrackInfo []struct {
+			Title string `json:"title"`
+			// in seconds
+			Duration float64 `json:"duration"`
+			TrackNum int     `json:"track_num"`
+		} `json:"trackinfo"`
+	}
+
+	// bandcampLD is the schema.org MusicAlbum or MusicRecording description of the page
+	bandcampLD struct {
+		Type          string          `json:"@type"`
+		Name          string          `json:"name"`
+		DatePublished string          `json:"datePublished"`
+		Image         json.RawMessage `json:"image"`
+		Keywords      json.RawMessage `json:"keywords"`
+		ByArtist      bandcampEntity  `json:"byArtist"`
+		Publisher     bandcampEntity  `json:"publisher"`
+	}
+
+	bandcampEntity struct {
+		Type string `json:"@type"`
+		Name string `json:"name"`
+	}
+)
+
+func newBandcampImporter(conf *cfg.Config, catalog albumSaver, covers coverStorer, log *zerolog.Logger) *bandcampImporter {
+	return &bandcampImporter{
+		client:  &http.Client{Timeout: 15 * time.Second},
+		catalog: catalog,
+		covers:  covers,
+		thumbs:  &conf.Fiber.Thumbnailing,
+		maxSize: max(conf.Fiber.MaxUploadSize, 10<<20),
+		log:     log,
+	}
+}
+
+// withCatalog returns a copy of the importer which resolves and saves through the given catalog
+func (bi *bandcampImporter) withCatalog(catalog albumSaver) *bandcampImporter {
+	clone := *bi
+	clone.catalog = catalog
+	return &clone
+}
+
+// Import scrapes a Bandcamp album or track page and adds it to the catalog. Track pages are
+// imported as single-track releases. The cover art is saved on behalf of the importing member
+func (bi *bandcampImporter) Import(ctx context.Context, memberName, uri string) (*media.Album, error) {
+	pageURL, err := parseBandcampURL(uri)
+	if err != nil {
+		return nil, err
+	}
+	page, _, err := bi.fetch(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	tralbum, ld, err := parseBandcampPage(page)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", errInvalidImportURI, uri, err)
+	}
+
+	album := &media.Album{
+		Name:        cmp.Or(ld.Name, tralbum.Current.Title),
+		ReleaseDate: parseBandcampDate(tralbum.AlbumReleaseDate, tralbum.Current.ReleaseDate, ld.DatePublished, tralbum.Current.PublishDate),
+	}
+	artistName := cmp.Or(ld.ByArtist.Name, tralbum.Artist)
+	if artistName != "" {
+		// Bandcamp describes every artist as a MusicGroup, only the rare Person is certain
+		artist, err := bi.catalog.ResolveArtist(ctx, artistName, ld.ByArtist.Type != "Person")
+		if err != nil {
+			return nil, err
+		}
+		album.AlbumArtists = []media.AlbumArtist{*artist}
+	}
+	if label := ld.Publisher.Name; label != "" && !strings.EqualFold(label, artistName) {
+		if album.Studio, err = bi.catalog.ResolveStudio(ctx, label, media.Music); err != nil {
+			return nil, err
+		}
+	}
+
+	// the tags mix genres, places and moods, the ones which aren't genres become keywords
+	tags := bandcampKeywords(ld.Keywords)
+	if album.Genres, err = bi.catalog.FindGenres(ctx, "music", tags); err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		isGenre := false
+		for i := range album.Genres {
+			if strings.EqualFold(album.Genres[i].Name, tag) {
+				isGenre = true
+				break
+			}
+		}
+		if !isGenre {
+			album.Keywords = append(album.Keywords, media.Keyword{Keyword: strings.ToLower(tag)})
+		}
+	}
+
+	var total time.Duration
+	for i, t := range tralbum.TrackInfo {
+		duration := time.Duration(t.Duration * float64(time.Second)).Round(time.Second)
+		total += duration
+		number := t.TrackNum
+		if number == 0 {
+			number = i + 1
+		}
+		album.Tracks = append(album.Tracks, media.Track{
+			Name:     t.Title,
+			Duration: time.Time{}.Add(duration),
+			Number:   int16(number),
+		})
+	}
+	if total > 0 {
+		album.Duration.Time, album.Duration.Valid = time.Time{}.Add(total), true
+	}
+
+	id, err := bi.catalog.AddAlbum(ctx, album)
+	if err != nil {
+		return nil, err
+	}
+	album.MediaID = &id
+
+	// the album is already in the catalog, so a missing cover shouldn't fail the import
+	if cover := bandcampCover(ld.Image, tralbum.ArtID); cover != "" {
+		err = afterSave(ctx, bi.catalog, func(ctx context.Context) error {
+			path, err := bi.saveCover(ctx, memberName, *album.MediaID, cover)
+			if err != nil {
+				bi.log.Warn().Err(err).Msgf("failed to save the cover art of %s", uri)
+				return nil
+			}
+			album.ImagePaths = append(album.ImagePaths, path)
+			return nil
+		})
+	}
+	return album, err
+}
+
+// saveCover downloads the cover art, registers it as the album's main image and generates its thumbnail
+func (bi *bandcampImporter) saveCover(ctx context.Context, memberName string, albumID uuid.UUID, coverURL string) (string, error) {
+	u, err := url.Parse(coverURL)
+	if err != nil || u.Scheme != "https" || !isHostOf(u.Hostname(), "bcbits.com") {
+		return "", fmt.Errorf("unexpected cover art location %s", coverURL)
+	}
+	data, mimeType, err := bi.fetch(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	var ext string
+	switch mimeType {
+	case "image/jpeg":
+		ext = "jpg"
+	case "image/png":
+		ext = "png"
+	case "image/gif":
+		ext = "gif"
+	default:
+		return "", fmt.Errorf("unsupported cover art type %s", mimeType)
+	}
+
+	sum := sha256.Sum256(data)
+	dest, imageID, err := bi.covers.AddImage(ctx, &static.MediaProps{
+		Uploader:  memberName,
+		Ext:       ext,
+		Hash:      hex.EncodeToString(sum[:]),
+		ImageType: "album_cover",
+		MediaID:   &albumID,
+	})
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create the directory for %s: %w", dest, err)
+	}
+	if err = os.WriteFile(dest, data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to save cover art to %s: %w", dest, err)
+	}
+	if err = bi.covers.AttachImage(ctx, albumID, imageID, true); err != nil {
+		return "", err
+	}
+
+	if dims := bi.thumbs.DimsFor("album_cover"); dims != nil {
+		thumb, err := static.SaveThumbnail(*dims, dest, mimeType)
+		if err != nil {
+			bi.log.Warn().Err(err).Msgf("failed to generate thumbnail for %s", dest)
+			return dest, nil
+		}
+		if err = bi.covers.SetThumbnail(ctx, imageID, thumb); err != nil {
+			return "", err
+		}
+	}
+	return dest, nil
+}
+
+// fetch downloads a page or an image, returning its detected MIME type
+func (bi *bandcampImporter) fetch(ctx context.Context, u *url.URL) (data []byte, mimeType string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create Bandcamp request: %v", err)
+	}
+	req.Header.Set("User-Agent", discogsUserAgent)
+	res, err := bi.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("request to %s failed: %v", u.Host, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, "", fmt.Errorf("%w: %s not found", errInvalidImportURI, u)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status %s from %s", res.Status, u)
+	}
+	data, err = io.ReadAll(io.LimitReader(res.Body, bi.maxSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %v", u, err)
+	}
+	if int64(len(data)) > bi.maxSize {
+		return nil, "", fmt.Errorf("%s exceeds the size limit of %d bytes", u, bi.maxSize)
+	}
+	return data, http.DetectContentType(data), nil
+}
+
+// parseBandcampURL accepts album and track pages on bandcamp.com subdomains. Artists' custom
+// domains can't be told apart from arbitrary sites, so they're not supported
+func parseBandcampURL(uri string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil || !isHostOf(u.Hostname(), "bandcamp.com") {
+		return nil, fmt.Errorf("%w: %s is not a Bandcamp URL", errInvalidImportURI, uri)
+	}
+	if !strings.HasPrefix(u.Path, "/album/") && !strings.HasPrefix(u.Path, "/track/") {
+		return nil, fmt.Errorf("%w: %s is not a Bandcamp album or track", errInvalidImportURI, uri)
+	}
+	u.Scheme, u.RawQuery, u.Fragment = "https", "", ""
+	return u, nil
+}
+
+// parseBandcampPage extracts the data-tralbum attribute and the ld+json script from the page
+func parseBandcampPage(page []byte) (tralbum bandcampTralbum, ld bandcampLD, err error) {
+	var foundTralbum, foundLD, inLD bool
+	z := html.NewTokenizer(bytes.NewReader(page))
+	for !foundTralbum || !foundLD {
+		switch z.Next() {
+		case html.ErrorToken:
+			if !foundTralbum {
+				return tralbum, ld, fmt.Errorf("no data-tralbum attribute found")
+			}
+			return tralbum, ld, nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			for _, attr := range token.Attr {
+				switch {
+				case attr.Key == "data-tralbum" && !foundTralbum:
+					// the tokenizer already unescapes the attribute values
+					if err = json.Unmarshal([]byte(attr.Val), &tralbum); err != nil {
+						return tralbum, ld, fmt.Errorf("invalid data-tralbum: %v", err)
+					}
+					foundTralbum = true
+				case token.Data == "script" && attr.Key == "type" && attr.Val == "application/ld+json":
+					inLD = true
+				}
+			}
+		case html.TextToken:
+			if inLD && !foundLD {
+				// a broken description isn't fatal, the tralbum has the essentials
+				foundLD = json.Unmarshal(z.Text(), &ld) == nil
+			}
+			inLD = false
+		case html.EndTagToken:
+			inLD = false
+		}
+	}
+	return tralbum, ld, nil
+}
+
+// parseBandcampDate returns the first of the dates that can be parsed
+func parseBandcampDate(dates ...string) time.Time {
+	for _, d := range dates {
+		if t, err := time.Parse(bandcampDate, d); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// bandcampKeywords decodes the tags, which are either a list or a comma-separated string
+func bandcampKeywords(raw json.RawMessage) (tags []string) {
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		var joined string
+		if err = json.Unmarshal(raw, &joined); err != nil {
+			return nil
+		}
+		list = strings.Split(joined, ",")
+	}
+	for _, tag := range list {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// bandcampCover returns the URL of the cover art, constructing it from the art ID if needed
+func bandcampCover(image json.RawMessage, artID int64) string {
+	var cover string
+	if err := json.Unmarshal(image, &cover); err != nil || cover == "" {
+		var images []string
+		if err = json.Unmarshal(image, &images); err == nil && len(images) > 0 {
+			cover = images[0]
+		}
+	}
+	if cover == "" && artID != 0 {
+		cover = fmt.Sprintf("https://f4.bcbits.com/img/a%010d_10.jpg", artID)
+	}
+	return cover
+}
+
+func isHostOf(hostname, domain string) bool {
+	return hostname == domain || strings.HasSuffix(hostname, "."+domain)
+}
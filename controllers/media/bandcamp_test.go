@@ -0,0 +1,179 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/cfg"
+	"codeberg.org/mjh/LibRate/internal/lib/thumbnailer"
+	"codeberg.org/mjh/LibRate/models/media"
+	"codeberg.org/mjh/LibRate/models/static"
+)
+
+// fakeAlbumCatalog remembers the last album added
+type fakeAlbumCatalog struct {
+	fakeCatalog
+	album *media.Album
+}
+
+func (fc *fakeAlbumCatalog) AddAlbum(_ context.Context, album *media.Album) (uuid.UUID, error) {
+	fc.album = album
+	return uuid.Must(uuid.NewV4()), nil
+}
+
+// fakeCovers saves the images to a temporary directory
+type fakeCovers struct {
+	dir        string
+	props      *static.MediaProps
+	thumbnail  string
+	attachedTo uuid.UUID
+}
+
+func (fc *fakeCovers) AddImage(_ context.Context, props *static.MediaProps) (string, int64, error) {
+	fc.props = props
+	return filepath.Join(fc.dir, "static", "img", "music", props.MediaID.String()+"."+props.Ext), 42, nil
+}
+
+func (fc *fakeCovers) SetThumbnail(_ context.Context, _ int64, thumbnail string) error {
+	fc.thumbnail = thumbnail
+	return nil
+}
+
+func (fc *fakeCovers) AttachImage(_ context.Context, mediaID uuid.UUID, _ int64, _ bool) error {
+	fc.attachedTo = mediaID
+	return nil
+}
+
+// redirectTransport sends all requests to the fixture server, regardless of the host
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newTestBandcampImporter serves the pages from testdata/bandcamp and a generated cover art
+func newTestBandcampImporter(t *testing.T, catalog *fakeAlbumCatalog, covers *fakeCovers) *bandcampImporter {
+	t.Helper()
+	var cover bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for x := 0; x < 64; x++ {
+		img.Set(x, x, color.RGBA{R: 200, A: 255})
+	}
+	require.NoError(t, jpeg.Encode(&cover, img, nil))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/img/") {
+			w.Write(cover.Bytes()) //nolint:errcheck // test server
+			return
+		}
+		http.ServeFile(w, r, filepath.Join("testdata", "bandcamp", filepath.FromSlash(r.URL.Path)+".html"))
+	}))
+	t.Cleanup(srv.Close)
+	target, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	log := zerolog.Nop()
+	bi := newBandcampImporter(&cfg.TestConfig, catalog, covers, &log)
+	bi.client = &http.Client{Transport: redirectTransport{target: target}}
+	bi.thumbs = &cfg.ThumbnailConfig{TargetNS: []cfg.ThumbnailerNamespace{
+		{Names: []string{"album_cover"}, MaxSize: thumbnailer.Dims{Width: 32, Height: 32}},
+	}}
+	return bi
+}
+
+func TestBandcampAlbum(t *testing.T) {
+	catalog := &fakeAlbumCatalog{fakeCatalog: fakeCatalog{genres: []media.Genre{{ID: 11, Name: "Ambient"}, {ID: 12, Name: "Drone"}}}}
+	covers := &fakeCovers{dir: t.TempDir()}
+	bi := newTestBandcampImporter(t, catalog, covers)
+
+	album, err := bi.Import(context.Background(), "lain", "https://lowlandcartography.bandcamp.com/album/tidal-archive?from=discover")
+	require.NoError(t, err)
+	require.NotNil(t, album.MediaID)
+
+	assert.Equal(t, "Tidal Archive", album.Name)
+	assert.Equal(t, time.Date(2020, time.March, 13, 0, 0, 0, 0, time.UTC), album.ReleaseDate)
+	require.Len(t, album.AlbumArtists, 1)
+	assert.Equal(t, "Lowland Cartography", album.AlbumArtists[0].Name)
+	assert.Equal(t, []string{"Estuary Tapes"}, catalog.studios)
+	assert.Len(t, album.Genres, 2)
+	require.Len(t, album.Keywords, 2, "tags which are genres shouldn't be duplicated as keywords")
+	assert.Equal(t, "field recordings", album.Keywords[0].Keyword)
+	assert.Equal(t, "rotterdam", album.Keywords[1].Keyword)
+
+	require.Len(t, album.Tracks, 3)
+	assert.Equal(t, "Salt Marsh & Fog", album.Tracks[1].Name)
+	assert.EqualValues(t, 2, album.Tracks[1].Number)
+	assert.Equal(t, 7*time.Minute+2*time.Second, album.Tracks[1].Duration.Sub(time.Time{}))
+	assert.Equal(t, 14*time.Minute+23*time.Second, album.Duration.Time.Sub(time.Time{}))
+
+	require.Len(t, album.ImagePaths, 1)
+	assert.FileExists(t, album.ImagePaths[0])
+	assert.Equal(t, "lain", covers.props.Uploader)
+	assert.Equal(t, "jpg", covers.props.Ext)
+	assert.Len(t, covers.props.Hash, 64)
+	assert.Equal(t, *album.MediaID, covers.attachedTo)
+	require.NotEmpty(t, covers.thumbnail)
+	thumb, err := os.Open(covers.thumbnail)
+	require.NoError(t, err)
+	defer thumb.Close()
+	cfgThumb, err := jpeg.DecodeConfig(thumb)
+	require.NoError(t, err)
+	assert.Equal(t, 32, cfgThumb.Width)
+}
+
+func TestBandcampTrack(t *testing.T) {
+	catalog := &fakeAlbumCatalog{fakeCatalog: fakeCatalog{genres: []media.Genre{{ID: 21, Name: "Synthpop"}}}}
+	bi := newTestBandcampImporter(t, catalog, &fakeCovers{dir: t.TempDir()})
+
+	album, err := bi.Import(context.Background(), "lain", "https://miraodell.bandcamp.com/track/nightswim")
+	require.NoError(t, err)
+
+	assert.Equal(t, "Nightswim", album.Name)
+	assert.Equal(t, time.Date(2023, time.June, 2, 9, 14, 0, 0, time.UTC), album.ReleaseDate,
+		"the publishing date should be used if the release date is missing")
+	require.Len(t, album.AlbumArtists, 1)
+	assert.Equal(t, "individual", album.AlbumArtists[0].ArtistType)
+	assert.Empty(t, catalog.studios, "self-released tracks have no label")
+	assert.Equal(t, []media.Keyword{{Keyword: "oslo"}}, album.Keywords)
+	require.Len(t, album.Tracks, 1)
+	assert.EqualValues(t, 1, album.Tracks[0].Number)
+	assert.Len(t, album.ImagePaths, 1, "the cover should be derived from the art ID")
+}
+
+func TestParseBandcampURL(t *testing.T) {
+	for uri, valid := range map[string]bool{
+		"https://lowlandcartography.bandcamp.com/album/tidal-archive": true,
+		"http://miraodell.bandcamp.com/track/nightswim":               true,
+		"https://lowlandcartography.bandcamp.com/":                    false,
+		"https://bandcamp.com.example.org/album/tidal-archive":        false,
+		"https://music.example.org/album/tidal-archive":               false,
+	} {
+		u, err := parseBandcampURL(uri)
+		if !valid {
+			assert.ErrorIs(t, err, errInvalidImportURI, uri)
+			continue
+		}
+		require.NoError(t, err, uri)
+		assert.Equal(t, "https", u.Scheme)
+	}
+}
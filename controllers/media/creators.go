@@ -8,48 +8,84 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofrs/uuid/v5"
 
+	"codeberg.org/mjh/LibRate/controllers/federation"
 	h "codeberg.org/mjh/LibRate/internal/handlers"
+	"codeberg.org/mjh/LibRate/middleware/security"
 )
 
+// GetCreatorByID retrieves a person, group or studio
+// @Summary Get a creator
+// @Description With Accept: application/activity+json, the ActivityStreams actor is returned instead,
+// @Description so that other instances can reference the creator by IRI
+// @Tags media,artists
+// @Param kind query string true "Kind of the creator" Enums(person, group, studio)
+// @Param id query string true "ID of the creator"
+// @Produce json
+// @Produce application/activity+json
+// @Success 200 {object} h.ResponseHTTP{}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /media/creator [get]
 func (mc *Controller) GetCreatorByID(c *fiber.Ctx) error {
+	c.Vary(fiber.HeaderAccept)
 	if c.Query("kind") == "" || c.Query("id") == "" {
 		return h.Res(c, fiber.StatusBadRequest, "Missing kind or ID")
 	}
 	id := c.Query("id")
-	if c.Query("kind") == "person" {
+	var (
+		creator any
+		toActor func() ([]byte, error)
+	)
+	switch c.Query("kind") {
+	case "person":
 		idInt, err := i64fromID(id)
 		if err != nil {
 			return h.Res(c, fiber.StatusBadRequest, "Invalid ID: "+id)
 		}
-		creator, err := mc.storage.Ps.GetPerson(c.UserContext(), idInt)
+		person, err := mc.storage.Ps.GetPerson(c.UserContext(), idInt)
 		if err != nil {
 			return h.Res(c, fiber.StatusInternalServerError, fmt.Sprintf("Failed to get creator with ID %s: %s", id, err.Error()))
 		}
-
-		creatorJSON, err := json.Marshal(creator)
+		creator = person
+		toActor = func() ([]byte, error) { return mc.fedConv.PersonToActor(&person, id) }
+	case "group":
+		idInt, err := i64fromID(id)
 		if err != nil {
-			return h.Res(c, fiber.StatusInternalServerError, "Failed to marshal creator: "+err.Error())
+			return h.Res(c, fiber.StatusBadRequest, "Invalid ID: "+id)
 		}
-
-		return h.Res(c, fiber.StatusOK, string(creatorJSON))
-	} else if c.Query("kind") == "group" {
+		group, err := mc.storage.Ps.GetGroup(c.UserContext(), int32(idInt))
+		if err != nil {
+			return h.Res(c, fiber.StatusInternalServerError, "Failed to get creator: "+err.Error())
+		}
+		creator = group
+		toActor = func() ([]byte, error) { return mc.fedConv.GroupToActor(&group, id) }
+	case "studio":
 		idInt, err := i64fromID(id)
 		if err != nil {
 			return h.Res(c, fiber.StatusBadRequest, "Invalid ID: "+id)
 		}
-		creator, err := mc.storage.Ps.GetGroup(c.UserContext(), int32(idInt))
+		studio, err := mc.storage.Ps.GetStudio(c.UserContext(), int32(idInt))
 		if err != nil {
 			return h.Res(c, fiber.StatusInternalServerError, "Failed to get creator: "+err.Error())
 		}
+		creator = studio
+		toActor = func() ([]byte, error) { return mc.fedConv.StudioToActor(studio) }
+	default:
+		return h.Res(c, fiber.StatusBadRequest, "Invalid kind: "+c.Query("kind"))
+	}
 
-		creatorJSON, err := json.Marshal(creator)
+	if security.WantsActivityStreams(c) {
+		doc, err := toActor()
 		if err != nil {
-			return h.Res(c, fiber.StatusInternalServerError, "Failed to marshal creator: "+err.Error())
+			return handleInternalError(mc.storage.Log, c, "Failed to convert creator", err)
 		}
-
-		return h.Res(c, fiber.StatusOK, string(creatorJSON))
+		return federation.SendDocument(c, doc)
+	}
+	creatorJSON, err := json.Marshal(creator)
+	if err != nil {
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to marshal creator: "+err.Error())
 	}
-	return h.Res(c, fiber.StatusBadRequest, "Invalid kind: "+c.Query("kind"))
+	return h.Res(c, fiber.StatusOK, string(creatorJSON))
 }
 
 // @Summary Get the cast of the media with given ID
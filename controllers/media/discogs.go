@@ -0,0 +1,284 @@
+package media
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"codeberg.org/mjh/LibRate/cfg"
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+const (
+	discogsAPI = "https://api.discogs.com"
+	// Discogs rejects requests without a descriptive user agent
+	discogsUserAgent = "LibRate/1.0 +https://codeberg.org/mjh/LibRate"
+	// the pseudo-artist of compilations
+	discogsVarious = 194
+)
+
+var (
+	// matches both the current (/release/123-Artist-Title) and the legacy
+	// (/Artist-Title/release/123) URL formats, with an optional language prefix
+	discogsURLPattern = regexp.MustCompile(`^/(?:[^/]+/)*(release|master)/(\d+)`)
+	// Discogs disambiguates artists and labels with the same name by a numeric suffix, e.g. "Tool (2)"
+	discogsSuffix = regexp.MustCompile(`\s+\(\d+\)$`)
+)
+
+type (
+	discogsImporter struct {
+		baseURL string
+		token   string
+		client  *http.Client
+		catalog catalogResolver
+		log     *zerolog.Logger
+	}
+
+	discogsRelease struct {
+		ID        int64           `json:"id"`
+		Title     string          `json:"title"`
+		Artists   []discogsArtist `json:"artists"`
+		Labels    []discogsLabel  `json:"labels"`
+		Genres    []string        `json:"genres"`
+		Styles    []string        `json:"styles"`
+		Released  string          `json:"released"`
+		Year      int             `json:"year"`
+		Tracklist []discogsTrack  `json:"tracklist"`
+	}
+
+	discogsMaster struct {
+		ID          int64 `json:"id"`
+		MainRelease int64 `json:"main_release"`
+	}
+
+	discogsArtist struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+		// set only when fetching the artist itself
+		Members []discogsArtist `json:"members,omitempty"`
+	}
+
+	discogsLabel struct {
+		ID    int64  `json:"id"`
+		Name  string `json:"name"`
+		Catno string `json:"catno"`
+	}
+
+	discogsTrack struct {
+		Position string `json:"position"`
+		// track, heading or index, the latter holding the sub_tracks of a suite etc.
+		Type      string         `json:"type_"`
+		Title     string         `json:"title"`
+		Duration  string         `json:"duration"`
+		SubTracks []discogsTrack `json:"sub_tracks,omitempty"`
+	}
+)
+
+var errInvalidImportURI = errors.New("invalid import URI")
+
+func newDiscogsImporter(conf *cfg.Config, catalog catalogResolver, log *zerolog.Logger) *discogsImporter {
+	return &discogsImporter{
+		baseURL: discogsAPI,
+		token:   conf.External.DiscogsToken,
+		client:  &http.Client{Timeout: 15 * time.Second},
+		catalog: catalog,
+		log:     log,
+	}
+}
+
+// withCatalog returns a copy of the importer which resolves through the given catalog
+func (di *discogsImporter) withCatalog(catalog catalogResolver) *discogsImporter {
+	clone := *di
+	clone.catalog = catalog
+	return &clone
+}
+
+// Import converts a Discogs release or master release to an album. The artists and
+// the label are added to the database if they're not there yet
+func (di *discogsImporter) Import(ctx context.Context, uri string) (*media.Album, error) {
+	kind, id, err := parseDiscogsURL(uri)
+	if err != nil {
+		return nil, err
+	}
+	if kind == "master" {
+		var master discogsMaster
+		if err = di.get(ctx, "/masters/"+id, &master); err != nil {
+			return nil, err
+		}
+		id = strconv.FormatInt(master.MainRelease, 10)
+	}
+	var release discogsRelease
+	if err = di.get(ctx, "/releases/"+id, &release); err != nil {
+		return nil, err
+	}
+
+	album := &media.Album{
+		Name:        release.Title,
+		ReleaseDate: parseDiscogsDate(release.Released, release.Year),
+	}
+	if album.AlbumArtists, err = di.resolveArtists(ctx, release.Artists); err != nil {
+		return nil, err
+	}
+	genres := append(release.Genres, release.Styles...)
+	if album.Genres, err = di.catalog.FindGenres(ctx, "music", genres); err != nil {
+		return nil, err
+	}
+	di.log.Debug().Msgf("matched %d of %d Discogs genres and styles of %s", len(album.Genres), len(genres), uri)
+	if label := mainLabel(release.Labels); label != "" {
+		if album.Studio, err = di.catalog.ResolveStudio(ctx, label, media.Music); err != nil {
+			return nil, err
+		}
+	}
+
+	var total time.Duration
+	album.Tracks, total = discogsTracks(release.Tracklist)
+	if total > 0 {
+		album.Duration.Time, album.Duration.Valid = time.Time{}.Add(total), true
+	}
+	return album, nil
+}
+
+// resolveArtists finds or creates the credited artists. Only the artist resource tells
+// whether it's a group, by listing its members
+func (di *discogsImporter) resolveArtists(ctx context.Context, credited []discogsArtist) ([]media.AlbumArtist, error) {
+	artists := make([]media.AlbumArtist, 0, len(credited))
+	for i := range credited {
+		if credited[i].ID == discogsVarious {
+			continue
+		}
+		var details discogsArtist
+		if err := di.get(ctx, "/artists/"+strconv.FormatInt(credited[i].ID, 10), &details); err != nil {
+			return nil, err
+		}
+		artist, err := di.catalog.ResolveArtist(ctx, cleanDiscogsName(credited[i].Name), len(details.Members) > 0)
+		if err != nil {
+			return nil, err
+		}
+		artists = append(artists, *artist)
+	}
+	return artists, nil
+}
+
+func (di *discogsImporter) get(ctx context.Context, path string, dest any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, di.baseURL+path, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("failed to create Discogs request: %v", err)
+	}
+	req.Header.Set("User-Agent", discogsUserAgent)
+	req.Header.Set("Accept", "application/vnd.discogs.v2.discogs+json")
+	if di.token != "" {
+		req.Header.Set("Authorization", "Discogs token="+di.token)
+	}
+	res, err := di.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to Discogs failed: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s not found on Discogs", errInvalidImportURI, path)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s from Discogs for %s", res.Status, path)
+	}
+	if err = json.NewDecoder(io.LimitReader(res.Body, 4<<20)).Decode(dest); err != nil {
+		return fmt.Errorf("failed to decode Discogs response for %s: %v", path, err)
+	}
+	return nil
+}
+
+// parseDiscogsURL extracts the kind (release or master) and the ID from a Discogs URL
+func parseDiscogsURL(uri string) (kind, id string, err error) {
+	u, err := url.Parse(uri)
+	if err != nil || (u.Hostname() != "discogs.com" && !strings.HasSuffix(u.Hostname(), ".discogs.com")) {
+		return "", "", fmt.Errorf("%w: %s is not a Discogs URL", errInvalidImportURI, uri)
+	}
+	match := discogsURLPattern.FindStringSubmatch(u.Path)
+	if match == nil {
+		return "", "", fmt.Errorf("%w: %s is not a Discogs release or master release", errInvalidImportURI, uri)
+	}
+	return match[1], match[2], nil
+}
+
+func cleanDiscogsName(name string) string {
+	return discogsSuffix.ReplaceAllString(strings.TrimSpace(name), "")
+}
+
+// mainLabel returns the name of the first label, unless the release is self-released
+func mainLabel(labels []discogsLabel) string {
+	for i := range labels {
+		name := cleanDiscogsName(labels[i].Name)
+		if name != "" && !strings.HasPrefix(name, "Not On Label") {
+			return name
+		}
+	}
+	return ""
+}
+
+// parseDiscogsDate parses the release date, which can be partial, e.g. 2001-05-00 or 2001-00-00
+func parseDiscogsDate(released string, year int) time.Time {
+	parts := strings.Split(released, "-")
+	numbers := make([]int, 3)
+	for i := 0; i < len(parts) && i < 3; i++ {
+		numbers[i], _ = strconv.Atoi(parts[i])
+	}
+	if numbers[0] == 0 {
+		numbers[0] = year
+	}
+	if numbers[0] == 0 {
+		return time.Time{}
+	}
+	return time.Date(numbers[0], time.Month(max(numbers[1], 1)), max(numbers[2], 1), 0, 0, 0, 0, time.UTC)
+}
+
+// parseDiscogsDuration parses durations in the m:ss or h:mm:ss format
+func parseDiscogsDuration(duration string) time.Duration {
+	if duration == "" {
+		return 0
+	}
+	var total time.Duration
+	for _, part := range strings.Split(duration, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		total = total*60 + time.Duration(n)
+	}
+	return total * time.Second
+}
+
+// discogsTracks flattens the tracklist, skipping headings and expanding index tracks
+// into their sub-tracks. It also returns the total duration
+func discogsTracks(tracklist []discogsTrack) (tracks []media.Track, total time.Duration) {
+	for i := range tracklist {
+		switch tracklist[i].Type {
+		case "heading":
+			continue
+		case "index":
+			sub, subTotal := discogsTracks(tracklist[i].SubTracks)
+			for j := range sub {
+				sub[j].Number = int16(len(tracks) + 1)
+				tracks = append(tracks, sub[j])
+			}
+			total += subTotal
+		default:
+			duration := parseDiscogsDuration(tracklist[i].Duration)
+			total += duration
+			tracks = append(tracks, media.Track{
+				Name:     tracklist[i].Title,
+				Duration: time.Time{}.Add(duration),
+				Number:   int16(len(tracks) + 1),
+			})
+		}
+	}
+	return tracks, total
+}
@@ -0,0 +1,160 @@
+package media
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/cfg"
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+// fakeCatalog knows a few genres and records the artists and studios it was asked to resolve
+type fakeCatalog struct {
+	genres  []media.Genre
+	artists []media.AlbumArtist
+	studios []string
+}
+
+func (fc *fakeCatalog) FindGenres(_ context.Context, _ string, names []string) (genres []media.Genre, err error) {
+	for _, g := range fc.genres {
+		if slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(name, g.Name) }) {
+			genres = append(genres, g)
+		}
+	}
+	return genres, nil
+}
+
+func (fc *fakeCatalog) ResolveArtist(_ context.Context, name string, group bool) (*media.AlbumArtist, error) {
+	artist := media.AlbumArtist{ID: uuid.Must(uuid.NewV4()), Name: name, ArtistType: "individual"}
+	if group {
+		artist.ArtistType = "group"
+	}
+	fc.artists = append(fc.artists, artist)
+	return &artist, nil
+}
+
+func (fc *fakeCatalog) ResolveStudio(_ context.Context, name string, _ media.StudioKind) (*media.Studio, error) {
+	fc.studios = append(fc.studios, name)
+	return &media.Studio{ID: int32(len(fc.studios)), Name: name}, nil
+}
+
+// newDiscogsFixtures serves the recorded API responses from testdata/discogs
+func newDiscogsFixtures(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("User-Agent"), "LibRate") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join("testdata", "discogs", filepath.FromSlash(r.URL.Path)+".json"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestDiscogsImporter(t *testing.T, catalog *fakeCatalog) *discogsImporter {
+	log := zerolog.Nop()
+	di := newDiscogsImporter(&cfg.TestConfig, catalog, &log)
+	di.baseURL = newDiscogsFixtures(t).URL
+	return di
+}
+
+func TestDiscogsRelease(t *testing.T) {
+	catalog := &fakeCatalog{genres: []media.Genre{{ID: 1, Name: "Rock"}, {ID: 7, Name: "Progressive Rock"}, {ID: 9, Name: "Prog Rock"}}}
+	di := newTestDiscogsImporter(t, catalog)
+
+	album, err := di.Import(context.Background(), "https://www.discogs.com/release/2039113-Tool-Lateralus")
+	require.NoError(t, err)
+
+	assert.Equal(t, "Lateralus", album.Name)
+	assert.Equal(t, time.Date(2001, time.May, 15, 0, 0, 0, 0, time.UTC), album.ReleaseDate)
+	require.Len(t, album.AlbumArtists, 1)
+	assert.Equal(t, "Tool", album.AlbumArtists[0].Name, "the disambiguation suffix should be removed")
+	assert.Equal(t, "group", album.AlbumArtists[0].ArtistType)
+	assert.ElementsMatch(t, []int64{1, 9}, []int64{album.Genres[0].ID, album.Genres[1].ID})
+	require.NotNil(t, album.Studio)
+	assert.Equal(t, "Volcano Entertainment", album.Studio.Name)
+
+	require.Len(t, album.Tracks, 13)
+	assert.Equal(t, "Schism", album.Tracks[4].Name)
+	assert.EqualValues(t, 5, album.Tracks[4].Number)
+	assert.Equal(t, 6*time.Minute+47*time.Second, album.Tracks[4].Duration.Sub(time.Time{}))
+	require.True(t, album.Duration.Valid)
+	assert.Equal(t, 78*time.Minute+51*time.Second, album.Duration.Time.Sub(time.Time{}))
+}
+
+func TestDiscogsMaster(t *testing.T) {
+	catalog := &fakeCatalog{}
+	di := newTestDiscogsImporter(t, catalog)
+
+	album, err := di.Import(context.Background(), "https://www.discogs.com/master/545036-Nils-Frahm-Spaces")
+	require.NoError(t, err)
+
+	assert.Equal(t, "Spaces", album.Name)
+	assert.Equal(t, time.Date(2013, time.November, 1, 0, 0, 0, 0, time.UTC), album.ReleaseDate)
+	require.Len(t, album.AlbumArtists, 1)
+	assert.Equal(t, "individual", album.AlbumArtists[0].ArtistType)
+	assert.Empty(t, album.Genres)
+	assert.Equal(t, []string{"Erased Tapes Records"}, catalog.studios)
+
+	names := make([]string, len(album.Tracks))
+	for i := range album.Tracks {
+		names[i] = album.Tracks[i].Name
+		assert.EqualValues(t, i+1, album.Tracks[i].Number)
+	}
+	assert.Equal(t, []string{
+		"An Aborted Beginning",
+		"Says",
+		"Improvisation For Coughs And A Cell Phone",
+		"Over There, It's Raining",
+		"For - Peter - Toilet Brushes - More",
+	}, names, "headings should be skipped and index tracks expanded")
+}
+
+func TestDiscogsNotFound(t *testing.T) {
+	di := newTestDiscogsImporter(t, &fakeCatalog{})
+	_, err := di.Import(context.Background(), "https://www.discogs.com/release/1-Missing")
+	assert.ErrorIs(t, err, errInvalidImportURI)
+}
+
+func TestParseDiscogsURL(t *testing.T) {
+	cases := []struct {
+		uri, kind, id string
+		valid         bool
+	}{
+		{uri: "https://www.discogs.com/release/2039113-Tool-Lateralus", kind: "release", id: "2039113", valid: true},
+		{uri: "https://www.discogs.com/de/master/545036-Nils-Frahm-Spaces", kind: "master", id: "545036", valid: true},
+		{uri: "https://www.discogs.com/Tool-Lateralus/release/2039113", kind: "release", id: "2039113", valid: true},
+		{uri: "https://www.discogs.com/artist/37060-Tool-2"},
+		{uri: "https://notdiscogs.com/release/2039113"},
+	}
+	for _, tc := range cases {
+		kind, id, err := parseDiscogsURL(tc.uri)
+		if !tc.valid {
+			assert.ErrorIs(t, err, errInvalidImportURI, tc.uri)
+			continue
+		}
+		require.NoError(t, err, tc.uri)
+		assert.Equal(t, tc.kind, kind)
+		assert.Equal(t, tc.id, id)
+	}
+}
+
+func TestParseDiscogsDate(t *testing.T) {
+	assert.Equal(t, time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC), parseDiscogsDate("2001-00-00", 2001))
+	assert.Equal(t, time.Date(1999, time.January, 1, 0, 0, 0, 0, time.UTC), parseDiscogsDate("", 1999))
+	assert.True(t, parseDiscogsDate("", 0).IsZero())
+	assert.Equal(t, time.Hour+2*time.Minute+3*time.Second, parseDiscogsDuration("1:02:03"))
+	assert.Zero(t, parseDiscogsDuration("?"))
+}
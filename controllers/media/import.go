@@ -3,35 +3,70 @@ package media
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid/v5"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/samber/lo"
 	spotifyauth "github.com/zmb3/spotify/v2/auth"
 	"golang.org/x/oauth2/clientcredentials"
 
 	"codeberg.org/mjh/LibRate/db"
+	h "codeberg.org/mjh/LibRate/internal/handlers"
+	"codeberg.org/mjh/LibRate/internal/lib/audiotags"
 	"codeberg.org/mjh/LibRate/models/media"
 
 	"github.com/zmb3/spotify/v2"
 )
 
-type ImportSource struct {
-	Name string `json:"name" validate:"required"`
-	URI  string `json:"uri" validate:"required"`
-}
+type (
+	ImportSource struct {
+		Name string `json:"name" validate:"required"`
+		URI  string `json:"uri" validate:"required"`
+	}
+
+	// catalogResolver maps the artists, labels and genres found in import sources onto the catalog
+	catalogResolver interface {
+		FindGenres(ctx context.Context, kind string, names []string) ([]media.Genre, error)
+		ResolveArtist(ctx context.Context, name string, group bool) (*media.AlbumArtist, error)
+		ResolveStudio(ctx context.Context, name string, kind media.StudioKind) (*media.Studio, error)
+	}
+
+	// albumSaver also adds the imported albums to the catalog
+	albumSaver interface {
+		catalogResolver
+		AddAlbum(ctx context.Context, album *media.Album) (uuid.UUID, error)
+	}
+
+	storageCatalog struct {
+		*media.Storage
+		*media.PeopleStorage
+	}
+)
 
 func (mc *Controller) GetImportSources(c *fiber.Ctx) error {
 	return c.JSON(mc.conf.External.ImportSources)
 }
 
 // ImportWeb handles the import of media from 3rd party sources
-// Importing from the local filesystem is handled by the client since
-// 1. Uploading music files to the server would unnecessarily overload the server
-// 2. Although processing ID3 tags may be faster on the server, one has to consider the
-// round-trip time of the request, which would be much slower than processing the tags on the client
+// Local files are preferably read by the client, which sends only the tag dumps to ImportTags,
+// since uploading whole music files would unnecessarily overload the server
+// @Summary Import from a 3rd party source
+// @Description Starts fetching the album, film, book or person in the background. Nothing is added
+// @Description to the catalog until the preview of the job, listing the new and matched artists, genres and tracks,
+// @Description is confirmed. Spotify albums are still returned right away, without saving them
+// @Tags media,import
+// @Accept json
+// @Produce json
+// @Param source body ImportSource true "Source name and URI"
+// @Success 202 {object} ImportJob
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Router /media/import [post]
 func (mc *Controller) ImportWeb(c *fiber.Ctx) error {
 	var source ImportSource
 	if err := c.BodyParser(&source); err != nil || !lo.Contains(mc.conf.External.ImportSources, source.Name) {
@@ -40,22 +75,68 @@ func (mc *Controller) ImportWeb(c *fiber.Ctx) error {
 	switch source.Name {
 	case "spotify":
 		return mc.importSpotify(c, source.URI)
-	case "discogs":
-		return mc.importDiscogs(c, source)
 	case "lastfm":
 		return mc.importLastFM(c, source)
-	case "listenbrainz":
-		return mc.importListenBrainz(c, source)
-	case "bandcamp":
-		return mc.importBandcamp(c, source)
-	case "mediawiki":
-		return mc.importMW(c, source)
 	case "rym":
 		return mc.importRYM(c, source)
 	case "pitchfork":
 		return mc.importPF(c, source)
+	}
+
+	memberName := c.Locals("jwtToken").(*jwt.Token).Claims.(jwt.MapClaims)["member_name"].(string)
+	task, err := mc.importTask(memberName, source)
+	if err != nil {
+		return handleBadRequest(mc.storage.Log, c, err.Error())
+	}
+	job := mc.imports.Start(memberName, source.Name, source.URI, task)
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// importTask checks the URI and returns the task importing it
+func (mc *Controller) importTask(memberName string, source ImportSource) (importTask, error) {
+	uri := source.URI
+	switch source.Name {
+	case "discogs":
+		if _, _, err := parseDiscogsURL(uri); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, catalog *stagingCatalog) (any, error) {
+			return mc.discogs.withCatalog(catalog).Import(ctx, uri)
+		}, nil
+	case "listenbrainz":
+		// either a MusicBrainz release (or release group), or a ListenBrainz profile, whose
+		// listening history is imported as rating placeholders
+		if isListenBrainzURI(uri) {
+			if _, err := parseListenBrainzURI(uri); err != nil {
+				return nil, err
+			}
+			return func(ctx context.Context, catalog *stagingCatalog) (any, error) {
+				return mc.musicBrainz.withCatalog(catalog).ImportListens(ctx, memberName, uri)
+			}, nil
+		}
+		if _, _, err := parseMusicBrainzURI(uri); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, catalog *stagingCatalog) (any, error) {
+			return mc.musicBrainz.withCatalog(catalog).Import(ctx, uri)
+		}, nil
+	case "bandcamp":
+		if _, err := parseBandcampURL(uri); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, catalog *stagingCatalog) (any, error) {
+			return mc.bandcamp.withCatalog(catalog).Import(ctx, memberName, uri)
+		}, nil
+	case "mediawiki":
+		// a Wikidata item, or the item of a Wikipedia article, mapped onto a film, book or person
+		if _, _, err := parseWikidataURI(uri); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, catalog *stagingCatalog) (any, error) {
+			return mc.wikidata.withCatalog(catalog).Import(ctx, uri)
+		}, nil
 	default:
-		return handleBadRequest(mc.storage.Log, c, "Invalid source name")
+		return nil, errors.New("invalid source name")
 	}
 }
 
@@ -221,28 +302,188 @@ func (mc *Controller) lookupSpotifyArtists(c *fiber.Ctx, artists []spotify.Simpl
 	return dbArtists, nil
 }
 
-func (mc *Controller) importDiscogs(c *fiber.Ctx, source ImportSource) error {
-	return c.SendStatus(fiber.StatusNotImplemented)
+// importLastFM and importRYM only point to ImportLibrary, since neither service has a public
+// API for reading a member's library
+func (mc *Controller) importLastFM(c *fiber.Ctx, source ImportSource) error {
+	return handleBadRequest(mc.storage.Log, c, "Last.fm scrobbles can only be imported from CSV exports, use /api/media/import/library")
 }
 
-func (mc *Controller) importLastFM(c *fiber.Ctx, source ImportSource) error {
-	return c.SendStatus(fiber.StatusNotImplemented)
+func (mc *Controller) importRYM(c *fiber.Ctx, source ImportSource) error {
+	return handleBadRequest(mc.storage.Log, c, "RateYourMusic ratings can only be imported from CSV exports, use /api/media/import/library")
 }
 
-func (mc *Controller) importListenBrainz(c *fiber.Ctx, source ImportSource) error {
-	return c.SendStatus(fiber.StatusNotImplemented)
+// ImportLibrary starts importing a RateYourMusic ratings or Last.fm scrobbles export
+// @Summary Import a library export
+// @Description Bulk import of the CSV exports of RateYourMusic ratings or Last.fm scrobbles and loved tracks.
+// @Description The albums and tracks found in the catalog are rated, or marked as listened to,
+// @Description the rest is saved as pending submissions. The import runs in the background, its progress
+// @Description can be polled with the returned job ID
+// @Tags media,import
+// @Accept multipart/form-data
+// @Produce json
+// @Param source formData string true "Name of the service" Enums(rym,lastfm)
+// @Param file formData file true "CSV export"
+// @Success 202 {object} LibraryImportJob
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /media/import/library [post]
+func (mc *Controller) ImportLibrary(c *fiber.Ctx) error {
+	source := c.FormValue("source")
+	if !lo.Contains(mc.conf.External.ImportSources, source) {
+		return handleBadRequest(mc.storage.Log, c, "Invalid source name")
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		return handleBadRequest(mc.storage.Log, c, "The export file is missing")
+	}
+	export, err := file.Open()
+	if err != nil {
+		return handleInternalError(mc.storage.Log, c, "failed to read the export", err)
+	}
+	defer export.Close()
+
+	memberName := c.Locals("jwtToken").(*jwt.Token).Claims.(jwt.MapClaims)["member_name"].(string)
+	job, err := mc.library.Start(memberName, source, export)
+	if err != nil {
+		if errors.Is(err, errInvalidExport) {
+			return handleBadRequest(mc.storage.Log, c, err.Error())
+		}
+		return handleInternalError(mc.storage.Log, c, "failed to start the import", err)
+	}
+	return c.Status(fiber.StatusAccepted).JSON(job)
 }
 
-func (mc *Controller) importBandcamp(c *fiber.Ctx, source ImportSource) error {
-	return c.SendStatus(fiber.StatusNotImplemented)
+// GetLibraryImport reports the progress of a library import
+// @Summary Get the progress of a library import
+// @Tags media,import
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} LibraryImportJob
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Router /media/import/library/{id} [get]
+func (mc *Controller) GetLibraryImport(c *fiber.Ctx) error {
+	id, err := uuid.FromString(c.Params("id"))
+	if err != nil {
+		return handleBadRequest(mc.storage.Log, c, "Invalid job ID")
+	}
+	memberName := c.Locals("jwtToken").(*jwt.Token).Claims.(jwt.MapClaims)["member_name"].(string)
+	job, ok := mc.library.Job(memberName, id)
+	if !ok {
+		return h.Res(c, fiber.StatusNotFound, "Import not found")
+	}
+	return c.JSON(job)
 }
 
-func (mc *Controller) importMW(c *fiber.Ctx, source ImportSource) error {
-	return c.SendStatus(fiber.StatusNotImplemented)
+// ImportTags starts importing the albums made up by the uploaded audio files or tag dumps
+// @Summary Import albums from audio tags
+// @Description Reads the ID3v2, ID3v1, FLAC or Ogg Vorbis/Opus tags of the uploaded files and groups the tracks
+// @Description into albums by the album artist and title. Instead of the audio files, which must be smaller than
+// @Description the upload limit, clients can send JSON dumps of the tags (.json files with an object or an array)
+// @Tags media,import
+// @Accept multipart/form-data
+// @Produce json
+// @Param files formData file true "Audio files or JSON tag dumps"
+// @Success 202 {object} ImportJob
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /media/import/tags [post]
+func (mc *Controller) ImportTags(c *fiber.Ctx) error {
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["files"]) == 0 {
+		return handleBadRequest(mc.storage.Log, c, "No files were uploaded")
+	}
+	var tracks []audiotags.Tags
+	for _, file := range form.File["files"] {
+		source := "id3"
+		if strings.EqualFold(filepath.Ext(file.Filename), ".json") {
+			source = "json"
+		}
+		if !lo.Contains(mc.conf.External.ImportSources, source) {
+			return handleBadRequest(mc.storage.Log, c, "Importing from "+source+" is disabled")
+		}
+		if file.Size > mc.conf.Fiber.MaxUploadSize {
+			return handleBadRequest(mc.storage.Log, c, file.Filename+" is too large, upload only the tags")
+		}
+		f, err := file.Open()
+		if err != nil {
+			return handleInternalError(mc.storage.Log, c, "failed to read "+file.Filename, err)
+		}
+		read, err := readTags(file.Filename, f)
+		f.Close()
+		if err != nil {
+			if errors.Is(err, errInvalidTags) {
+				return handleBadRequest(mc.storage.Log, c, err.Error())
+			}
+			return handleInternalError(mc.storage.Log, c, "failed to read "+file.Filename, err)
+		}
+		tracks = append(tracks, read...)
+	}
+
+	memberName := c.Locals("jwtToken").(*jwt.Token).Claims.(jwt.MapClaims)["member_name"].(string)
+	job := mc.imports.Start(memberName, "tags", "", func(ctx context.Context, catalog *stagingCatalog) (any, error) {
+		return mc.tags.withCatalog(catalog).Import(ctx, tracks)
+	})
+	return c.Status(fiber.StatusAccepted).JSON(job)
 }
 
-func (mc *Controller) importRYM(c *fiber.Ctx, source ImportSource) error {
-	return c.SendStatus(fiber.StatusNotImplemented)
+// GetImportJob reports the state of an import and, once the source is fetched, its preview
+// @Summary Get an import
+// @Description The preview lists the artists, labels, genres, albums and tracks found in the source,
+// @Description each either new or matched with the catalog. Genres which aren't in the catalog are skipped
+// @Tags media,import
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} ImportJob
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Router /media/import/jobs/{id} [get]
+func (mc *Controller) GetImportJob(c *fiber.Ctx) error {
+	return mc.handleImportJob(c, mc.imports.Job)
+}
+
+// ConfirmImport commits a previewed import to the catalog
+// @Summary Confirm an import
+// @Description Adds the new artists, labels and albums of the previewed import. The commit runs in the background
+// @Tags media,import
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 202 {object} ImportJob
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 409 {object} h.ResponseHTTP{}
+// @Router /media/import/jobs/{id}/confirm [post]
+func (mc *Controller) ConfirmImport(c *fiber.Ctx) error {
+	c.Status(fiber.StatusAccepted)
+	return mc.handleImportJob(c, mc.imports.Confirm)
+}
+
+// CancelImport stops an import which is still being fetched or committed, or discards its preview
+// @Summary Cancel an import
+// @Tags media,import
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} ImportJob
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 409 {object} h.ResponseHTTP{}
+// @Router /media/import/jobs/{id} [delete]
+func (mc *Controller) CancelImport(c *fiber.Ctx) error {
+	return mc.handleImportJob(c, mc.imports.Cancel)
+}
+
+func (mc *Controller) handleImportJob(c *fiber.Ctx, action func(memberName string, id uuid.UUID) (*ImportJob, error)) error {
+	id, err := uuid.FromString(c.Params("id"))
+	if err != nil {
+		return handleBadRequest(mc.storage.Log, c, "Invalid job ID")
+	}
+	memberName := c.Locals("jwtToken").(*jwt.Token).Claims.(jwt.MapClaims)["member_name"].(string)
+	job, err := action(memberName, id)
+	switch {
+	case errors.Is(err, errJobNotFound):
+		return h.Res(c, fiber.StatusNotFound, "Import not found")
+	case errors.Is(err, errJobState):
+		return h.Res(c, fiber.StatusConflict, err.Error())
+	case err != nil:
+		return handleInternalError(mc.storage.Log, c, "failed to update the import", err)
+	}
+	return c.JSON(job)
 }
 
 func (mc *Controller) importPF(c *fiber.Ctx, source ImportSource) error {
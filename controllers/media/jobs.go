@@ -0,0 +1,230 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// fetching includes the rate limited requests for the artists and releases
+	importFetchTimeout  = 10 * time.Minute
+	importCommitTimeout = 10 * time.Minute
+	// previews which are neither confirmed nor cancelled are discarded after this long
+	importPreviewExpiry = time.Hour
+	// finished jobs are forgotten after this long
+	importJobRetention = 24 * time.Hour
+
+	jobFetching   = "fetching"
+	jobPreview    = "preview"
+	jobCommitting = "committing"
+	jobDone       = "done"
+	jobFailed     = "failed"
+	jobCancelled  = "cancelled"
+)
+
+var (
+	errJobNotFound = errors.New("import not found")
+	// returned when confirming or cancelling a job which isn't in the right state
+	errJobState = errors.New("invalid import state")
+)
+
+type (
+	// importTask fetches and normalizes the import source, resolving it through the staging
+	// catalog, and returns the imported item(s)
+	importTask func(ctx context.Context, catalog *stagingCatalog) (any, error)
+
+	importJobs struct {
+		catalog importCatalog
+		log     *zerolog.Logger
+		mu      sync.Mutex
+		jobs    map[uuid.UUID]*ImportJob
+	}
+
+	// ImportJob is an import from a 3rd party source. Nothing is added to the catalog until
+	// the member confirms the preview
+	ImportJob struct {
+		ID     uuid.UUID `json:"id"`
+		Source string    `json:"source" example:"musicbrainz"`
+		URI    string    `json:"uri,omitempty" example:"https://musicbrainz.org/release/2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21"`
+		Status string    `json:"status" enum:"fetching,preview,committing,done,failed,cancelled" example:"preview"`
+		// set once the source is fetched
+		Preview *ImportPreview `json:"preview,omitempty"`
+		// the imported item(s). The new artists and labels have temporary IDs until the import is committed
+		Result   any        `json:"result,omitempty"`
+		Error    string     `json:"error,omitempty"`
+		Started  time.Time  `json:"started"`
+		Finished *time.Time `json:"finished,omitempty"`
+		member   string
+		// stops the fetch or the commit
+		cancel    context.CancelFunc
+		staging   *stagingCatalog
+		previewed time.Time
+	}
+)
+
+func newImportJobs(catalog importCatalog, log *zerolog.Logger) *importJobs {
+	return &importJobs{
+		catalog: catalog,
+		log:     log,
+		jobs:    make(map[uuid.UUID]*ImportJob),
+	}
+}
+
+// Start runs the task in the background. Once it's done, the job waits for confirmation
+// with the preview of the changes
+func (ij *importJobs) Start(memberName, source, uri string, task importTask) *ImportJob {
+	// the job outlives the request which started it
+	ctx, cancel := context.WithTimeout(context.Background(), importFetchTimeout)
+	job := &ImportJob{
+		ID:      uuid.Must(uuid.NewV4()),
+		Source:  source,
+		URI:     uri,
+		Status:  jobFetching,
+		Started: time.Now(),
+		member:  memberName,
+		cancel:  cancel,
+		staging: newStagingCatalog(ij.catalog),
+	}
+	staging := job.staging
+	ij.mu.Lock()
+	ij.prune()
+	ij.jobs[job.ID] = job
+	snapshot := job.snapshot()
+	ij.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		// only this goroutine uses the staging catalog until the preview is ready
+		result, err := task(ctx, staging)
+
+		ij.mu.Lock()
+		defer ij.mu.Unlock()
+		if job.Status != jobFetching {
+			return
+		}
+		if err != nil {
+			ij.fail(job, err)
+			return
+		}
+		job.Status, job.Result, job.Preview = jobPreview, result, &staging.preview
+		job.previewed = time.Now()
+	}()
+	return snapshot
+}
+
+// Job returns the state of an import started by the member
+func (ij *importJobs) Job(memberName string, id uuid.UUID) (*ImportJob, error) {
+	ij.mu.Lock()
+	defer ij.mu.Unlock()
+	job, err := ij.get(memberName, id)
+	if err != nil {
+		return nil, err
+	}
+	return job.snapshot(), nil
+}
+
+// Confirm commits the previewed import in the background
+func (ij *importJobs) Confirm(memberName string, id uuid.UUID) (*ImportJob, error) {
+	ij.mu.Lock()
+	defer ij.mu.Unlock()
+	job, err := ij.get(memberName, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != jobPreview {
+		return nil, fmt.Errorf("%w: only previewed imports can be confirmed, this one is %s", errJobState, job.Status)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), importCommitTimeout)
+	job.Status, job.cancel = jobCommitting, cancel
+	staging, result := job.staging, job.Result
+
+	go func() {
+		defer cancel()
+		err := staging.commit(ctx, result)
+
+		ij.mu.Lock()
+		defer ij.mu.Unlock()
+		if job.Status != jobCommitting {
+			return
+		}
+		if err != nil {
+			ij.fail(job, err)
+			return
+		}
+		job.finish(jobDone)
+	}()
+	return job.snapshot(), nil
+}
+
+// Cancel stops fetching the source or discards the preview. Cancelling a commit rolls back
+// the album being saved, but the ones saved before it are kept
+func (ij *importJobs) Cancel(memberName string, id uuid.UUID) (*ImportJob, error) {
+	ij.mu.Lock()
+	defer ij.mu.Unlock()
+	job, err := ij.get(memberName, id)
+	if err != nil {
+		return nil, err
+	}
+	switch job.Status {
+	case jobFetching:
+		job.cancel()
+	case jobCommitting:
+		job.cancel()
+		// the commit may still be replacing the IDs until it notices
+		job.Result = nil
+	case jobPreview:
+	default:
+		return nil, fmt.Errorf("%w: the import is %s already", errJobState, job.Status)
+	}
+	job.finish(jobCancelled)
+	return job.snapshot(), nil
+}
+
+// get returns the job if it was started by the member. The caller must hold the lock
+func (ij *importJobs) get(memberName string, id uuid.UUID) (*ImportJob, error) {
+	job, ok := ij.jobs[id]
+	if !ok || job.member != memberName {
+		return nil, errJobNotFound
+	}
+	return job, nil
+}
+
+// fail records the error. The caller must hold the lock
+func (ij *importJobs) fail(job *ImportJob, err error) {
+	ij.log.Error().Err(err).Msgf("%s import %s failed", job.Source, job.ID)
+	job.Error = err.Error()
+	job.finish(jobFailed)
+}
+
+// prune forgets the jobs finished long ago and the expired previews. The caller must hold the lock
+func (ij *importJobs) prune() {
+	for id, job := range ij.jobs {
+		if (job.Finished != nil && time.Since(*job.Finished) > importJobRetention) ||
+			(job.Status == jobPreview && time.Since(job.previewed) > importPreviewExpiry) {
+			delete(ij.jobs, id)
+		}
+	}
+}
+
+func (job *ImportJob) finish(status string) {
+	finished := time.Now()
+	job.Status, job.Finished = status, &finished
+	// the staged changes aren't needed anymore
+	job.staging = nil
+}
+
+// snapshot copies the job for the response. The result is left out while it's being committed,
+// since the IDs of the new artists are replaced in the meantime
+func (job *ImportJob) snapshot() *ImportJob {
+	snapshot := *job
+	if job.Status == jobCommitting {
+		snapshot.Result = nil
+	}
+	return &snapshot
+}
@@ -0,0 +1,194 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+// fakeImportCatalog knows some of the artists and labels already
+type fakeImportCatalog struct {
+	fakeMBCatalog
+	knownArtists map[string]uuid.UUID
+	knownStudios map[string]int32
+}
+
+func (fc *fakeImportCatalog) FindArtist(_ context.Context, _ uuid.NullUUID, name string, group bool) (*media.AlbumArtist, error) {
+	id, ok := fc.knownArtists[strings.ToLower(name)]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	artistType := "individual"
+	if group {
+		artistType = "group"
+	}
+	return &media.AlbumArtist{ID: id, Name: name, ArtistType: artistType}, nil
+}
+
+func (fc *fakeImportCatalog) FindStudio(_ context.Context, name string, _ media.StudioKind) (*media.Studio, error) {
+	id, ok := fc.knownStudios[strings.ToLower(name)]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &media.Studio{ID: id, Name: name}, nil
+}
+
+func newFakeImportCatalog() *fakeImportCatalog {
+	return &fakeImportCatalog{
+		fakeMBCatalog: fakeMBCatalog{
+			fakeCatalog: fakeCatalog{genres: []media.Genre{{ID: 3, Name: "Trip Hop"}}},
+			media:       make(map[uuid.UUID]uuid.UUID),
+		},
+		knownArtists: make(map[string]uuid.UUID),
+		knownStudios: map[string]int32{"circa": 7},
+	}
+}
+
+// waitForJob polls the job until it leaves the given state
+func waitForJob(t *testing.T, jobs *importJobs, id uuid.UUID, status string) *ImportJob {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		job, err := jobs.Job("lain", id)
+		require.NoError(t, err)
+		if job.Status != status {
+			return job
+		}
+	}
+	t.Fatalf("the job is still %s", status)
+	return nil
+}
+
+func TestImportJobConfirm(t *testing.T) {
+	log := zerolog.Nop()
+	catalog := newFakeImportCatalog()
+	mi := newTestMusicBrainzImporter(t, &catalog.fakeMBCatalog)
+	jobs := newImportJobs(catalog, &log)
+
+	uri := "https://musicbrainz.org/release/2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21"
+	started := jobs.Start("lain", "listenbrainz", uri, func(ctx context.Context, catalog *stagingCatalog) (any, error) {
+		return mi.withCatalog(catalog).Import(ctx, uri)
+	})
+	assert.Equal(t, jobFetching, started.Status)
+
+	job := waitForJob(t, jobs, started.ID, jobFetching)
+	require.Equal(t, jobPreview, job.Status, job.Error)
+	assert.Zero(t, catalog.added, "nothing should be saved before the import is confirmed")
+	assert.Empty(t, catalog.artists)
+	assert.Empty(t, catalog.studios)
+
+	preview := job.Preview
+	require.NotNil(t, preview)
+	assert.Equal(t, []PreviewEntry{{Name: "Massive Attack", Status: previewNew}}, preview.Artists)
+	assert.Equal(t, []PreviewEntry{{Name: "Circa", Status: previewMatched, ID: "7"}}, preview.Studios)
+	assert.Contains(t, preview.Genres, PreviewEntry{Name: "Trip Hop", Status: previewMatched, ID: "3"})
+	assert.Equal(t, []PreviewEntry{{Name: "Mezzanine", Status: previewNew}}, preview.Media)
+	require.Len(t, preview.Tracks, 3)
+	assert.Equal(t, PreviewEntry{Name: "Teardrop", Status: previewNew, Album: "Mezzanine"}, preview.Tracks[2])
+
+	album := job.Result.(*media.Album)
+	temporaryID := album.AlbumArtists[0].ID
+
+	_, err := jobs.Confirm("alice", job.ID)
+	assert.ErrorIs(t, err, errJobNotFound, "other members shouldn't see the job")
+	_, err = jobs.Confirm("lain", job.ID)
+	require.NoError(t, err)
+	job = waitForJob(t, jobs, job.ID, jobCommitting)
+	require.Equal(t, jobDone, job.Status, job.Error)
+
+	assert.Equal(t, 1, catalog.added)
+	require.Len(t, catalog.artists, 1)
+	assert.NotEqual(t, temporaryID, catalog.artists[0].ID)
+	assert.Equal(t, catalog.artists[0].ID, album.AlbumArtists[0].ID, "the temporary ID should be replaced")
+	assert.EqualValues(t, 1, album.Studio.ID, "the label should be resolved again when committing")
+
+	_, err = jobs.Confirm("lain", job.ID)
+	assert.ErrorIs(t, err, errJobState)
+}
+
+func TestImportJobMatchedAlbum(t *testing.T) {
+	log := zerolog.Nop()
+	catalog := newFakeImportCatalog()
+	existing := uuid.Must(uuid.NewV4())
+	catalog.media[uuid.Must(uuid.FromString("2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21"))] = existing
+	catalog.knownArtists["massive attack"] = uuid.Must(uuid.NewV4())
+	mi := newTestMusicBrainzImporter(t, &catalog.fakeMBCatalog)
+	jobs := newImportJobs(catalog, &log)
+
+	started := jobs.Start("lain", "listenbrainz", "", func(ctx context.Context, catalog *stagingCatalog) (any, error) {
+		return mi.withCatalog(catalog).Import(ctx, "2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21")
+	})
+	job := waitForJob(t, jobs, started.ID, jobFetching)
+	require.Equal(t, jobPreview, job.Status, job.Error)
+	assert.Equal(t, previewMatched, job.Preview.Artists[0].Status)
+	assert.Equal(t, []PreviewEntry{{Name: "Mezzanine", Status: previewMatched, ID: existing.String()}}, job.Preview.Media)
+	assert.Equal(t, previewMatched, job.Preview.Tracks[0].Status)
+
+	_, err := jobs.Confirm("lain", job.ID)
+	require.NoError(t, err)
+	job = waitForJob(t, jobs, job.ID, jobCommitting)
+	require.Equal(t, jobDone, job.Status, job.Error)
+	assert.Zero(t, catalog.added)
+}
+
+func TestImportJobCancel(t *testing.T) {
+	log := zerolog.Nop()
+	catalog := newFakeImportCatalog()
+	jobs := newImportJobs(catalog, &log)
+
+	fetching := jobs.Start("lain", "discogs", "", func(ctx context.Context, _ *stagingCatalog) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	job, err := jobs.Cancel("lain", fetching.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobCancelled, job.Status)
+	time.Sleep(20 * time.Millisecond)
+	job, err = jobs.Job("lain", fetching.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobCancelled, job.Status, "the cancelled fetch shouldn't be reported as failed")
+	assert.Empty(t, job.Error)
+
+	previewed := jobs.Start("lain", "bandcamp", "", func(ctx context.Context, catalog *stagingCatalog) (any, error) {
+		album := &media.Album{Name: "Nightswim", Tracks: []media.Track{{Name: "Nightswim"}}}
+		artist, err := catalog.ResolveArtist(ctx, "Mira Odell", true)
+		if err != nil {
+			return nil, err
+		}
+		album.AlbumArtists = []media.AlbumArtist{*artist}
+		_, err = catalog.AddAlbum(ctx, album)
+		return album, err
+	})
+	waitForJob(t, jobs, previewed.ID, jobFetching)
+	job, err = jobs.Cancel("lain", previewed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobCancelled, job.Status)
+	_, err = jobs.Confirm("lain", previewed.ID)
+	assert.ErrorIs(t, err, errJobState)
+	_, err = jobs.Cancel("lain", previewed.ID)
+	assert.ErrorIs(t, err, errJobState)
+	assert.Zero(t, catalog.added)
+	assert.Empty(t, catalog.artists)
+}
+
+func TestImportJobFailed(t *testing.T) {
+	log := zerolog.Nop()
+	jobs := newImportJobs(newFakeImportCatalog(), &log)
+	mi := newTestMusicBrainzImporter(t, &fakeMBCatalog{media: make(map[uuid.UUID]uuid.UUID)})
+
+	started := jobs.Start("lain", "listenbrainz", "", func(ctx context.Context, catalog *stagingCatalog) (any, error) {
+		return mi.withCatalog(catalog).Import(ctx, "00000000-0000-4000-8000-000000000000")
+	})
+	job := waitForJob(t, jobs, started.ID, jobFetching)
+	assert.Equal(t, jobFailed, job.Status)
+	assert.Contains(t, job.Error, "not found")
+	assert.NotNil(t, job.Finished)
+}
@@ -3,6 +3,7 @@ package media
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -13,8 +14,13 @@ import (
 	"github.com/samber/lo"
 
 	"codeberg.org/mjh/LibRate/cfg"
+	"codeberg.org/mjh/LibRate/controllers/federation"
 	h "codeberg.org/mjh/LibRate/internal/handlers"
+	"codeberg.org/mjh/LibRate/middleware/security"
+	"codeberg.org/mjh/LibRate/models"
 	"codeberg.org/mjh/LibRate/models/media"
+	"codeberg.org/mjh/LibRate/models/member"
+	"codeberg.org/mjh/LibRate/models/static"
 )
 
 type (
@@ -32,6 +38,19 @@ type (
 	Controller struct {
 		storage media.Storage
 		conf    *cfg.Config
+		// used to serve the catalog to other instances
+		fedConv     federation.CatalogConverter
+		discogs     *discogsImporter
+		musicBrainz *musicBrainzImporter
+		bandcamp    *bandcampImporter
+		wikidata    *wikidataImporter
+		library     *libraryImporter
+		tags        *tagImporter
+		imports     *importJobs
+		revisions   revisionStorage
+		works       workStorage
+		titles      titleStorage
+		locales     localeGetter
 	}
 
 	mediaError struct {
@@ -40,8 +59,31 @@ type (
 	}
 )
 
-func NewController(storage media.Storage, conf *cfg.Config) *Controller {
-	return &Controller{storage: storage, conf: conf}
+func NewController(
+	storage media.Storage,
+	covers *static.Storage,
+	ratings *models.RatingStorage,
+	conf *cfg.Config,
+	fedConv federation.CatalogConverter,
+	members member.Getter,
+) *Controller {
+	catalog := storageCatalog{Storage: &storage, PeopleStorage: storage.Ps}
+	return &Controller{
+		storage:     storage,
+		conf:        conf,
+		fedConv:     fedConv,
+		discogs:     newDiscogsImporter(conf, catalog, storage.Log),
+		musicBrainz: newMusicBrainzImporter(catalog, storage.Log),
+		bandcamp:    newBandcampImporter(conf, catalog, covers, storage.Log),
+		wikidata:    newWikidataImporter(catalog, storage.Log),
+		library:     newLibraryImporter(catalog, ratings, storage.Log),
+		tags:        newTagImporter(catalog, storage.Log),
+		imports:     newImportJobs(catalog, storage.Log),
+		revisions:   &storage,
+		works:       &storage,
+		titles:      &storage,
+		locales:     members,
+	}
 }
 
 // GetMedia retrieves media information based on the media ID
@@ -51,14 +93,21 @@ func NewController(storage media.Storage, conf *cfg.Config) *Controller {
 // @Summary Retrieve media information
 // @Description Retrieve complete media information for the given media ID
 // @Tags media,metadata
+// @Description With Accept: application/activity+json, the ActivityStreams object is returned instead,
+// @Description so that other instances can reference the media item by IRI.
+// @Description The IDs of the media merged into others as duplicates redirect to the merged media
 // @Param id path string true "Media UUID"
 // @Accept json
 // @Produce json
+// @Produce application/activity+json
 // @Success 200 {object} h.ResponseHTTP{data=any}
+// @Success 301
 // @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
 // @Failure 500 {object} h.ResponseHTTP{}
 // @Router /media/{id} [get]
 func (mc *Controller) GetMedia(c *fiber.Ctx) error {
+	c.Vary(fiber.HeaderAccept)
 	mediaID, err := uuid.FromString(c.Params("id"))
 	if err != nil {
 		mc.storage.Log.Error().Err(err).
@@ -69,15 +118,34 @@ func (mc *Controller) GetMedia(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	media, err := mc.storage.Get(ctx, mediaID)
+	item, err := mc.storage.Get(ctx, mediaID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the media may have been merged into another as a duplicate
+		if to, rerr := mc.storage.Redirect(ctx, media.DuplicateMedia, mediaID.String()); rerr == nil {
+			return c.Redirect("/api/media/"+to, fiber.StatusMovedPermanently)
+		}
+		return h.Res(c, fiber.StatusNotFound, "Media not found")
+	}
 	if err != nil {
 		mc.storage.Log.Error().Err(err).
 			Msgf("Failed to get media with ID %s", c.Params("id"))
 		return h.Res(c, fiber.StatusInternalServerError, "Failed to get media")
 	}
+	// submissions are hidden until a moderator approves them
+	if item.Status != media.StatusApproved {
+		return h.Res(c, fiber.StatusNotFound, "Media not found")
+	}
+
+	if security.WantsActivityStreams(c) {
+		doc, err := mc.fedConv.MediaToAS(&item)
+		if err != nil {
+			return handleInternalError(mc.storage.Log, c, "Failed to convert media", err)
+		}
+		return federation.SendDocument(c, doc)
+	}
 
 	detailedMedia, err := mc.storage.
-		GetDetails(ctx, media.Kind, media.ID)
+		GetDetails(ctx, item.Kind, item.ID)
 	if err != nil {
 		mc.storage.Log.Error().Err(err).Msgf("Failed to get media details for media with ID %s: %v", c.Params("id"), err)
 		return h.Res(c, fiber.StatusInternalServerError, "Failed to get media details")
@@ -129,7 +197,7 @@ func (mc *Controller) GetImagePaths(c *fiber.Ctx) error {
 // @Summary Retrieve genres
 // @Description Retrieve the list of genres of the specified type
 // @Tags media,genres,bulk operations
-// @Param kind path string true "Genre kind" Enums(film, tv, music, book, game)
+// @Param kind path string true "Genre kind" Enums(film, tv, music, book, game, anime, comic)
 // @Param names_only query bool false "Return only genre names. Usually used for populating dropdowns"
 // @Param as_links query bool false "Return the genre names as links"
 // @Param all query bool false "Return all genres, not only the ones without a parent genre (e.g. Twee Pop and Jangle Pop instead of just Pop)"
@@ -146,7 +214,7 @@ func (mc *Controller) GetImagePaths(c *fiber.Ctx) error {
 func (mc *Controller) GetGenres(c *fiber.Ctx) error {
 	genreKind := c.Params("kind")
 	namesOnly := c.QueryBool("names_only", true)
-	possible := []string{"film", "tv", "music", "book", "game"}
+	possible := []string{"film", "tv", "music", "book", "game", "anime", "comic"}
 	if !lo.Contains(possible, genreKind) {
 		return handleBadRequest(mc.storage.Log, c, "Invalid genre kind")
 	}
@@ -185,7 +253,7 @@ func (mc *Controller) GetGenres(c *fiber.Ctx) error {
 // @Summary Retrieve genre
 // @Description Retrieve the genre with the given name and type
 // @Tags media,genres
-// @Param kind path string true "Genre kind" Enums(film, tv, music, book, game)
+// @Param kind path string true "Genre kind" Enums(film, tv, music, book, game, anime, comic)
 // @Param genre path string true "Genre name (snake_lowercase)"
 // @Param lang query string false "ISO-639-1 language code" Enums(en, de)
 // @Accept json
@@ -197,7 +265,7 @@ func (mc *Controller) GetGenres(c *fiber.Ctx) error {
 // @Router /genre/{kind}/{genre} [get] "Note the singular genre, not genres"
 func (mc *Controller) GetGenre(c *fiber.Ctx) error {
 	genreKind := c.Params("kind")
-	possible := []string{"film", "tv", "music", "book", "game"}
+	possible := []string{"film", "tv", "music", "book", "game", "anime", "comic"}
 	if !lo.Contains(possible, genreKind) {
 		return handleBadRequest(mc.storage.Log, c, "Invalid genre kind")
 	}
@@ -0,0 +1,420 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+
+	"codeberg.org/mjh/LibRate/models"
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+const (
+	// minimum similarity of both the title and the artist for an entry to match a catalog item
+	libraryMatchThreshold = 0.6
+	libraryImportTimeout  = 30 * time.Minute
+	// finished jobs are forgotten after this long
+	libraryJobRetention = 24 * time.Hour
+	libraryBatchSize    = 100
+	// the date format of the Last.fm export tools
+	lastFMDateLayout = "02 Jan 2006 15:04"
+)
+
+var errInvalidExport = errors.New("invalid export")
+
+// libraryScale is the scale of the libraryEntry stars
+var libraryScale = models.RatingScale{Lower: 1, Upper: 10, Step: 1}
+
+type (
+	// libraryCatalog matches the imported entries against the catalog
+	libraryCatalog interface {
+		MatchMedia(ctx context.Context, kind, title, artist string) (uuid.UUID, float64, error)
+		SaveRatingPlaceholders(ctx context.Context, memberName string, placeholders []media.RatingPlaceholder) (int, error)
+		AddPendingSubmissions(ctx context.Context, memberName string, submissions []media.PendingSubmission) (int, error)
+	}
+
+	ratingImporter interface {
+		ImportRatings(ctx context.Context, memberName string, ratings []models.RatingInput, scale models.RatingScale) (int, error)
+	}
+
+	libraryImporter struct {
+		catalog libraryCatalog
+		ratings ratingImporter
+		log     *zerolog.Logger
+		mu      sync.Mutex
+		jobs    map[uuid.UUID]*LibraryImportJob
+	}
+
+	// LibraryImportJob reports the progress of importing a RateYourMusic or Last.fm export
+	LibraryImportJob struct {
+		ID     uuid.UUID `json:"id"`
+		Source string    `json:"source" example:"rym"`
+		Status string    `json:"status" enum:"running,done,failed" example:"running"`
+		// number of distinct albums and tracks found in the export
+		Total     int `json:"total" example:"1200"`
+		Processed int `json:"processed" example:"340"`
+		Matched   int `json:"matched" example:"310"`
+		// ratings added, media rated by the member before are skipped
+		Rated        int        `json:"rated" example:"280"`
+		Placeholders int        `json:"placeholders" example:"30"`
+		Submitted    int        `json:"submitted" example:"30"`
+		Error        string     `json:"error,omitempty"`
+		Started      time.Time  `json:"started"`
+		Finished     *time.Time `json:"finished,omitempty"`
+		member       string
+	}
+
+	// libraryEntry is an album or track found in an export
+	libraryEntry struct {
+		Kind   string
+		Title  string
+		Artist string
+		Album  string
+		Year   int16
+		// on our 1-10 scale, 0 if not rated
+		Stars        int8
+		Review       string
+		Listens      int
+		LastListened time.Time
+	}
+)
+
+func newLibraryImporter(catalog libraryCatalog, ratings ratingImporter, log *zerolog.Logger) *libraryImporter {
+	return &libraryImporter{
+		catalog: catalog,
+		ratings: ratings,
+		log:     log,
+		jobs:    make(map[uuid.UUID]*LibraryImportJob),
+	}
+}
+
+// Start parses the export and imports it in the background. Matched albums and tracks are
+// rated, or marked as listened to, the rest is saved as pending submissions
+func (li *libraryImporter) Start(memberName, source string, export io.Reader) (*LibraryImportJob, error) {
+	var (
+		entries []libraryEntry
+		err     error
+	)
+	switch source {
+	case "rym":
+		entries, err = parseRYMExport(export)
+	case "lastfm":
+		entries, err = parseLastFMExport(export)
+	default:
+		return nil, fmt.Errorf("%w: importing %s exports is not supported", errInvalidExport, source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: no albums or tracks found", errInvalidExport)
+	}
+
+	job := &LibraryImportJob{
+		ID:      uuid.Must(uuid.NewV4()),
+		Source:  source,
+		Status:  "running",
+		Total:   len(entries),
+		Started: time.Now(),
+		member:  memberName,
+	}
+	li.mu.Lock()
+	li.prune()
+	li.jobs[job.ID] = job
+	snapshot := *job
+	li.mu.Unlock()
+
+	go func() {
+		// the job outlives the request which started it
+		ctx, cancel := context.WithTimeout(context.Background(), libraryImportTimeout)
+		defer cancel()
+		err := li.run(ctx, job, entries)
+
+		li.mu.Lock()
+		defer li.mu.Unlock()
+		finished := time.Now()
+		job.Finished = &finished
+		job.Status = "done"
+		if err != nil {
+			li.log.Error().Err(err).Msgf("library import %s failed", job.ID)
+			job.Status, job.Error = "failed", err.Error()
+		}
+	}()
+	return &snapshot, nil
+}
+
+// Job returns the progress of an import started by the member
+func (li *libraryImporter) Job(memberName string, id uuid.UUID) (*LibraryImportJob, bool) {
+	li.mu.Lock()
+	defer li.mu.Unlock()
+	job, ok := li.jobs[id]
+	if !ok || job.member != memberName {
+		return nil, false
+	}
+	snapshot := *job
+	return &snapshot, true
+}
+
+// prune forgets the jobs finished long ago. The caller must hold the lock
+func (li *libraryImporter) prune() {
+	for id, job := range li.jobs {
+		if job.Finished != nil && time.Since(*job.Finished) > libraryJobRetention {
+			delete(li.jobs, id)
+		}
+	}
+}
+
+func (li *libraryImporter) run(ctx context.Context, job *LibraryImportJob, entries []libraryEntry) error {
+	for start := 0; start < len(entries); start += libraryBatchSize {
+		batch := entries[start:min(start+libraryBatchSize, len(entries))]
+		var (
+			ratings      []models.RatingInput
+			placeholders []media.RatingPlaceholder
+			submissions  []media.PendingSubmission
+		)
+		for i := range batch {
+			e := &batch[i]
+			id, score, err := li.catalog.MatchMedia(ctx, e.Kind, e.Title, e.Artist)
+			if err != nil {
+				return err
+			}
+			switch {
+			case id == uuid.Nil || score < libraryMatchThreshold:
+				submissions = append(submissions, e.submission(job.Source))
+			case e.Stars > 0:
+				ratings = append(ratings, models.RatingInput{NumStars: float64(e.Stars), Comment: e.Review, MediaID: id})
+			default:
+				placeholders = append(placeholders, media.RatingPlaceholder{
+					MediaID:      id,
+					Source:       job.Source,
+					Listens:      e.Listens,
+					LastListened: sql.NullTime{Time: e.LastListened, Valid: !e.LastListened.IsZero()},
+				})
+			}
+		}
+
+		var rated, saved, submitted int
+		var err error
+		if len(ratings) > 0 {
+			if rated, err = li.ratings.ImportRatings(ctx, job.member, ratings, libraryScale); err != nil {
+				return err
+			}
+		}
+		if len(placeholders) > 0 {
+			if saved, err = li.catalog.SaveRatingPlaceholders(ctx, job.member, placeholders); err != nil {
+				return err
+			}
+		}
+		if len(submissions) > 0 {
+			if submitted, err = li.catalog.AddPendingSubmissions(ctx, job.member, submissions); err != nil {
+				return err
+			}
+		}
+
+		li.mu.Lock()
+		job.Processed += len(batch)
+		job.Matched += len(batch) - len(submissions)
+		job.Rated += rated
+		job.Placeholders += saved
+		job.Submitted += submitted
+		li.mu.Unlock()
+	}
+	return nil
+}
+
+func (e *libraryEntry) submission(source string) media.PendingSubmission {
+	return media.PendingSubmission{
+		Kind:        e.Kind,
+		Title:       e.Title,
+		Artist:      e.Artist,
+		Album:       sql.NullString{String: e.Album, Valid: e.Album != ""},
+		ReleaseYear: sql.NullInt16{Int16: e.Year, Valid: e.Year > 0},
+		Source:      source,
+		Stars:       sql.NullInt16{Int16: int16(e.Stars) * (models.ReferenceScale / 10), Valid: e.Stars > 0},
+		Listens:     e.Listens,
+	}
+}
+
+// parseRYMExport reads the CSV export of RateYourMusic ratings. Artists are split into
+// first and last names, bands have only the latter
+func parseRYMExport(export io.Reader) ([]libraryEntry, error) {
+	r := csv.NewReader(export)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidExport, err)
+	}
+	columns := csvColumns(header)
+	for _, required := range []string{"last name", "title", "rating"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: the %q column is missing, is it a RateYourMusic export?", errInvalidExport, required)
+		}
+	}
+
+	var entries []libraryEntry
+	seen := make(map[string]bool)
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidExport, err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		artist := strings.TrimSpace(field("first name") + " " + field("last name"))
+		if artist == "" {
+			artist = strings.TrimSpace(field("first name localized") + " " + field("last name localized"))
+		}
+		entry := libraryEntry{Kind: "album", Title: field("title"), Artist: artist, Review: field("review")}
+		if entry.Title == "" || entry.Artist == "" {
+			continue
+		}
+		if entry.Stars, err = libraryStars(field("rating")); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", errInvalidExport, line, err)
+		}
+		if year, err := strconv.ParseInt(field("release_date"), 10, 16); err == nil {
+			entry.Year = int16(year)
+		}
+		key := strings.ToLower(entry.Artist + "\x00" + entry.Title)
+		if !seen[key] {
+			seen[key] = true
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// parseLastFMExport reads the scrobbles (artist, album, track, date) or the loved tracks
+// (artist, track, date) exported from Last.fm, with or without a header. Last.fm has no
+// ratings, so the listens of both the albums and the tracks are summed up instead
+func parseLastFMExport(export io.Reader) ([]libraryEntry, error) {
+	r := csv.NewReader(export)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidExport, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{"artist": 0, "album": 1, "track": 2, "date": 3}
+	if len(records[0]) == 3 {
+		columns = map[string]int{"artist": 0, "track": 1, "date": 2}
+	}
+	if header := csvColumns(records[0]); hasColumn(header, "artist") {
+		columns = header
+		for alias, name := range map[string]string{"name": "track", "title": "track", "uts": "date", "utc_time": "date"} {
+			if i, ok := header[alias]; ok && !hasColumn(columns, name) {
+				columns[name] = i
+			}
+		}
+		records = records[1:]
+	}
+	if !hasColumn(columns, "track") {
+		return nil, fmt.Errorf("%w: no track column found, is it a Last.fm export?", errInvalidExport)
+	}
+
+	var entries []libraryEntry
+	index := make(map[string]int)
+	count := func(e libraryEntry) {
+		key := strings.ToLower(e.Kind + "\x00" + e.Artist + "\x00" + e.Title)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(entries)
+			entries = append(entries, e)
+			return
+		}
+		entries[i].Listens += e.Listens
+		if e.LastListened.After(entries[i].LastListened) {
+			entries[i].LastListened = e.LastListened
+		}
+	}
+	for _, record := range records {
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		artist, album, track := field("artist"), field("album"), field("track")
+		if artist == "" || track == "" {
+			continue
+		}
+		// loved tracks aren't listens
+		listens := 0
+		if hasColumn(columns, "album") {
+			listens = 1
+		}
+		listened := parseLastFMDate(field("date"))
+		count(libraryEntry{Kind: "track", Title: track, Artist: artist, Album: album, Listens: listens, LastListened: listened})
+		if album != "" {
+			count(libraryEntry{Kind: "album", Title: album, Artist: artist, Listens: listens, LastListened: listened})
+		}
+	}
+	return entries, nil
+}
+
+// libraryStars converts a rating onto our 1-10 scale. RateYourMusic exports half stars
+// as whole numbers from 1 to 10, while other tools use 0.5 to 5 stars. 0 means not rated
+func libraryStars(rating string) (int8, error) {
+	if rating == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseFloat(strings.ReplaceAll(rating, ",", "."), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rating %q", rating)
+	}
+	if strings.ContainsAny(rating, ".,") {
+		value *= 2
+	}
+	if value < 0 || value > 10 {
+		return 0, fmt.Errorf("rating %q is out of range", rating)
+	}
+	return int8(math.Round(value)), nil
+}
+
+func parseLastFMDate(date string) time.Time {
+	if ts, err := strconv.ParseInt(date, 10, 64); err == nil {
+		return time.Unix(ts, 0).UTC()
+	}
+	for _, layout := range []string{lastFMDateLayout, time.RFC3339, time.DateTime} {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// csvColumns maps the lowercased column names to their indices, ignoring the byte order mark
+func csvColumns(header []string) map[string]int {
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	return columns
+}
+
+func hasColumn(columns map[string]int, name string) bool {
+	_, ok := columns[name]
+	return ok
+}
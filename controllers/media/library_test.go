@@ -0,0 +1,169 @@
+package media
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/models"
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+// fakeLibrary knows a few albums and tracks by their titles and records what was imported
+type fakeLibrary struct {
+	mu           sync.Mutex
+	known        map[string]uuid.UUID
+	ratings      []models.RatingInput
+	placeholders []media.RatingPlaceholder
+	submissions  []media.PendingSubmission
+}
+
+func newFakeLibrary(known ...string) *fakeLibrary {
+	fl := &fakeLibrary{known: make(map[string]uuid.UUID)}
+	for _, k := range known {
+		fl.known[k] = uuid.Must(uuid.NewV4())
+	}
+	return fl
+}
+
+func (fl *fakeLibrary) MatchMedia(_ context.Context, kind, title, _ string) (uuid.UUID, float64, error) {
+	if id, ok := fl.known[kind+":"+strings.ToLower(title)]; ok {
+		return id, 0.9, nil
+	}
+	return uuid.Nil, 0, nil
+}
+
+func (fl *fakeLibrary) SaveRatingPlaceholders(_ context.Context, _ string, placeholders []media.RatingPlaceholder) (int, error) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	fl.placeholders = append(fl.placeholders, placeholders...)
+	return len(placeholders), nil
+}
+
+func (fl *fakeLibrary) AddPendingSubmissions(_ context.Context, _ string, submissions []media.PendingSubmission) (int, error) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	fl.submissions = append(fl.submissions, submissions...)
+	return len(submissions), nil
+}
+
+func (fl *fakeLibrary) ImportRatings(
+	_ context.Context, _ string, ratings []models.RatingInput, _ models.RatingScale,
+) (int, error) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	fl.ratings = append(fl.ratings, ratings...)
+	return len(ratings), nil
+}
+
+// importLibrary runs the import of the export from testdata/library to completion
+func importLibrary(t *testing.T, library *fakeLibrary, source, export string) *LibraryImportJob {
+	t.Helper()
+	log := zerolog.Nop()
+	li := newLibraryImporter(library, library, &log)
+	f, err := os.Open(filepath.Join("testdata", "library", export))
+	require.NoError(t, err)
+	defer f.Close()
+
+	job, err := li.Start("lain", source, f)
+	require.NoError(t, err)
+	assert.Equal(t, "running", job.Status)
+	_, ok := li.Job("someone_else", job.ID)
+	assert.False(t, ok, "jobs should only be visible to the member who started them")
+
+	require.Eventually(t, func() bool {
+		job, ok = li.Job("lain", job.ID)
+		return ok && job.Finished != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "done", job.Status, job.Error)
+	assert.Equal(t, job.Total, job.Processed)
+	return job
+}
+
+func TestLibraryImportRYM(t *testing.T) {
+	library := newFakeLibrary("album:mezzanine", "album:untrue", "album:tidal archive")
+	job := importLibrary(t, library, "rym", "rym.csv")
+
+	assert.Equal(t, 4, job.Total, "duplicate rows should be merged")
+	assert.Equal(t, 3, job.Matched)
+	assert.Equal(t, 2, job.Rated)
+	require.Len(t, library.ratings, 2)
+	assert.EqualValues(t, 9, library.ratings[0].NumStars)
+	assert.Equal(t, library.known["album:untrue"], library.ratings[1].MediaID)
+	assert.Equal(t, "Still sounds like the night bus.", library.ratings[1].Comment)
+	require.Len(t, library.placeholders, 1, "unrated albums should get placeholders")
+
+	require.Len(t, library.submissions, 1)
+	missing := library.submissions[0]
+	assert.Equal(t, "Basement Sessions", missing.Title)
+	assert.Equal(t, "Unknown Quartet", missing.Artist)
+	assert.EqualValues(t, 2011, missing.ReleaseYear.Int16)
+	assert.EqualValues(t, 700, missing.Stars.Int16, "pending ratings are stored on the reference scale")
+}
+
+func TestLibraryImportLastFM(t *testing.T) {
+	library := newFakeLibrary("album:mezzanine", "track:teardrop", "track:angel")
+	job := importLibrary(t, library, "lastfm", "lastfm-scrobbles.csv")
+
+	assert.Equal(t, 5, job.Total, "two albums and three tracks")
+	assert.Equal(t, 3, job.Placeholders)
+	assert.Empty(t, library.ratings, "Last.fm has no ratings")
+	for _, p := range library.placeholders {
+		switch p.MediaID {
+		case library.known["album:mezzanine"]:
+			assert.Equal(t, 3, p.Listens)
+			assert.Equal(t, time.Date(2020, time.February, 1, 9, 12, 0, 0, time.UTC), p.LastListened.Time)
+		case library.known["track:teardrop"]:
+			assert.Equal(t, 2, p.Listens)
+		}
+	}
+	require.Len(t, library.submissions, 2)
+	assert.Equal(t, "track", library.submissions[0].Kind)
+	assert.Equal(t, "Basement Sessions", library.submissions[0].Album.String)
+}
+
+func TestLibraryImportLastFMLoved(t *testing.T) {
+	library := newFakeLibrary("track:teardrop")
+	job := importLibrary(t, library, "lastfm", "lastfm-loved.csv")
+
+	assert.Equal(t, 2, job.Total)
+	require.Len(t, library.placeholders, 1)
+	assert.Zero(t, library.placeholders[0].Listens, "loved tracks aren't listens")
+	assert.Equal(t, time.Unix(1580496300, 0).UTC(), library.placeholders[0].LastListened.Time)
+	require.Len(t, library.submissions, 1)
+	assert.Equal(t, "Archangel", library.submissions[0].Title)
+}
+
+func TestLibraryImportInvalid(t *testing.T) {
+	log := zerolog.Nop()
+	li := newLibraryImporter(newFakeLibrary(), newFakeLibrary(), &log)
+	for source, export := range map[string]string{
+		"rym":     "artist,album,track,date\nBurial,Untrue,Archangel,01 Feb 2020 09:12\n",
+		"lastfm":  "",
+		"discogs": "Artist,Title\n",
+	} {
+		_, err := li.Start("lain", source, strings.NewReader(export))
+		assert.ErrorIs(t, err, errInvalidExport, source)
+	}
+}
+
+func TestLibraryStars(t *testing.T) {
+	for rating, stars := range map[string]int8{"": 0, "0": 0, "7": 7, "10": 10, "3.5": 7, "4,5": 9, "0.5": 1} {
+		got, err := libraryStars(rating)
+		require.NoError(t, err, rating)
+		assert.Equal(t, stars, got, rating)
+	}
+	for _, rating := range []string{"11", "-1", "great"} {
+		_, err := libraryStars(rating)
+		assert.Error(t, err, rating)
+	}
+}
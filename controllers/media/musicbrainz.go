@@ -0,0 +1,494 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+const (
+	musicBrainzAPI  = "https://musicbrainz.org/ws/2"
+	listenBrainzAPI = "https://api.listenbrainz.org/1"
+	// MusicBrainz allows one request per second per client
+	musicBrainzInterval = time.Second
+	// only the most recent listens are imported, older ones are unlikely to be rated anyway
+	listenBrainzMaxListens = 1000
+	listenBrainzPageSize   = 100
+)
+
+var (
+	// the special purpose artist credited on compilations
+	mbVariousArtists = uuid.Must(uuid.FromString("89ad4ac3-39f7-470e-963a-56509c546377"))
+	// the special purpose label of self-released albums
+	mbNoLabel = uuid.Must(uuid.FromString("157afde4-4bf5-4039-8ad2-5a15acc85176"))
+
+	musicBrainzURLPattern  = regexp.MustCompile(`^/(release|release-group)/([0-9a-fA-F-]{36})`)
+	listenBrainzURLPattern = regexp.MustCompile(`^/user/([^/]+)`)
+)
+
+type (
+	// mbCatalog extends the catalog resolver with the lookups by MusicBrainz IDs
+	mbCatalog interface {
+		albumSaver
+		ResolveArtistMBID(ctx context.Context, mbid uuid.UUID, name string, group bool) (*media.AlbumArtist, error)
+		MediaByMBID(ctx context.Context, mbids []uuid.UUID) (map[uuid.UUID]uuid.UUID, error)
+		SaveRatingPlaceholders(ctx context.Context, memberName string, placeholders []media.RatingPlaceholder) (int, error)
+	}
+
+	musicBrainzImporter struct {
+		baseURL       string
+		listensURL    string
+		client        *http.Client
+		catalog       mbCatalog
+		log           *zerolog.Logger
+		throttle      *mbThrottle
+		interval      time.Duration
+		maxListens    int
+		listensPerReq int
+	}
+
+	// mbThrottle is shared by the copies of the importer, so that together they keep to the rate limit
+	mbThrottle struct {
+		mu          sync.Mutex
+		lastRequest time.Time
+	}
+
+	// ListenImport summarizes the import of a ListenBrainz listening history
+	ListenImport struct {
+		Listens      int `json:"listens"`
+		Placeholders int `json:"placeholders"`
+		// releases not in the catalog yet, which can be imported separately
+		UnmatchedReleases []string `json:"unmatched_releases,omitempty"`
+	}
+
+	mbRelease struct {
+		ID           uuid.UUID        `json:"id"`
+		Title        string           `json:"title"`
+		Date         string           `json:"date"`
+		Status       string           `json:"status"`
+		ArtistCredit []mbArtistCredit `json:"artist-credit"`
+		LabelInfo    []mbLabelInfo    `json:"label-info"`
+		Genres       []mbGenre        `json:"genres"`
+		ReleaseGroup *mbReleaseGroup  `json:"release-group,omitempty"`
+		Media        []mbMedium       `json:"media"`
+	}
+
+	mbReleaseGroup struct {
+		ID               uuid.UUID   `json:"id"`
+		Title            string      `json:"title"`
+		FirstReleaseDate string      `json:"first-release-date"`
+		Genres           []mbGenre   `json:"genres"`
+		Releases         []mbRelease `json:"releases,omitempty"`
+	}
+
+	mbArtistCredit struct {
+		Name   string `json:"name"`
+		Artist struct {
+			ID   uuid.UUID `json:"id"`
+			Name string    `json:"name"`
+			// Person, Group, Orchestra, Choir, Character or Other
+			Type string `json:"type"`
+		} `json:"artist"`
+	}
+
+	mbLabelInfo struct {
+		Label *struct {
+			ID   uuid.UUID `json:"id"`
+			Name string    `json:"name"`
+		} `json:"label"`
+	}
+
+	mbGenre struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	mbMedium struct {
+		Position int       `json:"position"`
+		Tracks   []mbTrack `json:"tracks"`
+	}
+
+	mbTrack struct {
+		Title string `json:"title"`
+		// in milliseconds
+		Length    int64 `json:"length"`
+		Recording struct {
+			ID uuid.UUID `json:"id"`
+		} `json:"recording"`
+	}
+
+	lbListens struct {
+		Payload struct {
+			Count   int `json:"count"`
+			Listens []struct {
+				ListenedAt    int64 `json:"listened_at"`
+				TrackMetadata struct {
+					AdditionalInfo lbMBIDs  `json:"additional_info"`
+					MBIDMapping    *lbMBIDs `json:"mbid_mapping,omitempty"`
+				} `json:"track_metadata"`
+			} `json:"listens"`
+		} `json:"payload"`
+	}
+
+	lbMBIDs struct {
+		ReleaseMBID   string `json:"release_mbid"`
+		RecordingMBID string `json:"recording_mbid"`
+	}
+)
+
+func newMusicBrainzImporter(catalog mbCatalog, log *zerolog.Logger) *musicBrainzImporter {
+	return &musicBrainzImporter{
+		baseURL:       musicBrainzAPI,
+		listensURL:    listenBrainzAPI,
+		client:        &http.Client{Timeout: 15 * time.Second},
+		catalog:       catalog,
+		log:           log,
+		throttle:      &mbThrottle{},
+		interval:      musicBrainzInterval,
+		maxListens:    listenBrainzMaxListens,
+		listensPerReq: listenBrainzPageSize,
+	}
+}
+
+// withCatalog returns a copy of the importer which resolves and saves through the given catalog
+func (mi *musicBrainzImporter) withCatalog(catalog mbCatalog) *musicBrainzImporter {
+	clone := *mi
+	clone.catalog = catalog
+	return &clone
+}
+
+// Import adds a MusicBrainz release to the catalog. For release groups, the earliest
+// official release is used. Albums imported before are looked up by their MBID instead of
+// being added again
+func (mi *musicBrainzImporter) Import(ctx context.Context, uri string) (*media.Album, error) {
+	kind, mbid, err := parseMusicBrainzURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	var group *mbReleaseGroup
+	if kind == "release-group" {
+		group = &mbReleaseGroup{}
+		if err = mi.get(ctx, mi.baseURL+"/release-group/"+mbid.String()+"?inc=releases+genres&fmt=json", group); err != nil {
+			return nil, err
+		}
+		if mbid, err = group.mainRelease(); err != nil {
+			return nil, err
+		}
+	}
+	var release mbRelease
+	err = mi.get(ctx, mi.baseURL+"/release/"+mbid.String()+"?inc=artist-credits+recordings+labels+genres+release-groups&fmt=json", &release)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		group = release.ReleaseGroup
+	}
+
+	album := &media.Album{
+		Name:        release.Title,
+		ReleaseDate: parseMusicBrainzDate(release.Date),
+		MBID:        uuid.NullUUID{UUID: release.ID, Valid: true},
+	}
+	if album.ReleaseDate.IsZero() && group != nil {
+		album.ReleaseDate = parseMusicBrainzDate(group.FirstReleaseDate)
+	}
+	if album.AlbumArtists, err = mi.resolveArtists(ctx, release.ArtistCredit); err != nil {
+		return nil, err
+	}
+	genres := mbGenreNames(release.Genres)
+	if group != nil {
+		genres = append(genres, mbGenreNames(group.Genres)...)
+	}
+	if album.Genres, err = mi.catalog.FindGenres(ctx, "music", genres); err != nil {
+		return nil, err
+	}
+	for i := range release.LabelInfo {
+		label := release.LabelInfo[i].Label
+		if label == nil || label.ID == mbNoLabel || strings.TrimSpace(label.Name) == "" {
+			continue
+		}
+		if album.Studio, err = mi.catalog.ResolveStudio(ctx, label.Name, media.Music); err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	var total time.Duration
+	album.Tracks, total = mbTracks(release.Media)
+	if total > 0 {
+		album.Duration.Time, album.Duration.Valid = time.Time{}.Add(total), true
+	}
+	id, err := mi.catalog.AddAlbum(ctx, album)
+	if err != nil {
+		return nil, err
+	}
+	album.MediaID = &id
+	mi.log.Debug().Msgf("imported MusicBrainz release %s as %s", release.ID, id)
+	return album, nil
+}
+
+// ImportListens turns the recent ListenBrainz listens of a user into rating placeholders
+// for the given member. Only the releases and recordings already in the catalog are matched
+func (mi *musicBrainzImporter) ImportListens(ctx context.Context, memberName, uri string) (*ListenImport, error) {
+	user, err := parseListenBrainzURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	type listened struct {
+		count int
+		last  time.Time
+	}
+	var (
+		summary  ListenImport
+		listens  = make(map[uuid.UUID]*listened)
+		releases = make(map[uuid.UUID]struct{})
+		maxTS    int64
+		count    = func(raw string, at time.Time) (uuid.UUID, bool) {
+			mbid, err := uuid.FromString(raw)
+			if err != nil {
+				return uuid.Nil, false
+			}
+			l, ok := listens[mbid]
+			if !ok {
+				l = &listened{}
+				listens[mbid] = l
+			}
+			l.count++
+			if at.After(l.last) {
+				l.last = at
+			}
+			return mbid, true
+		}
+	)
+	for summary.Listens < mi.maxListens {
+		endpoint := fmt.Sprintf("%s/user/%s/listens?count=%d", mi.listensURL, url.PathEscape(user), mi.listensPerReq)
+		if maxTS > 0 {
+			endpoint += "&max_ts=" + strconv.FormatInt(maxTS, 10)
+		}
+		var page lbListens
+		if err = mi.get(ctx, endpoint, &page); err != nil {
+			return nil, err
+		}
+		for _, l := range page.Payload.Listens {
+			ids := l.TrackMetadata.AdditionalInfo
+			// the mapping is done by ListenBrainz for listens submitted without MBIDs
+			if m := l.TrackMetadata.MBIDMapping; m != nil {
+				if ids.ReleaseMBID == "" {
+					ids.ReleaseMBID = m.ReleaseMBID
+				}
+				if ids.RecordingMBID == "" {
+					ids.RecordingMBID = m.RecordingMBID
+				}
+			}
+			at := time.Unix(l.ListenedAt, 0).UTC()
+			if mbid, ok := count(ids.ReleaseMBID, at); ok {
+				releases[mbid] = struct{}{}
+			}
+			count(ids.RecordingMBID, at)
+			summary.Listens++
+			maxTS = l.ListenedAt
+		}
+		if len(page.Payload.Listens) < mi.listensPerReq {
+			break
+		}
+	}
+	if len(listens) == 0 {
+		return &summary, nil
+	}
+
+	mbids := make([]uuid.UUID, 0, len(listens))
+	for mbid := range listens {
+		mbids = append(mbids, mbid)
+	}
+	known, err := mi.catalog.MediaByMBID(ctx, mbids)
+	if err != nil {
+		return nil, err
+	}
+	placeholders := make([]media.RatingPlaceholder, 0, len(known))
+	for mbid, mediaID := range known {
+		placeholders = append(placeholders, media.RatingPlaceholder{
+			MediaID:      mediaID,
+			Source:       "listenbrainz",
+			Listens:      listens[mbid].count,
+			LastListened: sql.NullTime{Time: listens[mbid].last, Valid: true},
+		})
+	}
+	for mbid := range releases {
+		if _, ok := known[mbid]; !ok {
+			summary.UnmatchedReleases = append(summary.UnmatchedReleases, mbid.String())
+		}
+	}
+	if len(placeholders) > 0 {
+		if summary.Placeholders, err = mi.catalog.SaveRatingPlaceholders(ctx, memberName, placeholders); err != nil {
+			return nil, err
+		}
+	}
+	return &summary, nil
+}
+
+// resolveArtists finds or creates the credited artists by their MBIDs
+func (mi *musicBrainzImporter) resolveArtists(ctx context.Context, credits []mbArtistCredit) ([]media.AlbumArtist, error) {
+	artists := make([]media.AlbumArtist, 0, len(credits))
+	for i := range credits {
+		if credits[i].Artist.ID == mbVariousArtists {
+			continue
+		}
+		var group bool
+		switch credits[i].Artist.Type {
+		case "Group", "Orchestra", "Choir":
+			group = true
+		}
+		artist, err := mi.catalog.ResolveArtistMBID(ctx, credits[i].Artist.ID, credits[i].Artist.Name, group)
+		if err != nil {
+			return nil, err
+		}
+		artists = append(artists, *artist)
+	}
+	return artists, nil
+}
+
+// get fetches a JSON document, spacing out the requests according to the MusicBrainz rate limit
+func (mi *musicBrainzImporter) get(ctx context.Context, endpoint string, dest any) error {
+	mi.throttle.mu.Lock()
+	wait := time.Until(mi.throttle.lastRequest.Add(mi.interval))
+	if wait > 0 {
+		select {
+		case <-ctx.Done():
+			mi.throttle.mu.Unlock()
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	mi.throttle.lastRequest = time.Now()
+	mi.throttle.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("failed to create MusicBrainz request: %v", err)
+	}
+	// MusicBrainz blocks anonymous user agents, and so does Discogs
+	req.Header.Set("User-Agent", discogsUserAgent)
+	req.Header.Set("Accept", "application/json")
+	res, err := mi.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %v", req.URL.Host, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("%w: %s not found", errInvalidImportURI, req.URL.Path)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s from %s for %s", res.Status, req.URL.Host, req.URL.Path)
+	}
+	if err = json.NewDecoder(io.LimitReader(res.Body, 8<<20)).Decode(dest); err != nil {
+		return fmt.Errorf("failed to decode the response for %s: %v", req.URL.Path, err)
+	}
+	return nil
+}
+
+// mainRelease picks the earliest official release of the group, or the earliest release
+// if none is official
+func (g *mbReleaseGroup) mainRelease() (uuid.UUID, error) {
+	var best *mbRelease
+	for i := range g.Releases {
+		r := &g.Releases[i]
+		switch {
+		case best == nil,
+			r.Status == "Official" && best.Status != "Official",
+			r.Status == best.Status && r.Date != "" && (best.Date == "" || r.Date < best.Date):
+			best = r
+		}
+	}
+	if best == nil {
+		return uuid.Nil, fmt.Errorf("%w: release group %s has no releases", errInvalidImportURI, g.ID)
+	}
+	return best.ID, nil
+}
+
+// parseMusicBrainzURI accepts release and release group URLs as well as bare release MBIDs
+func parseMusicBrainzURI(uri string) (kind string, mbid uuid.UUID, err error) {
+	uri = strings.TrimSpace(uri)
+	if mbid, err = uuid.FromString(uri); err == nil {
+		return "release", mbid, nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil || (u.Hostname() != "musicbrainz.org" && !strings.HasSuffix(u.Hostname(), ".musicbrainz.org")) {
+		return "", uuid.Nil, fmt.Errorf("%w: %s is not a MusicBrainz URL", errInvalidImportURI, uri)
+	}
+	match := musicBrainzURLPattern.FindStringSubmatch(u.Path)
+	if match == nil {
+		return "", uuid.Nil, fmt.Errorf("%w: %s is not a MusicBrainz release or release group", errInvalidImportURI, uri)
+	}
+	if mbid, err = uuid.FromString(match[2]); err != nil {
+		return "", uuid.Nil, fmt.Errorf("%w: invalid MBID in %s", errInvalidImportURI, uri)
+	}
+	return match[1], mbid, nil
+}
+
+// isListenBrainzURI tells whether the URI points to a ListenBrainz profile
+func isListenBrainzURI(uri string) bool {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	return err == nil && (u.Hostname() == "listenbrainz.org" || strings.HasSuffix(u.Hostname(), ".listenbrainz.org"))
+}
+
+func parseListenBrainzURI(uri string) (user string, err error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil || !isListenBrainzURI(uri) {
+		return "", fmt.Errorf("%w: %s is not a ListenBrainz URL", errInvalidImportURI, uri)
+	}
+	match := listenBrainzURLPattern.FindStringSubmatch(u.Path)
+	if match == nil {
+		return "", fmt.Errorf("%w: %s is not a ListenBrainz profile", errInvalidImportURI, uri)
+	}
+	return match[1], nil
+}
+
+// parseMusicBrainzDate parses the release date, which can be just the year or year and month
+func parseMusicBrainzDate(date string) time.Time {
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func mbGenreNames(genres []mbGenre) []string {
+	names := make([]string, len(genres))
+	for i := range genres {
+		names[i] = genres[i].Name
+	}
+	return names
+}
+
+// mbTracks numbers the tracks of all media (discs, sides) sequentially and returns the total duration
+func mbTracks(mediums []mbMedium) (tracks []media.Track, total time.Duration) {
+	for i := range mediums {
+		for _, t := range mediums[i].Tracks {
+			duration := time.Duration(t.Length) * time.Millisecond
+			total += duration
+			tracks = append(tracks, media.Track{
+				Name:     t.Title,
+				Duration: time.Time{}.Add(duration),
+				Number:   int16(len(tracks) + 1),
+				MBID:     uuid.NullUUID{UUID: t.Recording.ID, Valid: t.Recording.ID != uuid.Nil},
+			})
+		}
+	}
+	return tracks, total
+}
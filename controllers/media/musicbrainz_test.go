@@ -0,0 +1,183 @@
+package media
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+// fakeMBCatalog keeps the imported albums in memory, keyed by their MBIDs
+type fakeMBCatalog struct {
+	fakeCatalog
+	artistMBIDs  []uuid.UUID
+	media        map[uuid.UUID]uuid.UUID
+	added        int
+	placeholders []media.RatingPlaceholder
+}
+
+func (fc *fakeMBCatalog) ResolveArtistMBID(ctx context.Context, mbid uuid.UUID, name string, group bool) (*media.AlbumArtist, error) {
+	fc.artistMBIDs = append(fc.artistMBIDs, mbid)
+	return fc.ResolveArtist(ctx, name, group)
+}
+
+func (fc *fakeMBCatalog) AddAlbum(_ context.Context, album *media.Album) (uuid.UUID, error) {
+	if id, ok := fc.media[album.MBID.UUID]; ok {
+		return id, nil
+	}
+	fc.added++
+	id := uuid.Must(uuid.NewV4())
+	fc.media[album.MBID.UUID] = id
+	for i := range album.Tracks {
+		fc.media[album.Tracks[i].MBID.UUID] = uuid.Must(uuid.NewV4())
+	}
+	return id, nil
+}
+
+func (fc *fakeMBCatalog) MediaByMBID(_ context.Context, mbids []uuid.UUID) (map[uuid.UUID]uuid.UUID, error) {
+	found := make(map[uuid.UUID]uuid.UUID)
+	for _, mbid := range mbids {
+		if id, ok := fc.media[mbid]; ok {
+			found[mbid] = id
+		}
+	}
+	return found, nil
+}
+
+func (fc *fakeMBCatalog) SaveRatingPlaceholders(_ context.Context, _ string, placeholders []media.RatingPlaceholder) (int, error) {
+	fc.placeholders = append(fc.placeholders, placeholders...)
+	return len(placeholders), nil
+}
+
+// newBrainzFixtures serves the recorded MusicBrainz and ListenBrainz responses. Paginated
+// listens are stored with the max_ts parameter as the file name suffix
+func newBrainzFixtures(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("User-Agent"), "LibRate") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		path := filepath.FromSlash(r.URL.Path)
+		if maxTS := r.URL.Query().Get("max_ts"); maxTS != "" {
+			path += "_" + maxTS
+		}
+		http.ServeFile(w, r, filepath.Join("testdata", path+".json"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestMusicBrainzImporter(t *testing.T, catalog *fakeMBCatalog) *musicBrainzImporter {
+	log := zerolog.Nop()
+	mi := newMusicBrainzImporter(catalog, &log)
+	srv := newBrainzFixtures(t)
+	mi.baseURL = srv.URL + "/musicbrainz"
+	mi.listensURL = srv.URL + "/listenbrainz"
+	mi.interval = 0
+	mi.listensPerReq = 2
+	return mi
+}
+
+func TestMusicBrainzRelease(t *testing.T) {
+	catalog := &fakeMBCatalog{
+		fakeCatalog: fakeCatalog{genres: []media.Genre{{ID: 3, Name: "Trip Hop"}, {ID: 5, Name: "Downtempo"}}},
+		media:       make(map[uuid.UUID]uuid.UUID),
+	}
+	mi := newTestMusicBrainzImporter(t, catalog)
+
+	album, err := mi.Import(context.Background(), "https://musicbrainz.org/release/2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21")
+	require.NoError(t, err)
+
+	require.NotNil(t, album.MediaID)
+	assert.Equal(t, "Mezzanine", album.Name)
+	assert.Equal(t, "2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21", album.MBID.UUID.String())
+	assert.Equal(t, time.Date(1998, time.April, 20, 0, 0, 0, 0, time.UTC), album.ReleaseDate)
+	require.Len(t, album.AlbumArtists, 1)
+	assert.Equal(t, "group", album.AlbumArtists[0].ArtistType)
+	assert.Equal(t, []uuid.UUID{uuid.Must(uuid.FromString("10adbe5e-a2c0-4bf3-8249-2b4cbf6e6ca8"))}, catalog.artistMBIDs)
+	require.Len(t, album.Genres, 2, "genres of the release group should be included")
+	assert.Equal(t, []string{"Circa"}, catalog.studios)
+
+	require.Len(t, album.Tracks, 3)
+	assert.Equal(t, "Teardrop", album.Tracks[2].Name)
+	assert.EqualValues(t, 3, album.Tracks[2].Number, "tracks should be numbered across discs")
+	assert.Equal(t, "0e2d4b8b-1c3d-4e0f-8a7b-5f6c7d8e9f03", album.Tracks[2].MBID.UUID.String())
+	assert.Equal(t, 16*time.Minute+47*time.Second, album.Duration.Time.Sub(time.Time{}))
+
+	again, err := mi.Import(context.Background(), "2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21")
+	require.NoError(t, err)
+	assert.Equal(t, *album.MediaID, *again.MediaID, "re-imports should resolve to the same album")
+	assert.Equal(t, 1, catalog.added)
+}
+
+func TestMusicBrainzReleaseGroup(t *testing.T) {
+	catalog := &fakeMBCatalog{media: make(map[uuid.UUID]uuid.UUID)}
+	mi := newTestMusicBrainzImporter(t, catalog)
+
+	album, err := mi.Import(context.Background(), "https://musicbrainz.org/release-group/8a6d1d62-1a29-3f5b-8c8c-2b9d0c2f3c11")
+	require.NoError(t, err)
+	assert.Equal(t, "2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21", album.MBID.UUID.String(),
+		"the earliest official release should be picked")
+}
+
+func TestMusicBrainzNotFound(t *testing.T) {
+	mi := newTestMusicBrainzImporter(t, &fakeMBCatalog{media: make(map[uuid.UUID]uuid.UUID)})
+	_, err := mi.Import(context.Background(), "https://musicbrainz.org/release/00000000-0000-4000-8000-000000000000")
+	assert.ErrorIs(t, err, errInvalidImportURI)
+}
+
+func TestListenBrainzListens(t *testing.T) {
+	catalog := &fakeMBCatalog{media: make(map[uuid.UUID]uuid.UUID)}
+	mi := newTestMusicBrainzImporter(t, catalog)
+	album, err := mi.Import(context.Background(), "2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21")
+	require.NoError(t, err)
+
+	summary, err := mi.ImportListens(context.Background(), "lain", "https://listenbrainz.org/user/alice/")
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, summary.Listens)
+	assert.Equal(t, 3, summary.Placeholders, "the album and the two tracks listened to")
+	assert.Equal(t, []string{"76df3287-6cda-33eb-8e9a-044b5e15ffdd"}, summary.UnmatchedReleases)
+	for _, p := range catalog.placeholders {
+		assert.Equal(t, "listenbrainz", p.Source)
+		if p.MediaID == *album.MediaID {
+			assert.Equal(t, 2, p.Listens)
+			assert.Equal(t, time.Unix(1760000300, 0).UTC(), p.LastListened.Time)
+		}
+	}
+}
+
+func TestParseMusicBrainzURI(t *testing.T) {
+	cases := []struct {
+		uri, kind string
+		valid     bool
+	}{
+		{uri: "https://musicbrainz.org/release/2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21", kind: "release", valid: true},
+		{uri: "https://beta.musicbrainz.org/release-group/8a6d1d62-1a29-3f5b-8c8c-2b9d0c2f3c11/", kind: "release-group", valid: true},
+		{uri: " 2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21 ", kind: "release", valid: true},
+		{uri: "https://musicbrainz.org/artist/10adbe5e-a2c0-4bf3-8249-2b4cbf6e6ca8"},
+		{uri: "https://musicbrainz.org.example.com/release/2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21"},
+	}
+	for _, tc := range cases {
+		kind, _, err := parseMusicBrainzURI(tc.uri)
+		if !tc.valid {
+			assert.ErrorIs(t, err, errInvalidImportURI, tc.uri)
+			continue
+		}
+		require.NoError(t, err, tc.uri)
+		assert.Equal(t, tc.kind, kind)
+	}
+	assert.Equal(t, time.Date(1998, time.April, 1, 0, 0, 0, 0, time.UTC), parseMusicBrainzDate("1998-04"))
+	assert.True(t, parseMusicBrainzDate("").IsZero())
+}
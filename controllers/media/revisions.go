@@ -0,0 +1,199 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+
+	h "codeberg.org/mjh/LibRate/internal/handlers"
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+const (
+	defaultRevisionLimit = 50
+	maxRevisionLimit     = 500
+)
+
+type (
+	// revisionStorage is implemented by media.Storage
+	revisionStorage interface {
+		Revise(ctx context.Context, target, id string, doc json.RawMessage, editor, summary string) (*media.Revision, error)
+		Revert(ctx context.Context, revisionID int64, editor, summary string) (*media.Revision, error)
+		Revisions(ctx context.Context, target, id string, limit, offset int) ([]media.Revision, error)
+		Revision(ctx context.Context, id int64) (*media.Revision, error)
+	}
+
+	// EditInput is an edit of a media item, person or genre
+	EditInput struct {
+		// the changed fields of the object, in the same format as it's returned in
+		Document json.RawMessage `json:"document" swaggertype:"object"`
+		Summary  string          `json:"summary,omitempty" example:"Fixed the release date"`
+	}
+
+	// RevisionDiff lists the changes between two versions of an object
+	RevisionDiff struct {
+		From    int64               `json:"from" example:"12"`
+		To      int64               `json:"to" example:"15"`
+		Changes []media.FieldChange `json:"changes"`
+	}
+)
+
+// @Summary List the revisions
+// @Description Lists the edits of a media item, person or genre, newest first
+// @Tags media,history
+// @Produce json
+// @Param target path string true "The kind of the object" Enums(media, album, film, book, person, genre)
+// @Param id path string true "UUID of the media item or person, or the ID of the genre"
+// @Param limit query int false "Page size" default(50)
+// @Param offset query int false "Offset" default(0)
+// @Success 200 {object} h.ResponseHTTP{data=[]media.Revision}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /revisions/{target}/{id} [get]
+func (mc *Controller) GetRevisions(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", defaultRevisionLimit)
+	if limit <= 0 || limit > maxRevisionLimit {
+		limit = defaultRevisionLimit
+	}
+	offset := max(c.QueryInt("offset", 0), 0)
+	revisions, err := mc.revisions.Revisions(c.UserContext(), c.Params("target"), c.Params("id"), limit, offset)
+	if err != nil {
+		return mc.handleRevisionError(c, "list the revisions", err)
+	}
+	return h.ResData(c, fiber.StatusOK, "success", revisions)
+}
+
+// @Summary Diff revisions
+// @Description Lists the fields changed by the revision. With the `to` parameter,
+// @Description the object after the revision is compared with the object after the other revision instead
+// @Tags media,history
+// @Produce json
+// @Param id path int true "Revision ID"
+// @Param to query int false "ID of a later revision of the same object"
+// @Success 200 {object} h.ResponseHTTP{data=RevisionDiff}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /revisions/{id}/diff [get]
+func (mc *Controller) DiffRevisions(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return handleBadRequest(mc.storage.Log, c, "Invalid revision ID")
+	}
+	from, err := mc.revisions.Revision(c.UserContext(), id)
+	if err != nil {
+		return mc.handleRevisionError(c, "get the revision", err)
+	}
+	diff := RevisionDiff{From: from.ID, To: from.ID}
+	before, after := from.Before, from.After
+
+	if c.Query("to") != "" {
+		toID, err := strconv.ParseInt(c.Query("to"), 10, 64)
+		if err != nil {
+			return handleBadRequest(mc.storage.Log, c, "Invalid revision ID")
+		}
+		to, err := mc.revisions.Revision(c.UserContext(), toID)
+		if err != nil {
+			return mc.handleRevisionError(c, "get the revision", err)
+		}
+		if to.Target != from.Target || to.TargetID != from.TargetID {
+			return handleBadRequest(mc.storage.Log, c, "The revisions are of different objects")
+		}
+		diff.To, before, after = to.ID, from.After, to.After
+	}
+
+	if diff.Changes, err = media.Diff(before, after); err != nil {
+		return handleInternalError(mc.storage.Log, c, "Failed to diff the revisions", err)
+	}
+	return h.ResData(c, fiber.StatusOK, "success", diff)
+}
+
+// @Summary Edit a media item, person or genre
+// @Description Changes the fields present in the document and records the edit as a revision.
+// @Description IDs, media kinds and moderation statuses can't be edited
+// @Tags media,history
+// @Accept json
+// @Produce json
+// @Param target path string true "The kind of the object" Enums(media, album, film, book, person, genre)
+// @Param id path string true "UUID of the media item or person, or the ID of the genre"
+// @Param input body EditInput true "The edit"
+// @Param X-CSRF-Token header string true "X-CSRF-Token header"
+// @Success 200 {object} h.ResponseHTTP{data=media.Revision}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /revisions/{target}/{id} [put]
+func (mc *Controller) Edit(c *fiber.Ctx) error {
+	var input EditInput
+	if err := c.BodyParser(&input); err != nil || len(input.Document) == 0 {
+		return handleBadRequest(mc.storage.Log, c, "Invalid edit")
+	}
+	rev, err := mc.revisions.Revise(c.UserContext(), c.Params("target"), c.Params("id"),
+		input.Document, editorWebfinger(c), input.Summary)
+	if err != nil {
+		return mc.handleRevisionError(c, "edit", err)
+	}
+	return h.ResData(c, fiber.StatusOK, "success", rev)
+}
+
+// @Summary Revert a revision
+// @Description Restores the object to its state before the revision, undoing the later revisions too
+// @Tags media,history
+// @Accept json
+// @Produce json
+// @Param id path int true "Revision ID"
+// @Param input body EditInput false "Only the summary is read"
+// @Param X-CSRF-Token header string true "X-CSRF-Token header"
+// @Success 200 {object} h.ResponseHTTP{data=media.Revision}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /revisions/{id}/revert [post]
+func (mc *Controller) RevertRevision(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return handleBadRequest(mc.storage.Log, c, "Invalid revision ID")
+	}
+	var input EditInput
+	// the summary is optional
+	_ = c.BodyParser(&input)
+	rev, err := mc.revisions.Revert(c.UserContext(), id, editorWebfinger(c), input.Summary)
+	if err != nil {
+		return mc.handleRevisionError(c, "revert", err)
+	}
+	return h.ResData(c, fiber.StatusOK, "success", rev)
+}
+
+func (mc *Controller) handleRevisionError(c *fiber.Ctx, action string, err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return h.Res(c, fiber.StatusNotFound, "Not found")
+	case errors.Is(err, media.ErrNoChanges):
+		return handleBadRequest(mc.storage.Log, c, "Nothing changed")
+	case errors.Is(err, media.ErrUnknownTarget):
+		return handleBadRequest(mc.storage.Log, c, "Invalid target")
+	case errors.Is(err, media.ErrInvalidKey):
+		return handleBadRequest(mc.storage.Log, c, "Invalid ID")
+	case errors.Is(err, media.ErrInvalidTitle):
+		return handleBadRequest(mc.storage.Log, c, err.Error())
+	case errors.As(err, new(*json.SyntaxError)), errors.As(err, new(*json.UnmarshalTypeError)):
+		return handleBadRequest(mc.storage.Log, c, err.Error())
+	default:
+		return handleInternalError(mc.storage.Log, c, "Failed to "+action, err)
+	}
+}
+
+// editorWebfinger returns the webfinger of the member who sent the request
+func editorWebfinger(c *fiber.Ctx) string {
+	token, ok := c.Locals("jwtToken").(*jwt.Token)
+	if !ok {
+		return ""
+	}
+	wf, _ := token.Claims.(jwt.MapClaims)["webfinger"].(string)
+	return wf
+}
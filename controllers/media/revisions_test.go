@@ -0,0 +1,174 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/models/media"
+	"codeberg.org/mjh/LibRate/tests"
+)
+
+// memoryRevisions keeps the objects as flat JSON documents
+type memoryRevisions struct {
+	objects   map[string]map[string]json.RawMessage
+	revisions []media.Revision
+}
+
+func (m *memoryRevisions) Revise(_ context.Context, target, id string, doc json.RawMessage, editor, summary string) (*media.Revision, error) {
+	return m.revise(target, id, doc, editor, summary, sql.NullInt64{})
+}
+
+func (m *memoryRevisions) revise(target, id string, doc json.RawMessage, editor, summary string, reverts sql.NullInt64) (*media.Revision, error) {
+	object, ok := m.objects[target+"/"+id]
+	if !ok {
+		return nil, fmt.Errorf("error loading %s %s: %w", target, id, sql.ErrNoRows)
+	}
+	// fiber reuses the memory of the path parameters
+	target, id = strings.Clone(target), strings.Clone(id)
+	rev := media.Revision{Target: target, TargetID: id, Editor: editor, Summary: summary, Reverts: reverts}
+	rev.Before, _ = json.Marshal(object)
+	if err := json.Unmarshal(doc, &object); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", target, err)
+	}
+	rev.After, _ = json.Marshal(object)
+	if bytes.Equal(rev.Before, rev.After) {
+		return nil, media.ErrNoChanges
+	}
+	rev.ID = int64(len(m.revisions) + 1)
+	rev.Created = time.Now()
+	m.revisions = append(m.revisions, rev)
+	return &rev, nil
+}
+
+func (m *memoryRevisions) Revert(ctx context.Context, revisionID int64, editor, summary string) (*media.Revision, error) {
+	reverted, err := m.Revision(ctx, revisionID)
+	if err != nil {
+		return nil, err
+	}
+	return m.revise(reverted.Target, reverted.TargetID, reverted.Before, editor, summary,
+		sql.NullInt64{Int64: revisionID, Valid: true})
+}
+
+func (m *memoryRevisions) Revisions(_ context.Context, target, id string, _, _ int) ([]media.Revision, error) {
+	if target != media.RevisionAlbum && target != media.RevisionGenre {
+		return nil, media.ErrUnknownTarget
+	}
+	revisions := make([]media.Revision, 0)
+	for i := len(m.revisions) - 1; i >= 0; i-- {
+		if m.revisions[i].Target == target && m.revisions[i].TargetID == id {
+			revisions = append(revisions, m.revisions[i])
+		}
+	}
+	return revisions, nil
+}
+
+func (m *memoryRevisions) Revision(_ context.Context, id int64) (*media.Revision, error) {
+	if id <= 0 || id > int64(len(m.revisions)) {
+		return nil, sql.ErrNoRows
+	}
+	return &m.revisions[id-1], nil
+}
+
+func newRevisionsApp(revisions *memoryRevisions) *fiber.App {
+	log := zerolog.Nop()
+	mc := &Controller{storage: media.Storage{Log: &log}, revisions: revisions}
+	app := fiber.New()
+	app.Use(tests.FakeAuth)
+	app.Get("/revisions/:id/diff", mc.DiffRevisions)
+	app.Post("/revisions/:id/revert", mc.RevertRevision)
+	app.Get("/revisions/:target/:id", mc.GetRevisions)
+	app.Put("/revisions/:target/:id", mc.Edit)
+	return app
+}
+
+func TestEditAndRevert(t *testing.T) {
+	album := "/revisions/album/2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21"
+	revisions := &memoryRevisions{objects: map[string]map[string]json.RawMessage{
+		"album/2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21": {
+			"name":         json.RawMessage(`"Mezzanine"`),
+			"release_date": json.RawMessage(`"1998-04-02T00:00:00Z"`),
+		},
+	}}
+	app := newRevisionsApp(revisions)
+
+	status, _ := tests.JSONRequest(t, app, fiber.MethodPut, album, "lain", `{"summary":"nothing"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status, "an edit needs a document")
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPut, album, "lain",
+		`{"document":{"release_date":"1998-04-02T00:00:00Z"}}`)
+	assert.Equal(t, fiber.StatusBadRequest, status, "edits which change nothing shouldn't be recorded")
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPut, "/revisions/album/0c6f2b1e-0000-4000-8000-000000000000", "lain",
+		`{"document":{"name":"Blue Lines"}}`)
+	assert.Equal(t, fiber.StatusNotFound, status)
+
+	status, data := tests.JSONRequest(t, app, fiber.MethodPut, album, "lain",
+		`{"document":{"release_date":"1998-04-20T00:00:00Z"},"summary":"Fixed the release date"}`)
+	require.Equal(t, fiber.StatusOK, status)
+	var rev media.Revision
+	require.NoError(t, json.Unmarshal(data, &rev))
+	assert.Equal(t, "lain@librate.club", rev.Editor)
+	assert.Equal(t, "Fixed the release date", rev.Summary)
+
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPut, album, "lain", `{"document":{"name":"Mezzanine (Deluxe)"}}`)
+	require.Equal(t, fiber.StatusOK, status)
+
+	status, data = tests.JSONRequest(t, app, fiber.MethodGet, "/revisions/1/diff", "lain", "")
+	require.Equal(t, fiber.StatusOK, status)
+	var diff RevisionDiff
+	require.NoError(t, json.Unmarshal(data, &diff))
+	require.Len(t, diff.Changes, 1)
+	assert.Equal(t, "release_date", diff.Changes[0].Field)
+
+	status, data = tests.JSONRequest(t, app, fiber.MethodGet, "/revisions/1/diff?to=2", "lain", "")
+	require.Equal(t, fiber.StatusOK, status)
+	require.NoError(t, json.Unmarshal(data, &diff))
+	require.Len(t, diff.Changes, 1)
+	assert.Equal(t, "name", diff.Changes[0].Field, "only the changes made after the first revision should be listed")
+
+	status, data = tests.JSONRequest(t, app, fiber.MethodPost, "/revisions/1/revert", "lain", "")
+	require.Equal(t, fiber.StatusOK, status)
+	require.NoError(t, json.Unmarshal(data, &rev))
+	assert.Equal(t, sql.NullInt64{Int64: 1, Valid: true}, rev.Reverts)
+	assert.JSONEq(t, `{"name":"Mezzanine","release_date":"1998-04-02T00:00:00Z"}`, string(rev.After),
+		"the later revisions should be undone too")
+
+	status, data = tests.JSONRequest(t, app, fiber.MethodGet, album, "lain", "")
+	require.Equal(t, fiber.StatusOK, status)
+	var listed []media.Revision
+	require.NoError(t, json.Unmarshal(data, &listed))
+	require.Len(t, listed, 3)
+	assert.Equal(t, int64(3), listed[0].ID, "the newest revision should be first")
+
+	status, _ = tests.JSONRequest(t, app, fiber.MethodGet, "/revisions/single/2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21", "lain", "")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, "/revisions/9/revert", "lain", "")
+	assert.Equal(t, fiber.StatusNotFound, status)
+}
+
+func TestDiffRevisionsOfDifferentObjects(t *testing.T) {
+	revisions := &memoryRevisions{objects: map[string]map[string]json.RawMessage{
+		"genre/3": {"name": json.RawMessage(`"Trip Hop"`)},
+		"genre/9": {"name": json.RawMessage(`"Downtempo"`)},
+	}}
+	app := newRevisionsApp(revisions)
+
+	status, _ := tests.JSONRequest(t, app, fiber.MethodPut, "/revisions/genre/3", "lain", `{"document":{"name":"Trip-Hop"}}`)
+	require.Equal(t, fiber.StatusOK, status)
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPut, "/revisions/genre/9", "lain", `{"document":{"name":"Chillout"}}`)
+	require.Equal(t, fiber.StatusOK, status)
+
+	status, _ = tests.JSONRequest(t, app, fiber.MethodGet, "/revisions/1/diff?to=2", "lain", "")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	status, _ = tests.JSONRequest(t, app, fiber.MethodGet, "/revisions/one/diff", "lain", "")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
@@ -0,0 +1,342 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+const (
+	previewNew     = "new"
+	previewMatched = "matched"
+	// genres which aren't in the catalog are dropped, imports never add them
+	previewSkipped = "skipped"
+)
+
+type (
+	// importCatalog is the catalog the import jobs are committed to. The lookups which
+	// never add anything are used for previewing the changes
+	importCatalog interface {
+		mbCatalog
+		FindArtist(ctx context.Context, mbid uuid.NullUUID, name string, group bool) (*media.AlbumArtist, error)
+		FindStudio(ctx context.Context, name string, kind media.StudioKind) (*media.Studio, error)
+	}
+
+	// committer is implemented by catalogs which hold back the changes until the import is
+	// confirmed, so the steps which need the saved media have to wait for the commit too
+	committer interface {
+		onCommit(step func(ctx context.Context) error)
+	}
+
+	// ImportPreview is the diff between the imported data and the catalog
+	ImportPreview struct {
+		Artists []PreviewEntry `json:"artists"`
+		Studios []PreviewEntry `json:"studios,omitempty"`
+		Genres  []PreviewEntry `json:"genres"`
+		// albums, which are the only media saved by imports so far
+		Media  []PreviewEntry `json:"media,omitempty"`
+		Tracks []PreviewEntry `json:"tracks,omitempty"`
+		// the number of listened to albums and tracks to be marked for rating
+		Placeholders int `json:"placeholders,omitempty" example:"12"`
+	}
+
+	// PreviewEntry is an artist, label, genre or media item found in the imported data
+	PreviewEntry struct {
+		Name   string `json:"name" example:"Massive Attack"`
+		Status string `json:"status" enum:"new,matched,skipped" example:"matched"`
+		// the ID of the matched catalog entry
+		ID string `json:"id,omitempty"`
+		// the album of a track
+		Album string `json:"album,omitempty"`
+	}
+
+	// stagingCatalog resolves the artists, labels and genres of an import against the catalog
+	// without adding anything, and records the changes to be made once the import is confirmed.
+	// The new artists and labels get temporary IDs, which are replaced when they're committed
+	stagingCatalog struct {
+		catalog      importCatalog
+		preview      ImportPreview
+		artists      []stagedArtist
+		studios      []stagedStudio
+		albums       []*media.Album
+		placeholders []stagedPlaceholders
+		steps        []func(ctx context.Context) error
+		// the temporary IDs mapped onto the committed ones
+		artistIDs map[uuid.UUID]uuid.UUID
+		studioIDs map[int32]int32
+	}
+
+	stagedArtist struct {
+		mbid  uuid.NullUUID
+		name  string
+		group bool
+		id    uuid.UUID
+	}
+
+	stagedStudio struct {
+		name string
+		kind media.StudioKind
+		id   int32
+	}
+
+	stagedPlaceholders struct {
+		member       string
+		placeholders []media.RatingPlaceholder
+	}
+)
+
+func newStagingCatalog(catalog importCatalog) *stagingCatalog {
+	return &stagingCatalog{
+		catalog: catalog,
+		preview: ImportPreview{Artists: []PreviewEntry{}, Genres: []PreviewEntry{}},
+	}
+}
+
+// afterSave runs the step right away, unless the catalog only stages the changes, in which
+// case it's run after they're committed
+func afterSave(ctx context.Context, catalog any, step func(ctx context.Context) error) error {
+	if c, ok := catalog.(committer); ok {
+		c.onCommit(step)
+		return nil
+	}
+	return step(ctx)
+}
+
+func (sc *stagingCatalog) onCommit(step func(ctx context.Context) error) {
+	sc.steps = append(sc.steps, step)
+}
+
+// FindGenres looks up the genres, noting which of the names are skipped
+func (sc *stagingCatalog) FindGenres(ctx context.Context, kind string, names []string) ([]media.Genre, error) {
+	genres, err := sc.catalog.FindGenres(ctx, kind, names)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || sc.listed(sc.preview.Genres, name) {
+			continue
+		}
+		entry := PreviewEntry{Name: name, Status: previewSkipped}
+		for i := range genres {
+			if strings.EqualFold(genres[i].Name, name) {
+				entry = PreviewEntry{Name: genres[i].Name, Status: previewMatched, ID: strconv.FormatInt(genres[i].ID, 10)}
+				break
+			}
+		}
+		sc.preview.Genres = append(sc.preview.Genres, entry)
+	}
+	return genres, nil
+}
+
+func (sc *stagingCatalog) ResolveArtist(ctx context.Context, name string, group bool) (*media.AlbumArtist, error) {
+	return sc.resolveArtist(ctx, uuid.NullUUID{}, name, group)
+}
+
+func (sc *stagingCatalog) ResolveArtistMBID(ctx context.Context, mbid uuid.UUID, name string, group bool) (*media.AlbumArtist, error) {
+	return sc.resolveArtist(ctx, uuid.NullUUID{UUID: mbid, Valid: true}, name, group)
+}
+
+func (sc *stagingCatalog) resolveArtist(ctx context.Context, mbid uuid.NullUUID, name string, group bool) (*media.AlbumArtist, error) {
+	name = strings.TrimSpace(name)
+	artistType := "individual"
+	if group {
+		artistType = "group"
+	}
+	for _, a := range sc.artists {
+		if a.group == group && ((mbid.Valid && a.mbid == mbid) || strings.EqualFold(a.name, name)) {
+			return &media.AlbumArtist{ID: a.id, Name: a.name, ArtistType: artistType}, nil
+		}
+	}
+
+	staged := stagedArtist{mbid: mbid, name: name, group: group}
+	entry := PreviewEntry{Name: name, Status: previewMatched}
+	artist, err := sc.catalog.FindArtist(ctx, mbid, name, group)
+	switch {
+	case err == nil:
+		staged.id = artist.ID
+		entry.ID = artist.ID.String()
+	case errors.Is(err, sql.ErrNoRows):
+		staged.id = uuid.Must(uuid.NewV4())
+		entry.Status = previewNew
+	default:
+		return nil, err
+	}
+	sc.artists = append(sc.artists, staged)
+	sc.preview.Artists = append(sc.preview.Artists, entry)
+	return &media.AlbumArtist{ID: staged.id, Name: name, ArtistType: artistType}, nil
+}
+
+// ResolveStudio looks up the studio. New studios get negative temporary IDs
+func (sc *stagingCatalog) ResolveStudio(ctx context.Context, name string, kind media.StudioKind) (*media.Studio, error) {
+	name = strings.TrimSpace(name)
+	for _, s := range sc.studios {
+		if s.kind == kind && strings.EqualFold(s.name, name) {
+			return &media.Studio{ID: s.id, Name: s.name, Active: true}, nil
+		}
+	}
+
+	staged := stagedStudio{name: name, kind: kind}
+	entry := PreviewEntry{Name: name, Status: previewMatched}
+	studio, err := sc.catalog.FindStudio(ctx, name, kind)
+	switch {
+	case err == nil:
+		staged.id = studio.ID
+		entry.ID = strconv.Itoa(int(studio.ID))
+	case errors.Is(err, sql.ErrNoRows):
+		staged.id = -int32(len(sc.studios) + 1)
+		entry.Status = previewNew
+	default:
+		return nil, err
+	}
+	sc.studios = append(sc.studios, staged)
+	sc.preview.Studios = append(sc.preview.Studios, entry)
+	return &media.Studio{ID: staged.id, Name: name, Active: true}, nil
+}
+
+// AddAlbum stages the album, unless it's matched by its MBID, in which case the existing
+// album's ID is returned, like the catalog itself does
+func (sc *stagingCatalog) AddAlbum(ctx context.Context, album *media.Album) (uuid.UUID, error) {
+	status, id := previewNew, uuid.Must(uuid.NewV4())
+	if album.MBID.Valid {
+		known, err := sc.catalog.MediaByMBID(ctx, []uuid.UUID{album.MBID.UUID})
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if existing, ok := known[album.MBID.UUID]; ok {
+			status, id = previewMatched, existing
+		}
+	}
+	entry := PreviewEntry{Name: album.Name, Status: status}
+	if status == previewMatched {
+		entry.ID = id.String()
+	} else {
+		sc.albums = append(sc.albums, album)
+	}
+	sc.preview.Media = append(sc.preview.Media, entry)
+	for i := range album.Tracks {
+		sc.preview.Tracks = append(sc.preview.Tracks, PreviewEntry{Name: album.Tracks[i].Name, Status: status, Album: album.Name})
+	}
+	return id, nil
+}
+
+func (sc *stagingCatalog) MediaByMBID(ctx context.Context, mbids []uuid.UUID) (map[uuid.UUID]uuid.UUID, error) {
+	return sc.catalog.MediaByMBID(ctx, mbids)
+}
+
+func (sc *stagingCatalog) SaveRatingPlaceholders(_ context.Context, memberName string, placeholders []media.RatingPlaceholder) (int, error) {
+	sc.placeholders = append(sc.placeholders, stagedPlaceholders{member: memberName, placeholders: placeholders})
+	sc.preview.Placeholders += len(placeholders)
+	return len(placeholders), nil
+}
+
+// commit adds the staged artists, labels and albums to the catalog and replaces the
+// temporary IDs in the result of the import. Each album is saved in its own transaction,
+// so an import which fails halfway can leave the artists of the remaining albums behind
+func (sc *stagingCatalog) commit(ctx context.Context, result any) error {
+	sc.artistIDs = make(map[uuid.UUID]uuid.UUID, len(sc.artists))
+	for _, a := range sc.artists {
+		var (
+			artist *media.AlbumArtist
+			err    error
+		)
+		if a.mbid.Valid {
+			artist, err = sc.catalog.ResolveArtistMBID(ctx, a.mbid.UUID, a.name, a.group)
+		} else {
+			artist, err = sc.catalog.ResolveArtist(ctx, a.name, a.group)
+		}
+		if err != nil {
+			return err
+		}
+		sc.artistIDs[a.id] = artist.ID
+	}
+	sc.studioIDs = make(map[int32]int32, len(sc.studios))
+	for _, s := range sc.studios {
+		studio, err := sc.catalog.ResolveStudio(ctx, s.name, s.kind)
+		if err != nil {
+			return err
+		}
+		sc.studioIDs[s.id] = studio.ID
+	}
+
+	for _, album := range sc.albums {
+		sc.relinkAlbum(album)
+		if _, err := sc.catalog.AddAlbum(ctx, album); err != nil {
+			return fmt.Errorf("failed to save %s: %w", album.Name, err)
+		}
+	}
+	for _, p := range sc.placeholders {
+		if _, err := sc.catalog.SaveRatingPlaceholders(ctx, p.member, p.placeholders); err != nil {
+			return err
+		}
+	}
+	for _, step := range sc.steps {
+		if err := step(ctx); err != nil {
+			return err
+		}
+	}
+	sc.relink(result)
+	return nil
+}
+
+// relink replaces the temporary IDs in the results of the importers which don't save
+// anything themselves, e.g. the people of films and books imported from Wikidata
+func (sc *stagingCatalog) relink(result any) {
+	switch r := result.(type) {
+	case *media.Album:
+		sc.relinkAlbum(r)
+	case []*media.Album:
+		for _, album := range r {
+			sc.relinkAlbum(album)
+		}
+	case *WikidataImport:
+		if r.Film != nil {
+			sc.relinkPeople(r.Film.Cast.Directors)
+			sc.relinkPeople(r.Film.Cast.Actors)
+		}
+		if r.Book != nil {
+			sc.relinkPeople(r.Book.Authors)
+			if id, ok := sc.studioIDs[r.Book.Publisher.ID]; ok {
+				r.Book.Publisher.ID = id
+			}
+		}
+	}
+}
+
+func (sc *stagingCatalog) relinkAlbum(album *media.Album) {
+	for i := range album.AlbumArtists {
+		if id, ok := sc.artistIDs[album.AlbumArtists[i].ID]; ok {
+			album.AlbumArtists[i].ID = id
+		}
+	}
+	if album.Studio != nil {
+		if id, ok := sc.studioIDs[album.Studio.ID]; ok {
+			album.Studio.ID = id
+		}
+	}
+}
+
+func (sc *stagingCatalog) relinkPeople(people []media.Person) {
+	for i := range people {
+		if id, ok := sc.artistIDs[people[i].ID]; ok {
+			people[i].ID = id
+		}
+	}
+}
+
+// listed tells whether the name is among the entries already
+func (sc *stagingCatalog) listed(entries []PreviewEntry, name string) bool {
+	for i := range entries {
+		if strings.EqualFold(entries[i].Name, name) {
+			return true
+		}
+	}
+	return false
+}
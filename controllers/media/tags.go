@@ -0,0 +1,216 @@
+package media
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+
+	"codeberg.org/mjh/LibRate/internal/lib/audiotags"
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+// errInvalidTags is returned for files which are neither supported audio files nor tag dumps
+var errInvalidTags = errors.New("unreadable tags")
+
+// the extensions of the files read by ImportTagFiles
+var tagFileExtensions = []string{".mp3", ".flac", ".ogg", ".oga", ".opus", ".json"}
+
+// tagImporter groups the tags of audio files into albums and adds them to the catalog
+type tagImporter struct {
+	catalog albumSaver
+	log     *zerolog.Logger
+}
+
+func newTagImporter(catalog albumSaver, log *zerolog.Logger) *tagImporter {
+	return &tagImporter{catalog: catalog, log: log}
+}
+
+// withCatalog returns a copy of the importer which resolves and saves through the given catalog
+func (ti *tagImporter) withCatalog(catalog albumSaver) *tagImporter {
+	clone := *ti
+	clone.catalog = catalog
+	return &clone
+}
+
+// ImportTagFiles reads the audio files and JSON tag dumps at the given paths, walking directories
+// recursively, and adds the albums they make up to the catalog. Unreadable files are skipped.
+// It's the implementation of the -import-tags mode of the server binary
+func ImportTagFiles(ctx context.Context, storage *media.Storage, paths []string) ([]*media.Album, error) {
+	var tracks []audiotags.Tags
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !slices.Contains(tagFileExtensions, strings.ToLower(filepath.Ext(path))) {
+				return nil
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			read, err := readTags(path, f)
+			if err != nil {
+				storage.Log.Warn().Err(err).Msgf("skipping %s", path)
+				return nil
+			}
+			tracks = append(tracks, read...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	catalog := storageCatalog{Storage: storage, PeopleStorage: storage.Ps}
+	return newTagImporter(catalog, storage.Log).Import(ctx, tracks)
+}
+
+// readTags reads the tags of an audio file, or a JSON dump of the tags of one or more tracks,
+// made by a client which read the files itself
+func readTags(name string, r io.ReadSeeker) ([]audiotags.Tags, error) {
+	if !strings.EqualFold(filepath.Ext(name), ".json") {
+		tags, err := audiotags.Read(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", errInvalidTags, name, err)
+		}
+		return []audiotags.Tags{*tags}, nil
+	}
+	dump, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	dump = bytes.TrimSpace(dump)
+	var tracks []audiotags.Tags
+	if bytes.HasPrefix(dump, []byte("{")) {
+		tracks = make([]audiotags.Tags, 1)
+		err = json.Unmarshal(dump, &tracks[0])
+	} else {
+		err = json.Unmarshal(dump, &tracks)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", errInvalidTags, name, err)
+	}
+	return tracks, nil
+}
+
+// Import groups the tracks by the album artist (or the artist) and album title, and adds each
+// album to the catalog. Tracks without an album are imported as singles
+func (ti *tagImporter) Import(ctx context.Context, tracks []audiotags.Tags) ([]*media.Album, error) {
+	var (
+		keys   []string
+		groups = make(map[string][]audiotags.Tags)
+	)
+	for i := range tracks {
+		if tracks[i].Title == "" {
+			continue
+		}
+		album := cmp.Or(tracks[i].Album, tracks[i].Title)
+		key := strings.ToLower(cmp.Or(tracks[i].AlbumArtist, tracks[i].Artist) + "\x00" + album)
+		if tracks[i].Album == "" {
+			// two untitled tracks by the same artist aren't one album
+			key += "\x00single"
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], tracks[i])
+	}
+
+	albums := make([]*media.Album, 0, len(keys))
+	for _, key := range keys {
+		album, err := ti.importAlbum(ctx, groups[key])
+		if err != nil {
+			return albums, fmt.Errorf("failed to import %q: %w", cmp.Or(groups[key][0].Album, groups[key][0].Title), err)
+		}
+		albums = append(albums, album)
+	}
+	return albums, nil
+}
+
+func (ti *tagImporter) importAlbum(ctx context.Context, tracks []audiotags.Tags) (*media.Album, error) {
+	slices.SortStableFunc(tracks, func(a, b audiotags.Tags) int {
+		return cmp.Or(cmp.Compare(a.Disc, b.Disc), cmp.Compare(a.Track, b.Track))
+	})
+	album := &media.Album{Name: cmp.Or(tracks[0].Album, tracks[0].Title)}
+
+	var (
+		artistNames, genreNames []string
+		discs                   = make(map[int]bool)
+		dateTag                 string
+	)
+	for i := range tracks {
+		discs[tracks[i].Disc] = true
+		// the most precise date is kept, since some of the tracks may be tagged with the year only
+		if date := tracks[i].ReleaseDate(); !date.IsZero() && len(tracks[i].Date) > len(dateTag) {
+			album.ReleaseDate, dateTag = date, tracks[i].Date
+		}
+		if !album.MBID.Valid && tracks[i].AlbumMBID != "" {
+			if id, err := uuid.FromString(tracks[i].AlbumMBID); err == nil {
+				album.MBID = uuid.NullUUID{UUID: id, Valid: true}
+			}
+		}
+		genreNames = append(genreNames, tracks[i].Genres...)
+		if name := cmp.Or(tracks[i].AlbumArtist, tracks[i].Artist); name != "" &&
+			!slices.ContainsFunc(artistNames, func(n string) bool { return strings.EqualFold(n, name) }) {
+			artistNames = append(artistNames, name)
+		}
+	}
+
+	// tags don't tell people from bands, so like with Bandcamp, the artists are assumed to be groups
+	for _, name := range artistNames {
+		artist, err := ti.catalog.ResolveArtist(ctx, name, true)
+		if err != nil {
+			return nil, err
+		}
+		album.AlbumArtists = append(album.AlbumArtists, *artist)
+	}
+	var err error
+	if album.Genres, err = ti.catalog.FindGenres(ctx, "music", genreNames); err != nil {
+		return nil, err
+	}
+
+	var total time.Duration
+	for i := range tracks {
+		// tracks are numbered across the discs, like on MusicBrainz
+		number := tracks[i].Track
+		if number == 0 || len(discs) > 1 {
+			number = i + 1
+		}
+		track := media.Track{
+			Name:     tracks[i].Title,
+			Duration: time.Time{}.Add(tracks[i].Duration()),
+			Lyrics:   tracks[i].Lyrics,
+			Number:   int16(number),
+		}
+		if id, err := uuid.FromString(tracks[i].RecordingMBID); err == nil {
+			track.MBID = uuid.NullUUID{UUID: id, Valid: true}
+		}
+		total += tracks[i].Duration()
+		album.Tracks = append(album.Tracks, track)
+	}
+	if total > 0 {
+		album.Duration = sql.NullTime{Time: time.Time{}.Add(total), Valid: true}
+	}
+
+	id, err := ti.catalog.AddAlbum(ctx, album)
+	if err != nil {
+		return nil, err
+	}
+	album.MediaID = &id
+	return album, nil
+}
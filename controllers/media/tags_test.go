@@ -0,0 +1,91 @@
+package media
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/internal/lib/audiotags"
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+func readTagFixture(t *testing.T, name string) []audiotags.Tags {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "tags", name))
+	require.NoError(t, err)
+	defer f.Close()
+	tracks, err := readTags(name, f)
+	require.NoError(t, err)
+	return tracks
+}
+
+func TestTagImport(t *testing.T) {
+	log := zerolog.Nop()
+	catalog := &fakeAlbumCatalog{fakeCatalog: fakeCatalog{genres: []media.Genre{{ID: 4, Name: "Trip Hop"}, {ID: 5, Name: "Synthpop"}}}}
+	ti := newTagImporter(catalog, &log)
+
+	tracks := append(readTagFixture(t, "mezzanine.json"), readTagFixture(t, "single.json")...)
+	require.Len(t, tracks, 4)
+	albums, err := ti.Import(context.Background(), tracks)
+	require.NoError(t, err)
+	require.Len(t, albums, 2, "tracks should be grouped regardless of the case of the tags")
+
+	mezzanine := albums[0]
+	assert.NotNil(t, mezzanine.MediaID)
+	assert.Equal(t, "Mezzanine", mezzanine.Name)
+	require.Len(t, mezzanine.AlbumArtists, 1)
+	assert.Equal(t, "group", mezzanine.AlbumArtists[0].ArtistType)
+	assert.Equal(t, []media.Genre{{ID: 4, Name: "Trip Hop"}}, mezzanine.Genres)
+	assert.Equal(t, time.Date(1998, time.April, 20, 0, 0, 0, 0, time.UTC), mezzanine.ReleaseDate)
+	assert.Equal(t, "2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21", mezzanine.MBID.UUID.String())
+
+	require.Len(t, mezzanine.Tracks, 3)
+	for i, name := range []string{"Angel", "Risingson", "Teardrop"} {
+		assert.Equal(t, name, mezzanine.Tracks[i].Name)
+		assert.EqualValues(t, i+1, mezzanine.Tracks[i].Number)
+	}
+	assert.Equal(t, 5*time.Minute+31*time.Second, mezzanine.Tracks[2].Duration.Sub(time.Time{}))
+	assert.True(t, mezzanine.Tracks[2].MBID.Valid)
+	assert.False(t, mezzanine.Tracks[0].MBID.Valid)
+	require.True(t, mezzanine.Duration.Valid)
+	assert.Equal(t, 16*time.Minute+49*time.Second, mezzanine.Duration.Time.Sub(time.Time{}))
+
+	single := albums[1]
+	assert.Equal(t, "Nightswim", single.Name, "a track without an album should be a single")
+	require.Len(t, single.Tracks, 1)
+	assert.EqualValues(t, 1, single.Tracks[0].Number)
+	assert.Equal(t, time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC), single.ReleaseDate)
+}
+
+func TestTagImportMultipleDiscs(t *testing.T) {
+	log := zerolog.Nop()
+	ti := newTagImporter(&fakeAlbumCatalog{}, &log)
+	tracks := []audiotags.Tags{
+		{Title: "Four", Artist: "A", Album: "Double", Disc: 2, Track: 2},
+		{Title: "One", Artist: "A", Album: "Double", Disc: 1, Track: 1},
+		{Title: "Three", Artist: "A", Album: "Double", Disc: 2, Track: 1},
+		{Title: "Two", Artist: "A", Album: "Double", Disc: 1, Track: 2},
+	}
+	albums, err := ti.Import(context.Background(), tracks)
+	require.NoError(t, err)
+	require.Len(t, albums, 1)
+	for i, name := range []string{"One", "Two", "Three", "Four"} {
+		assert.Equal(t, name, albums[0].Tracks[i].Name)
+		assert.EqualValues(t, i+1, albums[0].Tracks[i].Number, "tracks should be numbered across the discs")
+	}
+	assert.False(t, albums[0].Duration.Valid)
+}
+
+func TestReadTagsUnsupported(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "tags", "untagged.wav"))
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = readTags("untagged.wav", f)
+	assert.ErrorIs(t, err, errInvalidTags)
+}
@@ -0,0 +1,92 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/text/language"
+
+	h "codeberg.org/mjh/LibRate/internal/handlers"
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+type (
+	// titleStorage is implemented by media.Storage
+	titleStorage interface {
+		Get(ctx context.Context, id uuid.UUID) (media.Media, error)
+		Titles(ctx context.Context, mediaID uuid.UUID) ([]media.Title, error)
+	}
+
+	// localeGetter is implemented by member.PgMemberStorage
+	localeGetter interface {
+		GetLocale(ctx context.Context, memberName string) (language.Tag, error)
+	}
+
+	// MediaTitles lists the titles of a media item along with the one chosen for the viewer
+	MediaTitles struct {
+		Preferred media.Title   `json:"preferred"`
+		Titles    []media.Title `json:"titles"`
+	}
+)
+
+// @Summary Get the titles of a media item
+// @Description Lists the original, romanized and localized titles, and picks the one to show to the viewer.
+// @Description The locale is taken from the lang parameter, the member's preferences or the Accept-Language header.
+// @Description The titles are edited as a part of the media, see /revisions/media/{id}
+// @Tags media,metadata
+// @Produce json
+// @Param media_id path string true "Media UUID"
+// @Param lang query string false "BCP 47 language tag" example(en-GB)
+// @Param Accept-Language header string false "The languages preferred by anonymous viewers"
+// @Success 200 {object} h.ResponseHTTP{data=MediaTitles}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /media/{media_id}/titles [get]
+func (mc *Controller) GetTitles(c *fiber.Ctx) error {
+	mediaID, err := uuid.FromString(c.Params("media_id"))
+	if err != nil {
+		return handleBadRequest(mc.storage.Log, c, "Invalid media ID")
+	}
+	item, err := mc.titles.Get(c.UserContext(), mediaID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && item.Status != media.StatusApproved) {
+		return h.Res(c, fiber.StatusNotFound, "Media not found")
+	}
+	if err != nil {
+		return handleInternalError(mc.storage.Log, c, "Failed to get media", err)
+	}
+	titles, err := mc.titles.Titles(c.UserContext(), mediaID)
+	if err != nil {
+		return handleInternalError(mc.storage.Log, c, "Failed to get the titles", err)
+	}
+	c.Vary(fiber.HeaderAcceptLanguage)
+	return h.ResData(c, fiber.StatusOK, "success", MediaTitles{
+		Preferred: media.PreferredTitle(item.Title, titles, mc.viewerLocale(c)),
+		Titles:    titles,
+	})
+}
+
+// viewerLocale returns the locale requested explicitly, the one from the member's preferences
+// or the first one from the Accept-Language header, in that order
+func (mc *Controller) viewerLocale(c *fiber.Ctx) language.Tag {
+	if tag, err := language.Parse(c.Query("lang")); err == nil {
+		return tag
+	}
+	if token, ok := c.Locals("jwtToken").(*jwt.Token); ok && mc.locales != nil {
+		if name, _ := token.Claims.(jwt.MapClaims)["member_name"].(string); name != "" {
+			tag, err := mc.locales.GetLocale(c.UserContext(), name)
+			if err == nil {
+				return tag
+			}
+			mc.storage.Log.Warn().Err(err).Msgf("Failed to get the locale of %s", name)
+		}
+	}
+	if tags, _, err := language.ParseAcceptLanguage(c.Get(fiber.HeaderAcceptLanguage)); err == nil && len(tags) > 0 {
+		return tags[0]
+	}
+	return language.English
+}
@@ -0,0 +1,101 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+
+	"codeberg.org/mjh/LibRate/models/media"
+	"codeberg.org/mjh/LibRate/tests"
+)
+
+type memoryTitles struct {
+	media  map[uuid.UUID]media.Media
+	titles map[uuid.UUID][]media.Title
+}
+
+func (m *memoryTitles) Get(_ context.Context, id uuid.UUID) (media.Media, error) {
+	item, ok := m.media[id]
+	if !ok {
+		return media.Media{}, fmt.Errorf("error getting media %s: %w", id, sql.ErrNoRows)
+	}
+	return item, nil
+}
+
+func (m *memoryTitles) Titles(_ context.Context, id uuid.UUID) ([]media.Title, error) {
+	return m.titles[id], nil
+}
+
+type memoryLocales map[string]language.Tag
+
+func (m memoryLocales) GetLocale(_ context.Context, memberName string) (language.Tag, error) {
+	tag, ok := m[memberName]
+	if !ok {
+		return language.Und, sql.ErrNoRows
+	}
+	return tag, nil
+}
+
+func TestGetTitles(t *testing.T) {
+	okami, pending := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	store := &memoryTitles{
+		media: map[uuid.UUID]media.Media{
+			okami:   {ID: okami, Title: "Okami", Kind: "game", Status: media.StatusApproved},
+			pending: {ID: pending, Title: "Okamiden", Kind: "game", Status: media.StatusPending},
+		},
+		titles: map[uuid.UUID][]media.Title{okami: {
+			{Title: "Okami", Language: "en", Kind: media.TitleLocalized},
+			{Title: "Ōkami", Language: "ja-Latn", Kind: media.TitleRomanized},
+			{Title: "大神", Language: "ja", Kind: media.TitleOriginal},
+		}},
+	}
+	log := zerolog.Nop()
+	mc := &Controller{storage: media.Storage{Log: &log}, titles: store, locales: memoryLocales{"lain": language.Japanese}}
+	app := fiber.New()
+	app.Use(tests.FakeAuth)
+	app.Get("/media/:media_id/titles", mc.GetTitles)
+
+	preferred := func(path, member, acceptLanguage string) (int, string) {
+		req := httptest.NewRequest(fiber.MethodGet, path, nil)
+		req.Header.Set(tests.MemberHeader, member)
+		req.Header.Set(fiber.HeaderAcceptLanguage, acceptLanguage)
+		res, err := app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		var decoded struct {
+			Data MediaTitles `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&decoded))
+		return res.StatusCode, decoded.Data.Preferred.Title
+	}
+
+	path := "/media/" + okami.String() + "/titles"
+	for _, tc := range []struct {
+		name, query, member, acceptLanguage, want string
+	}{
+		{"default", "", "", "", "Okami"},
+		{"accept language", "", "", "ja-JP,ja;q=0.9,en;q=0.8", "大神"},
+		{"member's locale", "", "lain", "en", "大神"},
+		{"member without preferences", "", "alice", "de", "Ōkami"},
+		{"explicit language", "?lang=en", "lain", "ja", "Okami"},
+	} {
+		status, title := preferred(path+tc.query, tc.member, tc.acceptLanguage)
+		require.Equal(t, fiber.StatusOK, status, tc.name)
+		assert.Equal(t, tc.want, title, tc.name)
+	}
+
+	status, _ := preferred("/media/"+pending.String()+"/titles", "", "")
+	assert.Equal(t, fiber.StatusNotFound, status, "pending media are hidden")
+	status, _ = preferred("/media/x/titles", "", "")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
@@ -0,0 +1,603 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+
+	"codeberg.org/mjh/LibRate/models/media"
+	"codeberg.org/mjh/LibRate/models/places"
+)
+
+const (
+	wikidataAPI = "https://www.wikidata.org/w/api.php"
+	// wbgetentities accepts up to 50 IDs per request
+	wikidataBatchSize = 50
+	// films can list hundreds of cast members, only the first ones are billed anyway
+	wikidataMaxCast = 20
+)
+
+var (
+	wikidataQID = regexp.MustCompile(`^Q[1-9]\d*$`)
+
+	// values of "instance of" (P31) mapped onto our media kinds
+	wikidataFilms = []string{
+		"Q11424",    // film
+		"Q24862",    // short film
+		"Q24869",    // feature film
+		"Q202866",   // animated film
+		"Q506240",   // television film
+		"Q93204",    // documentary film
+		"Q226730",   // silent film
+		"Q229390",   // 3D film
+		"Q17123180", // sequel film
+	}
+	wikidataBooks = []string{
+		"Q571",      // book
+		"Q7725634",  // literary work
+		"Q47461344", // written work
+		"Q8261",     // novel
+		"Q3331189",  // version, edition or translation
+		"Q49084",    // short story
+		"Q12106333", // poetry collection
+	}
+)
+
+const wikidataHuman = "Q5"
+
+type (
+	wikidataImporter struct {
+		apiURL  string
+		client  *http.Client
+		catalog catalogResolver
+		log     *zerolog.Logger
+	}
+
+	// WikidataImport is the result of mapping a Wikidata entity. Only one of Film, Book and Person is set
+	WikidataImport struct {
+		Kind   string           `json:"kind" example:"film"`
+		QID    string           `json:"qid" example:"Q83495"`
+		Titles []LocalizedTitle `json:"titles,omitempty"`
+		// films have no genres of their own yet, so they're returned alongside
+		Genres []media.Genre `json:"genres,omitempty"`
+		Film   *media.Film   `json:"film,omitempty"`
+		Book   *media.Book   `json:"book,omitempty"`
+		Person *media.Person `json:"person,omitempty"`
+	}
+
+	// LocalizedTitle is the title of a work in a given language
+	LocalizedTitle struct {
+		Language string `json:"language" example:"de"`
+		Title    string `json:"title" example:"Matrix"`
+		// the title in the work's original language
+		Original bool `json:"original,omitempty"`
+	}
+
+	wdEntity struct {
+		ID string `json:"id"`
+		// present (and empty) if the entity doesn't exist
+		Missing *string              `json:"missing,omitempty"`
+		Labels  map[string]wdText    `json:"labels"`
+		Claims  map[string][]wdClaim `json:"claims"`
+	}
+
+	wdText struct {
+		Language string `json:"language"`
+		Value    string `json:"value"`
+	}
+
+	wdClaim struct {
+		Rank     string `json:"rank"`
+		Mainsnak struct {
+			// value, somevalue (unknown) or novalue
+			SnakType  string `json:"snaktype"`
+			DataValue struct {
+				Type  string          `json:"type"`
+				Value json.RawMessage `json:"value"`
+			} `json:"datavalue"`
+		} `json:"mainsnak"`
+	}
+
+	wdTime struct {
+		Time string `json:"time"`
+		// 9 is a year, 10 a month, 11 a day
+		Precision int `json:"precision"`
+	}
+
+	wdQuantity struct {
+		Amount string `json:"amount"`
+		Unit   string `json:"unit"`
+	}
+)
+
+func newWikidataImporter(catalog catalogResolver, log *zerolog.Logger) *wikidataImporter {
+	return &wikidataImporter{
+		apiURL:  wikidataAPI,
+		client:  &http.Client{Timeout: 15 * time.Second},
+		catalog: catalog,
+		log:     log,
+	}
+}
+
+// withCatalog returns a copy of the importer which resolves through the given catalog
+func (wi *wikidataImporter) withCatalog(catalog catalogResolver) *wikidataImporter {
+	clone := *wi
+	clone.catalog = catalog
+	return &clone
+}
+
+// Import maps a Wikidata entity, given by its Q-ID, Wikidata URL or Wikipedia article URL,
+// onto a film, book or person. The people and publishers it refers to are added to the database
+// if needed, the imported item itself is returned for the member to submit
+func (wi *wikidataImporter) Import(ctx context.Context, uri string) (*WikidataImport, error) {
+	qid, wikiURL, err := parseWikidataURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	lang := "en"
+	if wikiURL != nil {
+		lang = strings.SplitN(wikiURL.Hostname(), ".", 2)[0]
+		if qid, err = wi.resolveArticle(ctx, wikiURL); err != nil {
+			return nil, err
+		}
+	}
+
+	entities, err := wi.entities(ctx, nil, qid)
+	if err != nil {
+		return nil, err
+	}
+	entity, ok := entities[qid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s not found on Wikidata", errInvalidImportURI, qid)
+	}
+
+	instanceOf := entity.ids("P31")
+	switch {
+	case slices.Contains(instanceOf, wikidataHuman):
+		return wi.person(ctx, entity, lang)
+	case slices.ContainsFunc(instanceOf, func(id string) bool { return slices.Contains(wikidataFilms, id) }):
+		return wi.film(ctx, entity, lang)
+	case slices.ContainsFunc(instanceOf, func(id string) bool { return slices.Contains(wikidataBooks, id) }):
+		return wi.book(ctx, entity, lang)
+	default:
+		return nil, fmt.Errorf("%w: %s is neither a film, a book nor a person", errInvalidImportURI, qid)
+	}
+}
+
+func (wi *wikidataImporter) film(ctx context.Context, entity *wdEntity, lang string) (*WikidataImport, error) {
+	directors := entity.ids("P57")
+	cast := entity.ids("P161")
+	if len(cast) > wikidataMaxCast {
+		cast = cast[:wikidataMaxCast]
+	}
+	genres := entity.ids("P136")
+	refs, err := wi.entities(ctx, []string{"en", lang}, slices.Concat(directors, cast, genres)...)
+	if err != nil {
+		return nil, err
+	}
+
+	film := &media.Film{
+		Title:       entity.label(lang),
+		ReleaseDate: entity.time("P577"),
+	}
+	if duration := entity.duration("P2047"); duration > 0 {
+		film.Duration = sql.NullTime{Time: time.Time{}.Add(duration), Valid: true}
+	}
+	if film.Cast.Directors, err = wi.resolvePeople(ctx, refs, directors, lang); err != nil {
+		return nil, err
+	}
+	if film.Cast.Actors, err = wi.resolvePeople(ctx, refs, cast, lang); err != nil {
+		return nil, err
+	}
+
+	// genres on Wikidata are named like "science fiction film", ours are not
+	var names []string
+	for _, label := range labels(refs, genres, "en") {
+		names = append(names, label, strings.TrimSuffix(label, " film"))
+	}
+	result := &WikidataImport{Kind: "film", QID: entity.ID, Titles: entity.titles(), Film: film}
+	if result.Genres, err = wi.catalog.FindGenres(ctx, "film", names); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (wi *wikidataImporter) book(ctx context.Context, entity *wdEntity, lang string) (*WikidataImport, error) {
+	var (
+		authors    = entity.ids("P50")
+		publishers = entity.ids("P123")
+		genres     = entity.ids("P136")
+		languages  = entity.ids("P407")
+		subjects   = entity.ids("P921")
+	)
+	refs, err := wi.entities(ctx, []string{"en", lang}, slices.Concat(authors, publishers, genres, languages, subjects)...)
+	if err != nil {
+		return nil, err
+	}
+
+	book := &media.Book{
+		Title:           entity.label(lang),
+		PublicationDate: entity.time("P577"),
+		// language names are stored in English
+		Languages: labels(refs, languages, "en"),
+		Keywords:  pq.StringArray(labels(refs, subjects, "en")),
+	}
+	if isbn := slices.Concat(entity.strings("P212"), entity.strings("P957")); len(isbn) > 0 {
+		book.ISBN = sql.NullString{String: isbn[0], Valid: true}
+	}
+	if pages, _ := entity.quantity("P1104"); pages > 0 && pages <= 1<<15-1 {
+		book.Pages = int16(pages)
+	}
+	if book.Authors, err = wi.resolvePeople(ctx, refs, authors, lang); err != nil {
+		return nil, err
+	}
+	if names := labels(refs, publishers, lang); len(names) > 0 {
+		publisher, err := wi.catalog.ResolveStudio(ctx, names[0], media.Publishing)
+		if err != nil {
+			return nil, err
+		}
+		book.Publisher = *publisher
+	}
+	if book.Genres, err = wi.catalog.FindGenres(ctx, "book", labels(refs, genres, "en")); err != nil {
+		return nil, err
+	}
+	return &WikidataImport{Kind: "book", QID: entity.ID, Titles: entity.titles(), Book: book}, nil
+}
+
+func (wi *wikidataImporter) person(ctx context.Context, entity *wdEntity, lang string) (*WikidataImport, error) {
+	name := entity.label(lang)
+	person := &media.Person{
+		Name:  name,
+		Birth: entity.time("P569"),
+		Death: entity.time("P570"),
+	}
+	person.FirstName, person.LastName = media.SplitName(name)
+	// names in other scripts, e.g. Cyrillic or Japanese
+	for _, l := range entity.titles() {
+		if l.Title != name && !slices.Contains(person.OtherNames, l.Title) {
+			person.OtherNames = append(person.OtherNames, l.Title)
+		}
+	}
+	if websites := entity.strings("P856"); len(websites) > 0 {
+		person.Website = sql.NullString{String: websites[0], Valid: true}
+	}
+
+	if birthplace := entity.ids("P19"); len(birthplace) > 0 {
+		refs, err := wi.entities(ctx, []string{"en", lang}, birthplace[0])
+		if err != nil {
+			return nil, err
+		}
+		if place, ok := refs[birthplace[0]]; ok {
+			person.Hometown = places.Place{Kind: "city", Name: place.label(lang)}
+			person.Hometown.Lat, person.Hometown.Lng, _ = place.coordinates("P625")
+			if country := place.ids("P17"); len(country) > 0 {
+				countries, err := wi.entities(ctx, []string{"en", lang}, country[0])
+				if err != nil {
+					return nil, err
+				}
+				if c, ok := countries[country[0]]; ok {
+					person.Hometown.Country = &places.Country{Name: c.label(lang)}
+					if codes := c.strings("P297"); len(codes) > 0 {
+						person.Hometown.Country.Code = codes[0]
+					}
+				}
+			}
+		}
+	}
+	return &WikidataImport{Kind: "person", QID: entity.ID, Person: person}, nil
+}
+
+// resolvePeople finds or adds the referenced people, in the order they're listed
+func (wi *wikidataImporter) resolvePeople(ctx context.Context, refs map[string]*wdEntity, ids []string, lang string) ([]media.Person, error) {
+	people := make([]media.Person, 0, len(ids))
+	for _, name := range labels(refs, ids, lang) {
+		artist, err := wi.catalog.ResolveArtist(ctx, name, false)
+		if err != nil {
+			return nil, err
+		}
+		person := media.Person{ID: artist.ID, Name: name}
+		person.FirstName, person.LastName = media.SplitName(name)
+		people = append(people, person)
+	}
+	return people, nil
+}
+
+// resolveArticle looks up the Wikidata item of a Wikipedia article
+func (wi *wikidataImporter) resolveArticle(ctx context.Context, article *url.URL) (string, error) {
+	title := strings.TrimPrefix(article.Path, "/wiki/")
+	query := url.Values{
+		"action":    {"query"},
+		"prop":      {"pageprops"},
+		"ppprop":    {"wikibase_item"},
+		"redirects": {"1"},
+		"format":    {"json"},
+		"titles":    {title},
+	}
+	var res struct {
+		Query struct {
+			Pages map[string]struct {
+				PageProps struct {
+					WikibaseItem string `json:"wikibase_item"`
+				} `json:"pageprops"`
+			} `json:"pages"`
+		} `json:"query"`
+	}
+	if err := wi.get(ctx, "https://"+article.Host+"/w/api.php?"+query.Encode(), &res); err != nil {
+		return "", err
+	}
+	for _, page := range res.Query.Pages {
+		if wikidataQID.MatchString(page.PageProps.WikibaseItem) {
+			return page.PageProps.WikibaseItem, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s has no Wikidata item", errInvalidImportURI, article)
+}
+
+// entities fetches the labels and claims of the given items. If languages are given, only
+// the labels in those languages are fetched. Missing entities are left out
+func (wi *wikidataImporter) entities(ctx context.Context, languages []string, ids ...string) (map[string]*wdEntity, error) {
+	found := make(map[string]*wdEntity, len(ids))
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	for start := 0; start < len(ids); start += wikidataBatchSize {
+		batch := ids[start:min(start+wikidataBatchSize, len(ids))]
+		query := url.Values{
+			"action": {"wbgetentities"},
+			"ids":    {strings.Join(batch, "|")},
+			"props":  {"labels|claims"},
+			"format": {"json"},
+		}
+		if len(languages) > 0 {
+			query.Set("languages", strings.Join(slices.Compact(slices.Clone(languages)), "|"))
+		}
+		var res struct {
+			Entities map[string]*wdEntity `json:"entities"`
+		}
+		if err := wi.get(ctx, wi.apiURL+"?"+query.Encode(), &res); err != nil {
+			return nil, err
+		}
+		for id, entity := range res.Entities {
+			if entity.Missing == nil {
+				found[id] = entity
+			}
+		}
+	}
+	return found, nil
+}
+
+func (wi *wikidataImporter) get(ctx context.Context, endpoint string, dest any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("failed to create Wikidata request: %v", err)
+	}
+	// Wikimedia requires a user agent identifying the client
+	req.Header.Set("User-Agent", discogsUserAgent)
+	req.Header.Set("Accept", "application/json")
+	res, err := wi.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %v", req.URL.Host, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s from %s", res.Status, req.URL.Host)
+	}
+	if err = json.NewDecoder(io.LimitReader(res.Body, 16<<20)).Decode(dest); err != nil {
+		return fmt.Errorf("failed to decode the response from %s: %v", req.URL.Host, err)
+	}
+	return nil
+}
+
+// parseWikidataURI accepts bare Q-IDs, Wikidata item URLs and Wikipedia article URLs.
+// For the latter, the Q-ID is empty and the article URL is returned instead
+func parseWikidataURI(uri string) (qid string, article *url.URL, err error) {
+	uri = strings.TrimSpace(uri)
+	if wikidataQID.MatchString(strings.ToUpper(uri)) {
+		return strings.ToUpper(uri), nil, nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %s is not a Wikidata or Wikipedia URL", errInvalidImportURI, uri)
+	}
+	switch {
+	case u.Hostname() == "www.wikidata.org" || u.Hostname() == "wikidata.org" || u.Hostname() == "m.wikidata.org":
+		qid = strings.TrimPrefix(u.Path, "/wiki/")
+		if u.Query().Has("id") {
+			qid = u.Query().Get("id")
+		}
+		if !wikidataQID.MatchString(qid) {
+			return "", nil, fmt.Errorf("%w: %s is not a Wikidata item", errInvalidImportURI, uri)
+		}
+		return qid, nil, nil
+	case isHostOf(u.Hostname(), "wikipedia.org") && strings.Count(u.Hostname(), ".") >= 2:
+		if !strings.HasPrefix(u.Path, "/wiki/") || len(u.Path) == len("/wiki/") {
+			return "", nil, fmt.Errorf("%w: %s is not a Wikipedia article", errInvalidImportURI, uri)
+		}
+		// the mobile site shares the article titles with the desktop one
+		u.Host = strings.Replace(u.Host, ".m.wikipedia.org", ".wikipedia.org", 1)
+		return "", u, nil
+	default:
+		return "", nil, fmt.Errorf("%w: %s is not a Wikidata or Wikipedia URL", errInvalidImportURI, uri)
+	}
+}
+
+// label returns the label in the preferred language, falling back to English, the
+// multilingual label and finally any other one
+func (e *wdEntity) label(lang string) string {
+	for _, l := range []string{lang, "en", "mul"} {
+		if label, ok := e.Labels[l]; ok {
+			return label.Value
+		}
+	}
+	titles := e.titles()
+	if len(titles) > 0 {
+		return titles[0].Title
+	}
+	return ""
+}
+
+// titles lists the labels by language, marking the title in the original language (P1476)
+func (e *wdEntity) titles() []LocalizedTitle {
+	byLang := make(map[string]*LocalizedTitle, len(e.Labels))
+	for lang, label := range e.Labels {
+		byLang[lang] = &LocalizedTitle{Language: lang, Title: label.Value}
+	}
+	for _, claim := range e.values("P1476") {
+		var original struct {
+			Text     string `json:"text"`
+			Language string `json:"language"`
+		}
+		if json.Unmarshal(claim, &original) == nil && original.Text != "" {
+			byLang[original.Language] = &LocalizedTitle{Language: original.Language, Title: original.Text, Original: true}
+		}
+	}
+	titles := make([]LocalizedTitle, 0, len(byLang))
+	for _, t := range byLang {
+		titles = append(titles, *t)
+	}
+	slices.SortFunc(titles, func(a, b LocalizedTitle) int { return strings.Compare(a.Language, b.Language) })
+	return titles
+}
+
+// values returns the raw values of a property, skipping deprecated and unknown ones
+func (e *wdEntity) values(prop string) (values []json.RawMessage) {
+	for _, claim := range e.Claims[prop] {
+		if claim.Rank == "deprecated" || claim.Mainsnak.SnakType != "value" {
+			continue
+		}
+		values = append(values, claim.Mainsnak.DataValue.Value)
+	}
+	return values
+}
+
+// ids returns the items referenced by a property
+func (e *wdEntity) ids(prop string) (ids []string) {
+	for _, v := range e.values(prop) {
+		var ref struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(v, &ref) == nil && wikidataQID.MatchString(ref.ID) {
+			ids = append(ids, ref.ID)
+		}
+	}
+	return ids
+}
+
+func (e *wdEntity) strings(prop string) (values []string) {
+	for _, v := range e.values(prop) {
+		var s string
+		if json.Unmarshal(v, &s) == nil && s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// time returns the earliest date of a property, e.g. the first release of a film
+func (e *wdEntity) time(prop string) (earliest sql.NullTime) {
+	for _, v := range e.values(prop) {
+		var wt wdTime
+		if json.Unmarshal(v, &wt) != nil {
+			continue
+		}
+		t, ok := parseWikidataTime(wt)
+		if ok && (!earliest.Valid || t.Before(earliest.Time)) {
+			earliest = sql.NullTime{Time: t, Valid: true}
+		}
+	}
+	return earliest
+}
+
+func (e *wdEntity) quantity(prop string) (amount float64, unit string) {
+	for _, v := range e.values(prop) {
+		var q wdQuantity
+		if json.Unmarshal(v, &q) != nil {
+			continue
+		}
+		amount, err := strconv.ParseFloat(strings.TrimPrefix(q.Amount, "+"), 64)
+		if err == nil {
+			return amount, strings.TrimPrefix(q.Unit, "http://www.wikidata.org/entity/")
+		}
+	}
+	return 0, ""
+}
+
+// duration converts a quantity in seconds, minutes or hours
+func (e *wdEntity) duration(prop string) time.Duration {
+	amount, unit := e.quantity(prop)
+	switch unit {
+	case "Q11574":
+		return time.Duration(amount * float64(time.Second))
+	case "Q7727":
+		return time.Duration(amount * float64(time.Minute))
+	case "Q25235":
+		return time.Duration(amount * float64(time.Hour))
+	default:
+		return 0
+	}
+}
+
+func (e *wdEntity) coordinates(prop string) (lat, lng float64, ok bool) {
+	for _, v := range e.values(prop) {
+		var c struct {
+			Latitude  float64 `json:"latitude"`
+			Longitude float64 `json:"longitude"`
+		}
+		if json.Unmarshal(v, &c) == nil {
+			return c.Latitude, c.Longitude, true
+		}
+	}
+	return 0, 0, false
+}
+
+// labels returns the labels of the referenced entities which could be fetched
+func labels(refs map[string]*wdEntity, ids []string, lang string) (names []string) {
+	for _, id := range ids {
+		if e, ok := refs[id]; ok {
+			if label := e.label(lang); label != "" {
+				names = append(names, label)
+			}
+		}
+	}
+	return names
+}
+
+// parseWikidataTime parses dates like +1999-03-31T00:00:00Z, where the month and day
+// are zero for dates with the precision of a year or month. Dates BC are not supported
+func parseWikidataTime(wt wdTime) (time.Time, bool) {
+	if !strings.HasPrefix(wt.Time, "+") || wt.Precision < 9 {
+		return time.Time{}, false
+	}
+	date, _, _ := strings.Cut(wt.Time[1:], "T")
+	parts := strings.Split(date, "-")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	numbers := make([]int, 3)
+	for i := range parts {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return time.Time{}, false
+		}
+		numbers[i] = n
+	}
+	if wt.Precision < 11 {
+		numbers[2] = 0
+	}
+	if wt.Precision < 10 {
+		numbers[1] = 0
+	}
+	return time.Date(numbers[0], time.Month(max(numbers[1], 1)), max(numbers[2], 1), 0, 0, 0, 0, time.UTC), true
+}
@@ -0,0 +1,143 @@
+package media
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+// newTestWikidataImporter serves the entities from testdata/wikidata/entities, batched like
+// wbgetentities does, and the Wikipedia page properties from testdata/wikidata/articles
+func newTestWikidataImporter(t *testing.T, catalog *fakeCatalog) *wikidataImporter {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("action") == "query" {
+			http.ServeFile(w, r, filepath.Join("testdata", "wikidata", "articles", query.Get("titles")+".json"))
+			return
+		}
+		entities := make(map[string]json.RawMessage)
+		for _, id := range strings.Split(query.Get("ids"), "|") {
+			entity, err := os.ReadFile(filepath.Join("testdata", "wikidata", "entities", id+".json"))
+			if err != nil {
+				entity = json.RawMessage(`{"id":"` + id + `","missing":""}`)
+			}
+			entities[id] = entity
+		}
+		json.NewEncoder(w).Encode(map[string]any{"entities": entities}) //nolint:errcheck // test server
+	}))
+	t.Cleanup(srv.Close)
+	target, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	log := zerolog.Nop()
+	wi := newWikidataImporter(catalog, &log)
+	wi.client = &http.Client{Transport: redirectTransport{target: target}}
+	return wi
+}
+
+func TestWikidataFilm(t *testing.T) {
+	catalog := &fakeCatalog{genres: []media.Genre{{ID: 4, Name: "Science Fiction"}, {ID: 6, Name: "Action"}}}
+	wi := newTestWikidataImporter(t, catalog)
+
+	item, err := wi.Import(context.Background(), "https://www.wikidata.org/wiki/Q83495")
+	require.NoError(t, err)
+	require.NotNil(t, item.Film)
+
+	assert.Equal(t, "film", item.Kind)
+	assert.Equal(t, "The Matrix", item.Film.Title)
+	assert.Equal(t, time.Date(1999, time.March, 31, 0, 0, 0, 0, time.UTC), item.Film.ReleaseDate.Time,
+		"the earliest release should be used, skipping deprecated claims")
+	assert.Equal(t, 136*time.Minute, item.Film.Duration.Time.Sub(time.Time{}))
+	require.Len(t, item.Film.Cast.Directors, 2)
+	assert.Equal(t, "Wachowski", item.Film.Cast.Directors[0].LastName)
+	require.Len(t, item.Film.Cast.Actors, 2, "unknown cast members should be skipped")
+	assert.Equal(t, "Keanu Reeves", item.Film.Cast.Actors[0].Name)
+	assert.Len(t, catalog.artists, 4)
+	assert.Len(t, item.Genres, 2)
+
+	require.Len(t, item.Titles, 4)
+	assert.Equal(t, LocalizedTitle{Language: "en", Title: "The Matrix", Original: true}, item.Titles[1])
+	assert.Equal(t, LocalizedTitle{Language: "ja", Title: "マトリックス"}, item.Titles[2])
+}
+
+func TestWikidataFromWikipedia(t *testing.T) {
+	wi := newTestWikidataImporter(t, &fakeCatalog{})
+
+	item, err := wi.Import(context.Background(), "https://de.m.wikipedia.org/wiki/Matrix_(Film)")
+	require.NoError(t, err)
+	assert.Equal(t, "Q83495", item.QID)
+	assert.Equal(t, "Matrix", item.Film.Title, "the title should be in the language of the article")
+}
+
+func TestWikidataBook(t *testing.T) {
+	catalog := &fakeCatalog{genres: []media.Genre{{ID: 8, Name: "Dystopian Novel"}}}
+	wi := newTestWikidataImporter(t, catalog)
+
+	item, err := wi.Import(context.Background(), "Q208460")
+	require.NoError(t, err)
+	require.NotNil(t, item.Book)
+
+	assert.Equal(t, "Nineteen Eighty-Four", item.Book.Title)
+	assert.Equal(t, "978-0-14-118776-1", item.Book.ISBN.String, "ISBN-13 should be preferred")
+	assert.Equal(t, time.Date(1949, time.June, 8, 0, 0, 0, 0, time.UTC), item.Book.PublicationDate.Time)
+	assert.Equal(t, "Secker & Warburg", item.Book.Publisher.Name)
+	assert.Equal(t, []string{"Secker & Warburg"}, catalog.studios)
+	require.Len(t, item.Book.Authors, 1)
+	assert.Equal(t, "Orwell", item.Book.Authors[0].LastName)
+	assert.EqualValues(t, 328, item.Book.Pages)
+	assert.Equal(t, []string{"English"}, item.Book.Languages)
+	assert.Equal(t, []string{"totalitarianism", "mass surveillance"}, []string(item.Book.Keywords))
+	assert.Len(t, item.Book.Genres, 1)
+	assert.Len(t, item.Titles, 3)
+}
+
+func TestWikidataPerson(t *testing.T) {
+	wi := newTestWikidataImporter(t, &fakeCatalog{})
+
+	item, err := wi.Import(context.Background(), "q43416")
+	require.NoError(t, err)
+	require.NotNil(t, item.Person)
+
+	person := item.Person
+	assert.Equal(t, "Keanu", person.FirstName)
+	assert.Equal(t, "Reeves", person.LastName)
+	assert.Equal(t, time.Date(1964, time.September, 2, 0, 0, 0, 0, time.UTC), person.Birth.Time)
+	assert.False(t, person.Death.Valid)
+	assert.ElementsMatch(t, []string{"Киану Ривз", "キアヌ・リーブス"}, person.OtherNames)
+	assert.Equal(t, "Beirut", person.Hometown.Name)
+	assert.InDelta(t, 33.8869, person.Hometown.Lat, 1e-6)
+	require.NotNil(t, person.Hometown.Country)
+	assert.Equal(t, "LB", person.Hometown.Country.Code)
+}
+
+func TestWikidataUnsupported(t *testing.T) {
+	wi := newTestWikidataImporter(t, &fakeCatalog{})
+	for _, uri := range []string{"Q2", "Q999999999", "https://en.wikipedia.org/wiki/Tidal_Archive_(album)", "https://example.org/wiki/Q83495"} {
+		_, err := wi.Import(context.Background(), uri)
+		assert.ErrorIs(t, err, errInvalidImportURI, uri)
+	}
+}
+
+func TestParseWikidataTime(t *testing.T) {
+	year, ok := parseWikidataTime(wdTime{Time: "+1998-00-00T00:00:00Z", Precision: 9})
+	require.True(t, ok)
+	assert.Equal(t, time.Date(1998, time.January, 1, 0, 0, 0, 0, time.UTC), year)
+	_, ok = parseWikidataTime(wdTime{Time: "-0044-03-15T00:00:00Z", Precision: 11})
+	assert.False(t, ok, "dates BC are not supported")
+	_, ok = parseWikidataTime(wdTime{Time: "+1900-00-00T00:00:00Z", Precision: 7})
+	assert.False(t, ok, "centuries are too imprecise")
+}
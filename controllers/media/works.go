@@ -0,0 +1,169 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid/v5"
+
+	h "codeberg.org/mjh/LibRate/internal/handlers"
+	"codeberg.org/mjh/LibRate/models/media"
+)
+
+type (
+	// workStorage is implemented by media.Storage
+	workStorage interface {
+		CreateWork(ctx context.Context, work *media.Work) error
+		GetWork(ctx context.Context, id uuid.UUID) (*media.Work, error)
+		AddEdition(ctx context.Context, workID uuid.UUID, edition *media.Edition) error
+		RemoveEdition(ctx context.Context, workID, mediaID uuid.UUID) error
+	}
+
+	// WorkInput groups albums (as a release group) or books into a work
+	WorkInput struct {
+		Kind     string         `json:"kind" enum:"album,book" example:"album"`
+		Title    string         `json:"title" example:"Mezzanine"`
+		Editions []EditionInput `json:"editions"`
+	}
+
+	// EditionInput is a media item added to a work
+	EditionInput struct {
+		MediaID uuid.UUID `json:"media_id"`
+		// what sets the edition apart from the others
+		Edition string `json:"edition,omitempty" example:"2019 remaster"`
+	}
+)
+
+// @Summary Get a work
+// @Description Gets the work, i.e. a release group or the editions of a book, along with its editions
+// @Tags media,works
+// @Produce json
+// @Param id path string true "Work UUID"
+// @Success 200 {object} h.ResponseHTTP{data=media.Work}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /media/works/{id} [get]
+func (mc *Controller) GetWork(c *fiber.Ctx) error {
+	id, err := uuid.FromString(c.Params("id"))
+	if err != nil {
+		return handleBadRequest(mc.storage.Log, c, "Invalid work ID")
+	}
+	work, err := mc.works.GetWork(c.UserContext(), id)
+	if err != nil {
+		return mc.handleWorkError(c, "get the work", err)
+	}
+	return h.ResData(c, fiber.StatusOK, "success", work)
+}
+
+// @Summary Create a work
+// @Description Groups the albums or books into a work, so that their ratings can be viewed together.
+// @Description Editions which belonged to another work are moved
+// @Tags media,works
+// @Accept json
+// @Produce json
+// @Param input body WorkInput true "The work with its editions"
+// @Param X-CSRF-Token header string true "X-CSRF-Token header"
+// @Success 201 {object} h.ResponseHTTP{data=media.Work}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /media/works [post]
+func (mc *Controller) CreateWork(c *fiber.Ctx) error {
+	var input WorkInput
+	if err := c.BodyParser(&input); err != nil {
+		return handleBadRequest(mc.storage.Log, c, "Invalid work")
+	}
+	if strings.TrimSpace(input.Title) == "" {
+		return handleBadRequest(mc.storage.Log, c, "The title of the work is required")
+	}
+	work := media.Work{
+		Kind:     input.Kind,
+		Title:    input.Title,
+		Editions: make([]media.Edition, len(input.Editions)),
+	}
+	for i := range input.Editions {
+		work.Editions[i] = media.Edition{MediaID: input.Editions[i].MediaID, Edition: input.Editions[i].Edition}
+	}
+	if err := mc.works.CreateWork(c.UserContext(), &work); err != nil {
+		return mc.handleWorkError(c, "create the work", err)
+	}
+	return h.ResData(c, fiber.StatusCreated, "success", work)
+}
+
+// @Summary Add an edition to a work
+// @Description Adds the album or book to the work, moving it from its previous work if it had one.
+// @Description For editions of the work, only the label is changed
+// @Tags media,works
+// @Accept json
+// @Produce json
+// @Param id path string true "Work UUID"
+// @Param media_id path string true "Media UUID"
+// @Param input body EditionInput false "Only the edition label is read"
+// @Param X-CSRF-Token header string true "X-CSRF-Token header"
+// @Success 200 {object} h.ResponseHTTP{data=media.Edition}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /media/works/{id}/editions/{media_id} [put]
+func (mc *Controller) AddEdition(c *fiber.Ctx) error {
+	workID, err := uuid.FromString(c.Params("id"))
+	if err != nil {
+		return handleBadRequest(mc.storage.Log, c, "Invalid work ID")
+	}
+	mediaID, err := uuid.FromString(c.Params("media_id"))
+	if err != nil {
+		return handleBadRequest(mc.storage.Log, c, "Invalid media ID")
+	}
+	var input EditionInput
+	// the label is optional
+	_ = c.BodyParser(&input)
+	edition := media.Edition{MediaID: mediaID, Edition: input.Edition}
+	if err = mc.works.AddEdition(c.UserContext(), workID, &edition); err != nil {
+		return mc.handleWorkError(c, "add the edition", err)
+	}
+	return h.ResData(c, fiber.StatusOK, "success", edition)
+}
+
+// @Summary Remove an edition from a work
+// @Description Removes the album or book from the work. The work is deleted along with its last edition
+// @Tags media,works
+// @Produce json
+// @Param id path string true "Work UUID"
+// @Param media_id path string true "Media UUID"
+// @Param X-CSRF-Token header string true "X-CSRF-Token header"
+// @Success 200 {object} h.ResponseHTTP{}
+// @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 404 {object} h.ResponseHTTP{}
+// @Failure 500 {object} h.ResponseHTTP{}
+// @Router /media/works/{id}/editions/{media_id} [delete]
+func (mc *Controller) RemoveEdition(c *fiber.Ctx) error {
+	workID, err := uuid.FromString(c.Params("id"))
+	if err != nil {
+		return handleBadRequest(mc.storage.Log, c, "Invalid work ID")
+	}
+	mediaID, err := uuid.FromString(c.Params("media_id"))
+	if err != nil {
+		return handleBadRequest(mc.storage.Log, c, "Invalid media ID")
+	}
+	if err = mc.works.RemoveEdition(c.UserContext(), workID, mediaID); err != nil {
+		return mc.handleWorkError(c, "remove the edition", err)
+	}
+	return h.Res(c, fiber.StatusOK, "Removed")
+}
+
+func (mc *Controller) handleWorkError(c *fiber.Ctx, action string, err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return h.Res(c, fiber.StatusNotFound, "Not found")
+	case errors.Is(err, media.ErrKindMismatch), errors.Is(err, media.ErrNoEditions):
+		return handleBadRequest(mc.storage.Log, c, err.Error())
+	case errors.Is(err, media.ErrUnknownTarget):
+		return handleBadRequest(mc.storage.Log, c, "Only albums and books have editions")
+	default:
+		return handleInternalError(mc.storage.Log, c, "Failed to "+action, err)
+	}
+}
@@ -0,0 +1,159 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"codeberg.org/mjh/LibRate/models/media"
+	"codeberg.org/mjh/LibRate/tests"
+)
+
+// memoryWorks mimics media.works, with the kinds of the media items kept separately
+type memoryWorks struct {
+	kinds map[uuid.UUID]string
+	works map[uuid.UUID]*media.Work
+}
+
+func (m *memoryWorks) CreateWork(ctx context.Context, work *media.Work) error {
+	if !media.IsWorkKind(work.Kind) {
+		return fmt.Errorf("%w %s", media.ErrUnknownTarget, work.Kind)
+	}
+	if len(work.Editions) == 0 {
+		return media.ErrNoEditions
+	}
+	work.ID = uuid.Must(uuid.NewV4())
+	work.Created = time.Now()
+	editions := work.Editions
+	m.works[work.ID] = &media.Work{ID: work.ID, Kind: work.Kind, Title: work.Title, Created: work.Created}
+	for i := range editions {
+		if err := m.AddEdition(ctx, work.ID, &editions[i]); err != nil {
+			delete(m.works, work.ID)
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryWorks) GetWork(_ context.Context, id uuid.UUID) (*media.Work, error) {
+	work, ok := m.works[id]
+	if !ok {
+		return nil, fmt.Errorf("error getting work %s: %w", id, sql.ErrNoRows)
+	}
+	return work, nil
+}
+
+func (m *memoryWorks) AddEdition(_ context.Context, workID uuid.UUID, edition *media.Edition) error {
+	work, ok := m.works[workID]
+	if !ok {
+		return fmt.Errorf("error getting work %s: %w", workID, sql.ErrNoRows)
+	}
+	kind, ok := m.kinds[edition.MediaID]
+	if !ok {
+		return fmt.Errorf("error getting media %s: %w", edition.MediaID, sql.ErrNoRows)
+	}
+	if kind != work.Kind {
+		return media.ErrKindMismatch
+	}
+	for _, w := range m.works {
+		m.remove(w, edition.MediaID)
+	}
+	work.Editions = append(work.Editions, *edition)
+	return nil
+}
+
+func (m *memoryWorks) remove(work *media.Work, mediaID uuid.UUID) bool {
+	for i := range work.Editions {
+		if work.Editions[i].MediaID == mediaID {
+			work.Editions = append(work.Editions[:i], work.Editions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memoryWorks) RemoveEdition(_ context.Context, workID, mediaID uuid.UUID) error {
+	work, ok := m.works[workID]
+	if !ok || !m.remove(work, mediaID) {
+		return sql.ErrNoRows
+	}
+	if len(work.Editions) == 0 {
+		delete(m.works, workID)
+	}
+	return nil
+}
+
+func newWorksApp(works *memoryWorks) *fiber.App {
+	log := zerolog.Nop()
+	mc := &Controller{storage: media.Storage{Log: &log}, works: works}
+	app := fiber.New()
+	app.Use(tests.FakeAuth)
+	app.Post("/media/works", mc.CreateWork)
+	app.Get("/media/works/:id", mc.GetWork)
+	app.Put("/media/works/:id/editions/:media_id", mc.AddEdition)
+	app.Delete("/media/works/:id/editions/:media_id", mc.RemoveEdition)
+	return app
+}
+
+func TestWorks(t *testing.T) {
+	original, remaster, book := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	works := &memoryWorks{
+		kinds: map[uuid.UUID]string{original: "album", remaster: "album", book: "book"},
+		works: make(map[uuid.UUID]*media.Work),
+	}
+	app := newWorksApp(works)
+
+	status, _ := tests.JSONRequest(t, app, fiber.MethodPost, "/media/works", "lain",
+		`{"kind": "album", "title": " ", "editions": [{"media_id": "`+original.String()+`"}]}`)
+	assert.Equal(t, fiber.StatusBadRequest, status, "the title is required")
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, "/media/works", "lain", `{"kind": "film", "title": "Alien"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status, "films have no editions")
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPost, "/media/works", "lain", `{"kind": "album", "title": "Mezzanine"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status, "a work needs editions")
+
+	status, data := tests.JSONRequest(t, app, fiber.MethodPost, "/media/works", "lain",
+		`{"kind": "album", "title": "Mezzanine", "editions": [{"media_id": "`+original.String()+`"}]}`)
+	require.Equal(t, fiber.StatusCreated, status)
+	var work media.Work
+	require.NoError(t, json.Unmarshal(data, &work))
+	path := "/media/works/" + work.ID.String()
+
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPut, path+"/editions/"+book.String(), "lain", `{}`)
+	assert.Equal(t, fiber.StatusBadRequest, status, "books can't be editions of albums")
+	status, data = tests.JSONRequest(t, app, fiber.MethodPut, path+"/editions/"+remaster.String(), "lain",
+		`{"edition": "2019 remaster"}`)
+	require.Equal(t, fiber.StatusOK, status)
+	var edition media.Edition
+	require.NoError(t, json.Unmarshal(data, &edition))
+	assert.Equal(t, "2019 remaster", edition.Edition)
+	status, _ = tests.JSONRequest(t, app, fiber.MethodPut, "/media/works/"+uuid.Must(uuid.NewV4()).String()+
+		"/editions/"+remaster.String(), "lain", `{}`)
+	assert.Equal(t, fiber.StatusNotFound, status)
+
+	status, data = tests.JSONRequest(t, app, fiber.MethodGet, path, "lain", "")
+	require.Equal(t, fiber.StatusOK, status)
+	require.NoError(t, json.Unmarshal(data, &work))
+	require.Len(t, work.Editions, 2)
+	assert.Equal(t, original, work.Editions[0].MediaID)
+	assert.Equal(t, remaster, work.Editions[1].MediaID)
+
+	status, _ = tests.JSONRequest(t, app, fiber.MethodDelete, path+"/editions/"+book.String(), "lain", "")
+	assert.Equal(t, fiber.StatusNotFound, status, "the book isn't an edition of the work")
+	for _, id := range []uuid.UUID{original, remaster} {
+		status, _ = tests.JSONRequest(t, app, fiber.MethodDelete, path+"/editions/"+id.String(), "lain", "")
+		require.Equal(t, fiber.StatusOK, status)
+	}
+	status, _ = tests.JSONRequest(t, app, fiber.MethodGet, path, "lain", "")
+	assert.Equal(t, fiber.StatusNotFound, status, "the work is deleted with its last edition")
+	status, _ = tests.JSONRequest(t, app, fiber.MethodGet, "/media/works/x", "lain", "")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
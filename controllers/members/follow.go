@@ -39,7 +39,12 @@ func (mc *Controller) Follow(c *fiber.Ctx) error {
 	fr.Requester = follower
 	mc.log.Debug().Msgf("parsed the request into: %+v", fr)
 
-	resp := mc.storage.RequestFollow(c.Context(), &fr)
+	var resp member.FollowResponse
+	if isLocalRequest(follower, fr.Target) {
+		resp = mc.storage.RequestFollow(c.Context(), &fr)
+	} else {
+		resp = mc.fedCon.FollowRemote(c.Context(), &fr)
+	}
 	switch resp.Status {
 	case "not_found":
 		return logAndRes(c, mc.log, resp.Error, 404, "Member not found")
@@ -50,10 +55,6 @@ func (mc *Controller) Follow(c *fiber.Ctx) error {
 	case "already_following":
 		return logAndRes(c, mc.log, resp.Error, 204, "Already following")
 	default:
-		if !isLocalRequest(follower, fr.Target) {
-			return h.Res(c, fiber.StatusNotImplemented, "Remote follow not implemented")
-		}
-
 		return h.ResData(c, 200, "Follow request sent", resp)
 	}
 }
@@ -77,6 +78,8 @@ func (mc *Controller) AcceptFollow(c *fiber.Ctx) error {
 	if id, err = strconv.ParseInt(ID, 10, 64); err != nil {
 		return logAndRes(c, mc.log, err, 400, "Invalid input")
 	}
+	// needed to notify remote requesters, which is only possible before the request is removed
+	fr, frErr := mc.storage.GetFollowRequest(c.Context(), id)
 	err = mc.storage.AcceptFollow(c.Context(), accepter, id)
 	if err != nil {
 		switch {
@@ -97,6 +100,8 @@ func (mc *Controller) AcceptFollow(c *fiber.Ctx) error {
 		}
 	}
 
+	mc.notifyRemoteRequester(c, fr, frErr, true)
+
 	return h.Res(c, 200, "Follow request accepted")
 }
 
@@ -120,6 +125,7 @@ func (mc *Controller) RejectFollow(c *fiber.Ctx) error {
 	if id, err = strconv.ParseInt(ID, 10, 64); err != nil {
 		return logAndRes(c, mc.log, err, 400, "Invalid input")
 	}
+	fr, frErr := mc.storage.GetFollowRequest(c.Context(), id)
 	err = mc.storage.RejectFollow(c.Context(), rejecter, id)
 	if err != nil {
 		switch {
@@ -140,6 +146,8 @@ func (mc *Controller) RejectFollow(c *fiber.Ctx) error {
 		}
 	}
 
+	mc.notifyRemoteRequester(c, fr, frErr, false)
+
 	return h.Res(c, 200, "Follow request rejected")
 }
 
@@ -186,6 +194,16 @@ func (mc *Controller) Unfollow(c *fiber.Ctx) error {
 		return logAndRes(c, mc.log, err, 400, "Error parsing input")
 	}
 	fr.Requester = follower
+	remote := !isLocalRequest(follower, fr.Target)
+	var followIRI string
+	if remote {
+		// the Undo must reference the original Follow, so it has to be looked up before removal
+		iri, err := mc.storage.GetFollowActivityIRI(c.Context(), follower, fr.Target)
+		if err != nil {
+			mc.log.Warn().Err(err).Msgf("no follow activity found for %s -> %s", follower, fr.Target)
+		}
+		followIRI = iri
+	}
 	err := mc.storage.RemoveFollower(c.Context(), follower, fr.Target)
 	if err != nil {
 		switch {
@@ -204,8 +222,10 @@ func (mc *Controller) Unfollow(c *fiber.Ctx) error {
 		}
 	}
 
-	if !isLocalRequest(follower, fr.Target) {
-		return h.Res(c, fiber.StatusNotImplemented, "Remote follow not implemented")
+	if remote {
+		if err = mc.fedCon.UndoFollow(c.Context(), follower, fr.Target, followIRI); err != nil {
+			mc.log.Error().Err(err).Msgf("failed to notify %s about unfollow", fr.Target)
+		}
 	}
 
 	return h.Res(c, 200, "Unfollowed")
@@ -240,6 +260,25 @@ func logAndRes(c *fiber.Ctx, logger *zerolog.Logger, err error, status int, msg
 	return h.Res(c, status, msg)
 }
 
+// notifyRemoteRequester sends the response to a follow request which came from another instance
+func (mc *Controller) notifyRemoteRequester(
+	c *fiber.Ctx,
+	fr *member.FollowBlockRequest,
+	lookupErr error,
+	accepted bool,
+) {
+	if lookupErr != nil {
+		mc.log.Warn().Err(lookupErr).Msg("follow request lookup failed, requester won't be notified")
+		return
+	}
+	if isLocalRequest(fr.Requester, fr.Target) {
+		return
+	}
+	if err := mc.fedCon.RespondFollow(c.Context(), fr, accepted); err != nil {
+		mc.log.Error().Err(err).Msgf("failed to notify %s about follow response", fr.Requester)
+	}
+}
+
 func isLocalRequest(sender, recipient string) bool {
 	senderDomain := strings.Split(sender, "@")[1]
 	recipientDomain := strings.Split(recipient, "@")[1]
@@ -40,11 +40,12 @@ func NewController(
 	sess *session.Store,
 	logger *zerolog.Logger,
 	conf *cfg.Config,
+	fedCon federation.FedHandler,
 ) *Controller {
 	imagesStorage := static.NewStorage(db, logger)
 	return &Controller{
 		storage:      storage,
-		fedCon:       federation.NewController(logger, db, storage),
+		fedCon:       fedCon,
 		sessionStore: sess,
 		log:          logger,
 		conf:         conf,
@@ -8,12 +8,14 @@ import (
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgtype"
 	"github.com/lib/pq"
 	"github.com/samber/lo"
 	"golang.org/x/text/language"
 
 	h "codeberg.org/mjh/LibRate/internal/handlers"
+	"codeberg.org/mjh/LibRate/models"
 	"codeberg.org/mjh/LibRate/models/member"
 )
 
@@ -85,6 +87,7 @@ func (mc *Controller) Update(c *fiber.Ctx) (err error) {
 // @Param locale formData string false "The ISO 639-1 locale to use"
 // @Param rating_scale_lower formData int16 false "The lower bound of the rating scale" minimum(0) maximum(100)
 // @Param rating_scale_upper formData int16 false "The upper bound of the rating scale" minimum(2) maximum(100)
+// @Param rating_scale_step formData number false "The difference between the neighbouring ratings, e.g. 0.5 for half stars" minimum(0.01) maximum(1)
 // @Param message_autohide_words formData []string false "A comma-separated list of words to autohide in messages"
 // @Param muted_instances formData []string false "A comma-separated list of instance domains to mute"
 // @Param auto_accept_follow formData bool false "Whether to automatically accept follow requests"
@@ -93,6 +96,7 @@ func (mc *Controller) Update(c *fiber.Ctx) (err error) {
 // @Param robots_searchable formData bool false "Whether to allow robots to index the profile"
 // @Success 200 {object} h.ResponseHTTP{}
 // @Failure 400 {object} h.ResponseHTTP{}
+// @Failure 403 {object} h.ResponseHTTP{}
 // @Failure 500 {object} h.ResponseHTTP{}
 // @Router /update/{member_name}/preferences [patch]
 func (mc *Controller) UpdatePrefs(c *fiber.Ctx) error {
@@ -114,7 +118,38 @@ func (mc *Controller) UpdatePrefs(c *fiber.Ctx) error {
 			return h.Res(c, fiber.StatusBadRequest, "Error parsing request body")
 		}
 	}
-	return h.Res(c, fiber.StatusNotImplemented, "Preferences updating not implemented yet")
+	if prefs == nil {
+		return h.Res(c, fiber.StatusBadRequest, "Error parsing request body")
+	}
+	if c.Params("member_name") != c.Locals("jwtToken").(*jwt.Token).Claims.(jwt.MapClaims)["member_name"] {
+		return h.Res(c, fiber.StatusForbidden, "Cannot update the preferences of another member")
+	}
+	if prefs.UX.Locale != language.Und {
+		if err = mc.storage.SetLocale(c.UserContext(), c.Params("member_name"), prefs.UX.Locale); err != nil {
+			mc.log.Error().Err(err).Msgf("Error updating locale: %v", err)
+			return h.Res(c, fiber.StatusInternalServerError, "Internal Server Error")
+		}
+	}
+	// without the upper bound, the saved scale is kept
+	if prefs.UX.RatingScaleUpper != 0 {
+		scale := models.RatingScale{
+			Lower: prefs.UX.RatingScaleLower,
+			Upper: prefs.UX.RatingScaleUpper,
+			Step:  prefs.UX.RatingScaleStep,
+		}
+		if scale.Step == 0 {
+			scale.Step = 1
+		}
+		if err = scale.Validate(); err != nil {
+			return h.Res(c, fiber.StatusBadRequest, err.Error())
+		}
+		if err = mc.storage.SetRatingScale(c.UserContext(), c.Params("member_name"), scale); err != nil {
+			mc.log.Error().Err(err).Msgf("Error updating rating scale: %v", err)
+			return h.Res(c, fiber.StatusInternalServerError, "Internal Server Error")
+		}
+	}
+	// TODO: save the remaining preferences
+	return h.Res(c, fiber.StatusOK, "success")
 }
 
 func parseFormPrefs(c *fiber.Ctx) (p *member.Preferences, err error) {
@@ -124,19 +159,22 @@ func parseFormPrefs(c *fiber.Ctx) (p *member.Preferences, err error) {
 		if err != nil {
 			return nil, h.Res(c, fiber.StatusBadRequest, "Invalid locale")
 		}
-	} else {
-		tag = language.English
-		// TODO: get the current locale from the database
-		// maybe when the data is sent to the client, automatically include non-modified fields
-		// in the request
 	}
+	// without the locale, the saved one is kept
 	lower, err := strconv.ParseInt(c.FormValue("rating_scale_lower", "1"), 10, 16)
 	if err != nil {
 		return nil, h.Res(c, fiber.StatusBadRequest, "Invalid rating scale lower bound")
 	}
-	upper, err := strconv.ParseInt(c.FormValue("rating_scale_upper", "10"), 10, 16)
+	var upper int64
+	if c.FormValue("rating_scale_upper") != "" {
+		upper, err = strconv.ParseInt(c.FormValue("rating_scale_upper"), 10, 16)
+		if err != nil {
+			return nil, h.Res(c, fiber.StatusBadRequest, "Invalid rating scale upper bound")
+		}
+	}
+	step, err := strconv.ParseFloat(c.FormValue("rating_scale_step", "1"), 64)
 	if err != nil {
-		return nil, h.Res(c, fiber.StatusBadRequest, "Invalid rating scale upper bound")
+		return nil, h.Res(c, fiber.StatusBadRequest, "Invalid rating scale step")
 	}
 
 	autoHideWords := strings.Split(c.FormValue("message_autohide_words"), ",")
@@ -147,6 +185,7 @@ func parseFormPrefs(c *fiber.Ctx) (p *member.Preferences, err error) {
 			Locale:           tag,
 			RatingScaleLower: int16(lower),
 			RatingScaleUpper: int16(upper),
+			RatingScaleStep:  step,
 		},
 		PrivacySecurity: member.PrivacySecurityPreferences{
 			MessageAutohideWords: pq.StringArray(autoHideWords),
@@ -2,19 +2,26 @@ package controllers
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofrs/uuid/v5"
+	"github.com/golang-jwt/jwt/v5"
 
+	"codeberg.org/mjh/LibRate/controllers/search/aggregation"
 	h "codeberg.org/mjh/LibRate/internal/handlers"
 	"codeberg.org/mjh/LibRate/models"
 	"codeberg.org/mjh/LibRate/models/media"
 )
 
+// how often the ratings are reweighed and all the scores recomputed
+const scoreRebuildInterval = 24 * time.Hour
+
 type (
 	// IReviewController is the interface for the review controller
 	// It defines the methods that the review controller must implement
@@ -32,10 +39,22 @@ type (
 		rs *models.RatingStorage
 		ms *media.Storage
 	}
+
+	// ScoreHistogram is the distribution of the ratings of a media item on the viewer's rating scale
+	ScoreHistogram struct {
+		Buckets     []aggregation.HistogramBucket `json:"buckets"`
+		RatingCount int                           `json:"rating_count"`
+		ReviewCount int                           `json:"review_count"`
+		// the Bayesian average, in which the ratings of new and inactive accounts count less
+		WeightedScore *float64 `json:"weighted_score,omitempty"`
+		// from 0 to 1, see models.MediaScore
+		Contentious float64            `json:"contentious"`
+		Scale       models.RatingScale `json:"scale"`
+	}
 )
 
-func NewReviewController(rs models.RatingStorage) *ReviewController {
-	return &ReviewController{rs: &rs}
+func NewReviewController(rs models.RatingStorage, ms *media.Storage) *ReviewController {
+	return &ReviewController{rs: &rs, ms: ms}
 }
 
 // GetMediaRatings retrieves reviews for a specific media item based on the media ID
@@ -51,6 +70,10 @@ func (rc *ReviewController) GetMediaReviews(c *fiber.Ctx) error {
 	if err != nil {
 		return h.Res(c, fiber.StatusNotFound, "Ratings not found")
 	}
+	scale := rc.viewerScale(c)
+	for i := range reviews {
+		reviews[i].Rescale(scale)
+	}
 
 	return c.JSON(reviews)
 }
@@ -67,6 +90,7 @@ func (rc *ReviewController) GetByID(c *fiber.Ctx) error {
 		rc.ms.Log.Error().Err(err).Msgf(err.Error())
 		return h.Res(c, fiber.StatusInternalServerError, "Failed to fetch review")
 	}
+	review.Rescale(rc.viewerScale(c))
 	return c.JSON(review)
 }
 
@@ -88,13 +112,22 @@ func (rc *ReviewController) GetLatest(c *fiber.Ctx) error {
 	if err != nil {
 		return h.Res(c, fiber.StatusNotFound, err.Error())
 	}
+	scale := rc.viewerScale(c)
+	for i := range ratings {
+		ratings[i].Rescale(scale)
+	}
 
 	// Return the ratings as a JSON response.
 	return c.JSON(ratings)
 }
 
-// PostRating handles the submission of a user's review for a specific media item
+// PostRating handles the submission of a user's review for a specific media item.
+// The rating is on the member's rating scale, and the review is written by the signed in member
 func (rc *ReviewController) PostRating(c *fiber.Ctx) error {
+	name := memberName(c)
+	if name == "" {
+		return h.Res(c, fiber.StatusUnauthorized, "Not logged in")
+	}
 	var input models.RatingInput
 	err := json.Unmarshal(c.Body(), &input)
 	if err != nil {
@@ -104,7 +137,14 @@ func (rc *ReviewController) PostRating(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err = rc.rs.New(ctx, &input)
+	scale, err := rc.rs.RatingScale(ctx, name)
+	if err != nil {
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to get the rating scale")
+	}
+	err = rc.rs.New(ctx, name, &input, scale)
+	if errors.Is(err, models.ErrOutOfScale) || errors.Is(err, models.ErrInvalidAspect) {
+		return h.Res(c, fiber.StatusBadRequest, err.Error())
+	}
 	if err != nil {
 		return h.Res(c, fiber.StatusInternalServerError, "Failed to add rating")
 	}
@@ -114,17 +154,20 @@ func (rc *ReviewController) PostRating(c *fiber.Ctx) error {
 	})
 }
 
-// UpdateRating handles the update of a user's review for a specific media item
-// The types of values that can be updated are defined by the union type models.UpdateableKeyTypes
-// This way, things like the date of the review are not updateable
+// UpdateRating handles the update of a user's review for a specific media item.
+// The rating is on the member's rating scale. Members can only update their own reviews
 func (rc *ReviewController) UpdateRating(c *fiber.Ctx) error {
+	name := memberName(c)
+	if name == "" {
+		return h.Res(c, fiber.StatusUnauthorized, "Not logged in")
+	}
 	ratingID, err := strconv.ParseInt(c.Params("id"), 10, 64)
 	if err != nil {
 		return h.Res(c, fiber.StatusBadRequest, "Invalid rating ID")
 	}
 
-	var keysToUpdate []string
-	err = json.Unmarshal(c.Body(), &keysToUpdate)
+	var input models.RatingInput
+	err = json.Unmarshal(c.Body(), &input)
 	if err != nil {
 		return h.Res(c, fiber.StatusBadRequest, "Invalid input")
 	}
@@ -132,9 +175,19 @@ func (rc *ReviewController) UpdateRating(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// WARN: not sure if this is correct, but one cannot have type params on receiver methods
-	err = models.UpdateRating(ctx, rc.rs, ratingID, keysToUpdate)
+	scale, err := rc.rs.RatingScale(ctx, name)
 	if err != nil {
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to get the rating scale")
+	}
+	err = rc.rs.Update(ctx, ratingID, name, &input, scale)
+	switch {
+	case errors.Is(err, models.ErrOutOfScale):
+		return h.Res(c, fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, models.ErrNotAuthor):
+		return h.Res(c, fiber.StatusForbidden, "Only the author can update the rating")
+	case errors.Is(err, sql.ErrNoRows):
+		return h.Res(c, fiber.StatusNotFound, "Rating not found")
+	case err != nil:
 		return h.Res(c, fiber.StatusInternalServerError, "Failed to update rating")
 	}
 
@@ -143,8 +196,13 @@ func (rc *ReviewController) UpdateRating(c *fiber.Ctx) error {
 	})
 }
 
-// DeleteRating handles the deletion of a user's review for a specific media item
+// DeleteRating handles the deletion of a user's review for a specific media item.
+// Members can only delete their own reviews
 func (rc *ReviewController) DeleteRating(c *fiber.Ctx) error {
+	name := memberName(c)
+	if name == "" {
+		return h.Res(c, fiber.StatusUnauthorized, "Not logged in")
+	}
 	ratingID, err := strconv.ParseInt(c.Params("id"), 10, 64)
 	if err != nil {
 		return h.Res(c, fiber.StatusBadRequest, "Invalid rating ID")
@@ -152,8 +210,13 @@ func (rc *ReviewController) DeleteRating(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err = rc.rs.Delete(ctx, ratingID)
-	if err != nil {
+	err = rc.rs.Delete(ctx, ratingID, name)
+	switch {
+	case errors.Is(err, models.ErrNotAuthor):
+		return h.Res(c, fiber.StatusForbidden, "Only the author can delete the rating")
+	case errors.Is(err, sql.ErrNoRows):
+		return h.Res(c, fiber.StatusNotFound, "Rating not found")
+	case err != nil:
 		return h.Res(c, fiber.StatusInternalServerError, "Failed to delete rating")
 	}
 
@@ -163,31 +226,52 @@ func (rc *ReviewController) DeleteRating(c *fiber.Ctx) error {
 }
 
 // GetAverageRating fetches the average (float64) rating ("stars") score based on a given media UUID, kind
-// and rating type
+// and rating type, on the viewer's rating scale, along with the averages and counts of the secondary
+// ratings of each aspect of the media. For albums and books, the scope query parameter selects between the ratings
+// of the given edition ("edition", the default) and the ratings of all the editions of its work ("work")
 func (rc *ReviewController) GetAverageRating(c *fiber.Ctx) error {
 	mediaID, err := uuid.FromString(c.Params("media_id"))
 	if err != nil {
 		return h.Res(c, fiber.StatusBadRequest, "Invalid media ID")
 	}
+	scope := c.Query("scope", "edition")
+	if scope != "edition" && scope != "work" {
+		return h.Res(c, fiber.StatusBadRequest, "Invalid scope "+scope)
+	}
 
 	mediaKind, err := rc.ms.GetKind(c.UserContext(), mediaID)
 	if err != nil {
 		return h.Res(c, fiber.StatusInternalServerError, "Failed to fetch media kind")
 	}
 
+	if scope == "work" && media.IsWorkKind(mediaKind) {
+		workID, err := rc.ms.WorkOf(c.UserContext(), mediaID)
+		if err != nil {
+			return h.Res(c, fiber.StatusInternalServerError, "Failed to fetch the work")
+		}
+		// an item without other editions is its own work
+		if workID.Valid {
+			average, err := rc.getWorkAverageScore(c.UserContext(), workID.UUID)
+			if err != nil {
+				return h.Res(c, fiber.StatusInternalServerError, err.Error())
+			}
+			return c.JSON(average.Rescale(rc.viewerScale(c)))
+		}
+	}
+
 	switch mediaKind {
-	case "track":
+	case "track", "book", "film", "tv_show", "season", "episode", "game", "anime", "manga", "comic":
 		average, err := rc.getTrackAverageScore(c.UserContext(), mediaID)
 		if err != nil {
 			return h.Res(c, fiber.StatusInternalServerError, err.Error())
 		}
-		return c.JSON(average)
+		return c.JSON(average.Rescale(rc.viewerScale(c)))
 	case "album":
 		average, err := rc.getAlbumAverageScore(c.UserContext(), mediaID)
 		if err != nil {
 			return h.Res(c, fiber.StatusInternalServerError, err.Error())
 		}
-		return c.JSON(average)
+		return c.JSON(average.Rescale(rc.viewerScale(c)))
 	default:
 		return h.Res(c, fiber.StatusNotImplemented,
 			fmt.Sprintf(`Fetching average score for this media type (%s) is not implemented yet.
@@ -200,12 +284,17 @@ func (rc *ReviewController) getTrackAverageScore(
 ) (*models.RatingAverage, error) {
 	average, err := rc.rs.GetAverageStars(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get average score for track with ID %s: %v", id.String(), err.Error())
+		return nil, fmt.Errorf("failed to get average score for media with ID %s: %v", id.String(), err.Error())
+	}
+	aspects, err := rc.rs.GetAspectAverages(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get aspect averages for media with ID %s: %w", id.String(), err)
 	}
 	return &models.RatingAverage{
 		BaseRatingScore:         average,
 		SecondaryRatingTypes:    nil,
 		SecondaryRatingAverages: nil,
+		Aspects:                 aspects,
 	}, nil
 }
 
@@ -237,9 +326,123 @@ func (rc *ReviewController) getAlbumAverageScore(
 	if err != nil {
 		return nil, fmt.Errorf("error getting average score for album with ID %s: %w", id.String(), err)
 	}
+	aspects, err := rc.rs.GetAspectAverages(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting aspect averages for album with ID %s: %w", id.String(), err)
+	}
 	return &models.RatingAverage{
 		BaseRatingScore:         albumAverage,
 		SecondaryRatingTypes:    &[]string{"track"},
 		SecondaryRatingAverages: trackAverages,
+		Aspects:                 aspects,
+	}, nil
+}
+
+func (rc *ReviewController) getWorkAverageScore(
+	ctx context.Context, id uuid.UUID,
+) (*models.RatingAverage, error) {
+	work, err := rc.ms.GetWork(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the editions of work %s: %w", id.String(), err)
+	}
+	editionAverages := make([]models.SecondaryRatingAverage, 0, len(work.Editions))
+	editionIDs := make([]uuid.UUID, 0, len(work.Editions))
+	for i := range work.Editions {
+		editionIDs = append(editionIDs, work.Editions[i].MediaID)
+		editionScore, err := rc.rs.GetAverageStars(ctx, work.Editions[i].MediaID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch average rating of edition %s of work %s: %w",
+				work.Editions[i].MediaID.String(), id.String(), err)
+		}
+		editionAverages = append(editionAverages, models.SecondaryRatingAverage{
+			MediaID:   work.Editions[i].MediaID,
+			MediaKind: work.Kind,
+			Score:     editionScore,
+		})
+	}
+	workAverage, err := rc.rs.GetWorkAverageStars(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting average score for work with ID %s: %w", id.String(), err)
+	}
+	aspects, err := rc.rs.GetAspectAverages(ctx, editionIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting aspect averages for work with ID %s: %w", id.String(), err)
+	}
+	return &models.RatingAverage{
+		BaseRatingScore:         workAverage,
+		SecondaryRatingTypes:    &[]string{"edition"},
+		SecondaryRatingAverages: editionAverages,
+		Aspects:                 aspects,
 	}, nil
 }
+
+// viewerScale returns the rating scale of the signed in member, or the default one for the visitors
+func (rc *ReviewController) viewerScale(c *fiber.Ctx) models.RatingScale {
+	name := memberName(c)
+	scale, err := rc.rs.RatingScale(c.UserContext(), name)
+	if err != nil {
+		rc.ms.Log.Warn().Err(err).Msgf("Failed to get the rating scale of %s", name)
+		return models.DefaultRatingScale
+	}
+	return scale
+}
+
+// memberName returns the name of the signed in member, if any
+func memberName(c *fiber.Ctx) string {
+	if token, ok := c.Locals("jwtToken").(*jwt.Token); ok {
+		name, _ := token.Claims.(jwt.MapClaims)["member_name"].(string)
+		return name
+	}
+	return ""
+}
+
+// GetHistogram returns the distribution of the ratings of a media item on the viewer's rating scale,
+// along with its weighted score and how contentious it is
+func (rc *ReviewController) GetHistogram(c *fiber.Ctx) error {
+	mediaID, err := uuid.FromString(c.Params("media_id"))
+	if err != nil {
+		return h.Res(c, fiber.StatusBadRequest, "Invalid media ID")
+	}
+	score, err := rc.rs.GetScore(c.UserContext(), mediaID)
+	if err != nil {
+		rc.ms.Log.Error().Err(err).Msgf("Failed to get the score of %s", mediaID)
+		return h.Res(c, fiber.StatusInternalServerError, "Failed to fetch the score")
+	}
+	scale := rc.viewerScale(c)
+	histogram := ScoreHistogram{
+		Buckets:     aggregation.Histogram(score.Histogram, scale),
+		RatingCount: score.RatingCount,
+		ReviewCount: score.ReviewCount,
+		Contentious: score.Contentious,
+		Scale:       scale,
+	}
+	if score.WeightedScore != nil {
+		weighted := scale.Convert(*score.WeightedScore)
+		histogram.WeightedScore = &weighted
+	}
+	return c.JSON(histogram)
+}
+
+// RunScoreRebuild periodically reweighs the ratings and recomputes the scores in the background,
+// since the ratings of new accounts count more as the accounts age
+func (rc *ReviewController) RunScoreRebuild(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(scoreRebuildInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			changed, err := rc.rs.RebuildScores(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					rc.ms.Log.Error().Err(err).Msg("failed to rebuild the scores")
+				}
+				continue
+			}
+			rc.ms.Log.Info().Msgf("rebuilt the scores, %d changed", changed)
+		}
+	}()
+}
@@ -12,12 +12,12 @@ type (
 )
 
 const (
-	// RatingCount does not take reviews with a text body into account
+	// RatingCount counts all the ratings, whether they come with a text body or not
 	RatingCount MediaAggregation = "rating_count"
 	// Contentious is a special aggregation, that is used to determine the most
 	// polarizing media, ones that people either love or hate.
 	Contentious MediaAggregation = "contentious"
-	// ReviewCount is useful when one wants to know more
+	// ReviewCount only counts the ratings with a text body. It is useful when one wants to know more
 	// about a media than just it's core and synopsis (if any)
 	ReviewCount MediaAggregation = "review_count"
 	// RewardCount counts the number of received rewards
@@ -29,8 +29,9 @@ const (
 	// which by default is then displayed as 0-100 float with one decimal,
 	// but users can set their own scale relative to that.
 	AverageRating MediaAggregation = "average_rating"
-	// WeightedScore is the average rating of a media item
-	// weighed by the number of ratings
+	// WeightedScore is the Bayesian average rating of a media item, pulled towards
+	// the average of its kind when it has few ratings. The ratings of new and
+	// inactive accounts count less
 	WeightedScore MediaAggregation = "weighted_score"
 	// Added is the date when the media was added to the database
 	Added MediaAggregation = "added"
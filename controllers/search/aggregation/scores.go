@@ -0,0 +1,52 @@
+package aggregation
+
+import (
+	"codeberg.org/mjh/LibRate/models"
+)
+
+// ScoreAggregations are the media aggregations kept up to date on every rating written,
+// see models.MediaScore. They're a part of the search documents, so the results can be sorted by them
+// nolint: gochecknoglobals
+var ScoreAggregations = []MediaAggregation{
+	RatingCount, ReviewCount, AverageRating, WeightedScore, Contentious,
+}
+
+// HistogramBucket is the number of ratings given a rating on the viewer's scale
+type HistogramBucket struct {
+	Rating float64 `json:"rating" example:"3.5"`
+	Count  int     `json:"count" example:"12"`
+}
+
+// SortField returns the search sort key for a score aggregation, e.g. -weighted_score
+// for the best rated media first. Other sort keys are returned as they are
+func SortField(key string, descending bool) string {
+	for _, a := range ScoreAggregations {
+		if a.String() != key {
+			continue
+		}
+		if descending {
+			return "-" + key
+		}
+		return key
+	}
+	return key
+}
+
+// Histogram converts a rating histogram from the reference scale to the viewer's scale.
+// The buckets which fall onto the same rating of a coarser scale are merged
+func Histogram(histogram []int32, scale models.RatingScale) []HistogramBucket {
+	if len(histogram) < 2 {
+		return nil
+	}
+	buckets := make([]HistogramBucket, 0, len(histogram))
+	step := models.ReferenceScale / (len(histogram) - 1)
+	for i, count := range histogram {
+		rating := scale.Denormalize(int16(i * step))
+		if n := len(buckets); n > 0 && buckets[n-1].Rating == rating {
+			buckets[n-1].Count += int(count)
+			continue
+		}
+		buckets = append(buckets, HistogramBucket{Rating: rating, Count: int(count)})
+	}
+	return buckets
+}
@@ -0,0 +1,38 @@
+package aggregation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"codeberg.org/mjh/LibRate/models"
+)
+
+func TestSortField(t *testing.T) {
+	assert.Equal(t, "-weighted_score", SortField("weighted_score", true))
+	assert.Equal(t, "contentious", SortField("contentious", false))
+	assert.Equal(t, "name", SortField("name", true), "only the scores should be reversed")
+}
+
+func TestHistogram(t *testing.T) {
+	histogram := []int32{1, 2, 0, 0, 3, 0, 0, 5, 4, 0, 6}
+
+	halfStars := Histogram(histogram, models.RatingScale{Lower: 0, Upper: 5, Step: 0.5})
+	assert.Len(t, halfStars, 11)
+	assert.Equal(t, HistogramBucket{Rating: 3.5, Count: 5}, halfStars[7])
+
+	stars := Histogram(histogram, models.RatingScale{Lower: 1, Upper: 5, Step: 1})
+	assert.Equal(t, []HistogramBucket{
+		{Rating: 1, Count: 3},
+		{Rating: 2, Count: 3},
+		{Rating: 3, Count: 0},
+		{Rating: 4, Count: 9},
+		{Rating: 5, Count: 6},
+	}, stars)
+
+	tens := Histogram(histogram, models.DefaultRatingScale)
+	assert.Len(t, tens, 10, "0 should be merged into the lowest rating")
+	assert.Equal(t, HistogramBucket{Rating: 1, Count: 3}, tens[0])
+
+	assert.Nil(t, Histogram(nil, models.DefaultRatingScale))
+}
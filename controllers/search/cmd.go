@@ -7,6 +7,9 @@ import (
 
 	"github.com/blevesearch/bleve/v2"
 	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/samber/lo"
+
+	"codeberg.org/mjh/LibRate/controllers/search/aggregation"
 )
 
 // RunQuery performs a search on the bleve index
@@ -38,10 +41,11 @@ func buildUniversalQuery(queryVal string, fuzzy bool) query.Query {
 
 func buildSearchRequest(opts *Options, queryVal query.Query) *bleve.SearchRequest {
 	req := bleve.NewSearchRequest(queryVal)
-	if opts.Sort != "" && strings.Contains(opts.Sort, ",") {
-		req.SortBy(strings.Split(opts.Sort, ","))
-	} else if opts.Sort != "" {
-		req.SortBy([]string{opts.Sort})
+	if opts.Sort != "" {
+		// the scores are sorted by, unlike the other fields, in the requested order
+		req.SortBy(lo.Map(strings.Split(opts.Sort, ","), func(key string, _ int) string {
+			return aggregation.SortField(key, opts.SortDescending)
+		}))
 	}
 	req.Size = int(opts.PageSize)
 	req.From = int(opts.Page * opts.PageSize)
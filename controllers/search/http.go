@@ -20,7 +20,7 @@ import (
 // @Param q query string false "The search query. Falls back to a wildcard query if not provided."
 // @Param category query string false "The category to search in" Enums(union,members,artists,media,ratings,genres)
 // @Param fuzzy query boolean false "Whether to perform a fuzzy search"
-// @Param sort query string false "The field to sort the results by" Enums(score,added,modified,name)
+// @Param sort query string false "The field to sort the results by" Enums(score,added,modified,name,rating_count,review_count,average_rating,weighted_score,contentious)
 // @Param desc query boolean false "Whether to sort the results in descending order"
 // @Param page query integer false "The page to return"
 // @Param pageSize query integer false "The number of results to return per page"
@@ -14,6 +14,7 @@ import (
 	"github.com/blevesearch/bleve/v2/mapping"
 	"github.com/rs/zerolog"
 
+	"codeberg.org/mjh/LibRate/controllers/search/aggregation"
 	searchdb "codeberg.org/mjh/LibRate/models/search"
 )
 
@@ -201,6 +202,17 @@ func buildMediaMapping(textFieldMapping, keywordMapping *mapping.FieldMapping) *
 
 	mapping.AddFieldMappingsAt("kind", keywordMapping)
 	mapping.AddFieldMappingsAt("title", textFieldMapping)
+	mapping.AddFieldMappingsAt("titles", textFieldMapping)
+	mapping.AddFieldMappingsAt("platforms", keywordMapping)
+	mapping.AddFieldMappingsAt("franchises", textFieldMapping)
+	mapping.AddFieldMappingsAt("studios", textFieldMapping)
+	mapping.AddFieldMappingsAt("authors", textFieldMapping)
+	mapping.AddFieldMappingsAt("artists", textFieldMapping)
+	mapping.AddFieldMappingsAt("serializations", textFieldMapping)
+	// the scores, to sort the results by
+	for _, score := range aggregation.ScoreAggregations {
+		mapping.AddFieldMappingsAt(score.String(), bleve.NewNumericFieldMapping())
+	}
 	//mapping.AddSubDocumentMapping("artists", artists)
 	//mapping.AddSubDocumentMapping("genres", genres)
 	//mapping.AddFieldMappingsAt("language", keywordMapping)
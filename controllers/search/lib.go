@@ -34,7 +34,8 @@ type (
 
 		// Sort is the field, that should be sorted by.
 		// When left empty, the default sorting is used.
-		Sort string `json:"sort,omitempty" query:"sort,omitempty" validate:"oneof=score added modified name"`
+		// The media can also be sorted by their scores, see aggregation.ScoreAggregations
+		Sort string `json:"sort,omitempty" query:"sort,omitempty" validate:"oneof=score added modified name rating_count review_count average_rating weighted_score contentious"`
 
 		// LocalFirst determines whether the results from the current instance should be
 		// preferred over remote results.
@@ -6,23 +6,17 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"fmt"
-	"image/gif"
-	"image/jpeg"
-	"image/png"
 	"io"
 	"mime/multipart"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/samber/lo"
 
 	"github.com/golang-jwt/jwt/v5"
 
 	h "codeberg.org/mjh/LibRate/internal/handlers"
-	"codeberg.org/mjh/LibRate/internal/lib/thumbnailer"
 	"codeberg.org/mjh/LibRate/models/static"
 )
 
@@ -108,16 +102,7 @@ func (s *Controller) saveThumb(
 	imagePath,
 	imageFormat string,
 ) {
-	var dims *thumbnailer.Dims
-	ns := s.conf.Fiber.Thumbnailing.TargetNS
-	for i := range ns {
-		// #wontfix providing more than one ns and all simultaneously
-		if lo.Contains(ns[i].Names, imageType) || ns[i].Names[0] == "all" {
-			dims = &ns[i].MaxSize
-			break
-		}
-	}
-
+	dims := s.conf.Fiber.Thumbnailing.DimsFor(imageType)
 	if dims == nil {
 		s.log.Warn().Msgf(
 			`Image of type (as in use case) %s was provided,
@@ -127,42 +112,8 @@ func (s *Controller) saveThumb(
 		return
 	}
 
-	imagePathBase := strings.TrimSuffix(imagePath, filepath.Ext(imagePath))
-	imgPathNew := imagePathBase + "_thumb" + filepath.Ext(imagePath)
-	f, err := os.Create(imgPathNew)
-	if err != nil {
+	if _, err := static.SaveThumbnail(*dims, imagePath, imageFormat); err != nil {
 		s.log.Error().Err(err).Msgf("Failed to save thumbnail for image %s", imagePath)
-		return
-	}
-	defer f.Close()
-
-	thumb, err := thumbnailer.Thumbnail(*dims, imagePath)
-	if err != nil {
-		s.log.Error().Err(err).Msgf("Failed to create thumbnail for image %s", imagePath)
-		return
-	}
-	switch imageFormat {
-	case "image/jpeg":
-		if err := jpeg.Encode(f, thumb, nil); err != nil {
-			s.log.Error().Err(err).Msgf("Failed to encode thumbnail for image %s", imagePath)
-			return
-		}
-	case "image/png":
-		if err := png.Encode(f, thumb); err != nil {
-			s.log.Error().Err(err).Msgf("Failed to encode thumbnail for image %s", imagePath)
-			return
-		}
-	case "image/gif":
-		if err := gif.Encode(f, thumb, nil); err != nil {
-			s.log.Error().Err(err).Msgf("Failed to encode thumbnail for image %s", imagePath)
-			return
-		}
-	case "image/webp":
-		s.log.Error().Msg("WebP thumbnailing disabled since both libraries I've found break my builds.")
-		return
-	default:
-		s.log.Error().Err(err).Msgf("Failed to encode thumbnail for image %s for MIME %s", imagePath, imageType)
-		return
 	}
 }
 
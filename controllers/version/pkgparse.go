@@ -2,6 +2,7 @@ package version
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 
 	h "codeberg.org/mjh/LibRate/internal/handlers"
@@ -11,9 +12,20 @@ import (
 
 // Get retrieves the version of the frontend
 func Get(c *fiber.Ctx) error {
+	version, err := Version()
+	if err != nil {
+		return h.Res(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return h.Res(c, fiber.StatusOK, version)
+}
+
+// Version reads the version from the frontend's package.json, which is the single
+// source of truth for the release number
+func Version() (string, error) {
 	f, err := os.Open("fe/package.json")
 	if err != nil {
-		return h.Res(c, fiber.StatusInternalServerError, "error reading package.json")
+		return "", errors.New("error reading package.json")
 	}
 	defer f.Close()
 
@@ -22,8 +34,8 @@ func Get(c *fiber.Ctx) error {
 	}
 
 	if err := json.NewDecoder(f).Decode(&pkg); err != nil {
-		return h.Res(c, fiber.StatusInternalServerError, "error parsing package.json")
+		return "", errors.New("error parsing package.json")
 	}
 
-	return h.Res(c, fiber.StatusOK, pkg.Version)
+	return pkg.Version, nil
 }
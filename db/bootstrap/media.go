@@ -13,7 +13,7 @@ func MediaCore(ctx context.Context, connection *sqlx.DB) (err error) {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
-		mediaKinds := []string{"album", "track", "film", "tv_show", "book", "anime", "manga", "comic", "game"}
+		mediaKinds := []string{"album", "track", "film", "tv_show", "season", "episode", "book", "anime", "manga", "comic", "game"}
 		err := createEnumType(ctx, connection, "kind", "media", mediaKinds...)
 		if err != nil {
 			return fmt.Errorf("failed to create media table: %w", err)
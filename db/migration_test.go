@@ -2,12 +2,14 @@ package db
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"codeberg.org/mjh/LibRate/cfg"
 )
@@ -108,3 +110,66 @@ func TestGetDir(t *testing.T) {
 		}
 	}
 }
+
+// latestDefinition returns the last statement in the migrations, in the order they're applied,
+// which starts with the given prefix
+func latestDefinition(t *testing.T, prefix string) (stmt string) {
+	t.Helper()
+	dirs, err := os.ReadDir("./migrations")
+	require.NoError(t, err)
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		files, err := filepath.Glob(filepath.Join("./migrations", dir.Name(), "*.up.sql"))
+		require.NoError(t, err)
+		for _, file := range files {
+			contents, err := os.ReadFile(file)
+			require.NoError(t, err)
+			sql := string(contents)
+			for i := strings.Index(sql, prefix); i >= 0; {
+				rest := sql[i:]
+				end := strings.Index(rest, ";")
+				// the bodies of functions have statements of their own
+				if body := strings.Index(rest, "$function$"); body >= 0 && body < end {
+					end = strings.Index(rest, "$function$\n;")
+				}
+				stmt = rest[:end]
+				next := strings.Index(rest[1:], prefix)
+				if next < 0 {
+					break
+				}
+				i += next + 1
+			}
+		}
+	}
+	require.NotEmpty(t, stmt, "no statement starts with %q", prefix)
+	return stmt
+}
+
+func TestSilencedReviewsAreHidden(t *testing.T) {
+	t.Run("search sync", func(t *testing.T) {
+		trigger := latestDefinition(t, "CREATE OR REPLACE TRIGGER zcouchdb_sync_reviews_basic")
+		assert.Contains(t, trigger, "WHEN (reviews.is_public(NEW.remote_actor))")
+	})
+
+	t.Run("incremental scores", func(t *testing.T) {
+		scoring := latestDefinition(t, "CREATE OR REPLACE FUNCTION reviews.score_rating()")
+		assert.Contains(t, scoring, "reviews.is_public(OLD.remote_actor)")
+		assert.Contains(t, scoring, "reviews.is_public(NEW.remote_actor)")
+	})
+
+	t.Run("rebuilt scores", func(t *testing.T) {
+		rebuild := latestDefinition(t, "CREATE OR REPLACE FUNCTION media.rebuild_scores(")
+		assert.Contains(t, rebuild, "FROM reviews.public_ratings r")
+		assert.NotContains(t, rebuild, "FROM reviews.ratings r")
+		assert.NotContains(t, rebuild, "JOIN reviews.ratings")
+	})
+
+	// the charts are computed from the scores, which leave out the silenced reviews
+	t.Run("charts", func(t *testing.T) {
+		charts := latestDefinition(t, "CREATE MATERIALIZED VIEW media.chart_entries")
+		assert.Contains(t, charts, "JOIN media.scores s")
+		assert.NotContains(t, charts, "reviews.ratings")
+	})
+}
@@ -0,0 +1,5 @@
+ALTER TABLE public.followers DROP CONSTRAINT followers_pk;
+ALTER TABLE public.followers ADD CONSTRAINT followers_pk PRIMARY KEY (follower);
+ALTER TABLE public.followers DROP COLUMN activity_iri;
+ALTER TABLE public.follow_requests DROP COLUMN activity_iri;
+ALTER TABLE public.members DROP COLUMN private_key_pem;
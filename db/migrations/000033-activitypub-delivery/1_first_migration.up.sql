@@ -0,0 +1,9 @@
+ALTER TABLE public.members ADD COLUMN private_key_pem TEXT NOT NULL DEFAULT '';
+
+-- keep the id of the Follow activity, so that Accept/Reject/Undo can reference it
+ALTER TABLE public.follow_requests ADD COLUMN activity_iri TEXT NULL;
+ALTER TABLE public.followers ADD COLUMN activity_iri TEXT NULL;
+
+-- a member can obviously follow more than one account
+ALTER TABLE public.followers DROP CONSTRAINT followers_pk;
+ALTER TABLE public.followers ADD CONSTRAINT followers_pk PRIMARY KEY (follower, followee);
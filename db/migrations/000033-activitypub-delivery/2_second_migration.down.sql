@@ -0,0 +1,3 @@
+DROP TABLE federation.activities;
+DROP TABLE federation.remote_actors;
+DROP SCHEMA IF EXISTS federation;
@@ -0,0 +1,29 @@
+CREATE SCHEMA IF NOT EXISTS federation;
+
+-- cache of remote actors, mostly needed for signature verification and delivery
+CREATE TABLE federation.remote_actors (
+	iri text NOT NULL,
+	webfinger varchar NOT NULL,
+	inbox text NOT NULL,
+	shared_inbox text NULL,
+	key_id text NOT NULL,
+	public_key_pem text NOT NULL,
+	fetched timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT remote_actors_pk PRIMARY KEY (iri)
+);
+CREATE UNIQUE INDEX remote_actors_webfinger_idx ON federation.remote_actors (webfinger);
+CREATE INDEX remote_actors_key_id_idx ON federation.remote_actors (key_id);
+
+CREATE TABLE federation.activities (
+	id serial8 NOT NULL,
+	iri text NULL,
+	kind varchar NOT NULL,
+	actor text NOT NULL,
+	object text NULL,
+	direction varchar NOT NULL CHECK (direction IN ('in', 'out')),
+	payload jsonb NOT NULL,
+	created timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT activities_pk PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX activities_iri_idx ON federation.activities (iri, direction);
+CREATE INDEX activities_actor_idx ON federation.activities (actor, direction, created DESC);
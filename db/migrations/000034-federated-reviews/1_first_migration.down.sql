@@ -0,0 +1,6 @@
+ALTER TABLE reviews.ratings DROP CONSTRAINT IF EXISTS ratings_author_check;
+DROP INDEX IF EXISTS reviews.ratings_activity_iri_idx;
+DELETE FROM reviews.ratings WHERE remote_actor IS NOT NULL;
+ALTER TABLE reviews.ratings DROP COLUMN IF EXISTS activity_iri;
+ALTER TABLE reviews.ratings DROP COLUMN IF EXISTS remote_actor;
+ALTER TABLE reviews.ratings ALTER COLUMN user_id SET NOT NULL;
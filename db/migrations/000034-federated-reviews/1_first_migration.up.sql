@@ -0,0 +1,11 @@
+-- needed for the published date of federated reviews
+ALTER TABLE reviews.ratings ADD COLUMN IF NOT EXISTS created_at timestamptz NOT NULL DEFAULT now();
+
+-- reviews received from other instances aren't authored by a local member
+ALTER TABLE reviews.ratings ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE reviews.ratings ADD COLUMN remote_actor text NULL;
+ALTER TABLE reviews.ratings ADD COLUMN activity_iri text NULL;
+CREATE UNIQUE INDEX ratings_activity_iri_idx ON reviews.ratings (activity_iri);
+
+ALTER TABLE reviews.ratings ADD CONSTRAINT ratings_author_check
+CHECK (user_id IS NOT NULL OR remote_actor IS NOT NULL);
@@ -0,0 +1,18 @@
+-- outbound deliveries are persisted, so that they survive restarts and can be retried
+CREATE TABLE federation.deliveries (
+	id serial8 NOT NULL,
+	sender varchar NOT NULL,
+	inbox text NOT NULL,
+	host varchar NOT NULL,
+	activity_iri text NULL,
+	payload bytea NOT NULL,
+	status varchar NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'dead')),
+	attempts int4 NOT NULL DEFAULT 0,
+	last_error text NULL,
+	next_attempt timestamptz NOT NULL DEFAULT now(),
+	locked_until timestamptz NULL,
+	created timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT deliveries_pk PRIMARY KEY (id)
+);
+CREATE INDEX deliveries_due_idx ON federation.deliveries (next_attempt) WHERE status <> 'dead';
+CREATE INDEX deliveries_dead_idx ON federation.deliveries (created DESC) WHERE status = 'dead';
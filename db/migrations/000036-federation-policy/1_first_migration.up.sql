@@ -0,0 +1,13 @@
+-- instance-wide moderation of other servers. A policy applies to the domain and its subdomains
+CREATE TABLE federation.domain_policies (
+	domain varchar NOT NULL,
+	-- block rejects all activities, silence accepts them but hides the content from public listings,
+	-- allow is only meaningful in allowlist mode
+	severity varchar NOT NULL CHECK (severity IN ('allow', 'silence', 'block')),
+	reject_media bool NOT NULL DEFAULT false,
+	reason text NULL,
+	created_by varchar NULL,
+	created timestamptz NOT NULL DEFAULT now(),
+	updated timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT domain_policies_pk PRIMARY KEY (domain)
+);
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS reviews.rating_placeholders;
+DROP INDEX IF EXISTS people.group_mbid_idx;
+ALTER TABLE people."group" DROP COLUMN IF EXISTS mbid;
+DROP INDEX IF EXISTS people.person_mbid_idx;
+ALTER TABLE people.person DROP COLUMN IF EXISTS mbid;
+DROP INDEX IF EXISTS media.tracks_mbid_idx;
+DROP INDEX IF EXISTS media.tracks_album_mbid_idx;
+ALTER TABLE media.tracks DROP COLUMN IF EXISTS mbid;
+DROP INDEX IF EXISTS media.albums_mbid_idx;
+ALTER TABLE media.albums DROP COLUMN IF EXISTS mbid;
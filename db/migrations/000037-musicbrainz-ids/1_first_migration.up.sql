@@ -0,0 +1,27 @@
+-- MusicBrainz identifiers, used to deduplicate re-imports
+ALTER TABLE media.albums ADD COLUMN mbid uuid NULL;
+COMMENT ON COLUMN media.albums.mbid IS 'MusicBrainz release MBID';
+CREATE UNIQUE INDEX albums_mbid_idx ON media.albums (mbid);
+
+-- the same recording can appear on several releases, e.g. compilations
+ALTER TABLE media.tracks ADD COLUMN mbid uuid NULL;
+COMMENT ON COLUMN media.tracks.mbid IS 'MusicBrainz recording MBID';
+CREATE UNIQUE INDEX tracks_album_mbid_idx ON media.tracks (album, mbid);
+CREATE INDEX tracks_mbid_idx ON media.tracks (mbid);
+
+ALTER TABLE people.person ADD COLUMN mbid uuid NULL;
+CREATE UNIQUE INDEX person_mbid_idx ON people.person (mbid);
+
+ALTER TABLE people."group" ADD COLUMN mbid uuid NULL;
+CREATE UNIQUE INDEX group_mbid_idx ON people."group" (mbid);
+
+-- media the member has listened to, but not rated yet
+CREATE TABLE reviews.rating_placeholders (
+    member_id int4 NOT NULL REFERENCES public.members(id_numeric) ON DELETE CASCADE,
+    media_id uuid NOT NULL REFERENCES media.media(id) ON DELETE CASCADE,
+    "source" varchar(32) NOT NULL,
+    listens int4 NOT NULL DEFAULT 0,
+    last_listened timestamptz NULL,
+    created timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT rating_placeholders_pkey PRIMARY KEY (member_id, media_id)
+);
@@ -0,0 +1,17 @@
+-- albums and tracks found in imported libraries, which aren't in the catalog yet
+CREATE TABLE media.submissions (
+    id bigserial NOT NULL,
+    member_id int4 NOT NULL REFERENCES public.members(id_numeric) ON DELETE CASCADE,
+    kind media.kind NOT NULL,
+    title varchar(255) NOT NULL,
+    artist varchar(255) NOT NULL,
+    album varchar(255) NULL,
+    release_year int2 NULL,
+    "source" varchar(32) NOT NULL,
+    stars int2 NULL CHECK (stars BETWEEN 1 AND 10),
+    listens int4 NOT NULL DEFAULT 0,
+    created timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT submissions_pkey PRIMARY KEY (id),
+    CONSTRAINT submissions_member_item_key UNIQUE (member_id, kind, title, artist)
+);
+COMMENT ON COLUMN media.submissions.stars IS 'the rating to add once the item is in the catalog';
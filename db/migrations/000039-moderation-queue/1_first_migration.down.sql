@@ -0,0 +1,11 @@
+CREATE OR REPLACE TRIGGER zcouchdb_sync_media
+AFTER INSERT OR UPDATE OF
+title, kind, created, added, modified
+ON media.media
+FOR EACH ROW
+EXECUTE PROCEDURE couchdb_put();
+
+DROP TABLE IF EXISTS media.moderation_comments;
+DROP INDEX IF EXISTS media.media_moderation_queue_idx;
+ALTER TABLE media.media DROP COLUMN IF EXISTS submitted_by, DROP COLUMN IF EXISTS status;
+DROP TYPE IF EXISTS media.moderation_status;
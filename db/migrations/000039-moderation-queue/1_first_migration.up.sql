@@ -0,0 +1,31 @@
+CREATE TYPE media.moderation_status AS ENUM ('pending', 'approved', 'rejected', 'needs-changes');
+
+-- everything added before the queue existed counts as approved
+ALTER TABLE media.media
+    ADD COLUMN status media.moderation_status NOT NULL DEFAULT 'approved',
+    ADD COLUMN submitted_by int4 NULL REFERENCES public.members(id_numeric) ON DELETE SET NULL;
+COMMENT ON COLUMN media.media.status IS 'only approved media are shown and indexed for search';
+COMMENT ON COLUMN media.media.submitted_by IS 'the member who submitted the media through the form';
+
+CREATE INDEX media_moderation_queue_idx ON media.media (added) WHERE status IN ('pending', 'needs-changes');
+
+CREATE TABLE media.moderation_comments (
+    id bigserial NOT NULL,
+    media_id uuid NOT NULL REFERENCES media.media(id) ON DELETE CASCADE,
+    reviewer int4 NULL REFERENCES public.members(id_numeric) ON DELETE SET NULL,
+    -- the status the reviewer set
+    status media.moderation_status NOT NULL,
+    body text NOT NULL DEFAULT '',
+    created timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT moderation_comments_pkey PRIMARY KEY (id)
+);
+CREATE INDEX moderation_comments_media_idx ON media.moderation_comments (media_id, created);
+
+-- submissions reach CouchDB, and so the search index, only once they're approved
+CREATE OR REPLACE TRIGGER zcouchdb_sync_media
+AFTER INSERT OR UPDATE OF
+title, kind, created, added, modified, status
+ON media.media
+FOR EACH ROW
+WHEN (NEW.status = 'approved')
+EXECUTE PROCEDURE couchdb_put();
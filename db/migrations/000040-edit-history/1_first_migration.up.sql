@@ -0,0 +1,17 @@
+-- wiki-style history of the edits to media, people and genres
+CREATE TABLE media.revisions (
+    id bigserial NOT NULL,
+    target varchar(16) NOT NULL CHECK (target IN ('media', 'album', 'film', 'book', 'person', 'genre')),
+    -- UUID of the media or person, or the numeric ID of the genre
+    target_id varchar(64) NOT NULL,
+    "before" jsonb NOT NULL,
+    "after" jsonb NOT NULL,
+    -- kept as the webfinger, so that the history survives the deletion of the editor's account
+    editor varchar(255) NOT NULL,
+    summary text NOT NULL DEFAULT '',
+    reverts int8 NULL REFERENCES media.revisions(id) ON DELETE SET NULL,
+    created timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT revisions_pkey PRIMARY KEY (id)
+);
+CREATE INDEX revisions_target_idx ON media.revisions (target, target_id, created DESC);
+CREATE INDEX revisions_editor_idx ON media.revisions (editor);
@@ -0,0 +1,5 @@
+ALTER TABLE media.tv_show_episodes DROP COLUMN IF EXISTS plot, DROP COLUMN IF EXISTS duration, DROP COLUMN IF EXISTS air_date;
+ALTER TABLE media.tv_shows DROP COLUMN IF EXISTS active, DROP COLUMN IF EXISTS "year";
+DROP INDEX IF EXISTS media.media_submitted_with_idx;
+ALTER TABLE media.media DROP COLUMN IF EXISTS submitted_with;
+-- enum values can't be dropped, 'season' and 'episode' stay in media.kind
@@ -0,0 +1,15 @@
+ALTER TYPE media."kind" ADD VALUE IF NOT EXISTS 'season';
+ALTER TYPE media."kind" ADD VALUE IF NOT EXISTS 'episode';
+
+-- tracks, seasons and episodes submitted along with their album or TV show are moderated together with it
+ALTER TABLE media.media ADD COLUMN submitted_with uuid NULL REFERENCES media.media(id) ON DELETE SET NULL;
+CREATE INDEX media_submitted_with_idx ON media.media (submitted_with) WHERE submitted_with IS NOT NULL;
+
+ALTER TABLE media.tv_shows
+ADD COLUMN "year" int2 NULL,
+ADD COLUMN active bool NOT NULL DEFAULT false;
+
+ALTER TABLE media.tv_show_episodes
+ADD COLUMN air_date date NULL,
+ADD COLUMN duration interval NULL,
+ADD COLUMN plot text NULL;
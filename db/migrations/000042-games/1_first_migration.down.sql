@@ -0,0 +1,61 @@
+CREATE OR REPLACE FUNCTION public.json_serialize(target_table TEXT, table_data RECORD)
+ RETURNS jsonb
+ LANGUAGE plpgsql IMMUTABLE
+AS $function$
+DECLARE
+    DOC jsonb;
+    FULL_ARTIST_NAME TEXT;
+    REVIEWER_WF TEXT;
+    REVIEW_MEDIA_TITLE TEXT;
+    GENRE_DESCRIPTIONS public.genre_description[];
+    GENRE_NAME text;
+    GENRE_KINDS text[];
+    CITY TEXT;
+    ADDED timestamptz;
+    MODIFIED timestamptz;
+BEGIN
+    MODIFIED := CURRENT_TIMESTAMP AT TIME ZONE 'UTC';
+   IF NOT target_table = 'genres' OR target_table = 'members' THEN
+  ADDED := to_timestamp(table_data.added) AT TIME ZONE 'UTC';
+   END IF;
+   CASE target_table
+        WHEN 'genres' THEN
+            GENRE_DESCRIPTIONS := ARRAY(SELECT ROW(description, language) FROM media."genre_descriptions" WHERE genre_id = table_data.id);
+            DOC := jsonb_build_object('name', table_data.name, 'kinds', table_data.kinds, 'descriptions', jsonb_build_array(GENRE_DESCRIPTIONS));
+        WHEN 'members' THEN
+            DOC := jsonb_build_object('bio', table_data.bio, 'display_name', table_data.display_name, 'webfinger', table_data.webfinger);
+        WHEN 'media' THEN
+            DOC := jsonb_build_object('title', table_data.title, 'kind', table_data.kind, 
+            'created', table_data.created, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'person' THEN
+            FULL_ARTIST_NAME := CONCAT(table_data.first_name, ' ', table_data.last_name);
+            DOC := jsonb_build_object('name', FULL_ARTIST_NAME, 'nick_names', table_data.nick_names,
+             'bio', table_data.bio, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'group' THEN
+            DOC := jsonb_build_object('name', table_data.name, 'active', table_data.active, 
+            'bio', table_data.bio, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'studio' THEN
+            DOC := jsonb_build_object('name', table_data.name, 'kind', table_data.kind, 'city', table_data.city, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'genre_descriptions' THEN
+            GENRE_NAME := (SELECT name FROM media."genres" WHERE id = table_data.genre_id);
+            GENRE_KINDS := (SELECT kinds FROM media."genres" WHERE id = table_data.genre_id);
+            DOC := jsonb_build_object('name', GENRE_NAME, 'kinds', GENRE_KINDS,
+             'descriptions', jsonb_build_array('language', table_data.language, 'description', table_data.description));
+        WHEN 'ratings' THEN
+            REVIEWER_WF := (SELECT webfinger FROM public.members WHERE uuid = table_data.user_id);
+            REVIEW_MEDIA_TITLE := (SELECT title FROM media.media WHERE id = table_data.media_id);
+            DOC := jsonb_build_object('topic', NEW.topic, 'body', NEW.body, 'user', webfinger, 'media_title', media_title, 'added', NEW.added, 'modified', NEW.modified);
+    END CASE;
+    RETURN DOC;
+END;
+$function$
+;
+
+DROP TABLE IF EXISTS media.game_releases;
+DROP TABLE IF EXISTS media.game_studios;
+DROP TABLE IF EXISTS media.game_genres;
+DROP TABLE IF EXISTS media.game_franchises;
+DROP TABLE IF EXISTS media.game_platforms;
+DROP TABLE IF EXISTS media.games;
+DROP TABLE IF EXISTS media.franchises;
+DROP TABLE IF EXISTS media.platforms;
@@ -0,0 +1,125 @@
+CREATE TABLE media.platforms (
+	id serial PRIMARY KEY,
+	name varchar(128) NOT NULL,
+	CONSTRAINT platforms_name_key UNIQUE (name)
+);
+
+INSERT INTO media.platforms (name) VALUES
+('PC'), ('macOS'), ('Linux'), ('PlayStation'), ('PlayStation 2'), ('PlayStation 3'), ('PlayStation 4'),
+('PlayStation 5'), ('PlayStation Portable'), ('PlayStation Vita'), ('Xbox'), ('Xbox 360'), ('Xbox One'),
+('Xbox Series X/S'), ('NES'), ('SNES'), ('Nintendo 64'), ('GameCube'), ('Wii'), ('Wii U'), ('Nintendo Switch'),
+('Game Boy'), ('Game Boy Color'), ('Game Boy Advance'), ('Nintendo DS'), ('Nintendo 3DS'), ('Sega Master System'),
+('Sega Genesis'), ('Sega Saturn'), ('Dreamcast'), ('Amiga'), ('Commodore 64'), ('ZX Spectrum'), ('MS-DOS'),
+('Arcade'), ('iOS'), ('Android');
+
+CREATE TABLE media.franchises (
+	id serial PRIMARY KEY,
+	name varchar(255) NOT NULL,
+	CONSTRAINT franchises_name_key UNIQUE (name)
+);
+
+CREATE TABLE media.games (
+	media_id uuid PRIMARY KEY REFERENCES media.media(id) ON DELETE CASCADE,
+	title varchar(255) NOT NULL,
+	synopsis text NULL
+);
+
+CREATE TABLE media.game_platforms (
+	game uuid NOT NULL REFERENCES media.games(media_id) ON DELETE CASCADE,
+	platform int4 NOT NULL REFERENCES media.platforms(id) ON DELETE CASCADE,
+	PRIMARY KEY (game, platform)
+);
+
+CREATE TABLE media.game_franchises (
+	game uuid NOT NULL REFERENCES media.games(media_id) ON DELETE CASCADE,
+	franchise int4 NOT NULL REFERENCES media.franchises(id) ON DELETE CASCADE,
+	PRIMARY KEY (game, franchise)
+);
+
+CREATE TABLE media.game_genres (
+	game uuid NOT NULL REFERENCES media.games(media_id) ON DELETE CASCADE,
+	genre int2 NOT NULL REFERENCES media.genres(id) ON DELETE CASCADE,
+	PRIMARY KEY (game, genre)
+);
+
+CREATE TABLE media.game_studios (
+	game uuid NOT NULL REFERENCES media.games(media_id) ON DELETE CASCADE,
+	studio int4 NOT NULL REFERENCES people.studio(id_numeric) ON DELETE CASCADE,
+	"role" varchar(16) NOT NULL CHECK ("role" IN ('developer', 'publisher')),
+	PRIMARY KEY (game, studio, "role")
+);
+
+-- the release dates differ between regions and platforms
+CREATE TABLE media.game_releases (
+	id serial PRIMARY KEY,
+	game uuid NOT NULL REFERENCES media.games(media_id) ON DELETE CASCADE,
+	-- ISO 3166-1 alpha-2 code, or WW for worldwide releases
+	region char(2) NOT NULL,
+	platform int4 NULL REFERENCES media.platforms(id) ON DELETE CASCADE,
+	release_date date NOT NULL
+);
+CREATE UNIQUE INDEX game_releases_region_platform_idx ON media.game_releases (game, region, COALESCE(platform, 0));
+
+CREATE OR REPLACE FUNCTION public.json_serialize(target_table TEXT, table_data RECORD)
+ RETURNS jsonb
+ LANGUAGE plpgsql IMMUTABLE
+AS $function$
+DECLARE
+    DOC jsonb;
+    FULL_ARTIST_NAME TEXT;
+    REVIEWER_WF TEXT;
+    REVIEW_MEDIA_TITLE TEXT;
+    GENRE_DESCRIPTIONS public.genre_description[];
+    GENRE_NAME text;
+    GENRE_KINDS text[];
+    CITY TEXT;
+    ADDED timestamptz;
+    MODIFIED timestamptz;
+BEGIN
+    MODIFIED := CURRENT_TIMESTAMP AT TIME ZONE 'UTC';
+   IF NOT target_table = 'genres' OR target_table = 'members' THEN
+  ADDED := to_timestamp(table_data.added) AT TIME ZONE 'UTC';
+   END IF;
+   CASE target_table
+        WHEN 'genres' THEN
+            GENRE_DESCRIPTIONS := ARRAY(SELECT ROW(description, language) FROM media."genre_descriptions" WHERE genre_id = table_data.id);
+            DOC := jsonb_build_object('name', table_data.name, 'kinds', table_data.kinds, 'descriptions', jsonb_build_array(GENRE_DESCRIPTIONS));
+        WHEN 'members' THEN
+            DOC := jsonb_build_object('bio', table_data.bio, 'display_name', table_data.display_name, 'webfinger', table_data.webfinger);
+        WHEN 'media' THEN
+            DOC := jsonb_build_object('title', table_data.title, 'kind', table_data.kind, 
+            'created', table_data.created, 'added', ADDED, 'modified', MODIFIED);
+            -- games can also be found by their platforms, franchises and studios
+            IF table_data.kind = 'game' THEN
+                DOC := DOC || jsonb_build_object(
+                'platforms', ARRAY(SELECT p.name FROM media.game_platforms gp
+                    JOIN media.platforms p ON p.id = gp.platform WHERE gp.game = table_data.id),
+                'franchises', ARRAY(SELECT f.name FROM media.game_franchises gf
+                    JOIN media.franchises f ON f.id = gf.franchise WHERE gf.game = table_data.id),
+                'studios', ARRAY(SELECT DISTINCT s.name FROM media.game_studios gs
+                    JOIN people.studio s ON s.id_numeric = gs.studio WHERE gs.game = table_data.id));
+            END IF;
+        WHEN 'person' THEN
+            FULL_ARTIST_NAME := CONCAT(table_data.first_name, ' ', table_data.last_name);
+            DOC := jsonb_build_object('name', FULL_ARTIST_NAME, 'nick_names', table_data.nick_names,
+             'bio', table_data.bio, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'group' THEN
+            DOC := jsonb_build_object('name', table_data.name, 'active', table_data.active, 
+            'bio', table_data.bio, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'studio' THEN
+            DOC := jsonb_build_object('name', table_data.name, 'kind', table_data.kind, 'city', table_data.city, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'genre_descriptions' THEN
+            GENRE_NAME := (SELECT name FROM media."genres" WHERE id = table_data.genre_id);
+            GENRE_KINDS := (SELECT kinds FROM media."genres" WHERE id = table_data.genre_id);
+            DOC := jsonb_build_object('name', GENRE_NAME, 'kinds', GENRE_KINDS,
+             'descriptions', jsonb_build_array('language', table_data.language, 'description', table_data.description));
+        WHEN 'ratings' THEN
+            REVIEWER_WF := (SELECT webfinger FROM public.members WHERE uuid = table_data.user_id);
+            REVIEW_MEDIA_TITLE := (SELECT title FROM media.media WHERE id = table_data.media_id);
+            DOC := jsonb_build_object('topic', NEW.topic, 'body', NEW.body, 'user', webfinger, 'media_title', media_title, 'added', NEW.added, 'modified', NEW.modified);
+    END CASE;
+    RETURN DOC;
+END;
+$function$
+;
+
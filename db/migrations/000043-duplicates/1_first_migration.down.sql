@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS media.media_title_trgm_idx;
+DROP INDEX IF EXISTS people.studio_name_trgm_idx;
+DROP INDEX IF EXISTS people.group_name_trgm_idx;
+DROP INDEX IF EXISTS people.person_name_trgm_idx;
+DROP TABLE IF EXISTS media.redirects;
+DROP TABLE IF EXISTS media.duplicate_candidates;
@@ -0,0 +1,34 @@
+-- likely duplicates found by the background scan, waiting for a moderator to merge or dismiss them
+CREATE TABLE media.duplicate_candidates (
+    id bigserial NOT NULL,
+    target varchar(16) NOT NULL CHECK (target IN ('person', 'group', 'studio', 'media')),
+    -- the suggested survivor, usually the older row
+    first_id varchar(64) NOT NULL,
+    second_id varchar(64) NOT NULL,
+    score real NOT NULL CHECK (score BETWEEN 0 AND 1),
+    reasons text[] NOT NULL DEFAULT '{}',
+    status varchar(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'merged', 'dismissed')),
+    found timestamptz NOT NULL DEFAULT now(),
+    resolved_by varchar(255) NULL,
+    resolved timestamptz NULL,
+    CONSTRAINT duplicate_candidates_pkey PRIMARY KEY (id),
+    CONSTRAINT duplicate_candidates_pair_key UNIQUE (target, first_id, second_id)
+);
+CREATE INDEX duplicate_candidates_status_idx ON media.duplicate_candidates (status, score DESC);
+
+-- the rows merged into others, so that the old links keep working
+CREATE TABLE media.redirects (
+    target varchar(16) NOT NULL CHECK (target IN ('person', 'group', 'studio', 'media')),
+    from_id varchar(64) NOT NULL,
+    to_id varchar(64) NOT NULL,
+    merged_by varchar(255) NOT NULL,
+    merged timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT redirects_pkey PRIMARY KEY (target, from_id)
+);
+CREATE INDEX redirects_to_idx ON media.redirects (target, to_id);
+
+-- the scan pairs the rows with similar names
+CREATE INDEX person_name_trgm_idx ON people.person USING gin (lower(first_name || ' ' || last_name) gin_trgm_ops);
+CREATE INDEX group_name_trgm_idx ON people."group" USING gin (lower(name) gin_trgm_ops);
+CREATE INDEX studio_name_trgm_idx ON people.studio USING gin (lower(name) gin_trgm_ops);
+CREATE INDEX media_title_trgm_idx ON media.media USING gin (lower(title) gin_trgm_ops);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS media.books_work_idx;
+DROP INDEX IF EXISTS media.albums_work_idx;
+ALTER TABLE media.books DROP COLUMN IF EXISTS work;
+ALTER TABLE media.albums DROP COLUMN IF EXISTS edition;
+ALTER TABLE media.albums DROP COLUMN IF EXISTS work;
+DROP TABLE IF EXISTS media.works;
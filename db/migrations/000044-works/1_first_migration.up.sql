@@ -0,0 +1,17 @@
+-- a work groups the editions of the same album (a release group) or book,
+-- e.g. the original release, remasters, deluxe editions and translations
+CREATE TABLE media.works (
+	id uuid NOT NULL DEFAULT uuid_time_nextval(30,65536),
+	kind varchar(16) NOT NULL CHECK (kind IN ('album', 'book')),
+	title varchar(255) NOT NULL,
+	created timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT works_pkey PRIMARY KEY (id)
+);
+
+ALTER TABLE media.albums ADD COLUMN work uuid NULL REFERENCES media.works(id) ON DELETE SET NULL;
+-- what sets the edition apart, like the books' edition column
+ALTER TABLE media.albums ADD COLUMN edition varchar(255) NOT NULL DEFAULT '';
+ALTER TABLE media.books ADD COLUMN work uuid NULL REFERENCES media.works(id) ON DELETE SET NULL;
+
+CREATE INDEX albums_work_idx ON media.albums (work);
+CREATE INDEX books_work_idx ON media.books (work);
@@ -0,0 +1,181 @@
+CREATE TABLE media.anime (
+	media_id uuid PRIMARY KEY REFERENCES media.media(id) ON DELETE CASCADE,
+	title varchar(255) NOT NULL,
+	format varchar(16) NOT NULL DEFAULT 'tv' CHECK (format IN ('tv', 'movie', 'ova', 'ona', 'special')),
+	-- the announced number of episodes, which may differ from the ones listed
+	episode_count int2 NULL CHECK (episode_count > 0),
+	synopsis text NULL
+);
+
+CREATE TABLE media.anime_studios (
+	anime uuid NOT NULL REFERENCES media.anime(media_id) ON DELETE CASCADE,
+	studio int4 NOT NULL REFERENCES people.studio(id_numeric) ON DELETE CASCADE,
+	PRIMARY KEY (anime, studio)
+);
+
+CREATE TABLE media.anime_genres (
+	anime uuid NOT NULL REFERENCES media.anime(media_id) ON DELETE CASCADE,
+	genre int2 NOT NULL REFERENCES media.genres(id) ON DELETE CASCADE,
+	PRIMARY KEY (anime, genre)
+);
+
+-- the seasons (cours) are numbered within the anime, the broadcast season is when they started airing
+CREATE TABLE media.anime_seasons (
+	anime uuid NOT NULL REFERENCES media.anime(media_id) ON DELETE CASCADE,
+	"number" int2 NOT NULL CHECK ("number" > 0),
+	title varchar(255) NOT NULL DEFAULT '',
+	"year" int2 NULL,
+	quarter varchar(8) NULL CHECK (quarter IN ('winter', 'spring', 'summer', 'fall')),
+	PRIMARY KEY (anime, "number")
+);
+
+-- the foreign keys to the seasons and volumes are deferred, so that merging duplicates can move
+-- the episodes and chapters before the seasons and volumes they belong to
+CREATE TABLE media.anime_episodes (
+	anime uuid NOT NULL,
+	season int2 NOT NULL,
+	"number" int2 NOT NULL CHECK ("number" > 0),
+	title varchar(255) NOT NULL,
+	air_date date NULL,
+	PRIMARY KEY (anime, season, "number"),
+	FOREIGN KEY (anime, season) REFERENCES media.anime_seasons(anime, "number") ON DELETE CASCADE
+		DEFERRABLE INITIALLY DEFERRED
+);
+
+-- manga and comics share their tables, media.media tells them apart
+CREATE TABLE media.comics (
+	media_id uuid PRIMARY KEY REFERENCES media.media(id) ON DELETE CASCADE,
+	title varchar(255) NOT NULL,
+	status varchar(16) NOT NULL DEFAULT 'ongoing' CHECK (status IN ('ongoing', 'completed', 'hiatus', 'cancelled')),
+	-- the publisher of the collected volumes
+	publisher int4 NULL REFERENCES people.studio(id_numeric) ON DELETE SET NULL,
+	synopsis text NULL
+);
+
+-- the people writing the story and drawing it are often different
+CREATE TABLE media.comic_creators (
+	comic uuid NOT NULL REFERENCES media.comics(media_id) ON DELETE CASCADE,
+	person uuid NOT NULL REFERENCES people.person(id) ON DELETE CASCADE,
+	"role" varchar(16) NOT NULL CHECK ("role" IN ('author', 'artist')),
+	PRIMARY KEY (comic, person, "role")
+);
+
+CREATE TABLE media.comic_genres (
+	comic uuid NOT NULL REFERENCES media.comics(media_id) ON DELETE CASCADE,
+	genre int2 NOT NULL REFERENCES media.genres(id) ON DELETE CASCADE,
+	PRIMARY KEY (comic, genre)
+);
+
+CREATE TABLE media.comic_volumes (
+	comic uuid NOT NULL REFERENCES media.comics(media_id) ON DELETE CASCADE,
+	"number" int2 NOT NULL CHECK ("number" > 0),
+	title varchar(255) NOT NULL DEFAULT '',
+	release_date date NULL,
+	isbn varchar(17) NULL,
+	PRIMARY KEY (comic, "number")
+);
+
+-- the chapters not collected in a volume yet have no volume number
+CREATE TABLE media.comic_chapters (
+	comic uuid NOT NULL REFERENCES media.comics(media_id) ON DELETE CASCADE,
+	"number" int2 NOT NULL CHECK ("number" > 0),
+	volume int2 NULL,
+	title varchar(255) NOT NULL DEFAULT '',
+	release_date date NULL,
+	PRIMARY KEY (comic, "number"),
+	FOREIGN KEY (comic, volume) REFERENCES media.comic_volumes(comic, "number") DEFERRABLE INITIALLY DEFERRED
+);
+
+-- the magazines manga and comics are serialized in before being collected in volumes
+CREATE TABLE media.magazines (
+	id serial PRIMARY KEY,
+	name varchar(255) NOT NULL,
+	CONSTRAINT magazines_name_key UNIQUE (name)
+);
+
+CREATE TABLE media.comic_serializations (
+	comic uuid NOT NULL REFERENCES media.comics(media_id) ON DELETE CASCADE,
+	magazine int4 NOT NULL REFERENCES media.magazines(id) ON DELETE CASCADE,
+	started date NULL,
+	ended date NULL,
+	PRIMARY KEY (comic, magazine)
+);
+
+CREATE OR REPLACE FUNCTION public.json_serialize(target_table TEXT, table_data RECORD)
+ RETURNS jsonb
+ LANGUAGE plpgsql IMMUTABLE
+AS $function$
+DECLARE
+    DOC jsonb;
+    FULL_ARTIST_NAME TEXT;
+    REVIEWER_WF TEXT;
+    REVIEW_MEDIA_TITLE TEXT;
+    GENRE_DESCRIPTIONS public.genre_description[];
+    GENRE_NAME text;
+    GENRE_KINDS text[];
+    CITY TEXT;
+    ADDED timestamptz;
+    MODIFIED timestamptz;
+BEGIN
+    MODIFIED := CURRENT_TIMESTAMP AT TIME ZONE 'UTC';
+   IF NOT target_table = 'genres' OR target_table = 'members' THEN
+  ADDED := to_timestamp(table_data.added) AT TIME ZONE 'UTC';
+   END IF;
+   CASE target_table
+        WHEN 'genres' THEN
+            GENRE_DESCRIPTIONS := ARRAY(SELECT ROW(description, language) FROM media."genre_descriptions" WHERE genre_id = table_data.id);
+            DOC := jsonb_build_object('name', table_data.name, 'kinds', table_data.kinds, 'descriptions', jsonb_build_array(GENRE_DESCRIPTIONS));
+        WHEN 'members' THEN
+            DOC := jsonb_build_object('bio', table_data.bio, 'display_name', table_data.display_name, 'webfinger', table_data.webfinger);
+        WHEN 'media' THEN
+            DOC := jsonb_build_object('title', table_data.title, 'kind', table_data.kind, 
+            'created', table_data.created, 'added', ADDED, 'modified', MODIFIED,
+            -- the original, romanized and localized titles can be searched for too
+            'titles', ARRAY(SELECT t.title FROM media.titles t WHERE t.media_id = table_data.id));
+            -- games can also be found by their platforms, franchises and studios
+            IF table_data.kind = 'game' THEN
+                DOC := DOC || jsonb_build_object(
+                'platforms', ARRAY(SELECT p.name FROM media.game_platforms gp
+                    JOIN media.platforms p ON p.id = gp.platform WHERE gp.game = table_data.id),
+                'franchises', ARRAY(SELECT f.name FROM media.game_franchises gf
+                    JOIN media.franchises f ON f.id = gf.franchise WHERE gf.game = table_data.id),
+                'studios', ARRAY(SELECT DISTINCT s.name FROM media.game_studios gs
+                    JOIN people.studio s ON s.id_numeric = gs.studio WHERE gs.game = table_data.id));
+            ELSIF table_data.kind = 'anime' THEN
+                DOC := DOC || jsonb_build_object(
+                'studios', ARRAY(SELECT s.name FROM media.anime_studios ast
+                    JOIN people.studio s ON s.id_numeric = ast.studio WHERE ast.anime = table_data.id));
+            -- manga and comics by their writers, artists and the magazines they ran in
+            ELSIF table_data.kind IN ('manga', 'comic') THEN
+                DOC := DOC || jsonb_build_object(
+                'authors', ARRAY(SELECT p.first_name || ' ' || p.last_name FROM media.comic_creators cc
+                    JOIN people.person p ON p.id = cc.person WHERE cc.comic = table_data.id AND cc."role" = 'author'),
+                'artists', ARRAY(SELECT p.first_name || ' ' || p.last_name FROM media.comic_creators cc
+                    JOIN people.person p ON p.id = cc.person WHERE cc.comic = table_data.id AND cc."role" = 'artist'),
+                'serializations', ARRAY(SELECT m.name FROM media.comic_serializations cs
+                    JOIN media.magazines m ON m.id = cs.magazine WHERE cs.comic = table_data.id));
+            END IF;
+        WHEN 'person' THEN
+            FULL_ARTIST_NAME := CONCAT(table_data.first_name, ' ', table_data.last_name);
+            DOC := jsonb_build_object('name', FULL_ARTIST_NAME, 'nick_names', table_data.nick_names,
+             'bio', table_data.bio, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'group' THEN
+            DOC := jsonb_build_object('name', table_data.name, 'active', table_data.active, 
+            'bio', table_data.bio, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'studio' THEN
+            DOC := jsonb_build_object('name', table_data.name, 'kind', table_data.kind, 'city', table_data.city, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'genre_descriptions' THEN
+            GENRE_NAME := (SELECT name FROM media."genres" WHERE id = table_data.genre_id);
+            GENRE_KINDS := (SELECT kinds FROM media."genres" WHERE id = table_data.genre_id);
+            DOC := jsonb_build_object('name', GENRE_NAME, 'kinds', GENRE_KINDS,
+             'descriptions', jsonb_build_array('language', table_data.language, 'description', table_data.description));
+        WHEN 'ratings' THEN
+            REVIEWER_WF := (SELECT webfinger FROM public.members WHERE uuid = table_data.user_id);
+            REVIEW_MEDIA_TITLE := (SELECT title FROM media.media WHERE id = table_data.media_id);
+            DOC := jsonb_build_object('topic', NEW.topic, 'body', NEW.body, 'user', webfinger, 'media_title', media_title, 'added', NEW.added, 'modified', NEW.modified);
+    END CASE;
+    RETURN DOC;
+END;
+$function$
+;
+
@@ -0,0 +1,22 @@
+DROP FUNCTION IF EXISTS reviews.member_stars(int2, uuid);
+
+-- the ratings are rounded back to the 1-10 scale, so the rollback loses their precision
+
+ALTER TABLE media.submissions DROP CONSTRAINT IF EXISTS submissions_stars_check;
+UPDATE media.submissions SET stars = greatest(1, round(stars / 100.0));
+ALTER TABLE media.submissions ADD CONSTRAINT submissions_stars_check CHECK (stars BETWEEN 1 AND 10);
+
+ALTER TABLE reviews.cast_ratings DROP CONSTRAINT IF EXISTS cast_ratings_stars_check;
+UPDATE reviews.cast_ratings SET stars = greatest(1, round(stars / 100.0));
+ALTER TABLE reviews.cast_ratings ADD CONSTRAINT cast_ratings_stars_check CHECK (stars BETWEEN 1 AND 10);
+
+ALTER TABLE reviews.track_ratings DROP CONSTRAINT IF EXISTS track_ratings_stars_check;
+UPDATE reviews.track_ratings SET stars = greatest(1, round(stars / 100.0));
+ALTER TABLE reviews.track_ratings ADD CONSTRAINT track_ratings_stars_check CHECK (stars BETWEEN 1 AND 10);
+
+ALTER TABLE reviews.ratings DROP CONSTRAINT IF EXISTS ratings_stars_check;
+UPDATE reviews.ratings SET stars = greatest(1, round(stars / 100.0));
+ALTER TABLE reviews.ratings ADD CONSTRAINT ratings_stars_check CHECK (stars BETWEEN 1 AND 10);
+
+ALTER TABLE public.member_prefs DROP CONSTRAINT IF EXISTS member_prefs_rating_scale_check;
+ALTER TABLE public.member_prefs DROP COLUMN IF EXISTS rating_scale_step;
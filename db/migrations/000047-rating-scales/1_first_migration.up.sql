@@ -0,0 +1,43 @@
+-- the ratings are stored on a 0-1000 reference scale and converted to each member's scale,
+-- so that e.g. 3.5 out of 5 stars and 70 out of 100 are both stored as 700
+ALTER TABLE public.member_prefs ADD COLUMN rating_scale_step numeric(3,2) NOT NULL DEFAULT 1
+	CHECK (rating_scale_step > 0 AND rating_scale_step <= 1);
+ALTER TABLE public.member_prefs ADD CONSTRAINT member_prefs_rating_scale_check
+	CHECK (rating_scale_lower >= 0 AND rating_scale_lower < rating_scale_upper AND rating_scale_upper <= 100);
+
+-- the old ratings were on the default 1-10 scale
+ALTER TABLE reviews.ratings DROP CONSTRAINT IF EXISTS ratings_stars_check;
+UPDATE reviews.ratings SET stars = stars * 100;
+ALTER TABLE reviews.ratings ADD CONSTRAINT ratings_stars_check CHECK (stars BETWEEN 0 AND 1000);
+
+ALTER TABLE reviews.track_ratings DROP CONSTRAINT IF EXISTS track_ratings_stars_check;
+UPDATE reviews.track_ratings SET stars = stars * 100;
+ALTER TABLE reviews.track_ratings ADD CONSTRAINT track_ratings_stars_check CHECK (stars BETWEEN 0 AND 1000);
+
+ALTER TABLE reviews.cast_ratings DROP CONSTRAINT IF EXISTS cast_ratings_stars_check;
+UPDATE reviews.cast_ratings SET stars = stars * 100;
+ALTER TABLE reviews.cast_ratings ADD CONSTRAINT cast_ratings_stars_check CHECK (stars BETWEEN 0 AND 1000);
+
+ALTER TABLE media.submissions DROP CONSTRAINT IF EXISTS submissions_stars_check;
+UPDATE media.submissions SET stars = stars * 100;
+ALTER TABLE media.submissions ADD CONSTRAINT submissions_stars_check CHECK (stars BETWEEN 0 AND 1000);
+
+-- converts a stored rating to the member's scale, rounded to its steps, for the exports.
+-- Mirrors models.RatingScale.Denormalize
+CREATE OR REPLACE FUNCTION reviews.member_stars(stars int2, member uuid)
+ RETURNS numeric
+ LANGUAGE sql
+ STABLE
+AS $function$
+	SELECT greatest(s.lower, least(s.upper,
+		round(stars * s.upper / 1000.0 / s.step) * s.step))
+	FROM (
+		SELECT COALESCE(p.rating_scale_lower, 1) AS lower,
+			COALESCE(p.rating_scale_upper, 10) AS upper,
+			COALESCE(p.rating_scale_step, 1) AS step
+		FROM public.members m
+		LEFT JOIN public.member_prefs p ON p.member_id = m.id
+		WHERE m.uuid = member
+	) s
+$function$
+;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS reviews.secondary_ratings;
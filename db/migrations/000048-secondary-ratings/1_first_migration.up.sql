@@ -0,0 +1,12 @@
+-- ratings of single aspects of the media, like the acting or the soundtrack, given along with a review.
+-- Which aspects can be rated depends on the kind of media, see models.ValidAspect
+CREATE TABLE reviews.secondary_ratings (
+	id bigserial NOT NULL,
+	rating_id int8 NOT NULL REFERENCES reviews.ratings(id_numeric) ON DELETE CASCADE,
+	kind varchar(16) NOT NULL CHECK (kind IN ('plotline', 'soundtrack', 'acting', 'scenography',
+		'scenario', 'theme', 'gameplay', 'story', 'graphics')),
+	-- on the 0-1000 reference scale, like reviews.ratings.stars
+	stars int2 NOT NULL CHECK (stars BETWEEN 0 AND 1000),
+	CONSTRAINT secondary_ratings_pkey PRIMARY KEY (id),
+	CONSTRAINT secondary_ratings_rating_kind_key UNIQUE (rating_id, kind)
+);
@@ -0,0 +1,90 @@
+DROP TRIGGER IF EXISTS ratings_score ON reviews.ratings;
+DROP TRIGGER IF EXISTS ratings_weigh ON reviews.ratings;
+DROP FUNCTION IF EXISTS media.rebuild_scores(boolean);
+DROP FUNCTION IF EXISTS reviews.score_rating();
+DROP FUNCTION IF EXISTS reviews.weigh_rating();
+DROP FUNCTION IF EXISTS media.refresh_scores(uuid[], boolean);
+DROP FUNCTION IF EXISTS media.add_to_score(uuid, int2, real, boolean, int);
+DROP TABLE IF EXISTS media.score_priors;
+DROP TABLE IF EXISTS media.scores;
+DROP FUNCTION IF EXISTS reviews.rating_weight(uuid);
+ALTER TABLE reviews.ratings DROP COLUMN IF EXISTS weight;
+
+CREATE OR REPLACE FUNCTION public.json_serialize(target_table TEXT, table_data RECORD)
+ RETURNS jsonb
+ LANGUAGE plpgsql IMMUTABLE
+AS $function$
+DECLARE
+    DOC jsonb;
+    FULL_ARTIST_NAME TEXT;
+    REVIEWER_WF TEXT;
+    REVIEW_MEDIA_TITLE TEXT;
+    GENRE_DESCRIPTIONS public.genre_description[];
+    GENRE_NAME text;
+    GENRE_KINDS text[];
+    CITY TEXT;
+    ADDED timestamptz;
+    MODIFIED timestamptz;
+BEGIN
+    MODIFIED := CURRENT_TIMESTAMP AT TIME ZONE 'UTC';
+   IF NOT target_table = 'genres' OR target_table = 'members' THEN
+  ADDED := to_timestamp(table_data.added) AT TIME ZONE 'UTC';
+   END IF;
+   CASE target_table
+        WHEN 'genres' THEN
+            GENRE_DESCRIPTIONS := ARRAY(SELECT ROW(description, language) FROM media."genre_descriptions" WHERE genre_id = table_data.id);
+            DOC := jsonb_build_object('name', table_data.name, 'kinds', table_data.kinds, 'descriptions', jsonb_build_array(GENRE_DESCRIPTIONS));
+        WHEN 'members' THEN
+            DOC := jsonb_build_object('bio', table_data.bio, 'display_name', table_data.display_name, 'webfinger', table_data.webfinger);
+        WHEN 'media' THEN
+            DOC := jsonb_build_object('title', table_data.title, 'kind', table_data.kind, 
+            'created', table_data.created, 'added', ADDED, 'modified', MODIFIED,
+            -- the original, romanized and localized titles can be searched for too
+            'titles', ARRAY(SELECT t.title FROM media.titles t WHERE t.media_id = table_data.id));
+            -- games can also be found by their platforms, franchises and studios
+            IF table_data.kind = 'game' THEN
+                DOC := DOC || jsonb_build_object(
+                'platforms', ARRAY(SELECT p.name FROM media.game_platforms gp
+                    JOIN media.platforms p ON p.id = gp.platform WHERE gp.game = table_data.id),
+                'franchises', ARRAY(SELECT f.name FROM media.game_franchises gf
+                    JOIN media.franchises f ON f.id = gf.franchise WHERE gf.game = table_data.id),
+                'studios', ARRAY(SELECT DISTINCT s.name FROM media.game_studios gs
+                    JOIN people.studio s ON s.id_numeric = gs.studio WHERE gs.game = table_data.id));
+            ELSIF table_data.kind = 'anime' THEN
+                DOC := DOC || jsonb_build_object(
+                'studios', ARRAY(SELECT s.name FROM media.anime_studios ast
+                    JOIN people.studio s ON s.id_numeric = ast.studio WHERE ast.anime = table_data.id));
+            -- manga and comics by their writers, artists and the magazines they ran in
+            ELSIF table_data.kind IN ('manga', 'comic') THEN
+                DOC := DOC || jsonb_build_object(
+                'authors', ARRAY(SELECT p.first_name || ' ' || p.last_name FROM media.comic_creators cc
+                    JOIN people.person p ON p.id = cc.person WHERE cc.comic = table_data.id AND cc."role" = 'author'),
+                'artists', ARRAY(SELECT p.first_name || ' ' || p.last_name FROM media.comic_creators cc
+                    JOIN people.person p ON p.id = cc.person WHERE cc.comic = table_data.id AND cc."role" = 'artist'),
+                'serializations', ARRAY(SELECT m.name FROM media.comic_serializations cs
+                    JOIN media.magazines m ON m.id = cs.magazine WHERE cs.comic = table_data.id));
+            END IF;
+        WHEN 'person' THEN
+            FULL_ARTIST_NAME := CONCAT(table_data.first_name, ' ', table_data.last_name);
+            DOC := jsonb_build_object('name', FULL_ARTIST_NAME, 'nick_names', table_data.nick_names,
+             'bio', table_data.bio, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'group' THEN
+            DOC := jsonb_build_object('name', table_data.name, 'active', table_data.active, 
+            'bio', table_data.bio, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'studio' THEN
+            DOC := jsonb_build_object('name', table_data.name, 'kind', table_data.kind, 'city', table_data.city, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'genre_descriptions' THEN
+            GENRE_NAME := (SELECT name FROM media."genres" WHERE id = table_data.genre_id);
+            GENRE_KINDS := (SELECT kinds FROM media."genres" WHERE id = table_data.genre_id);
+            DOC := jsonb_build_object('name', GENRE_NAME, 'kinds', GENRE_KINDS,
+             'descriptions', jsonb_build_array('language', table_data.language, 'description', table_data.description));
+        WHEN 'ratings' THEN
+            REVIEWER_WF := (SELECT webfinger FROM public.members WHERE uuid = table_data.user_id);
+            REVIEW_MEDIA_TITLE := (SELECT title FROM media.media WHERE id = table_data.media_id);
+            DOC := jsonb_build_object('topic', NEW.topic, 'body', NEW.body, 'user', webfinger, 'media_title', media_title, 'added', NEW.added, 'modified', NEW.modified);
+    END CASE;
+    RETURN DOC;
+END;
+$function$
+;
+
@@ -0,0 +1,303 @@
+-- the weight of a rating in the weighted scores. Ratings of new accounts, of the ones which have
+-- rated little and of remote actors count less, see reviews.rating_weight
+ALTER TABLE reviews.ratings ADD COLUMN weight real NOT NULL DEFAULT 1 CHECK (weight > 0 AND weight <= 1);
+
+-- a local account counts fully once it's a month old and has rated 20 media
+CREATE OR REPLACE FUNCTION reviews.rating_weight(member uuid)
+ RETURNS real
+ LANGUAGE sql
+ STABLE
+AS $function$
+	SELECT COALESCE((
+		SELECT greatest(0.1,
+			least(1, extract(epoch FROM now() - m.reg_timestamp) / (30 * 86400))
+			* least(1, (SELECT count(*) FROM reviews.ratings r WHERE r.user_id = m.uuid) / 20.0))
+		FROM public.members m WHERE m.uuid = member), 0.5)::real
+$function$
+;
+
+-- the aggregated ratings of each media item. The sums and the histogram are updated incrementally
+-- by the triggers on reviews.ratings, the scores are derived from them by media.refresh_scores
+CREATE TABLE media.scores (
+	media_id uuid NOT NULL REFERENCES media.media(id) ON DELETE CASCADE,
+	rating_count int4 NOT NULL DEFAULT 0,
+	-- the ratings with a text body
+	review_count int4 NOT NULL DEFAULT 0,
+	stars_sum int8 NOT NULL DEFAULT 0,
+	stars_sq_sum int8 NOT NULL DEFAULT 0,
+	weight_sum float8 NOT NULL DEFAULT 0,
+	weighted_sum float8 NOT NULL DEFAULT 0,
+	-- the number of ratings rounded to each hundred of the reference scale, 0 to 1000
+	histogram int4[] NOT NULL DEFAULT array_fill(0, ARRAY[11]),
+	average float8 NULL,
+	-- the Bayesian average, pulled towards the average of the media of the same kind
+	weighted_score float8 NULL,
+	-- from 0, when everyone agrees, to 1, when half the ratings are 0 and half 1000
+	contentious float8 NOT NULL DEFAULT 0,
+	updated timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT scores_pkey PRIMARY KEY (media_id)
+);
+CREATE INDEX scores_weighted_score_idx ON media.scores (weighted_score DESC NULLS LAST);
+CREATE INDEX scores_contentious_idx ON media.scores (contentious DESC);
+
+-- the weighted sums of all the ratings of each kind of media, the priors of the Bayesian averages
+CREATE TABLE media.score_priors (
+	kind varchar(16) NOT NULL,
+	weight_sum float8 NOT NULL DEFAULT 0,
+	weighted_sum float8 NOT NULL DEFAULT 0,
+	CONSTRAINT score_priors_pkey PRIMARY KEY (kind)
+);
+
+-- adds (sign 1) or removes (sign -1) a rating from the sums of its media item
+CREATE OR REPLACE FUNCTION media.add_to_score(_media uuid, _stars int2, _weight real, _review boolean, _sign int)
+ RETURNS void
+ LANGUAGE plpgsql
+AS $function$
+DECLARE
+	_kind text;
+	_bucket int := round(_stars / 100.0)::int + 1;
+BEGIN
+	SELECT kind INTO _kind FROM media.media WHERE id = _media;
+	-- the media item is being deleted
+	IF _kind IS NULL THEN
+		RETURN;
+	END IF;
+	INSERT INTO media.scores (media_id) VALUES (_media) ON CONFLICT DO NOTHING;
+	UPDATE media.scores SET
+		rating_count = rating_count + _sign,
+		review_count = review_count + CASE WHEN _review THEN _sign ELSE 0 END,
+		stars_sum = stars_sum + _sign * _stars,
+		stars_sq_sum = stars_sq_sum + _sign * _stars::int8 * _stars,
+		weight_sum = weight_sum + _sign * _weight,
+		weighted_sum = weighted_sum + _sign * _weight * _stars,
+		histogram[_bucket] = histogram[_bucket] + _sign
+	WHERE media_id = _media;
+	INSERT INTO media.score_priors AS p (kind, weight_sum, weighted_sum)
+	VALUES (_kind, _sign * _weight, _sign * _weight * _stars)
+	ON CONFLICT (kind) DO UPDATE SET
+		weight_sum = p.weight_sum + EXCLUDED.weight_sum,
+		weighted_sum = p.weighted_sum + EXCLUDED.weighted_sum;
+END;
+$function$
+;
+
+-- derives the scores of the media items (all of them if _media is NULL) from their sums.
+-- Touching the media rows of the changed scores syncs their search documents
+CREATE OR REPLACE FUNCTION media.refresh_scores(_media uuid[], _touch boolean DEFAULT true)
+ RETURNS int
+ LANGUAGE plpgsql
+AS $function$
+DECLARE
+	-- how many ratings of the average media item the prior counts as
+	_prior_weight CONSTANT float8 := 10;
+	_changed int;
+BEGIN
+	WITH computed AS (
+		SELECT s.media_id,
+			s.stars_sum::float8 / NULLIF(s.rating_count, 0) AS average,
+			CASE WHEN s.rating_count > 0 THEN
+				(_prior_weight * COALESCE(p.weighted_sum / NULLIF(p.weight_sum, 0), 500) + s.weighted_sum)
+				/ (_prior_weight + s.weight_sum)
+			END AS weighted_score,
+			-- the variance relative to the largest possible one, damped for the media rated by few
+			CASE WHEN s.rating_count > 1 THEN
+				greatest(0, s.stars_sq_sum::float8 / s.rating_count - (s.stars_sum::float8 / s.rating_count) ^ 2)
+				/ 250000 * s.rating_count / (s.rating_count + _prior_weight)
+			ELSE 0 END AS contentious
+		FROM media.scores s
+		JOIN media.media m ON m.id = s.media_id
+		LEFT JOIN media.score_priors p ON p.kind = m.kind
+		WHERE _media IS NULL OR s.media_id = ANY(_media)
+	), changed AS (
+		UPDATE media.scores s SET
+			average = c.average,
+			weighted_score = c.weighted_score,
+			contentious = c.contentious,
+			updated = now()
+		FROM computed c
+		WHERE c.media_id = s.media_id
+			AND (s.average, s.weighted_score, s.contentious) IS DISTINCT FROM (c.average, c.weighted_score, c.contentious)
+		RETURNING s.media_id
+	)
+	UPDATE media.media SET modified = extract(epoch FROM now())::bigint
+	WHERE _touch AND id IN (SELECT media_id FROM changed);
+	GET DIAGNOSTICS _changed = ROW_COUNT;
+	RETURN _changed;
+END;
+$function$
+;
+
+CREATE OR REPLACE FUNCTION reviews.weigh_rating()
+ RETURNS trigger
+ LANGUAGE plpgsql
+AS $function$
+BEGIN
+	NEW.weight := reviews.rating_weight(NEW.user_id);
+	RETURN NEW;
+END;
+$function$
+;
+
+CREATE OR REPLACE FUNCTION reviews.score_rating()
+ RETURNS trigger
+ LANGUAGE plpgsql
+AS $function$
+BEGIN
+	IF TG_OP IN ('UPDATE', 'DELETE') THEN
+		PERFORM media.add_to_score(OLD.media_id, OLD.stars, OLD.weight, COALESCE(OLD.body, '') <> '', -1);
+	END IF;
+	IF TG_OP IN ('INSERT', 'UPDATE') THEN
+		PERFORM media.add_to_score(NEW.media_id, NEW.stars, NEW.weight, COALESCE(NEW.body, '') <> '', 1);
+	END IF;
+	IF TG_OP = 'UPDATE' AND OLD.media_id IS DISTINCT FROM NEW.media_id THEN
+		PERFORM media.refresh_scores(ARRAY[OLD.media_id, NEW.media_id]);
+	ELSE
+		PERFORM media.refresh_scores(ARRAY[COALESCE(NEW.media_id, OLD.media_id)]);
+	END IF;
+	RETURN NULL;
+END;
+$function$
+;
+
+CREATE TRIGGER ratings_weigh
+BEFORE INSERT ON reviews.ratings
+FOR EACH ROW
+EXECUTE FUNCTION reviews.weigh_rating();
+
+-- the weight is left out, since media.rebuild_scores recomputes the weights and all the scores at once
+CREATE TRIGGER ratings_score
+AFTER INSERT OR DELETE OR UPDATE OF stars, body, media_id ON reviews.ratings
+FOR EACH ROW
+EXECUTE FUNCTION reviews.score_rating();
+
+-- reweighs the ratings of the accounts which got older or more active, and recomputes all the sums
+-- from scratch, correcting the drift of the priors. It returns the number of media with changed scores
+CREATE OR REPLACE FUNCTION media.rebuild_scores(_touch boolean DEFAULT true)
+ RETURNS int
+ LANGUAGE plpgsql
+AS $function$
+BEGIN
+	UPDATE reviews.ratings SET weight = reviews.rating_weight(user_id)
+	WHERE user_id IS NOT NULL AND weight < 1;
+
+	DELETE FROM media.score_priors;
+	INSERT INTO media.score_priors (kind, weight_sum, weighted_sum)
+	SELECT m.kind, sum(r.weight), sum(r.weight * r.stars)
+	FROM reviews.ratings r
+	JOIN media.media m ON m.id = r.media_id
+	GROUP BY m.kind;
+
+	DELETE FROM media.scores s
+	WHERE NOT EXISTS (SELECT 1 FROM reviews.ratings r WHERE r.media_id = s.media_id);
+	INSERT INTO media.scores AS s
+		(media_id, rating_count, review_count, stars_sum, stars_sq_sum, weight_sum, weighted_sum, histogram)
+	SELECT r.media_id, count(*), count(*) FILTER (WHERE COALESCE(r.body, '') <> ''),
+		sum(r.stars), sum(r.stars::int8 * r.stars), sum(r.weight), sum(r.weight * r.stars),
+		ARRAY(SELECT count(h.id)::int4
+			FROM generate_series(0, 10) AS b
+			LEFT JOIN reviews.ratings h ON h.media_id = r.media_id AND round(h.stars / 100.0) = b
+			GROUP BY b ORDER BY b)
+	FROM reviews.ratings r
+	JOIN media.media m ON m.id = r.media_id
+	GROUP BY r.media_id
+	ON CONFLICT (media_id) DO UPDATE SET
+		rating_count = EXCLUDED.rating_count,
+		review_count = EXCLUDED.review_count,
+		stars_sum = EXCLUDED.stars_sum,
+		stars_sq_sum = EXCLUDED.stars_sq_sum,
+		weight_sum = EXCLUDED.weight_sum,
+		weighted_sum = EXCLUDED.weighted_sum,
+		histogram = EXCLUDED.histogram;
+
+	RETURN media.refresh_scores(NULL, _touch);
+END;
+$function$
+;
+
+-- the existing ratings are weighed by the accounts as they are now, without syncing every media item
+SELECT media.rebuild_scores(false);
+
+CREATE OR REPLACE FUNCTION public.json_serialize(target_table TEXT, table_data RECORD)
+ RETURNS jsonb
+ LANGUAGE plpgsql IMMUTABLE
+AS $function$
+DECLARE
+    DOC jsonb;
+    FULL_ARTIST_NAME TEXT;
+    REVIEWER_WF TEXT;
+    REVIEW_MEDIA_TITLE TEXT;
+    GENRE_DESCRIPTIONS public.genre_description[];
+    GENRE_NAME text;
+    GENRE_KINDS text[];
+    CITY TEXT;
+    ADDED timestamptz;
+    MODIFIED timestamptz;
+BEGIN
+    MODIFIED := CURRENT_TIMESTAMP AT TIME ZONE 'UTC';
+   IF NOT target_table = 'genres' OR target_table = 'members' THEN
+  ADDED := to_timestamp(table_data.added) AT TIME ZONE 'UTC';
+   END IF;
+   CASE target_table
+        WHEN 'genres' THEN
+            GENRE_DESCRIPTIONS := ARRAY(SELECT ROW(description, language) FROM media."genre_descriptions" WHERE genre_id = table_data.id);
+            DOC := jsonb_build_object('name', table_data.name, 'kinds', table_data.kinds, 'descriptions', jsonb_build_array(GENRE_DESCRIPTIONS));
+        WHEN 'members' THEN
+            DOC := jsonb_build_object('bio', table_data.bio, 'display_name', table_data.display_name, 'webfinger', table_data.webfinger);
+        WHEN 'media' THEN
+            DOC := jsonb_build_object('title', table_data.title, 'kind', table_data.kind, 
+            'created', table_data.created, 'added', ADDED, 'modified', MODIFIED,
+            -- the original, romanized and localized titles can be searched for too
+            'titles', ARRAY(SELECT t.title FROM media.titles t WHERE t.media_id = table_data.id));
+            -- the scores the search results can be sorted by
+            DOC := DOC || COALESCE((SELECT jsonb_build_object(
+                'rating_count', s.rating_count, 'review_count', s.review_count,
+                'average_rating', s.average, 'weighted_score', s.weighted_score, 'contentious', s.contentious)
+                FROM media.scores s WHERE s.media_id = table_data.id),
+                jsonb_build_object('rating_count', 0, 'review_count', 0, 'contentious', 0));
+            -- games can also be found by their platforms, franchises and studios
+            IF table_data.kind = 'game' THEN
+                DOC := DOC || jsonb_build_object(
+                'platforms', ARRAY(SELECT p.name FROM media.game_platforms gp
+                    JOIN media.platforms p ON p.id = gp.platform WHERE gp.game = table_data.id),
+                'franchises', ARRAY(SELECT f.name FROM media.game_franchises gf
+                    JOIN media.franchises f ON f.id = gf.franchise WHERE gf.game = table_data.id),
+                'studios', ARRAY(SELECT DISTINCT s.name FROM media.game_studios gs
+                    JOIN people.studio s ON s.id_numeric = gs.studio WHERE gs.game = table_data.id));
+            ELSIF table_data.kind = 'anime' THEN
+                DOC := DOC || jsonb_build_object(
+                'studios', ARRAY(SELECT s.name FROM media.anime_studios ast
+                    JOIN people.studio s ON s.id_numeric = ast.studio WHERE ast.anime = table_data.id));
+            -- manga and comics by their writers, artists and the magazines they ran in
+            ELSIF table_data.kind IN ('manga', 'comic') THEN
+                DOC := DOC || jsonb_build_object(
+                'authors', ARRAY(SELECT p.first_name || ' ' || p.last_name FROM media.comic_creators cc
+                    JOIN people.person p ON p.id = cc.person WHERE cc.comic = table_data.id AND cc."role" = 'author'),
+                'artists', ARRAY(SELECT p.first_name || ' ' || p.last_name FROM media.comic_creators cc
+                    JOIN people.person p ON p.id = cc.person WHERE cc.comic = table_data.id AND cc."role" = 'artist'),
+                'serializations', ARRAY(SELECT m.name FROM media.comic_serializations cs
+                    JOIN media.magazines m ON m.id = cs.magazine WHERE cs.comic = table_data.id));
+            END IF;
+        WHEN 'person' THEN
+            FULL_ARTIST_NAME := CONCAT(table_data.first_name, ' ', table_data.last_name);
+            DOC := jsonb_build_object('name', FULL_ARTIST_NAME, 'nick_names', table_data.nick_names,
+             'bio', table_data.bio, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'group' THEN
+            DOC := jsonb_build_object('name', table_data.name, 'active', table_data.active, 
+            'bio', table_data.bio, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'studio' THEN
+            DOC := jsonb_build_object('name', table_data.name, 'kind', table_data.kind, 'city', table_data.city, 'added', ADDED, 'modified', MODIFIED);
+        WHEN 'genre_descriptions' THEN
+            GENRE_NAME := (SELECT name FROM media."genres" WHERE id = table_data.genre_id);
+            GENRE_KINDS := (SELECT kinds FROM media."genres" WHERE id = table_data.genre_id);
+            DOC := jsonb_build_object('name', GENRE_NAME, 'kinds', GENRE_KINDS,
+             'descriptions', jsonb_build_array('language', table_data.language, 'description', table_data.description));
+        WHEN 'ratings' THEN
+            REVIEWER_WF := (SELECT webfinger FROM public.members WHERE uuid = table_data.user_id);
+            REVIEW_MEDIA_TITLE := (SELECT title FROM media.media WHERE id = table_data.media_id);
+            DOC := jsonb_build_object('topic', NEW.topic, 'body', NEW.body, 'user', webfinger, 'media_title', media_title, 'added', NEW.added, 'modified', NEW.modified);
+    END CASE;
+    RETURN DOC;
+END;
+$function$
+;
+
@@ -0,0 +1,4 @@
+DROP MATERIALIZED VIEW IF EXISTS media.chart_entries;
+DROP VIEW IF EXISTS media.media_countries;
+DROP VIEW IF EXISTS media.media_genres;
+ALTER TABLE people.person DROP COLUMN IF EXISTS hometown;
@@ -0,0 +1,102 @@
+-- where the people come from, the charts tell the artists' countries by it
+ALTER TABLE people.person ADD COLUMN hometown uuid NULL REFERENCES places.place(uuid) ON DELETE SET NULL;
+
+-- the genres of the media of all the kinds which have them
+CREATE OR REPLACE VIEW media.media_genres AS
+	SELECT album AS media_id, genre FROM media.album_genres
+	UNION ALL
+	SELECT book, genre FROM media.book_genres
+	UNION ALL
+	SELECT game, genre FROM media.game_genres
+	UNION ALL
+	SELECT anime, genre FROM media.anime_genres
+	UNION ALL
+	SELECT comic, genre FROM media.comic_genres;
+
+-- the countries the media come from: the hometowns of the artists and authors, the locations of the bands,
+-- the cities of the game developers and anime studios, and the production countries of films and TV shows
+CREATE OR REPLACE VIEW media.media_countries AS
+	SELECT aa.album AS media_id, pl.country
+	FROM media.album_artists aa
+	JOIN people.person p ON p.id = aa.artist
+	JOIN places.place pl ON pl.uuid = p.hometown
+	WHERE aa.artist_type = 'individual'
+	UNION ALL
+	SELECT aa.album, pl.country
+	FROM media.album_artists aa
+	JOIN people.group_locations gl ON gl.group_id = aa.artist
+	JOIN places.place pl ON pl.uuid = gl.location_id
+	WHERE aa.artist_type = 'group'
+	UNION ALL
+	SELECT ba.book, pl.country
+	FROM media.book_authors ba
+	JOIN people.person p ON p.id = ba.person
+	JOIN places.place pl ON pl.uuid = p.hometown
+	UNION ALL
+	SELECT cc.comic, pl.country
+	FROM media.comic_creators cc
+	JOIN people.person p ON p.id = cc.person
+	JOIN places.place pl ON pl.uuid = p.hometown
+	UNION ALL
+	SELECT gs.game, c.country
+	FROM media.game_studios gs
+	JOIN people.studio s ON s.id_numeric = gs.studio
+	JOIN places.city c ON c.uuid = s.city
+	WHERE gs."role" = 'developer'
+	UNION ALL
+	SELECT ast.anime, c.country
+	FROM media.anime_studios ast
+	JOIN people.studio s ON s.id_numeric = ast.studio
+	JOIN places.city c ON c.uuid = s.city
+	UNION ALL
+	SELECT film, country FROM media.film_countries
+	UNION ALL
+	SELECT tv_show, country FROM media.tv_show_countries;
+
+-- the rated media, precomputed for the charts and refreshed periodically, see RatingStorage.RefreshCharts.
+-- The genres include all the ancestors of the media genres, so that a chart of a genre includes its subgenres
+CREATE MATERIALIZED VIEW media.chart_entries AS
+WITH RECURSIVE lineage (genre, ancestor) AS (
+	SELECT id, id FROM media.genres
+	UNION
+	SELECT l.genre, g.parent
+	FROM lineage l
+	JOIN media.genres g ON g.id = l.ancestor
+	WHERE g.parent IS NOT NULL
+), entries AS (
+	SELECT m.id, m.kind, m.title, m.created, s.rating_count, s.average, s.weighted_score, te.air_date,
+		-- tracks, seasons and episodes are charted by the genres and countries of what they're a part of
+		COALESCE(t.album, ts.tv_show, te.tv_show, m.id) AS origin
+	FROM media.media m
+	JOIN media.scores s ON s.media_id = m.id
+	LEFT JOIN media.tracks t ON t.media_id = m.id
+	LEFT JOIN media.tv_show_seasons ts ON ts.media_id = m.id
+	LEFT JOIN media.tv_show_episodes te ON te.media_id = m.id
+	WHERE m.status = 'approved' AND s.rating_count > 0
+)
+SELECT e.id AS media_id, e.kind, e.title,
+	-- the media without a release date of their own were released when they were created
+	extract(year FROM COALESCE(e.air_date, al.release_date, f.release_date, make_date(tv."year"::int, 1, 1),
+		gr.released, e.created))::int2 AS "year",
+	ARRAY(SELECT DISTINCT l.ancestor
+		FROM media.media_genres mg
+		JOIN lineage l ON l.genre = mg.genre
+		WHERE mg.media_id = e.origin)::int2[] AS genres,
+	ARRAY(SELECT DISTINCT mc.country
+		FROM media.media_countries mc
+		WHERE mc.media_id = e.origin AND mc.country IS NOT NULL)::int2[] AS countries,
+	e.rating_count, e.average, e.weighted_score
+FROM entries e
+LEFT JOIN media.albums al ON al.media_id = e.origin
+LEFT JOIN media.films f ON f.media_id = e.origin
+LEFT JOIN media.tv_shows tv ON tv.media_id = e.origin
+LEFT JOIN LATERAL (
+	SELECT min(r.release_date) AS released FROM media.game_releases r WHERE r.game = e.origin
+) gr ON true;
+
+-- the unique index lets the view be refreshed concurrently, without blocking the charts
+CREATE UNIQUE INDEX chart_entries_media_id_idx ON media.chart_entries (media_id);
+CREATE INDEX chart_entries_kind_year_idx ON media.chart_entries (kind, "year", weighted_score DESC NULLS LAST);
+CREATE INDEX chart_entries_weighted_score_idx ON media.chart_entries (weighted_score DESC NULLS LAST);
+CREATE INDEX chart_entries_genres_idx ON media.chart_entries USING gin (genres);
+CREATE INDEX chart_entries_countries_idx ON media.chart_entries USING gin (countries);
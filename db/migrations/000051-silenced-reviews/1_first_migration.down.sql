@@ -0,0 +1,74 @@
+CREATE OR REPLACE TRIGGER zcouchdb_sync_reviews_basic
+AFTER INSERT OR UPDATE OF
+topic, body, user_id, media_id, added, modified
+ON reviews.ratings
+FOR EACH ROW
+  EXECUTE PROCEDURE couchdb_put();
+
+CREATE OR REPLACE FUNCTION reviews.score_rating()
+ RETURNS trigger
+ LANGUAGE plpgsql
+AS $function$
+BEGIN
+	IF TG_OP IN ('UPDATE', 'DELETE') THEN
+		PERFORM media.add_to_score(OLD.media_id, OLD.stars, OLD.weight, COALESCE(OLD.body, '') <> '', -1);
+	END IF;
+	IF TG_OP IN ('INSERT', 'UPDATE') THEN
+		PERFORM media.add_to_score(NEW.media_id, NEW.stars, NEW.weight, COALESCE(NEW.body, '') <> '', 1);
+	END IF;
+	IF TG_OP = 'UPDATE' AND OLD.media_id IS DISTINCT FROM NEW.media_id THEN
+		PERFORM media.refresh_scores(ARRAY[OLD.media_id, NEW.media_id]);
+	ELSE
+		PERFORM media.refresh_scores(ARRAY[COALESCE(NEW.media_id, OLD.media_id)]);
+	END IF;
+	RETURN NULL;
+END;
+$function$
+;
+
+CREATE OR REPLACE FUNCTION media.rebuild_scores(_touch boolean DEFAULT true)
+ RETURNS int
+ LANGUAGE plpgsql
+AS $function$
+BEGIN
+	UPDATE reviews.ratings SET weight = reviews.rating_weight(user_id)
+	WHERE user_id IS NOT NULL AND weight < 1;
+
+	DELETE FROM media.score_priors;
+	INSERT INTO media.score_priors (kind, weight_sum, weighted_sum)
+	SELECT m.kind, sum(r.weight), sum(r.weight * r.stars)
+	FROM reviews.ratings r
+	JOIN media.media m ON m.id = r.media_id
+	GROUP BY m.kind;
+
+	DELETE FROM media.scores s
+	WHERE NOT EXISTS (SELECT 1 FROM reviews.ratings r WHERE r.media_id = s.media_id);
+	INSERT INTO media.scores AS s
+		(media_id, rating_count, review_count, stars_sum, stars_sq_sum, weight_sum, weighted_sum, histogram)
+	SELECT r.media_id, count(*), count(*) FILTER (WHERE COALESCE(r.body, '') <> ''),
+		sum(r.stars), sum(r.stars::int8 * r.stars), sum(r.weight), sum(r.weight * r.stars),
+		ARRAY(SELECT count(h.id)::int4
+			FROM generate_series(0, 10) AS b
+			LEFT JOIN reviews.ratings h ON h.media_id = r.media_id AND round(h.stars / 100.0) = b
+			GROUP BY b ORDER BY b)
+	FROM reviews.ratings r
+	JOIN media.media m ON m.id = r.media_id
+	GROUP BY r.media_id
+	ON CONFLICT (media_id) DO UPDATE SET
+		rating_count = EXCLUDED.rating_count,
+		review_count = EXCLUDED.review_count,
+		stars_sum = EXCLUDED.stars_sum,
+		stars_sq_sum = EXCLUDED.stars_sq_sum,
+		weight_sum = EXCLUDED.weight_sum,
+		weighted_sum = EXCLUDED.weighted_sum,
+		histogram = EXCLUDED.histogram;
+
+	RETURN media.refresh_scores(NULL, _touch);
+END;
+$function$
+;
+
+DROP VIEW IF EXISTS reviews.public_ratings;
+DROP FUNCTION IF EXISTS reviews.is_public(text);
+
+SELECT media.rebuild_scores(false);
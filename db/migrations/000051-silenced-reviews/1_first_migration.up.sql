@@ -0,0 +1,98 @@
+-- whether a review can be shown publicly and counted in the scores, i.e. whether it was written locally
+-- or received from a domain which isn't silenced. The most specific policy of the domain and its parents applies
+CREATE OR REPLACE FUNCTION reviews.is_public(_remote_actor text)
+ RETURNS boolean
+ LANGUAGE sql
+ STABLE
+AS $function$
+	SELECT _remote_actor IS NULL OR COALESCE((
+		SELECT p.severity = 'allow'
+		FROM federation.domain_policies p,
+			substring(_remote_actor from '^[a-z]+://([^/:]+)') AS host
+		WHERE host = p.domain OR host LIKE '%.' || p.domain
+		ORDER BY length(p.domain) DESC
+		LIMIT 1), true)
+$function$
+;
+
+-- the reviews every public listing and aggregate is read from
+CREATE OR REPLACE VIEW reviews.public_ratings AS
+	SELECT r.* FROM reviews.ratings r
+	WHERE reviews.is_public(r.remote_actor);
+
+-- silenced reviews aren't synced to the search
+CREATE OR REPLACE TRIGGER zcouchdb_sync_reviews_basic
+AFTER INSERT OR UPDATE OF
+topic, body, user_id, media_id, added, modified
+ON reviews.ratings
+FOR EACH ROW
+WHEN (reviews.is_public(NEW.remote_actor))
+  EXECUTE PROCEDURE couchdb_put();
+
+-- silenced reviews don't count in the scores, and thus neither in the charts derived from them.
+-- Since the scores are only updated incrementally, they are rebuilt whenever a domain policy changes
+CREATE OR REPLACE FUNCTION reviews.score_rating()
+ RETURNS trigger
+ LANGUAGE plpgsql
+AS $function$
+BEGIN
+	IF TG_OP IN ('UPDATE', 'DELETE') AND reviews.is_public(OLD.remote_actor) THEN
+		PERFORM media.add_to_score(OLD.media_id, OLD.stars, OLD.weight, COALESCE(OLD.body, '') <> '', -1);
+	END IF;
+	IF TG_OP IN ('INSERT', 'UPDATE') AND reviews.is_public(NEW.remote_actor) THEN
+		PERFORM media.add_to_score(NEW.media_id, NEW.stars, NEW.weight, COALESCE(NEW.body, '') <> '', 1);
+	END IF;
+	IF TG_OP = 'UPDATE' AND OLD.media_id IS DISTINCT FROM NEW.media_id THEN
+		PERFORM media.refresh_scores(ARRAY[OLD.media_id, NEW.media_id]);
+	ELSE
+		PERFORM media.refresh_scores(ARRAY[COALESCE(NEW.media_id, OLD.media_id)]);
+	END IF;
+	RETURN NULL;
+END;
+$function$
+;
+
+CREATE OR REPLACE FUNCTION media.rebuild_scores(_touch boolean DEFAULT true)
+ RETURNS int
+ LANGUAGE plpgsql
+AS $function$
+BEGIN
+	UPDATE reviews.ratings SET weight = reviews.rating_weight(user_id)
+	WHERE user_id IS NOT NULL AND weight < 1;
+
+	DELETE FROM media.score_priors;
+	INSERT INTO media.score_priors (kind, weight_sum, weighted_sum)
+	SELECT m.kind, sum(r.weight), sum(r.weight * r.stars)
+	FROM reviews.public_ratings r
+	JOIN media.media m ON m.id = r.media_id
+	GROUP BY m.kind;
+
+	DELETE FROM media.scores s
+	WHERE NOT EXISTS (SELECT 1 FROM reviews.public_ratings r WHERE r.media_id = s.media_id);
+	INSERT INTO media.scores AS s
+		(media_id, rating_count, review_count, stars_sum, stars_sq_sum, weight_sum, weighted_sum, histogram)
+	SELECT r.media_id, count(*), count(*) FILTER (WHERE COALESCE(r.body, '') <> ''),
+		sum(r.stars), sum(r.stars::int8 * r.stars), sum(r.weight), sum(r.weight * r.stars),
+		ARRAY(SELECT count(h.id)::int4
+			FROM generate_series(0, 10) AS b
+			LEFT JOIN reviews.public_ratings h ON h.media_id = r.media_id AND round(h.stars / 100.0) = b
+			GROUP BY b ORDER BY b)
+	FROM reviews.public_ratings r
+	JOIN media.media m ON m.id = r.media_id
+	GROUP BY r.media_id
+	ON CONFLICT (media_id) DO UPDATE SET
+		rating_count = EXCLUDED.rating_count,
+		review_count = EXCLUDED.review_count,
+		stars_sum = EXCLUDED.stars_sum,
+		stars_sq_sum = EXCLUDED.stars_sq_sum,
+		weight_sum = EXCLUDED.weight_sum,
+		weighted_sum = EXCLUDED.weighted_sum,
+		histogram = EXCLUDED.histogram;
+
+	RETURN media.refresh_scores(NULL, _touch);
+END;
+$function$
+;
+
+-- leave out the reviews of the domains silenced so far
+SELECT media.rebuild_scores(false);
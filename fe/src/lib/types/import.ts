@@ -0,0 +1,31 @@
+import type { UUID } from './utils';
+
+export type ImportJobStatus = 'fetching' | 'preview' | 'committing' | 'done' | 'failed' | 'cancelled';
+
+export interface PreviewEntry {
+  name: string;
+  status: 'new' | 'matched' | 'skipped';
+  id?: string;
+  album?: string;
+}
+
+export interface ImportPreview {
+  artists: PreviewEntry[];
+  studios?: PreviewEntry[];
+  genres: PreviewEntry[];
+  media?: PreviewEntry[];
+  tracks?: PreviewEntry[];
+  placeholders?: number;
+}
+
+export interface ImportJob {
+  id: UUID;
+  source: string;
+  uri?: string;
+  status: ImportJobStatus;
+  preview?: ImportPreview;
+  result?: any;
+  error?: string;
+  started: Date | string;
+  finished?: Date | string;
+}
@@ -0,0 +1,57 @@
+package audiotags
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	flacStreamInfo    = 0
+	flacVorbisComment = 4
+)
+
+// readFLAC reads the stream info, for the length, and the vorbis comments, starting at the
+// current position. Other metadata blocks, like the embedded pictures, are skipped
+func readFLAC(r io.ReadSeeker) (*Tags, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil || string(magic[:]) != "fLaC" {
+		return nil, fmt.Errorf("%w: not a FLAC stream", ErrUnsupported)
+	}
+	tags := &Tags{Format: "flac"}
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, fmt.Errorf("error reading FLAC metadata block: %w", err)
+		}
+		last, kind := header[0]&0x80 != 0, header[0]&0x7F
+		size := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+
+		switch kind {
+		case flacStreamInfo, flacVorbisComment:
+			block := make([]byte, size)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return nil, fmt.Errorf("error reading FLAC metadata block: %w", err)
+			}
+			if kind == flacVorbisComment {
+				if err := readVorbisComments(block, tags); err != nil {
+					return nil, err
+				}
+			} else if len(block) >= 18 {
+				// 20 bits of sample rate, 3 of channels, 5 of bits per sample and 36 of total samples
+				sampleRate := uint64(block[10])<<12 | uint64(block[11])<<4 | uint64(block[12])>>4
+				samples := binary.BigEndian.Uint64(block[10:18]) & (1<<36 - 1)
+				if sampleRate > 0 {
+					tags.Length = float64(samples) / float64(sampleRate)
+				}
+			}
+		default:
+			if _, err := r.Seek(size, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+		if last {
+			return tags, nil
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package audiotags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// ID3v2 tags can hold pictures, but anything larger is most likely a broken file
+	id3MaxSize = 16 << 20
+	// ID3v1 tags are the last 128 bytes of the file
+	id3v1Size = 128
+	// the owner of the UFID frame holding the recording MBID
+	musicBrainzUFID = "http://musicbrainz.org"
+)
+
+// the text frames mapped onto their vorbis comment names. ID3v2.2 uses 3-character IDs
+var id3Frames = map[string]string{
+	"TIT2": "TITLE", "TT2": "TITLE",
+	"TPE1": "ARTIST", "TP1": "ARTIST",
+	"TPE2": "ALBUMARTIST", "TP2": "ALBUMARTIST",
+	"TALB": "ALBUM", "TAL": "ALBUM",
+	"TRCK": "TRACKNUMBER", "TRK": "TRACKNUMBER",
+	"TPOS": "DISCNUMBER", "TPA": "DISCNUMBER",
+	"TYER": "YEAR", "TYE": "YEAR",
+	"TDRC": "DATE", "TDRL": "DATE", "TDOR": "ORIGINALDATE",
+}
+
+// id3v1Genres are the genres of ID3v1, including the Winamp extensions, which ID3v2 can
+// still refer to by number
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop", "Jazz", "Metal",
+	"New Age", "Oldies", "Other", "Pop", "R&B", "Rap", "Reggae", "Rock", "Techno", "Industrial",
+	"Alternative", "Ska", "Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal", "Jazz+Funk",
+	"Fusion", "Trance", "Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"Alternative Rock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic",
+	"Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream", "Southern Rock", "Comedy", "Cult", "Gangsta",
+	"Top 40", "Christian Rap", "Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave", "Psychedelic", "Rave", "Showtunes",
+	"Trailer", "Lo-Fi", "Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock",
+	"Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion", "Bebop", "Latin", "Revival", "Celtic", "Bluegrass",
+	"Avantgarde", "Gothic Rock", "Progressive Rock", "Psychedelic Rock", "Symphonic Rock", "Slow Rock", "Big Band", "Chorus", "Easy Listening", "Acoustic",
+	"Humour", "Speech", "Chanson", "Opera", "Chamber Music", "Sonata", "Symphony", "Booty Bass", "Primus", "Porn Groove",
+	"Satire", "Slow Jam", "Club", "Tango", "Samba", "Folklore", "Ballad", "Power Ballad", "Rhythmic Soul", "Freestyle",
+	"Duet", "Punk Rock", "Drum Solo", "A capella", "Euro-House", "Dance Hall",
+}
+
+// readID3v2 reads the ID3v2.2, 2.3 or 2.4 tag at the start of the file. Compressed and
+// encrypted frames are skipped
+func readID3v2(r io.ReadSeeker) (*Tags, error) {
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("error reading ID3 header: %w", err)
+	}
+	major, flags := header[3], header[5]
+	if major < 2 || major > 4 {
+		return nil, fmt.Errorf("%w: ID3v2.%d", ErrUnsupported, major)
+	}
+	size := syncsafe(header[6:10])
+	if size > id3MaxSize {
+		return nil, fmt.Errorf("the ID3 tag of %d bytes is too large", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("error reading ID3 tag: %w", err)
+	}
+	// FLAC files are sometimes tagged with ID3 too, but their own comments are more reliable
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err == nil && string(magic[:]) == "fLaC" {
+		if _, err = r.Seek(int64(len(header)+size), io.SeekStart); err != nil {
+			return nil, err
+		}
+		return readFLAC(r)
+	}
+
+	if flags&0x80 != 0 && major < 4 {
+		data = unsynchronise(data)
+	}
+	if flags&0x40 != 0 && major > 2 && len(data) >= 4 {
+		extended := int(binary.BigEndian.Uint32(data[:4])) + 4
+		if major == 4 {
+			extended = syncsafe(data[:4])
+		}
+		if extended > len(data) {
+			return nil, errors.New("invalid ID3 extended header")
+		}
+		data = data[extended:]
+	}
+
+	tags := &Tags{Format: "id3v2." + strconv.Itoa(int(major))}
+	headerSize := 10
+	if major == 2 {
+		headerSize = 6
+	}
+	for len(data) >= headerSize && data[0] != 0 {
+		var (
+			id         string
+			frameSize  int
+			frameFlags byte
+		)
+		switch major {
+		case 2:
+			id, frameSize = string(data[:3]), int(data[3])<<16|int(data[4])<<8|int(data[5])
+		case 3:
+			id, frameSize, frameFlags = string(data[:4]), int(binary.BigEndian.Uint32(data[4:8])), data[9]
+			// compression and encryption
+			if frameFlags&0xC0 != 0 {
+				frameFlags = 0xFF
+			}
+		default:
+			id, frameSize, frameFlags = string(data[:4]), syncsafe(data[4:8]), data[9]
+			if frameFlags&0x0C != 0 {
+				frameFlags = 0xFF
+			}
+		}
+		if frameSize < 0 || frameSize > len(data)-headerSize {
+			break
+		}
+		body := data[headerSize : headerSize+frameSize]
+		data = data[headerSize+frameSize:]
+		if frameFlags == 0xFF {
+			continue
+		}
+		if major == 4 {
+			if frameFlags&0x02 != 0 {
+				body = unsynchronise(body)
+			}
+			// data length indicator
+			if frameFlags&0x01 != 0 && len(body) >= 4 {
+				body = body[4:]
+			}
+		}
+		tags.frame(id, body)
+	}
+	return tags, nil
+}
+
+func (t *Tags) frame(id string, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	if name, ok := id3Frames[id]; ok {
+		for _, value := range decodeText(body[0], body[1:]) {
+			t.set(name, value)
+		}
+		return
+	}
+	switch id {
+	case "TCON", "TCO":
+		for _, value := range decodeText(body[0], body[1:]) {
+			if genre := id3Genre(value); genre != "" {
+				t.Genres = append(t.Genres, genre)
+			}
+		}
+	case "TLEN", "TLE":
+		if values := decodeText(body[0], body[1:]); len(values) > 0 {
+			if ms, err := strconv.ParseFloat(strings.TrimSpace(values[0]), 64); err == nil {
+				t.Length = ms / 1000
+			}
+		}
+	case "USLT", "ULT":
+		// encoding, language, description and the lyrics
+		if len(body) > 4 {
+			if values := decodeText(body[0], body[4:]); len(values) > 1 {
+				t.set("LYRICS", values[1])
+			}
+		}
+	case "TXXX", "TXX":
+		if values := decodeText(body[0], body[1:]); len(values) > 1 {
+			t.set(values[0], values[1])
+		}
+	case "UFID", "UFI":
+		if owner, id, ok := bytes.Cut(body, []byte{0}); ok && string(owner) == musicBrainzUFID {
+			t.RecordingMBID = string(id)
+		}
+	}
+}
+
+// readID3v1 reads the fixed-size tag at the end of the file, including the track number of ID3v1.1
+func readID3v1(r io.ReadSeeker) (*Tags, error) {
+	if _, err := r.Seek(-id3v1Size, io.SeekEnd); err != nil {
+		return nil, err
+	}
+	var tag [id3v1Size]byte
+	if _, err := io.ReadFull(r, tag[:]); err != nil {
+		return nil, err
+	}
+	if string(tag[:3]) != "TAG" {
+		return nil, errors.New("no ID3v1 tag found")
+	}
+	field := func(b []byte) string {
+		b, _, _ = bytes.Cut(b, []byte{0})
+		return strings.TrimSpace(latin1(b))
+	}
+	tags := &Tags{
+		Title:  field(tag[3:33]),
+		Artist: field(tag[33:63]),
+		Album:  field(tag[63:93]),
+		Date:   field(tag[93:97]),
+		Format: "id3v1",
+	}
+	if tag[125] == 0 && tag[126] != 0 {
+		tags.Track = int(tag[126])
+	}
+	if int(tag[127]) < len(id3v1Genres) {
+		tags.Genres = []string{id3v1Genres[tag[127]]}
+	}
+	return tags, nil
+}
+
+// id3Genre resolves genres referring to ID3v1 by number, e.g. "(17)", "17" or "(17)Rock"
+func id3Genre(value string) string {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "(") {
+		if number, refinement, ok := strings.Cut(value[1:], ")"); ok {
+			if refinement != "" {
+				return refinement
+			}
+			value = number
+		}
+	}
+	if n, err := strconv.Atoi(value); err == nil {
+		if n >= 0 && n < len(id3v1Genres) {
+			return id3v1Genres[n]
+		}
+		return ""
+	}
+	return value
+}
+
+// decodeText decodes the null-separated values of a text frame
+func decodeText(encoding byte, b []byte) (values []string) {
+	switch encoding {
+	case 1, 2:
+		// UTF-16, with a byte order mark, or big-endian without one
+		bigEndian := encoding == 2
+		var units []uint16
+		flush := func() {
+			values = append(values, string(utf16.Decode(units)))
+			units = units[:0]
+		}
+		for i := 0; i+1 < len(b); i += 2 {
+			switch {
+			case b[i] == 0xFF && b[i+1] == 0xFE:
+				bigEndian = false
+			case b[i] == 0xFE && b[i+1] == 0xFF:
+				bigEndian = true
+			case b[i] == 0 && b[i+1] == 0:
+				flush()
+			case bigEndian:
+				units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+			default:
+				units = append(units, uint16(b[i+1])<<8|uint16(b[i]))
+			}
+		}
+		if len(units) > 0 {
+			flush()
+		}
+	default:
+		for _, value := range bytes.Split(bytes.TrimRight(b, "\x00"), []byte{0}) {
+			if encoding == 0 {
+				values = append(values, latin1(value))
+			} else {
+				values = append(values, string(value))
+			}
+		}
+	}
+	return values
+}
+
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i := range b {
+		runes[i] = rune(b[i])
+	}
+	return string(runes)
+}
+
+// syncsafe decodes the 28-bit integers of ID3v2, which use 7 bits of each byte
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7F)<<21 | int(b[1]&0x7F)<<14 | int(b[2]&0x7F)<<7 | int(b[3]&0x7F)
+}
+
+// unsynchronise removes the zero bytes inserted after 0xFF to avoid false MPEG sync signals
+func unsynchronise(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xFF, 0x00}, []byte{0xFF})
+}
@@ -0,0 +1,126 @@
+package audiotags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	oggPageHeaderSize = 27
+	// the comment header usually starts on the second page, but embedded cover art can make it span many
+	oggMaxHeaderSize = 16 << 20
+	// the last page, holding the length of the stream, is looked for within the end of the file
+	oggTailSize = 64 << 10
+	// Opus always uses the 48 kHz clock for granule positions
+	opusSampleRate = 48000
+)
+
+// readOgg reads the comment header of the first logical stream, which can be Vorbis or Opus.
+// The length is calculated from the granule position of the last page
+func readOgg(r io.ReadSeeker) (*Tags, error) {
+	var (
+		serial  uint32
+		packets [][]byte
+		packet  []byte
+		read    int
+	)
+	for first := true; len(packets) < 2; first = false {
+		var header [oggPageHeaderSize]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, fmt.Errorf("error reading Ogg page: %w", err)
+		}
+		if string(header[:4]) != "OggS" {
+			return nil, fmt.Errorf("%w: invalid Ogg page", ErrUnsupported)
+		}
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(r, segments); err != nil {
+			return nil, fmt.Errorf("error reading Ogg page: %w", err)
+		}
+		pageSerial := binary.LittleEndian.Uint32(header[14:18])
+		if first {
+			serial = pageSerial
+		}
+		for _, size := range segments {
+			if pageSerial != serial {
+				// pages of other multiplexed streams
+				if _, err := r.Seek(int64(size), io.SeekCurrent); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if read += int(size); read > oggMaxHeaderSize {
+				return nil, fmt.Errorf("the Ogg headers are larger than %d bytes", oggMaxHeaderSize)
+			}
+			segment := make([]byte, size)
+			if _, err := io.ReadFull(r, segment); err != nil {
+				return nil, fmt.Errorf("error reading Ogg page: %w", err)
+			}
+			packet = append(packet, segment...)
+			// a segment shorter than 255 bytes ends the packet
+			if size < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+	}
+
+	var (
+		id, comments = packets[0], packets[1]
+		tags         = &Tags{}
+		sampleRate   uint64
+		preSkip      uint64
+	)
+	switch {
+	case bytes.HasPrefix(id, []byte("\x01vorbis")) && len(id) >= 16 && bytes.HasPrefix(comments, []byte("\x03vorbis")):
+		tags.Format = "vorbis"
+		sampleRate = uint64(binary.LittleEndian.Uint32(id[12:16]))
+		comments = comments[7:]
+	case bytes.HasPrefix(id, []byte("OpusHead")) && len(id) >= 12 && bytes.HasPrefix(comments, []byte("OpusTags")):
+		tags.Format = "opus"
+		sampleRate = opusSampleRate
+		preSkip = uint64(binary.LittleEndian.Uint16(id[10:12]))
+		comments = comments[8:]
+	default:
+		return nil, fmt.Errorf("%w: Ogg streams other than Vorbis and Opus", ErrUnsupported)
+	}
+	if err := readVorbisComments(comments, tags); err != nil {
+		return nil, err
+	}
+
+	granule, err := lastGranule(r, serial)
+	if err != nil {
+		return nil, err
+	}
+	if sampleRate > 0 && granule > preSkip {
+		tags.Length = float64(granule-preSkip) / float64(sampleRate)
+	}
+	return tags, nil
+}
+
+// lastGranule finds the granule position, i.e. the number of samples, of the last page of the stream
+func lastGranule(r io.ReadSeeker, serial uint32) (uint64, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	start := max(end-oggTailSize, 0)
+	if _, err = r.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	tail := make([]byte, end-start)
+	if _, err = io.ReadFull(r, tail); err != nil {
+		return 0, fmt.Errorf("error reading the last Ogg page: %w", err)
+	}
+	for i := bytes.LastIndex(tail, []byte("OggS")); i >= 0; i = bytes.LastIndex(tail[:i], []byte("OggS")) {
+		if i+oggPageHeaderSize <= len(tail) && binary.LittleEndian.Uint32(tail[i+14:i+18]) == serial {
+			granule := binary.LittleEndian.Uint64(tail[i+6 : i+14])
+			// -1 marks pages on which no packet ends
+			if granule != ^uint64(0) {
+				return granule, nil
+			}
+		}
+	}
+	return 0, nil
+}
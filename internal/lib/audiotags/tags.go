@@ -0,0 +1,174 @@
+// Package audiotags reads the metadata of MP3 (ID3v2 and ID3v1), FLAC and Ogg Vorbis/Opus files.
+// Only the tags needed to catalog a release are read, the audio itself is never decoded
+package audiotags
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupported is returned for files which are neither MP3, FLAC nor Ogg
+var ErrUnsupported = errors.New("unsupported audio format")
+
+// Tags are the common subset of the metadata of the supported formats. They're also the
+// format of the tag dumps made by clients which read the files themselves
+type Tags struct {
+	Title       string `json:"title" example:"Teardrop"`
+	Artist      string `json:"artist" example:"Massive Attack"`
+	AlbumArtist string `json:"album_artist,omitempty" example:"Massive Attack"`
+	Album       string `json:"album" example:"Mezzanine"`
+	// ID3v1 genre numbers are resolved to their names
+	Genres     []string `json:"genres,omitempty" example:"Trip Hop"`
+	Track      int      `json:"track,omitempty" example:"3"`
+	TrackTotal int      `json:"track_total,omitempty" example:"11"`
+	Disc       int      `json:"disc,omitempty" example:"1"`
+	// YYYY, YYYY-MM or YYYY-MM-DD
+	Date string `json:"date,omitempty" example:"1998-04-20"`
+	// in seconds
+	Length float64 `json:"length,omitempty" example:"330.5"`
+	Lyrics string  `json:"lyrics,omitempty"`
+	// MusicBrainz release and recording IDs, as written by Picard
+	AlbumMBID     string `json:"musicbrainz_album_id,omitempty"`
+	RecordingMBID string `json:"musicbrainz_track_id,omitempty"`
+	// the format the tags were read from, e.g. id3v2.4 or flac
+	Format string `json:"format,omitempty" example:"flac"`
+}
+
+// Read detects the format of the file and reads its tags
+func Read(r io.ReadSeeker) (*Tags, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, fmt.Errorf("error reading the file header: %w", err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic[:], []byte("ID3")):
+		return readID3v2(r)
+	case bytes.Equal(magic[:], []byte("fLaC")):
+		return readFLAC(r)
+	case bytes.Equal(magic[:], []byte("OggS")):
+		return readOgg(r)
+	default:
+		// MP3 files can have only the old tag at the end, or none at all
+		tags, err := readID3v1(r)
+		if err != nil {
+			return nil, ErrUnsupported
+		}
+		return tags, nil
+	}
+}
+
+// Duration returns the length of the track
+func (t *Tags) Duration() time.Duration {
+	return time.Duration(t.Length * float64(time.Second)).Round(time.Second)
+}
+
+// ReleaseDate parses the date tag, which is often only a year. The zero time is
+// returned if the date is missing or unreadable
+func (t *Tags) ReleaseDate() time.Time {
+	date := strings.TrimSpace(t.Date)
+	// ID3v2.4 timestamps can have the time too
+	date, _, _ = strings.Cut(date, "T")
+	for _, layout := range []string{time.DateOnly, "2006-01", "2006"} {
+		if len(date) >= len(layout) {
+			if parsed, err := time.Parse(layout, date[:len(layout)]); err == nil {
+				return parsed
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// set assigns a tag by its Vorbis comment name. The ID3 frames are mapped onto the same names
+func (t *Tags) set(name, value string) {
+	value = strings.TrimSpace(strings.TrimRight(value, "\x00"))
+	if value == "" {
+		return
+	}
+	switch strings.ToUpper(name) {
+	case "TITLE":
+		t.Title = value
+	case "ARTIST":
+		if t.Artist == "" {
+			t.Artist = value
+		}
+	case "ALBUMARTIST", "ALBUM ARTIST", "ALBUM_ARTIST":
+		t.AlbumArtist = value
+	case "ALBUM":
+		t.Album = value
+	case "GENRE":
+		t.Genres = append(t.Genres, value)
+	case "TRACKNUMBER":
+		t.Track, t.TrackTotal = parsePosition(value, t.TrackTotal)
+	case "TRACKTOTAL", "TOTALTRACKS":
+		t.TrackTotal, _ = strconv.Atoi(value)
+	case "DISCNUMBER":
+		t.Disc, _ = parsePosition(value, 0)
+	case "DATE", "YEAR", "ORIGINALDATE":
+		// the release date is preferred over the date of the recording
+		if t.Date == "" || len(value) > len(t.Date) {
+			t.Date = value
+		}
+	case "LYRICS", "UNSYNCEDLYRICS":
+		t.Lyrics = value
+	case "MUSICBRAINZ_ALBUMID", "MUSICBRAINZ ALBUM ID":
+		t.AlbumMBID = value
+	case "MUSICBRAINZ_TRACKID":
+		t.RecordingMBID = value
+	}
+}
+
+// parsePosition parses the track and disc numbers, which can be followed by the total, e.g. "3/12"
+func parsePosition(value string, total int) (int, int) {
+	number, of, found := strings.Cut(value, "/")
+	n, _ := strconv.Atoi(strings.TrimSpace(number))
+	if found {
+		if t, err := strconv.Atoi(strings.TrimSpace(of)); err == nil {
+			total = t
+		}
+	}
+	return n, total
+}
+
+// readVorbisComments parses the comment block shared by FLAC, Vorbis and Opus. Unlike the
+// rest of FLAC, it's little-endian
+func readVorbisComments(block []byte, tags *Tags) error {
+	next := func() (string, error) {
+		if len(block) < 4 {
+			return "", io.ErrUnexpectedEOF
+		}
+		size := int(uint32(block[0]) | uint32(block[1])<<8 | uint32(block[2])<<16 | uint32(block[3])<<24)
+		if size < 0 || len(block)-4 < size {
+			return "", io.ErrUnexpectedEOF
+		}
+		s := string(block[4 : 4+size])
+		block = block[4+size:]
+		return s, nil
+	}
+	// the vendor string
+	if _, err := next(); err != nil {
+		return fmt.Errorf("error reading vorbis comments: %w", err)
+	}
+	if len(block) < 4 {
+		return fmt.Errorf("error reading vorbis comments: %w", io.ErrUnexpectedEOF)
+	}
+	count := int(uint32(block[0]) | uint32(block[1])<<8 | uint32(block[2])<<16 | uint32(block[3])<<24)
+	block = block[4:]
+	for i := 0; i < count; i++ {
+		comment, err := next()
+		if err != nil {
+			return fmt.Errorf("error reading vorbis comment %d: %w", i, err)
+		}
+		if name, value, ok := strings.Cut(comment, "="); ok {
+			tags.set(name, value)
+		}
+	}
+	return nil
+}
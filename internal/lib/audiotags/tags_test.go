@@ -0,0 +1,218 @@
+package audiotags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// id3Frame encodes a v2.3 or v2.4 frame
+func id3Frame(major byte, id string, body []byte) []byte {
+	frame := []byte(id)
+	size := make([]byte, 4)
+	if major == 4 {
+		size = []byte{byte(len(body) >> 21 & 0x7F), byte(len(body) >> 14 & 0x7F), byte(len(body) >> 7 & 0x7F), byte(len(body) & 0x7F)}
+	} else {
+		binary.BigEndian.PutUint32(size, uint32(len(body)))
+	}
+	frame = append(frame, size...)
+	frame = append(frame, 0, 0)
+	return append(frame, body...)
+}
+
+func id3Tag(major byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	// padding
+	body = append(body, make([]byte, 16)...)
+	n := len(body)
+	tag := []byte{'I', 'D', '3', major, 0, 0, byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+	return append(tag, body...)
+}
+
+func utf16Text(values ...string) []byte {
+	text := []byte{1}
+	for i, value := range values {
+		if i > 0 {
+			text = append(text, 0, 0)
+		}
+		text = append(text, 0xFF, 0xFE)
+		for _, unit := range utf16.Encode([]rune(value)) {
+			text = append(text, byte(unit), byte(unit>>8))
+		}
+	}
+	return text
+}
+
+func vorbisComments(comments ...string) []byte {
+	var b bytes.Buffer
+	write := func(s string) {
+		binary.Write(&b, binary.LittleEndian, uint32(len(s))) //nolint:errcheck // in-memory buffer
+		b.WriteString(s)
+	}
+	write("test encoder")
+	binary.Write(&b, binary.LittleEndian, uint32(len(comments))) //nolint:errcheck // in-memory buffer
+	for _, c := range comments {
+		write(c)
+	}
+	return b.Bytes()
+}
+
+// oggPage wraps a packet in a single page. The checksum isn't verified by the reader
+func oggPage(serial uint32, granule uint64, packet []byte) []byte {
+	var segments []byte
+	for n := len(packet); ; n -= 255 {
+		if n < 255 {
+			segments = append(segments, byte(n))
+			break
+		}
+		segments = append(segments, 255)
+	}
+	page := []byte("OggS\x00\x00")
+	page = binary.LittleEndian.AppendUint64(page, granule)
+	page = binary.LittleEndian.AppendUint32(page, serial)
+	page = append(page, make([]byte, 8)...)
+	page = append(page, byte(len(segments)))
+	page = append(page, segments...)
+	return append(page, packet...)
+}
+
+func TestID3v24(t *testing.T) {
+	file := id3Tag(4,
+		id3Frame(4, "TIT2", append([]byte{3}, "Teardrop"...)),
+		id3Frame(4, "TPE1", utf16Text("Massive Attack", "Elizabeth Fraser")),
+		id3Frame(4, "TALB", append([]byte{3}, "Mezzanine"...)),
+		id3Frame(4, "TRCK", append([]byte{0}, "3/11"...)),
+		id3Frame(4, "TCON", append([]byte{0}, "(27)"...)),
+		id3Frame(4, "TDRC", append([]byte{3}, "1998-04-20T00:00"...)),
+		id3Frame(4, "TLEN", append([]byte{0}, "330500"...)),
+		id3Frame(4, "TXXX", append([]byte{3}, "MusicBrainz Album Id\x002b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21"...)),
+		id3Frame(4, "UFID", []byte("http://musicbrainz.org\x000e2d4b8b-1c3d-4e0f-8a7b-5f6c7d8e9f03")),
+		id3Frame(4, "APIC", make([]byte, 300)),
+	)
+	file = append(file, make([]byte, 1024)...)
+
+	tags, err := Read(bytes.NewReader(file))
+	require.NoError(t, err)
+	assert.Equal(t, "id3v2.4", tags.Format)
+	assert.Equal(t, "Teardrop", tags.Title)
+	assert.Equal(t, "Massive Attack", tags.Artist, "the first of multiple artists should be used")
+	assert.Equal(t, "Mezzanine", tags.Album)
+	assert.Equal(t, 3, tags.Track)
+	assert.Equal(t, 11, tags.TrackTotal)
+	assert.Equal(t, []string{"Trip-Hop"}, tags.Genres)
+	assert.Equal(t, time.Date(1998, time.April, 20, 0, 0, 0, 0, time.UTC), tags.ReleaseDate())
+	assert.Equal(t, 5*time.Minute+31*time.Second, tags.Duration())
+	assert.Equal(t, "2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21", tags.AlbumMBID)
+	assert.Equal(t, "0e2d4b8b-1c3d-4e0f-8a7b-5f6c7d8e9f03", tags.RecordingMBID)
+}
+
+func TestID3v23(t *testing.T) {
+	file := id3Tag(3,
+		id3Frame(3, "TIT2", utf16Text("Żółw")),
+		id3Frame(3, "TPE2", append([]byte{0}, "Various Artists"...)),
+		id3Frame(3, "TYER", append([]byte{0}, "2004"...)),
+		id3Frame(3, "TPOS", append([]byte{0}, "2/2"...)),
+		id3Frame(3, "USLT", append([]byte{0}, "eng\x00la la la"...)),
+	)
+	tags, err := Read(bytes.NewReader(file))
+	require.NoError(t, err)
+	assert.Equal(t, "Żółw", tags.Title)
+	assert.Equal(t, "Various Artists", tags.AlbumArtist)
+	assert.Equal(t, 2, tags.Disc)
+	assert.Equal(t, "la la la", tags.Lyrics)
+	assert.Equal(t, 2004, tags.ReleaseDate().Year())
+}
+
+func TestID3v1(t *testing.T) {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	copy(tag[3:], "Angel")
+	copy(tag[33:], "Massive Attack")
+	copy(tag[63:], "Mezzanine")
+	copy(tag[93:], "1998")
+	tag[126], tag[127] = 1, 27
+	file := append(bytes.Repeat([]byte{0xFF, 0xFB, 0x90, 0x64}, 64), tag...)
+
+	tags, err := Read(bytes.NewReader(file))
+	require.NoError(t, err)
+	assert.Equal(t, "id3v1", tags.Format)
+	assert.Equal(t, "Angel", tags.Title)
+	assert.Equal(t, 1, tags.Track)
+	assert.Equal(t, []string{"Trip-Hop"}, tags.Genres)
+}
+
+func TestFLAC(t *testing.T) {
+	streamInfo := make([]byte, 34)
+	// 44.1 kHz, stereo, 16 bits, 10 seconds
+	samples := uint64(441000)
+	binary.BigEndian.PutUint64(streamInfo[10:18], 44100<<44|1<<41|15<<36|samples)
+	comments := vorbisComments("TITLE=Nightswim", "ARTIST=Mira Odell", "ALBUM=Nightswim", "TRACKNUMBER=1",
+		"TRACKTOTAL=1", "GENRE=Synthpop", "GENRE=Dream Pop", "DATE=2023-06-02", "MUSICBRAINZ_TRACKID=abc")
+
+	file := []byte("fLaC")
+	file = append(file, flacStreamInfo, 0, 0, byte(len(streamInfo)))
+	file = append(file, streamInfo...)
+	// a picture block, which should be skipped
+	file = append(file, 6, 0, 0, 8)
+	file = append(file, make([]byte, 8)...)
+	file = append(file, 0x80|flacVorbisComment, 0, byte(len(comments)>>8), byte(len(comments)))
+	file = append(file, comments...)
+
+	// tagged with ID3 too
+	withID3 := append(id3Tag(3, id3Frame(3, "TIT2", append([]byte{0}, "Wrong"...))), file...)
+	for _, f := range [][]byte{file, withID3} {
+		tags, err := Read(bytes.NewReader(f))
+		require.NoError(t, err)
+		assert.Equal(t, "flac", tags.Format)
+		assert.Equal(t, "Nightswim", tags.Title)
+		assert.Equal(t, "Mira Odell", tags.Artist)
+		assert.Equal(t, []string{"Synthpop", "Dream Pop"}, tags.Genres)
+		assert.Equal(t, 1, tags.TrackTotal)
+		assert.Equal(t, 10*time.Second, tags.Duration())
+		assert.Equal(t, "abc", tags.RecordingMBID)
+	}
+}
+
+func TestOgg(t *testing.T) {
+	vorbisID := append([]byte("\x01vorbis"), make([]byte, 23)...)
+	binary.LittleEndian.PutUint32(vorbisID[12:16], 48000)
+	comment := append([]byte("\x03vorbis"), vorbisComments("TITLE=Tide Pools", "ARTIST=Lowland Cartography",
+		"TRACKNUMBER=2/3", "LYRICS="+strings.Repeat("la ", 200))...)
+
+	var file []byte
+	file = append(file, oggPage(7, 0, vorbisID)...)
+	file = append(file, oggPage(7, 0, comment)...)
+	// an interleaved stream
+	file = append(file, oggPage(8, 999999999, []byte("other"))...)
+	file = append(file, oggPage(7, 48000*90, make([]byte, 100))...)
+
+	tags, err := Read(bytes.NewReader(file))
+	require.NoError(t, err)
+	assert.Equal(t, "vorbis", tags.Format)
+	assert.Equal(t, "Tide Pools", tags.Title)
+	assert.Equal(t, 2, tags.Track)
+	assert.Equal(t, 3, tags.TrackTotal)
+	assert.Len(t, tags.Lyrics, 599, "comments spanning several segments should be joined")
+	assert.Equal(t, 90*time.Second, tags.Duration())
+
+	opusID := append([]byte("OpusHead\x01\x02"), 0x38, 0x01)
+	opusID = append(opusID, make([]byte, 7)...)
+	opus := oggPage(3, 0, opusID)
+	opus = append(opus, oggPage(3, 0, append([]byte("OpusTags"), vorbisComments("TITLE=Opus")...))...)
+	opus = append(opus, oggPage(3, 312+48000*5, make([]byte, 10))...)
+	tags, err = Read(bytes.NewReader(opus))
+	require.NoError(t, err)
+	assert.Equal(t, "opus", tags.Format)
+	assert.Equal(t, 5*time.Second, tags.Duration(), "the pre-skip should be subtracted")
+}
+
+func TestUnsupported(t *testing.T) {
+	_, err := Read(bytes.NewReader([]byte("RIFF....WAVEfmt and some more bytes to make it long enough")))
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
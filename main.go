@@ -21,11 +21,13 @@ import (
 	"net"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"codeberg.org/mjh/LibRate/cfg"
 	"codeberg.org/mjh/LibRate/cmd"
+	mediaCtrl "codeberg.org/mjh/LibRate/controllers/media"
 	"codeberg.org/mjh/LibRate/lib/redist"
 	"codeberg.org/mjh/LibRate/routes"
 
@@ -45,7 +47,10 @@ import (
 	"codeberg.org/mjh/LibRate/internal/logging"
 	"codeberg.org/mjh/LibRate/middleware/profiling"
 	"codeberg.org/mjh/LibRate/middleware/render"
+	"codeberg.org/mjh/LibRate/middleware/security"
 	"codeberg.org/mjh/LibRate/middleware/session"
+	"codeberg.org/mjh/LibRate/models"
+	mediaModels "codeberg.org/mjh/LibRate/models/media"
 )
 
 type FlagArgs struct {
@@ -59,6 +64,9 @@ type FlagArgs struct {
 	// SkipErrors is a comma-separated list of error codes to skip and not panic on.
 	// Particularly useful in development to bypass certain less important blockers
 	SkipErrors string
+	// ImportTags is a comma-separated list of audio files, tag dumps or directories
+	// to import albums from, instead of starting the server
+	ImportTags string
 }
 
 // @title LibRate
@@ -152,6 +160,8 @@ func main() {
 		log.Fatal().Err(err).Msgf("Failed to connect to database: %v", err)
 	}
 	log.Info().Msg("Connected to database")
+	s.SetDeliveries(models.NewDeliveryStorage(dbConn, &log))
+	s.SetDomainPolicies(models.NewDomainPolicyStorage(dbConn, &log))
 	defer func() {
 		if dbConn != nil {
 			dbConn.Close()
@@ -167,6 +177,13 @@ func main() {
 		}
 	}
 
+	if flags.ImportTags != "" {
+		if err = importTags(pgConn, dbConn, flags.ImportTags, &log); err != nil {
+			log.Fatal().Err(err).Msg("Failed to import tags")
+		}
+		return
+	}
+
 	// Check password entropy
 	entropy, _ := redist.CheckPasswordEntropy(conf.Secret)
 	if err == nil && entropy < 50 {
@@ -268,7 +285,8 @@ func setupPOW(conf *cfg.Config, app *fiber.App) {
 		PowInterval: time.Duration(conf.Fiber.PowInterval * int(time.Second)),
 		Difficulty:  conf.Fiber.PowDifficulty,
 		Filter: func(c *fiber.Ctx) bool {
-			return c.IP() == conf.Fiber.Host || conf.LibrateEnv == "development"
+			return c.IP() == conf.Fiber.Host || conf.LibrateEnv == "development" ||
+				security.IsFederationRequest(c)
 		},
 		Storage: redis.New(redis.Config{
 			Host:     conf.Redis.Host,
@@ -318,6 +336,7 @@ func parseFlags() FlagArgs {
 	var (
 		init, profiler         bool
 		configFile, skipErrors string
+		importPaths            string
 	)
 
 	const (
@@ -329,6 +348,7 @@ func parseFlags() FlagArgs {
 		pprofUse   = "Start tracing/profiling server. LibrateEnv must be set to development"
 		skipErrVal = ""
 		skipErrUse = "Comma-separated list of error codes to skip and not panic on"
+		importUse  = "Comma-separated list of audio files, JSON tag dumps or directories to import albums from, then exit"
 		short      = " (shorthand)"
 	)
 
@@ -340,6 +360,7 @@ func parseFlags() FlagArgs {
 	flag.StringVar(&skipErrors, "s", skipErrVal, skipErrUse+short)
 	flag.BoolVar(&profiler, "tracing", pprofVal, pprofUse)
 	flag.BoolVar(&profiler, "t", pprofVal, pprofUse+short)
+	flag.StringVar(&importPaths, "import-tags", "", importUse)
 
 	flag.Parse()
 
@@ -348,7 +369,25 @@ func parseFlags() FlagArgs {
 		ConfigFile: configFile,
 		Profile:    profiler,
 		SkipErrors: skipErrors,
+		ImportTags: importPaths,
+	}
+}
+
+// importTags reads the tags of the audio files at the given paths into albums, for bulk imports
+// of local collections without uploading them through the API
+func importTags(pgConn *pgxpool.Pool, dbConn *sqlx.DB, paths string, log *zerolog.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	storage := mediaModels.NewStorage(pgConn, dbConn, log)
+	albums, err := mediaCtrl.ImportTagFiles(ctx, storage, strings.Split(paths, ","))
+	for i := range albums {
+		log.Info().Msgf("Imported %s (%d tracks) as %s", albums[i].Name, len(albums[i].Tracks), albums[i].MediaID)
 	}
+	if err != nil {
+		return fmt.Errorf("failed to import tags: %w", err)
+	}
+	log.Info().Msgf("Imported %d albums", len(albums))
+	return nil
 }
 
 func initLogging(logConf *logging.Config) zerolog.Logger {
@@ -40,6 +40,18 @@ func Protected(sess *session.Store, log *zerolog.Logger, conf *cfg.Config) fiber
 	})
 }
 
+// Identified lets anonymous requests through, but identifies the member like Protected does
+// when the request carries a JWT, e.g. to personalize public pages
+func Identified(sess *session.Store, log *zerolog.Logger, conf *cfg.Config) fiber.Handler {
+	protected := Protected(sess, log, conf)
+	return func(c *fiber.Ctx) error {
+		if len(c.Request().Header.Peek(fiber.HeaderAuthorization)) == 0 {
+			return c.Next()
+		}
+		return protected(c)
+	}
+}
+
 func DecryptJWT(tokenString string, s *session.Session, conf *cfg.Config) (*jwt.Token, error) {
 	claims := jwt.MapClaims{
 		"exp":         s.Get("claims_exp"),
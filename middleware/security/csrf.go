@@ -14,6 +14,7 @@ import (
 
 func SetupCSRF(conf *cfg.Config, logger *zerolog.Logger) fiber.Handler {
 	return csrf.New(csrf.Config{
+		Next: IsFederationRequest,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			path := c.Path()
 			if conf.LibrateEnv == "development" {
@@ -0,0 +1,57 @@
+package security
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// IsFederationRequest reports whether the request comes from another server, e.g.
+// a fediverse instance. Such requests can't solve proof of work challenges nor
+// carry CSRF tokens. The discovery endpoints and the ActivityStreams documents are
+// only ever read, and the inboxes authenticate the requests with HTTP signatures instead.
+func IsFederationRequest(c *fiber.Ctx) bool {
+	path := c.Path()
+	if strings.HasPrefix(path, "/.well-known/") || strings.HasPrefix(path, "/nodeinfo/") || isInbox(path) {
+		return true
+	}
+	readOnly := c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead
+	return readOnly && isDocument(path) && WantsActivityStreams(c)
+}
+
+// WantsActivityStreams reports whether the client asked for the ActivityStreams
+// representation of a resource, rather than the one used by the frontend
+func WantsActivityStreams(c *fiber.Ctx) bool {
+	accept := c.Get(fiber.HeaderAccept)
+	return strings.Contains(accept, "application/activity+json") ||
+		strings.Contains(accept, "application/ld+json")
+}
+
+// isInbox reports whether the path is the shared inbox or the inbox of a member
+func isInbox(path string) bool {
+	if path == "/api/inbox" {
+		return true
+	}
+	name, found := strings.CutPrefix(path, "/api/members/")
+	name, isInbox := strings.CutSuffix(name, "/inbox")
+	return found && isInbox && name != "" && !strings.Contains(name, "/")
+}
+
+// isDocument reports whether the path is one of the resources served as ActivityStreams
+// documents: the actors and their outboxes, the activities, the media and the creators
+func isDocument(path string) bool {
+	if path == "/api/media/creator" {
+		return true
+	}
+	for _, prefix := range []string{"/api/members/", "/api/activities/", "/api/media/"} {
+		rest, found := strings.CutPrefix(path, prefix)
+		if !found || rest == "" {
+			continue
+		}
+		if prefix == "/api/members/" {
+			rest = strings.TrimSuffix(rest, "/outbox")
+		}
+		return !strings.Contains(rest, "/")
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package security
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsFederationRequest(t *testing.T) {
+	const activityJSON = "application/activity+json"
+	testCases := []struct {
+		name, method, path, accept, signature string
+		want                                  bool
+	}{
+		{name: "webfinger", method: fiber.MethodGet, path: "/.well-known/webfinger", want: true},
+		{name: "nodeinfo", method: fiber.MethodGet, path: "/nodeinfo/2.1", want: true},
+		{name: "shared inbox", method: fiber.MethodPost, path: "/api/inbox", want: true},
+		{name: "member inbox", method: fiber.MethodPost, path: "/api/members/lain/inbox", want: true},
+		{name: "actor document", method: fiber.MethodGet, path: "/api/members/lain", accept: activityJSON, want: true},
+		{name: "outbox document", method: fiber.MethodGet, path: "/api/members/lain/outbox", accept: activityJSON, want: true},
+		{name: "media document", method: fiber.MethodGet, path: "/api/media/0190a4f4-6e5b-7c3a-8d1e-2f4b5a6c7d8e", accept: activityJSON, want: true},
+		{name: "creator document", method: fiber.MethodHead, path: "/api/media/creator", accept: "application/ld+json", want: true},
+		{name: "activity document", method: fiber.MethodGet, path: "/api/activities/42", accept: activityJSON, want: true},
+		{name: "media page", method: fiber.MethodGet, path: "/api/media/0190a4f4-6e5b-7c3a-8d1e-2f4b5a6c7d8e"},
+		{name: "write with ActivityStreams accept", method: fiber.MethodPost, path: "/api/media/import", accept: activityJSON},
+		{name: "write to a document path", method: fiber.MethodDelete, path: "/api/members/lain", accept: activityJSON},
+		{name: "other route with ActivityStreams accept", method: fiber.MethodGet, path: "/api/reviews/latest", accept: activityJSON},
+		{name: "nested media route", method: fiber.MethodGet, path: "/api/media/works/1", accept: activityJSON},
+		{name: "signature outside the inboxes", method: fiber.MethodPost, path: "/api/reviews/", signature: `keyId="x"`},
+		{name: "members route ending like an inbox", method: fiber.MethodPost, path: "/api/members/follow/x/inbox"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got bool
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				got = IsFederationRequest(c)
+				return c.SendStatus(fiber.StatusNoContent)
+			})
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.accept != "" {
+				req.Header.Set(fiber.HeaderAccept, tc.accept)
+			}
+			if tc.signature != "" {
+				req.Header.Set("Signature", tc.signature)
+			}
+			_, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
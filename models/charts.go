@@ -0,0 +1,200 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/lib/pq"
+	"github.com/samber/lo"
+)
+
+// ErrInvalidChartFilter is returned for chart filters which can't match any media
+var ErrInvalidChartFilter = errors.New("invalid chart filter")
+
+// chartKinds lists the kinds of media the charts can be narrowed down to
+var chartKinds = []string{
+	"album", "track", "film", "tv_show", "season", "episode", "book", "game", "anime", "manga", "comic",
+}
+
+type (
+	// ChartFilter narrows down the charts. The zero values don't filter anything
+	ChartFilter struct {
+		Kind string
+		// the range of the release years, both inclusive
+		YearFrom int
+		YearTo   int
+		// the media of the subgenres of the genre are included
+		GenreID int64
+		// ISO 3166-1 alpha-2 code of the country the artists, authors or studios come from
+		Country    string
+		MinRatings int
+		Limit      int
+		Offset     int
+	}
+
+	// ChartEntry is a media item in the charts, ranked by its weighted score
+	ChartEntry struct {
+		Rank    int       `json:"rank" db:"-" example:"1"`
+		MediaID uuid.UUID `json:"media_id" db:"media_id"`
+		Kind    string    `json:"kind" db:"kind" example:"album"`
+		Title   string    `json:"title" db:"title" example:"Transilvanian Hunger"`
+		Year    int16     `json:"year" db:"year" example:"1994"`
+		// including the ancestors of the genres of the media item
+		Genres pq.Int64Array `json:"genres" db:"genres"`
+		// ISO 3166-1 alpha-2 codes
+		Countries   pq.StringArray `json:"countries" db:"countries" example:"['NO']"`
+		RatingCount int            `json:"rating_count" db:"rating_count"`
+		// on the reference scale, until converted to the viewer's scale
+		Average       float64 `json:"average_rating" db:"average"`
+		WeightedScore float64 `json:"weighted_score" db:"weighted_score"`
+	}
+)
+
+// ParseChartFilter reads the chart filters from the query string through query, e.g. fiber.Ctx.Query,
+// and validates them. A year or a decade, like 1990, is a shorthand for a range of release years
+func ParseChartFilter(query func(key string, defaultValue ...string) string) (*ChartFilter, error) {
+	filter := ChartFilter{
+		Kind:    query("kind"),
+		Country: query("country"),
+	}
+	ints := []struct {
+		key   string
+		value *int
+		def   string
+	}{
+		{"year_from", &filter.YearFrom, "0"},
+		{"year_to", &filter.YearTo, "0"},
+		{"min_ratings", &filter.MinRatings, "0"},
+		{"limit", &filter.Limit, "25"},
+		{"offset", &filter.Offset, "0"},
+	}
+	for _, i := range ints {
+		value, err := strconv.Atoi(query(i.key, i.def))
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid %s", ErrInvalidChartFilter, i.key)
+		}
+		*i.value = value
+	}
+	if genre := query("genre"); genre != "" {
+		id, err := strconv.ParseInt(genre, 10, 16)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("%w: invalid genre %q", ErrInvalidChartFilter, genre)
+		}
+		filter.GenreID = id
+	}
+	if year := query("year"); year != "" {
+		y, err := strconv.Atoi(year)
+		if err != nil || y < 1 {
+			return nil, fmt.Errorf("%w: invalid year %q", ErrInvalidChartFilter, year)
+		}
+		filter.YearFrom, filter.YearTo = y, y
+	}
+	if decade := query("decade"); decade != "" {
+		d, err := strconv.Atoi(decade)
+		if err != nil || d < 1 || d%10 != 0 {
+			return nil, fmt.Errorf("%w: invalid decade %q, expected a year like 1990", ErrInvalidChartFilter, decade)
+		}
+		filter.YearFrom, filter.YearTo = d, d+9
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	return &filter, nil
+}
+
+// Validate checks the kind, the year range, the country code and the paging of the filter
+func (f *ChartFilter) Validate() error {
+	switch {
+	case f.Kind != "" && !lo.Contains(chartKinds, f.Kind):
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidChartFilter, f.Kind)
+	case f.YearFrom < 0 || f.YearTo < 0 || (f.YearTo != 0 && f.YearFrom > f.YearTo):
+		return fmt.Errorf("%w: invalid year range %d-%d", ErrInvalidChartFilter, f.YearFrom, f.YearTo)
+	case f.GenreID < 0:
+		return fmt.Errorf("%w: invalid genre %d", ErrInvalidChartFilter, f.GenreID)
+	case f.Country != "" && len(f.Country) != 2:
+		return fmt.Errorf("%w: invalid country code %q", ErrInvalidChartFilter, f.Country)
+	case f.MinRatings < 0:
+		return fmt.Errorf("%w: the minimum number of ratings can't be negative", ErrInvalidChartFilter)
+	case f.Limit < 1 || f.Limit > 100 || f.Offset < 0:
+		return fmt.Errorf("%w: invalid page of %d from %d", ErrInvalidChartFilter, f.Limit, f.Offset)
+	}
+	return nil
+}
+
+// Chart returns the best rated media matching the filter, from the precomputed media.chart_entries,
+// so the latest ratings show up after the next RefreshCharts
+func (rs *RatingStorage) Chart(ctx context.Context, filter *ChartFilter) ([]ChartEntry, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		if err := filter.Validate(); err != nil {
+			return nil, err
+		}
+		// only the set filters are added, so that the planner can pick the indexes they need
+		var (
+			conditions []string
+			args       []any
+		)
+		where := func(condition string, arg any) {
+			args = append(args, arg)
+			conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+		}
+		if filter.Kind != "" {
+			where("c.kind = $%d::media.kind", filter.Kind)
+		}
+		if filter.YearFrom != 0 {
+			where(`c."year" >= $%d`, filter.YearFrom)
+		}
+		if filter.YearTo != 0 {
+			where(`c."year" <= $%d`, filter.YearTo)
+		}
+		if filter.GenreID != 0 {
+			where("c.genres @> ARRAY[$%d::int2]", filter.GenreID)
+		}
+		if filter.Country != "" {
+			where("c.countries && ARRAY(SELECT id FROM places.country WHERE code = $%d)::int2[]",
+				strings.ToUpper(filter.Country))
+		}
+		if filter.MinRatings > 1 {
+			where("c.rating_count >= $%d", filter.MinRatings)
+		}
+		query := `SELECT c.media_id, c.kind, c.title, c."year", c.genres,
+			ARRAY(SELECT code FROM places.country WHERE id = ANY(c.countries) ORDER BY code) AS countries,
+			c.rating_count, c.average, c.weighted_score
+			FROM media.chart_entries c`
+		if len(conditions) > 0 {
+			query += " WHERE " + strings.Join(conditions, " AND ")
+		}
+		args = append(args, filter.Limit, filter.Offset)
+		query += fmt.Sprintf(` ORDER BY c.weighted_score DESC NULLS LAST, c.rating_count DESC, c.media_id
+			LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+		entries := make([]ChartEntry, 0, filter.Limit)
+		if err := rs.db.SelectContext(ctx, &entries, query, args...); err != nil {
+			return nil, fmt.Errorf("error getting the chart: %w", err)
+		}
+		for i := range entries {
+			entries[i].Rank = filter.Offset + i + 1
+		}
+		return entries, nil
+	}
+}
+
+// RefreshCharts recomputes the charts from the current scores, genres and places.
+// The charts stay readable while they're being refreshed
+func (rs *RatingStorage) RefreshCharts(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if _, err := rs.db.ExecContext(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY media.chart_entries`); err != nil {
+			return fmt.Errorf("error refreshing the charts: %w", err)
+		}
+		return nil
+	}
+}
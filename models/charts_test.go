@@ -0,0 +1,113 @@
+package models
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// query looks up the query string parameters the way fiber.Ctx.Query does
+func query(t *testing.T, raw string) func(string, ...string) string {
+	t.Helper()
+	values, err := url.ParseQuery(raw)
+	require.NoError(t, err)
+	return func(key string, defaultValue ...string) string {
+		if v := values.Get(key); v != "" {
+			return v
+		}
+		if len(defaultValue) > 0 {
+			return defaultValue[0]
+		}
+		return ""
+	}
+}
+
+func TestParseChartFilter(t *testing.T) {
+	testCases := []struct {
+		name  string
+		query string
+		want  ChartFilter
+	}{
+		{"defaults", "", ChartFilter{Limit: 25}},
+		{"year", "year=1994", ChartFilter{YearFrom: 1994, YearTo: 1994, Limit: 25}},
+		{"decade", "decade=1990", ChartFilter{YearFrom: 1990, YearTo: 1999, Limit: 25}},
+		{"year range", "year_from=1990&year_to=1995", ChartFilter{YearFrom: 1990, YearTo: 1995, Limit: 25}},
+		{"decade overrides the range", "decade=1980&year_from=1990&year_to=1995", ChartFilter{YearFrom: 1980, YearTo: 1989, Limit: 25}},
+		{"open-ended range", "year_from=2000", ChartFilter{YearFrom: 2000, Limit: 25}},
+		{
+			"all the filters",
+			"kind=album&genre=12&country=no&min_ratings=5&limit=10&offset=20",
+			ChartFilter{Kind: "album", GenreID: 12, Country: "no", MinRatings: 5, Limit: 10, Offset: 20},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := ParseChartFilter(query(t, tc.query))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, *filter)
+		})
+	}
+}
+
+func TestParseChartFilterInvalid(t *testing.T) {
+	testCases := []struct {
+		name  string
+		query string
+	}{
+		{"decade not ending in 0", "decade=1994"},
+		{"negative decade", "decade=-1990"},
+		{"decade not a number", "decade=nineties"},
+		{"year not a number", "year=MCMXCIV"},
+		{"zero year", "year=0"},
+		{"reversed year range", "year_from=1999&year_to=1990"},
+		{"unknown kind", "kind=podcast"},
+		{"genre not a number", "genre=metal"},
+		{"genre out of range", "genre=40000"},
+		{"three letter country code", "country=NOR"},
+		{"one letter country code", "country=N"},
+		{"negative minimum of ratings", "min_ratings=-1"},
+		{"zero limit", "limit=0"},
+		{"limit over 100", "limit=101"},
+		{"negative offset", "offset=-1"},
+		{"limit not a number", "limit=all"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseChartFilter(query(t, tc.query))
+			assert.ErrorIs(t, err, ErrInvalidChartFilter)
+		})
+	}
+}
+
+func TestChartFilterValidate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		filter ChartFilter
+		valid  bool
+	}{
+		{"first page", ChartFilter{Limit: 1}, true},
+		{"largest page", ChartFilter{Limit: 100, Offset: 1000}, true},
+		{"single year", ChartFilter{YearFrom: 1994, YearTo: 1994, Limit: 25}, true},
+		{"up to a year", ChartFilter{YearTo: 1994, Limit: 25}, true},
+		{"two letter country code", ChartFilter{Country: "NO", Limit: 25}, true},
+		{"reversed year range", ChartFilter{YearFrom: 1995, YearTo: 1994, Limit: 25}, false},
+		{"negative year", ChartFilter{YearFrom: -1, Limit: 25}, false},
+		{"long country code", ChartFilter{Country: "NOR", Limit: 25}, false},
+		{"negative genre", ChartFilter{GenreID: -1, Limit: 25}, false},
+		{"no limit", ChartFilter{}, false},
+		{"limit over 100", ChartFilter{Limit: 101}, false},
+		{"negative offset", ChartFilter{Limit: 25, Offset: -1}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.filter.Validate()
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidChartFilter)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+type (
+	// Delivery is an outgoing federated activity, queued for delivery to a single inbox
+	Delivery struct {
+		ID     int64  `json:"id" db:"id"`
+		Sender string `json:"sender" db:"sender"`
+		Inbox  string `json:"inbox" db:"inbox"`
+		// Host of the inbox, used to limit the number of concurrent deliveries to one server
+		Host        string         `json:"host" db:"host"`
+		ActivityIRI sql.NullString `json:"activity_iri" db:"activity_iri"`
+		Payload     []byte         `json:"payload" db:"payload"`
+		// Status is either pending, running or dead (delivery was abandoned)
+		Status      string         `json:"status" db:"status"`
+		Attempts    int32          `json:"attempts" db:"attempts"`
+		LastError   sql.NullString `json:"last_error" db:"last_error"`
+		NextAttempt time.Time      `json:"next_attempt" db:"next_attempt"`
+		LockedUntil sql.NullTime   `json:"-" db:"locked_until"`
+		Created     time.Time      `json:"created" db:"created"`
+	}
+
+	DeliveryStorage struct {
+		db  *sqlx.DB
+		log *zerolog.Logger
+	}
+)
+
+func NewDeliveryStorage(db *sqlx.DB, log *zerolog.Logger) *DeliveryStorage {
+	return &DeliveryStorage{db: db, log: log}
+}
+
+// Enqueue adds a delivery to the queue, to be attempted as soon as possible
+func (ds *DeliveryStorage) Enqueue(ctx context.Context, d *Delivery) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		err := ds.db.GetContext(ctx, &d.ID, `INSERT INTO federation.deliveries
+		(sender, inbox, host, activity_iri, payload)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+			d.Sender, d.Inbox, d.Host, d.ActivityIRI, d.Payload)
+		if err != nil {
+			return fmt.Errorf("error enqueuing delivery to %s: %w", d.Inbox, err)
+		}
+		return nil
+	}
+}
+
+// Claim locks the oldest due delivery for the duration of the lease and returns it.
+// Deliveries to the excluded hosts are skipped. Deliveries whose lease has expired,
+// e.g. because the instance was restarted mid-delivery, can be claimed again.
+// If nothing is due, the returned error wraps sql.ErrNoRows.
+func (ds *DeliveryStorage) Claim(ctx context.Context, exclude []string, lease time.Duration) (*Delivery, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		if exclude == nil {
+			exclude = []string{}
+		}
+		var d Delivery
+		err := ds.db.GetContext(ctx, &d, `UPDATE federation.deliveries
+		SET status = 'running', locked_until = now() + make_interval(secs => $2)
+		WHERE id = (
+			SELECT id FROM federation.deliveries
+			WHERE next_attempt <= now()
+				AND (status = 'pending' OR (status = 'running' AND locked_until < now()))
+				AND NOT (host = ANY($1))
+			ORDER BY next_attempt
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, pq.Array(exclude), lease.Seconds())
+		if err != nil {
+			return nil, fmt.Errorf("error claiming delivery: %w", err)
+		}
+		return &d, nil
+	}
+}
+
+// Complete removes a successful delivery from the queue
+func (ds *DeliveryStorage) Complete(ctx context.Context, id int64) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if _, err := ds.db.ExecContext(ctx, `DELETE FROM federation.deliveries WHERE id = $1`, id); err != nil {
+			return fmt.Errorf("error completing delivery %d: %w", id, err)
+		}
+		return nil
+	}
+}
+
+// Reschedule records a failed attempt and releases the delivery until the given time
+func (ds *DeliveryStorage) Reschedule(ctx context.Context, id int64, next time.Time, lastErr string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		_, err := ds.db.ExecContext(ctx, `UPDATE federation.deliveries
+		SET status = 'pending', attempts = attempts + 1, last_error = $2,
+			next_attempt = $3, locked_until = NULL
+		WHERE id = $1`, id, lastErr, next)
+		if err != nil {
+			return fmt.Errorf("error rescheduling delivery %d: %w", id, err)
+		}
+		return nil
+	}
+}
+
+// Bury moves a delivery to the dead letter queue, where it stays until it's retried or discarded
+func (ds *DeliveryStorage) Bury(ctx context.Context, id int64, lastErr string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		_, err := ds.db.ExecContext(ctx, `UPDATE federation.deliveries
+		SET status = 'dead', attempts = attempts + 1, last_error = $2, locked_until = NULL
+		WHERE id = $1`, id, lastErr)
+		if err != nil {
+			return fmt.Errorf("error burying delivery %d: %w", id, err)
+		}
+		return nil
+	}
+}
+
+// DeadLetters lists the abandoned deliveries, newest first
+func (ds *DeliveryStorage) DeadLetters(ctx context.Context, limit, offset int) (dead []*Delivery, err error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		err = ds.db.SelectContext(ctx, &dead, `SELECT * FROM federation.deliveries
+		WHERE status = 'dead'
+		ORDER BY created DESC
+		LIMIT $1 OFFSET $2`, limit, offset)
+		if err != nil {
+			return nil, fmt.Errorf("error getting dead letters: %w", err)
+		}
+		return dead, nil
+	}
+}
+
+// Retry puts a dead letter back into the queue, with a fresh attempt budget
+func (ds *DeliveryStorage) Retry(ctx context.Context, id int64) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		res, err := ds.db.ExecContext(ctx, `UPDATE federation.deliveries
+		SET status = 'pending', attempts = 0, next_attempt = now()
+		WHERE id = $1 AND status = 'dead'`, id)
+		if err != nil {
+			return fmt.Errorf("error retrying delivery %d: %w", id, err)
+		}
+		return expectAffected(res, id)
+	}
+}
+
+// Discard permanently removes a dead letter
+func (ds *DeliveryStorage) Discard(ctx context.Context, id int64) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		res, err := ds.db.ExecContext(ctx, `DELETE FROM federation.deliveries
+		WHERE id = $1 AND status = 'dead'`, id)
+		if err != nil {
+			return fmt.Errorf("error discarding delivery %d: %w", id, err)
+		}
+		return expectAffected(res, id)
+	}
+}
+
+func expectAffected(res sql.Result, id int64) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking affected rows: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("dead letter %d not found: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
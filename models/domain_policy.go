@@ -0,0 +1,210 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+const (
+	// SeverityAllow marks a domain as trusted when federating in allowlist mode
+	SeverityAllow = "allow"
+	// SeveritySilence accepts activities, but hides the content from public listings
+	SeveritySilence = "silence"
+	// SeverityBlock rejects all activities from and to the domain
+	SeverityBlock = "block"
+)
+
+type (
+	// DomainPolicy is an instance-wide moderation decision about another server
+	DomainPolicy struct {
+		Domain   string `json:"domain" db:"domain" validate:"required,fqdn" example:"spam.example"`
+		Severity string `json:"severity" db:"severity" validate:"required,oneof=allow silence block" example:"block"`
+		// RejectMedia strips images, videos etc. from the content received from the domain
+		RejectMedia bool           `json:"reject_media" db:"reject_media"`
+		Reason      sql.NullString `json:"reason,omitempty" db:"reason" swaggertype:"string"`
+		CreatedBy   sql.NullString `json:"created_by,omitempty" db:"created_by" swaggertype:"string"`
+		Created     time.Time      `json:"created" db:"created"`
+		Updated     time.Time      `json:"updated" db:"updated"`
+	}
+
+	DomainPolicyStorage struct {
+		db  *sqlx.DB
+		log *zerolog.Logger
+	}
+)
+
+func NewDomainPolicyStorage(db *sqlx.DB, log *zerolog.Logger) *DomainPolicyStorage {
+	return &DomainPolicyStorage{db: db, log: log}
+}
+
+// Validate normalizes the domain and checks the severity
+func (p *DomainPolicy) Validate() error {
+	p.Domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(p.Domain)), ".")
+	if p.Domain == "" || strings.ContainsAny(p.Domain, "/:@ %_\\") {
+		return fmt.Errorf("invalid domain %q", p.Domain)
+	}
+	if !lo.Contains([]string{SeverityAllow, SeveritySilence, SeverityBlock}, p.Severity) {
+		return fmt.Errorf("invalid severity %q", p.Severity)
+	}
+	return nil
+}
+
+// Set creates or replaces the policy for a domain. Blocking a domain also removes the
+// reviews and follow relationships of its members. The scores are rebuilt, since silencing
+// a domain or lifting the silence changes which reviews count in them
+func (ds *DomainPolicyStorage) Set(ctx context.Context, p *DomainPolicy) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		tx, err := ds.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		_, err = tx.NamedExecContext(ctx, `INSERT INTO federation.domain_policies
+		(domain, severity, reject_media, reason, created_by)
+		VALUES (:domain, :severity, :reject_media, :reason, :created_by)
+		ON CONFLICT (domain) DO UPDATE SET
+			severity = EXCLUDED.severity,
+			reject_media = EXCLUDED.reject_media,
+			reason = EXCLUDED.reason,
+			updated = now()`, p)
+		if err != nil {
+			return fmt.Errorf("error saving policy for %s: %w", p.Domain, err)
+		}
+
+		if p.Severity == SeverityBlock {
+			if err = purgeDomain(ctx, tx, p.Domain); err != nil {
+				return err
+			}
+		}
+		if _, err = tx.ExecContext(ctx, rebuildScores); err != nil {
+			return fmt.Errorf("error rebuilding scores: %w", err)
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error saving policy for %s: %w", p.Domain, err)
+		}
+		return nil
+	}
+}
+
+// purgeDomain removes the data received from a blocked domain
+func purgeDomain(ctx context.Context, tx *sqlx.Tx, domain string) error {
+	webfingerPattern := "%@" + domain
+	subdomainPattern := "%." + domain
+	statements := []string{
+		`DELETE FROM reviews.ratings WHERE remote_actor IS NOT NULL
+			AND (substring(remote_actor from '^[a-z]+://([^/:]+)') = $1
+				OR substring(remote_actor from '^[a-z]+://([^/:]+)') LIKE $3)`,
+		`DELETE FROM public.followers WHERE follower LIKE $2 OR follower LIKE $3
+			OR followee LIKE $2 OR followee LIKE $3`,
+		`DELETE FROM public.follow_requests
+			WHERE requester_webfinger LIKE $2 OR requester_webfinger LIKE $3
+			OR target_webfinger LIKE $2 OR target_webfinger LIKE $3`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt, domain, webfingerPattern, subdomainPattern); err != nil {
+			return fmt.Errorf("error purging data of %s: %w", domain, err)
+		}
+	}
+	return nil
+}
+
+// Remove deletes the policy for a domain and rebuilds the scores, in case the domain was silenced
+func (ds *DomainPolicyStorage) Remove(ctx context.Context, domain string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		tx, err := ds.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		res, err := tx.ExecContext(ctx, `DELETE FROM federation.domain_policies WHERE domain = $1`,
+			strings.ToLower(domain))
+		if err != nil {
+			return fmt.Errorf("error removing policy for %s: %w", domain, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error checking affected rows: %w", err)
+		}
+		if n == 0 {
+			return fmt.Errorf("no policy for %s: %w", domain, sql.ErrNoRows)
+		}
+		if _, err = tx.ExecContext(ctx, rebuildScores); err != nil {
+			return fmt.Errorf("error rebuilding scores: %w", err)
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error removing policy for %s: %w", domain, err)
+		}
+		return nil
+	}
+}
+
+// List returns all domain policies, sorted by domain
+func (ds *DomainPolicyStorage) List(ctx context.Context) (policies []*DomainPolicy, err error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		err = ds.db.SelectContext(ctx, &policies, `SELECT * FROM federation.domain_policies ORDER BY domain`)
+		if err != nil {
+			return nil, fmt.Errorf("error listing domain policies: %w", err)
+		}
+		return policies, nil
+	}
+}
+
+// Match returns the most specific policy applying to the host, i.e. the one for the host
+// itself or its closest parent domain. If there's none, the returned policy is nil
+func (ds *DomainPolicyStorage) Match(ctx context.Context, host string) (*DomainPolicy, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		var p DomainPolicy
+		err := ds.db.GetContext(ctx, &p, `SELECT * FROM federation.domain_policies
+		WHERE domain = ANY($1)
+		ORDER BY length(domain) DESC
+		LIMIT 1`, pq.Array(ParentDomains(host)))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error matching policy for %s: %w", host, err)
+		}
+		return &p, nil
+	}
+}
+
+// ParentDomains returns the host along with all of its parent domains,
+// e.g. a.b.example for a.b.example, b.example and example
+func ParentDomains(host string) []string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	domains := []string{host}
+	for {
+		_, parent, found := strings.Cut(host, ".")
+		if !found || parent == "" {
+			return domains
+		}
+		domains = append(domains, parent)
+		host = parent
+	}
+}
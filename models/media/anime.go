@@ -0,0 +1,199 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// The formats anime are released in
+const (
+	AnimeTV      = "tv"
+	AnimeMovie   = "movie"
+	AnimeOVA     = "ova"
+	AnimeONA     = "ona"
+	AnimeSpecial = "special"
+)
+
+type (
+	// Anime is a Japanese animated series or film
+	Anime struct {
+		MediaID *uuid.UUID `json:"media_id" db:"media_id,pk,unique"`
+		Title   string     `json:"title" db:"title" example:"Cowboy Bebop"`
+		Format  string     `json:"format" db:"format" enum:"tv,movie,ova,ona,special" example:"tv"`
+		// the announced number of episodes, also known before all of them are listed
+		EpisodeCount *int16        `json:"episode_count,omitempty" db:"episode_count" example:"26"`
+		Synopsis     *string       `json:"synopsis,omitempty" db:"synopsis"`
+		Studios      []Studio      `json:"studios,omitempty" db:"-"`
+		Seasons      []AnimeSeason `json:"seasons,omitempty" db:"-"`
+		Genres       []Genre       `json:"genres,omitempty" db:"-"`
+	}
+
+	// AnimeSeason is a numbered season (or cour) of an anime
+	AnimeSeason struct {
+		Number uint8  `json:"number" db:"number"`
+		Title  string `json:"title,omitempty" db:"title"`
+		// the broadcast season the first episode aired in, e.g. spring 1998
+		Year     *int16         `json:"year,omitempty" db:"year" example:"1998"`
+		Quarter  *string        `json:"quarter,omitempty" db:"quarter" enum:"winter,spring,summer,fall" example:"spring"`
+		Episodes []AnimeEpisode `json:"episodes,omitempty" db:"-"`
+	}
+
+	// AnimeEpisode is an episode of an anime season
+	AnimeEpisode struct {
+		Number  uint16     `json:"number" db:"number"`
+		Title   string     `json:"title" db:"title" example:"Asteroid Blues"`
+		AirDate *time.Time `json:"air_date,omitempty" db:"air_date"`
+	}
+)
+
+// ValidAnimeFormat checks if the format is one of the formats anime are released in
+func ValidAnimeFormat(format string) bool {
+	switch format {
+	case AnimeTV, AnimeMovie, AnimeOVA, AnimeONA, AnimeSpecial:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValidQuarter checks if the quarter is one of the four broadcast seasons
+func ValidQuarter(quarter string) bool {
+	switch quarter {
+	case "winter", "spring", "summer", "fall":
+		return true
+	default:
+		return false
+	}
+}
+
+// AddAnime adds the anime submitted by the member to the moderation queue, along with its seasons
+// and episodes. The studios are matched by their names and added if they're new
+func (ms *Storage) AddAnime(ctx context.Context, anime *Anime, submitter string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		for i := range anime.Studios {
+			if anime.Studios[i].ID != 0 {
+				continue
+			}
+			studio, err := ms.Ps.ResolveStudio(ctx, anime.Studios[i].Name, TV)
+			if err != nil {
+				return fmt.Errorf("error resolving studio %s: %w", anime.Studios[i].Name, err)
+			}
+			anime.Studios[i] = *studio
+		}
+
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		id, err := addMediaRow(ctx, tx, anime.Title, "anime", submitter, uuid.NullUUID{})
+		if err != nil {
+			return fmt.Errorf("error adding anime %s: %w", anime.Title, err)
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO media.anime (media_id, title, format, episode_count, synopsis)
+			VALUES ($1, $2, $3, $4, $5)`, id, anime.Title, anime.Format, anime.EpisodeCount, anime.Synopsis)
+		if err != nil {
+			return fmt.Errorf("failed to insert anime into media.anime: %w", err)
+		}
+
+		for i := range anime.Studios {
+			_, err = tx.ExecContext(ctx, `INSERT INTO media.anime_studios (anime, studio)
+				VALUES ($1, $2) ON CONFLICT DO NOTHING`, id, anime.Studios[i].ID)
+			if err != nil {
+				return fmt.Errorf("failed to insert anime studio into media.anime_studios: %w", err)
+			}
+		}
+		for i := range anime.Genres {
+			_, err = tx.ExecContext(ctx, `INSERT INTO media.anime_genres (anime, genre)
+				VALUES ($1, $2) ON CONFLICT DO NOTHING`, id, anime.Genres[i].ID)
+			if err != nil {
+				return fmt.Errorf("failed to insert anime genre into media.anime_genres: %w", err)
+			}
+		}
+		for i := range anime.Seasons {
+			s := &anime.Seasons[i]
+			_, err = tx.ExecContext(ctx, `INSERT INTO media.anime_seasons (anime, "number", title, "year", quarter)
+				VALUES ($1, $2, $3, $4, $5)`, id, s.Number, s.Title, s.Year, s.Quarter)
+			if err != nil {
+				return fmt.Errorf("failed to insert season %d into media.anime_seasons: %w", s.Number, err)
+			}
+			for j := range s.Episodes {
+				e := &s.Episodes[j]
+				_, err = tx.ExecContext(ctx, `INSERT INTO media.anime_episodes (anime, season, "number", title, air_date)
+					VALUES ($1, $2, $3, $4, $5)`, id, s.Number, e.Number, e.Title, e.AirDate)
+				if err != nil {
+					return fmt.Errorf("failed to insert episode %d of season %d into media.anime_episodes: %w",
+						e.Number, s.Number, err)
+				}
+			}
+		}
+
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error saving anime %s: %w", anime.Title, err)
+		}
+		anime.MediaID = &id
+		return nil
+	}
+}
+
+func (ms *Storage) getAnime(ctx context.Context, id uuid.UUID) (*Anime, error) {
+	var anime Anime
+	err := ms.db.GetContext(ctx, &anime, `SELECT media_id, title, format, episode_count, synopsis
+		FROM media.anime WHERE media_id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting anime %s: %w", id, err)
+	}
+	err = ms.db.SelectContext(ctx, &anime.Studios, `SELECT s.id_numeric AS id, s.name
+		FROM media.anime_studios ast
+		JOIN people.studio s ON s.id_numeric = ast.studio
+		WHERE ast.anime = $1
+		ORDER BY s.name`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the studios of anime %s: %w", id, err)
+	}
+	for i := range anime.Studios {
+		anime.Studios[i].Kinds = []studioKind{TV}
+	}
+	err = ms.db.SelectContext(ctx, &anime.Genres, `SELECT g.id, g.name, g.kinds AS kind
+		FROM media.anime_genres ag
+		JOIN media.genres g ON g.id = ag.genre
+		WHERE ag.anime = $1
+		ORDER BY g.name`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the genres of anime %s: %w", id, err)
+	}
+	err = ms.db.SelectContext(ctx, &anime.Seasons, `SELECT "number", title, "year", quarter
+		FROM media.anime_seasons WHERE anime = $1
+		ORDER BY "number"`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the seasons of anime %s: %w", id, err)
+	}
+
+	var episodes []struct {
+		Season uint8 `db:"season"`
+		AnimeEpisode
+	}
+	err = ms.db.SelectContext(ctx, &episodes, `SELECT season, "number", title, air_date
+		FROM media.anime_episodes WHERE anime = $1
+		ORDER BY season, "number"`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the episodes of anime %s: %w", id, err)
+	}
+	seasons := make(map[uint8]*AnimeSeason, len(anime.Seasons))
+	for i := range anime.Seasons {
+		seasons[anime.Seasons[i].Number] = &anime.Seasons[i]
+	}
+	for i := range episodes {
+		if s, ok := seasons[episodes[i].Season]; ok {
+			s.Episodes = append(s.Episodes, episodes[i].AnimeEpisode)
+		}
+	}
+	return &anime, nil
+}
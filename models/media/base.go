@@ -37,6 +37,12 @@ type (
 		Creators []Person      `json:"creators,omitempty"` // no db tag, we're using a junction table
 		Added    time.Time     `json:"added,omitempty" db:"added"`
 		Modified sql.NullTime  `json:"modified,omitempty" db:"modified"`
+		// only approved media are shown, see CanTransition
+		Status string `json:"status,omitempty" db:"status" enum:"pending,approved,rejected,needs-changes"`
+		// the nick of the member submitting the media through the form
+		Submitter string `json:"-" db:"-"`
+		// the original, romanized and localized titles, see PreferredTitle
+		Titles []Title `json:"titles,omitempty" db:"-"`
 	}
 
 	// used in search
@@ -63,7 +69,7 @@ type (
 	// Genre does not have a UUID due to parent-child relationships
 	Genre struct {
 		ID          int64              `json:"id" db:"id,pk,autoinc"`
-		Kinds       pq.StringArray     `json:"kind" db:"kind" enum:"music,film,tv,book,game" example:"music"`
+		Kinds       pq.StringArray     `json:"kind" db:"kind" enum:"music,film,tv,book,game,anime,comic" example:"music"`
 		Name        string             `json:"name" db:"name" example:"Black Metal"`
 		Description []GenreDescription `json:"description,omitempty" db:"-"`
 		//	DescLong    string   `json:"desc_long" db:"desc_long"`
@@ -107,7 +113,8 @@ func (ms *Storage) Get(ctx context.Context, id uuid.UUID) (media Media, err erro
 	case <-ctx.Done():
 		return Media{}, ctx.Err()
 	default:
-		stmt, err := ms.db.PrepareContext(ctx, "SELECT * FROM media.media WHERE id = $1")
+		stmt, err := ms.db.PrepareContext(ctx,
+			"SELECT id, title, kind, created, creator, status FROM media.media WHERE id = $1")
 		if err != nil {
 			ms.Log.Error().Err(err).Msg("error preparing statement")
 			return Media{}, fmt.Errorf("error preparing statement: %v", err)
@@ -116,10 +123,10 @@ func (ms *Storage) Get(ctx context.Context, id uuid.UUID) (media Media, err erro
 
 		row := stmt.QueryRowContext(ctx, id)
 		err = row.Scan(
-			&media.ID, &media.Title, &media.Kind, &media.Created, &media.Creator)
+			&media.ID, &media.Title, &media.Kind, &media.Created, &media.Creator, &media.Status)
 		if err != nil {
 			ms.Log.Error().Err(err).Msg("error scanning row")
-			return Media{}, fmt.Errorf("error scanning row: %v", err)
+			return Media{}, fmt.Errorf("error scanning row: %w", err)
 		}
 		return media, nil
 	}
@@ -277,6 +284,26 @@ func (ms *Storage) GetGenre(ctx context.Context, kind, lang, name string) (genre
 	}
 }
 
+// FindGenres looks up the genres with the given names, ignoring case. Names which don't
+// match any genre are skipped, since the import sources use their own classifications
+func (ms *Storage) FindGenres(ctx context.Context, kind string, names []string) (genres []Genre, err error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		lowered := lo.Map(names, func(name string, _ int) string {
+			return strings.ToLower(strings.TrimSpace(name))
+		})
+		err = ms.db.SelectContext(ctx, &genres, `SELECT id, name, parent FROM media.genres
+		WHERE $1 = ANY(kinds) AND lower(name) = ANY($2)
+		ORDER BY id`, kind, pq.Array(lowered))
+		if err != nil {
+			return nil, fmt.Errorf("error looking up genres: %w", err)
+		}
+		return genres, nil
+	}
+}
+
 func (ms *Storage) GetDetails(
 	ctx context.Context,
 	mediaKind string,
@@ -293,6 +320,12 @@ func (ms *Storage) GetDetails(
 		return ms.getFilm(ctx, id)
 	case "tv_show":
 		return ms.getSeries(ctx, id)
+	case "game":
+		return ms.getGame(ctx, id)
+	case "anime":
+		return ms.getAnime(ctx, id)
+	case "manga", "comic":
+		return ms.getComic(ctx, id)
 	default:
 		return nil, fmt.Errorf("unknown media kind")
 	}
@@ -316,7 +349,7 @@ func (ms *Storage) GetRandom(ctx context.Context, count int, blacklistKinds ...s
 		stmt, err := ms.db.PreparexContext(ctx,
 			`SELECT id, kind
 			FROM media.media 
-			WHERE kind != ALL($1)
+			WHERE kind != ALL($1) AND status = 'approved'
 			ORDER BY RANDOM()
 			LIMIT $2`)
 		if err != nil {
@@ -353,6 +386,7 @@ func (ms *Storage) GetRandom(ctx context.Context, count int, blacklistKinds ...s
 // Add is a generic method that adds an object to the media.media table. It needs to be run
 // BEFORE the object is added to its respective table, since it needs the media ID to be
 // generated first.
+// The media added this way are submissions, so they're pending until a moderator approves them.
 func (ms *Storage) Add(ctx context.Context, props *Media) (mediaID *uuid.UUID, err error) {
 	select {
 	case <-ctx.Done():
@@ -364,9 +398,9 @@ func (ms *Storage) Add(ctx context.Context, props *Media) (mediaID *uuid.UUID, e
 		}
 		stmt, err := ms.db.PreparexContext(ctx, `	
 		INSERT INTO media.media (
-			title, kind, created
+			title, kind, created, status, submitted_by
 		) VALUES (
-			$1, $2, $3
+			$1, $2, $3, $4, (SELECT id_numeric FROM public.members WHERE nick = $5)
 		)
 		RETURNING id
 		`)
@@ -375,7 +409,8 @@ func (ms *Storage) Add(ctx context.Context, props *Media) (mediaID *uuid.UUID, e
 		}
 		defer stmt.Close()
 
-		err = stmt.GetContext(ctx, mediaID, props.Title, props.Kind, props.Created)
+		mediaID = new(uuid.UUID)
+		err = stmt.GetContext(ctx, mediaID, props.Title, props.Kind, props.Created, StatusPending, props.Submitter)
 		if err != nil {
 			return nil, fmt.Errorf("error executing statement: %v", err)
 		}
@@ -392,6 +427,26 @@ func (ms *Storage) Add(ctx context.Context, props *Media) (mediaID *uuid.UUID, e
 	}
 }
 
+// addMediaRow adds the media.media row of an item saved together with its details. Items submitted
+// by members wait for moderation, and the parts of a submission, like the tracks of an album,
+// are moderated with it
+func addMediaRow(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	title, kind, submitter string,
+	partOf uuid.NullUUID,
+) (id uuid.UUID, err error) {
+	if submitter == "" {
+		err = tx.GetContext(ctx, &id, `INSERT INTO media.media (title, kind) VALUES ($1, $2) RETURNING id`, title, kind)
+		return id, err
+	}
+	err = tx.GetContext(ctx, &id, `
+	INSERT INTO media.media (title, kind, status, submitted_by, submitted_with)
+	VALUES ($1, $2, $3, (SELECT id_numeric FROM public.members WHERE nick = $4), $5)
+	RETURNING id`, title, kind, StatusPending, submitter, partOf)
+	return id, err
+}
+
 func (ms *Storage) AddCreators(ctx context.Context, id uuid.UUID, creators []Person) error {
 	select {
 	case <-ctx.Done():
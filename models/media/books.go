@@ -28,6 +28,10 @@ type (
 		ASIN            sql.NullString `json:"asin,omitempty" db:"asin,unique,omitempty"`
 		Cover           sql.NullString `json:"cover,omitempty" db:"cover,omitempty"`
 		Summary         string         `json:"summary" db:"summary"`
+		// e.g. "2nd edition" or "Polish translation"
+		Edition string `json:"edition,omitempty" db:"edition"`
+		// the work the book is an edition of
+		Work *uuid.UUID `json:"work,omitempty" db:"work"`
 	}
 
 	BookValues interface {
@@ -60,10 +64,12 @@ func (ms *Storage) getBook(ctx context.Context, id uuid.UUID) (*Book, error) {
 	return &book, nil
 }
 
+// AddBook adds the book submitted by the member to the moderation queue
 func (ms *Storage) AddBook(
 	ctx context.Context,
 	book *Book,
 	publisher *Studio,
+	submitter string,
 ) error {
 	select {
 	case <-ctx.Done():
@@ -78,17 +84,17 @@ func (ms *Storage) AddBook(
 			return fmt.Errorf("error getting publisher ID: %w", err)
 		}
 
-		mediaID, err := ms.addBookAsMedia(ctx, book)
+		mediaID, err := ms.addBookAsMedia(ctx, book, submitter)
 		if err != nil {
 			return err
 		}
 
 		_, err = ms.db.NamedExecContext(ctx, `
 		INSERT INTO media.books (
-		title, publisher, publication_date,
+		title, edition, publisher, publication_date,
 		keywords, pages, isbn, asin, cover, summary
 		) VALUES (
-		:title, :publisher, :publication_date,
+		:title, :edition, :publisher, :publication_date,
 		:keywords, :pages, :isbn, :asin, :cover, :summary
 		`, book)
 		if err != nil {
@@ -111,7 +117,7 @@ func (ms *Storage) AddBook(
 	}
 }
 
-func (ms *Storage) addBookAsMedia(ctx context.Context, book *Book) (mediaID *uuid.UUID, err error) {
+func (ms *Storage) addBookAsMedia(ctx context.Context, book *Book, submitter string) (mediaID *uuid.UUID, err error) {
 	var created time.Time
 	if book.PublicationDate.Valid {
 		created = book.PublicationDate.Time
@@ -120,10 +126,11 @@ func (ms *Storage) addBookAsMedia(ctx context.Context, book *Book) (mediaID *uui
 	}
 
 	media := Media{
-		Title:    book.Title,
-		Kind:     "book",
-		Created:  created,
-		Creators: book.Authors,
+		Title:     book.Title,
+		Kind:      "book",
+		Created:   created,
+		Creators:  book.Authors,
+		Submitter: submitter,
 	}
 
 	mediaID, err = ms.Add(ctx, &media)
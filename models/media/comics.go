@@ -0,0 +1,304 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+// The roles of the people who made a manga or comic
+const (
+	// writes the story
+	ComicAuthor = "author"
+	// draws it
+	ComicArtist = "artist"
+)
+
+// The publication states of manga and comics
+const (
+	ComicOngoing   = "ongoing"
+	ComicCompleted = "completed"
+	ComicHiatus    = "hiatus"
+	ComicCancelled = "cancelled"
+)
+
+type (
+	// Comic is a manga or a comic. Both are usually serialized in magazines first and then
+	// collected in volumes, so they're stored together and told apart by the kind
+	Comic struct {
+		MediaID *uuid.UUID `json:"media_id" db:"media_id,pk,unique"`
+		Kind    string     `json:"kind" db:"kind" enum:"manga,comic" example:"manga"`
+		Title   string     `json:"title" db:"title" example:"Akira"`
+		Status  string     `json:"status" db:"status" enum:"ongoing,completed,hiatus,cancelled" example:"completed"`
+		// the publisher of the collected volumes
+		Publisher *Studio `json:"publisher,omitempty" db:"-"`
+		Synopsis  *string `json:"synopsis,omitempty" db:"synopsis"`
+		// the writers of the story
+		Authors []Person `json:"authors,omitempty" db:"-"`
+		// the people drawing it, who are often the authors too
+		Artists        []Person        `json:"artists,omitempty" db:"-"`
+		Serializations []Serialization `json:"serializations,omitempty" db:"-"`
+		Volumes        []ComicVolume   `json:"volumes,omitempty" db:"-"`
+		// the chapters which haven't been collected in a volume yet
+		Chapters []ComicChapter `json:"chapters,omitempty" db:"-"`
+		Genres   []Genre        `json:"genres,omitempty" db:"-"`
+	}
+
+	// Serialization is a run of a manga or comic in a magazine
+	Serialization struct {
+		MagazineID int32      `json:"magazine_id,omitempty" db:"magazine_id"`
+		Magazine   string     `json:"magazine" db:"magazine" example:"Weekly Young Magazine"`
+		Started    *time.Time `json:"started,omitempty" db:"started"`
+		Ended      *time.Time `json:"ended,omitempty" db:"ended"`
+	}
+
+	// ComicVolume is a collected volume (tankōbon or trade paperback)
+	ComicVolume struct {
+		Number      uint16         `json:"number" db:"number"`
+		Title       string         `json:"title,omitempty" db:"title"`
+		ReleaseDate *time.Time     `json:"release_date,omitempty" db:"release_date"`
+		ISBN        *string        `json:"isbn,omitempty" db:"isbn" example:"978-1-935429-00-2"`
+		Chapters    []ComicChapter `json:"chapters,omitempty" db:"-"`
+	}
+
+	// ComicChapter is a chapter of a manga or an issue of a comic. The numbers are unique
+	// within the manga or comic, not the volume
+	ComicChapter struct {
+		Number      uint16     `json:"number" db:"number"`
+		Title       string     `json:"title,omitempty" db:"title"`
+		ReleaseDate *time.Time `json:"release_date,omitempty" db:"release_date"`
+	}
+)
+
+// IsComicKind checks if the media kind is stored as a Comic
+func IsComicKind(kind string) bool {
+	return kind == "manga" || kind == "comic"
+}
+
+// ValidComicStatus checks if the status is one of the publication states
+func ValidComicStatus(status string) bool {
+	switch status {
+	case ComicOngoing, ComicCompleted, ComicHiatus, ComicCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// AddComic adds the manga or comic submitted by the member to the moderation queue, along with its
+// volumes and chapters. The people, publisher and magazines are matched by their names and added if they're new
+func (ms *Storage) AddComic(ctx context.Context, comic *Comic, submitter string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if !IsComicKind(comic.Kind) {
+			return fmt.Errorf("%w %s", ErrUnknownTarget, comic.Kind)
+		}
+		for _, people := range [][]Person{comic.Authors, comic.Artists} {
+			for i := range people {
+				if people[i].ID != uuid.Nil {
+					continue
+				}
+				artist, err := ms.Ps.ResolveArtist(ctx, people[i].Name, false)
+				if err != nil {
+					return fmt.Errorf("error resolving person %s: %w", people[i].Name, err)
+				}
+				people[i].ID = artist.ID
+			}
+		}
+		publisher := sql.NullInt32{}
+		if comic.Publisher != nil {
+			if comic.Publisher.ID == 0 {
+				studio, err := ms.Ps.ResolveStudio(ctx, comic.Publisher.Name, Publishing)
+				if err != nil {
+					return fmt.Errorf("error resolving publisher %s: %w", comic.Publisher.Name, err)
+				}
+				comic.Publisher = studio
+			}
+			publisher = sql.NullInt32{Int32: comic.Publisher.ID, Valid: true}
+		}
+
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		id, err := addMediaRow(ctx, tx, comic.Title, comic.Kind, submitter, uuid.NullUUID{})
+		if err != nil {
+			return fmt.Errorf("error adding %s %s: %w", comic.Kind, comic.Title, err)
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO media.comics (media_id, title, status, publisher, synopsis)
+			VALUES ($1, $2, $3, $4, $5)`, id, comic.Title, comic.Status, publisher, comic.Synopsis)
+		if err != nil {
+			return fmt.Errorf("failed to insert %s into media.comics: %w", comic.Kind, err)
+		}
+
+		for role, people := range map[string][]Person{ComicAuthor: comic.Authors, ComicArtist: comic.Artists} {
+			for i := range people {
+				_, err = tx.ExecContext(ctx, `INSERT INTO media.comic_creators (comic, person, "role")
+					VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`, id, people[i].ID, role)
+				if err != nil {
+					return fmt.Errorf("failed to insert %s into media.comic_creators: %w", role, err)
+				}
+			}
+		}
+		for i := range comic.Genres {
+			_, err = tx.ExecContext(ctx, `INSERT INTO media.comic_genres (comic, genre)
+				VALUES ($1, $2) ON CONFLICT DO NOTHING`, id, comic.Genres[i].ID)
+			if err != nil {
+				return fmt.Errorf("failed to insert genre into media.comic_genres: %w", err)
+			}
+		}
+		for i := range comic.Serializations {
+			s := &comic.Serializations[i]
+			err = tx.GetContext(ctx, &s.MagazineID, `INSERT INTO media.magazines (name) VALUES ($1)
+				ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+				RETURNING id`, strings.TrimSpace(s.Magazine))
+			if err != nil {
+				return fmt.Errorf("failed to insert magazine %s: %w", s.Magazine, err)
+			}
+			_, err = tx.ExecContext(ctx, `INSERT INTO media.comic_serializations (comic, magazine, started, ended)
+				VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`, id, s.MagazineID, s.Started, s.Ended)
+			if err != nil {
+				return fmt.Errorf("failed to insert serialization into media.comic_serializations: %w", err)
+			}
+		}
+		for i := range comic.Volumes {
+			v := &comic.Volumes[i]
+			_, err = tx.ExecContext(ctx, `INSERT INTO media.comic_volumes (comic, "number", title, release_date, isbn)
+				VALUES ($1, $2, $3, $4, $5)`, id, v.Number, v.Title, v.ReleaseDate, v.ISBN)
+			if err != nil {
+				return fmt.Errorf("failed to insert volume %d into media.comic_volumes: %w", v.Number, err)
+			}
+			if err = addChapters(ctx, tx, id, sql.NullInt16{Int16: int16(v.Number), Valid: true}, v.Chapters); err != nil {
+				return err
+			}
+		}
+		if err = addChapters(ctx, tx, id, sql.NullInt16{}, comic.Chapters); err != nil {
+			return err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error saving %s %s: %w", comic.Kind, comic.Title, err)
+		}
+		comic.MediaID = &id
+		return nil
+	}
+}
+
+func addChapters(ctx context.Context, tx sqlx.ExecerContext, comicID uuid.UUID, volume sql.NullInt16, chapters []ComicChapter) error {
+	for i := range chapters {
+		_, err := tx.ExecContext(ctx, `INSERT INTO media.comic_chapters (comic, "number", volume, title, release_date)
+			VALUES ($1, $2, $3, $4, $5)`, comicID, chapters[i].Number, volume, chapters[i].Title, chapters[i].ReleaseDate)
+		if err != nil {
+			return fmt.Errorf("failed to insert chapter %d into media.comic_chapters: %w", chapters[i].Number, err)
+		}
+	}
+	return nil
+}
+
+func (ms *Storage) getComic(ctx context.Context, id uuid.UUID) (*Comic, error) {
+	var (
+		comic     Comic
+		publisher struct {
+			ID   sql.NullInt32  `db:"publisher"`
+			Name sql.NullString `db:"publisher_name"`
+		}
+	)
+	row := ms.db.QueryRowxContext(ctx, `SELECT c.media_id, m.kind, c.title, c.status, c.synopsis,
+		c.publisher, s.name AS publisher_name
+		FROM media.comics c
+		JOIN media.media m ON m.id = c.media_id
+		LEFT JOIN people.studio s ON s.id_numeric = c.publisher
+		WHERE c.media_id = $1`, id)
+	err := row.Scan(&comic.MediaID, &comic.Kind, &comic.Title, &comic.Status, &comic.Synopsis,
+		&publisher.ID, &publisher.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error getting comic %s: %w", id, err)
+	}
+	if publisher.ID.Valid {
+		comic.Publisher = &Studio{ID: publisher.ID.Int32, Name: publisher.Name.String, Kinds: []studioKind{Publishing}}
+	}
+
+	rows, err := ms.db.QueryxContext(ctx, `SELECT cc."role", p.id, p.first_name, p.last_name
+		FROM media.comic_creators cc
+		JOIN people.person p ON p.id = cc.person
+		WHERE cc.comic = $1
+		ORDER BY p.last_name, p.first_name`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the creators of comic %s: %w", id, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			role   string
+			person Person
+		)
+		if err = rows.Scan(&role, &person.ID, &person.FirstName, &person.LastName); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		person.Name = strings.TrimSpace(person.FirstName + " " + person.LastName)
+		if role == ComicArtist {
+			comic.Artists = append(comic.Artists, person)
+		} else {
+			comic.Authors = append(comic.Authors, person)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting the creators of comic %s: %w", id, err)
+	}
+
+	err = ms.db.SelectContext(ctx, &comic.Genres, `SELECT g.id, g.name, g.kinds AS kind
+		FROM media.comic_genres cg
+		JOIN media.genres g ON g.id = cg.genre
+		WHERE cg.comic = $1
+		ORDER BY g.name`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the genres of comic %s: %w", id, err)
+	}
+	err = ms.db.SelectContext(ctx, &comic.Serializations, `SELECT m.id AS magazine_id, m.name AS magazine,
+		cs.started, cs.ended
+		FROM media.comic_serializations cs
+		JOIN media.magazines m ON m.id = cs.magazine
+		WHERE cs.comic = $1
+		ORDER BY cs.started NULLS LAST, m.name`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the serializations of comic %s: %w", id, err)
+	}
+	err = ms.db.SelectContext(ctx, &comic.Volumes, `SELECT "number", title, release_date, isbn
+		FROM media.comic_volumes WHERE comic = $1
+		ORDER BY "number"`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the volumes of comic %s: %w", id, err)
+	}
+
+	var chapters []struct {
+		Volume sql.NullInt16 `db:"volume"`
+		ComicChapter
+	}
+	err = ms.db.SelectContext(ctx, &chapters, `SELECT volume, "number", title, release_date
+		FROM media.comic_chapters WHERE comic = $1
+		ORDER BY "number"`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the chapters of comic %s: %w", id, err)
+	}
+	volumes := make(map[int16]*ComicVolume, len(comic.Volumes))
+	for i := range comic.Volumes {
+		volumes[int16(comic.Volumes[i].Number)] = &comic.Volumes[i]
+	}
+	for i := range chapters {
+		if v, ok := volumes[chapters[i].Volume.Int16]; ok && chapters[i].Volume.Valid {
+			v.Chapters = append(v.Chapters, chapters[i].ComicChapter)
+		} else {
+			comic.Chapters = append(comic.Chapters, chapters[i].ComicChapter)
+		}
+	}
+	return &comic, nil
+}
@@ -0,0 +1,747 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// The kinds of rows checked for duplicates
+const (
+	DuplicatePerson = "person"
+	DuplicateGroup  = "group"
+	DuplicateStudio = "studio"
+	DuplicateMedia  = "media"
+)
+
+// The states of a duplicate candidate other than StatusPending
+const (
+	DuplicateMerged    = "merged"
+	DuplicateDismissed = "dismissed"
+)
+
+// DuplicateThreshold is the lowest score of the pairs kept as duplicate candidates
+const DuplicateThreshold = 0.6
+
+var (
+	// ErrResolved is returned when a candidate was already merged or dismissed
+	ErrResolved = errors.New("the duplicate candidate was already resolved")
+	// ErrUnmergeable is returned when the rows can't be merged, e.g. media of different kinds
+	ErrUnmergeable = errors.New("the rows cannot be merged")
+)
+
+type (
+	// DuplicateCandidate is a pair of rows which likely describe the same person, group, studio or media
+	DuplicateCandidate struct {
+		ID     int64  `json:"id" db:"id"`
+		Target string `json:"target" db:"target" enum:"person,group,studio,media" example:"person"`
+		// the suggested survivor of the merge, usually the older row
+		FirstID    string         `json:"first_id" db:"first_id" example:"2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21"`
+		FirstName  string         `json:"first_name" db:"first_name" example:"Aphex Twin"`
+		SecondID   string         `json:"second_id" db:"second_id" example:"2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d22"`
+		SecondName string         `json:"second_name" db:"second_name" example:"Aphex  Twin"`
+		Score      float64        `json:"score" db:"score" example:"0.85"`
+		Reasons    pq.StringArray `json:"reasons" db:"reasons" swaggertype:"array,string" example:"same name"`
+		Status     string         `json:"status" db:"status" enum:"pending,merged,dismissed"`
+		Found      time.Time      `json:"found" db:"found"`
+		ResolvedBy sql.NullString `json:"resolved_by,omitempty" db:"resolved_by" swaggertype:"string"`
+		Resolved   sql.NullTime   `json:"resolved,omitempty" db:"resolved" swaggertype:"string"`
+	}
+
+	// duplicatePair is a pair of rows with similar names, as found by the scan
+	duplicatePair struct {
+		FirstID    string         `db:"first_id"`
+		SecondID   string         `db:"second_id"`
+		FirstName  string         `db:"first_name"`
+		SecondName string         `db:"second_name"`
+		Similarity float64        `db:"similarity"`
+		FirstDate  sql.NullTime   `db:"first_date"`
+		SecondDate sql.NullTime   `db:"second_date"`
+		FirstExt   sql.NullString `db:"first_ext"`
+		SecondExt  sql.NullString `db:"second_ext"`
+	}
+
+	// reference is a column pointing at a merged row. The rows which would duplicate a row of
+	// the survivor, i.e. have the same peers, are dropped instead of being repointed
+	reference struct {
+		table, column string
+		peers         []string
+		// optional, for the columns shared by several kinds of rows, e.g. the artists of an album
+		kindColumn, kind string
+	}
+)
+
+// duplicatePairs pair the rows with similar names. The first row is always the older one,
+// since the IDs are sequential
+var duplicatePairs = map[string]string{
+	DuplicatePerson: `SELECT a.id::text AS first_id, b.id::text AS second_id,
+		a.first_name || ' ' || a.last_name AS first_name, b.first_name || ' ' || b.last_name AS second_name,
+		similarity(lower(a.first_name || ' ' || a.last_name), lower(b.first_name || ' ' || b.last_name)) AS similarity,
+		a.birth AS first_date, b.birth AS second_date, a.mbid::text AS first_ext, b.mbid::text AS second_ext
+	FROM people.person a
+	JOIN people.person b ON a.id < b.id
+		AND lower(a.first_name || ' ' || a.last_name) % lower(b.first_name || ' ' || b.last_name)`,
+	DuplicateGroup: `SELECT a.id::text AS first_id, b.id::text AS second_id,
+		a.name AS first_name, b.name AS second_name, similarity(lower(a.name), lower(b.name)) AS similarity,
+		a.formed AS first_date, b.formed AS second_date, a.mbid::text AS first_ext, b.mbid::text AS second_ext
+	FROM people."group" a
+	JOIN people."group" b ON a.id < b.id AND lower(a.name) % lower(b.name)`,
+	DuplicateStudio: `SELECT a.id_numeric::text AS first_id, b.id_numeric::text AS second_id,
+		a.name AS first_name, b.name AS second_name, similarity(lower(a.name), lower(b.name)) AS similarity,
+		NULL::date AS first_date, NULL::date AS second_date, NULL AS first_ext, NULL AS second_ext
+	FROM people.studio a
+	JOIN people.studio b ON a.id_numeric < b.id_numeric AND a.kind = b.kind AND lower(a.name) % lower(b.name)`,
+	// tracks, seasons and episodes share their titles with the parts of other media all the time
+	DuplicateMedia: `SELECT a.id::text AS first_id, b.id::text AS second_id,
+		a.title AS first_name, b.title AS second_name, similarity(lower(a.title), lower(b.title)) AS similarity,
+		COALESCE(aa.release_date, af.release_date, ab.publication_date) AS first_date,
+		COALESCE(ba.release_date, bf.release_date, bb.publication_date) AS second_date,
+		aa.mbid::text AS first_ext, ba.mbid::text AS second_ext
+	FROM media.media a
+	JOIN media.media b ON a.id < b.id AND a.kind = b.kind AND lower(a.title) % lower(b.title)
+	LEFT JOIN media.albums aa ON aa.media_id = a.id
+	LEFT JOIN media.films af ON af.media_id = a.id
+	LEFT JOIN media.books ab ON ab.media_id = a.id
+	LEFT JOIN media.albums ba ON ba.media_id = b.id
+	LEFT JOIN media.films bf ON bf.media_id = b.id
+	LEFT JOIN media.books bb ON bb.media_id = b.id
+	WHERE a.kind NOT IN ('track', 'season', 'episode')
+		AND a.status <> 'rejected' AND b.status <> 'rejected'`,
+}
+
+// the rows pointing at people, groups, studios and media, which are moved to the survivor of a merge
+var references = map[string][]reference{
+	DuplicatePerson: {
+		{table: "media.album_artists", column: "artist", peers: []string{"album"}, kindColumn: "artist_type", kind: "individual"},
+		{table: "media.track_artists", column: "artist", peers: []string{"track"}},
+		{table: "media.book_authors", column: "person", peers: []string{"book"}},
+		{table: "media.comic_creators", column: "person", peers: []string{"comic", `"role"`}},
+		{table: "media.media_creators", column: "creator_id", peers: []string{"media_id"}},
+		{table: "media.tv_show_cast", column: "person", peers: []string{"tv_show"}},
+		{table: "people.actor_cast", column: "person_id", peers: []string{"cast_id"}},
+		{table: "people.director_cast", column: "person_id", peers: []string{"cast_id"}},
+		{table: "people.person_photos", column: "person_id", peers: []string{"image_id"}},
+		{table: "people.person_works", column: "person_id", peers: []string{"media_id"}},
+		{table: "people.group_members", column: "person_id", peers: []string{"group_id"}},
+		{table: "people.studio_artists", column: "person_id", peers: []string{"studio_id"}},
+		{table: "contributors.person", column: "person_id", peers: []string{"contributor"}},
+	},
+	DuplicateGroup: {
+		{table: "media.album_artists", column: "artist", peers: []string{"album"}, kindColumn: "artist_type", kind: "group"},
+		{table: "people.group_locations", column: "group_id", peers: []string{"location_id"}},
+		{table: "people.group_photos", column: "group_id", peers: []string{"image_id"}},
+		{table: "people.group_members", column: "group_id", peers: []string{"person_id"}},
+		{table: "people.group_genres", column: "group_id", peers: []string{"primary_genre_id"}},
+		{table: "people.group_works", column: "group_id", peers: []string{"media_id"}},
+		{table: "contributors.group", column: "group_id", peers: []string{"contributor"}},
+	},
+	DuplicateStudio: {
+		{table: "media.books", column: "publisher"},
+		{table: "media.game_studios", column: "studio", peers: []string{"game", `"role"`}},
+		{table: "media.anime_studios", column: "studio", peers: []string{"anime"}},
+		{table: "media.comics", column: "publisher"},
+		{table: "people.studio_artists", column: "studio_id", peers: []string{"person_id"}},
+		{table: "people.studio_works", column: "studio_id", peers: []string{"media_id"}},
+		{table: "contributors.studio", column: "studio_id", peers: []string{"contributor"}},
+	},
+	DuplicateMedia: {
+		// a member who rated both keeps the rating of the survivor
+		{table: "reviews.ratings", column: "media_id", peers: []string{"user_id"}},
+		{table: "reviews.rating_placeholders", column: "media_id", peers: []string{"member_id"}},
+		{table: "media.media_images", column: "media_id", peers: []string{"image_id"}},
+		{table: "media.media_creators", column: "media_id", peers: []string{"creator_id"}},
+		{table: "media.titles", column: "media_id", peers: []string{"kind", `"language"`}},
+		{table: "media.album_artists", column: "album", peers: []string{"artist", "artist_type"}},
+		{table: "media.album_keywords", column: "album", peers: []string{"keyword_id"}},
+		{table: "media.album_genres", column: "album", peers: []string{"genre"}},
+		{table: "media.album_langs", column: "album", peers: []string{"lang"}},
+		{table: "media.track_artists", column: "track", peers: []string{"artist"}},
+		{table: "media.track_langs", column: "track", peers: []string{"lang"}},
+		{table: "media.book_authors", column: "book", peers: []string{"person"}},
+		{table: "media.book_genres", column: "book", peers: []string{"genre"}},
+		{table: "media.book_languages", column: "book", peers: []string{"lang"}},
+		{table: "media.game_platforms", column: "game", peers: []string{"platform"}},
+		{table: "media.game_franchises", column: "game", peers: []string{"franchise"}},
+		{table: "media.game_genres", column: "game", peers: []string{"genre"}},
+		{table: "media.game_studios", column: "game", peers: []string{"studio", `"role"`}},
+		{table: "media.anime_studios", column: "anime", peers: []string{"studio"}},
+		{table: "media.anime_genres", column: "anime", peers: []string{"genre"}},
+		// the episodes and chapters go first, so that the seasons and volumes they belong to are still there
+		{table: "media.anime_episodes", column: "anime", peers: []string{"season", `"number"`}},
+		{table: "media.anime_seasons", column: "anime", peers: []string{`"number"`}},
+		{table: "media.comic_creators", column: "comic", peers: []string{"person", `"role"`}},
+		{table: "media.comic_genres", column: "comic", peers: []string{"genre"}},
+		{table: "media.comic_serializations", column: "comic", peers: []string{"magazine"}},
+		{table: "media.comic_chapters", column: "comic", peers: []string{`"number"`}},
+		{table: "media.comic_volumes", column: "comic", peers: []string{`"number"`}},
+		{table: "people.person_works", column: "media_id", peers: []string{"person_id"}},
+		{table: "people.group_works", column: "media_id", peers: []string{"group_id"}},
+		{table: "people.studio_works", column: "media_id", peers: []string{"studio_id"}},
+		{table: "contributors.media", column: "media_id", peers: []string{"contributor"}},
+	},
+}
+
+// the tables holding the details of each kind of media
+var detailTables = map[string]string{
+	"album":   "media.albums",
+	"track":   "media.tracks",
+	"film":    "media.films",
+	"book":    "media.books",
+	"tv_show": "media.tv_shows",
+	"game":    "media.games",
+	"anime":   "media.anime",
+	"manga":   "media.comics",
+	"comic":   "media.comics",
+}
+
+// NormalizeName prepares a name for comparison, by lowercasing it, stripping the diacritics,
+// punctuation and the leading article and squeezing the whitespace
+func NormalizeName(name string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	stripped, _, err := transform.String(t, name)
+	if err != nil {
+		stripped = name
+	}
+	stripped = strings.ReplaceAll(strings.ToLower(stripped), "&", " and ")
+	words := strings.FieldsFunc(stripped, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// scoreDuplicate tells how likely the pair is to describe the same thing, from 0 to 1, and why.
+// Different external IDs, e.g. MBIDs, mean they're different things with the same name
+func scoreDuplicate(p *duplicatePair) (score float64, reasons []string) {
+	if p.FirstExt.Valid && p.SecondExt.Valid {
+		if p.FirstExt.String == p.SecondExt.String {
+			return 1, []string{"same external ID"}
+		}
+		return 0, nil
+	}
+
+	if NormalizeName(p.FirstName) == NormalizeName(p.SecondName) {
+		score, reasons = 0.7, append(reasons, "same name")
+	} else {
+		score, reasons = 0.6*p.Similarity, append(reasons, "similar name")
+	}
+	if p.FirstDate.Valid && p.SecondDate.Valid {
+		first, second := p.FirstDate.Time, p.SecondDate.Time
+		switch {
+		case first.Format(time.DateOnly) == second.Format(time.DateOnly):
+			score, reasons = score+0.3, append(reasons, "same date")
+		case first.Year() == second.Year():
+			score, reasons = score+0.15, append(reasons, "same year")
+		default:
+			score -= 0.3
+		}
+	}
+	return min(max(score, 0), 1), reasons
+}
+
+// ScanDuplicates looks for the people, groups, studios and media which were likely added
+// more than once and saves them as duplicate candidates. The scores of the pending
+// candidates are refreshed, while the resolved ones are left alone
+func (ms *Storage) ScanDuplicates(ctx context.Context) (found int, err error) {
+	for _, target := range []string{DuplicatePerson, DuplicateGroup, DuplicateStudio, DuplicateMedia} {
+		select {
+		case <-ctx.Done():
+			return found, ctx.Err()
+		default:
+		}
+		var pairs []duplicatePair
+		if err = ms.db.SelectContext(ctx, &pairs, duplicatePairs[target]); err != nil {
+			return found, fmt.Errorf("error pairing similar %s rows: %w", target, err)
+		}
+		for i := range pairs {
+			score, reasons := scoreDuplicate(&pairs[i])
+			if score < DuplicateThreshold {
+				continue
+			}
+			_, err = ms.db.ExecContext(ctx, `INSERT INTO media.duplicate_candidates
+				(target, first_id, second_id, score, reasons)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (target, first_id, second_id) DO UPDATE
+				SET score = EXCLUDED.score, reasons = EXCLUDED.reasons
+				WHERE media.duplicate_candidates.status = $6`,
+				target, pairs[i].FirstID, pairs[i].SecondID, score, pq.StringArray(reasons), StatusPending)
+			if err != nil {
+				return found, fmt.Errorf("error saving duplicate candidate: %w", err)
+			}
+			found++
+		}
+	}
+	return found, nil
+}
+
+// candidateName looks up the name of the row a candidate points at
+func candidateName(column string) string {
+	return `CASE c.target
+		WHEN 'person' THEN (SELECT first_name || ' ' || last_name FROM people.person WHERE id = c.` + column + `::uuid)
+		WHEN 'group' THEN (SELECT name FROM people."group" WHERE id = c.` + column + `::uuid)
+		WHEN 'studio' THEN (SELECT name FROM people.studio WHERE id_numeric = c.` + column + `::int4)
+		ELSE (SELECT title FROM media.media WHERE id = c.` + column + `::uuid)
+	END`
+}
+
+// DuplicateCandidates lists the candidates with the given status, most likely duplicates first.
+// An empty target lists the candidates of every kind
+func (ms *Storage) DuplicateCandidates(ctx context.Context, target, status string, limit, offset int) ([]DuplicateCandidate, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		candidates := make([]DuplicateCandidate, 0)
+		err := ms.db.SelectContext(ctx, &candidates, `SELECT c.id, c.target, c.first_id, c.second_id,
+			c.score, c.reasons, c.status, c.found, c.resolved_by, c.resolved,
+			COALESCE(`+candidateName("first_id")+`, '') AS first_name,
+			COALESCE(`+candidateName("second_id")+`, '') AS second_name
+		FROM media.duplicate_candidates c
+		WHERE c.status = $1 AND ($2 = '' OR c.target = $2)
+		ORDER BY c.score DESC, c.id
+		LIMIT $3 OFFSET $4`, status, target, limit, offset)
+		if err != nil {
+			return nil, fmt.Errorf("error listing duplicate candidates: %w", err)
+		}
+		return candidates, nil
+	}
+}
+
+// DismissDuplicate marks the candidate as not being a duplicate, so that it's not suggested again
+func (ms *Storage) DismissDuplicate(ctx context.Context, id int64, moderator string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		var status string
+		err := ms.db.GetContext(ctx, &status, `UPDATE media.duplicate_candidates
+			SET status = CASE WHEN status = $2 THEN $3 ELSE status END,
+				resolved_by = CASE WHEN status = $2 THEN $4 ELSE resolved_by END,
+				resolved = CASE WHEN status = $2 THEN now() ELSE resolved END
+			WHERE id = $1
+			RETURNING status`, id, StatusPending, DuplicateDismissed, moderator)
+		if err != nil {
+			return fmt.Errorf("error dismissing duplicate candidate %d: %w", id, err)
+		}
+		if status != DuplicateDismissed {
+			return ErrResolved
+		}
+		return nil
+	}
+}
+
+// MergeDuplicate merges the rows of the candidate into the one with the given ID, which has to be
+// one of the pair. If keepID is empty, the first row survives
+func (ms *Storage) MergeDuplicate(ctx context.Context, id int64, keepID, moderator string) (*DuplicateCandidate, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		var c DuplicateCandidate
+		err = tx.GetContext(ctx, &c, `SELECT id, target, first_id, second_id, score, reasons, status, found
+			FROM media.duplicate_candidates WHERE id = $1 FOR UPDATE`, id)
+		if err != nil {
+			return nil, fmt.Errorf("error getting duplicate candidate %d: %w", id, err)
+		}
+		if c.Status != StatusPending {
+			return nil, ErrResolved
+		}
+		keep, duplicate := c.FirstID, c.SecondID
+		switch keepID {
+		case "", c.FirstID:
+		case c.SecondID:
+			keep, duplicate = c.SecondID, c.FirstID
+		default:
+			return nil, fmt.Errorf("%w %q: not one of the duplicates", ErrInvalidKey, keepID)
+		}
+
+		if err = ms.merge(ctx, tx, c.Target, keep, duplicate, moderator); err != nil {
+			return nil, err
+		}
+		err = tx.GetContext(ctx, &c, `UPDATE media.duplicate_candidates
+			SET status = $2, resolved_by = $3, resolved = now()
+			WHERE id = $1
+			RETURNING id, target, first_id, second_id, score, reasons, status, found, resolved_by, resolved`,
+			id, DuplicateMerged, moderator)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving duplicate candidate %d: %w", id, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, fmt.Errorf("error committing the merge: %w", err)
+		}
+		return &c, nil
+	}
+}
+
+// Merge moves everything pointing at the duplicate to the row which is kept, deletes
+// the duplicate and leaves a redirect from its ID
+func (ms *Storage) Merge(ctx context.Context, target, keepID, duplicateID, moderator string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		if err = ms.merge(ctx, tx, target, keepID, duplicateID, moderator); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error committing the merge: %w", err)
+		}
+		return nil
+	}
+}
+
+// Redirect returns the ID of the row the given one was merged into, or sql.ErrNoRows
+func (ms *Storage) Redirect(ctx context.Context, target, id string) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+		var to string
+		err := ms.db.GetContext(ctx, &to, `SELECT to_id FROM media.redirects WHERE target = $1 AND from_id = $2`,
+			target, id)
+		if err != nil {
+			return "", fmt.Errorf("error getting the redirect of %s %s: %w", target, id, err)
+		}
+		return to, nil
+	}
+}
+
+// mergeStatements builds the statements moving the references to the survivor ($1) from the duplicate ($2).
+// What's left after the update would duplicate the rows of the survivor and is deleted
+func mergeStatements(ref reference) (update, remove string) {
+	filter := ""
+	if ref.kindColumn != "" {
+		filter = fmt.Sprintf(" AND t.%s = '%s'", ref.kindColumn, ref.kind)
+	}
+	update = fmt.Sprintf(`UPDATE %s AS t SET %s = $1 WHERE t.%s = $2%s`, ref.table, ref.column, ref.column, filter)
+	if len(ref.peers) > 0 {
+		same := make([]string, 0, len(ref.peers)+1)
+		if ref.kindColumn != "" {
+			same = append(same, fmt.Sprintf("k.%s = t.%s", ref.kindColumn, ref.kindColumn))
+		}
+		for _, peer := range ref.peers {
+			same = append(same, fmt.Sprintf("k.%s = t.%s", peer, peer))
+		}
+		update += fmt.Sprintf(` AND NOT EXISTS (SELECT 1 FROM %s AS k WHERE k.%s = $1 AND %s)`,
+			ref.table, ref.column, strings.Join(same, " AND "))
+	}
+	remove = fmt.Sprintf(`DELETE FROM %s AS t WHERE t.%s = $2%s`, ref.table, ref.column, filter)
+	return update, remove
+}
+
+// mergeKeys parses the IDs of the merged rows, which are numeric for studios and UUIDs otherwise
+func mergeKeys(target, keepID, duplicateID string) (keep, duplicate any, err error) {
+	if _, ok := references[target]; !ok {
+		return nil, nil, fmt.Errorf("%w: merging %s is not supported", ErrUnknownTarget, target)
+	}
+	if keepID == duplicateID {
+		return nil, nil, fmt.Errorf("%w: %s cannot be merged into itself", ErrUnmergeable, keepID)
+	}
+	parse := func(id string) (any, error) {
+		if target == DuplicateStudio {
+			n, err := strconv.ParseInt(id, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%w %q: %v", ErrInvalidKey, id, err)
+			}
+			return int32(n), nil
+		}
+		u, err := uuid.FromString(id)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %v", ErrInvalidKey, id, err)
+		}
+		return u, nil
+	}
+	if keep, err = parse(keepID); err != nil {
+		return nil, nil, err
+	}
+	if duplicate, err = parse(duplicateID); err != nil {
+		return nil, nil, err
+	}
+	return keep, duplicate, nil
+}
+
+func (ms *Storage) merge(ctx context.Context, tx *sqlx.Tx, target, keepID, duplicateID, moderator string) error {
+	keep, duplicate, err := mergeKeys(target, keepID, duplicateID)
+	if err != nil {
+		return err
+	}
+
+	var remove string
+	switch target {
+	case DuplicateMedia:
+		return ms.mergeMedia(ctx, tx, keep.(uuid.UUID), duplicate.(uuid.UUID), moderator)
+	case DuplicatePerson:
+		err, remove = mergePerson(ctx, tx, keep, duplicate), `DELETE FROM people.person WHERE id = $1`
+	case DuplicateGroup:
+		err, remove = mergeGroup(ctx, tx, keep, duplicate), `DELETE FROM people."group" WHERE id = $1`
+	case DuplicateStudio:
+		err = lockPair(ctx, tx, `SELECT kind::text FROM people.studio WHERE id_numeric = $1 FOR UPDATE`, keep, duplicate)
+		remove = `DELETE FROM people.studio WHERE id_numeric = $1`
+	}
+	if err != nil {
+		return err
+	}
+	if err = repoint(ctx, tx, target, keep, duplicate); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, remove, duplicate); err != nil {
+		return fmt.Errorf("error deleting %s %s: %w", target, duplicateID, err)
+	}
+	return redirect(ctx, tx, target, keepID, duplicateID, moderator)
+}
+
+// lockPair locks both rows for the merge and makes sure they're of the same kind
+func lockPair(ctx context.Context, tx *sqlx.Tx, query string, keep, duplicate any) error {
+	var kinds [2]string
+	for i, id := range []any{keep, duplicate} {
+		var kind sql.NullString
+		if err := tx.GetContext(ctx, &kind, query, id); err != nil {
+			return fmt.Errorf("error locking %v for the merge: %w", id, err)
+		}
+		kinds[i] = kind.String
+	}
+	if kinds[0] != kinds[1] {
+		return fmt.Errorf("%w: %s and %s are different kinds", ErrUnmergeable, kinds[0], kinds[1])
+	}
+	return nil
+}
+
+func repoint(ctx context.Context, tx *sqlx.Tx, target string, keep, duplicate any) error {
+	for _, ref := range references[target] {
+		update, remove := mergeStatements(ref)
+		if _, err := tx.ExecContext(ctx, update, keep, duplicate); err != nil {
+			return fmt.Errorf("error moving %s.%s to the merged %s: %w", ref.table, ref.column, target, err)
+		}
+		if _, err := tx.ExecContext(ctx, remove, keep, duplicate); err != nil {
+			return fmt.Errorf("error removing duplicate %s.%s: %w", ref.table, ref.column, err)
+		}
+	}
+	return nil
+}
+
+// redirect points the links to the duplicate, including the older redirects, to the survivor
+func redirect(ctx context.Context, tx *sqlx.Tx, target, keepID, duplicateID, moderator string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE media.redirects SET to_id = $3 WHERE target = $1 AND to_id = $2`,
+		target, duplicateID, keepID)
+	if err != nil {
+		return fmt.Errorf("error updating the redirects to %s %s: %w", target, duplicateID, err)
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO media.redirects (target, from_id, to_id, merged_by)
+		VALUES ($1, $2, $3, $4)`, target, duplicateID, keepID, moderator)
+	if err != nil {
+		return fmt.Errorf("error redirecting %s %s to %s: %w", target, duplicateID, keepID, err)
+	}
+	// the other suggestions involving the duplicate are found again for the survivor by the next scan
+	_, err = tx.ExecContext(ctx, `DELETE FROM media.duplicate_candidates
+		WHERE target = $1 AND status = $3 AND (first_id = $2 OR second_id = $2)`,
+		target, duplicateID, StatusPending)
+	if err != nil {
+		return fmt.Errorf("error removing the candidates of %s %s: %w", target, duplicateID, err)
+	}
+	return nil
+}
+
+// mergePerson fills in the details missing from the survivor and takes over the MBID. The name
+// of the duplicate is kept as a nickname if it differs, so that searching for it still works
+func mergePerson(ctx context.Context, tx *sqlx.Tx, keep, duplicate any) error {
+	if err := lockPair(ctx, tx, `SELECT 'person' FROM people.person WHERE id = $1 FOR UPDATE`, keep, duplicate); err != nil {
+		return err
+	}
+	mbid, err := takeMBID(ctx, tx, "people.person", "id", duplicate)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE people.person k SET
+		mbid = COALESCE(k.mbid, $3),
+		birth = COALESCE(k.birth, d.birth),
+		death = COALESCE(k.death, d.death),
+		website = COALESCE(k.website, d.website),
+		bio = COALESCE(k.bio, d.bio),
+		nick_names = CASE
+			WHEN lower(k.first_name || ' ' || k.last_name) = lower(d.first_name || ' ' || d.last_name) THEN k.nick_names
+			ELSE array_append(k.nick_names, trim(d.first_name || ' ' || d.last_name)::varchar)
+		END
+	FROM people.person d
+	WHERE k.id = $1 AND d.id = $2`, keep, duplicate, mbid)
+	if err != nil {
+		return fmt.Errorf("error merging the details of person %v: %w", duplicate, err)
+	}
+	return nil
+}
+
+// mergeGroup is like mergePerson, for groups
+func mergeGroup(ctx context.Context, tx *sqlx.Tx, keep, duplicate any) error {
+	// not comparing the kinds, since they're often unknown, e.g. for the imported groups
+	if err := lockPair(ctx, tx, `SELECT 'group' FROM people."group" WHERE id = $1 FOR UPDATE`, keep, duplicate); err != nil {
+		return err
+	}
+	mbid, err := takeMBID(ctx, tx, `people."group"`, "id", duplicate)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE people."group" k SET
+		mbid = COALESCE(k.mbid, $3),
+		kind = COALESCE(k.kind, d.kind),
+		formed = COALESCE(k.formed, d.formed),
+		disbanded = COALESCE(k.disbanded, d.disbanded),
+		website = COALESCE(k.website, d.website),
+		bio = COALESCE(k.bio, d.bio)
+	FROM people."group" d
+	WHERE k.id = $1 AND d.id = $2`, keep, duplicate, mbid)
+	if err != nil {
+		return fmt.Errorf("error merging the details of group %v: %w", duplicate, err)
+	}
+	return nil
+}
+
+// takeMBID clears the MBID of the duplicate, since it's unique, so that the survivor can take it over
+func takeMBID(ctx context.Context, tx *sqlx.Tx, table, key string, duplicate any) (mbid uuid.NullUUID, err error) {
+	err = tx.GetContext(ctx, &mbid, `SELECT mbid FROM `+table+` WHERE `+key+` = $1`, duplicate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return mbid, nil
+	}
+	if err == nil && mbid.Valid {
+		_, err = tx.ExecContext(ctx, `UPDATE `+table+` SET mbid = NULL WHERE `+key+` = $1`, duplicate)
+	}
+	if err != nil {
+		return mbid, fmt.Errorf("error taking the MBID of %v: %w", duplicate, err)
+	}
+	return mbid, nil
+}
+
+// mergeMedia merges the tracks of albums too, matching them by their numbers or MBIDs. The tracks
+// of the duplicate with no counterpart are moved to the survivor
+func (ms *Storage) mergeMedia(ctx context.Context, tx *sqlx.Tx, keep, duplicate uuid.UUID, moderator string) error {
+	err := lockPair(ctx, tx, `SELECT kind::text FROM media.media WHERE id = $1 FOR UPDATE`, keep, duplicate)
+	if err != nil {
+		return err
+	}
+	var kind string
+	if err = tx.GetContext(ctx, &kind, `SELECT kind FROM media.media WHERE id = $1`, keep); err != nil {
+		return fmt.Errorf("error getting the kind of %s: %w", keep, err)
+	}
+	switch kind {
+	case "tv_show", "season", "episode":
+		// the episodes are keyed by the show and season numbers, so they'd collide
+		return fmt.Errorf("%w: merging %s media is not supported yet", ErrUnmergeable, kind)
+	case "album":
+		var tracks []struct {
+			Keep      uuid.UUID `db:"keep"`
+			Duplicate uuid.UUID `db:"duplicate"`
+		}
+		err = tx.SelectContext(ctx, &tracks, `SELECT DISTINCT ON (d.media_id) k.media_id AS keep, d.media_id AS duplicate
+			FROM media.tracks d
+			JOIN media.tracks k ON k.album = $1 AND (k.track_number = d.track_number OR k.mbid = d.mbid)
+			WHERE d.album = $2
+			ORDER BY d.media_id, k.mbid = d.mbid DESC`, keep, duplicate)
+		if err != nil {
+			return fmt.Errorf("error matching the tracks of album %v: %w", duplicate, err)
+		}
+		for i := range tracks {
+			err = ms.merge(ctx, tx, DuplicateMedia, tracks[i].Keep.String(), tracks[i].Duplicate.String(), moderator)
+			if err != nil {
+				return fmt.Errorf("error merging track %s: %w", tracks[i].Duplicate, err)
+			}
+		}
+		if _, err = tx.ExecContext(ctx, `UPDATE media.tracks SET album = $1 WHERE album = $2`, keep, duplicate); err != nil {
+			return fmt.Errorf("error moving the tracks of album %v: %w", duplicate, err)
+		}
+		if _, err = tx.ExecContext(ctx, `UPDATE media.media SET submitted_with = $1 WHERE submitted_with = $2`,
+			keep, duplicate); err != nil {
+			return fmt.Errorf("error moving the tracks of album %v: %w", duplicate, err)
+		}
+		mbid, err := takeMBID(ctx, tx, "media.albums", "media_id", duplicate)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, `UPDATE media.albums SET mbid = COALESCE(mbid, $2) WHERE media_id = $1`,
+			keep, mbid); err != nil {
+			return fmt.Errorf("error merging the MBID of album %v: %w", duplicate, err)
+		}
+	}
+
+	// the survivor keeps its main image
+	_, err = tx.ExecContext(ctx, `UPDATE media.media_images SET is_main = false
+		WHERE media_id = $2 AND EXISTS (SELECT 1 FROM media.media_images WHERE media_id = $1 AND is_main)`,
+		keep, duplicate)
+	if err != nil {
+		return fmt.Errorf("error merging the images of %v: %w", duplicate, err)
+	}
+	if err = mergeCast(ctx, tx, keep, duplicate); err != nil {
+		return err
+	}
+	if err = repoint(ctx, tx, DuplicateMedia, keep, duplicate); err != nil {
+		return err
+	}
+
+	if table, ok := detailTables[kind]; ok {
+		if _, err = tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE media_id = $1`, duplicate); err != nil {
+			return fmt.Errorf("error deleting the details of %s %v: %w", kind, duplicate, err)
+		}
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM media.media WHERE id = $1`, duplicate); err != nil {
+		return fmt.Errorf("error deleting media %v: %w", duplicate, err)
+	}
+	return redirect(ctx, tx, DuplicateMedia, keep.String(), duplicate.String(), moderator)
+}
+
+// mergeCast moves the cast of the duplicate to the survivor, or its actors and directors if
+// the survivor has a cast already
+func mergeCast(ctx context.Context, tx *sqlx.Tx, keep, duplicate any) error {
+	var castIDs [2]sql.NullInt64
+	for i, id := range []any{keep, duplicate} {
+		err := tx.GetContext(ctx, &castIDs[i], `SELECT id FROM people."cast" WHERE media_id = $1 LIMIT 1`, id)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("error getting the cast of %v: %w", id, err)
+		}
+	}
+	switch {
+	case !castIDs[1].Valid:
+		return nil
+	case !castIDs[0].Valid:
+		_, err := tx.ExecContext(ctx, `UPDATE people."cast" SET media_id = $1 WHERE media_id = $2`, keep, duplicate)
+		if err != nil {
+			return fmt.Errorf("error moving the cast of %v: %w", duplicate, err)
+		}
+		return nil
+	}
+	for _, table := range []string{"people.actor_cast", "people.director_cast"} {
+		update, remove := mergeStatements(reference{table: table, column: "cast_id", peers: []string{"person_id"}})
+		if _, err := tx.ExecContext(ctx, update, castIDs[0].Int64, castIDs[1].Int64); err != nil {
+			return fmt.Errorf("error moving %s of %v: %w", table, duplicate, err)
+		}
+		if _, err := tx.ExecContext(ctx, remove, castIDs[0].Int64, castIDs[1].Int64); err != nil {
+			return fmt.Errorf("error removing duplicate %s of %v: %w", table, duplicate, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM people."cast" WHERE id = $1`, castIDs[1].Int64); err != nil {
+		return fmt.Errorf("error deleting the cast of %v: %w", duplicate, err)
+	}
+	return nil
+}
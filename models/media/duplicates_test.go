@@ -0,0 +1,83 @@
+package media
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeName(t *testing.T) {
+	for name, want := range map[string]string{
+		"The Beatles":          "beatles",
+		"  Björk ":             "bjork",
+		"Simon & Garfunkel":    "simon and garfunkel",
+		"Godspeed You! Black…": "godspeed you black",
+		"The The":              "the",
+		"AC/DC":                "ac dc",
+	} {
+		assert.Equal(t, want, NormalizeName(name), name)
+	}
+}
+
+func TestScoreDuplicate(t *testing.T) {
+	date := func(s string) sql.NullTime {
+		d, err := time.Parse(time.DateOnly, s)
+		require.NoError(t, err)
+		return sql.NullTime{Time: d, Valid: true}
+	}
+	ext := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+
+	for _, tc := range []struct {
+		name      string
+		pair      duplicatePair
+		duplicate bool
+		reasons   []string
+	}{
+		{"same normalized name", duplicatePair{FirstName: "The Beatles", SecondName: "Beatles"}, true, []string{"same name"}},
+		{"same name, different years",
+			duplicatePair{FirstName: "Heroes", SecondName: "Heroes", FirstDate: date("1977-10-14"), SecondDate: date("1998-01-01")},
+			false, []string{"same name"}},
+		{"similar name, same date",
+			duplicatePair{FirstName: "Aphex Twin", SecondName: "Aphex Twins", Similarity: 0.8, FirstDate: date("1971-08-18"), SecondDate: date("1971-08-18")},
+			true, []string{"similar name", "same date"}},
+		{"similar name only", duplicatePair{FirstName: "Aphex Twin", SecondName: "Aphex Twins", Similarity: 0.8}, false, []string{"similar name"}},
+		{"same external ID", duplicatePair{FirstName: "Prince", SecondName: "TAFKAP", FirstExt: ext("a"), SecondExt: ext("a")}, true, []string{"same external ID"}},
+		{"different external IDs", duplicatePair{FirstName: "Nirvana", SecondName: "Nirvana", FirstExt: ext("a"), SecondExt: ext("b")}, false, nil},
+	} {
+		score, reasons := scoreDuplicate(&tc.pair)
+		assert.Equal(t, tc.duplicate, score >= DuplicateThreshold, "%s: %f", tc.name, score)
+		assert.Equal(t, tc.reasons, reasons, tc.name)
+		assert.True(t, score >= 0 && score <= 1, tc.name)
+	}
+}
+
+func TestMergeStatements(t *testing.T) {
+	update, remove := mergeStatements(reference{
+		table: "media.album_artists", column: "artist", peers: []string{"album"},
+		kindColumn: "artist_type", kind: "group",
+	})
+	assert.Equal(t, `UPDATE media.album_artists AS t SET artist = $1 WHERE t.artist = $2 AND t.artist_type = 'group'`+
+		` AND NOT EXISTS (SELECT 1 FROM media.album_artists AS k WHERE k.artist = $1 AND k.artist_type = t.artist_type AND k.album = t.album)`,
+		update)
+	assert.Equal(t, `DELETE FROM media.album_artists AS t WHERE t.artist = $2 AND t.artist_type = 'group'`, remove)
+
+	update, _ = mergeStatements(reference{table: "media.books", column: "publisher"})
+	assert.Equal(t, `UPDATE media.books AS t SET publisher = $1 WHERE t.publisher = $2`, update)
+}
+
+func TestMergeKeys(t *testing.T) {
+	keep, duplicate, err := mergeKeys(DuplicateStudio, "3", "12")
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), keep)
+	assert.Equal(t, int32(12), duplicate)
+
+	_, _, err = mergeKeys(DuplicatePerson, "3", "12")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	_, _, err = mergeKeys(DuplicateMedia, "2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21", "2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21")
+	assert.ErrorIs(t, err, ErrUnmergeable)
+	_, _, err = mergeKeys("genre", "3", "12")
+	assert.ErrorIs(t, err, ErrUnknownTarget)
+}
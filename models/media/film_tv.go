@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid/v5"
+	"github.com/jmoiron/sqlx"
 	"github.com/samber/lo"
 )
 
@@ -99,7 +100,8 @@ func (f *Film) GetPosterPath(id uuid.UUID) string {
 	return "/media/" + id.String() + "/poster.jpg"
 }
 
-func (ms *Storage) AddFilm(ctx context.Context, film *Film) error {
+// AddFilm adds the film submitted by the member to the moderation queue
+func (ms *Storage) AddFilm(ctx context.Context, film *Film, submitter string) error {
 	ms.Log.Info().Msg("Adding film \"" + film.Title + "\"")
 	// if film has no release date provided yet, set it to 31st December 9999
 	// While making the media."media"(created) nullable would seem more intuitive,
@@ -115,10 +117,11 @@ func (ms *Storage) AddFilm(ctx context.Context, film *Film) error {
 		film.ReleaseDate.Valid = true
 	}
 	media := Media{
-		Title:    film.Title,
-		Kind:     "film",
-		Created:  film.ReleaseDate.Time,
-		Creators: lo.Interleave(film.Cast.Actors, film.Cast.Directors),
+		Title:     film.Title,
+		Kind:      "film",
+		Created:   film.ReleaseDate.Time,
+		Creators:  lo.Interleave(film.Cast.Actors, film.Cast.Directors),
+		Submitter: submitter,
 	}
 	mediaID, err := ms.Add(ctx, &media)
 	if err != nil {
@@ -255,3 +258,156 @@ func (ms *Storage) UpdateFilm(ctx context.Context, film *Film) error {
 	}
 	return nil
 }
+
+// AddTVShow adds the TV show submitted by the member to the moderation queue. Its seasons and
+// episodes are approved or rejected together with it
+func (ms *Storage) AddTVShow(ctx context.Context, show *TVShow, submitter string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		id, err := addMediaRow(ctx, tx, show.Title, "tv_show", submitter, uuid.NullUUID{})
+		if err != nil {
+			return fmt.Errorf("error adding TV show %s: %w", show.Title, err)
+		}
+		year := sql.NullInt16{Int16: int16(show.Year), Valid: show.Year != 0}
+		_, err = tx.ExecContext(ctx, `INSERT INTO media.tv_shows (media_id, title, "year", active)
+			VALUES ($1, $2, $3, $4)`, id, show.Title, year, show.Active)
+		if err != nil {
+			return fmt.Errorf("failed to insert TV show into media.tv_shows: %w", err)
+		}
+		if show.Studio.ID != 0 {
+			_, err = tx.ExecContext(ctx, `INSERT INTO people.studio_works (studio_id, media_id)
+				VALUES ($1, $2) ON CONFLICT DO NOTHING`, show.Studio.ID, id)
+			if err != nil {
+				return fmt.Errorf("failed to insert the TV show's studio into people.studio_works: %w", err)
+			}
+		}
+		partOf := uuid.NullUUID{UUID: id, Valid: true}
+		for i := range show.Seasons {
+			show.Seasons[i].ShowID = &id
+			if err = addSeason(ctx, tx, &show.Seasons[i], submitter, partOf); err != nil {
+				return err
+			}
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error saving TV show %s: %w", show.Title, err)
+		}
+		show.MediaID = &id
+		ms.Log.Info().Msgf("Member %s submitted TV show %s with %d seasons", submitter, id, len(show.Seasons))
+		return nil
+	}
+}
+
+// AddSeason adds the season submitted by the member, along with its episodes, to an existing TV show
+func (ms *Storage) AddSeason(ctx context.Context, season *Season, submitter string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if season.ShowID == nil {
+			return fmt.Errorf("the season must belong to a TV show")
+		}
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		var showID uuid.UUID
+		err = tx.GetContext(ctx, &showID, `SELECT media_id FROM media.tv_shows WHERE media_id = $1 FOR SHARE`, season.ShowID)
+		if err != nil {
+			return fmt.Errorf("error getting TV show %s: %w", season.ShowID, err)
+		}
+		if err = addSeason(ctx, tx, season, submitter, uuid.NullUUID{}); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error saving season %d of %s: %w", season.Number, showID, err)
+		}
+		return nil
+	}
+}
+
+// AddEpisode adds the episode submitted by the member to an existing season
+func (ms *Storage) AddEpisode(ctx context.Context, episode *Episode, submitter string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if episode.ShowID == nil {
+			return fmt.Errorf("the episode must belong to a TV show")
+		}
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		var seasonID uuid.UUID
+		err = tx.GetContext(ctx, &seasonID, `SELECT media_id FROM media.tv_show_seasons
+			WHERE tv_show = $1 AND season = $2 FOR SHARE`, episode.ShowID, episode.Season)
+		if err != nil {
+			return fmt.Errorf("error getting season %d of %s: %w", episode.Season, episode.ShowID, err)
+		}
+		episode.SeasonID = &seasonID
+		if err = addEpisode(ctx, tx, episode, submitter, uuid.NullUUID{}); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error saving episode %s: %w", episode.Title, err)
+		}
+		return nil
+	}
+}
+
+// addSeason adds the season and its episodes. Unless the season is a part of another
+// submission, its episodes are moderated together with it
+func addSeason(ctx context.Context, tx *sqlx.Tx, season *Season, submitter string, partOf uuid.NullUUID) error {
+	title := fmt.Sprintf("Season %d", season.Number)
+	id, err := addMediaRow(ctx, tx, title, "season", submitter, partOf)
+	if err != nil {
+		return fmt.Errorf("error adding season %d: %w", season.Number, err)
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO media.tv_show_seasons (media_id, tv_show, season)
+		VALUES ($1, $2, $3)`, id, season.ShowID, season.Number)
+	if err != nil {
+		return fmt.Errorf("failed to insert season into media.tv_show_seasons: %w", err)
+	}
+	season.MediaID = &id
+	if !partOf.Valid {
+		partOf = uuid.NullUUID{UUID: id, Valid: true}
+	}
+	for i := range season.Episodes {
+		ep := &season.Episodes[i]
+		ep.ShowID, ep.SeasonID, ep.Season = season.ShowID, &id, uint16(season.Number)
+		if err = addEpisode(ctx, tx, ep, submitter, partOf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addEpisode(ctx context.Context, tx *sqlx.Tx, episode *Episode, submitter string, partOf uuid.NullUUID) error {
+	id, err := addMediaRow(ctx, tx, episode.Title, "episode", submitter, partOf)
+	if err != nil {
+		return fmt.Errorf("error adding episode %s: %w", episode.Title, err)
+	}
+	airDate := sql.NullTime{Time: episode.AirDate, Valid: !episode.AirDate.IsZero()}
+	duration := sql.NullFloat64{Float64: episode.Duration.Seconds(), Valid: episode.Duration > 0}
+	_, err = tx.ExecContext(ctx, `INSERT INTO media.tv_show_episodes
+		(media_id, tv_show, season, episode, title, air_date, duration, plot)
+		VALUES ($1, $2, $3, $4, $5, $6, $7 * interval '1 second', NULLIF($8, ''))`,
+		id, episode.ShowID, episode.Season, episode.Episode, episode.Title, airDate, duration, episode.Plot)
+	if err != nil {
+		return fmt.Errorf("failed to insert episode into media.tv_show_episodes: %w", err)
+	}
+	episode.MediaID = &id
+	return nil
+}
@@ -0,0 +1,262 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+// The roles of the studios which worked on a game
+const (
+	GameDeveloper = "developer"
+	GamePublisher = "publisher"
+)
+
+// RegionWorldwide is used for games released everywhere at the same time
+const RegionWorldwide = "WW"
+
+type (
+	// Game is a video game
+	Game struct {
+		MediaID    *uuid.UUID     `json:"media_id" db:"media_id,pk,unique"`
+		Title      string         `json:"title" db:"title" example:"Deus Ex"`
+		Synopsis   sql.NullString `json:"synopsis,omitempty" db:"synopsis" swaggertype:"string"`
+		Platforms  []Platform     `json:"platforms,omitempty" db:"-"`
+		Developers []Studio       `json:"developers,omitempty" db:"-"`
+		Publishers []Studio       `json:"publishers,omitempty" db:"-"`
+		Releases   []GameRelease  `json:"releases,omitempty" db:"-"`
+		Franchises []Franchise    `json:"franchises,omitempty" db:"-"`
+		Genres     []Genre        `json:"genres,omitempty" db:"-"`
+	}
+
+	// Platform is a system games are released on, e.g. a console
+	Platform struct {
+		ID   int32  `json:"id,omitempty" db:"id"`
+		Name string `json:"name" db:"name" example:"PlayStation 2"`
+	}
+
+	// Franchise groups the games set in the same universe or sharing their name
+	Franchise struct {
+		ID   int32  `json:"id,omitempty" db:"id"`
+		Name string `json:"name" db:"name" example:"Deus Ex"`
+	}
+
+	// GameRelease is the release date of the game in a region, optionally on a single platform
+	GameRelease struct {
+		// ISO 3166-1 alpha-2 code, or WW for worldwide releases
+		Region   string    `json:"region" db:"region" example:"JP"`
+		Platform string    `json:"platform,omitempty" db:"platform" example:"PC"`
+		Date     time.Time `json:"date" db:"release_date"`
+	}
+)
+
+// ValidRegion checks if the region is an uppercase two-letter code
+func ValidRegion(region string) bool {
+	if len(region) != 2 {
+		return false
+	}
+	for _, r := range region {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// AddGame adds the game submitted by the member to the moderation queue. The platforms and
+// franchises are matched by their names and added if they're new, same as the studios
+func (ms *Storage) AddGame(ctx context.Context, game *Game, submitter string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		// resolving the studios first, since they're saved by the people storage
+		for _, studios := range [][]Studio{game.Developers, game.Publishers} {
+			for i := range studios {
+				if studios[i].ID != 0 {
+					continue
+				}
+				studio, err := ms.Ps.ResolveStudio(ctx, studios[i].Name, GameStudio)
+				if err != nil {
+					return fmt.Errorf("error resolving studio %s: %w", studios[i].Name, err)
+				}
+				studios[i] = *studio
+			}
+		}
+
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		id, err := addMediaRow(ctx, tx, game.Title, "game", submitter, uuid.NullUUID{})
+		if err != nil {
+			return fmt.Errorf("error adding game %s: %w", game.Title, err)
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO media.games (media_id, title, synopsis) VALUES ($1, $2, $3)`,
+			id, game.Title, game.Synopsis)
+		if err != nil {
+			return fmt.Errorf("failed to insert game into media.games: %w", err)
+		}
+
+		platforms := make(map[string]int32, len(game.Platforms))
+		for i := range game.Platforms {
+			p := &game.Platforms[i]
+			if p.ID, err = resolvePlatform(ctx, tx, p.Name); err != nil {
+				return err
+			}
+			platforms[strings.ToLower(p.Name)] = p.ID
+			_, err = tx.ExecContext(ctx, `INSERT INTO media.game_platforms (game, platform)
+				VALUES ($1, $2) ON CONFLICT DO NOTHING`, id, p.ID)
+			if err != nil {
+				return fmt.Errorf("failed to insert game platform into media.game_platforms: %w", err)
+			}
+		}
+		for i := range game.Franchises {
+			f := &game.Franchises[i]
+			err = tx.GetContext(ctx, &f.ID, `INSERT INTO media.franchises (name) VALUES ($1)
+				ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+				RETURNING id`, strings.TrimSpace(f.Name))
+			if err != nil {
+				return fmt.Errorf("failed to insert franchise %s: %w", f.Name, err)
+			}
+			_, err = tx.ExecContext(ctx, `INSERT INTO media.game_franchises (game, franchise)
+				VALUES ($1, $2) ON CONFLICT DO NOTHING`, id, f.ID)
+			if err != nil {
+				return fmt.Errorf("failed to insert game franchise into media.game_franchises: %w", err)
+			}
+		}
+		for i := range game.Genres {
+			_, err = tx.ExecContext(ctx, `INSERT INTO media.game_genres (game, genre)
+				VALUES ($1, $2) ON CONFLICT DO NOTHING`, id, game.Genres[i].ID)
+			if err != nil {
+				return fmt.Errorf("failed to insert game genre into media.game_genres: %w", err)
+			}
+		}
+		for role, studios := range map[string][]Studio{GameDeveloper: game.Developers, GamePublisher: game.Publishers} {
+			for i := range studios {
+				_, err = tx.ExecContext(ctx, `INSERT INTO media.game_studios (game, studio, "role")
+					VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`, id, studios[i].ID, role)
+				if err != nil {
+					return fmt.Errorf("failed to insert game %s into media.game_studios: %w", role, err)
+				}
+			}
+		}
+		for i := range game.Releases {
+			r := &game.Releases[i]
+			platform := sql.NullInt32{}
+			if r.Platform != "" {
+				// releases may be on platforms not listed separately
+				pid, ok := platforms[strings.ToLower(r.Platform)]
+				if !ok {
+					if pid, err = resolvePlatform(ctx, tx, r.Platform); err != nil {
+						return err
+					}
+				}
+				platform = sql.NullInt32{Int32: pid, Valid: true}
+			}
+			_, err = tx.ExecContext(ctx, `INSERT INTO media.game_releases (game, region, platform, release_date)
+				VALUES ($1, $2, $3, $4)`, id, r.Region, platform, r.Date)
+			if err != nil {
+				return fmt.Errorf("failed to insert game release into media.game_releases: %w", err)
+			}
+		}
+
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error saving game %s: %w", game.Title, err)
+		}
+		game.MediaID = &id
+		return nil
+	}
+}
+
+// resolvePlatform looks up the platform by its name, ignoring case, and adds it if there's none
+func resolvePlatform(ctx context.Context, tx *sqlx.Tx, name string) (id int32, err error) {
+	name = strings.TrimSpace(name)
+	err = tx.GetContext(ctx, &id, `SELECT id FROM media.platforms WHERE lower(name) = lower($1)`, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.GetContext(ctx, &id, `INSERT INTO media.platforms (name) VALUES ($1)
+			ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+			RETURNING id`, name)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error resolving platform %s: %w", name, err)
+	}
+	return id, nil
+}
+
+func (ms *Storage) getGame(ctx context.Context, id uuid.UUID) (*Game, error) {
+	var game Game
+	err := ms.db.GetContext(ctx, &game, `SELECT media_id, title, synopsis FROM media.games WHERE media_id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting game %s: %w", id, err)
+	}
+	err = ms.db.SelectContext(ctx, &game.Platforms, `SELECT p.id, p.name
+		FROM media.game_platforms gp
+		JOIN media.platforms p ON p.id = gp.platform
+		WHERE gp.game = $1
+		ORDER BY p.name`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the platforms of game %s: %w", id, err)
+	}
+	err = ms.db.SelectContext(ctx, &game.Franchises, `SELECT f.id, f.name
+		FROM media.game_franchises gf
+		JOIN media.franchises f ON f.id = gf.franchise
+		WHERE gf.game = $1
+		ORDER BY f.name`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the franchises of game %s: %w", id, err)
+	}
+	err = ms.db.SelectContext(ctx, &game.Genres, `SELECT g.id, g.name, g.kinds AS kind
+		FROM media.game_genres gg
+		JOIN media.genres g ON g.id = gg.genre
+		WHERE gg.game = $1
+		ORDER BY g.name`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the genres of game %s: %w", id, err)
+	}
+	err = ms.db.SelectContext(ctx, &game.Releases, `SELECT r.region, COALESCE(p.name, '') AS platform, r.release_date
+		FROM media.game_releases r
+		LEFT JOIN media.platforms p ON p.id = r.platform
+		WHERE r.game = $1
+		ORDER BY r.release_date, r.region`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the releases of game %s: %w", id, err)
+	}
+
+	rows, err := ms.db.QueryxContext(ctx, `SELECT gs."role", s.id_numeric, s.name
+		FROM media.game_studios gs
+		JOIN people.studio s ON s.id_numeric = gs.studio
+		WHERE gs.game = $1
+		ORDER BY s.name`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the studios of game %s: %w", id, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			role   string
+			studio Studio
+		)
+		if err = rows.Scan(&role, &studio.ID, &studio.Name); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		studio.Kinds = []studioKind{GameStudio}
+		if role == GamePublisher {
+			game.Publishers = append(game.Publishers, studio)
+		} else {
+			game.Developers = append(game.Developers, studio)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting the studios of game %s: %w", id, err)
+	}
+	return &game, nil
+}
@@ -0,0 +1,50 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// MatchMedia finds the album or track most similar to the given title and artist, using
+// trigram similarity. The score is between 0 and 1, with the title weighing twice as
+// much as the artist. If nothing is similar enough, uuid.Nil is returned
+func (ms *Storage) MatchMedia(ctx context.Context, kind, title, artist string) (id uuid.UUID, score float64, err error) {
+	select {
+	case <-ctx.Done():
+		return uuid.Nil, 0, ctx.Err()
+	default:
+		if kind != "album" && kind != "track" {
+			return uuid.Nil, 0, fmt.Errorf("matching %s is not supported", kind)
+		}
+		var match struct {
+			ID    uuid.UUID `db:"id"`
+			Score float64   `db:"score"`
+		}
+		// tracks are credited to the artists of their album
+		err = ms.db.GetContext(ctx, &match, `SELECT m.id,
+			(2 * similarity(lower(m.title), lower($2)) + COALESCE(MAX(GREATEST(
+				similarity(lower(concat_ws(' ', p.first_name, p.last_name)), lower($3)),
+				similarity(lower(g.name), lower($3)))), 0)) / 3 AS score
+		FROM media.media m
+		LEFT JOIN media.tracks t ON m.kind = 'track' AND t.media_id = m.id
+		LEFT JOIN media.album_artists aa ON aa.album = COALESCE(t.album, m.id)
+		LEFT JOIN people.person p ON aa.artist_type = 'individual' AND p.id = aa.artist
+		LEFT JOIN people."group" g ON aa.artist_type = 'group' AND g.id = aa.artist
+		WHERE m.kind = $1::media.kind AND lower(m.title) % lower($2)
+		GROUP BY m.id, m.title
+		ORDER BY score DESC
+		LIMIT 1`, kind, strings.TrimSpace(title), strings.TrimSpace(artist))
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, 0, nil
+		}
+		if err != nil {
+			return uuid.Nil, 0, fmt.Errorf("error matching %s %q: %w", kind, title, err)
+		}
+		return match.ID, match.Score, nil
+	}
+}
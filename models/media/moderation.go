@@ -0,0 +1,184 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/lib/pq"
+)
+
+// The moderation statuses of media. Media added through the submission form start as pending
+// and are hidden until a moderator approves them
+const (
+	StatusPending      = "pending"
+	StatusApproved     = "approved"
+	StatusRejected     = "rejected"
+	StatusNeedsChanges = "needs-changes"
+)
+
+// ErrInvalidTransition is returned when a submission can't be moved to the requested status,
+// e.g. when approving a rejected submission
+var ErrInvalidTransition = errors.New("invalid moderation status change")
+
+type (
+	// Submission is a media item in the moderation queue, along with the reviewers' comments
+	Submission struct {
+		ID       uuid.UUID    `json:"id" db:"id"`
+		Title    string       `json:"title" db:"title" example:"Mezzanine"`
+		Kind     string       `json:"kind" db:"kind" example:"album"`
+		Status   string       `json:"status" db:"status" enum:"pending,approved,rejected,needs-changes" example:"pending"`
+		Added    time.Time    `json:"added" db:"added"`
+		Modified sql.NullTime `json:"modified,omitempty" db:"modified"`
+		// the nick of the member who submitted the media, if they haven't deleted their account
+		Submitter sql.NullString      `json:"submitter,omitempty" db:"submitter" example:"lain"`
+		Comments  []ModerationComment `json:"comments,omitempty" db:"-"`
+	}
+
+	// ModerationComment is left by a moderator along with the status they set
+	ModerationComment struct {
+		ID       int64          `json:"id" db:"id"`
+		MediaID  uuid.UUID      `json:"media_id" db:"media_id"`
+		Reviewer sql.NullString `json:"reviewer,omitempty" db:"reviewer" example:"alice"`
+		Status   string         `json:"status" db:"status" enum:"approved,rejected,needs-changes" example:"needs-changes"`
+		Body     string         `json:"body" db:"body" example:"Please add the release date"`
+		Created  time.Time      `json:"created" db:"created"`
+	}
+)
+
+// CanTransition tells whether a submission may be moved from one status to the other.
+// Moderators approve, reject or ask for changes to pending submissions, and the submitter
+// sends the changed ones back to the queue. Approved and rejected submissions are final
+func CanTransition(from, to string) bool {
+	switch from {
+	case StatusPending:
+		return to == StatusApproved || to == StatusRejected || to == StatusNeedsChanges
+	case StatusNeedsChanges:
+		return to == StatusPending || to == StatusApproved || to == StatusRejected
+	default:
+		return false
+	}
+}
+
+// ModerationQueue lists the submissions with the given statuses, oldest first
+func (ms *Storage) ModerationQueue(ctx context.Context, statuses []string, limit, offset int) ([]Submission, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		queue := make([]Submission, 0)
+		err := ms.db.SelectContext(ctx, &queue, `
+		SELECT m.id, m.title, m.kind, m.status, m.added, m.modified, mem.nick AS submitter
+		FROM media.media AS m
+		LEFT JOIN public.members AS mem ON mem.id_numeric = m.submitted_by
+		WHERE m.status::text = ANY($1) AND m.submitted_with IS NULL
+		ORDER BY m.added
+		LIMIT $2 OFFSET $3`, pq.Array(statuses), limit, offset)
+		if err != nil {
+			return nil, fmt.Errorf("error listing the moderation queue: %w", err)
+		}
+		return queue, nil
+	}
+}
+
+// Submission returns the moderation status of the media, along with the comments of the reviewers
+func (ms *Storage) Submission(ctx context.Context, mediaID uuid.UUID) (*Submission, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		var s Submission
+		err := ms.db.GetContext(ctx, &s, `
+		SELECT m.id, m.title, m.kind, m.status, m.added, m.modified, mem.nick AS submitter
+		FROM media.media AS m
+		LEFT JOIN public.members AS mem ON mem.id_numeric = m.submitted_by
+		WHERE m.id = $1`, mediaID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting submission %s: %w", mediaID, err)
+		}
+		err = ms.db.SelectContext(ctx, &s.Comments, `
+		SELECT c.id, c.media_id, mem.nick AS reviewer, c.status, c.body, c.created
+		FROM media.moderation_comments AS c
+		LEFT JOIN public.members AS mem ON mem.id_numeric = c.reviewer
+		WHERE c.media_id = $1
+		ORDER BY c.created`, mediaID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting the comments on submission %s: %w", mediaID, err)
+		}
+		return &s, nil
+	}
+}
+
+// Moderate sets the status of the submission and records the reviewer's comment
+func (ms *Storage) Moderate(
+	ctx context.Context,
+	mediaID uuid.UUID,
+	reviewer, status, comment string,
+) (*ModerationComment, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		var current string
+		err = tx.GetContext(ctx, &current, `SELECT status FROM media.media WHERE id = $1 FOR UPDATE`, mediaID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting the status of %s: %w", mediaID, err)
+		}
+		if !CanTransition(current, status) || status == StatusPending {
+			return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, current, status)
+		}
+		// the tracks, seasons and episodes submitted along with the media share its status
+		_, err = tx.ExecContext(ctx, `UPDATE media.media SET status = $1 WHERE id = $2 OR submitted_with = $2`,
+			status, mediaID)
+		if err != nil {
+			return nil, fmt.Errorf("error setting the status of %s: %w", mediaID, err)
+		}
+
+		c := ModerationComment{
+			MediaID:  mediaID,
+			Reviewer: sql.NullString{String: reviewer, Valid: true},
+			Status:   status,
+			Body:     comment,
+		}
+		err = tx.QueryRowxContext(ctx, `
+		INSERT INTO media.moderation_comments (media_id, reviewer, status, body)
+		VALUES ($1, (SELECT id_numeric FROM public.members WHERE nick = $2), $3, $4)
+		RETURNING id, created`,
+			mediaID, reviewer, status, comment).Scan(&c.ID, &c.Created)
+		if err != nil {
+			return nil, fmt.Errorf("error saving the comment on %s: %w", mediaID, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, fmt.Errorf("error moderating %s: %w", mediaID, err)
+		}
+		return &c, nil
+	}
+}
+
+// Resubmit sends the submission back to the queue once the member who submitted it made the
+// changes the moderators asked for. It does nothing for the other submissions
+func (ms *Storage) Resubmit(ctx context.Context, mediaID uuid.UUID, memberName string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		_, err := ms.db.ExecContext(ctx, `
+		UPDATE media.media SET status = $1
+		WHERE (id = $2 OR submitted_with = $2) AND status = $3
+			AND submitted_by = (SELECT id_numeric FROM public.members WHERE nick = $4)`,
+			StatusPending, mediaID, StatusNeedsChanges, memberName)
+		if err != nil {
+			return fmt.Errorf("error resubmitting %s: %w", mediaID, err)
+		}
+		return nil
+	}
+}
@@ -3,6 +3,7 @@ package media
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
@@ -19,11 +20,18 @@ type (
 		ImagePaths   pq.StringArray `json:"image_paths,omitempty"` // we make use of a junction table that utilizes the image IDs
 		ReleaseDate  time.Time      `json:"release_date" db:"release_date"`
 		Genres       []Genre        `json:"genres,omitempty" db:"genres"`
-		//	Studio       Studio                       `json:"studio,omitempty" db:"studio"`
+		// the record label
+		Studio   *Studio      `json:"studio,omitempty" db:"-"`
 		Keywords []Keyword    `json:"keywords,omitempty" db:"keywords"`
 		Duration sql.NullTime `json:"duration,omitempty" db:"duration"`
 		Tracks   []Track      `json:"tracks,omitempty" db:"tracks"`
 		//	Languages int16         `json:"languages" db:"languages,omitempty"`
+		// MusicBrainz release MBID
+		MBID uuid.NullUUID `json:"mbid,omitempty" db:"mbid" swaggertype:"string"`
+		// the release group, see Work
+		Work *uuid.UUID `json:"work,omitempty" db:"work"`
+		// e.g. "2019 remaster" or "deluxe edition"
+		Edition string `json:"edition,omitempty" db:"edition"`
 	}
 
 	// junction table media.album_artists
@@ -42,72 +50,192 @@ type (
 		Lyrics   string    `json:"lyrics,omitempty" db:"lyrics"`
 		Number   int16     `json:"track_number" db:"track_number"`
 		// Languages []string                     `json:"languages,omitempty" db:"languages"`
+		// MusicBrainz recording MBID
+		MBID uuid.NullUUID `json:"mbid,omitempty" db:"mbid" swaggertype:"string"`
 	}
 )
 
-func addAlbum(ctx context.Context, db *sqlx.DB, album *Album) error {
-	// Insert the album into the media.albums table
-	_, err := db.ExecContext(ctx, `
-		INSERT INTO media.albums (media_id, name, release_date, duration)
-		VALUES ($1, $2, $3, $4)`,
-		album.MediaID, album.Name, album.ReleaseDate, album.Duration)
+// addAlbum saves the album's details along with its artists, genres, keywords, label and tracks.
+// The media.media row of the album must be added first. If the submitter is set, the tracks
+// are moderated together with the album
+func addAlbum(ctx context.Context, tx *sqlx.Tx, album *Album, submitter string) error {
+	id := *album.MediaID
+	_, err := tx.ExecContext(ctx, `INSERT INTO media.albums (media_id, name, release_date, duration, mbid)
+		VALUES ($1, $2, $3, $4, $5)`,
+		id, album.Name, album.ReleaseDate, album.Duration, album.MBID)
 	if err != nil {
 		return fmt.Errorf("failed to insert album into media.albums: %w", err)
 	}
-	// Insert keywords into the junction table
-	_, err = db.ExecContext(ctx, `
-		INSERT INTO media.album_keywords (album, keyword)
-		VALUES ($1, $2)`,
-		album.MediaID, album.Keywords)
-	if err != nil {
-		return fmt.Errorf("failed to insert album keywords into media.album_keywords: %w", err)
+	for i := range album.AlbumArtists {
+		artistType := album.AlbumArtists[i].ArtistType
+		if artistType == "" {
+			artistType = "individual"
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO media.album_artists (album, artist, artist_type)
+			VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+			id, album.AlbumArtists[i].ID, artistType)
+		if err != nil {
+			return fmt.Errorf("failed to insert album artist into media.album_artists: %w", err)
+		}
 	}
-
-	// Insert the genres into the media.album_genres table
 	for i := range album.Genres {
-		_, err = db.ExecContext(ctx, "INSERT INTO media.album_genres (album, genre) VALUES ($1, $2)",
-			album.MediaID, album.Genres[i].ID)
+		_, err = tx.ExecContext(ctx, `INSERT INTO media.album_genres (album, genre)
+			VALUES ($1, $2) ON CONFLICT DO NOTHING`, id, album.Genres[i].ID)
 		if err != nil {
 			return fmt.Errorf("failed to insert album genre into media.album_genres: %w", err)
 		}
 	}
+	for i := range album.Keywords {
+		kw := &album.Keywords[i]
+		err = tx.GetContext(ctx, &kw.ID, `INSERT INTO media.keywords (keyword) VALUES ($1)
+			ON CONFLICT (keyword) DO UPDATE SET keyword = EXCLUDED.keyword
+			RETURNING id`, kw.Keyword)
+		if err != nil {
+			return fmt.Errorf("failed to insert keyword %s: %w", kw.Keyword, err)
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO media.album_keywords (album, keyword_id)
+			VALUES ($1, $2) ON CONFLICT DO NOTHING`, id, kw.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert album keyword into media.album_keywords: %w", err)
+		}
+	}
+	if album.Studio != nil {
+		_, err = tx.ExecContext(ctx, `INSERT INTO people.studio_works (studio_id, media_id)
+			VALUES ($1, $2) ON CONFLICT DO NOTHING`, album.Studio.ID, id)
+		if err != nil {
+			return fmt.Errorf("failed to insert the album's label into people.studio_works: %w", err)
+		}
+	}
+	partOf := uuid.NullUUID{}
+	if submitter != "" {
+		partOf = uuid.NullUUID{UUID: id, Valid: true}
+	}
+	for i := range album.Tracks {
+		album.Tracks[i].AlbumID = &id
+		if err = addTrack(ctx, tx, &album.Tracks[i], submitter, partOf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	errChan := make(chan error)
-	go func() {
-		aa := album.AlbumArtists
-		for i := range aa {
-			_, err := db.ExecContext(ctx, `INSERT INTO media.album_artists (album, artist, artist_type)
-				VALUES ($1, $2, $3)`,
-				album.MediaID, aa[i].ID, "individual")
-			if err != nil {
-				errChan <- fmt.Errorf("failed to insert album artist into media.album_artists: %w", err)
+// AddAlbum saves an imported album together with its artists, genres, keywords, label and tracks.
+// If the album has an MBID which is already known, the existing album's ID is returned instead
+func (ms *Storage) AddAlbum(ctx context.Context, album *Album) (id uuid.UUID, err error) {
+	select {
+	case <-ctx.Done():
+		return uuid.Nil, ctx.Err()
+	default:
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		if album.MBID.Valid {
+			err = tx.GetContext(ctx, &id, `SELECT media_id FROM media.albums WHERE mbid = $1 FOR UPDATE`, album.MBID)
+			if err == nil {
+				album.MediaID = &id
+				return id, nil
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return uuid.Nil, fmt.Errorf("error looking up album %s: %w", album.MBID.UUID, err)
 			}
 		}
-		close(errChan)
-	}()
 
-	err = <-errChan
-	if err != nil {
-		return err
+		if id, err = addMediaRow(ctx, tx, album.Name, "album", "", uuid.NullUUID{}); err != nil {
+			return uuid.Nil, fmt.Errorf("error adding album %s: %w", album.Name, err)
+		}
+		album.MediaID = &id
+		if err = addAlbum(ctx, tx, album, ""); err != nil {
+			return uuid.Nil, err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return uuid.Nil, fmt.Errorf("error saving album %s: %w", album.Name, err)
+		}
+		return id, nil
 	}
+}
 
-	return nil
+// SubmitAlbum adds the album submitted by the member to the moderation queue. Its tracks are
+// approved or rejected together with it
+func (ms *Storage) SubmitAlbum(ctx context.Context, album *Album, submitter string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		id, err := addMediaRow(ctx, tx, album.Name, "album", submitter, uuid.NullUUID{})
+		if err != nil {
+			return fmt.Errorf("error adding album %s: %w", album.Name, err)
+		}
+		album.MediaID = &id
+		if err = addAlbum(ctx, tx, album, submitter); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error saving album %s: %w", album.Name, err)
+		}
+		ms.Log.Info().Msgf("Member %s submitted album %s with %d tracks", submitter, id, len(album.Tracks))
+		return nil
+	}
 }
 
-func addTrack(ctx context.Context, db *sqlx.DB, track *Track) error {
-	_, err := db.ExecContext(ctx, `
-		INSERT INTO media.tracks (media_id, name, duration, lyrics)
-		VALUES ($1, $2, $3, $4)`,
-		&track.MediaID, &track.Name, &track.Duration, &track.Lyrics)
+// SubmitTrack adds the track submitted by the member to an existing album. The track is moderated
+// on its own
+func (ms *Storage) SubmitTrack(ctx context.Context, track *Track, submitter string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if track.AlbumID == nil {
+			return fmt.Errorf("the track must belong to an album")
+		}
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		var albumID uuid.UUID
+		err = tx.GetContext(ctx, &albumID, `SELECT media_id FROM media.albums WHERE media_id = $1 FOR SHARE`, track.AlbumID)
+		if err != nil {
+			return fmt.Errorf("error getting album %s: %w", track.AlbumID, err)
+		}
+		if err = addTrack(ctx, tx, track, submitter, uuid.NullUUID{}); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error saving track %s: %w", track.Name, err)
+		}
+		return nil
+	}
+}
+
+// addTrack adds the media.media row of the track, followed by its details
+func addTrack(ctx context.Context, tx *sqlx.Tx, track *Track, submitter string, partOf uuid.NullUUID) error {
+	id, err := addMediaRow(ctx, tx, track.Name, "track", submitter, partOf)
+	if err != nil {
+		return fmt.Errorf("error adding track %s: %w", track.Name, err)
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO media.tracks (media_id, name, album, duration, lyrics, track_number, mbid)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		id, track.Name, track.AlbumID, track.Duration, track.Lyrics, track.Number, track.MBID)
 	if err != nil {
 		return fmt.Errorf("failed to insert track into media.tracks: %w", err)
 	}
-
+	track.MediaID = &id
 	return nil
 }
 
 func (ms *Storage) getAlbum(ctx context.Context, id uuid.UUID) (Album, error) {
-	stmt, err := ms.db.PrepareContext(ctx, `SELECT media_id, album_name, release_date, duration
+	stmt, err := ms.db.PrepareContext(ctx, `SELECT media_id, album_name, release_date, duration, work, edition
 		FROM media.albums 
 		WHERE media_id = $1`)
 	if err != nil {
@@ -117,7 +245,7 @@ func (ms *Storage) getAlbum(ctx context.Context, id uuid.UUID) (Album, error) {
 
 	row := stmt.QueryRowContext(ctx, id)
 	var album Album
-	err = row.Scan(&album.MediaID, &album.Name, &album.ReleaseDate, &album.Duration)
+	err = row.Scan(&album.MediaID, &album.Name, &album.ReleaseDate, &album.Duration, &album.Work, &album.Edition)
 	if err != nil {
 		return Album{}, fmt.Errorf("error scanning row: %w", err)
 	}
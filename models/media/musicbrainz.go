@@ -0,0 +1,107 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/lib/pq"
+)
+
+// RatingPlaceholder marks a media item which a member has listened to, but not rated yet
+type RatingPlaceholder struct {
+	MediaID      uuid.UUID    `json:"media_id" db:"media_id"`
+	Source       string       `json:"source" db:"source" example:"listenbrainz"`
+	Listens      int          `json:"listens" db:"listens"`
+	LastListened sql.NullTime `json:"last_listened,omitempty" db:"last_listened"`
+	Created      time.Time    `json:"created" db:"created"`
+}
+
+// MediaByMBID maps the MusicBrainz release and recording IDs of the imported albums
+// and tracks to their media IDs. Unknown MBIDs are left out
+func (ms *Storage) MediaByMBID(ctx context.Context, mbids []uuid.UUID) (map[uuid.UUID]uuid.UUID, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		var rows []struct {
+			MBID    uuid.UUID `db:"mbid"`
+			MediaID uuid.UUID `db:"media_id"`
+		}
+		ids := make([]string, len(mbids))
+		for i := range mbids {
+			ids[i] = mbids[i].String()
+		}
+		err := ms.db.SelectContext(ctx, &rows, `SELECT mbid, media_id FROM media.albums WHERE mbid = ANY($1::uuid[])
+		UNION ALL
+		SELECT mbid, media_id FROM media.tracks WHERE mbid = ANY($1::uuid[]) AND media_id IS NOT NULL`,
+			pq.Array(ids))
+		if err != nil {
+			return nil, fmt.Errorf("error looking up MBIDs: %w", err)
+		}
+		found := make(map[uuid.UUID]uuid.UUID, len(rows))
+		for i := range rows {
+			found[rows[i].MBID] = rows[i].MediaID
+		}
+		return found, nil
+	}
+}
+
+// SaveRatingPlaceholders records the media a member has listened to. Media already rated
+// by the member are skipped. It returns the number of placeholders created or updated
+func (ms *Storage) SaveRatingPlaceholders(
+	ctx context.Context,
+	memberName string,
+	placeholders []RatingPlaceholder,
+) (saved int, err error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	default:
+		// the placeholders refer to the members by their numeric ID, the ratings by their uuid
+		var member struct {
+			UUID uuid.UUID `db:"uuid"`
+			ID   int       `db:"id_numeric"`
+		}
+		err = ms.db.GetContext(ctx, &member, `SELECT uuid, id_numeric FROM public.members WHERE nick = $1`, memberName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("member %s not found: %w", memberName, err)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error looking up member %s: %w", memberName, err)
+		}
+
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return 0, fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		for i := range placeholders {
+			res, err := tx.ExecContext(ctx, `INSERT INTO reviews.rating_placeholders
+			(member_id, media_id, source, listens, last_listened)
+			SELECT $1, $2, $3, $4, $5
+			WHERE NOT EXISTS (SELECT 1 FROM reviews.ratings WHERE user_id = $6 AND media_id = $2)
+			ON CONFLICT (member_id, media_id) DO UPDATE SET
+				listens = GREATEST(reviews.rating_placeholders.listens, EXCLUDED.listens),
+				last_listened = GREATEST(reviews.rating_placeholders.last_listened, EXCLUDED.last_listened)`,
+				member.ID, placeholders[i].MediaID, placeholders[i].Source,
+				placeholders[i].Listens, placeholders[i].LastListened, member.UUID)
+			if err != nil {
+				return 0, fmt.Errorf("error saving rating placeholder for %s: %w", placeholders[i].MediaID, err)
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return 0, fmt.Errorf("error checking affected rows: %w", err)
+			}
+			saved += int(n)
+		}
+		if err = tx.Commit(); err != nil {
+			return 0, fmt.Errorf("error saving rating placeholders: %w", err)
+		}
+		return saved, nil
+	}
+}
@@ -19,7 +19,7 @@ type studioKind string
 const (
 	FilmStudio     studioKind = "film"
 	Music          studioKind = "music"
-	Game           studioKind = "game"
+	GameStudio     studioKind = "game"
 	TV             studioKind = "tv"
 	Publishing     studioKind = "publishing"
 	VisualArtOther studioKind = "visual_art_other"
@@ -56,6 +56,7 @@ type (
 		Residence  places.Place   `json:"residence,omitempty" db:"residence"`
 		Added      time.Time      `json:"added,omitempty" db:"added"`
 		Modified   sql.NullTime   `json:"modified,omitempty" db:"modified"`
+		MBID       uuid.NullUUID  `json:"mbid,omitempty" db:"mbid" swaggertype:"string"`
 	}
 
 	Group struct {
@@ -78,6 +79,7 @@ type (
 		Bandcamp        sql.NullString `json:"bandcamp,omitempty" db:"bandcamp"`
 		Soundcloud      sql.NullString `json:"soundcloud,omitempty" db:"soundcloud"`
 		Bio             sql.NullString `json:"bio,omitempty" db:"bio"`
+		MBID            uuid.NullUUID  `json:"mbid,omitempty" db:"mbid" swaggertype:"string"`
 	}
 
 	Studio struct {
@@ -103,7 +105,7 @@ func (s studioKind) valid() bool {
 	return lo.Contains([]studioKind{
 		FilmStudio,
 		Music,
-		Game,
+		GameStudio,
 		TV,
 		Publishing,
 		VisualArtOther,
@@ -0,0 +1,185 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// ResolveArtist returns the person or group with the given name, adding it if it's not
+// in the database yet. Import sources usually can't tell more than the name, so the
+// rest of the details is left for the members to fill in
+func (p *PeopleStorage) ResolveArtist(ctx context.Context, name string, group bool) (*AlbumArtist, error) {
+	return p.resolveArtist(ctx, uuid.NullUUID{}, name, group)
+}
+
+// ResolveArtistMBID is like ResolveArtist, but looks up the artist by its MusicBrainz ID
+// first. An artist found by name is only reused if it has no MBID yet, in which case
+// it's assigned the given one
+func (p *PeopleStorage) ResolveArtistMBID(ctx context.Context, mbid uuid.UUID, name string, group bool) (*AlbumArtist, error) {
+	return p.resolveArtist(ctx, uuid.NullUUID{UUID: mbid, Valid: true}, name, group)
+}
+
+// FindArtist looks the artist up like ResolveArtistMBID does, by the MBID if it's valid and then
+// by the name, but never adds it. sql.ErrNoRows is returned if the artist isn't in the database
+func (p *PeopleStorage) FindArtist(ctx context.Context, mbid uuid.NullUUID, name string, group bool) (*AlbumArtist, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		artist, _, err := p.findArtist(ctx, mbid, name, group)
+		return artist, err
+	}
+}
+
+func (p *PeopleStorage) resolveArtist(ctx context.Context, mbid uuid.NullUUID, name string, group bool) (*AlbumArtist, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		artist, byName, err := p.findArtist(ctx, mbid, name, group)
+		switch {
+		case err == nil:
+			if byName && mbid.Valid {
+				table := "people.person"
+				if group {
+					table = `people."group"`
+				}
+				_, err = p.dbConn.ExecContext(ctx, `UPDATE `+table+` SET mbid = $1 WHERE id = $2`, mbid, artist.ID)
+				if err != nil {
+					return nil, fmt.Errorf("error setting the MBID of %s: %w", artist.Name, err)
+				}
+			}
+			return artist, nil
+		case !errors.Is(err, sql.ErrNoRows):
+			return nil, err
+		}
+
+		var args []any
+		insert := `INSERT INTO people.person (first_name, last_name, mbid) VALUES ($1, $2, $3) RETURNING id`
+		if group {
+			insert = `INSERT INTO people."group" (name, mbid) VALUES ($1, $2) RETURNING id`
+			args = []any{artist.Name, mbid}
+		} else {
+			firstName, lastName := SplitName(artist.Name)
+			args = []any{firstName, lastName, mbid}
+		}
+		if err = p.dbConn.GetContext(ctx, &artist.ID, insert, args...); err != nil {
+			return nil, fmt.Errorf("error adding artist %s: %w", artist.Name, err)
+		}
+		p.logger.Debug().Msgf("added %s artist %s (%s)", artist.ArtistType, artist.Name, artist.ID)
+		return artist, nil
+	}
+}
+
+// findArtist also tells whether the artist was found by the name rather than the MBID. If it's not
+// found, the returned artist has only the name and type set, along with sql.ErrNoRows
+func (p *PeopleStorage) findArtist(ctx context.Context, mbid uuid.NullUUID, name string, group bool) (*AlbumArtist, bool, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, false, fmt.Errorf("artist name cannot be empty")
+	}
+	var (
+		artist = AlbumArtist{Name: name, ArtistType: "individual"}
+		table  = "people.person"
+		lookup = `(lower(first_name) = lower($1) AND lower(last_name) = lower($2)) OR $3 = ANY(nick_names)`
+	)
+	firstName, lastName := SplitName(name)
+	args := []any{firstName, lastName, name}
+	if group {
+		artist.ArtistType = "group"
+		table = `people."group"`
+		lookup = `lower(name) = lower($1)`
+		args = []any{name}
+	}
+
+	if mbid.Valid {
+		err := p.dbConn.GetContext(ctx, &artist.ID, `SELECT id FROM `+table+` WHERE mbid = $1`, mbid)
+		if err == nil {
+			return &artist, false, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, false, fmt.Errorf("error looking up artist %s: %w", mbid.UUID, err)
+		}
+	}
+
+	err := p.dbConn.GetContext(ctx, &artist.ID, `SELECT id FROM `+table+` WHERE (`+lookup+`)
+		AND (mbid IS NULL OR NOT $`+fmt.Sprint(len(args)+1)+`)
+		LIMIT 1`, append(args, mbid.Valid)...)
+	switch {
+	case err == nil:
+		return &artist, true, nil
+	case errors.Is(err, sql.ErrNoRows):
+		return &artist, false, err
+	default:
+		return nil, false, fmt.Errorf("error looking up artist %s: %w", name, err)
+	}
+}
+
+// SplitName splits a full name into the first and last name. The last name is empty
+// for mononyms and pseudonyms consisting of a single word
+func SplitName(name string) (firstName, lastName string) {
+	fields := strings.Fields(name)
+	if len(fields) < 2 {
+		return strings.Join(fields, ""), ""
+	}
+	return strings.Join(fields[:len(fields)-1], " "), fields[len(fields)-1]
+}
+
+// ResolveStudio returns the studio, label or publisher of the given kind, adding it if necessary
+func (p *PeopleStorage) ResolveStudio(ctx context.Context, name string, kind StudioKind) (*Studio, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		studio, err := p.FindStudio(ctx, name, kind)
+		if err == nil {
+			return studio, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		err = p.dbConn.GetContext(ctx, &studio.ID, `INSERT INTO people.studio (name, kind)
+			VALUES ($1, $2) RETURNING id_numeric`, studio.Name, studio.Kinds[0])
+		if err != nil {
+			return nil, fmt.Errorf("error adding studio %s: %w", studio.Name, err)
+		}
+		p.logger.Debug().Msgf("added %s studio %s (%d)", studio.Kinds[0], studio.Name, studio.ID)
+		return studio, nil
+	}
+}
+
+// FindStudio looks up the studio of the given kind by its name, ignoring case. If there's none,
+// sql.ErrNoRows is returned along with the studio that ResolveStudio would add
+func (p *PeopleStorage) FindStudio(ctx context.Context, name string, kind StudioKind) (*Studio, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sk, ok := kind.(studioKind)
+		if !ok || !sk.valid() {
+			return nil, fmt.Errorf("invalid studio kind %v", kind)
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("studio name cannot be empty")
+		}
+		studio := Studio{Name: name, Active: true, Kinds: []studioKind{sk}}
+		// the serial ID was renamed to id_numeric when studios got UUIDs for syncing with CouchDB
+		err := p.dbConn.GetContext(ctx, &studio.ID, `SELECT id_numeric FROM people.studio
+			WHERE lower(name) = lower($1) AND kind = $2
+			LIMIT 1`, name, sk)
+		switch {
+		case err == nil:
+			return &studio, nil
+		case errors.Is(err, sql.ErrNoRows):
+			return &studio, err
+		default:
+			return nil, fmt.Errorf("error looking up studio %s: %w", name, err)
+		}
+	}
+}
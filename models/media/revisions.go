@@ -0,0 +1,470 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// The kinds of objects whose edits are recorded as revisions
+const (
+	RevisionMedia  = "media"
+	RevisionAlbum  = "album"
+	RevisionFilm   = "film"
+	RevisionBook   = "book"
+	RevisionPerson = "person"
+	RevisionGenre  = "genre"
+)
+
+var (
+	// ErrUnknownTarget is returned for edits of objects which aren't revised
+	ErrUnknownTarget = errors.New("unknown revision target")
+	// ErrNoChanges is returned when the edit leaves the object as it was
+	ErrNoChanges = errors.New("nothing changed")
+	// ErrInvalidKey is returned for malformed IDs of the revised objects
+	ErrInvalidKey = errors.New("invalid ID")
+)
+
+type (
+	// Revision is a single edit, with the complete object before and after it
+	Revision struct {
+		ID       int64           `json:"id" db:"id"`
+		Target   string          `json:"target" db:"target" enum:"media,album,film,book,person,genre" example:"album"`
+		TargetID string          `json:"target_id" db:"target_id" example:"2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21"`
+		Before   json.RawMessage `json:"before" db:"before" swaggertype:"object"`
+		After    json.RawMessage `json:"after" db:"after" swaggertype:"object"`
+		Editor   string          `json:"editor" db:"editor" example:"lain@librate.club"`
+		Summary  string          `json:"summary" db:"summary" example:"Fixed the release date"`
+		// the revision whose changes were undone by this one
+		Reverts sql.NullInt64 `json:"reverts,omitempty" db:"reverts"`
+		Created time.Time     `json:"created" db:"created"`
+	}
+
+	// FieldChange is a field which differs between two revisions. Nested fields are
+	// separated with dots, e.g. "tracks.2.name"
+	FieldChange struct {
+		Field  string          `json:"field" example:"release_date"`
+		Before json.RawMessage `json:"before,omitempty" swaggertype:"object"`
+		After  json.RawMessage `json:"after,omitempty" swaggertype:"object"`
+	}
+
+	// revisable loads and saves the revised object within the transaction of the edit
+	revisable struct {
+		// parseKey validates the ID and returns its canonical form
+		parseKey func(id string) (string, error)
+		load     func(ctx context.Context, tx *sqlx.Tx, key string) (any, error)
+		save     func(ctx context.Context, tx *sqlx.Tx, key string, doc any) error
+	}
+)
+
+//nolint:gochecknoglobals // a lookup table
+var revisables = map[string]revisable{
+	RevisionMedia:  {parseKey: parseUUIDKey, load: loadMediaRevision, save: saveMediaRevision},
+	RevisionAlbum:  {parseKey: parseUUIDKey, load: loadAlbumRevision, save: saveAlbumRevision},
+	RevisionFilm:   {parseKey: parseUUIDKey, load: loadFilmRevision, save: saveFilmRevision},
+	RevisionBook:   {parseKey: parseUUIDKey, load: loadBookRevision, save: saveBookRevision},
+	RevisionPerson: {parseKey: parseUUIDKey, load: loadPersonRevision, save: savePersonRevision},
+	RevisionGenre:  {parseKey: parseGenreKey, load: loadGenreRevision, save: saveGenreRevision},
+}
+
+// Revise applies the edit to the object and records the revision. The document is merged
+// onto the current state of the object, so only the changed fields need to be sent. IDs,
+// the media kind and the moderation status can't be edited, and the tracks of an album can
+// be renamed or renumbered, but not added or removed
+func (ms *Storage) Revise(
+	ctx context.Context,
+	target, id string,
+	doc json.RawMessage,
+	editor, summary string,
+) (*Revision, error) {
+	return ms.revise(ctx, target, id, doc, editor, summary, sql.NullInt64{})
+}
+
+// Revert restores the object to its state before the given revision, undoing the later
+// revisions too. The revert is recorded as a new revision
+func (ms *Storage) Revert(ctx context.Context, revisionID int64, editor, summary string) (*Revision, error) {
+	reverted, err := ms.Revision(ctx, revisionID)
+	if err != nil {
+		return nil, err
+	}
+	if summary == "" {
+		summary = fmt.Sprintf("Reverted to the version before revision %d", revisionID)
+	}
+	return ms.revise(ctx, reverted.Target, reverted.TargetID, reverted.Before, editor, summary,
+		sql.NullInt64{Int64: revisionID, Valid: true})
+}
+
+func (ms *Storage) revise(
+	ctx context.Context,
+	target, id string,
+	doc json.RawMessage,
+	editor, summary string,
+	reverts sql.NullInt64,
+) (*Revision, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r, ok := revisables[target]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownTarget, target)
+		}
+		key, err := r.parseKey(id)
+		if err != nil {
+			return nil, err
+		}
+
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		object, err := r.load(ctx, tx, key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading %s %s: %w", target, key, err)
+		}
+		rev := Revision{Target: target, TargetID: key, Editor: editor, Summary: summary, Reverts: reverts}
+		if rev.Before, err = json.Marshal(object); err != nil {
+			return nil, fmt.Errorf("error serializing %s %s: %w", target, key, err)
+		}
+		// unmarshaling onto the loaded object keeps the fields missing from the document
+		if err = json.Unmarshal(doc, object); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", target, err)
+		}
+		if err = r.save(ctx, tx, key, object); err != nil {
+			return nil, fmt.Errorf("error saving %s %s: %w", target, key, err)
+		}
+		// loading it again drops what the edit couldn't change
+		if object, err = r.load(ctx, tx, key); err != nil {
+			return nil, fmt.Errorf("error loading %s %s: %w", target, key, err)
+		}
+		if rev.After, err = json.Marshal(object); err != nil {
+			return nil, fmt.Errorf("error serializing %s %s: %w", target, key, err)
+		}
+		if bytes.Equal(rev.Before, rev.After) {
+			return nil, ErrNoChanges
+		}
+
+		err = tx.QueryRowxContext(ctx, `INSERT INTO media.revisions
+			(target, target_id, "before", "after", editor, summary, reverts)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id, created`,
+			rev.Target, rev.TargetID, rev.Before, rev.After, rev.Editor, rev.Summary, rev.Reverts).
+			Scan(&rev.ID, &rev.Created)
+		if err != nil {
+			return nil, fmt.Errorf("error saving the revision of %s %s: %w", target, key, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, fmt.Errorf("error editing %s %s: %w", target, key, err)
+		}
+		return &rev, nil
+	}
+}
+
+// Revisions lists the revisions of the object, newest first
+func (ms *Storage) Revisions(ctx context.Context, target, id string, limit, offset int) ([]Revision, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		r, ok := revisables[target]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownTarget, target)
+		}
+		key, err := r.parseKey(id)
+		if err != nil {
+			return nil, err
+		}
+		revisions := make([]Revision, 0)
+		err = ms.db.SelectContext(ctx, &revisions, `SELECT * FROM media.revisions
+			WHERE target = $1 AND target_id = $2
+			ORDER BY created DESC, id DESC
+			LIMIT $3 OFFSET $4`, target, key, limit, offset)
+		if err != nil {
+			return nil, fmt.Errorf("error listing the revisions of %s %s: %w", target, key, err)
+		}
+		return revisions, nil
+	}
+}
+
+// Revision returns a single revision
+func (ms *Storage) Revision(ctx context.Context, id int64) (*Revision, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		var rev Revision
+		if err := ms.db.GetContext(ctx, &rev, `SELECT * FROM media.revisions WHERE id = $1`, id); err != nil {
+			return nil, fmt.Errorf("error getting revision %d: %w", id, err)
+		}
+		return &rev, nil
+	}
+}
+
+// Diff lists the fields which differ between the two versions of an object, in alphabetical
+// order. Objects are compared field by field, while arrays of different lengths are reported
+// as a whole
+func Diff(before, after json.RawMessage) ([]FieldChange, error) {
+	var a, b any
+	if len(before) > 0 {
+		if err := json.Unmarshal(before, &a); err != nil {
+			return nil, fmt.Errorf("error reading the old version: %w", err)
+		}
+	}
+	if len(after) > 0 {
+		if err := json.Unmarshal(after, &b); err != nil {
+			return nil, fmt.Errorf("error reading the new version: %w", err)
+		}
+	}
+	changes := make([]FieldChange, 0)
+	diffValues("", a, b, &changes)
+	return changes, nil
+}
+
+func diffValues(path string, a, b any, changes *[]FieldChange) {
+	switch av := a.(type) {
+	case map[string]any:
+		if bv, ok := b.(map[string]any); ok {
+			keys := make([]string, 0, len(av)+len(bv))
+			for k := range av {
+				keys = append(keys, k)
+			}
+			for k := range bv {
+				if _, ok := av[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				diffValues(joinPath(path, k), av[k], bv[k], changes)
+			}
+			return
+		}
+	case []any:
+		if bv, ok := b.([]any); ok && len(av) == len(bv) {
+			for i := range av {
+				diffValues(joinPath(path, strconv.Itoa(i)), av[i], bv[i], changes)
+			}
+			return
+		}
+	}
+	before, _ := json.Marshal(a)
+	after, _ := json.Marshal(b)
+	if !bytes.Equal(before, after) {
+		*changes = append(*changes, FieldChange{Field: path, Before: before, After: after})
+	}
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func parseUUIDKey(id string) (string, error) {
+	parsed, err := uuid.FromString(id)
+	if err != nil {
+		return "", fmt.Errorf("%w %q: %v", ErrInvalidKey, id, err)
+	}
+	return parsed.String(), nil
+}
+
+func parseGenreKey(id string) (string, error) {
+	parsed, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("%w %q: %v", ErrInvalidKey, id, err)
+	}
+	return strconv.FormatInt(parsed, 10), nil
+}
+
+func loadMediaRevision(ctx context.Context, tx *sqlx.Tx, key string) (any, error) {
+	var m Media
+	err := tx.GetContext(ctx, &m, `SELECT id, title, kind, created, creator, added, modified, status
+		FROM media.media WHERE id = $1 FOR UPDATE`, key)
+	if err != nil {
+		return nil, err
+	}
+	m.Titles, err = loadTitles(ctx, tx, key)
+	return &m, err
+}
+
+func saveMediaRevision(ctx context.Context, tx *sqlx.Tx, key string, doc any) error {
+	m := doc.(*Media)
+	_, err := tx.ExecContext(ctx, `UPDATE media.media SET title = $1, created = $2, creator = $3 WHERE id = $4`,
+		m.Title, m.Created, m.Creator, key)
+	if err != nil {
+		return err
+	}
+	return saveTitles(ctx, tx, key, m.Titles)
+}
+
+func loadAlbumRevision(ctx context.Context, tx *sqlx.Tx, key string) (any, error) {
+	var album Album
+	err := tx.GetContext(ctx, &album, `SELECT media_id, name, release_date, duration, mbid, edition
+		FROM media.albums WHERE media_id = $1 FOR UPDATE`, key)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.SelectContext(ctx, &album.AlbumArtists, `SELECT artist, artist_type
+		FROM media.album_artists WHERE album = $1 ORDER BY artist`, key)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.SelectContext(ctx, &album.Genres, `SELECT g.id, g.name
+		FROM media.album_genres AS ag
+		JOIN media.genres AS g ON g.id = ag.genre
+		WHERE ag.album = $1 ORDER BY g.id`, key)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.SelectContext(ctx, &album.Tracks, `SELECT media_id, name, album, duration, lyrics, track_number, mbid
+		FROM media.tracks WHERE album = $1 ORDER BY track_number, media_id`, key)
+	return &album, err
+}
+
+func saveAlbumRevision(ctx context.Context, tx *sqlx.Tx, key string, doc any) error {
+	album := doc.(*Album)
+	_, err := tx.ExecContext(ctx, `UPDATE media.albums SET name = $1, release_date = $2, duration = $3, mbid = $4, edition = $5
+		WHERE media_id = $6`, album.Name, album.ReleaseDate, album.Duration, album.MBID, album.Edition, key)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `UPDATE media.media SET title = $1 WHERE id = $2`, album.Name, key); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM media.album_artists WHERE album = $1`, key); err != nil {
+		return err
+	}
+	for i := range album.AlbumArtists {
+		_, err = tx.ExecContext(ctx, `INSERT INTO media.album_artists (album, artist, artist_type)
+			VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`, key, album.AlbumArtists[i].ID, album.AlbumArtists[i].ArtistType)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM media.album_genres WHERE album = $1`, key); err != nil {
+		return err
+	}
+	for i := range album.Genres {
+		_, err = tx.ExecContext(ctx, `INSERT INTO media.album_genres (album, genre)
+			VALUES ($1, $2) ON CONFLICT DO NOTHING`, key, album.Genres[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range album.Tracks {
+		track := &album.Tracks[i]
+		if track.MediaID == nil {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE media.tracks
+			SET name = $1, track_number = $2, duration = $3, lyrics = $4, mbid = $5
+			WHERE media_id = $6 AND album = $7`,
+			track.Name, track.Number, track.Duration, track.Lyrics, track.MBID, track.MediaID, key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadFilmRevision(ctx context.Context, tx *sqlx.Tx, key string) (any, error) {
+	var film Film
+	err := tx.GetContext(ctx, &film, `SELECT media_id, title, release_date, duration, synopsis
+		FROM media.films WHERE media_id = $1 FOR UPDATE`, key)
+	return &film, err
+}
+
+func saveFilmRevision(ctx context.Context, tx *sqlx.Tx, key string, doc any) error {
+	film := doc.(*Film)
+	_, err := tx.ExecContext(ctx, `UPDATE media.films SET title = $1, release_date = $2, duration = $3, synopsis = $4
+		WHERE media_id = $5`, film.Title, film.ReleaseDate, film.Duration, film.Synopsis, key)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE media.media SET title = $1 WHERE id = $2`, film.Title, key)
+	return err
+}
+
+func loadBookRevision(ctx context.Context, tx *sqlx.Tx, key string) (any, error) {
+	var book Book
+	err := tx.GetContext(ctx, &book, `SELECT media_id, title, publication_date, keywords, pages, isbn, asin, cover, summary, edition
+		FROM media.books WHERE media_id = $1 FOR UPDATE`, key)
+	return &book, err
+}
+
+func saveBookRevision(ctx context.Context, tx *sqlx.Tx, key string, doc any) error {
+	book := doc.(*Book)
+	_, err := tx.ExecContext(ctx, `UPDATE media.books
+		SET title = $1, publication_date = $2, keywords = $3, pages = $4, isbn = $5, asin = $6, cover = $7, summary = $8,
+		edition = $9
+		WHERE media_id = $10`,
+		book.Title, book.PublicationDate, book.Keywords, book.Pages, book.ISBN, book.ASIN, book.Cover, book.Summary,
+		book.Edition, key)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE media.media SET title = $1 WHERE id = $2`, book.Title, key)
+	return err
+}
+
+func loadPersonRevision(ctx context.Context, tx *sqlx.Tx, key string) (any, error) {
+	var person Person
+	err := tx.GetContext(ctx, &person, `SELECT id, first_name, other_names, last_name, nick_names, roles,
+		birth, death, website, bio, added, modified, mbid
+		FROM people.person WHERE id = $1 FOR UPDATE`, key)
+	return &person, err
+}
+
+func savePersonRevision(ctx context.Context, tx *sqlx.Tx, key string, doc any) error {
+	p := doc.(*Person)
+	_, err := tx.ExecContext(ctx, `UPDATE people.person
+		SET first_name = $1, other_names = $2, last_name = $3, nick_names = $4, roles = $5,
+			birth = $6, death = $7, website = $8, bio = $9, mbid = $10
+		WHERE id = $11`,
+		p.FirstName, p.OtherNames, p.LastName, p.NickNames, p.Roles, p.Birth, p.Death, p.Website, p.Bio, p.MBID, key)
+	return err
+}
+
+func loadGenreRevision(ctx context.Context, tx *sqlx.Tx, key string) (any, error) {
+	var genre Genre
+	err := tx.GetContext(ctx, &genre, `SELECT id, name, kinds AS kind, parent
+		FROM media.genres WHERE id = $1 FOR UPDATE`, key)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.SelectContext(ctx, &genre.Description, `SELECT genre_id, language, description
+		FROM media.genre_descriptions WHERE genre_id = $1 ORDER BY language`, key)
+	return &genre, err
+}
+
+// saveGenreRevision updates the descriptions in the languages the genre is described in already
+func saveGenreRevision(ctx context.Context, tx *sqlx.Tx, key string, doc any) error {
+	genre := doc.(*Genre)
+	_, err := tx.ExecContext(ctx, `UPDATE media.genres SET name = $1, kinds = $2, parent = $3 WHERE id = $4`,
+		genre.Name, pq.Array(genre.Kinds), genre.ParentGenreID, key)
+	if err != nil {
+		return err
+	}
+	for i := range genre.Description {
+		_, err = tx.ExecContext(ctx, `UPDATE media.genre_descriptions SET description = $1
+			WHERE genre_id = $2 AND language = $3`, genre.Description[i].Description, key, genre.Description[i].Language)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package media
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	before := json.RawMessage(`{
+		"name": "Mezzanine",
+		"release_date": "1998-04-02T00:00:00Z",
+		"genres": [{"id": 3, "name": "Trip Hop"}],
+		"tracks": [{"name": "Angel", "track_number": 1}, {"name": "Risingsun", "track_number": 2}]
+	}`)
+	after := json.RawMessage(`{
+		"name": "Mezzanine",
+		"release_date": "1998-04-20T00:00:00Z",
+		"genres": [{"id": 3, "name": "Trip Hop"}, {"id": 9, "name": "Downtempo"}],
+		"tracks": [{"name": "Angel", "track_number": 1}, {"name": "Risingson", "track_number": 2}],
+		"mbid": "2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21"
+	}`)
+
+	changes, err := Diff(before, after)
+	require.NoError(t, err)
+	require.Len(t, changes, 4)
+	assert.Equal(t, "genres", changes[0].Field, "arrays of different lengths should be reported as a whole")
+	assert.JSONEq(t, `[{"id": 3, "name": "Trip Hop"}, {"id": 9, "name": "Downtempo"}]`, string(changes[0].After))
+	assert.Equal(t, FieldChange{Field: "mbid", Before: json.RawMessage("null"), After: json.RawMessage(`"2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21"`)}, changes[1])
+	assert.Equal(t, "release_date", changes[2].Field)
+	assert.Equal(t, FieldChange{Field: "tracks.1.name", Before: json.RawMessage(`"Risingsun"`), After: json.RawMessage(`"Risingson"`)}, changes[3])
+
+	changes, err = Diff(after, after)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	_, err = Diff(json.RawMessage(`{"name":`), after)
+	assert.Error(t, err)
+}
+
+func TestParseRevisionKeys(t *testing.T) {
+	key, err := parseUUIDKey("2B5D1A8E-4C6E-4F4B-9D0B-6F0C4E7A1D21")
+	require.NoError(t, err)
+	assert.Equal(t, "2b5d1a8e-4c6e-4f4b-9d0b-6f0c4e7a1d21", key, "IDs should be stored in one form")
+	_, err = parseUUIDKey("42")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	key, err = parseGenreKey("0042")
+	require.NoError(t, err)
+	assert.Equal(t, "42", key)
+	_, err = parseGenreKey("trip-hop")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
@@ -0,0 +1,74 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PendingSubmission is an album or track found in an imported library, which isn't in the
+// catalog yet. It's kept until the member or a moderator adds the missing item
+type PendingSubmission struct {
+	ID          int64          `json:"id" db:"id"`
+	Kind        string         `json:"kind" db:"kind" example:"album"`
+	Title       string         `json:"title" db:"title" example:"Mezzanine"`
+	Artist      string         `json:"artist" db:"artist" example:"Massive Attack"`
+	Album       sql.NullString `json:"album,omitempty" db:"album"`
+	ReleaseYear sql.NullInt16  `json:"release_year,omitempty" db:"release_year"`
+	Source      string         `json:"source" db:"source" example:"rym"`
+	// the rating to add once the item is in the catalog, on the 0-1000 reference scale
+	Stars   sql.NullInt16 `json:"stars,omitempty" db:"stars"`
+	Listens int           `json:"listens" db:"listens"`
+	Created time.Time     `json:"created" db:"created"`
+}
+
+// AddPendingSubmissions saves the items missing from the catalog. Items submitted again by
+// the same member are updated instead. It returns the number of submissions saved
+func (ms *Storage) AddPendingSubmissions(
+	ctx context.Context,
+	memberName string,
+	submissions []PendingSubmission,
+) (saved int, err error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	default:
+		var memberID int
+		err = ms.db.GetContext(ctx, &memberID, `SELECT id_numeric FROM public.members WHERE nick = $1`, memberName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("member %s not found: %w", memberName, err)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error looking up member %s: %w", memberName, err)
+		}
+
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return 0, fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		for i := range submissions {
+			s := &submissions[i]
+			_, err = tx.ExecContext(ctx, `INSERT INTO media.submissions
+			(member_id, kind, title, artist, album, release_year, source, stars, listens)
+			VALUES ($1, $2::media.kind, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (member_id, kind, title, artist) DO UPDATE SET
+				album = COALESCE(EXCLUDED.album, media.submissions.album),
+				release_year = COALESCE(EXCLUDED.release_year, media.submissions.release_year),
+				stars = COALESCE(EXCLUDED.stars, media.submissions.stars),
+				listens = GREATEST(media.submissions.listens, EXCLUDED.listens)`,
+				memberID, s.Kind, s.Title, s.Artist, s.Album, s.ReleaseYear, s.Source, s.Stars, s.Listens)
+			if err != nil {
+				return 0, fmt.Errorf("error saving submission of %s %q: %w", s.Kind, s.Title, err)
+			}
+			saved++
+		}
+		if err = tx.Commit(); err != nil {
+			return 0, fmt.Errorf("error saving submissions: %w", err)
+		}
+		return saved, nil
+	}
+}
@@ -0,0 +1,155 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/text/language"
+)
+
+// The kinds of titles a media item can have besides the canonical one
+const (
+	// the title in the language the media was released in
+	TitleOriginal = "original"
+	// the original title transliterated to the Latin script, e.g. Ōkami for 大神
+	TitleRomanized = "romanized"
+	// the title the media was released under in another language
+	TitleLocalized = "localized"
+)
+
+// ErrInvalidTitle is returned for titles with an unknown kind or language
+var ErrInvalidTitle = errors.New("invalid title")
+
+// Title is one of the titles of a media item
+type Title struct {
+	Title string `json:"title" db:"title" example:"Ōkami"`
+	// BCP 47 language tag. Romanized titles are in the Latin script, e.g. ja-Latn
+	Language string `json:"language" db:"language" example:"ja-Latn"`
+	Kind     string `json:"kind" db:"kind" enum:"original,romanized,localized" example:"romanized"`
+}
+
+// NormalizeTitles validates the titles and canonicalizes their language tags.
+// A media item has a single original title and one title of each other kind per language
+func NormalizeTitles(titles []Title) error {
+	seen := make(map[string]bool, len(titles))
+	for i := range titles {
+		t := &titles[i]
+		t.Title = strings.TrimSpace(t.Title)
+		if t.Title == "" {
+			return fmt.Errorf("%w: the title is empty", ErrInvalidTitle)
+		}
+		tag, err := language.Parse(t.Language)
+		if err != nil {
+			return fmt.Errorf("%w %q: invalid language %q", ErrInvalidTitle, t.Title, t.Language)
+		}
+		key := t.Kind + "/" + tag.String()
+		switch t.Kind {
+		case TitleOriginal:
+			key = TitleOriginal
+		case TitleRomanized:
+			if tag, err = language.Compose(tag, language.MustParseScript("Latn")); err != nil {
+				return fmt.Errorf("%w %q: %v", ErrInvalidTitle, t.Title, err)
+			}
+			key = t.Kind + "/" + tag.String()
+		case TitleLocalized:
+		default:
+			return fmt.Errorf("%w %q: unknown kind %q", ErrInvalidTitle, t.Title, t.Kind)
+		}
+		if seen[key] {
+			return fmt.Errorf("%w %q: another %s title in %s", ErrInvalidTitle, t.Title, t.Kind, tag)
+		}
+		seen[key] = true
+		t.Language = tag.String()
+	}
+	return nil
+}
+
+// PreferredTitle picks the title to show to a viewer using the locale. The original or localized
+// title in the viewer's language comes first, then the romanized and original titles,
+// and the canonical title is used if none of them is known
+func PreferredTitle(canonical string, titles []Title, locale language.Tag) Title {
+	var (
+		tags       []language.Tag
+		candidates []Title
+		romanized  *Title
+		original   *Title
+	)
+	for i := range titles {
+		tag, err := language.Parse(titles[i].Language)
+		if err != nil {
+			continue
+		}
+		switch titles[i].Kind {
+		case TitleRomanized:
+			if romanized == nil {
+				romanized = &titles[i]
+			}
+			continue
+		case TitleOriginal:
+			original = &titles[i]
+			// the original wins over a localized title in the same language
+			tags = append([]language.Tag{tag}, tags...)
+			candidates = append([]Title{titles[i]}, candidates...)
+			continue
+		}
+		tags = append(tags, tag)
+		candidates = append(candidates, titles[i])
+	}
+
+	if len(tags) > 0 {
+		_, i, confidence := language.NewMatcher(tags).Match(locale)
+		if confidence >= language.High {
+			return candidates[i]
+		}
+	}
+	if romanized != nil {
+		return *romanized
+	}
+	if original != nil {
+		return *original
+	}
+	return Title{Title: canonical}
+}
+
+// Titles returns the original, romanized and localized titles of the media item
+func (ms *Storage) Titles(ctx context.Context, mediaID uuid.UUID) ([]Title, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		return loadTitles(ctx, ms.db, mediaID.String())
+	}
+}
+
+func loadTitles(ctx context.Context, q sqlx.QueryerContext, mediaID string) ([]Title, error) {
+	titles := make([]Title, 0)
+	err := sqlx.SelectContext(ctx, q, &titles, `SELECT title, "language", kind
+		FROM media.titles WHERE media_id = $1
+		ORDER BY kind, "language"`, mediaID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the titles of %s: %w", mediaID, err)
+	}
+	return titles, nil
+}
+
+// saveTitles replaces the titles of the media item
+func saveTitles(ctx context.Context, tx *sqlx.Tx, mediaID string, titles []Title) error {
+	if err := NormalizeTitles(titles); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM media.titles WHERE media_id = $1`, mediaID); err != nil {
+		return fmt.Errorf("error deleting the titles of %s: %w", mediaID, err)
+	}
+	for i := range titles {
+		_, err := tx.ExecContext(ctx, `INSERT INTO media.titles (media_id, title, "language", kind)
+			VALUES ($1, $2, $3, $4)`, mediaID, titles[i].Title, titles[i].Language, titles[i].Kind)
+		if err != nil {
+			return fmt.Errorf("error adding title %s of %s: %w", titles[i].Title, mediaID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package media
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+)
+
+func TestNormalizeTitles(t *testing.T) {
+	titles := []Title{
+		{Title: " 大神 ", Language: "ja", Kind: TitleOriginal},
+		{Title: "Ōkami", Language: "ja", Kind: TitleRomanized},
+		{Title: "Okami", Language: "en-us", Kind: TitleLocalized},
+	}
+	require.NoError(t, NormalizeTitles(titles))
+	assert.Equal(t, "大神", titles[0].Title)
+	assert.Equal(t, "ja-Latn", titles[1].Language, "romanized titles are in the Latin script")
+	assert.Equal(t, "en-US", titles[2].Language)
+
+	for name, titles := range map[string][]Title{
+		"empty title":      {{Title: " ", Language: "ja", Kind: TitleOriginal}},
+		"unknown language": {{Title: "Okami", Language: "english", Kind: TitleLocalized}},
+		"unknown kind":     {{Title: "Okami", Language: "en", Kind: "alternative"}},
+		"two originals": {
+			{Title: "大神", Language: "ja", Kind: TitleOriginal},
+			{Title: "Okami", Language: "en", Kind: TitleOriginal},
+		},
+		"two titles in a language": {
+			{Title: "Okami", Language: "en", Kind: TitleLocalized},
+			{Title: "Ōkami", Language: "EN", Kind: TitleLocalized},
+		},
+	} {
+		assert.ErrorIs(t, NormalizeTitles(titles), ErrInvalidTitle, name)
+	}
+}
+
+func TestPreferredTitle(t *testing.T) {
+	titles := []Title{
+		{Title: "Okami", Language: "en-US", Kind: TitleLocalized},
+		{Title: "Ōkami", Language: "ja-Latn", Kind: TitleRomanized},
+		{Title: "大神", Language: "ja", Kind: TitleOriginal},
+		{Title: "Ōkami – Zew Wilka", Language: "pl", Kind: TitleLocalized},
+	}
+	for locale, want := range map[string]string{
+		"ja":    "大神",
+		"ja-JP": "大神",
+		"en":    "Okami",
+		"en-GB": "Okami",
+		"pl":    "Ōkami – Zew Wilka",
+		"de":    "Ōkami",
+	} {
+		assert.Equal(t, want, PreferredTitle("Okami", titles, language.MustParse(locale)).Title, locale)
+	}
+	assert.Equal(t, "大神", PreferredTitle("Okami", titles[2:3], language.German).Title)
+	assert.Equal(t, "Mezzanine", PreferredTitle("Mezzanine", nil, language.German).Title)
+}
@@ -0,0 +1,247 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrKindMismatch is returned when an edition is added to a work of another media kind
+	ErrKindMismatch = errors.New("the media item and the work are of different kinds")
+	// ErrNoEditions is returned when a work is created without editions
+	ErrNoEditions = errors.New("the work has no editions")
+)
+
+type (
+	// Work groups the editions of the same album or book. For albums it's the release group,
+	// with the original release, remasters and deluxe editions as its editions.
+	// For books, the editions may also be translations
+	Work struct {
+		ID       uuid.UUID `json:"id" db:"id"`
+		Kind     string    `json:"kind" db:"kind" enum:"album,book" example:"album"`
+		Title    string    `json:"title" db:"title" example:"Mezzanine"`
+		Created  time.Time `json:"created" db:"created"`
+		Editions []Edition `json:"editions" db:"-"`
+	}
+
+	// Edition is a media item which belongs to a work
+	Edition struct {
+		MediaID uuid.UUID `json:"media_id" db:"media_id"`
+		Title   string    `json:"title" db:"title" example:"Mezzanine"`
+		// what sets the edition apart from the others
+		Edition  string       `json:"edition,omitempty" db:"edition" example:"2019 remaster"`
+		Released sql.NullTime `json:"released,omitempty" db:"released" swaggertype:"string"`
+	}
+
+	// editionTable describes where the editions of the works of a kind are stored
+	editionTable struct {
+		table, title, released string
+	}
+)
+
+//nolint:gochecknoglobals // lookup table
+var editionTables = map[string]editionTable{
+	"album": {table: "media.albums", title: "name", released: "release_date"},
+	"book":  {table: "media.books", title: "title", released: "publication_date"},
+}
+
+// IsWorkKind reports whether the media of the kind can be grouped into works
+func IsWorkKind(kind string) bool {
+	_, ok := editionTables[kind]
+	return ok
+}
+
+// CreateWork adds the work along with its editions, which must be of the same kind
+func (ms *Storage) CreateWork(ctx context.Context, work *Work) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if !IsWorkKind(work.Kind) {
+			return fmt.Errorf("%w %s", ErrUnknownTarget, work.Kind)
+		}
+		if len(work.Editions) == 0 {
+			return ErrNoEditions
+		}
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		err = tx.GetContext(ctx, work, `INSERT INTO media.works (kind, title) VALUES ($1, $2)
+			RETURNING id, kind, title, created`, work.Kind, strings.TrimSpace(work.Title))
+		if err != nil {
+			return fmt.Errorf("error adding work %s: %w", work.Title, err)
+		}
+		for i := range work.Editions {
+			previous, err := setEdition(ctx, tx, work.ID, work.Kind, &work.Editions[i])
+			if err != nil {
+				return err
+			}
+			if err = deleteIfEmpty(ctx, tx, previous); err != nil {
+				return err
+			}
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error saving work %s: %w", work.Title, err)
+		}
+		return nil
+	}
+}
+
+// AddEdition adds the media item to the work, moving it from its previous work if it had one.
+// If the item is already one of the editions of the work, only its label is changed
+func (ms *Storage) AddEdition(ctx context.Context, workID uuid.UUID, edition *Edition) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		var kind string
+		if err = tx.GetContext(ctx, &kind, `SELECT kind FROM media.works WHERE id = $1 FOR UPDATE`, workID); err != nil {
+			return fmt.Errorf("error getting work %s: %w", workID, err)
+		}
+		previous, err := setEdition(ctx, tx, workID, kind, edition)
+		if err != nil {
+			return err
+		}
+		if previous.UUID != workID {
+			if err = deleteIfEmpty(ctx, tx, previous); err != nil {
+				return err
+			}
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error adding edition %s to work %s: %w", edition.MediaID, workID, err)
+		}
+		return nil
+	}
+}
+
+// setEdition links the media item to the work, checking that it's of the kind of the work.
+// It returns the work the item belonged to before
+func setEdition(ctx context.Context, tx *sqlx.Tx, workID uuid.UUID, kind string, edition *Edition) (uuid.NullUUID, error) {
+	var mediaKind string
+	if err := tx.GetContext(ctx, &mediaKind, `SELECT kind FROM media.media WHERE id = $1`, edition.MediaID); err != nil {
+		return uuid.NullUUID{}, fmt.Errorf("error getting media %s: %w", edition.MediaID, err)
+	}
+	if mediaKind != kind {
+		return uuid.NullUUID{}, fmt.Errorf("%w: %s %s isn't a %s", ErrKindMismatch, mediaKind, edition.MediaID, kind)
+	}
+	t := editionTables[kind]
+	var previous uuid.NullUUID
+	err := tx.GetContext(ctx, &previous, fmt.Sprintf(`SELECT work FROM %s WHERE media_id = $1 FOR UPDATE`, t.table),
+		edition.MediaID)
+	if err != nil {
+		return uuid.NullUUID{}, fmt.Errorf("error getting %s %s: %w", kind, edition.MediaID, err)
+	}
+	err = tx.GetContext(ctx, edition, fmt.Sprintf(`UPDATE %s SET work = $1, edition = $2 WHERE media_id = $3
+		RETURNING media_id, %s AS title, edition, %s AS released`, t.table, t.title, t.released),
+		workID, strings.TrimSpace(edition.Edition), edition.MediaID)
+	if err != nil {
+		return uuid.NullUUID{}, fmt.Errorf("error adding edition %s to work %s: %w", edition.MediaID, workID, err)
+	}
+	return previous, nil
+}
+
+// RemoveEdition detaches the media item from the work. The work is deleted along with its last edition
+func (ms *Storage) RemoveEdition(ctx context.Context, workID, mediaID uuid.UUID) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		tx, err := ms.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		var kind string
+		if err = tx.GetContext(ctx, &kind, `SELECT kind FROM media.works WHERE id = $1 FOR UPDATE`, workID); err != nil {
+			return fmt.Errorf("error getting work %s: %w", workID, err)
+		}
+		res, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET work = NULL WHERE media_id = $1 AND work = $2`,
+			editionTables[kind].table), mediaID, workID)
+		if err != nil {
+			return fmt.Errorf("error removing edition %s from work %s: %w", mediaID, workID, err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return fmt.Errorf("%s isn't an edition of work %s: %w", mediaID, workID, sql.ErrNoRows)
+		}
+		if err = deleteIfEmpty(ctx, tx, uuid.NullUUID{UUID: workID, Valid: true}); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error removing edition %s from work %s: %w", mediaID, workID, err)
+		}
+		return nil
+	}
+}
+
+// deleteIfEmpty removes the work if it's left without editions, e.g. when its only edition was moved
+func deleteIfEmpty(ctx context.Context, tx *sqlx.Tx, work uuid.NullUUID) error {
+	if !work.Valid {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM media.works AS w WHERE id = $1
+		AND NOT EXISTS (SELECT 1 FROM media.albums WHERE work = w.id)
+		AND NOT EXISTS (SELECT 1 FROM media.books WHERE work = w.id)`, work.UUID)
+	if err != nil {
+		return fmt.Errorf("error deleting empty work %s: %w", work.UUID, err)
+	}
+	return nil
+}
+
+// GetWork returns the work with its editions, oldest first
+func (ms *Storage) GetWork(ctx context.Context, id uuid.UUID) (*Work, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		var work Work
+		err := ms.db.GetContext(ctx, &work, `SELECT id, kind, title, created FROM media.works WHERE id = $1`, id)
+		if err != nil {
+			return nil, fmt.Errorf("error getting work %s: %w", id, err)
+		}
+		t, ok := editionTables[work.Kind]
+		if !ok {
+			return nil, fmt.Errorf("%w %s", ErrUnknownTarget, work.Kind)
+		}
+		err = ms.db.SelectContext(ctx, &work.Editions, fmt.Sprintf(`SELECT media_id, %s AS title, edition, %s AS released
+			FROM %s WHERE work = $1
+			ORDER BY released NULLS LAST, media_id`, t.title, t.released, t.table), id)
+		if err != nil {
+			return nil, fmt.Errorf("error getting the editions of work %s: %w", id, err)
+		}
+		return &work, nil
+	}
+}
+
+// WorkOf returns the ID of the work the media item is an edition of, which is invalid for
+// items without a work
+func (ms *Storage) WorkOf(ctx context.Context, mediaID uuid.UUID) (uuid.NullUUID, error) {
+	select {
+	case <-ctx.Done():
+		return uuid.NullUUID{}, ctx.Err()
+	default:
+		var work uuid.NullUUID
+		err := ms.db.GetContext(ctx, &work, `SELECT work FROM media.albums WHERE media_id = $1
+			UNION ALL SELECT work FROM media.books WHERE media_id = $1`, mediaID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return uuid.NullUUID{}, fmt.Errorf("error getting the work of %s: %w", mediaID, err)
+		}
+		return work, nil
+	}
+}
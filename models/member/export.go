@@ -204,7 +204,8 @@ func (s *PgMemberStorage) exportTrackRatings(ctx context.Context, tx pgx.Tx, mem
     t."name" AS track_name, 
     a."name" AS album_name, 
     p.first_name || ' ' || p.last_name AS artist_name, 
-    r.stars AS rating
+    reviews.member_stars(r.stars, $1) AS rating,
+    r.stars AS score
 FROM 
     reviews.track_ratings r
 JOIN 
@@ -216,10 +217,10 @@ JOIN
 JOIN 
     people.person p ON aa.artist = p.id
 WHERE 
-    r.user_id = $1 -- replace $1 with the user_id
+    r.user_id = (SELECT id FROM public.members WHERE uuid = $1)
 ORDER BY 
     a."name", t.track_number;
-`)
+`, memberID)
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
@@ -242,7 +243,8 @@ ORDER BY
 func (s *PgMemberStorage) exportBaseRatings(ctx context.Context, tx pgx.Tx, memberID uuid.UUID) (output map[string]interface{}, err error) {
 	rows, err := tx.Query(ctx, `
 	SELECT m."title", m."kind" AS media_title, media_kind, 
-		r.stars, r.body, r.topic, r.attribution FROM reviews.ratings r
+		reviews.member_stars(r.stars, r.user_id) AS rating, r.stars AS score,
+		r.body, r.topic, r.attribution FROM reviews.ratings r
 	JOIN media.media m ON r.media_id = m.media_id
 	WHERE r.user_id = $1`, memberID)
 	if err == pgx.ErrNoRows {
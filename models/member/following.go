@@ -2,6 +2,8 @@ package member
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/mail"
 	"strings"
@@ -31,14 +33,19 @@ func (s *PgMemberStorage) RequestFollow(ctx context.Context, fr *FollowBlockRequ
 		}
 		s.log.Debug().Msg("sanitized webfingers")
 
-		_, err = s.GetID(ctx, strings.Split(fr.Target, "@")[0])
-		if err != nil {
-			return FollowResponse{
-				Status: "not_found",
-				Error:  fmt.Errorf("follow target %s not found: %v", fr.Target, err),
+		// remote targets are resolved by the federation controller, which
+		// also decides whether the request was accepted
+		remoteTarget := s.isRemote(fr.Target)
+		if !remoteTarget {
+			_, err = s.GetID(ctx, strings.Split(fr.Target, "@")[0])
+			if err != nil {
+				return FollowResponse{
+					Status: "not_found",
+					Error:  fmt.Errorf("follow target %s not found: %v", fr.Target, err),
+				}
 			}
+			s.log.Debug().Msg("target found")
 		}
-		s.log.Debug().Msg("target found")
 
 		blocked, err := s.IsBlocked(ctx, fr)
 		if err != nil {
@@ -84,29 +91,31 @@ func (s *PgMemberStorage) RequestFollow(ctx context.Context, fr *FollowBlockRequ
 
 		// check if target has auto_accept_follow enabled in public.member_prefs
 		var autoAcceptFollow bool
-		st, err = s.client.PreparexContext(ctx, `
+		if !remoteTarget {
+			st, err = s.client.PreparexContext(ctx, `
 		SELECT auto_accept_follow
 		FROM public.member_prefs 
 		WHERE member_id = (SELECT id FROM public.members WHERE webfinger = $1)`)
-		if err != nil {
-			return FollowResponse{
-				Status: "failed",
-				Error:  fmt.Errorf("failed to prepare statement to check if follow acceptance is enabled: %v", err),
+			if err != nil {
+				return FollowResponse{
+					Status: "failed",
+					Error:  fmt.Errorf("failed to prepare statement to check if follow acceptance is enabled: %v", err),
+				}
 			}
-		}
 
-		if err = st.GetContext(ctx, &autoAcceptFollow, fr.Target); err != nil {
-			return FollowResponse{
-				Status: "failed",
-				Error:  fmt.Errorf("failed to check if follow acceptance is enabled: %v", err),
+			if err = st.GetContext(ctx, &autoAcceptFollow, fr.Target); err != nil {
+				return FollowResponse{
+					Status: "failed",
+					Error:  fmt.Errorf("failed to check if follow acceptance is enabled: %v", err),
+				}
 			}
 		}
 
 		if autoAcceptFollow {
 			s.log.Debug().Msg("auto accept follow enabled")
-			_, err = s.client.ExecContext(ctx, `INSERT INTO public.followers (follower, followee, notifications, reblogs) 
-			VALUES ($1, $2, $3, $4)`,
-				fr.Requester, fr.Target, fr.Notify, fr.Reblogs)
+			_, err = s.client.ExecContext(ctx, `INSERT INTO public.followers (follower, followee, notifications, reblogs, activity_iri) 
+			VALUES ($1, $2, $3, $4, $5)`,
+				fr.Requester, fr.Target, fr.Notify, fr.Reblogs, fr.ActivityIRI)
 			if err != nil {
 				return FollowResponse{
 					Status: "failed",
@@ -123,9 +132,9 @@ func (s *PgMemberStorage) RequestFollow(ctx context.Context, fr *FollowBlockRequ
 		s.log.Debug().Msg("auto accept follow disabled")
 
 		row := s.client.QueryRowContext(ctx, `INSERT INTO follow_requests 
-		(requester_webfinger, target_webfinger, reblogs, notifications)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id`, fr.Requester, fr.Target, fr.Reblogs, fr.Notify)
+		(requester_webfinger, target_webfinger, reblogs, notifications, activity_iri)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`, fr.Requester, fr.Target, fr.Reblogs, fr.Notify, fr.ActivityIRI)
 
 		var id int64
 
@@ -170,9 +179,9 @@ func (s *PgMemberStorage) AcceptFollow(ctx context.Context, accepter string, req
 
 		batch := &pgx.Batch{}
 		// copy all rows but 'created' (creation set by DB) to followers
-		batch.Queue(`INSERT INTO public.followers VALUES (
-				SELECT reblogs, notifications, requester_webfinger, target_webfinger FROM public.follow_requests WHERE id = $1)
-			)`, requestID)
+		batch.Queue(`INSERT INTO public.followers (reblogs, notifications, follower, followee, activity_iri)
+				SELECT reblogs, notifications, requester_webfinger, target_webfinger, activity_iri
+				FROM public.follow_requests WHERE id = $1`, requestID)
 		batch.Queue(`DELETE FROM public.follow_requests WHERE id = $1`, requestID)
 
 		br := tx.SendBatch(ctx, batch)
@@ -387,7 +396,7 @@ func (s *PgMemberStorage) GetFollowStatus(ctx context.Context, follower, followe
 		LIMIT 1`, follower, followee)
 		requestErr := requestRow.Scan(&resp.ID, &resp.Reblogs, &resp.Notify)
 		switch {
-		case followErr.Error() == pgx.ErrNoRows.Error() && requestErr.Error() == pgx.ErrNoRows.Error():
+		case errors.Is(followErr, pgx.ErrNoRows) && errors.Is(requestErr, pgx.ErrNoRows):
 			return FollowResponse{
 				Status: "not_found",
 			}
@@ -401,6 +410,7 @@ func (s *PgMemberStorage) GetFollowStatus(ctx context.Context, follower, followe
 		case requestErr == nil:
 			return FollowResponse{
 				Status:  "pending",
+				ID:      resp.ID,
 				Reblogs: resp.Reblogs,
 				Notify:  resp.Notify,
 			}
@@ -412,3 +422,48 @@ func (s *PgMemberStorage) GetFollowStatus(ctx context.Context, follower, followe
 		}
 	}
 }
+
+// GetFollowRequest retrieves a single pending follow request by its ID
+func (s *PgMemberStorage) GetFollowRequest(ctx context.Context, requestID int64) (*FollowBlockRequest, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		var fr FollowBlockRequest
+		err := s.client.GetContext(ctx, &fr, `SELECT id, requester_webfinger, target_webfinger,
+		reblogs, notifications AS notify, created, activity_iri
+		FROM public.follow_requests WHERE id = $1`, requestID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get follow request with ID %d: %w", requestID, err)
+		}
+		return &fr, nil
+	}
+}
+
+func (s *PgMemberStorage) GetFollowActivityIRI(ctx context.Context, follower, followee string) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+		var iri sql.NullString
+		err := s.newClient.QueryRow(ctx, `SELECT activity_iri FROM public.followers
+		WHERE follower = $1 AND followee = $2
+		UNION ALL
+		SELECT activity_iri FROM public.follow_requests
+		WHERE requester_webfinger = $1 AND target_webfinger = $2
+		LIMIT 1`, follower, followee).Scan(&iri)
+		if err != nil {
+			return "", fmt.Errorf("failed to get follow activity IRI: %w", err)
+		}
+		return iri.String, nil
+	}
+}
+
+// isRemote reports whether the webfinger belongs to another instance
+func (s *PgMemberStorage) isRemote(webfinger string) bool {
+	if s.config == nil {
+		return false
+	}
+	parts := strings.Split(webfinger, "@")
+	return len(parts) == 2 && parts[1] != s.config.Fiber.Domain
+}
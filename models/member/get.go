@@ -6,6 +6,7 @@ import (
 
 	"codeberg.org/mjh/LibRate/db"
 	"github.com/samber/lo"
+	"golang.org/x/text/language"
 )
 
 func (s *PgMemberStorage) Read(ctx context.Context, value string, keyNames ...string) (*Member, error) {
@@ -61,3 +62,25 @@ func (s *PgMemberStorage) GetPassHash(email, login string) (string, error) {
 	}
 	return passHash, nil
 }
+
+// GetLocale returns the locale the member chose in the preferences
+func (s *PgMemberStorage) GetLocale(ctx context.Context, memberName string) (language.Tag, error) {
+	select {
+	case <-ctx.Done():
+		return language.Und, ctx.Err()
+	default:
+		var locale string
+		err := s.client.GetContext(ctx, &locale, `SELECT p.locale
+			FROM public.member_prefs AS p
+			JOIN public.members AS m ON m.id = p.member_id
+			WHERE m.nick = $1`, memberName)
+		if err != nil {
+			return language.Und, fmt.Errorf("failed to get the locale of %s: %w", memberName, err)
+		}
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return language.Und, fmt.Errorf("invalid locale %q of %s: %w", locale, memberName, err)
+		}
+		return tag, nil
+	}
+}
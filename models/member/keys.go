@@ -0,0 +1,22 @@
+package member
+
+import (
+	"context"
+	"fmt"
+)
+
+// SetKeys stores the keypair used for signing federated activities on behalf of a member
+func (s *PgMemberStorage) SetKeys(ctx context.Context, memberName, publicKeyPem, privateKeyPem string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		_, err := s.newClient.Exec(ctx, `UPDATE public.members
+		SET public_key_pem = $1, private_key_pem = $2
+		WHERE nick = $3`, publicKeyPem, privateKeyPem, memberName)
+		if err != nil {
+			return fmt.Errorf("failed to save keys for %s: %v", memberName, err)
+		}
+		return nil
+	}
+}
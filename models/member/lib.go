@@ -17,6 +17,7 @@ import (
 	"github.com/rs/zerolog"
 
 	"codeberg.org/mjh/LibRate/cfg"
+	"codeberg.org/mjh/LibRate/models"
 )
 
 // Member holds the core information about a member
@@ -42,6 +43,7 @@ type (
 		FollowersURI     string         `json:"followers_uri" db:"followers_uri"` // URI for getting the followers list of this account
 		SessionTimeout   sql.NullInt64  `json:"-" db:"session_timeout"`
 		PublicKeyPem     string         `jsonld:"publicKeyPem,omitempty" json:"publicKeyPem" db:"public_key_pem"`
+		PrivateKeyPem    string         `json:"-" db:"private_key_pem"`
 		CustomFields     pgtype.JSONB   `json:"customFields,omitempty" db:"custom_fields"`
 		Modified         sql.NullInt64  `json:"modified,omitempty" db:"modified"`
 		Added            sql.NullInt64  `json:"added,omitempty" db:"added"`
@@ -60,10 +62,12 @@ type (
 	// different devices
 	UXPreferences struct {
 		Locale language.Tag `json:"locale,omitempty" db:"locale"`
-		// everything is calculated relative to the maximum scale of 0-100
+		// the ratings are stored on the 0-1000 reference scale and converted to this one, see models.RatingScale
 		// nolint: revive // we'd need to configure validation inside function calls otherwise. That can harm consistency.
 		RatingScaleLower int16 `json:"rating_scale_lower,omitempty" db:"rating_scale_lower" validate:"ltfield=RatingScaleUpper",min=0,max=1" default:"1"`
 		RatingScaleUpper int16 `json:"rating_scale_upper,omitempty" db:"rating_scale_upper" validate:"min=2,max=100" default:"10"`
+		// e.g. 0.5 for half stars
+		RatingScaleStep float64 `json:"rating_scale_step,omitempty" db:"rating_scale_step" validate:"gt=0,max=1" default:"1"`
 	}
 
 	PrivacySecurityPreferences struct {
@@ -92,6 +96,8 @@ type (
 		Reblogs   bool      `json:"reblogs" db:"reblogs" default:"true" sql:"-"` // only used for follow requests
 		Notify    bool      `json:"notify" db:"notify" default:"true" sql:"-"`
 		Created   time.Time `json:"created,omitempty" db:"created"`
+		// ActivityIRI is the ID of the ActivityPub Follow activity, if the request was federated
+		ActivityIRI sql.NullString `json:"-" db:"activity_iri"`
 	}
 
 	FollowResponse struct {
@@ -156,6 +162,7 @@ type (
 		Checker
 		FollowStorer
 		Exporter
+		KeyStorer
 	}
 
 	Writer interface {
@@ -166,12 +173,15 @@ type (
 		UpdatePassword(ctx context.Context, nick, pass string) error
 		Delete(ctx context.Context, memberName string) error
 		CreateSession(ctx context.Context, member *Member) (string, error)
+		SetLocale(ctx context.Context, memberName string, locale language.Tag) error
+		SetRatingScale(ctx context.Context, memberName string, scale models.RatingScale) error
 	}
 
 	Getter interface {
 		Read(ctx context.Context, key string, keyNames ...string) (*Member, error)
 		GetID(ctx context.Context, key string) (int, error)
 		GetPassHash(email, login string) (string, error)
+		GetLocale(ctx context.Context, memberName string) (language.Tag, error)
 	}
 
 	Checker interface {
@@ -187,8 +197,16 @@ type (
 		Export(ctx context.Context, memberName, format string) ([]byte, []byte, error)
 	}
 
+	// KeyStorer manages the keypair used for signing federated activities
+	KeyStorer interface {
+		SetKeys(ctx context.Context, memberName, publicKeyPem, privateKeyPem string) error
+	}
+
 	FollowStorer interface {
 		RequestFollow(ctx context.Context, fr *FollowBlockRequest) FollowResponse
+		GetFollowRequest(ctx context.Context, requestID int64) (*FollowBlockRequest, error)
+		// GetFollowActivityIRI returns the ID of the Follow activity that created the relationship, if any
+		GetFollowActivityIRI(ctx context.Context, follower, followee string) (string, error)
 		//	UpdateFollow(ctx context.Context, fr *FollowBlockRequest) error
 		AcceptFollow(ctx context.Context, accepter string, requestID int64) error
 		CancelFollow(ctx context.Context, canceler string, requestID int64) error
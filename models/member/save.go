@@ -22,11 +22,13 @@ func (s *PgMemberStorage) Save(ctx context.Context, member *Member) error {
 	mu.Unlock()
 
 	batch := &pgx.Batch{}
-	batch.Queue(`INSERT INTO public.members (passhash, nick, webfinger, email, reg_timestamp, active, roles)
-	VALUES ($1, $2, $3, $4, to_timestamp($5), $6, $7)
+	batch.Queue(`INSERT INTO public.members (passhash, nick, webfinger, email, reg_timestamp, active, roles,
+	public_key_pem, private_key_pem)
+	VALUES ($1, $2, $3, $4, to_timestamp($5), $6, $7, $8, $9)
 	RETURNING id_numeric`,
 		member.PassHash, member.MemberName, member.Webfinger,
-		member.Email, member.RegTimestamp.Unix(), member.Active, pq.StringArray(member.Roles))
+		member.Email, member.RegTimestamp.Unix(), member.Active, pq.StringArray(member.Roles),
+		member.PublicKeyPem, member.PrivateKeyPem)
 
 	tx, err := s.newClient.BeginTx(ctx, pgx.TxOptions{
 		AccessMode:     pgx.ReadWrite,
@@ -7,8 +7,10 @@ import (
 	"strings"
 
 	"codeberg.org/mjh/LibRate/db"
+	"codeberg.org/mjh/LibRate/models"
 	"github.com/jackc/pgx/v5"
 	"github.com/lib/pq"
+	"golang.org/x/text/language"
 )
 
 func (s *PgMemberStorage) Update(ctx context.Context, member *Member) error {
@@ -108,3 +110,45 @@ func (s *PgMemberStorage) UpdatePassword(ctx context.Context, nick, pass string)
 		return tx.Commit(ctx)
 	}
 }
+
+// SetRatingScale changes the scale the member rates media on. The saved ratings are kept on the
+// reference scale, so they're shown on the new scale right away
+func (s *PgMemberStorage) SetRatingScale(ctx context.Context, memberName string, scale models.RatingScale) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if err := scale.Validate(); err != nil {
+			return err
+		}
+		res, err := s.client.ExecContext(ctx, `UPDATE public.member_prefs
+			SET rating_scale_lower = $1, rating_scale_upper = $2, rating_scale_step = $3
+			WHERE member_id = (SELECT id FROM public.members WHERE nick = $4)`,
+			scale.Lower, scale.Upper, scale.Step, memberName)
+		if err != nil {
+			return fmt.Errorf("failed to update the rating scale of %s: %w", memberName, err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return fmt.Errorf("failed to update the rating scale of %s: %w", memberName, sql.ErrNoRows)
+		}
+		return nil
+	}
+}
+
+// SetLocale changes the locale used e.g. to choose between the titles of media in different languages
+func (s *PgMemberStorage) SetLocale(ctx context.Context, memberName string, locale language.Tag) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		res, err := s.client.ExecContext(ctx, `UPDATE public.member_prefs SET locale = $1
+			WHERE member_id = (SELECT id FROM public.members WHERE nick = $2)`, locale.String(), memberName)
+		if err != nil {
+			return fmt.Errorf("failed to update the locale of %s: %w", memberName, err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return fmt.Errorf("failed to update the locale of %s: %w", memberName, sql.ErrNoRows)
+		}
+		return nil
+	}
+}
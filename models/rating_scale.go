@@ -0,0 +1,69 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ReferenceScale is the upper bound of the scale all the ratings are stored on.
+// They're converted from and to the scales chosen by the members when they're read or written
+const ReferenceScale = 1000
+
+var (
+	// ErrInvalidScale is returned for rating scales which can't be converted from and to the reference scale
+	ErrInvalidScale = errors.New("invalid rating scale")
+	// ErrOutOfScale is returned for ratings outside the scale or between its steps
+	ErrOutOfScale = errors.New("rating is out of the scale")
+
+	// DefaultRatingScale is used for the members who haven't chosen a scale and for the visitors
+	DefaultRatingScale = RatingScale{Lower: 1, Upper: 10, Step: 1}
+)
+
+// RatingScale is the scale a member rates media on, e.g. 1-5 stars with half stars or 0-100.
+// The ratings are proportional to the upper bound, so both 3.5 out of 5 and 70 out of 100 are stored as 700
+type RatingScale struct {
+	Lower int16 `json:"lower" db:"rating_scale_lower" example:"1"`
+	Upper int16 `json:"upper" db:"rating_scale_upper" example:"5"`
+	// the difference between the neighbouring ratings, e.g. 0.5 for half stars
+	Step float64 `json:"step" db:"rating_scale_step" example:"0.5"`
+}
+
+// Validate checks that the scale fits the 0-100 range, that its lower bound is one of its steps
+// and that each step can be told apart on the reference scale
+func (s RatingScale) Validate() error {
+	switch {
+	case s.Lower < 0 || s.Upper > 100 || s.Lower >= s.Upper:
+		return fmt.Errorf("%w: the bounds must be within 0-100, got %d-%d", ErrInvalidScale, s.Lower, s.Upper)
+	case s.Step <= 0 || s.Step > 1 || !onStep(1, s.Step):
+		return fmt.Errorf("%w: the step must divide 1, got %v", ErrInvalidScale, s.Step)
+	case float64(s.Upper)/s.Step > ReferenceScale:
+		return fmt.Errorf("%w: %d-%d with a step of %v is too fine", ErrInvalidScale, s.Lower, s.Upper, s.Step)
+	}
+	return nil
+}
+
+// Normalize converts a rating on the scale to the reference scale
+func (s RatingScale) Normalize(rating float64) (int16, error) {
+	if rating < float64(s.Lower) || rating > float64(s.Upper) || !onStep(rating, s.Step) {
+		return 0, fmt.Errorf("%w: %v is not one of %d-%d by %v", ErrOutOfScale, rating, s.Lower, s.Upper, s.Step)
+	}
+	return int16(math.Round(rating * ReferenceScale / float64(s.Upper))), nil
+}
+
+// Denormalize converts a stored rating to the nearest rating on the scale
+func (s RatingScale) Denormalize(stars int16) float64 {
+	rating := math.Round(s.Convert(float64(stars))/s.Step) * s.Step
+	return math.Max(float64(s.Lower), math.Min(float64(s.Upper), rating))
+}
+
+// Convert converts a value from the reference scale without rounding it to the steps, e.g. an average
+func (s RatingScale) Convert(value float64) float64 {
+	return value * float64(s.Upper) / ReferenceScale
+}
+
+// onStep checks if the value is a multiple of the step, allowing for rounding errors
+func onStep(value, step float64) bool {
+	n := value / step
+	return math.Abs(n-math.Round(n)) < 1e-9
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	halfStars = RatingScale{Lower: 1, Upper: 5, Step: 0.5}
+	percent   = RatingScale{Lower: 0, Upper: 100, Step: 1}
+)
+
+func TestRatingScaleValidate(t *testing.T) {
+	testCases := []struct {
+		name  string
+		scale RatingScale
+		valid bool
+	}{
+		{"default", DefaultRatingScale, true},
+		{"half stars", halfStars, true},
+		{"percent", percent, true},
+		{"tenths", RatingScale{Lower: 0, Upper: 10, Step: 0.1}, true},
+		{"reversed bounds", RatingScale{Lower: 5, Upper: 1, Step: 1}, false},
+		{"equal bounds", RatingScale{Lower: 5, Upper: 5, Step: 1}, false},
+		{"upper bound over 100", RatingScale{Lower: 0, Upper: 101, Step: 1}, false},
+		{"negative lower bound", RatingScale{Lower: -1, Upper: 5, Step: 1}, false},
+		{"zero step", RatingScale{Lower: 1, Upper: 5, Step: 0}, false},
+		{"step over 1", RatingScale{Lower: 0, Upper: 10, Step: 2}, false},
+		{"step not dividing 1", RatingScale{Lower: 1, Upper: 5, Step: 0.3}, false},
+		{"finer than the reference scale", RatingScale{Lower: 0, Upper: 100, Step: 0.05}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.scale.Validate()
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidScale)
+			}
+		})
+	}
+}
+
+func TestRatingScaleNormalize(t *testing.T) {
+	testCases := []struct {
+		name   string
+		scale  RatingScale
+		rating float64
+		want   int16
+		err    error
+	}{
+		{"half stars", halfStars, 3.5, 700, nil},
+		{"lowest half stars", halfStars, 1, 200, nil},
+		{"highest half stars", halfStars, 5, 1000, nil},
+		{"percent", percent, 70, 700, nil},
+		{"zero percent", percent, 0, 0, nil},
+		{"full percent", percent, 100, 1000, nil},
+		{"default", DefaultRatingScale, 7, 700, nil},
+		{"off the half star steps", halfStars, 3.25, 0, ErrOutOfScale},
+		{"off the percent steps", percent, 70.5, 0, ErrOutOfScale},
+		{"below the lower bound", halfStars, 0.5, 0, ErrOutOfScale},
+		{"above the upper bound", halfStars, 5.5, 0, ErrOutOfScale},
+		{"negative", percent, -1, 0, ErrOutOfScale},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stars, err := tc.scale.Normalize(tc.rating)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, stars)
+		})
+	}
+}
+
+func TestRatingScaleRoundTrip(t *testing.T) {
+	scales := []RatingScale{
+		DefaultRatingScale, halfStars, percent,
+		{Lower: 0, Upper: 3, Step: 0.25},
+		{Lower: 0, Upper: 10, Step: 0.1},
+	}
+	for _, scale := range scales {
+		// dividing rather than adding up the steps keeps the rounding errors from piling up
+		perUnit := math.Round(1 / scale.Step)
+		for i := 0.0; i <= float64(scale.Upper-scale.Lower)*perUnit; i++ {
+			rating := float64(scale.Lower) + i/perUnit
+			stars, err := scale.Normalize(rating)
+			require.NoError(t, err, "%v on %+v", rating, scale)
+			assert.InDelta(t, rating, scale.Denormalize(stars), 1e-9, "%v on %+v", rating, scale)
+		}
+	}
+}
+
+func TestRatingScaleDenormalize(t *testing.T) {
+	testCases := []struct {
+		name  string
+		scale RatingScale
+		stars int16
+		want  float64
+	}{
+		{"to half stars", halfStars, 700, 3.5},
+		{"rounded to the nearest half star", halfStars, 740, 3.5},
+		{"rounded up to the nearest half star", halfStars, 760, 4},
+		{"clamped to the lower bound", halfStars, 0, 1},
+		{"to percent", percent, 655, 66},
+		{"from another scale", DefaultRatingScale, 350, 4},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.InDelta(t, tc.want, tc.scale.Denormalize(tc.stars), 1e-9)
+		})
+	}
+}
+
+func TestRatingScaleConvert(t *testing.T) {
+	// averages keep their precision instead of being rounded to the steps
+	assert.InDelta(t, 3.5, halfStars.Convert(700), 1e-9)
+	assert.InDelta(t, 3.275, halfStars.Convert(655), 1e-9)
+	assert.InDelta(t, 65.5, percent.Convert(655), 1e-9)
+	assert.InDelta(t, 6.55, DefaultRatingScale.Convert(655), 1e-9)
+	assert.InDelta(t, 0, percent.Convert(0), 1e-9)
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
@@ -11,62 +12,63 @@ import (
 	"github.com/rs/zerolog"
 )
 
+// ErrNotAuthor is returned when a member tries to change or delete a review written by someone else
+var ErrNotAuthor = errors.New("the review was written by another member")
+
 type (
 	// nolint: revive
 	RatingInput struct {
-		// TODO: allow for setting dynamic rating scales
-		NumStars    int8      `json:"numstars" binding:"required" validate:"min=0,max=10" error:"numstars must be between 1 and 15" db:"stars"`
-		Comment     string    `json:"comment,omitempty" db:"comment"`
+		// on the member's rating scale, converted to the reference scale when saved
+		NumStars    float64   `json:"numstars" binding:"required" example:"3.5"`
+		Comment     string    `json:"comment,omitempty" db:"body"`
 		Topic       string    `json:"topic,omitempty" db:"topic"`
 		Attribution string    `json:"attribution,omitempty" db:"attribution"`
-		UserID      uint32    `json:"userid" db:"user_id"`
+		UserID      uuid.UUID `json:"-" db:"user_id"` // the signed in member, never taken from the request
 		MediaID     uuid.UUID `json:"mediaid" db:"media_id"`
+		// ratings of the aspects of the media, on the member's rating scale
+		SecondaryRatings []*SecondaryRating `json:"secondary_ratings,omitempty"`
 	}
 
 	//nolint: revive
 	Review struct {
-		ID               int64              `json:"_key" db:"id,pk"`
-		CreatedAt        time.Time          `json:"created_at" db:"created_at"`
-		NumStars         int8               `json:"numstars" binding:"required" validate:"min=0,max=10" error:"numstars must be between 1 and 10" db:"stars" `
-		Body             string             `json:"comment,omitempty" db:"body"`
-		Topic            string             `json:"topic,omitempty" db:"topic"`
-		Attribution      string             `json:"attribution,omitempty" db:"attribution"`
-		UserID           uint32             `json:"userid" db:"user_id"`
+		ID        int64     `json:"_key" db:"id,pk"`
+		CreatedAt time.Time `json:"created_at" db:"created_at"`
+		// on the 0-1000 reference scale
+		Stars int16 `json:"stars" db:"stars" example:"700"`
+		// on the viewer's rating scale, see Rescale
+		NumStars    float64 `json:"numstars,omitempty" db:"-" example:"3.5"`
+		Body        string  `json:"comment,omitempty" db:"body"`
+		Topic       string  `json:"topic,omitempty" db:"topic"`
+		Attribution string  `json:"attribution,omitempty" db:"attribution"`
+		// null for reviews received from other instances
+		UserID           uuid.NullUUID      `json:"userid" db:"user_id"`
 		MediaID          uuid.UUID          `json:"mediaid" db:"media_id"`
-		SecondaryRatings []*SecondaryRating `json:"secondary_ratings,omitempty" db:"secondary_ratings"`
+		SecondaryRatings []*SecondaryRating `json:"secondary_ratings,omitempty" db:"-"`
+		// RemoteActor is the IRI of the author of a federated review
+		RemoteActor sql.NullString `json:"remote_actor,omitempty" db:"remote_actor"`
+		ActivityIRI sql.NullString `json:"-" db:"activity_iri"`
 	}
 
 	// rating average is a helper, "meta"-type so that the averages retrieved are more concise
 	RatingAverage struct {
 		BaseRatingScore float64 `json:"base_rating_score" db:"base_rating_score"`
+		// the scale of the scores
+		Scale RatingScale `json:"scale" db:"-"`
 		//nolint: revive
-		SecondaryRatingTypes    *[]string                `json:"secondary_rating_types,omitempty" validate:"required,oneof=track plotline soundtrack acting scenography scenario theme" db:"secondary_rating_types"`
+		SecondaryRatingTypes    *[]string                `json:"secondary_rating_types,omitempty" validate:"required,oneof=track edition plotline soundtrack acting scenography scenario theme gameplay story graphics" db:"secondary_rating_types"`
 		SecondaryRatingAverages []SecondaryRatingAverage `json:"secondary_rating_score" db:"secondary_rating_score"`
+		// the averages of the secondary ratings of the aspects of the media
+		Aspects []AspectAverage `json:"aspects" db:"-"`
 	}
 
-	// TODO: add migration (if needed)
-	// SecondaryRatingAverages is a map of (secondary rating's) kind to it's value
+	// SecondaryRatingAverage is the average rating of a part of the media, like a track of an album
+	// or an edition of a work
 	SecondaryRatingAverage struct {
 		MediaID   uuid.UUID `json:"_key" db:"media_id,pk"`
 		MediaKind string    `json:"media_kind" db:"media_kind"`
 		Score     float64   `json:"score,omitempty" db:"score"`
 	}
 
-	UpdateableKeyTypes interface {
-		~int | ~uint | string
-	}
-
-	// TODO: add migration
-	// nolint: revive
-	SecondaryRating struct {
-		ID       int64      `json:"_key" db:"id,pk"`
-		MediaID  *uuid.UUID `json:"media_id" db:"media_id"`
-		Kind     string     `json:"kind" validate:"required,oneof=track plotline soundtrack acting scenography scenario theme" db:"kind"`
-		NumStars int8       `json:"numstars" binding:"required" validate:"min=1,max=10,error='numstars must be between 1 and 10'" db:"stars"`
-		UserID   uint32     `json:"userid" db:"user_id"`
-	}
-
-	// Update is not present, because methods cannot have type parameters
 	RatingStorer interface {
 		New(ri *RatingInput) error
 		Get(ctx context.Context, ID int64) (*Review, error)
@@ -74,33 +76,147 @@ type (
 		GetByMediaID(ctx context.Context, mediaID uuid.UUID) ([]*Review, error)
 	}
 
+	// ReviewPublisher is notified about changes to local reviews,
+	// so that they can be delivered to other instances
+	ReviewPublisher interface {
+		// PublishReview is called with activityType being one of Create, Update or Delete
+		// and the name of the signed in member who wrote the review
+		PublishReview(ctx context.Context, activityType, memberName string, review *Review) error
+	}
+
 	RatingStorage struct {
-		db  *sqlx.DB
-		log *zerolog.Logger
+		db        *sqlx.DB
+		log       *zerolog.Logger
+		publisher ReviewPublisher
 	}
 )
 
+// reviewColumns are the columns of reviews.ratings read into a Review. The reviews are identified
+// by their numeric IDs, since the id column holds the uuid used to sync them with CouchDB
+const reviewColumns = `id_numeric AS id, created_at, stars, body, topic, attribution, user_id, media_id, remote_actor, activity_iri`
+
+// publicReviews is the view of the reviews which can be listed publicly and counted in the averages,
+// that is all but the ones received from silenced domains
+const publicReviews = `reviews.public_ratings`
+
 func NewRatingStorage(db *sqlx.DB, log *zerolog.Logger) *RatingStorage {
-	return &RatingStorage{db, log}
+	return &RatingStorage{db: db, log: log}
+}
+
+// SetPublisher sets the handler used to federate reviews. Since the federation
+// controller itself depends on the rating storage, it can't be passed to the constructor
+func (rs *RatingStorage) SetPublisher(p ReviewPublisher) {
+	rs.publisher = p
+}
+
+// publish notifies the publisher, if any. Failing to federate a review
+// shouldn't fail the local operation, so errors are only logged
+func (rs *RatingStorage) publish(ctx context.Context, activityType, memberName string, review *Review) {
+	if rs.publisher == nil || review.RemoteActor.Valid {
+		return
+	}
+	if err := rs.publisher.PublishReview(ctx, activityType, memberName, review); err != nil {
+		rs.log.Error().Err(err).Msgf("failed to federate %s of review %d", activityType, review.ID)
+	}
+}
+
+// Rescale sets NumStars to the rating on the given scale
+func (r *Review) Rescale(scale RatingScale) {
+	r.NumStars = scale.Denormalize(r.Stars)
+	for _, s := range r.SecondaryRatings {
+		s.NumStars = scale.Denormalize(s.Stars)
+	}
+}
+
+// Rescale converts the averages from the reference scale to the given scale
+func (a *RatingAverage) Rescale(scale RatingScale) *RatingAverage {
+	a.BaseRatingScore = scale.Convert(a.BaseRatingScore)
+	for i := range a.SecondaryRatingAverages {
+		a.SecondaryRatingAverages[i].Score = scale.Convert(a.SecondaryRatingAverages[i].Score)
+	}
+	for i := range a.Aspects {
+		a.Aspects[i].Score = scale.Convert(a.Aspects[i].Score)
+	}
+	a.Scale = scale
+	return a
+}
+
+// RatingScale returns the rating scale chosen by the member, or the default one
+// for the members who haven't chosen any and for the visitors
+func (rs *RatingStorage) RatingScale(ctx context.Context, memberName string) (RatingScale, error) {
+	select {
+	case <-ctx.Done():
+		return RatingScale{}, ctx.Err()
+	default:
+		if memberName == "" {
+			return DefaultRatingScale, nil
+		}
+		var scale RatingScale
+		err := rs.db.GetContext(ctx, &scale, `SELECT p.rating_scale_lower, p.rating_scale_upper, p.rating_scale_step
+			FROM public.member_prefs AS p
+			JOIN public.members AS m ON m.id = p.member_id
+			WHERE m.nick = $1`, memberName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return DefaultRatingScale, nil
+		}
+		if err != nil {
+			return RatingScale{}, fmt.Errorf("error getting the rating scale of %s: %w", memberName, err)
+		}
+		return scale, nil
+	}
+}
+
+// authorID returns the uuid by which the reviews refer to the member
+func (rs *RatingStorage) authorID(ctx context.Context, memberName string) (id uuid.UUID, err error) {
+	err = rs.db.GetContext(ctx, &id, `SELECT uuid FROM public.members WHERE nick = $1`, memberName)
+	if err != nil {
+		// not wrapped, so that a missing member isn't mistaken for a missing review
+		return uuid.Nil, fmt.Errorf("error looking up member %s: %v", memberName, err)
+	}
+	return id, nil
 }
 
-func (rs *RatingStorage) New(ctx context.Context, rating *RatingInput) error {
+// unchangedError tells the reviews which don't exist apart from the ones written by other members,
+// once a review couldn't be changed or deleted by its ID and author
+func (rs *RatingStorage) unchangedError(ctx context.Context, id int64) error {
+	var exists bool
+	err := rs.db.GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM reviews.ratings WHERE id_numeric = $1)`, id)
+	switch {
+	case err != nil:
+		return fmt.Errorf("error looking up rating %d: %w", id, err)
+	case exists:
+		return fmt.Errorf("rating %d: %w", id, ErrNotAuthor)
+	default:
+		return fmt.Errorf("rating %d: %w", id, sql.ErrNoRows)
+	}
+}
+
+// New saves the rating of the member along with its secondary ratings, converting them from the member's scale
+// to the reference scale
+func (rs *RatingStorage) New(ctx context.Context, memberName string, rating *RatingInput, scale RatingScale) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
-		stmt, err := rs.db.PreparexContext(ctx,
-			`INSERT INTO reviews.ratings (stars, comment, topic, attribution, user_id, media_id)
-		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`)
+		stars, err := scale.Normalize(rating.NumStars)
 		if err != nil {
-			return fmt.Errorf("error preparing statement: %w", err)
+			return err
+		}
+		if rating.UserID, err = rs.authorID(ctx, memberName); err != nil {
+			return err
 		}
-		defer stmt.Close()
+		tx, err := rs.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
 
 		var id int64
 
-		err = stmt.QueryRowxContext(ctx,
-			rating.NumStars,
+		err = tx.QueryRowxContext(ctx,
+			`INSERT INTO reviews.ratings (stars, body, topic, attribution, user_id, media_id)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id_numeric`,
+			stars,
 			rating.Comment,
 			rating.Topic,
 			rating.Attribution,
@@ -111,23 +227,59 @@ func (rs *RatingStorage) New(ctx context.Context, rating *RatingInput) error {
 		if err != nil {
 			return fmt.Errorf("error inserting rating: %w", err)
 		}
+		if err = saveSecondaryRatings(ctx, tx, id, rating.MediaID, rating.SecondaryRatings, scale); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("error saving rating: %w", err)
+		}
 		rs.log.Debug().Msgf("Inserted rating with id %d", id)
 
+		rs.publish(ctx, "Create", memberName, &Review{
+			ID:               id,
+			CreatedAt:        time.Now(),
+			Stars:            stars,
+			Body:             rating.Comment,
+			Topic:            rating.Topic,
+			Attribution:      rating.Attribution,
+			UserID:           uuid.NullUUID{UUID: rating.UserID, Valid: true},
+			MediaID:          rating.MediaID,
+			SecondaryRatings: rating.SecondaryRatings,
+		})
+
 		return nil
 	}
 }
 
-func UpdateRating[U UpdateableKeyTypes](ctx context.Context, rs *RatingStorage, id int64, values []U) (err error) {
+// Update changes the rating, the text and the topic of a review written by the member, converting the rating
+// from the member's scale to the reference scale. It returns ErrNotAuthor for the reviews of other members
+func (rs *RatingStorage) Update(ctx context.Context, id int64, memberName string, rating *RatingInput, scale RatingScale) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
-
-		for v := range values {
-			_, err = rs.db.ExecContext(ctx, `UPDATE reviews.ratings SET $1 = $2 WHERE id = $3`, v, values[v], id)
+		stars, err := scale.Normalize(rating.NumStars)
+		if err != nil {
+			return err
+		}
+		authorID, err := rs.authorID(ctx, memberName)
+		if err != nil {
+			return err
+		}
+		res, err := rs.db.ExecContext(ctx, `UPDATE reviews.ratings SET stars = $1, body = $2, topic = $3
+			WHERE id_numeric = $4 AND user_id = $5`, stars, rating.Comment, rating.Topic, id, authorID)
+		if err != nil {
+			return fmt.Errorf("error updating rating: %w", err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return rs.unchangedError(ctx, id)
+		}
+		if rs.publisher != nil {
+			updated, err := rs.Get(ctx, id)
 			if err != nil {
-				return fmt.Errorf("error updating rating: %w", err)
+				return fmt.Errorf("error getting updated rating: %w", err)
 			}
+			rs.publish(ctx, "Update", memberName, &updated)
 		}
 		return nil
 	}
@@ -135,35 +287,53 @@ func UpdateRating[U UpdateableKeyTypes](ctx context.Context, rs *RatingStorage,
 
 // Get retrieves a rating by its id.
 func (rs *RatingStorage) Get(ctx context.Context, id int64) (r Review, err error) {
-	err = rs.db.GetContext(ctx, &r, `SELECT * FROM reviews.ratings WHERE id = $1`, id)
+	err = rs.db.GetContext(ctx, &r, `SELECT `+reviewColumns+` FROM reviews.ratings WHERE id_numeric = $1`, id)
 	if err != nil {
 		return Review{}, fmt.Errorf("error getting review: %w", err)
 	}
+	if err = rs.loadSecondaryRatings(ctx, &r); err != nil {
+		return Review{}, err
+	}
 	return r, nil
 }
 
-func (rs *RatingStorage) Delete(ctx context.Context, id int64) (err error) {
+// Delete removes a review written by the member. It returns ErrNotAuthor for the reviews of other members
+func (rs *RatingStorage) Delete(ctx context.Context, id int64, memberName string) (err error) {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
-		_, err = rs.db.ExecContext(ctx, `DELETE FROM reviews.ratings WHERE id = $1`, id)
+		authorID, err := rs.authorID(ctx, memberName)
+		if err != nil {
+			return err
+		}
+		// the deleted review is needed to federate the deletion
+		var review Review
+		err = rs.db.GetContext(ctx, &review, `DELETE FROM reviews.ratings WHERE id_numeric = $1 AND user_id = $2
+			RETURNING `+reviewColumns, id, authorID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return rs.unchangedError(ctx, id)
+		}
 		if err != nil {
 			return fmt.Errorf("error deleting rating: %w", err)
 		}
+		rs.publish(ctx, "Delete", memberName, &review)
 		return nil
 	}
 }
 
 // GetLatestRatings retrieves the latest reviews for all media items. The limit and offset
-// parameters are used for pagination.
+// parameters are used for pagination. Reviews from silenced domains are left out.
 func (rs *RatingStorage) GetLatest(ctx context.Context, limit int, offset int) (ratings []*Review, err error) {
-	err = rs.db.SelectContext(ctx, &ratings, `SELECT * FROM reviews.ratings 
+	err = rs.db.SelectContext(ctx, &ratings, `SELECT `+reviewColumns+` FROM `+publicReviews+`
 		ORDER BY created_at
 		DESC LIMIT $1 OFFSET $2`, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("error getting ratings: %w", err)
 	}
+	if err = rs.loadSecondaryRatings(ctx, ratings...); err != nil {
+		return nil, err
+	}
 	return ratings, nil
 }
 
@@ -171,22 +341,27 @@ func (rs *RatingStorage) GetAll() (ratings []*Review, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err = rs.db.SelectContext(ctx, &ratings, `SELECT * FROM reviews.ratings`)
+	err = rs.db.SelectContext(ctx, &ratings, `SELECT `+reviewColumns+` FROM reviews.ratings`)
 	if err != nil {
 		return nil, fmt.Errorf("error getting ratings: %w", err)
 	}
 	return ratings, nil
 }
 
+// GetByMediaID retrieves the reviews of a media item, leaving out the ones from silenced domains
 func (rs *RatingStorage) GetByMediaID(ctx context.Context, mediaID uuid.UUID) (ratings []*Review, err error) {
 	err = rs.db.SelectContext(
-		ctx, &ratings, `SELECT * FROM reviews.ratings WHERE media_id = $1`, mediaID)
+		ctx, &ratings, `SELECT `+reviewColumns+` FROM `+publicReviews+` WHERE media_id = $1`, mediaID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting ratings: %w", err)
 	}
+	if err = rs.loadSecondaryRatings(ctx, ratings...); err != nil {
+		return nil, err
+	}
 	return ratings, nil
 }
 
+// GetAverageStars returns the average rating of the media item on the reference scale
 func (rs *RatingStorage) GetAverageStars(ctx context.Context,
 	mediaID uuid.UUID,
 ) (avgStars float64, err error) {
@@ -196,7 +371,7 @@ func (rs *RatingStorage) GetAverageStars(ctx context.Context,
 	default:
 		var avgStarsFloat sql.NullFloat64
 		err = rs.db.GetContext(ctx, &avgStarsFloat,
-			`SELECT AVG(stars) FROM reviews.ratings WHERE media_id = $1`, mediaID)
+			`SELECT AVG(stars) FROM `+publicReviews+` WHERE media_id = $1`, mediaID)
 		if err != nil {
 			return 0, fmt.Errorf("error getting average stars: %w", err)
 		}
@@ -204,3 +379,131 @@ func (rs *RatingStorage) GetAverageStars(ctx context.Context,
 		return avgStarsFloat.Float64, nil
 	}
 }
+
+// GetWorkAverageStars returns the average rating of all the editions of the work on the reference scale.
+// Members who rated several editions are counted once, with the average of their ratings
+func (rs *RatingStorage) GetWorkAverageStars(ctx context.Context,
+	workID uuid.UUID,
+) (avgStars float64, err error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	default:
+		var avgStarsFloat sql.NullFloat64
+		err = rs.db.GetContext(ctx, &avgStarsFloat, `
+			SELECT AVG(stars) FROM (
+				SELECT AVG(r.stars) AS stars
+				FROM `+publicReviews+` AS r
+				JOIN (
+					SELECT media_id FROM media.albums WHERE work = $1
+					UNION ALL SELECT media_id FROM media.books WHERE work = $1
+				) AS e ON e.media_id = r.media_id
+				GROUP BY COALESCE(r.user_id::text, r.remote_actor, r.id::text)
+			) AS per_member`, workID)
+		if err != nil {
+			return 0, fmt.Errorf("error getting average stars of work %s: %w", workID, err)
+		}
+
+		return avgStarsFloat.Float64, nil
+	}
+}
+
+// SaveRemote stores or updates a review received from another instance.
+// Reviews are identified by the IRI of the federated object
+func (rs *RatingStorage) SaveRemote(ctx context.Context, review *Review) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if !review.RemoteActor.Valid || !review.ActivityIRI.Valid {
+			return fmt.Errorf("remote reviews must have an actor and an IRI")
+		}
+		_, err := rs.db.NamedExecContext(ctx, `INSERT INTO reviews.ratings
+		(stars, body, topic, media_id, remote_actor, activity_iri, created_at)
+		VALUES (:stars, :body, :topic, :media_id, :remote_actor, :activity_iri, :created_at)
+		ON CONFLICT (activity_iri) DO UPDATE SET
+			stars = EXCLUDED.stars,
+			body = EXCLUDED.body,
+			topic = EXCLUDED.topic
+		WHERE reviews.ratings.remote_actor = EXCLUDED.remote_actor`, review)
+		if err != nil {
+			return fmt.Errorf("error saving remote review %s: %w", review.ActivityIRI.String, err)
+		}
+		return nil
+	}
+}
+
+// DeleteRemote removes a review received from another instance. Only the original author can delete it
+func (rs *RatingStorage) DeleteRemote(ctx context.Context, activityIRI, actor string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		_, err := rs.db.ExecContext(ctx, `DELETE FROM reviews.ratings
+		WHERE activity_iri = $1 AND remote_actor = $2`, activityIRI, actor)
+		if err != nil {
+			return fmt.Errorf("error deleting remote review %s: %w", activityIRI, err)
+		}
+		return nil
+	}
+}
+
+// ImportRatings adds the ratings imported from other services, e.g. RateYourMusic, skipping
+// media the member has rated already. The ratings are on the scale of the service rather than
+// the member's. Imported ratings aren't federated, since followers would be flooded with them.
+// It returns the number of ratings added
+func (rs *RatingStorage) ImportRatings(ctx context.Context, memberName string, ratings []RatingInput, scale RatingScale) (added int, err error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	default:
+		// the ratings refer to the members by their uuid, the placeholders by their numeric ID
+		var member struct {
+			UUID uuid.UUID `db:"uuid"`
+			ID   uint32    `db:"id_numeric"`
+		}
+		err = rs.db.GetContext(ctx, &member, `SELECT uuid, id_numeric FROM public.members WHERE nick = $1`, memberName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("member %s not found: %w", memberName, err)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error looking up member %s: %w", memberName, err)
+		}
+
+		tx, err := rs.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return 0, fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after a successful commit
+
+		for i := range ratings {
+			stars, err := scale.Normalize(ratings[i].NumStars)
+			if err != nil {
+				return 0, fmt.Errorf("error importing rating of %s: %w", ratings[i].MediaID, err)
+			}
+			res, err := tx.ExecContext(ctx, `INSERT INTO reviews.ratings (stars, body, topic, attribution, user_id, media_id)
+			SELECT $1, $2, $3, $4, $5, $6
+			WHERE NOT EXISTS (SELECT 1 FROM reviews.ratings WHERE user_id = $5 AND media_id = $6)`,
+				stars, ratings[i].Comment, ratings[i].Topic, ratings[i].Attribution, member.UUID, ratings[i].MediaID)
+			if err != nil {
+				return 0, fmt.Errorf("error importing rating of %s: %w", ratings[i].MediaID, err)
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return 0, fmt.Errorf("error checking affected rows: %w", err)
+			}
+			added += int(n)
+		}
+		// media rated now don't need to be reminded about
+		_, err = tx.ExecContext(ctx, `DELETE FROM reviews.rating_placeholders p
+		USING reviews.ratings r
+		WHERE p.member_id = $1 AND r.user_id = $2 AND r.media_id = p.media_id`, member.ID, member.UUID)
+		if err != nil {
+			return 0, fmt.Errorf("error removing rating placeholders: %w", err)
+		}
+		if err = tx.Commit(); err != nil {
+			return 0, fmt.Errorf("error importing ratings: %w", err)
+		}
+		return added, nil
+	}
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorders is a database/sql driver which hands out the recorder registered under the data source name
+var recorders = &recorderDriver{byName: make(map[string]*recorder)}
+
+func init() {
+	sql.Register("recorder", recorders)
+}
+
+type recorderDriver struct {
+	mu     sync.Mutex
+	byName map[string]*recorder
+}
+
+func (d *recorderDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.byName[name], nil
+}
+
+// newRecordingDB returns a database which records the statements run against it.
+// Queries return no rows and statements affect a single one
+func newRecordingDB(t *testing.T) (*sqlx.DB, *recorder) {
+	t.Helper()
+	rec := &recorder{}
+	recorders.mu.Lock()
+	recorders.byName[t.Name()] = rec
+	recorders.mu.Unlock()
+	db, err := sql.Open("recorder", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return sqlx.NewDb(db, "postgres"), rec
+}
+
+type (
+	recorder struct {
+		mu    sync.Mutex
+		stmts []string
+	}
+	recordedStmt struct{}
+	recordedTx   struct{}
+	recordedRows struct{}
+)
+
+func (r *recorder) Prepare(query string) (driver.Stmt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stmts = append(r.stmts, query)
+	return recordedStmt{}, nil
+}
+
+func (r *recorder) Close() error              { return nil }
+func (r *recorder) Begin() (driver.Tx, error) { return recordedTx{}, nil }
+
+// reset returns the statements recorded so far and forgets them
+func (r *recorder) reset() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stmts := r.stmts
+	r.stmts = nil
+	return stmts
+}
+
+func (recordedStmt) Close() error  { return nil }
+func (recordedStmt) NumInput() int { return -1 }
+func (recordedStmt) Exec([]driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (recordedStmt) Query([]driver.Value) (driver.Rows, error) { return recordedRows{}, nil }
+
+func (recordedTx) Commit() error   { return nil }
+func (recordedTx) Rollback() error { return nil }
+
+func (recordedRows) Columns() []string         { return []string{} }
+func (recordedRows) Close() error              { return nil }
+func (recordedRows) Next([]driver.Value) error { return io.EOF }
+
+func TestPublicReadsSkipSilencedDomains(t *testing.T) {
+	ctx := context.Background()
+	mediaID := uuid.Must(uuid.NewV4())
+	testCases := []struct {
+		name string
+		read func(rs *RatingStorage) error
+	}{
+		{"latest reviews", func(rs *RatingStorage) error {
+			_, err := rs.GetLatest(ctx, 10, 0)
+			return err
+		}},
+		{"reviews of a media item", func(rs *RatingStorage) error {
+			_, err := rs.GetByMediaID(ctx, mediaID)
+			return err
+		}},
+		{"average rating", func(rs *RatingStorage) error {
+			_, err := rs.GetAverageStars(ctx, mediaID)
+			return err
+		}},
+		{"average rating of a work", func(rs *RatingStorage) error {
+			_, err := rs.GetWorkAverageStars(ctx, mediaID)
+			return err
+		}},
+		{"aspect averages", func(rs *RatingStorage) error {
+			_, err := rs.GetAspectAverages(ctx, mediaID)
+			return err
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, rec := newRecordingDB(t)
+			logger := zerolog.Nop()
+			// no rows come back, so only the statements matter
+			_ = tc.read(NewRatingStorage(db, &logger))
+
+			stmts := rec.reset()
+			require.NotEmpty(t, stmts)
+			for _, stmt := range stmts {
+				assert.Contains(t, stmt, publicReviews)
+				assert.NotContains(t, stmt, "reviews.ratings", "the reviews must be read through the public view")
+			}
+		})
+	}
+}
+
+func TestDomainPolicyChangesRebuildScores(t *testing.T) {
+	ctx := context.Background()
+	db, rec := newRecordingDB(t)
+	logger := zerolog.Nop()
+	ds := NewDomainPolicyStorage(db, &logger)
+
+	require.NoError(t, ds.Set(ctx, &DomainPolicy{Domain: "spam.example", Severity: SeveritySilence}))
+	stmts := rec.reset()
+	assert.Equal(t, rebuildScores, stmts[len(stmts)-1])
+
+	require.NoError(t, ds.Remove(ctx, "spam.example"))
+	stmts = rec.reset()
+	assert.Equal(t, rebuildScores, stmts[len(stmts)-1])
+	assert.True(t, strings.HasPrefix(stmts[0], "DELETE FROM federation.domain_policies"))
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/lib/pq"
+)
+
+// rebuildScores recomputes all the scores from the public reviews, returning the number of changed ones
+const rebuildScores = `SELECT media.rebuild_scores()`
+
+// MediaScore holds the aggregated ratings of a media item on the reference scale. It's kept up to date
+// by the database on every rating written, see the media.scores table
+type MediaScore struct {
+	MediaID     uuid.UUID `json:"media_id" db:"media_id"`
+	RatingCount int       `json:"rating_count" db:"rating_count"`
+	// the ratings with a text body
+	ReviewCount int      `json:"review_count" db:"review_count"`
+	Average     *float64 `json:"average_rating,omitempty" db:"average"`
+	// the Bayesian average, in which the ratings of new and inactive accounts count less
+	WeightedScore *float64 `json:"weighted_score,omitempty" db:"weighted_score"`
+	// from 0, when everyone agrees, to 1, when half the ratings are the lowest and half the highest
+	Contentious float64 `json:"contentious" db:"contentious"`
+	// the number of ratings rounded to each hundred of the reference scale, from 0 to 1000
+	Histogram pq.Int32Array `json:"histogram" db:"histogram"`
+	Updated   time.Time     `json:"updated" db:"updated"`
+}
+
+// GetScore returns the aggregated ratings of the media item. Media nobody rated get an empty score
+func (rs *RatingStorage) GetScore(ctx context.Context, mediaID uuid.UUID) (*MediaScore, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		var score MediaScore
+		err := rs.db.GetContext(ctx, &score, `SELECT media_id, rating_count, review_count, average,
+			weighted_score, contentious, histogram, updated
+			FROM media.scores WHERE media_id = $1`, mediaID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return &MediaScore{MediaID: mediaID, Histogram: make(pq.Int32Array, 11)}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error getting the score of %s: %w", mediaID, err)
+		}
+		return &score, nil
+	}
+}
+
+// RebuildScores reweighs the ratings of the accounts which got older or more active since they rated
+// and recomputes all the scores. It returns the number of media whose scores changed
+func (rs *RatingStorage) RebuildScores(ctx context.Context) (changed int, err error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	default:
+		if err = rs.db.GetContext(ctx, &changed, rebuildScores); err != nil {
+			return 0, fmt.Errorf("error rebuilding scores: %w", err)
+		}
+		return changed, nil
+	}
+}
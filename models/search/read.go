@@ -5,12 +5,16 @@ import (
 	"fmt"
 	"sync"
 	"time"
+	"unicode"
 
 	_ "github.com/go-kivik/couchdb/v3"
 	"github.com/go-kivik/kivik/v3"
 	"github.com/mitchellh/mapstructure"
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
 )
 
 type (
@@ -78,6 +82,23 @@ type (
 		Created  time.Time `json:"created" mapstructure:"created"`
 		Added    time.Time `json:"added" mapstructure:"added"`
 		Modified time.Time `json:"modified" mapstructure:"modified"`
+		// only set for games
+		Platforms  []string `json:"platforms,omitempty" mapstructure:"platforms,omitempty"`
+		Franchises []string `json:"franchises,omitempty" mapstructure:"franchises,omitempty"`
+		// set for games and anime
+		Studios []string `json:"studios,omitempty" mapstructure:"studios,omitempty"`
+		// only set for manga and comics
+		Authors        []string `json:"authors,omitempty" mapstructure:"authors,omitempty"`
+		Artists        []string `json:"artists,omitempty" mapstructure:"artists,omitempty"`
+		Serializations []string `json:"serializations,omitempty" mapstructure:"serializations,omitempty"`
+		// the original, romanized and localized titles
+		Titles []string `json:"titles,omitempty" mapstructure:"titles,omitempty"`
+		// the scores, on the 0-1000 reference scale, see models.MediaScore
+		RatingCount   int      `json:"rating_count" mapstructure:"rating_count"`
+		ReviewCount   int      `json:"review_count" mapstructure:"review_count"`
+		AverageRating *float64 `json:"average_rating,omitempty" mapstructure:"average_rating,omitempty"`
+		WeightedScore *float64 `json:"weighted_score,omitempty" mapstructure:"weighted_score,omitempty"`
+		Contentious   float64  `json:"contentious" mapstructure:"contentious"`
 	}
 
 	CombinedData struct {
@@ -327,8 +348,9 @@ func ToBleveDocument(combinedData *CombinedData, log *zerolog.Logger) (docs []Bl
 			var doc BleveDocument
 			doc.ID = combinedData.Media[i].ID
 			doc.Type = "media"
+			combinedData.Media[i].Titles = titleVariants(combinedData.Media[i].Title, combinedData.Media[i].Titles)
 
-			doc.Fields = []interface{}{combinedData.Media[i].Title, combinedData.Media[i].Kind, combinedData.Media[i].Created, combinedData.Media[i].Added}
+			doc.Fields = []interface{}{combinedData.Media[i].Title, combinedData.Media[i].Kind, combinedData.Media[i].Created, combinedData.Media[i].Added, combinedData.Media[i].Titles}
 			if err := mapstructure.Decode(combinedData.Media[i], &doc.Data); err != nil {
 				errorCh <- fmt.Errorf("error converting struct into map: %w", err)
 				break
@@ -605,3 +627,23 @@ func (s *Storage) readNewWorker(
 		outgoingDataFeed <- data
 	}
 }
+
+// titleVariants adds the titles without diacritics to the titles of a media item,
+// so that e.g. Ōkami can be found by typing Okami
+func titleVariants(title string, titles []string) []string {
+	seen := make(map[string]bool, len(titles)+1)
+	seen[title] = true
+	variants := make([]string, 0, 2*len(titles)+1)
+	for _, t := range append([]string{title}, titles...) {
+		if !seen[t] {
+			seen[t] = true
+			variants = append(variants, t)
+		}
+		folded, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), t)
+		if err == nil && !seen[folded] {
+			seen[folded] = true
+			variants = append(variants, folded)
+		}
+	}
+	return variants
+}
@@ -107,3 +107,9 @@ func TestToBleveDocument(t *testing.T) {
 	assert.Equal(t, 3, len(docs))
 	assert.Contains(t, docs[0].ID, "_1")
 }
+
+func TestTitleVariants(t *testing.T) {
+	assert.Equal(t, []string{"Okami", "大神"}, titleVariants("Ōkami", []string{"大神", "Ōkami", "Okami"}))
+	assert.Equal(t, []string{"Sigur Rós"}, titleVariants("Sigur Ros", []string{"Sigur Rós"}))
+	assert.Empty(t, titleVariants("Mezzanine", nil))
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ErrInvalidAspect is returned for secondary ratings of aspects the media kind doesn't have
+var ErrInvalidAspect = errors.New("invalid secondary rating")
+
+// aspectKinds lists the kinds of media each aspect can be rated for
+var aspectKinds = map[string][]string{
+	"acting":      {"film", "tv_show", "season", "episode"},
+	"scenography": {"film", "tv_show", "season", "episode"},
+	"scenario":    {"film", "tv_show", "season", "episode", "anime", "game"},
+	"soundtrack":  {"film", "tv_show", "season", "episode", "anime", "game"},
+	"plotline":    {"film", "tv_show", "season", "episode", "anime", "book", "game", "manga", "comic"},
+	"story":       {"book", "game", "anime", "manga", "comic"},
+	"theme":       {"film", "tv_show", "season", "episode", "anime", "book", "game", "manga", "comic", "album"},
+	"gameplay":    {"game"},
+	"graphics":    {"game", "anime", "manga", "comic"},
+}
+
+type (
+	// SecondaryRating is a rating of a single aspect of the media, like the acting, given along with a review
+	// nolint: revive
+	SecondaryRating struct {
+		ID       int64  `json:"_key" db:"id,pk"`
+		RatingID int64  `json:"rating_id" db:"rating_id"`
+		Kind     string `json:"kind" validate:"required,oneof=plotline soundtrack acting scenography scenario theme gameplay story graphics" db:"kind"`
+		// on the 0-1000 reference scale
+		Stars int16 `json:"stars" db:"stars" example:"800"`
+		// on the member's rating scale, like the one of the review
+		NumStars float64 `json:"numstars" binding:"required" db:"-" example:"4"`
+	}
+
+	// AspectAverage is the average rating of an aspect of the media
+	AspectAverage struct {
+		Kind  string  `json:"kind" db:"kind" example:"acting"`
+		Score float64 `json:"score" db:"score"`
+		Count int     `json:"count" db:"count"`
+	}
+)
+
+// ValidAspect checks if the aspect can be rated for the media kind
+func ValidAspect(mediaKind, aspect string) bool {
+	for _, kind := range aspectKinds[aspect] {
+		if kind == mediaKind {
+			return true
+		}
+	}
+	return false
+}
+
+// saveSecondaryRatings validates the aspect ratings against the kind of the rated media,
+// converts them to the reference scale and adds them to the review
+func saveSecondaryRatings(
+	ctx context.Context, tx *sqlx.Tx, ratingID int64, mediaID uuid.UUID, ratings []*SecondaryRating, scale RatingScale,
+) error {
+	if len(ratings) == 0 {
+		return nil
+	}
+	var mediaKind string
+	if err := tx.GetContext(ctx, &mediaKind, `SELECT kind FROM media.media WHERE id = $1`, mediaID); err != nil {
+		return fmt.Errorf("error getting the kind of %s: %w", mediaID, err)
+	}
+	if err := normalizeSecondaryRatings(mediaKind, ratings, scale); err != nil {
+		return err
+	}
+	for _, r := range ratings {
+		err := tx.QueryRowxContext(ctx, `INSERT INTO reviews.secondary_ratings (rating_id, kind, stars)
+			VALUES ($1, $2, $3) RETURNING id`, ratingID, r.Kind, r.Stars).Scan(&r.ID)
+		if err != nil {
+			return fmt.Errorf("error inserting secondary rating %s: %w", r.Kind, err)
+		}
+		r.RatingID = ratingID
+	}
+	return nil
+}
+
+// normalizeSecondaryRatings checks that each aspect can be rated for the media kind and is rated once,
+// and converts the ratings to the reference scale
+func normalizeSecondaryRatings(mediaKind string, ratings []*SecondaryRating, scale RatingScale) error {
+	seen := make(map[string]bool, len(ratings))
+	for _, r := range ratings {
+		if !ValidAspect(mediaKind, r.Kind) {
+			return fmt.Errorf("%w: %q can't be rated for %s", ErrInvalidAspect, r.Kind, mediaKind)
+		}
+		if seen[r.Kind] {
+			return fmt.Errorf("%w: %q is rated twice", ErrInvalidAspect, r.Kind)
+		}
+		seen[r.Kind] = true
+		stars, err := scale.Normalize(r.NumStars)
+		if err != nil {
+			return fmt.Errorf("error rating %s: %w", r.Kind, err)
+		}
+		r.Stars = stars
+	}
+	return nil
+}
+
+// loadSecondaryRatings attaches the aspect ratings to the reviews
+func (rs *RatingStorage) loadSecondaryRatings(ctx context.Context, reviews ...*Review) error {
+	if len(reviews) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(reviews))
+	byID := make(map[int64]*Review, len(reviews))
+	for i := range reviews {
+		ids[i] = reviews[i].ID
+		byID[reviews[i].ID] = reviews[i]
+	}
+	var ratings []*SecondaryRating
+	err := rs.db.SelectContext(ctx, &ratings, `SELECT id, rating_id, kind, stars
+		FROM reviews.secondary_ratings WHERE rating_id = ANY($1)
+		ORDER BY kind`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("error getting secondary ratings: %w", err)
+	}
+	for _, r := range ratings {
+		if review, ok := byID[r.RatingID]; ok {
+			review.SecondaryRatings = append(review.SecondaryRatings, r)
+		}
+	}
+	return nil
+}
+
+// GetAspectAverages returns the average rating of each aspect of the media items on the reference scale,
+// along with the number of ratings. Several items are passed to get the averages of a work
+func (rs *RatingStorage) GetAspectAverages(ctx context.Context, mediaIDs ...uuid.UUID) ([]AspectAverage, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		ids := make([]string, len(mediaIDs))
+		for i := range mediaIDs {
+			ids[i] = mediaIDs[i].String()
+		}
+		averages := make([]AspectAverage, 0)
+		err := rs.db.SelectContext(ctx, &averages, `SELECT s.kind, AVG(s.stars) AS score, COUNT(*) AS count
+			FROM reviews.secondary_ratings s
+			JOIN `+publicReviews+` r ON r.id_numeric = s.rating_id
+			WHERE r.media_id = ANY($1::uuid[])
+			GROUP BY s.kind
+			ORDER BY s.kind`, pq.Array(ids))
+		if err != nil {
+			return nil, fmt.Errorf("error getting aspect averages: %w", err)
+		}
+		return averages, nil
+	}
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidAspect(t *testing.T) {
+	testCases := []struct {
+		kind, aspect string
+		valid        bool
+	}{
+		{"film", "acting", true},
+		{"episode", "acting", true},
+		{"album", "acting", false},
+		{"book", "acting", false},
+		{"game", "gameplay", true},
+		{"film", "gameplay", false},
+		{"anime", "gameplay", false},
+		{"album", "theme", true},
+		{"album", "soundtrack", false},
+		{"manga", "graphics", true},
+		{"book", "graphics", false},
+		{"book", "story", true},
+		{"film", "unknown", false},
+		{"unknown", "plotline", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.kind+"/"+tc.aspect, func(t *testing.T) {
+			assert.Equal(t, tc.valid, ValidAspect(tc.kind, tc.aspect))
+		})
+	}
+}
+
+func TestNormalizeSecondaryRatings(t *testing.T) {
+	scale := RatingScale{Lower: 1, Upper: 5, Step: 0.5}
+
+	ratings := []*SecondaryRating{{Kind: "acting", NumStars: 4}, {Kind: "soundtrack", NumStars: 2.5}}
+	require.NoError(t, normalizeSecondaryRatings("film", ratings, scale))
+	assert.Equal(t, int16(800), ratings[0].Stars)
+	assert.Equal(t, int16(500), ratings[1].Stars)
+
+	testCases := []struct {
+		name    string
+		kind    string
+		ratings []*SecondaryRating
+		err     error
+	}{
+		{"rated twice", "film", []*SecondaryRating{{Kind: "acting", NumStars: 4}, {Kind: "acting", NumStars: 3}}, ErrInvalidAspect},
+		{"not an aspect of the kind", "album", []*SecondaryRating{{Kind: "acting", NumStars: 4}}, ErrInvalidAspect},
+		{"out of the scale", "game", []*SecondaryRating{{Kind: "gameplay", NumStars: 6}}, ErrOutOfScale},
+		{"off the steps", "game", []*SecondaryRating{{Kind: "gameplay", NumStars: 3.3}}, ErrOutOfScale},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ErrorIs(t, normalizeSecondaryRatings(tc.kind, tc.ratings, scale), tc.err)
+		})
+	}
+}
+
+func TestRatingAverageRescale(t *testing.T) {
+	average := &RatingAverage{
+		BaseRatingScore:         700,
+		SecondaryRatingAverages: []SecondaryRatingAverage{{MediaKind: "track", Score: 600}},
+		Aspects: []AspectAverage{
+			{Kind: "acting", Score: 850, Count: 3},
+			{Kind: "scenario", Score: 410, Count: 2},
+		},
+	}
+	scale := RatingScale{Lower: 0, Upper: 100, Step: 1}
+	average.Rescale(scale)
+
+	assert.InDelta(t, 70, average.BaseRatingScore, 1e-9)
+	assert.InDelta(t, 60, average.SecondaryRatingAverages[0].Score, 1e-9)
+	assert.InDelta(t, 85, average.Aspects[0].Score, 1e-9)
+	assert.InDelta(t, 41, average.Aspects[1].Score, 1e-9)
+	assert.Equal(t, 3, average.Aspects[0].Count, "the counts aren't scaled")
+	assert.Equal(t, scale, average.Scale)
+}
@@ -173,6 +173,36 @@ func (s *Storage) AddImage(ctx context.Context, props *MediaProps) (dest string,
 	}
 }
 
+// SetThumbnail records the path of the thumbnail generated for an image
+func (s *Storage) SetThumbnail(ctx context.Context, imageID int64, thumbnail string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		_, err := s.db.ExecContext(ctx, `UPDATE cdn.images SET thumbnail = $1 WHERE id = $2`, thumbnail, imageID)
+		if err != nil {
+			return fmt.Errorf("error setting thumbnail of image %d: %w", imageID, err)
+		}
+		return nil
+	}
+}
+
+// AttachImage links an image to a media item, e.g. an album cover or a film poster
+func (s *Storage) AttachImage(ctx context.Context, mediaID uuid.UUID, imageID int64, isMain bool) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		_, err := s.db.ExecContext(ctx, `INSERT INTO media.media_images (media_id, image_id, is_main)
+			VALUES ($1, $2, $3) ON CONFLICT (media_id, image_id) DO UPDATE SET is_main = EXCLUDED.is_main`,
+			mediaID, imageID, isMain)
+		if err != nil {
+			return fmt.Errorf("error attaching image %d to %s: %w", imageID, mediaID, err)
+		}
+		return nil
+	}
+}
+
 func (s *Storage) GetOwner(ctx context.Context, imageID int64) (owner string, err error) {
 	select {
 	case <-ctx.Done():
@@ -0,0 +1,47 @@
+package static
+
+import (
+	"fmt"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"codeberg.org/mjh/LibRate/internal/lib/thumbnailer"
+)
+
+// SaveThumbnail scales down the image and saves it next to the original with the _thumb suffix,
+// e.g. static/img/music/<id>_thumb.jpg. It returns the path of the thumbnail
+func SaveThumbnail(dims thumbnailer.Dims, imagePath, mimeType string) (string, error) {
+	thumb, err := thumbnailer.Thumbnail(dims, imagePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create thumbnail for image %s: %w", imagePath, err)
+	}
+
+	thumbPath := strings.TrimSuffix(imagePath, filepath.Ext(imagePath)) + "_thumb" + filepath.Ext(imagePath)
+	f, err := os.Create(thumbPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to save thumbnail for image %s: %w", imagePath, err)
+	}
+	defer f.Close()
+
+	switch mimeType {
+	case "image/jpeg":
+		err = jpeg.Encode(f, thumb, nil)
+	case "image/png":
+		err = png.Encode(f, thumb)
+	case "image/gif":
+		err = gif.Encode(f, thumb, nil)
+	case "image/webp":
+		err = fmt.Errorf("WebP thumbnailing disabled since both libraries I've found break my builds")
+	default:
+		err = fmt.Errorf("unsupported MIME type %s", mimeType)
+	}
+	if err != nil {
+		os.Remove(thumbPath)
+		return "", fmt.Errorf("failed to encode thumbnail for image %s: %w", imagePath, err)
+	}
+	return thumbPath, nil
+}
@@ -25,6 +25,7 @@ import (
 	"codeberg.org/mjh/LibRate/cfg"
 	"codeberg.org/mjh/LibRate/controllers"
 	"codeberg.org/mjh/LibRate/controllers/auth"
+	"codeberg.org/mjh/LibRate/controllers/federation"
 	"codeberg.org/mjh/LibRate/controllers/form"
 	"codeberg.org/mjh/LibRate/controllers/media"
 	memberCtrl "codeberg.org/mjh/LibRate/controllers/members"
@@ -38,6 +39,7 @@ import (
 	mediaModels "codeberg.org/mjh/LibRate/models/media"
 	"codeberg.org/mjh/LibRate/models/member"
 	searchdb "codeberg.org/mjh/LibRate/models/search"
+	staticModels "codeberg.org/mjh/LibRate/models/static"
 )
 
 type RouterProps struct {
@@ -81,25 +83,49 @@ func Setup(ctx context.Context, r *RouterProps) error {
 	}
 	mediaStor = mediaModels.NewStorage(r.DB, r.LegacyDB, r.Log)
 
-	memberSvc := memberCtrl.NewController(mStor, r.LegacyDB, r.SessionHandler, r.Log, r.Conf)
-	formCon := form.NewController(r.Log, *mediaStor, r.Conf)
+	fedCon := federation.NewController(r.Log, r.LegacyDB, mStor, r.Conf)
+	memberSvc := memberCtrl.NewController(mStor, r.LegacyDB, r.SessionHandler, r.Log, r.Conf, fedCon)
+	formCon := form.NewController(r.Log, *mediaStor, mStor, r.Conf)
 	uploadSvc := static.NewController(r.Conf, r.LegacyDB, r.Log)
+	rStor := models.NewRatingStorage(r.LegacyDB, r.Log)
+	rStor.SetPublisher(fedCon)
 
 	r.App.Get("/api/version", version.Get)
 
-	setupReviews(api, r.SessionHandler, r.Log, r.Conf, r.LegacyDB)
+	reviewSvc := setupReviews(api, r.SessionHandler, r.Log, r.Conf, rStor, mediaStor)
 
 	setupAuth(api, r.SessionHandler, r.Log, r.Conf, mStor)
 
 	setupMembers(memberSvc, api, r.SessionHandler, r.Log, r.Conf)
 
-	setupMedia(api, mediaStor, r.Conf)
+	setupFederation(fedCon, r.App, api, r.SessionHandler, r.Log, r.Conf)
+
+	setupMedia(api, mediaStor, staticModels.NewStorage(r.LegacyDB, r.Log), rStor, mStor, r.SessionHandler, r.Log, r.Conf, fedCon)
 
 	// don't see a point encapsulating 2-3 routes in a separate function
 	formAPI := api.Group("/form")
 	formAPI.Post("/add_media/:type", middleware.Protected(r.SessionHandler, r.Log, r.Conf), timeout.NewWithContext(formCon.AddMedia, 10*time.Second))
 	formAPI.Post("/update_media/:type", middleware.Protected(r.SessionHandler, r.Log, r.Conf), formCon.UpdateMedia)
 
+	moderation := api.Group("/moderation", middleware.Protected(r.SessionHandler, r.Log, r.Conf))
+	moderation.Get("/queue", formCon.GetQueue)
+	moderation.Get("/duplicates", formCon.GetDuplicates)
+	moderation.Post("/duplicates/scan", formCon.ScanDuplicates)
+	moderation.Post("/duplicates/:id/merge", formCon.MergeDuplicate)
+	moderation.Post("/duplicates/:id/dismiss", formCon.DismissDuplicate)
+	moderation.Get("/:id", formCon.GetSubmission)
+	moderation.Post("/:id", formCon.Moderate)
+
+	// like the delivery workers, the scan and the score rebuild outlive the setup context
+	scanCtx, stopScan := context.WithCancel(context.Background())
+	r.App.Hooks().OnShutdown(func() error {
+		stopScan()
+		return nil
+	})
+	formCon.RunDuplicateScan(scanCtx)
+	reviewSvc.RunScoreRebuild(scanCtx)
+	reviewSvc.RunChartRefresh(scanCtx)
+
 	setupUpload(uploadSvc, api, r.SessionHandler, r.Log, r.Conf)
 
 	setupSearch(ctx, r.Validation, &r.Conf.Search, r.Cache, r.Log, api)
@@ -172,18 +198,66 @@ func setupMembers(memberSvc *memberCtrl.Controller, api fiber.Router, sess *sess
 	members.Get("/:email_or_username/info", memberSvc.GetMemberByNickOrEmail)
 }
 
-func setupReviews(api fiber.Router, sess *session.Store, logger *zerolog.Logger, conf *cfg.Config, dbConn *sqlx.DB) {
-	rStor := models.NewRatingStorage(dbConn, logger)
-	reviewSvc := controllers.NewReviewController(*rStor)
+func setupFederation(
+	fedCon *federation.FedController,
+	app *fiber.App,
+	api fiber.Router,
+	sess *session.Store,
+	logger *zerolog.Logger,
+	conf *cfg.Config,
+) {
+	wellKnown := app.Group("/.well-known")
+	wellKnown.Get("/webfinger", fedCon.WebFinger)
+	wellKnown.Get("/host-meta", fedCon.HostMeta)
+	wellKnown.Get("/nodeinfo", fedCon.NodeInfoDiscovery)
+	app.Get("/nodeinfo/2.1", fedCon.NodeInfo)
+
+	api.Post("/inbox", fedCon.In)
+	api.Get("/activities/:id", fedCon.Activity)
+
+	members := api.Group("/members")
+	members.Get("/:member_name", fedCon.Actor)
+	members.Post("/:member_name/inbox", fedCon.In)
+	members.Get("/:member_name/outbox", fedCon.Out)
+
+	domains := api.Group("/admin/federation/domains", middleware.Protected(sess, logger, conf))
+	domains.Get("/", fedCon.ListDomainPolicies)
+	domains.Put("/:domain", fedCon.SetDomainPolicy)
+	domains.Delete("/:domain", fedCon.RemoveDomainPolicy)
+
+	// the setup context is short-lived, so the delivery workers get their own
+	deliveryCtx, stopDelivery := context.WithCancel(context.Background())
+	app.Hooks().OnShutdown(func() error {
+		stopDelivery()
+		return nil
+	})
+	fedCon.RunDelivery(deliveryCtx)
+}
+
+func setupReviews(
+	api fiber.Router,
+	sess *session.Store,
+	logger *zerolog.Logger,
+	conf *cfg.Config,
+	rStor *models.RatingStorage,
+	mediaStor *mediaModels.Storage,
+) *controllers.ReviewController {
+	reviewSvc := controllers.NewReviewController(*rStor, mediaStor)
 
 	reviews := api.Group("/reviews")
-	reviews.Get("/latest", reviewSvc.GetLatest)
+	// the ratings are shown on the viewer's rating scale
+	reviews.Get("/latest", middleware.Identified(sess, logger, conf), reviewSvc.GetLatest)
 	reviews.Post("/", middleware.Protected(sess, logger, conf), reviewSvc.PostRating)
 	reviews.Patch("/:id", middleware.Protected(sess, logger, conf), reviewSvc.UpdateRating)
 	reviews.Delete("/:id", middleware.Protected(sess, logger, conf), reviewSvc.DeleteRating)
-	reviews.Get("/:media_id", reviewSvc.GetMediaReviews)
-	reviews.Get("/:media_id/average", reviewSvc.GetAverageRating)
-	reviews.Get("/:id", reviewSvc.GetByID)
+	reviews.Get("/:media_id", middleware.Identified(sess, logger, conf), reviewSvc.GetMediaReviews)
+	reviews.Get("/:media_id/average", middleware.Identified(sess, logger, conf), reviewSvc.GetAverageRating)
+	reviews.Get("/:media_id/histogram", middleware.Identified(sess, logger, conf), reviewSvc.GetHistogram)
+	reviews.Get("/:id", middleware.Identified(sess, logger, conf), reviewSvc.GetByID)
+
+	// the best rated media, narrowed down by kind, release years, genre, country and number of ratings
+	api.Get("/charts", middleware.Identified(sess, logger, conf), reviewSvc.GetChart)
+	return reviewSvc
 }
 
 func setupAuth(
@@ -207,14 +281,25 @@ func setupAuth(
 func setupMedia(
 	api fiber.Router,
 	mediaStor *mediaModels.Storage,
+	covers *staticModels.Storage,
+	ratings *models.RatingStorage,
+	members member.Storer,
+	sess *session.Store,
+	logger *zerolog.Logger,
 	conf *cfg.Config,
+	fedCon *federation.FedController,
 ) {
-	mediaCon := media.NewController(*mediaStor, conf)
+	mediaCon := media.NewController(*mediaStor, covers, ratings, conf, fedCon, members)
 
 	mediaRouter := api.Group("/media")
 	mediaRouter.Get("/random", mediaCon.GetRandom)
 	mediaRouter.Get("/import-sources", mediaCon.GetImportSources)
+	mediaRouter.Post("/works", middleware.Protected(sess, logger, conf), mediaCon.CreateWork)
+	mediaRouter.Get("/works/:id", mediaCon.GetWork)
+	mediaRouter.Put("/works/:id/editions/:media_id", middleware.Protected(sess, logger, conf), mediaCon.AddEdition)
+	mediaRouter.Delete("/works/:id/editions/:media_id", middleware.Protected(sess, logger, conf), mediaCon.RemoveEdition)
 	mediaRouter.Get("/:media_id/images", mediaCon.GetImagePaths)
+	mediaRouter.Get("/:media_id/titles", middleware.Identified(sess, logger, conf), mediaCon.GetTitles)
 	mediaRouter.Get("/:id", mediaCon.GetMedia)
 	mediaRouter.Get("/:media_id/cast", timeout.NewWithContext(mediaCon.GetCastByMediaID, 10*time.Second))
 	mediaRouter.Get("/creator", timeout.NewWithContext(mediaCon.GetCreatorByID, 10*time.Second))
@@ -222,7 +307,19 @@ func setupMedia(
 	// NOTE: singular to get a single genre, plural for more
 	mediaRouter.Get("/genre/:kind/:genre", timeout.NewWithContext(mediaCon.GetGenre, 30*time.Second))
 	mediaRouter.Post("/artists/by-name", timeout.NewWithContext(mediaCon.GetArtistsByName, 30*time.Second))
-	mediaRouter.Post("/import", timeout.NewWithContext(mediaCon.ImportWeb, 60*time.Second))
+	mediaRouter.Post("/import", middleware.Protected(sess, logger, conf), timeout.NewWithContext(mediaCon.ImportWeb, 60*time.Second))
+	mediaRouter.Post("/import/library", middleware.Protected(sess, logger, conf), mediaCon.ImportLibrary)
+	mediaRouter.Get("/import/library/:id", middleware.Protected(sess, logger, conf), mediaCon.GetLibraryImport)
+	mediaRouter.Post("/import/tags", middleware.Protected(sess, logger, conf), timeout.NewWithContext(mediaCon.ImportTags, 60*time.Second))
+	mediaRouter.Get("/import/jobs/:id", middleware.Protected(sess, logger, conf), mediaCon.GetImportJob)
+	mediaRouter.Post("/import/jobs/:id/confirm", middleware.Protected(sess, logger, conf), mediaCon.ConfirmImport)
+	mediaRouter.Delete("/import/jobs/:id", middleware.Protected(sess, logger, conf), mediaCon.CancelImport)
+
+	revisions := api.Group("/revisions")
+	revisions.Get("/:id/diff", mediaCon.DiffRevisions)
+	revisions.Post("/:id/revert", middleware.Protected(sess, logger, conf), mediaCon.RevertRevision)
+	revisions.Get("/:target/:id", mediaCon.GetRevisions)
+	revisions.Put("/:target/:id", middleware.Protected(sess, logger, conf), mediaCon.Edit)
 }
 
 func setupStatic(app *fiber.App, assets, artifacts string) error {
@@ -0,0 +1,104 @@
+// this file contains a test double for the inboxes of other ActivityPub servers
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+type (
+	// RemoteInbox records the activities delivered to it. It can be told to fail
+	// a number of deliveries and to respond slowly, to exercise retries and concurrency limits
+	RemoteInbox struct {
+		*httptest.Server
+		// Delay is applied to every request before responding
+		Delay time.Duration
+
+		mu            sync.Mutex
+		received      []ReceivedActivity
+		failures      []int
+		inFlight      int
+		maxConcurrent int
+	}
+
+	ReceivedActivity struct {
+		Method string
+		// RequestURI is the path and query, as used to build the signing string
+		RequestURI string
+		Header     http.Header
+		Body       []byte
+	}
+)
+
+// NewRemoteInbox starts a remote inbox. It must be closed after the test
+func NewRemoteInbox() *RemoteInbox {
+	ri := &RemoteInbox{}
+	ri.Server = httptest.NewServer(http.HandlerFunc(ri.handle))
+	return ri
+}
+
+// Inbox returns the URL to deliver activities to
+func (ri *RemoteInbox) Inbox() string {
+	return ri.URL + "/inbox"
+}
+
+// FailNext makes the next n deliveries fail with the given status code
+func (ri *RemoteInbox) FailNext(n, status int) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	for i := 0; i < n; i++ {
+		ri.failures = append(ri.failures, status)
+	}
+}
+
+// Received returns the activities which were accepted so far
+func (ri *RemoteInbox) Received() []ReceivedActivity {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	return append([]ReceivedActivity(nil), ri.received...)
+}
+
+// MaxConcurrent returns the highest number of deliveries handled at the same time
+func (ri *RemoteInbox) MaxConcurrent() int {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	return ri.maxConcurrent
+}
+
+func (ri *RemoteInbox) handle(w http.ResponseWriter, r *http.Request) {
+	ri.mu.Lock()
+	ri.inFlight++
+	ri.maxConcurrent = max(ri.maxConcurrent, ri.inFlight)
+	ri.mu.Unlock()
+	defer func() {
+		ri.mu.Lock()
+		ri.inFlight--
+		ri.mu.Unlock()
+	}()
+
+	time.Sleep(ri.Delay)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	if len(ri.failures) > 0 {
+		status := ri.failures[0]
+		ri.failures = ri.failures[1:]
+		w.WriteHeader(status)
+		return
+	}
+	ri.received = append(ri.received, ReceivedActivity{
+		Method:     r.Method,
+		RequestURI: r.URL.RequestURI(),
+		Header:     r.Header.Clone(),
+		Body:       body,
+	})
+	w.WriteHeader(http.StatusAccepted)
+}